@@ -0,0 +1,146 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// AnalysisCostMutator is the kind of the cost of running a mutator on all modules.
+	AnalysisCostMutator = "mutator"
+
+	// AnalysisCostModuleType is the kind of the cost of GenerateAndroidBuildActions for all
+	// modules of a module type.
+	AnalysisCostModuleType = "module_type"
+)
+
+// AnalysisCostsEnvVar is the environment variable that enables the collection of the analysis
+// costs when set to "true". Timing every mutator and module slows down soong_build, so they are
+// not collected by default.
+const AnalysisCostsEnvVar = "SOONG_COLLECT_ANALYSIS_COSTS"
+
+// AnalysisCost is the wall time spent by soong_build in a mutator or in GenerateAndroidBuildActions
+// of a module type, summed over all the module variants it was called for. Mutators and modules
+// run in parallel, so the total of all the costs can exceed the wall time of soong_build.
+type AnalysisCost struct {
+	Kind  string
+	Name  string
+	Calls int64
+	Time  time.Duration
+}
+
+type analysisCostCounter struct {
+	calls int64
+	nanos int64
+}
+
+var analysisCostsOnceKey = NewOnceKey("analysis costs")
+
+// analysisCounters returns the counters for the config, keyed by kind and name. A sync.Map is used
+// because the keys are written once and then read from many goroutines.
+func analysisCounters(config Config) *sync.Map {
+	return config.Once(analysisCostsOnceKey, func() interface{} {
+		return &sync.Map{}
+	}).(*sync.Map)
+}
+
+var analysisCostsEnabledOnceKey = NewOnceKey("analysis costs enabled")
+
+// AnalysisCostsEnabled returns true if the analysis costs are collected for the config.
+func AnalysisCostsEnabled(config Config) bool {
+	return config.Once(analysisCostsEnabledOnceKey, func() interface{} {
+		return config.IsEnvTrue(AnalysisCostsEnvVar)
+	}).(bool)
+}
+
+// startAnalysisCost returns a function that adds the time elapsed since the call to
+// startAnalysisCost to the cost of the given kind and name, or does nothing if the analysis costs
+// are not collected.
+func startAnalysisCost(config Config, kind, name string) func() {
+	if !AnalysisCostsEnabled(config) {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		recordAnalysisCost(config, kind, name, start)
+	}
+}
+
+// recordAnalysisCost adds the time elapsed since start to the cost of the given kind and name.
+func recordAnalysisCost(config Config, kind, name string, start time.Time) {
+	elapsed := time.Since(start)
+	counters := analysisCounters(config)
+	key := kind + "/" + name
+	counter, ok := counters.Load(key)
+	if !ok {
+		counter, _ = counters.LoadOrStore(key, &analysisCostCounter{})
+	}
+	atomic.AddInt64(&counter.(*analysisCostCounter).calls, 1)
+	atomic.AddInt64(&counter.(*analysisCostCounter).nanos, int64(elapsed))
+}
+
+// AnalysisCosts returns the analysis costs recorded for the config, the most expensive first.
+func AnalysisCosts(config Config) []AnalysisCost {
+	var costs []AnalysisCost
+	analysisCounters(config).Range(func(key, value interface{}) bool {
+		parts := strings.SplitN(key.(string), "/", 2)
+		counter := value.(*analysisCostCounter)
+		costs = append(costs, AnalysisCost{
+			Kind:  parts[0],
+			Name:  parts[1],
+			Calls: atomic.LoadInt64(&counter.calls),
+			Time:  time.Duration(atomic.LoadInt64(&counter.nanos)),
+		})
+		return true
+	})
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Time != costs[j].Time {
+			return costs[i].Time > costs[j].Time
+		}
+		if costs[i].Kind != costs[j].Kind {
+			return costs[i].Kind < costs[j].Kind
+		}
+		return costs[i].Name < costs[j].Name
+	})
+	return costs
+}
+
+// analysisCostReport formats the n most expensive analysis costs as a table.
+func analysisCostReport(costs []AnalysisCost, n int) string {
+	if len(costs) > n {
+		costs = costs[:n]
+	}
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%-12s %-12s %-11s %s\n", "time", "calls", "kind", "name")
+	for _, cost := range costs {
+		fmt.Fprintf(sb, "%-12s %-12d %-11s %s\n", cost.Time.Round(time.Microsecond), cost.Calls,
+			cost.Kind, cost.Name)
+	}
+	return sb.String()
+}
+
+// WriteAnalysisCostReport writes the n most expensive mutators and module types of the config to
+// reportFile.
+func WriteAnalysisCostReport(config Config, reportFile string, n int) error {
+	report := analysisCostReport(AnalysisCosts(config), n)
+	return ioutil.WriteFile(absolutePath(reportFile), []byte(report), 0666)
+}
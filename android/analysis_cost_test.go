@@ -0,0 +1,73 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalysisCosts(t *testing.T) {
+	prepareForAnalysisCostTest := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.PreDepsMutators(func(ctx RegisterMutatorsContext) {
+				ctx.BottomUp("analysis_cost_test", func(ctx BottomUpMutatorContext) {})
+			})
+		}),
+		FixtureWithRootAndroidBp(`
+			deps {
+				name: "foo",
+				deps: ["bar"],
+			}
+
+			deps {
+				name: "bar",
+			}
+		`),
+	)
+
+	// The costs are only collected when requested.
+	result := prepareForAnalysisCostTest.RunTest(t)
+	AssertIntEquals(t, "analysis costs", 0, len(AnalysisCosts(result.Config)))
+
+	result = GroupFixturePreparers(
+		prepareForAnalysisCostTest,
+		FixtureMergeEnv(map[string]string{
+			AnalysisCostsEnvVar: "true",
+		}),
+	).RunTest(t)
+
+	calls := make(map[string]int64)
+	for _, cost := range AnalysisCosts(result.Config) {
+		calls[cost.Kind+"/"+cost.Name] = cost.Calls
+	}
+	AssertIntEquals(t, "mutator calls", 2, int(calls["mutator/analysis_cost_test"]))
+	AssertIntEquals(t, "module type calls", 2, int(calls["module_type/deps"]))
+}
+
+func TestAnalysisCostReport(t *testing.T) {
+	costs := []AnalysisCost{
+		{Kind: AnalysisCostModuleType, Name: "cc_library", Calls: 1000, Time: 3 * time.Second},
+		{Kind: AnalysisCostMutator, Name: "deps", Calls: 4000, Time: 2 * time.Second},
+		{Kind: AnalysisCostMutator, Name: "arch", Calls: 2000, Time: time.Second},
+	}
+
+	AssertStringEquals(t, "report", ""+
+		"time         calls        kind        name\n"+
+		"3s           1000         module_type cc_library\n"+
+		"2s           4000         mutator     deps\n",
+		analysisCostReport(costs, 2))
+}
@@ -144,6 +144,33 @@ type ApexTestForInfo struct {
 
 var ApexTestForInfoProvider = blueprint.NewMutatorProvider(ApexTestForInfo{}, "apex_test_for")
 
+// ApexPayloadFile is a file in the payload of an APEX.
+type ApexPayloadFile struct {
+	// The path of the file relative to the root of the payload, e.g. lib64/libfoo.so.
+	PathInPayload string
+
+	// The file that is copied into the payload.
+	BuiltFile Path
+
+	// The name of the module that the file comes from, or an empty string if the file is generated
+	// by the APEX itself, e.g. etc/linker.config.pb.
+	SourceModule string
+
+	// Whether the file is installed in the payload. It is false if the file is replaced by a symlink
+	// to the same file in the system partition.
+	Installable bool
+}
+
+// ApexPayloadInfo is provided by APEXes to list the files in their payload, so that other modules,
+// e.g. filesystem images, SBOM generators and tests, can consume the contents of an APEX without
+// walking its dependencies.
+type ApexPayloadInfo struct {
+	// The files in the payload, sorted by their path in the payload.
+	Files []ApexPayloadFile
+}
+
+var ApexPayloadInfoProvider = blueprint.NewProvider(ApexPayloadInfo{})
+
 // DepIsInSameApex defines an interface that should be used to determine whether a given dependency
 // should be considered as part of the same APEX as the current module or not. Note: this was
 // extracted from ApexModule to make it easier to define custom subsets of the ApexModule interface
@@ -705,20 +732,43 @@ const (
 // apexContents, and modules in that apex have a provider containing the apexContents of each
 // apexBundle they are part of.
 type ApexContents struct {
+	// the name of the module of the apexBundle, e.g. com.mycompany.android.foo for an
+	// override_apex
+	apexModuleName string
+
+	// the apex_name of the apexBundle, i.e. the name of the directory /apex/<apex_name> in which it
+	// is activated on device
+	apexName string
+
 	// map from a module name to its membership in this apexBundle
 	contents map[string]ApexMembership
 }
 
 // NewApexContents creates and initializes an ApexContents that is suitable
 // for use with an apex module.
+// * apexModuleName is the name of the module of the apex, without the prebuilt_ prefix.
+// * apexName is the apex_name of the apex, which it is activated as on device.
 // * contents is a map from a module name to information about its membership within
 //   the apex.
-func NewApexContents(contents map[string]ApexMembership) *ApexContents {
+func NewApexContents(apexModuleName, apexName string, contents map[string]ApexMembership) *ApexContents {
 	return &ApexContents{
-		contents: contents,
+		apexModuleName: apexModuleName,
+		apexName:       apexName,
+		contents:       contents,
 	}
 }
 
+// ApexModuleName returns the name of the module of the apexBundle.
+func (ac *ApexContents) ApexModuleName() string {
+	return ac.apexModuleName
+}
+
+// ApexName returns the apex_name of the apexBundle, i.e. the name of the directory
+// /apex/<apex_name> in which it is activated on device.
+func (ac *ApexContents) ApexName() string {
+	return ac.apexName
+}
+
 // Updates an existing membership by adding a new direct (or indirect) membership
 func (i ApexMembership) Add(direct bool) ApexMembership {
 	if direct || i == directlyInApex {
@@ -926,6 +976,7 @@ func CheckMinSdkVersion(ctx ModuleContext, minSdkVersion ApiLevel, walk WalkPayl
 		return
 	}
 
+	checker := newMinSdkVersionChecker(minSdkVersion)
 	walk(ctx, func(ctx ModuleContext, from blueprint.Module, to ApexModule, externalDep bool) bool {
 		if externalDep {
 			// external deps are outside the payload boundary, which is "stable"
@@ -936,6 +987,7 @@ func CheckMinSdkVersion(ctx ModuleContext, minSdkVersion ApiLevel, walk WalkPayl
 		if am, ok := from.(DepIsInSameApex); ok && !am.DepIsInSameApex(ctx, to) {
 			return false
 		}
+		checker.recordPayloadModule(ctx, to)
 		if m, ok := to.(ModuleWithMinSdkVersionCheck); ok {
 			// This dependency performs its own min_sdk_version check, just make sure it sets min_sdk_version
 			// to trigger the check.
@@ -947,15 +999,16 @@ func CheckMinSdkVersion(ctx ModuleContext, minSdkVersion ApiLevel, walk WalkPayl
 		if err := to.ShouldSupportSdkVersion(ctx, minSdkVersion); err != nil {
 			toName := ctx.OtherModuleName(to)
 			if ver, ok := minSdkVersionAllowlist[toName]; !ok || ver.GreaterThan(minSdkVersion) {
-				ctx.OtherModuleErrorf(to, "should support min_sdk_version(%v) for %q: %v."+
-					"\n\nDependency path: %s\n\n"+
-					"Consider adding 'min_sdk_version: %q' to %q",
-					minSdkVersion, ctx.ModuleName(), err.Error(),
-					ctx.GetPathString(false),
-					minSdkVersion, toName)
+				checker.recordViolation(ctx, to, err)
 				return false
 			}
 		}
 		return true
 	})
+	checker.reportViolations(ctx)
+
+	ctx.SetProvider(MinSdkVersionPayloadInfoProvider, MinSdkVersionPayloadInfo{
+		MinSdkVersion:         minSdkVersion,
+		PayloadMinSdkVersions: checker.payload,
+	})
 }
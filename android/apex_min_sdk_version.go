@@ -0,0 +1,177 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// This file contains the support for reporting the result of CheckMinSdkVersion, i.e. the
+// min_sdk_version computed for each module in the payload of a module, e.g. an APEX, and the
+// dependency paths from that module to the modules that do not support its min_sdk_version.
+
+// MinSdkVersionPayloadInfo is provided by modules that check that their payload supports their
+// min_sdk_version.
+type MinSdkVersionPayloadInfo struct {
+	// The min_sdk_version that the payload was checked against.
+	MinSdkVersion ApiLevel
+
+	// Map from the name of each module in the payload to the min_sdk_version that it is built with,
+	// which is the min_sdk_version set on the module if any, otherwise the min_sdk_version of the
+	// variant of the module that is in the payload.
+	PayloadMinSdkVersions map[string]ApiLevel
+}
+
+var MinSdkVersionPayloadInfoProvider = blueprint.NewProvider(MinSdkVersionPayloadInfo{})
+
+// payloadMinSdkVersion returns the min_sdk_version that a module in the payload is built with.
+func payloadMinSdkVersion(ctx ModuleContext, module Module) ApiLevel {
+	var raw string
+	switch m := module.(type) {
+	case interface{ MinSdkVersion() string }:
+		raw = m.MinSdkVersion()
+	case interface{ MinSdkVersionString() string }:
+		raw = m.MinSdkVersionString()
+	}
+	if raw != "" && raw != "apex_inherit" {
+		if apiLevel, err := ApiLevelFromUser(ctx, raw); err == nil {
+			return apiLevel
+		}
+	}
+	return ctx.OtherModuleProvider(module, ApexInfoProvider).(ApexInfo).MinSdkVersion
+}
+
+// minSdkVersionViolation records a module that does not support the min_sdk_version of the
+// payload and the dependency paths through which it was reached.
+type minSdkVersionViolation struct {
+	module Module
+	err    error
+
+	// The dependency paths from the module being checked to the violating module and the
+	// pretty-printed tags of the dependencies along each path.
+	paths [][]Module
+	tags  [][]string
+}
+
+// minSdkVersionChecker collects the results of CheckMinSdkVersion while walking the payload.
+type minSdkVersionChecker struct {
+	minSdkVersion ApiLevel
+	payload       map[string]ApiLevel
+
+	// The violations, in the order in which their modules were first visited.
+	violations      []*minSdkVersionViolation
+	violationByName map[string]*minSdkVersionViolation
+}
+
+func newMinSdkVersionChecker(minSdkVersion ApiLevel) *minSdkVersionChecker {
+	return &minSdkVersionChecker{
+		minSdkVersion:   minSdkVersion,
+		payload:         make(map[string]ApiLevel),
+		violationByName: make(map[string]*minSdkVersionViolation),
+	}
+}
+
+// recordPayloadModule records the min_sdk_version of a module in the payload.
+func (c *minSdkVersionChecker) recordPayloadModule(ctx ModuleContext, module Module) {
+	c.payload[ctx.OtherModuleName(module)] = payloadMinSdkVersion(ctx, module)
+}
+
+// recordViolation records the current dependency path to a module that does not support the
+// min_sdk_version. It must be called from within the callback passed to WalkDeps.
+func (c *minSdkVersionChecker) recordViolation(ctx ModuleContext, module Module, err error) {
+	key := module.String()
+	violation := c.violationByName[key]
+	if violation == nil {
+		violation = &minSdkVersionViolation{module: module, err: err}
+		c.violationByName[key] = violation
+		c.violations = append(c.violations, violation)
+	}
+	var tags []string
+	for _, tag := range ctx.GetTagPath() {
+		tags = append(tags, PrettyPrintTag(tag))
+	}
+	violation.paths = append(violation.paths, append([]Module(nil), ctx.GetWalkPath()...))
+	violation.tags = append(violation.tags, tags)
+}
+
+// reportViolations reports an error for each module that does not support the min_sdk_version
+// along with a tree of the dependency paths from the module being checked to it.
+func (c *minSdkVersionChecker) reportViolations(ctx ModuleContext) {
+	for _, violation := range c.violations {
+		toName := ctx.OtherModuleName(violation.module)
+		ctx.OtherModuleErrorf(violation.module, "should support min_sdk_version(%v) for %q: %v."+
+			"\n\nDependency path:\n%s\n"+
+			"Consider adding 'min_sdk_version: %q' to %q",
+			c.minSdkVersion, ctx.ModuleName(), violation.err.Error(),
+			c.dependencyTree(ctx, violation),
+			c.minSdkVersion, toName)
+	}
+}
+
+// minSdkVersionDepNode is a node in the tree of dependency paths to a violating module.
+type minSdkVersionDepNode struct {
+	module   Module
+	tag      string
+	children []*minSdkVersionDepNode
+}
+
+func (n *minSdkVersionDepNode) child(module Module, tag string) *minSdkVersionDepNode {
+	for _, child := range n.children {
+		if child.module == module && child.tag == tag {
+			return child
+		}
+	}
+	child := &minSdkVersionDepNode{module: module, tag: tag}
+	n.children = append(n.children, child)
+	return child
+}
+
+// dependencyTree returns a textual tree of the dependency paths to the violating module, e.g.
+//
+//	myapex{...} min_sdk_version: 29
+//	└── mylib{...} min_sdk_version: 29
+//	        via tag cc.libraryDependencyTag: {Kind:sharedLibraryDependency ...}
+//	    └── mylib2{...} min_sdk_version: 29
+//	            via tag cc.libraryDependencyTag: {Kind:sharedLibraryDependency ...}
+func (c *minSdkVersionChecker) dependencyTree(ctx ModuleContext, violation *minSdkVersionViolation) string {
+	root := &minSdkVersionDepNode{module: violation.paths[0][0]}
+	for i, path := range violation.paths {
+		node := root
+		for j, module := range path[1:] {
+			node = node.child(module, violation.tags[i][j])
+		}
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s min_sdk_version: %v\n", root.module, c.minSdkVersion)
+	var walk func(node *minSdkVersionDepNode, indent string)
+	walk = func(node *minSdkVersionDepNode, indent string) {
+		for i, child := range node.children {
+			connector, childIndent := "├── ", indent+"│   "
+			if i == len(node.children)-1 {
+				connector, childIndent = "└── ", indent+"    "
+			}
+			fmt.Fprintf(sb, "%s%s%s min_sdk_version: %v\n", indent, connector, child.module,
+				payloadMinSdkVersion(ctx, child.module))
+			fmt.Fprintf(sb, "%s    via tag %s\n", childIndent, child.tag)
+			walk(child, childIndent)
+		}
+	}
+	walk(root, "")
+	return sb.String()
+}
@@ -239,6 +239,10 @@ func ApiLevelFromUserWithConfig(config Config, raw string) (ApiLevel, error) {
 		}
 	}
 
+	if draft := config.NdkDraftApiLevel(); !draft.IsNone() && raw == draft.String() {
+		return draft, nil
+	}
+
 	canonical := ReplaceFinalizedCodenames(config, raw)
 	asInt, err := strconv.Atoi(canonical)
 	if err != nil {
@@ -270,6 +274,21 @@ func ApiLevelForTest(raw string) ApiLevel {
 	return apiLevel
 }
 
+// PreviewApiLevelForTest returns a preview ApiLevel with the supplied codename, i.e. the ApiLevel
+// that Config.PreviewApiLevels() returns for the codename when it is at the supplied index in
+// Platform_version_active_codenames.
+func PreviewApiLevelForTest(codename string, index int) ApiLevel {
+	if codename == "" || codename == "current" {
+		panic(fmt.Errorf("%q is not a valid codename for a preview API level", codename))
+	}
+
+	return ApiLevel{
+		value:     codename,
+		number:    index,
+		isPreview: true,
+	}
+}
+
 // Converts an API level string `raw` into an ApiLevel in the same method as
 // `ApiLevelFromUser`, but the input is assumed to have no errors and any errors
 // will panic instead of returning an error.
@@ -375,6 +394,9 @@ func GetApiLevelsMap(config Config) map[string]int {
 		for i, codename := range config.PlatformVersionActiveCodenames() {
 			apiLevelsMap[codename] = previewAPILevelBase + i
 		}
+		if draft := config.NdkDraftApiLevel(); !draft.IsNone() {
+			apiLevelsMap[draft.String()] = previewAPILevelBase + len(config.PlatformVersionActiveCodenames())
+		}
 
 		return apiLevelsMap
 	}).(map[string]int)
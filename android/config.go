@@ -63,6 +63,10 @@ var FutureApiLevel = ApiLevel{
 // The product variables file name, containing product config from Kati.
 const productVariablesFileName = "soong.variables"
 
+// The Starlark product variables file name, containing product config evaluated from Starlark by
+// soong_ui, which overrides the product config from Kati.
+const starlarkProductVariablesFileName = "soong.starlark.variables"
+
 // A Config object represents the entire build configuration for Android.
 type Config struct {
 	*config
@@ -116,7 +120,8 @@ type config struct {
 	// purposes.
 	BazelContext BazelContext
 
-	ProductVariablesFileName string
+	ProductVariablesFileName         string
+	StarlarkProductVariablesFileName string
 
 	// BuildOS stores the OsType for the OS that the build is running on.
 	BuildOS OsType
@@ -182,12 +187,14 @@ type jsonConfigurable interface {
 }
 
 func loadConfig(config *config) error {
-	return loadFromConfigFile(&config.productVariables, absolutePath(config.ProductVariablesFileName))
+	return loadFromConfigFile(&config.productVariables, absolutePath(config.ProductVariablesFileName),
+		absolutePath(config.StarlarkProductVariablesFileName))
 }
 
 // loadFromConfigFile loads and decodes configuration options from a JSON file
-// in the current working directory.
-func loadFromConfigFile(configurable *productVariables, filename string) error {
+// in the current working directory, followed by the options evaluated from the
+// Starlark product config in starlarkFilename, if any.
+func loadFromConfigFile(configurable *productVariables, filename, starlarkFilename string) error {
 	// Try to open the file
 	configFileReader, err := os.Open(filename)
 	defer configFileReader.Close()
@@ -212,6 +219,12 @@ func loadFromConfigFile(configurable *productVariables, filename string) error {
 		}
 	}
 
+	if starlarkFilename != "" {
+		if err := loadFromStarlarkConfigFile(configurable, starlarkFilename); err != nil {
+			return err
+		}
+	}
+
 	if Bool(configurable.GcovCoverage) && Bool(configurable.ClangCoverage) {
 		return fmt.Errorf("GcovCoverage and ClangCoverage cannot both be set")
 	}
@@ -457,7 +470,8 @@ func ConfigForAdditionalRun(c Config) (Config, error) {
 func NewConfig(moduleListFile string, runGoTests bool, outDir, soongOutDir string, availableEnv map[string]string) (Config, error) {
 	// Make a config with default options.
 	config := &config{
-		ProductVariablesFileName: filepath.Join(soongOutDir, productVariablesFileName),
+		ProductVariablesFileName:         filepath.Join(soongOutDir, productVariablesFileName),
+		StarlarkProductVariablesFileName: filepath.Join(soongOutDir, starlarkProductVariablesFileName),
 
 		env: availableEnv,
 
@@ -585,6 +599,12 @@ func (c *config) mockFileSystem(bp string, fs map[string][]byte) {
 	c.mockBpList = blueprint.MockModuleListFile
 }
 
+// Fs returns the filesystem that source files are read from, which is a mock filesystem in tests.
+// Callers that read files through it must add a ninja file dependency on them.
+func (c *config) Fs() pathtools.FileSystem {
+	return c.fs
+}
+
 func (c *config) SetAllowMissingDependencies() {
 	c.productVariables.Allow_missing_dependencies = proptools.BoolPtr(true)
 }
@@ -753,6 +773,11 @@ func (c *config) PlatformSdkCodename() string {
 	return String(c.productVariables.Platform_sdk_codename)
 }
 
+// HasPlatformSdkExtensionVersion returns true if the SDK extension version of the platform is set.
+func (c *config) HasPlatformSdkExtensionVersion() bool {
+	return c.productVariables.Platform_sdk_extension_version != nil
+}
+
 func (c *config) PlatformSdkExtensionVersion() int {
 	return *c.productVariables.Platform_sdk_extension_version
 }
@@ -815,6 +840,21 @@ func (c *config) LatestPreviewApiLevel() ApiLevel {
 	return level
 }
 
+// NdkDraftApiLevel returns the in-development NDK API level named by Ndk_draft_api_level, which
+// is ordered after all the active codenames, or NoneApiLevel if it isn't set. Stubs are generated
+// for it so that its APIs can be used in-tree before they are finalized, by modules that opt in.
+func (c *config) NdkDraftApiLevel() ApiLevel {
+	codename := String(c.productVariables.Ndk_draft_api_level)
+	if codename == "" || InList(codename, c.PlatformVersionActiveCodenames()) {
+		return NoneApiLevel
+	}
+	return ApiLevel{
+		value:     codename,
+		number:    len(c.PlatformVersionActiveCodenames()),
+		isPreview: true,
+	}
+}
+
 func (c *config) AllSupportedApiLevels() []ApiLevel {
 	var levels []ApiLevel
 	levels = append(levels, c.FinalApiLevels()...)
@@ -862,6 +902,12 @@ func (c *config) ProductAAPTPrebuiltDPI() []string {
 	return c.productVariables.AAPTPrebuiltDPI
 }
 
+// ProductLocales returns the locales supported by the product, in the PRODUCT_LOCALES format, for
+// example en_US.
+func (c *config) ProductLocales() []string {
+	return c.productVariables.ProductLocales
+}
+
 func (c *config) DefaultAppCertificateDir(ctx PathContext) SourcePath {
 	defaultCert := String(c.productVariables.DefaultAppCertificate)
 	if defaultCert != "" {
@@ -1006,6 +1052,21 @@ func (c *config) RunErrorProne() bool {
 	return c.IsEnvTrue("RUN_ERROR_PRONE")
 }
 
+// SboxNetwork returns the network access of the commands run in sbox sandboxes, set with
+// SOONG_SBOX_NETWORK: "audit" to run them without network access where supported and log the ones
+// that need it to a network_audit.log file next to their manifest, "deny" to run them without
+// network access or fail them where that is not supported, or "" to allow network access.
+func (c *config) SboxNetwork() string {
+	return c.Getenv("SOONG_SBOX_NETWORK")
+}
+
+// PerProductIntermediates returns true if the intermediates of the device variants of modules are
+// namespaced by product, set with SOONG_PER_PRODUCT_INTERMEDIATES, so that multiple products can be
+// built into the same out directory.
+func (c *config) PerProductIntermediates() bool {
+	return c.IsEnvTrue("SOONG_PER_PRODUCT_INTERMEDIATES")
+}
+
 // XrefCorpusName returns the Kythe cross-reference corpus name.
 func (c *config) XrefCorpusName() string {
 	return c.Getenv("XREF_CORPUS")
@@ -1418,6 +1479,13 @@ func (c *config) VendorConfig(name string) VendorConfig {
 	return soongconfig.Config(c.productVariables.VendorVars[name])
 }
 
+// BuildFlag returns the value of the build flag with the given fully qualified name for this
+// product, and whether it is set.
+func (c *config) BuildFlag(name string) (string, bool) {
+	value, ok := c.productVariables.BuildFlags[name]
+	return value, ok
+}
+
 func (c *config) NdkAbis() bool {
 	return Bool(c.productVariables.Ndk_abis)
 }
@@ -1593,6 +1661,13 @@ func (c *deviceConfig) RecoverySnapshotModules() map[string]bool {
 	return c.config.productVariables.RecoverySnapshotModules
 }
 
+// ContentAddressedSnapshots returns true if vendor and recovery snapshots should store their
+// prebuilt files in a content-addressed blob store described by a manifest, so that several
+// snapshot versions can share identical files.
+func (c *deviceConfig) ContentAddressedSnapshots() bool {
+	return c.config.productVariables.ContentAddressedSnapshots
+}
+
 func createDirsMap(previous map[string]bool, dirs []string) (map[string]bool, error) {
 	var ret = make(map[string]bool)
 	for _, dir := range dirs {
@@ -1681,6 +1756,12 @@ func (c *deviceConfig) BuildBrokenInputDir(name string) bool {
 	return InList(name, c.config.productVariables.BuildBrokenInputDirModules)
 }
 
+// BuildBrokenVendorApexEtcDir returns true if the APEX with the given name may put prebuilts in
+// the directories reserved for vendor APEXes although it is not a vendor APEX.
+func (c *deviceConfig) BuildBrokenVendorApexEtcDir(name string) bool {
+	return InList(name, c.config.productVariables.BuildBrokenVendorApexEtcDirModules)
+}
+
 func (c *deviceConfig) RequiresInsecureExecmemForSwiftshader() bool {
 	return c.config.productVariables.RequiresInsecureExecmemForSwiftshader
 }
@@ -1709,6 +1790,59 @@ func (c *config) ForceMultilibFirstOnDevice() bool {
 	return c.productVariables.ForceMultilibFirstOnDevice
 }
 
+// NinjaPool returns the Ninja pool with the given name defined by the product.
+func (c *config) NinjaPool(name string) (NinjaPool, bool) {
+	for _, pool := range c.productVariables.NinjaPools {
+		if pool.Name == name {
+			return pool, true
+		}
+	}
+	return NinjaPool{}, false
+}
+
+// SystemServerDirtyImageObjects returns the path of the dirty image objects file of the product
+// that is used to lay out the app images of the system server jars, or "" if it is not set.
+func (c *config) SystemServerDirtyImageObjects() string {
+	return String(c.productVariables.SystemServerDirtyImageObjects)
+}
+
+// DedupBootJars returns true if the resources of the platform boot jars that are identical to those
+// of an earlier boot jar should be removed, e.g. to reduce the memory footprint on low-RAM devices.
+func (c *config) DedupBootJars() bool {
+	return c.productVariables.DedupBootJars
+}
+
+// CheckDuplicateClasses returns true if apps should fail to build when a class is contributed with
+// different contents by more than one of their sources and static_libs.
+func (c *config) CheckDuplicateClasses() bool {
+	return c.productVariables.CheckDuplicateClasses
+}
+
+// RustCrossLanguageLTO returns true if the Rust static libraries of the device are compiled to LLVM
+// bitcode, so that they are optimized together with the C/C++ code of the modules linking them.
+// rustc and clang must then use the same major version of LLVM, the Rust modules check that.
+func (c *config) RustCrossLanguageLTO() bool {
+	return c.productVariables.RustCrossLanguageLto
+}
+
+// DebugPathPrefixMaps returns the prefixes of absolute paths that are remapped in the debug info of
+// C/C++ and Rust artifacts when the RemapDebugPaths product variable is set, as "from=to" pairs, so
+// that artifacts built in different checkouts can be compared byte for byte and shared between
+// caches.
+//
+// The source tree needs no remapping, as the global flags of C/C++ (-fdebug-prefix-map with
+// /proc/self/cwd) and Rust (-Z remap-cwd-prefix) already remap the working directory, and the
+// sources and the output directory within it are referenced by relative paths. Only an output
+// directory outside the source tree is remapped to "out": its absolute path is then already on
+// the command lines. Java needs no remapping, as javac only records the file names of the sources
+// in the class files.
+func (c *config) DebugPathPrefixMaps() []string {
+	if !c.productVariables.RemapDebugPaths || !filepath.IsAbs(c.outDir) {
+		return nil
+	}
+	return []string{c.outDir + "=out"}
+}
+
 // The ConfiguredJarList struct provides methods for handling a list of (apex, jar) pairs.
 // Such lists are used in the build system for things like bootclasspath jars or system server jars.
 // The apex part is either an apex name, or a special names "platform" or "system_ext". Jar is a
@@ -97,7 +97,7 @@ func verifyProductVariableMarshaling(t *testing.T, v productVariables) {
 	}
 
 	var v2 productVariables
-	err = loadFromConfigFile(&v2, path)
+	err = loadFromConfigFile(&v2, path, "")
 	if err != nil {
 		t.Errorf("Couldn't load default product config: %q", err)
 	}
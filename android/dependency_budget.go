@@ -0,0 +1,202 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterDependencyBudgetBuildComponents(InitRegistrationContext)
+}
+
+func RegisterDependencyBudgetBuildComponents(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("dependency_budget", dependencyBudgetSingletonFactory)
+}
+
+type dependencyBudgetProperties struct {
+	// The maximum number of modules this module may depend on, directly or transitively. Each
+	// module is counted once regardless of how many of its variants are depended on.
+	Max_transitive_deps *int
+
+	// The maximum depth of the dependencies of this module, i.e. the number of modules in the
+	// longest chain of dependencies starting from this module, not counting this module.
+	Max_depth *int
+
+	// The maximum number of modules that may depend directly on this module. Each module is counted
+	// once regardless of how many of its variants depend on this module.
+	Max_fan_in *int
+
+	// List of module names that this module must not depend on, directly or transitively. The
+	// names may contain globs, e.g. "libfoo*".
+	Forbidden_deps []string
+}
+
+// checkDependencyBudget enforces the dependency_budget properties of the module and writes a
+// report listing its transitive dependencies, one per line and sorted so that changes to it can be
+// diffed, to dependency_budget.txt in the output directory of the module.
+func (m *ModuleBase) checkDependencyBudget(ctx ModuleContext) {
+	budget := m.commonProperties.Dependency_budget
+	if budget.Max_transitive_deps == nil && budget.Max_depth == nil && len(budget.Forbidden_deps) == 0 {
+		return
+	}
+
+	for _, pattern := range budget.Forbidden_deps {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			ctx.PropertyErrorf("dependency_budget.forbidden_deps", "invalid pattern %q: %s", pattern, err)
+			return
+		}
+	}
+
+	deps := make(map[string]bool)
+	// The direct dependencies of each module by name, with all the variants of a module merged.
+	edges := make(map[string]map[string]bool)
+	forbidden := make(map[string]string)
+	ctx.WalkDeps(func(child, parent Module) bool {
+		name := ctx.OtherModuleName(child)
+		if name == ctx.ModuleName() {
+			// Other variants of this module are not dependencies.
+			return true
+		}
+		parentName := ctx.OtherModuleName(parent)
+		if edges[parentName] == nil {
+			edges[parentName] = make(map[string]bool)
+		}
+		edges[parentName][name] = true
+		if deps[name] {
+			return false
+		}
+		deps[name] = true
+		for _, pattern := range budget.Forbidden_deps {
+			if match, _ := filepath.Match(pattern, name); match {
+				var path []string
+				for _, module := range ctx.GetWalkPath() {
+					path = append(path, ctx.OtherModuleName(module))
+				}
+				forbidden[name] = strings.Join(path, " -> ")
+				break
+			}
+		}
+		return true
+	})
+
+	depth, longest := longestDependencyChain(ctx.ModuleName(), edges)
+
+	names := SortedStringKeys(deps)
+	report := fmt.Sprintf("# %d transitive dependencies", len(names))
+	if budget.Max_transitive_deps != nil {
+		report += fmt.Sprintf(", budget %d", *budget.Max_transitive_deps)
+	}
+	report += fmt.Sprintf("\n# depth %d", depth)
+	if budget.Max_depth != nil {
+		report += fmt.Sprintf(", budget %d", *budget.Max_depth)
+	}
+	report += "\n" + strings.Join(names, "\n")
+	WriteFileRule(ctx, PathForModuleOut(ctx, "dependency_budget.txt"), report)
+
+	for _, name := range SortedStringKeys(forbidden) {
+		ctx.PropertyErrorf("dependency_budget.forbidden_deps", "depends on forbidden module %q: %s",
+			name, forbidden[name])
+	}
+
+	if limit := budget.Max_transitive_deps; limit != nil && len(names) > *limit {
+		ctx.PropertyErrorf("dependency_budget.max_transitive_deps",
+			"has %d transitive dependencies, exceeding the budget of %d:\n%s",
+			len(names), *limit, strings.Join(names, "\n"))
+	}
+
+	if limit := budget.Max_depth; limit != nil && depth > *limit {
+		ctx.PropertyErrorf("dependency_budget.max_depth",
+			"has a dependency depth of %d, exceeding the budget of %d: %s",
+			depth, *limit, strings.Join(longest, " -> "))
+	}
+}
+
+// longestDependencyChain returns the number of dependencies in the longest chain of dependencies
+// starting from root in the graph of direct dependencies, and the modules in the chain. A chain
+// ends at a module that is already in the chain, which can only happen when variants of different
+// modules depend on each other.
+func longestDependencyChain(root string, edges map[string]map[string]bool) (int, []string) {
+	longest := make(map[string][]string)
+	onChain := make(map[string]bool)
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if chain, ok := longest[name]; ok {
+			return chain
+		}
+		onChain[name] = true
+		var best []string
+		for _, dep := range SortedStringKeys(edges[name]) {
+			if onChain[dep] {
+				continue
+			}
+			if chain := visit(dep); len(chain) > len(best) {
+				best = chain
+			}
+		}
+		onChain[name] = false
+		longest[name] = append([]string{name}, best...)
+		return longest[name]
+	}
+	chain := visit(root)
+	return len(chain) - 1, chain
+}
+
+func dependencyBudgetSingletonFactory() Singleton {
+	return &dependencyBudgetSingleton{}
+}
+
+// dependencyBudgetSingleton enforces the max_fan_in property of dependency_budget, which can't be
+// checked by the module itself as it doesn't see the modules that depend on it.
+type dependencyBudgetSingleton struct{}
+
+func (s *dependencyBudgetSingleton) GenerateBuildActions(ctx SingletonContext) {
+	limits := make(map[string]int)
+	budgetModules := make(map[string]Module)
+	ctx.VisitAllModules(func(m Module) {
+		if limit := m.base().commonProperties.Dependency_budget.Max_fan_in; limit != nil {
+			limits[ctx.ModuleName(m)] = *limit
+			budgetModules[ctx.ModuleName(m)] = m
+		}
+	})
+	if len(limits) == 0 {
+		return
+	}
+
+	dependents := make(map[string]map[string]bool)
+	ctx.VisitAllModules(func(m Module) {
+		name := ctx.ModuleName(m)
+		ctx.VisitDirectDeps(m, func(dep Module) {
+			depName := ctx.ModuleName(dep)
+			if _, ok := limits[depName]; !ok || depName == name {
+				return
+			}
+			if dependents[depName] == nil {
+				dependents[depName] = make(map[string]bool)
+			}
+			dependents[depName][name] = true
+		})
+	})
+
+	for _, name := range SortedStringKeys(dependents) {
+		if len(dependents[name]) > limits[name] {
+			ctx.ModuleErrorf(budgetModules[name],
+				"dependency_budget.max_fan_in: has %d modules depending on it, exceeding the budget of %d:\n%s",
+				len(dependents[name]), limits[name], strings.Join(SortedStringKeys(dependents[name]), "\n"))
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"testing"
+)
+
+const dependencyBudgetTestModules = `
+	deps {
+		name: "bar",
+		deps: ["baz", "qux"],
+	}
+
+	deps {
+		name: "baz",
+		deps: ["qux"],
+	}
+
+	deps {
+		name: "qux",
+	}
+`
+
+func TestDependencyBudget(t *testing.T) {
+	result := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureWithRootAndroidBp(dependencyBudgetTestModules+`
+			deps {
+				name: "foo",
+				deps: ["bar"],
+				dependency_budget: {
+					max_transitive_deps: 3,
+					forbidden_deps: ["libc*"],
+				},
+			}
+		`),
+	).RunTest(t)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	AssertStringEquals(t, "dependency budget report",
+		"# 3 transitive dependencies, budget 3\n# depth 3\nbar\nbaz\nqux\n",
+		ContentFromFileRuleForTests(t, foo.Output("dependency_budget.txt")))
+
+	bar := result.ModuleForTests("bar", "android_common")
+	if bar.MaybeOutput("dependency_budget.txt").Rule != nil {
+		t.Errorf("expected no dependency budget report for a module without a budget")
+	}
+}
+
+func TestDependencyBudgetErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		budget string
+		err    string
+	}{
+		{
+			name:   "max transitive deps",
+			budget: `max_transitive_deps: 2`,
+			err: `dependency_budget.max_transitive_deps: ` +
+				`has 3 transitive dependencies, exceeding the budget of 2:\nbar\nbaz\nqux`,
+		},
+		{
+			name:   "forbidden deps",
+			budget: `forbidden_deps: ["q*"]`,
+			err: `dependency_budget.forbidden_deps: ` +
+				`depends on forbidden module "qux": foo -> bar -> baz -> qux`,
+		},
+		{
+			name:   "max depth",
+			budget: `max_depth: 2`,
+			err: `dependency_budget.max_depth: ` +
+				`has a dependency depth of 3, exceeding the budget of 2: foo -> bar -> baz -> qux`,
+		},
+		{
+			name:   "invalid pattern",
+			budget: `forbidden_deps: ["[q"]`,
+			err:    `dependency_budget.forbidden_deps: invalid pattern "\[q"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			GroupFixturePreparers(
+				prepareForModuleTests,
+				FixtureWithRootAndroidBp(dependencyBudgetTestModules+`
+					deps {
+						name: "foo",
+						deps: ["bar"],
+						dependency_budget: {`+tc.budget+`},
+					}
+				`),
+			).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(tc.err)).
+				RunTest(t)
+		})
+	}
+}
+
+func TestDependencyBudgetMaxFanIn(t *testing.T) {
+	prepareForDependencyBudgetTest := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(RegisterDependencyBudgetBuildComponents),
+	)
+
+	bp := func(budget int) string {
+		return fmt.Sprintf(`
+			deps {
+				name: "foo",
+				deps: ["bar", "baz"],
+			}
+
+			deps {
+				name: "bar",
+				deps: ["baz"],
+			}
+
+			deps {
+				name: "baz",
+				dependency_budget: {
+					max_fan_in: %d,
+				},
+			}
+		`, budget)
+	}
+
+	GroupFixturePreparers(
+		prepareForDependencyBudgetTest,
+		FixtureWithRootAndroidBp(bp(2)),
+	).RunTest(t)
+
+	GroupFixturePreparers(
+		prepareForDependencyBudgetTest,
+		FixtureWithRootAndroidBp(bp(1)),
+	).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(
+		`dependency_budget.max_fan_in: has 2 modules depending on it, exceeding the budget of 1:\nbar\nfoo`)).
+		RunTest(t)
+}
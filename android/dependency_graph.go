@@ -0,0 +1,208 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// The formats supported by WriteDependencyGraph.
+const (
+	DependencyGraphFormatDot     = "dot"
+	DependencyGraphFormatMermaid = "mermaid"
+)
+
+// Fill colors of the nodes, assigned to the module types in the graph in alphabetical order.
+var dependencyGraphColors = []string{
+	"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3", "#fdb462",
+	"#b3de69", "#fccde5", "#d9d9d9", "#bc80bd", "#ccebc5", "#ffed6f",
+}
+
+type dependencyGraphNode struct {
+	// qualified name of the module, //<dir>:<name>, which is unique across namespaces
+	name       string
+	variant    string
+	moduleType string
+	apexes     map[string]bool
+	deps       map[string]bool
+}
+
+func (n *dependencyGraphNode) label(newline string) string {
+	lines := []string{n.name}
+	if n.variant != "" {
+		lines = append(lines, n.variant)
+	}
+	lines = append(lines, n.moduleType)
+	if len(n.apexes) > 0 {
+		lines = append(lines, "apex: "+strings.Join(SortedStringKeys(n.apexes), ", "))
+	}
+	return strings.Join(lines, newline)
+}
+
+// WriteDependencyGraph writes the dependencies of the module named root, up to depth levels deep,
+// in the given format, either "dot" or "mermaid". Each variant of a module is a separate node,
+// which is colored by module type and lists the apexes the variant is included in. The root may be
+// a module name or, to select a module in a namespace, a qualified name //<dir>:<name>. A depth of
+// 0 or less includes all transitive dependencies.
+func WriteDependencyGraph(ctx *Context, w io.Writer, root string, depth int, format string) error {
+	if format != DependencyGraphFormatDot && format != DependencyGraphFormatMermaid {
+		return fmt.Errorf("unsupported graph format %q, expected %q or %q",
+			format, DependencyGraphFormatDot, DependencyGraphFormatMermaid)
+	}
+
+	qualifiedName := func(module blueprint.Module) string {
+		dir := ctx.ModuleDir(module)
+		if dir == "." {
+			dir = ""
+		}
+		return "//" + dir + ":" + ctx.ModuleName(module)
+	}
+	nodeKey := func(module blueprint.Module) string {
+		return qualifiedName(module) + " " + ctx.ModuleSubDir(module)
+	}
+
+	nodes := make(map[string]*dependencyGraphNode)
+	getNode := func(module blueprint.Module) *dependencyGraphNode {
+		key := nodeKey(module)
+		n, ok := nodes[key]
+		if !ok {
+			n = &dependencyGraphNode{
+				name:       qualifiedName(module),
+				variant:    ctx.ModuleSubDir(module),
+				moduleType: ctx.ModuleType(module),
+				apexes:     make(map[string]bool),
+				deps:       make(map[string]bool),
+			}
+			nodes[key] = n
+		}
+		return n
+	}
+
+	var roots []string
+	rootNames := make(map[string]bool)
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		n := getNode(module)
+		if info, ok := ctx.ModuleProvider(module, ApexInfoProvider).(ApexInfo); ok {
+			for _, apex := range info.InApexVariants {
+				n.apexes[apex] = true
+			}
+		}
+		ctx.VisitDirectDeps(module, func(dep blueprint.Module) {
+			if key := nodeKey(dep); key != nodeKey(module) {
+				getNode(dep)
+				n.deps[key] = true
+			}
+		})
+		if ctx.ModuleName(module) == root || n.name == root {
+			roots = append(roots, nodeKey(module))
+			rootNames[n.name] = true
+		}
+	})
+
+	if len(roots) == 0 {
+		return fmt.Errorf("module %q not found", root)
+	} else if len(rootNames) > 1 {
+		return fmt.Errorf("module %q is ambiguous, use one of %s", root,
+			strings.Join(SortedStringKeys(rootNames), ", "))
+	}
+	sort.Strings(roots)
+
+	// Collect the nodes reachable from the variants of root in breadth first order.
+	included := make(map[string]bool)
+	for _, key := range roots {
+		included[key] = true
+	}
+	order := append([]string(nil), roots...)
+	for level, current := 1, roots; len(current) > 0 && (depth <= 0 || level <= depth); level++ {
+		var next []string
+		for _, key := range current {
+			for _, dep := range SortedStringKeys(nodes[key].deps) {
+				if !included[dep] {
+					included[dep] = true
+					order = append(order, dep)
+					next = append(next, dep)
+				}
+			}
+		}
+		current = next
+	}
+
+	colors := make(map[string]string)
+	var moduleTypes []string
+	for _, key := range order {
+		if _, ok := colors[nodes[key].moduleType]; !ok {
+			colors[nodes[key].moduleType] = ""
+			moduleTypes = append(moduleTypes, nodes[key].moduleType)
+		}
+	}
+	sort.Strings(moduleTypes)
+	for i, t := range moduleTypes {
+		colors[t] = dependencyGraphColors[i%len(dependencyGraphColors)]
+	}
+
+	ids := make(map[string]string)
+	for i, key := range order {
+		ids[key] = fmt.Sprintf("n%d", i)
+	}
+
+	buf := bufio.NewWriter(w)
+	if format == DependencyGraphFormatDot {
+		fmt.Fprintf(buf, "digraph %q {\n", root)
+		fmt.Fprintf(buf, "  node [shape=box, style=filled];\n")
+		for _, key := range order {
+			n := nodes[key]
+			attrs := fmt.Sprintf("label=%q, fillcolor=%q", n.label("\n"), colors[n.moduleType])
+			if len(n.apexes) > 0 {
+				attrs += ", penwidth=3"
+			}
+			fmt.Fprintf(buf, "  %s [%s];\n", ids[key], attrs)
+		}
+		for _, key := range order {
+			for _, dep := range SortedStringKeys(nodes[key].deps) {
+				if included[dep] {
+					fmt.Fprintf(buf, "  %s -> %s;\n", ids[key], ids[dep])
+				}
+			}
+		}
+		fmt.Fprintf(buf, "}\n")
+	} else {
+		fmt.Fprintf(buf, "graph LR\n")
+		for _, key := range order {
+			fmt.Fprintf(buf, "  %s[\"%s\"]\n", ids[key], nodes[key].label("<br/>"))
+		}
+		for _, key := range order {
+			for _, dep := range SortedStringKeys(nodes[key].deps) {
+				if included[dep] {
+					fmt.Fprintf(buf, "  %s --> %s\n", ids[key], ids[dep])
+				}
+			}
+		}
+		for _, key := range order {
+			n := nodes[key]
+			style := "fill:" + colors[n.moduleType]
+			if len(n.apexes) > 0 {
+				style += ",stroke-width:4px"
+			}
+			fmt.Fprintf(buf, "  style %s %s\n", ids[key], style)
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDependencyGraph(t *testing.T) {
+	result := GroupFixturePreparers(
+		prepareForModuleTests,
+		PrepareForTestWithNamespace,
+		FixtureWithRootAndroidBp(`
+			deps {
+				name: "foo",
+				deps: ["bar", "baz"],
+			}
+
+			deps {
+				name: "bar",
+				deps: ["baz"],
+			}
+
+			deps {
+				name: "baz",
+				deps: ["qux"],
+			}
+
+			deps {
+				name: "qux",
+			}
+		`),
+		FixtureAddTextFile("other/Android.bp", `
+			soong_namespace {
+			}
+
+			deps {
+				name: "qux",
+				host_supported: true,
+			}
+		`),
+	).RunTest(t)
+
+	writeGraph := func(root string, depth int, format string) string {
+		t.Helper()
+		var sb strings.Builder
+		if err := WriteDependencyGraph(result.TestContext.Context, &sb, root, depth, format); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return sb.String()
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		graph := writeGraph("foo", 1, "dot")
+		AssertStringDoesContain(t, "header", graph, `digraph "foo" {`)
+		AssertStringDoesContain(t, "foo node", graph, `n0 [label="//:foo\nandroid_common\ndeps", fillcolor="#8dd3c7"];`)
+		AssertStringDoesContain(t, "bar node", graph, `n1 [label="//:bar\nandroid_common\ndeps", fillcolor="#8dd3c7"];`)
+		AssertStringDoesContain(t, "baz node", graph, `n2 [label="//:baz\nandroid_common\ndeps", fillcolor="#8dd3c7"];`)
+		AssertStringDoesContain(t, "foo -> bar", graph, "n0 -> n1;")
+		AssertStringDoesContain(t, "foo -> baz", graph, "n0 -> n2;")
+		AssertStringDoesContain(t, "bar -> baz", graph, "n1 -> n2;")
+		AssertStringDoesNotContain(t, "qux beyond depth", graph, "qux")
+	})
+
+	t.Run("mermaid all", func(t *testing.T) {
+		graph := writeGraph("foo", 0, "mermaid")
+		AssertStringDoesContain(t, "header", graph, "graph LR\n")
+		AssertStringDoesContain(t, "qux node", graph, `n3["//:qux<br/>android_common<br/>deps"]`)
+		AssertStringDoesContain(t, "baz --> qux", graph, "n2 --> n3")
+		AssertStringDoesContain(t, "qux style", graph, "style n3 fill:#8dd3c7")
+		AssertStringDoesNotContain(t, "qux in namespace", graph, "//other:qux")
+	})
+
+	t.Run("namespaces and variants", func(t *testing.T) {
+		graph := writeGraph("//other:qux", 1, "dot")
+		AssertStringDoesContain(t, "device variant", graph, `label="//other:qux\nandroid_common\ndeps"`)
+		AssertStringDoesContain(t, "host variant", graph, `label="//other:qux\nlinux_glibc_common\ndeps"`)
+		AssertStringDoesNotContain(t, "qux in root namespace", graph, "//:qux")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var sb strings.Builder
+		err := WriteDependencyGraph(result.TestContext.Context, &sb, "missing", 1, "dot")
+		AssertErrorMessageEquals(t, "missing module", `module "missing" not found`, err)
+		err = WriteDependencyGraph(result.TestContext.Context, &sb, "qux", 1, "dot")
+		AssertErrorMessageEquals(t, "ambiguous module", `module "qux" is ambiguous, use one of //:qux, //other:qux`, err)
+		err = WriteDependencyGraph(result.TestContext.Context, &sb, "foo", 1, "svg")
+		AssertErrorMessageEquals(t, "bad format", `unsupported graph format "svg", expected "dot" or "mermaid"`, err)
+	})
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// applyEnabledIf disables the module if its enabled_if expression evaluates to false for the
+// product variables of the current product.
+func applyEnabledIf(ctx BottomUpMutatorContext, m *ModuleBase) {
+	expr := m.commonProperties.Enabled_if
+	if expr == nil {
+		return
+	}
+
+	enabled, err := evalProductVariableExpr(*expr, ctx.Config().productVariables)
+	if err != nil {
+		ctx.PropertyErrorf("enabled_if", "%s", err)
+		return
+	}
+	if !enabled {
+		m.commonProperties.Enabled = proptools.BoolPtr(false)
+	}
+}
+
+// evalProductVariableExpr evaluates a boolean expression over boolean product variables. The
+// expression consists of product variable names, either as used in product_variables, e.g. "eng"
+// or "unbundled_build", or as in the product variables file, e.g. "Eng" or "UseRBE", combined with
+// the "!", "&&" and "||" operators and parentheses. A product variable that is not set is false.
+func evalProductVariableExpr(expr string, variables productVariables) (bool, error) {
+	p := &productVariableExprParser{
+		tokens:    tokenizeProductVariableExpr(expr),
+		variables: reflect.ValueOf(variables),
+	}
+	result := p.parseOr()
+	if p.err == nil && p.pos < len(p.tokens) {
+		p.errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if p.err != nil {
+		return false, fmt.Errorf("invalid expression %q: %s", expr, p.err)
+	}
+	return result, nil
+}
+
+func tokenizeProductVariableExpr(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case isProductVariableExprIdentRune(c):
+			j := i
+			for j < len(expr) && isProductVariableExprIdentRune(rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			tokens = append(tokens, expr[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func isProductVariableExprIdentRune(c rune) bool {
+	return c == '_' || (c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)))
+}
+
+type productVariableExprParser struct {
+	tokens    []string
+	pos       int
+	variables reflect.Value
+	err       error
+}
+
+func (p *productVariableExprParser) errorf(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *productVariableExprParser) accept(token string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos] == token {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// The operands of "&&" and "||" are always evaluated so that errors in them are reported.
+func (p *productVariableExprParser) parseOr() bool {
+	result := p.parseAnd()
+	for p.accept("||") {
+		operand := p.parseAnd()
+		result = result || operand
+	}
+	return result
+}
+
+func (p *productVariableExprParser) parseAnd() bool {
+	result := p.parseUnary()
+	for p.accept("&&") {
+		operand := p.parseUnary()
+		result = result && operand
+	}
+	return result
+}
+
+func (p *productVariableExprParser) parseUnary() bool {
+	if p.accept("!") {
+		return !p.parseUnary()
+	}
+	if p.accept("(") {
+		result := p.parseOr()
+		if !p.accept(")") {
+			p.errorf("missing \")\"")
+		}
+		return result
+	}
+	if p.pos >= len(p.tokens) {
+		p.errorf("unexpected end of expression")
+		return false
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	if !isProductVariableExprIdentRune(rune(token[0])) {
+		p.errorf("unexpected %q", token)
+		return false
+	}
+	return p.lookup(token)
+}
+
+func (p *productVariableExprParser) lookup(name string) bool {
+	val := p.variables.FieldByName(proptools.FieldNameForProperty(name))
+	if !val.IsValid() {
+		p.errorf("unknown product variable %q", name)
+		return false
+	}
+	if val.Kind() == reflect.Ptr {
+		if val.Type().Elem().Kind() != reflect.Bool {
+			p.errorf("product variable %q is not a boolean", name)
+			return false
+		}
+		return !val.IsNil() && val.Elem().Bool()
+	}
+	if val.Kind() != reflect.Bool {
+		p.errorf("product variable %q is not a boolean", name)
+		return false
+	}
+	return val.Bool()
+}
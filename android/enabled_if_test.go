@@ -0,0 +1,117 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+)
+
+func TestEvalProductVariableExpr(t *testing.T) {
+	platformSdkVersion := 31
+	variables := productVariables{
+		Eng:                  proptools.BoolPtr(true),
+		Debuggable:           proptools.BoolPtr(false),
+		UseRBE:               proptools.BoolPtr(true),
+		Platform_sdk_version: &platformSdkVersion,
+	}
+
+	testCases := []struct {
+		expr     string
+		expected bool
+		err      string
+	}{
+		{expr: "eng", expected: true},
+		{expr: "debuggable", expected: false},
+		{expr: "unbundled_build", expected: false},
+		{expr: "!unbundled_build", expected: true},
+		{expr: "eng && debuggable", expected: false},
+		{expr: "eng || debuggable", expected: true},
+		{expr: "!(eng && !debuggable)", expected: false},
+		{expr: "debuggable || eng && !unbundled_build", expected: true},
+		{expr: "", err: `invalid expression "": unexpected end of expression`},
+		{expr: "eng &&", err: `invalid expression "eng &&": unexpected end of expression`},
+		{expr: "(eng", err: `invalid expression "(eng": missing ")"`},
+		{expr: "eng debuggable", err: `invalid expression "eng debuggable": unexpected "debuggable"`},
+		{expr: "eng & debuggable", err: `invalid expression "eng & debuggable": unexpected "&"`},
+		{expr: "Eng", expected: true},
+		{expr: "UseRBE && !debuggable", expected: true},
+		{expr: "useRBE", expected: true},
+		{expr: "eng || foo", err: `invalid expression "eng || foo": unknown product variable "foo"`},
+		{expr: "platform_sdk_version", err: `invalid expression "platform_sdk_version": product variable "platform_sdk_version" is not a boolean`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			result, err := evalProductVariableExpr(tc.expr, variables)
+			if tc.err != "" {
+				AssertErrorMessageEquals(t, "error", tc.err, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			AssertBoolEquals(t, "result", tc.expected, result)
+		})
+	}
+}
+
+func TestEnabledIf(t *testing.T) {
+	bp := `
+		deps {
+			name: "foo",
+			enabled_if: "eng && !unbundled_build",
+		}
+
+		deps {
+			name: "bar",
+			enabled_if: "unbundled_build",
+		}
+
+		deps {
+			name: "baz",
+			enabled: false,
+			enabled_if: "eng",
+		}
+	`
+
+	result := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureModifyProductVariables(func(variables FixtureProductVariables) {
+			variables.Eng = proptools.BoolPtr(true)
+		}),
+		FixtureRegisterWithContext(registerVariableBuildComponents),
+		FixtureWithRootAndroidBp(bp),
+	).RunTest(t)
+
+	for name, enabled := range map[string]bool{"foo": true, "bar": false, "baz": false} {
+		module := result.ModuleForTests(name, "android_common").Module()
+		AssertBoolEquals(t, name+" enabled", enabled, module.Enabled())
+	}
+
+	GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(registerVariableBuildComponents),
+		FixtureWithRootAndroidBp(`
+			deps {
+				name: "foo",
+				enabled_if: "eng &&",
+			}
+		`),
+	).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(
+		`module "foo": enabled_if: invalid expression "eng &&": unexpected end of expression`)).
+		RunTest(t)
+}
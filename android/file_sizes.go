@@ -0,0 +1,37 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strconv"
+)
+
+// FileSizesCommand adds a command to the rule that reads the entries file and writes each of its
+// lines to the standard output with the paths replaced by the sizes of the files in bytes. Each
+// line is a tab separated list of keyColumns keys followed by the paths of files, or "-" for a
+// file that takes no space such as a symlink, whose size is 0. The files must be listed in files,
+// they are added as implicit inputs. The output can be piped into another command to add totals
+// or differences to a report, and then written to the output of the rule.
+//
+// wc -c is used instead of stat as stat has different flags on Linux and Darwin, and adding 0 drops
+// the padding that wc adds on Darwin.
+func FileSizesCommand(rule *RuleBuilder, entries Path, keyColumns int, files Paths) *RuleBuilderCommand {
+	return rule.Command().
+		Text(`awk -F '\t' -v OFS='\t'`).
+		FlagWithArg("-v keys=", strconv.Itoa(keyColumns)).
+		Text(`'{ for (i = keys + 1; i <= NF; i++) { size = 0; if ($i != "-") { cmd = "wc -c < \"" $i "\""; cmd | getline size; close(cmd); size += 0 } $i = size } print }'`).
+		Input(entries).
+		Implicits(FirstUniquePaths(files))
+}
@@ -44,6 +44,7 @@ type bazelFilegroupAttributes struct {
 func (fg *fileGroup) ConvertWithBp2build(ctx TopDownMutatorContext) {
 	srcs := bazel.MakeLabelListAttribute(
 		BazelLabelForModuleSrcExcludes(ctx, fg.properties.Srcs, fg.properties.Exclude_srcs))
+	fg.addVariantSrcsToBazelAttribute(ctx, &srcs)
 
 	// For Bazel compatibility, don't generate the filegroup if there is only 1
 	// source file, and that the source file is named the same as the module
@@ -77,6 +78,37 @@ func (fg *fileGroup) ConvertWithBp2build(ctx TopDownMutatorContext) {
 	ctx.CreateBazelTargetModule(props, CommonAttributes{Name: fg.Name()}, attrs)
 }
 
+// addVariantSrcsToBazelAttribute adds the arch and target specific srcs of the filegroup to the
+// selects of the srcs attribute. The srcs of target.host are added to each host OS.
+func (fg *fileGroup) addVariantSrcsToBazelAttribute(ctx TopDownMutatorContext, srcs *bazel.LabelListAttribute) {
+	arch := &fg.properties.Arch
+	target := &fg.properties.Target
+	addSelectValue := func(axis bazel.ConfigurationAxis, config string, props ...*fileGroupVariantProperties) {
+		var variantSrcs, excludeSrcs []string
+		for _, p := range props {
+			variantSrcs = append(variantSrcs, p.Srcs...)
+			excludeSrcs = append(excludeSrcs, p.Exclude_srcs...)
+		}
+		if len(variantSrcs) == 0 && len(excludeSrcs) == 0 {
+			return
+		}
+		// The excludes also apply to the srcs of the filegroup, which is handled by ResolveExcludes.
+		srcs.SetSelectValue(axis, config, BazelLabelForModuleSrcExcludes(ctx, variantSrcs, excludeSrcs))
+	}
+
+	addSelectValue(bazel.ArchConfigurationAxis, Arm.Name, &arch.Arm)
+	addSelectValue(bazel.ArchConfigurationAxis, Arm64.Name, &arch.Arm64)
+	addSelectValue(bazel.ArchConfigurationAxis, X86.Name, &arch.X86)
+	addSelectValue(bazel.ArchConfigurationAxis, X86_64.Name, &arch.X86_64)
+	addSelectValue(bazel.OsConfigurationAxis, Android.Name, &target.Android)
+	addSelectValue(bazel.OsConfigurationAxis, Linux.Name, &target.Host, &target.Linux_glibc)
+	addSelectValue(bazel.OsConfigurationAxis, LinuxMusl.Name, &target.Host, &target.Linux_musl)
+	addSelectValue(bazel.OsConfigurationAxis, LinuxBionic.Name, &target.Host, &target.Linux_bionic)
+	addSelectValue(bazel.OsConfigurationAxis, Darwin.Name, &target.Host, &target.Darwin)
+	addSelectValue(bazel.OsConfigurationAxis, Windows.Name, &target.Host, &target.Windows)
+	srcs.ResolveExcludes()
+}
+
 type fileGroupProperties struct {
 	// srcs lists files that will be included in this filegroup
 	Srcs []string `android:"path"`
@@ -92,6 +124,42 @@ type fileGroupProperties struct {
 	// Create a make variable with the specified name that contains the list of files in the
 	// filegroup, relative to the root of the source tree.
 	Export_to_make_var *string
+
+	// Architecture specific files, used when the filegroup is a dependency of a module variant that
+	// targets the architecture, e.g. a cc_library built for arm64.
+	Arch struct {
+		Arm    fileGroupVariantProperties
+		Arm64  fileGroupVariantProperties
+		X86    fileGroupVariantProperties
+		X86_64 fileGroupVariantProperties
+	}
+
+	// OS specific files, used when the filegroup is a dependency of a module variant that targets
+	// the OS, e.g. a java_library built for the device. The files in host are used for all host
+	// OSes.
+	Target struct {
+		Android      fileGroupVariantProperties
+		Host         fileGroupVariantProperties
+		Linux_glibc  fileGroupVariantProperties
+		Linux_musl   fileGroupVariantProperties
+		Linux_bionic fileGroupVariantProperties
+		Darwin       fileGroupVariantProperties
+		Windows      fileGroupVariantProperties
+	}
+}
+
+type fileGroupVariantProperties struct {
+	// srcs lists files that will be added to the filegroup for the variant
+	Srcs []string `android:"path"`
+
+	// exclude_srcs lists files that will be removed from the filegroup for the variant
+	Exclude_srcs []string `android:"path"`
+}
+
+// fileGroupVariantSrcs contains the resolved files of a fileGroupVariantProperties.
+type fileGroupVariantSrcs struct {
+	srcs        Paths
+	excludeSrcs Paths
 }
 
 type fileGroup struct {
@@ -99,6 +167,9 @@ type fileGroup struct {
 	BazelModuleBase
 	properties fileGroupProperties
 	srcs       Paths
+
+	// The files for each of the keys returned by fileGroupVariantKeys.
+	variantSrcs map[string]fileGroupVariantSrcs
 }
 
 var _ SourceFileProducer = (*fileGroup)(nil)
@@ -115,7 +186,9 @@ func FileGroupFactory() Module {
 }
 
 func (fg *fileGroup) maybeGenerateBazelBuildActions(ctx ModuleContext) {
-	if !fg.MixedBuildsEnabled(ctx) {
+	// The files of a filegroup with arch or target specific srcs depend on the module that uses
+	// them, so they can't be replaced by the files of a single Bazel configuration.
+	if !fg.MixedBuildsEnabled(ctx) || len(fg.variantSrcs) > 0 {
 		return
 	}
 
@@ -149,13 +222,84 @@ func (fg *fileGroup) GenerateAndroidBuildActions(ctx ModuleContext) {
 		fg.srcs = PathsWithModuleSrcSubDir(ctx, fg.srcs, String(fg.properties.Path))
 	}
 
+	fg.variantSrcs = make(map[string]fileGroupVariantSrcs)
+	for key, props := range fg.variantProperties() {
+		if len(props.Srcs) == 0 && len(props.Exclude_srcs) == 0 {
+			continue
+		}
+		srcs := PathsForModuleSrc(ctx, props.Srcs)
+		excludeSrcs := PathsForModuleSrc(ctx, props.Exclude_srcs)
+		if fg.properties.Path != nil {
+			srcs = PathsWithModuleSrcSubDir(ctx, srcs, String(fg.properties.Path))
+			excludeSrcs = PathsWithModuleSrcSubDir(ctx, excludeSrcs, String(fg.properties.Path))
+		}
+		fg.variantSrcs[key] = fileGroupVariantSrcs{srcs: srcs, excludeSrcs: excludeSrcs}
+	}
+	if len(fg.variantSrcs) > 0 && fg.properties.Export_to_make_var != nil {
+		ctx.PropertyErrorf("export_to_make_var", "cannot be used with arch or target specific srcs")
+	}
+
 	fg.maybeGenerateBazelBuildActions(ctx)
 }
 
+// variantProperties returns the arch and target properties by the key used to look them up in
+// SrcsForTarget.
+func (fg *fileGroup) variantProperties() map[string]*fileGroupVariantProperties {
+	arch := &fg.properties.Arch
+	target := &fg.properties.Target
+	return map[string]*fileGroupVariantProperties{
+		"arch:" + Arm.Name:       &arch.Arm,
+		"arch:" + Arm64.Name:     &arch.Arm64,
+		"arch:" + X86.Name:       &arch.X86,
+		"arch:" + X86_64.Name:    &arch.X86_64,
+		"os:" + Android.Name:     &target.Android,
+		"host":                   &target.Host,
+		"os:" + Linux.Name:       &target.Linux_glibc,
+		"os:" + LinuxMusl.Name:   &target.Linux_musl,
+		"os:" + LinuxBionic.Name: &target.Linux_bionic,
+		"os:" + Darwin.Name:      &target.Darwin,
+		"os:" + Windows.Name:     &target.Windows,
+	}
+}
+
 func (fg *fileGroup) Srcs() Paths {
 	return append(Paths{}, fg.srcs...)
 }
 
+// SrcsForTarget returns the files of the filegroup for a module variant that targets the given OS
+// and architecture, i.e. the srcs of the filegroup plus the srcs of the matching arch and target
+// properties, less their exclude_srcs.
+func (fg *fileGroup) SrcsForTarget(target Target) Paths {
+	keys := []string{"os:" + target.Os.Name}
+	if target.Os.Class == Host {
+		keys = append([]string{"host"}, keys...)
+	}
+	if target.Arch.ArchType != Common {
+		keys = append(keys, "arch:"+target.Arch.ArchType.Name)
+	}
+
+	srcs := fg.Srcs()
+	var excludeSrcs Paths
+	for _, key := range keys {
+		if variant, ok := fg.variantSrcs[key]; ok {
+			srcs = append(srcs, variant.srcs...)
+			excludeSrcs = append(excludeSrcs, variant.excludeSrcs...)
+		}
+	}
+	srcs, _ = FilterPathList(srcs, excludeSrcs)
+	return FirstUniquePaths(srcs)
+}
+
+// TargetSpecificSourceFileProducer is a SourceFileProducer whose files depend on the OS and
+// architecture of the module variant that uses them, e.g. a filegroup with arch or target specific
+// srcs.
+type TargetSpecificSourceFileProducer interface {
+	SourceFileProducer
+	SrcsForTarget(target Target) Paths
+}
+
+var _ TargetSpecificSourceFileProducer = (*fileGroup)(nil)
+
 func (fg *fileGroup) MakeVars(ctx MakeVarsModuleContext) {
 	if makeVar := String(fg.properties.Export_to_make_var); makeVar != "" {
 		ctx.StrictRaw(makeVar, strings.Join(fg.srcs.Strings(), " "))
@@ -0,0 +1,158 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type filegroupConsumerTestModule struct {
+	ModuleBase
+	props struct {
+		Srcs []string `android:"path"`
+	}
+	srcs Paths
+}
+
+func (m *filegroupConsumerTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	m.srcs = PathsForModuleSrc(ctx, m.props.Srcs)
+}
+
+func filegroupConsumerTestModuleFactory(multilib Multilib) ModuleFactory {
+	return func() Module {
+		m := &filegroupConsumerTestModule{}
+		m.AddProperties(&m.props)
+		InitAndroidArchModule(m, HostAndDeviceSupported, multilib)
+		return m
+	}
+}
+
+func TestFilegroupTargetSpecificSrcs(t *testing.T) {
+	result := GroupFixturePreparers(
+		PrepareForTestWithArchMutator,
+		PrepareForTestWithFilegroup,
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("native_consumer", filegroupConsumerTestModuleFactory(MultilibBoth))
+			ctx.RegisterModuleType("common_consumer", filegroupConsumerTestModuleFactory(MultilibCommon))
+		}),
+		FixtureWithRootAndroidBp(`
+			filegroup {
+				name: "fg",
+				srcs: [
+					"common.txt",
+					"not_arm.txt",
+				],
+				arch: {
+					arm: {
+						exclude_srcs: ["not_arm.txt"],
+					},
+					arm64: {
+						srcs: ["arm64.txt"],
+					},
+					x86_64: {
+						srcs: ["x86_64.txt"],
+					},
+				},
+				target: {
+					android: {
+						srcs: ["android.txt"],
+					},
+					host: {
+						srcs: ["host.txt"],
+					},
+				},
+			}
+
+			native_consumer {
+				name: "foo",
+				srcs: [":fg"],
+			}
+
+			common_consumer {
+				name: "bar",
+				srcs: [":fg"],
+			}
+		`),
+		FixtureMergeMockFs(MockFS{
+			"common.txt":  nil,
+			"not_arm.txt": nil,
+			"arm64.txt":   nil,
+			"x86_64.txt":  nil,
+			"android.txt": nil,
+			"host.txt":    nil,
+		}),
+	).RunTest(t)
+
+	buildOSTarget := result.Config.BuildOSTarget
+
+	testCases := []struct {
+		module   string
+		variant  string
+		expected []string
+	}{
+		{
+			module:   "foo",
+			variant:  "android_arm64_armv8-a",
+			expected: []string{"common.txt", "not_arm.txt", "android.txt", "arm64.txt"},
+		},
+		{
+			module:   "foo",
+			variant:  "android_arm_armv7-a-neon",
+			expected: []string{"common.txt", "android.txt"},
+		},
+		{
+			module:   "foo",
+			variant:  buildOSTarget.String(),
+			expected: []string{"common.txt", "not_arm.txt", "host.txt", "x86_64.txt"},
+		},
+		{
+			module:   "bar",
+			variant:  "android_common",
+			expected: []string{"common.txt", "not_arm.txt", "android.txt"},
+		},
+		{
+			module:   "bar",
+			variant:  buildOSTarget.Os.String() + "_common",
+			expected: []string{"common.txt", "not_arm.txt", "host.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.module+"_"+tc.variant, func(t *testing.T) {
+			m := result.ModuleForTests(tc.module, tc.variant).Module().(*filegroupConsumerTestModule)
+			AssertPathsRelativeToTopEquals(t, "srcs", tc.expected, m.srcs)
+		})
+	}
+}
+
+func TestFilegroupTargetSpecificSrcsExportToMakeVar(t *testing.T) {
+	GroupFixturePreparers(
+		PrepareForTestWithArchMutator,
+		PrepareForTestWithFilegroup,
+	).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(
+		`"fg": export_to_make_var: cannot be used with arch or target specific srcs`)).
+		RunTestWithBp(t, `
+			filegroup {
+				name: "fg",
+				srcs: ["common.txt"],
+				target: {
+					android: {
+						srcs: ["android.txt"],
+					},
+				},
+				export_to_make_var: "FG_SRCS",
+			}
+		`)
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// This file contains the support for running host unit tests as part of the build, e.g. with
+// `m run-host-unit-tests`. The result of each passing test run is cached under a digest of the
+// test command and of the contents of the test binary, its data and its runtime dependencies, so
+// a test is only rerun when one of them changed since it last passed, even if the files were
+// rebuilt. Setting SOONG_NO_TEST_CACHE, e.g. with `m --no-test-cache`, always reruns the tests.
+
+func init() {
+	RegisterSingletonType("host_test_results", hostTestResultsSingletonFactory)
+
+	pctx.SourcePathVariable("runCachedHostTest", "build/soong/scripts/run-cached-host-test.sh")
+}
+
+var (
+	hostTestRun = pctx.AndroidStaticRule("hostTestRun",
+		blueprint.RuleParams{
+			Command:        `${runCachedHostTest} $flags $cacheDir $out.rsp $out $testCommand`,
+			CommandDeps:    []string{"${runCachedHostTest}"},
+			Rspfile:        "$out.rsp",
+			RspfileContent: "$in",
+		}, "flags", "cacheDir", "testCommand")
+)
+
+// HostTestRunParams describes how to run a host unit test.
+type HostTestRunParams struct {
+	// The command that runs the test, which must exit with a non-zero status if the test fails.
+	Command string
+
+	// The test binary and its data. The installed files of the runtime dependencies of the module
+	// are added automatically.
+	Inputs Paths
+}
+
+// HostTestResultInfo is provided by modules whose host unit test is run by the build.
+type HostTestResultInfo struct {
+	// The file written when the test passed.
+	Result Path
+}
+
+var HostTestResultInfoProvider = blueprint.NewProvider(HostTestResultInfo{})
+
+// BuildHostTestRun adds a rule that runs a host unit test unless it passed with the same inputs
+// before, and provides its result in HostTestResultInfo.
+func BuildHostTestRun(ctx ModuleContext, params HostTestRunParams) Path {
+	result := PathForModuleOut(ctx, "test_result", ctx.ModuleName()+".digest")
+
+	inputs := append(Paths(nil), params.Inputs...)
+	inputs = append(inputs, ctx.Module().base().installFilesDepSet.ToList().Paths()...)
+
+	var flags string
+	if ctx.Config().IsEnvTrue("SOONG_NO_TEST_CACHE") {
+		flags = "--no-cache"
+	}
+
+	ctx.Build(pctx, BuildParams{
+		Rule:        hostTestRun,
+		Description: "run host test " + ctx.ModuleName(),
+		Inputs:      SortedUniquePaths(inputs),
+		Output:      result,
+		Args: map[string]string{
+			"flags":       flags,
+			"cacheDir":    PathForOutput(ctx, "host_test_cache").String(),
+			"testCommand": proptools.ShellEscape(params.Command),
+		},
+	})
+
+	ctx.SetProvider(HostTestResultInfoProvider, HostTestResultInfo{Result: result})
+	return result
+}
+
+func hostTestResultsSingletonFactory() Singleton {
+	return &hostTestResultsSingleton{}
+}
+
+type hostTestResultsSingleton struct{}
+
+// GenerateBuildActions creates the run-host-unit-tests phony that runs all the host unit tests.
+func (s *hostTestResultsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var results Paths
+	ctx.VisitAllModules(func(module Module) {
+		if ctx.ModuleHasProvider(module, HostTestResultInfoProvider) {
+			results = append(results, ctx.ModuleProvider(module, HostTestResultInfoProvider).(HostTestResultInfo).Result)
+		}
+	})
+	if len(results) > 0 {
+		ctx.Phony("run-host-unit-tests", results...)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// This file contains the support for generating the init.rc files and VINTF manifest fragments of
+// a module from templates, e.g.
+//
+//	cc_binary {
+//	    name: "foo",
+//	    init_rc_template: ["foo.rc.in"],
+//	    template_vars: {
+//	        user: "system",
+//	    },
+//	}
+//
+// with a foo.rc.in of
+//
+//	service foo ${install_path}
+//	    user ${user}
+//
+// installs a foo.rc whose service runs the installed binary, e.g. /system/bin/foo, so the rc file
+// cannot drift from the install path of the binary. The generated files are checked to be valid
+// init.rc files or VINTF manifest fragments and are installed like the files in init_rc and
+// vintf_fragments.
+
+// InitRcTemplateProperties are the properties of modules that generate init.rc files and VINTF
+// manifest fragments from templates.
+type InitRcTemplateProperties struct {
+	// init.rc templates to be substituted and installed if this module is installed. Each ${name}
+	// in a template is replaced with the value of the variable, which are:
+	//   module_name: the name of the module.
+	//   install_path: the path of the installed module on the device, e.g. /system/bin/foo, or
+	//     /apex/com.android.foo/bin/foo for the variant of the module in the com.android.foo APEX.
+	//   device_name: the name of the device being built.
+	//   platform_sdk_version: the SDK version of the platform being built.
+	//   user, group, capabilities: the values of template_vars, if set.
+	// A ".in" suffix is removed from the name of the installed file.
+	Init_rc_template []string `android:"arch_variant,path"`
+
+	// VINTF manifest fragment templates to be substituted and installed if this module is
+	// installed, with the same variables as init_rc_template.
+	Vintf_fragments_template []string `android:"path"`
+
+	// Values of the variables used by init_rc_template and vintf_fragments_template.
+	Template_vars struct {
+		// The user the service runs as.
+		User *string
+
+		// The groups the service runs with, separated by spaces in the template.
+		Group []string
+
+		// The capabilities of the service, separated by spaces in the template.
+		Capabilities []string
+	}
+}
+
+// HasTemplates returns true if the module generates files from templates. As they contain the
+// install path of the variant, a module with templates needs a unique variant per APEX, see
+// ApexModule.UniqueApexVariations.
+func (p *InitRcTemplateProperties) HasTemplates() bool {
+	return len(p.Init_rc_template) > 0 || len(p.Vintf_fragments_template) > 0
+}
+
+// initRcTemplateInstallPath returns the path on the device of the variant of a module that is
+// installed at installPath. The APEX variant of the module is installed at the same path inside
+// the APEX, which is mounted at /apex/<apex_name>.
+func initRcTemplateInstallPath(ctx ModuleContext, installPath InstallPath) string {
+	apexInfo := ctx.Provider(ApexInfoProvider).(ApexInfo)
+	if apexInfo.IsForPlatform() {
+		return InstallPathToOnDevicePath(ctx, installPath)
+	}
+	// The APEX variants of a module with templates are not merged, so the variant is in a single
+	// APEX.
+	apexName := apexInfo.ApexContents[0].ApexName()
+	return filepath.Join("/apex", apexName, Rel(ctx, installPath.PartitionDir(), installPath.String()))
+}
+
+// initRcTemplateVars returns the variables that can be used in the templates of a module that is
+// installed at installPath, in the order in which they are passed to the tool.
+func initRcTemplateVars(ctx ModuleContext, props *InitRcTemplateProperties, installPath InstallPath) []string {
+	vars := []string{
+		"module_name=" + ctx.ModuleName(),
+		"install_path=" + initRcTemplateInstallPath(ctx, installPath),
+		"device_name=" + ctx.Config().DeviceName(),
+		"platform_sdk_version=" + ctx.Config().PlatformSdkVersion().String(),
+	}
+	if user := props.Template_vars.User; user != nil {
+		vars = append(vars, "user="+*user)
+	}
+	if groups := props.Template_vars.Group; len(groups) > 0 {
+		vars = append(vars, "group="+strings.Join(groups, " "))
+	}
+	if capabilities := props.Template_vars.Capabilities; len(capabilities) > 0 {
+		vars = append(vars, "capabilities="+strings.Join(capabilities, " "))
+	}
+	return vars
+}
+
+// GenerateInitRcFromTemplates generates the init.rc files and VINTF manifest fragments of a module
+// installed at installPath from its templates. They are installed along with the files listed in
+// init_rc and vintf_fragments.
+func GenerateInitRcFromTemplates(ctx ModuleContext, props *InitRcTemplateProperties, installPath InstallPath) {
+	templates := PathsForModuleSrc(ctx, props.Init_rc_template)
+	vintfTemplates := PathsForModuleSrc(ctx, props.Vintf_fragments_template)
+	if len(templates) == 0 && len(vintfTemplates) == 0 {
+		return
+	}
+
+	vars := initRcTemplateVars(ctx, props, installPath)
+	m := ctx.Module().base()
+	for _, template := range templates {
+		out := generateFromInitRcTemplate(ctx, "rc", template, vars)
+		m.generatedInitRcPaths = append(m.generatedInitRcPaths, out)
+	}
+	for _, template := range vintfTemplates {
+		out := generateFromInitRcTemplate(ctx, "vintf", template, vars)
+		m.generatedVintfFragmentsPaths = append(m.generatedVintfFragmentsPaths, out)
+	}
+}
+
+// generateFromInitRcTemplate substitutes the variables in a template and checks that the result is
+// in the format, either "rc" or "vintf".
+func generateFromInitRcTemplate(ctx ModuleContext, format string, template Path, vars []string) Path {
+	name := strings.TrimSuffix(template.Base(), ".in")
+	out := PathForModuleOut(ctx, format+"_template", name)
+
+	rule := NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().
+		BuiltTool("gen_init_rc_from_template").
+		FlagWithArg("--format ", format)
+	for _, v := range vars {
+		cmd.FlagWithArg("--var ", proptools.ShellEscape(v))
+	}
+	cmd.Input(template).Output(out)
+	rule.Build(format+"_template_"+name, "generate "+name+" from template")
+	return out
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InstallDepsOutputTag is the output tag, supported by all modules that install files, of a report
+// listing every file that is installed along with the module, i.e. the files installed by the module
+// itself, by all of its transitive install dependencies such as shared libraries and JNI libraries,
+// and by the modules it requires, transitively. Each line contains the size of the file in bytes,
+// its partition and its path relative to the root of the partition, and the last line contains the
+// total size. The reports are only generated when SOONG_COLLECT_INSTALL_DEPS is set, as they add
+// two rules to every module.
+const InstallDepsOutputTag = ".install_deps"
+
+func init() {
+	RegisterInstallDepsReportBuildComponents(InitRegistrationContext)
+}
+
+func RegisterInstallDepsReportBuildComponents(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("install_deps_report", installDepsReportSingletonFactory)
+}
+
+// InstallDepsReportExtraFilesProvider is implemented by modules that install files without
+// ModuleContext.InstallFile, e.g. the dexpreopt artifacts of java modules that are installed by
+// Make, so that the files are listed in the install deps reports.
+type InstallDepsReportExtraFilesProvider interface {
+	// InstallDepsReportExtraFiles returns the files and their absolute paths on the device.
+	InstallDepsReportExtraFiles(ctx PathContext) RuleBuilderInstalls
+}
+
+// installDepsReportEntry is a file listed in an install deps report.
+type installDepsReportEntry struct {
+	partition string
+	path      string
+	// The file to install, nil for symlinks that take no space on the device.
+	src Path
+}
+
+// collectInstallDepsReportEntries collects the files installed along with the module, the report
+// itself is written by the install_deps_report singleton that adds the files of the required
+// modules.
+func (m *ModuleBase) collectInstallDepsReportEntries(ctx ModuleContext) {
+	if !ctx.Config().IsEnvTrue("SOONG_COLLECT_INSTALL_DEPS") {
+		return
+	}
+
+	var entries []installDepsReportEntry
+	for _, spec := range m.TransitivePackagingSpecs() {
+		entry := installDepsReportEntry{partition: spec.partition, path: spec.relPathInPackage}
+		if spec.symlinkTarget == "" {
+			entry.src = spec.srcPath
+		}
+		entries = append(entries, entry)
+	}
+	if p, ok := ctx.Module().(InstallDepsReportExtraFilesProvider); ok {
+		for _, install := range p.InstallDepsReportExtraFiles(ctx) {
+			parts := strings.SplitN(strings.TrimPrefix(install.To, "/"), "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			entries = append(entries, installDepsReportEntry{partition: parts[0], path: parts[1], src: install.From})
+		}
+	}
+	if len(entries) == 0 && len(m.RequiredModuleNames()) == 0 {
+		return
+	}
+
+	m.installDepsReportEntries = entries
+	m.installDepsReportFile = PathForModuleOut(ctx, "install_deps.txt")
+}
+
+func installDepsReportSingletonFactory() Singleton {
+	return &installDepsReportSingleton{}
+}
+
+type installDepsReportSingleton struct{}
+
+func (s *installDepsReportSingleton) GenerateBuildActions(ctx SingletonContext) {
+	if !ctx.Config().IsEnvTrue("SOONG_COLLECT_INSTALL_DEPS") {
+		return
+	}
+
+	var reported []Module
+	modulesByName := make(map[string][]Module)
+	ctx.VisitAllModules(func(module Module) {
+		if module.base().installDepsReportFile != nil {
+			reported = append(reported, module)
+			name := ctx.ModuleName(module)
+			modulesByName[name] = append(modulesByName[name], module)
+		}
+	})
+
+	for i, module := range reported {
+		// Add the files of the required modules, transitively. Like Make, prefer the variant of
+		// the same os and arch, then the common and first arch variants.
+		entries := append([]installDepsReportEntry(nil), module.base().installDepsReportEntries...)
+		visited := map[Module]bool{module: true}
+		queue := []Module{module}
+		for len(queue) > 0 {
+			m := queue[0]
+			queue = queue[1:]
+			for _, name := range m.RequiredModuleNames() {
+				if r := requiredVariantForInstallDepsReport(modulesByName[name], m.Target()); r != nil && !visited[r] {
+					visited[r] = true
+					queue = append(queue, r)
+					entries = append(entries, r.base().installDepsReportEntries...)
+				}
+			}
+		}
+		writeInstallDepsReport(ctx, fmt.Sprintf("install_deps_report_%d", i), module, entries)
+	}
+}
+
+// requiredVariantForInstallDepsReport returns the variant of a required module that is installed
+// for a module of the target, or nil if there is none.
+func requiredVariantForInstallDepsReport(variants []Module, target Target) Module {
+	for _, archType := range []ArchType{target.Arch.ArchType, Common} {
+		for _, variant := range variants {
+			if variant.Target().Os == target.Os && variant.Target().Arch.ArchType == archType {
+				return variant
+			}
+		}
+	}
+	for _, variant := range variants {
+		if variant.Target().Os == target.Os {
+			return variant
+		}
+	}
+	return nil
+}
+
+// writeInstallDepsReport writes the report returned for the InstallDepsOutputTag output tag of the
+// module.
+func writeInstallDepsReport(ctx SingletonContext, name string, module Module, entries []installDepsReportEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].partition != entries[j].partition {
+			return entries[i].partition < entries[j].partition
+		}
+		return entries[i].path < entries[j].path
+	})
+
+	var lines []string
+	var srcs Paths
+	for i, entry := range entries {
+		if i > 0 && entry.partition == entries[i-1].partition && entry.path == entries[i-1].path {
+			continue
+		}
+		src := "-"
+		if entry.src != nil {
+			src = entry.src.String()
+			srcs = append(srcs, entry.src)
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s", entry.partition, entry.path, src))
+	}
+
+	report := module.base().installDepsReportFile
+	list := report.ReplaceExtension(ctx, "list")
+	WriteFileRule(ctx, list, strings.Join(lines, "\n"))
+
+	rule := NewRuleBuilder(pctx, ctx)
+	FileSizesCommand(rule, list, 2, srcs).
+		Text(`| awk -F '\t' -v OFS='\t' '{ total += $3; print $3, $1, $2 } END { print total + 0, "total" }' >`).
+		Output(report)
+	rule.Build(name, "install deps report "+ctx.ModuleName(module))
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstallDepsReport(t *testing.T) {
+	bp := `
+		deps {
+			name: "foo",
+			deps: ["bar"],
+			required: ["baz"],
+		}
+
+		deps {
+			name: "bar",
+		}
+
+		deps {
+			name: "baz",
+			required: ["qux", "foo"],
+		}
+
+		deps {
+			name: "qux",
+		}
+	`
+
+	preparer := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(RegisterInstallDepsReportBuildComponents),
+		FixtureWithRootAndroidBp(bp),
+	)
+
+	// The report is only generated when requested.
+	result := preparer.RunTest(t)
+	report := result.SingletonForTests("install_deps_report")
+	AssertBoolEquals(t, "install_deps.txt generated", false,
+		report.MaybeOutput("out/soong/.intermediates/foo/android_common/install_deps.txt").Rule != nil)
+
+	result = GroupFixturePreparers(
+		preparer,
+		FixtureMergeEnv(map[string]string{
+			"SOONG_COLLECT_INSTALL_DEPS": "true",
+		}),
+	).RunTest(t)
+	report = result.SingletonForTests("install_deps_report")
+	foo := result.ModuleForTests("foo", "android_common")
+
+	// The files of the required modules are listed, transitively.
+	list := report.Output("out/soong/.intermediates/foo/android_common/install_deps.list")
+	var entries []string
+	for _, line := range strings.Split(ContentFromFileRuleForTests(t, list), "\n") {
+		if fields := strings.Split(line, "\t"); len(fields) == 3 {
+			entries = append(entries, fields[0]+" "+fields[1]+" "+fields[2])
+		}
+	}
+	AssertArrayString(t, "install deps", []string{
+		"system bar out/soong/.intermediates/bar/android_common/bar",
+		"system baz out/soong/.intermediates/baz/android_common/baz",
+		"system foo out/soong/.intermediates/foo/android_common/foo",
+		"system qux out/soong/.intermediates/qux/android_common/qux",
+		"system symlinks/bar -",
+		"system symlinks/baz -",
+		"system symlinks/foo -",
+		"system symlinks/qux -",
+	}, entries)
+
+	txt := report.Output("out/soong/.intermediates/foo/android_common/install_deps.txt")
+	AssertPathsRelativeToTopEquals(t, "report implicits", []string{
+		"out/soong/.intermediates/bar/android_common/bar",
+		"out/soong/.intermediates/baz/android_common/baz",
+		"out/soong/.intermediates/foo/android_common/foo",
+		"out/soong/.intermediates/foo/android_common/install_deps.list",
+		"out/soong/.intermediates/qux/android_common/qux",
+	}, txt.Implicits)
+	// The paths are quoted in the command that gets the size of the files.
+	AssertStringDoesContain(t, "report command", txt.RuleParams.Command, `cmd = "wc -c < \""`)
+
+	AssertPathsRelativeToTopEquals(t, "output files", []string{
+		"out/soong/.intermediates/foo/android_common/install_deps.txt",
+	}, OutputFilesForModule(PathContextForTesting(result.Config), foo.Module(), InstallDepsOutputTag))
+}
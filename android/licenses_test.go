@@ -832,3 +832,49 @@ func defaultsLicensesFactory() Module {
 	InitDefaultsModule(m)
 	return m
 }
+
+func TestLicenseFixturePreparers(t *testing.T) {
+	result := GroupFixturePreparers(
+		prepareForLicenseTest,
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("mock_library", newMockLicensesLibraryModule)
+		}),
+		FixtureAddLicenseKind("kinds", "notice_kind", "notice"),
+		FixtureAddLicenseKind("kinds", "restricted_kind", "restricted"),
+		FixtureAddLicense("top", FixtureLicense{
+			Name:        "top_license",
+			PackageName: "topDog",
+			Kinds:       []string{"notice_kind"},
+			Text:        []string{"LICENSE"},
+		}),
+		FixtureAddLicense("other", FixtureLicense{
+			Name:  "other_license",
+			Kinds: []string{"restricted_kind"},
+		}),
+		FixtureAddPackage("top", "top_license"),
+		fixtureAppendToAndroidBp("top", `
+			mock_library {
+				name: "libdefault",
+			}
+
+			mock_library {
+				name: "libexplicit",
+				licenses: ["other_license"],
+			}
+		`),
+	).RunTest(t)
+
+	AssertEffectiveLicenseMetadata(t, result, "libdefault", "android_common", EffectiveLicenseMetadata{
+		Licenses:    []string{"top_license"},
+		PackageName: "topDog",
+		Kinds:       []string{"notice_kind"},
+		Conditions:  []string{"notice"},
+		Notices:     []string{"top/LICENSE:topDog"},
+	})
+
+	AssertEffectiveLicenseMetadata(t, result, "libexplicit", "android_common", EffectiveLicenseMetadata{
+		Licenses:   []string{"other_license"},
+		Kinds:      []string{"restricted_kind"},
+		Conditions: []string{"restricted"},
+	})
+}
@@ -79,6 +79,15 @@ func collectMetrics(config Config, eventHandler metrics.EventHandler) *soong_met
 		metrics.Events = append(metrics.Events, &perfInfo)
 	}
 
+	for _, cost := range AnalysisCosts(config) {
+		perfInfo := soong_metrics_proto.PerfInfo{
+			Description: proto.String(cost.Kind + "/" + cost.Name),
+			Name:        proto.String("soong_build_analysis"),
+			RealTime:    proto.Uint64(uint64(cost.Time.Nanoseconds())),
+		}
+		metrics.Events = append(metrics.Events, &perfInfo)
+	}
+
 	return metrics
 }
 
@@ -517,6 +517,8 @@ type Module interface {
 	VintfFragments() Paths
 	NoticeFiles() Paths
 	EffectiveLicenseFiles() Paths
+	EffectiveLicenseKinds() []string
+	EffectiveLicenseConditions() []string
 
 	AddProperties(props ...interface{})
 	GetProperties() []interface{}
@@ -690,6 +692,11 @@ type commonProperties struct {
 	// and so prevent early detection of changes that have broken those modules.
 	Enabled *bool `android:"arch_variant"`
 
+	// a boolean expression over boolean product variables, e.g. "eng || !unbundled_build", that
+	// disables the module when it evaluates to false for the current product. Supports the "!",
+	// "&&" and "||" operators and parentheses, product variables that are not set are false.
+	Enabled_if *string
+
 	// Controls the visibility of this module to other modules. Allowable values are one or more of
 	// these formats:
 	//
@@ -822,9 +829,23 @@ type commonProperties struct {
 	// VINTF manifest fragments to be installed if this module is installed
 	Vintf_fragments []string `android:"path"`
 
+	// whether the globs in the path properties of this module fail when they match files outside
+	// of the module directory through a symlink to a directory, e.g. "common/*.java" where common
+	// is a symlink to ../common. Defaults to the strict_globs property of the soong_namespace of
+	// the module.
+	Strict_globs *bool
+
+	// limits on the dependencies of this module, enforced when the build is analyzed
+	Dependency_budget dependencyBudgetProperties
+
 	// names of other modules to install if this module is installed
 	Required []string `android:"arch_variant"`
 
+	// images in which the modules listed in required must have a variant, instead of the image of
+	// this module, e.g. ["vendor"] for a system module that requires a vendor only module. One of
+	// "system", "vendor", "product", "ramdisk", "vendor_ramdisk", "debug_ramdisk" or "recovery".
+	Required_images []string
+
 	// names of other modules to install on host if this module is installed
 	Host_required []string `android:"arch_variant"`
 
@@ -1356,6 +1377,13 @@ type ModuleBase struct {
 	packagingSpecs       []PackagingSpec
 	packagingSpecsDepSet *packagingSpecsDepSet
 	noticeFiles          Paths
+
+	// installDepsReportFile is the file returned for the InstallDepsOutputTag output tag.
+	installDepsReportFile WritablePath
+	// installDepsReportEntries are the files installed along with the module, listed in the
+	// report together with the files of the required modules.
+	installDepsReportEntries []installDepsReportEntry
+
 	// katiInstalls tracks the install rules that were created by Soong but are being exported
 	// to Make to convert to ninja rules so that Make can add additional dependencies.
 	katiInstalls katiInstalls
@@ -1382,12 +1410,21 @@ type ModuleBase struct {
 	initRcPaths         Paths
 	vintfFragmentsPaths Paths
 
+	// The init.rc files and VINTF manifest fragments generated from templates by
+	// GenerateInitRcFromTemplates.
+	generatedInitRcPaths         Paths
+	generatedVintfFragmentsPaths Paths
+
 	// set of dependency module:location mappings used to populate the license metadata for
 	// apex containers.
 	licenseInstallMap []string
 
 	// The path to the generated license metadata file for the module.
 	licenseMetadataFile WritablePath
+
+	// The namespace of the module, recorded by the required_images mutator to resolve the names of
+	// its required modules after the mutators have run.
+	namespace *Namespace
 }
 
 // A struct containing all relevant information about a Bazel target converted via bp2build.
@@ -1911,6 +1948,18 @@ func (m *ModuleBase) EffectiveLicenseFiles() Paths {
 	return result
 }
 
+// EffectiveLicenseKinds returns the names of the license_kind modules of the licenses that apply to
+// this module.
+func (m *ModuleBase) EffectiveLicenseKinds() []string {
+	return m.commonProperties.Effective_license_kinds
+}
+
+// EffectiveLicenseConditions returns the conditions of the licenses that apply to this module,
+// e.g. "notice" or "restricted".
+func (m *ModuleBase) EffectiveLicenseConditions() []string {
+	return m.commonProperties.Effective_license_conditions
+}
+
 // computeInstallDeps finds the installed paths of all dependencies that have a dependency
 // tag that is annotated as needing installation via the IsInstallDepNeeded method.
 func (m *ModuleBase) computeInstallDeps(ctx ModuleContext) ([]*installPathsDepSet, []*packagingSpecsDepSet) {
@@ -2275,18 +2324,26 @@ func (m *ModuleBase) GenerateBuildActions(blueprintCtx blueprint.ModuleContext)
 			return
 		}
 
+		doneAnalysisCost := startAnalysisCost(ctx.Config(), AnalysisCostModuleType, ctx.ModuleType())
 		m.module.GenerateAndroidBuildActions(ctx)
+		doneAnalysisCost()
 		if ctx.Failed() {
 			return
 		}
 
-		m.initRcPaths = PathsForModuleSrc(ctx, m.commonProperties.Init_rc)
+		m.checkDependencyBudget(ctx)
+		if ctx.Failed() {
+			return
+		}
+
+		m.initRcPaths = append(PathsForModuleSrc(ctx, m.commonProperties.Init_rc), m.generatedInitRcPaths...)
 		rcDir := PathForModuleInstall(ctx, "etc", "init")
 		for _, src := range m.initRcPaths {
 			ctx.PackageFile(rcDir, filepath.Base(src.String()), src)
 		}
 
-		m.vintfFragmentsPaths = PathsForModuleSrc(ctx, m.commonProperties.Vintf_fragments)
+		m.vintfFragmentsPaths = append(PathsForModuleSrc(ctx, m.commonProperties.Vintf_fragments),
+			m.generatedVintfFragmentsPaths...)
 		vintfDir := PathForModuleInstall(ctx, "etc", "vintf", "manifest")
 		for _, src := range m.vintfFragmentsPaths {
 			ctx.PackageFile(vintfDir, filepath.Base(src.String()), src)
@@ -2324,6 +2381,13 @@ func (m *ModuleBase) GenerateBuildActions(blueprintCtx blueprint.ModuleContext)
 	m.installFilesDepSet = newInstallPathsDepSet(m.installFiles, dependencyInstallFiles)
 	m.packagingSpecsDepSet = newPackagingSpecsDepSet(m.packagingSpecs, dependencyPackagingSpecs)
 
+	if m.Enabled() && !ctx.Failed() {
+		m.collectInstallDepsReportEntries(ctx)
+		m.setTestMappingInfo(ctx)
+		m.setEffectiveSdkVersionsInfo(ctx)
+		m.setTestCoverageInfo(ctx)
+	}
+
 	buildLicenseMetadata(ctx, m.licenseMetadataFile)
 
 	m.buildParams = ctx.buildParams
@@ -2557,6 +2621,15 @@ func (installs katiInstalls) InstallPaths() InstallPaths {
 	return paths
 }
 
+// strictGlobs returns true if the globs in the path properties of the module must not match files
+// outside of the module directory.
+func (m *moduleContext) strictGlobs() bool {
+	if strict := m.module.base().commonProperties.Strict_globs; strict != nil {
+		return *strict
+	}
+	return m.Namespace().StrictGlobs()
+}
+
 func (m *moduleContext) ninjaError(params BuildParams, err error) (PackageContext, BuildParams) {
 	return pctx, BuildParams{
 		Rule:            ErrorRule,
@@ -3509,6 +3582,12 @@ func OutputFileForModule(ctx PathContext, module blueprint.Module, tag string) P
 }
 
 func outputFilesForModule(ctx PathContext, module blueprint.Module, tag string) (Paths, error) {
+	if tag == InstallDepsOutputTag {
+		if m, ok := module.(Module); ok && m.base().installDepsReportFile != nil {
+			return Paths{m.base().installDepsReportFile}, nil
+		}
+		return nil, fmt.Errorf("module %q has no install deps report, it is only generated when SOONG_COLLECT_INSTALL_DEPS is set for modules that install files", pathContextName(ctx, module))
+	}
 	if outputFileProducer, ok := module.(OutputFileProducer); ok {
 		paths, err := outputFileProducer.OutputFiles(tag)
 		if err != nil {
@@ -3542,6 +3621,17 @@ type HostToolProvider interface {
 	HostToolPath() OptionalPath
 }
 
+// HostToolRuntimeDepsInfo is provided by a HostToolProvider whose tool needs other files at runtime,
+// for example the installed jar and JNI libraries of a java_binary_host.  A genrule that uses the
+// tool, or a module that depends on it and runs it with RuleBuilderCommand.BuiltTool, adds the files
+// to the inputs of its sandbox.
+type HostToolRuntimeDepsInfo struct {
+	// The files that are needed to run the host tool.
+	Deps Paths
+}
+
+var HostToolRuntimeDepsInfoProvider = blueprint.NewProvider(HostToolRuntimeDepsInfo{})
+
 // Returns a list of paths expanded from globs and modules referenced using ":module" syntax.  The property must
 // be tagged with `android:"path" to support automatic source module dependency resolution.
 //
@@ -0,0 +1,130 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// moduleVariantDump is the dump of the properties of a variant of a module.
+type moduleVariantDump struct {
+	Name       string
+	Type       string
+	Dir        string
+	Variant    string
+	Properties map[string]interface{}
+}
+
+// WriteModuleDump writes, as JSON, the effective properties of every variant of the modules with
+// the given name, i.e. after the defaults were applied, the arch and product variable specific
+// properties were squashed into the other properties and the mutators ran. Only the properties
+// that are set are written, with the names they have in Android.bp files. The arch and product
+// variable specific property structs, which were already squashed, and the properties that
+// mutators set for their own use are skipped.
+func WriteModuleDump(ctx *Context, w io.Writer, name string) error {
+	var variants []moduleVariantDump
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		if ctx.ModuleName(module) != name {
+			return
+		}
+		variants = append(variants, moduleVariantDump{
+			Name:       name,
+			Type:       ctx.ModuleType(module),
+			Dir:        ctx.ModuleDir(module),
+			Variant:    ctx.ModuleSubDir(module),
+			Properties: dumpModuleProperties(module),
+		})
+	})
+
+	if len(variants) == 0 {
+		return fmt.Errorf("module %q not found", name)
+	}
+
+	// Modules with the same name in different namespaces are sorted by directory.
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Dir != variants[j].Dir {
+			return variants[i].Dir < variants[j].Dir
+		}
+		return variants[i].Variant < variants[j].Variant
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(variants)
+}
+
+// dumpModuleProperties returns the properties of the module that are set, keyed by their names.
+func dumpModuleProperties(module blueprint.Module) map[string]interface{} {
+	props := make(map[string]interface{})
+	m, ok := module.(Module)
+	if !ok {
+		return props
+	}
+	for _, p := range m.GetProperties() {
+		if _, ok := p.(*archPropRoot); ok || p == m.base().variableProperties {
+			continue
+		}
+		dumpPropertyStruct(reflect.ValueOf(p).Elem(), props)
+	}
+	return props
+}
+
+// dumpPropertyStruct adds the fields of the property struct that are set to props.
+func dumpPropertyStruct(v reflect.Value, props map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || proptools.HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+		if field.Anonymous && v.Field(i).Kind() == reflect.Struct {
+			dumpPropertyStruct(v.Field(i), props)
+			continue
+		}
+		if value, ok := dumpPropertyValue(v.Field(i)); ok {
+			props[proptools.PropertyNameForField(field.Name)] = value
+		}
+	}
+}
+
+// dumpPropertyValue returns the value of a property, and false if the property is not set.
+// Pointers are set when they are not nil, even if they point to a zero value.
+func dumpPropertyValue(v reflect.Value) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return dumpPropertyValue(v.Elem())
+		}
+		return v.Elem().Interface(), true
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		dumpPropertyStruct(v, props)
+		return props, len(props) > 0
+	case reflect.Slice:
+		return v.Interface(), v.Len() > 0
+	default:
+		return v.Interface(), !v.IsZero()
+	}
+}
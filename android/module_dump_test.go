@@ -0,0 +1,125 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type moduleDumpTestModule struct {
+	ModuleBase
+	props struct {
+		Srcs        []string `android:"arch_variant"`
+		Stem        *string
+		Installable *bool
+		Unset       *string
+		Nested      struct {
+			Flags []string `android:"arch_variant"`
+		} `android:"arch_variant"`
+		Mutated string `blueprint:"mutated"`
+	}
+}
+
+func (m *moduleDumpTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {}
+
+func moduleDumpTestModuleFactory() Module {
+	m := &moduleDumpTestModule{}
+	m.AddProperties(&m.props)
+	InitAndroidArchModule(m, HostAndDeviceSupported, MultilibCommon)
+	return m
+}
+
+func TestWriteModuleDump(t *testing.T) {
+	result := GroupFixturePreparers(
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("test", moduleDumpTestModuleFactory)
+			ctx.PreDepsMutators(func(ctx RegisterMutatorsContext) {
+				ctx.BottomUp("set_mutated", func(ctx BottomUpMutatorContext) {
+					if m, ok := ctx.Module().(*moduleDumpTestModule); ok {
+						m.props.Mutated = "mutated"
+					}
+				})
+			})
+		}),
+		FixtureWithRootAndroidBp(`
+			test {
+				name: "foo",
+				host_supported: true,
+				srcs: ["a.c"],
+				stem: "bar",
+				installable: false,
+				nested: {
+					flags: ["-a"],
+				},
+				target: {
+					android: {
+						srcs: ["android.c"],
+						nested: {
+							flags: ["-android"],
+						},
+					},
+					host: {
+						srcs: ["host.c"],
+					},
+				},
+			}
+		`),
+	).RunTest(t)
+
+	var sb strings.Builder
+	if err := WriteModuleDump(result.TestContext.Context, &sb, "foo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var variants []struct {
+		Name       string
+		Type       string
+		Variant    string
+		Properties map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(sb.String()), &variants); err != nil {
+		t.Fatalf("invalid JSON %q: %s", sb.String(), err)
+	}
+
+	buildOS := result.Config.BuildOS.String()
+	AssertIntEquals(t, "number of variants", 2, len(variants))
+	AssertStringEquals(t, "device variant", "android_common", variants[0].Variant)
+	AssertStringEquals(t, "host variant", buildOS+"_common", variants[1].Variant)
+
+	device := variants[0].Properties
+	AssertStringEquals(t, "type", "test", variants[0].Type)
+	AssertDeepEquals(t, "device name", "foo", device["name"])
+	AssertDeepEquals(t, "device srcs", []interface{}{"a.c", "android.c"}, device["srcs"])
+	AssertDeepEquals(t, "device stem", "bar", device["stem"])
+	AssertDeepEquals(t, "device installable", false, device["installable"])
+	AssertDeepEquals(t, "device nested", map[string]interface{}{"flags": []interface{}{"-a", "-android"}}, device["nested"])
+
+	host := variants[1].Properties
+	AssertDeepEquals(t, "host srcs", []interface{}{"a.c", "host.c"}, host["srcs"])
+	AssertDeepEquals(t, "host nested", map[string]interface{}{"flags": []interface{}{"-a"}}, host["nested"])
+
+	for _, variant := range variants {
+		for _, property := range []string{"unset", "mutated", "arch", "target", "multilib"} {
+			if _, ok := variant.Properties[property]; ok {
+				t.Errorf("%s: unexpected property %q in %v", variant.Variant, property, variant.Properties)
+			}
+		}
+	}
+
+	err := WriteModuleDump(result.TestContext.Context, &sb, "baz")
+	AssertErrorMessageEquals(t, "missing module", `module "baz" not found`, err)
+}
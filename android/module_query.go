@@ -0,0 +1,155 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// WriteModuleQuery writes, as JSON, the effective values of the given properties of every variant
+// of the given modules, e.g. with the properties sdk_version, min_sdk_version and apex_available:
+//
+//	[
+//	  {
+//	    "Name": "foo",
+//	    "Type": "java_library",
+//	    "Dir": "frameworks/foo",
+//	    "Variant": "android_common",
+//	    "Properties": {
+//	      "apex_available": ["com.android.foo"],
+//	      "min_sdk_version": "30",
+//	      "sdk_version": null
+//	    }
+//	  }
+//	]
+//
+// The values are the same as the ones written by WriteModuleDump, so that external tools do not
+// have to parse Android.bp files and resolve defaults themselves, except for sdk_version and
+// min_sdk_version of the modules that provide EffectiveSdkVersionsInfo, which are written with the
+// versions that the modules are built with. Properties of nested property structs are selected
+// with their dotted names, e.g. "stubs.versions". Properties that are not set or that the module
+// type does not have are written as null.
+func WriteModuleQuery(ctx *Context, w io.Writer, names []string, properties []string) error {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	found := make(map[string]bool)
+	var variants []moduleVariantDump
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		name := ctx.ModuleName(module)
+		if !wanted[name] {
+			return
+		}
+		found[name] = true
+		all := dumpModuleProperties(module)
+		selected := make(map[string]interface{})
+		for _, property := range properties {
+			selected[property] = lookupDumpedProperty(all, property)
+		}
+		sdkVersions := ctx.ModuleProvider(module, EffectiveSdkVersionsInfoProvider).(EffectiveSdkVersionsInfo)
+		if sdkVersions != (EffectiveSdkVersionsInfo{}) {
+			if _, ok := selected["sdk_version"]; ok {
+				selected["sdk_version"] = sdkVersions.SdkVersion
+			}
+			if _, ok := selected["min_sdk_version"]; ok {
+				selected["min_sdk_version"] = sdkVersions.MinSdkVersion
+			}
+		}
+		variants = append(variants, moduleVariantDump{
+			Name:       name,
+			Type:       ctx.ModuleType(module),
+			Dir:        ctx.ModuleDir(module),
+			Variant:    ctx.ModuleSubDir(module),
+			Properties: selected,
+		})
+	})
+
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("modules not found: %s", strings.Join(SortedUniqueStrings(missing), ", "))
+	}
+
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Name != variants[j].Name {
+			return variants[i].Name < variants[j].Name
+		}
+		if variants[i].Dir != variants[j].Dir {
+			return variants[i].Dir < variants[j].Dir
+		}
+		return variants[i].Variant < variants[j].Variant
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(variants)
+}
+
+// lookupDumpedProperty returns the value of a property with a possibly dotted name in the
+// properties returned by dumpModuleProperties, or nil if it is not set.
+func lookupDumpedProperty(props map[string]interface{}, property string) interface{} {
+	var value interface{} = props
+	for _, part := range strings.Split(property, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+// EffectiveSdkVersionsInfo is provided by the modules that are built against an SDK, with the
+// versions that they are built with, i.e. after the defaults of sdk_version and min_sdk_version
+// were applied.
+type EffectiveSdkVersionsInfo struct {
+	// The SDK that the module is built against, e.g. "system_30".
+	SdkVersion string
+
+	// The API level of the oldest release that the module runs on, e.g. "29".
+	MinSdkVersion string
+}
+
+var EffectiveSdkVersionsInfoProvider = blueprint.NewProvider(EffectiveSdkVersionsInfo{})
+
+// setEffectiveSdkVersionsInfo sets the EffectiveSdkVersionsInfoProvider of a module that
+// implements SdkContext. Other module types, e.g. cc modules, set it themselves.
+func (m *ModuleBase) setEffectiveSdkVersionsInfo(ctx ModuleContext) {
+	sdkContext, ok := m.module.(SdkContext)
+	if !ok {
+		return
+	}
+	minSdkVersion, err := sdkContext.MinSdkVersion(ctx).EffectiveVersionString(ctx)
+	if err != nil {
+		// The module reports the invalid version itself.
+		return
+	}
+	ctx.SetProvider(EffectiveSdkVersionsInfoProvider, EffectiveSdkVersionsInfo{
+		SdkVersion:    sdkContext.SdkVersion(ctx).String(),
+		MinSdkVersion: minSdkVersion,
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type moduleQuerySdkTestModule struct {
+	ModuleBase
+	props struct {
+		Sdk_version     *string
+		Min_sdk_version *string
+	}
+}
+
+func (m *moduleQuerySdkTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {}
+
+func (m *moduleQuerySdkTestModule) SdkVersion(ctx EarlyModuleContext) SdkSpec {
+	return SdkSpecFrom(ctx, String(m.props.Sdk_version))
+}
+
+func (m *moduleQuerySdkTestModule) SystemModules() string {
+	return ""
+}
+
+func (m *moduleQuerySdkTestModule) MinSdkVersion(ctx EarlyModuleContext) SdkSpec {
+	if m.props.Min_sdk_version != nil {
+		return SdkSpecFrom(ctx, *m.props.Min_sdk_version)
+	}
+	return m.SdkVersion(ctx)
+}
+
+func (m *moduleQuerySdkTestModule) TargetSdkVersion(ctx EarlyModuleContext) SdkSpec {
+	return m.SdkVersion(ctx)
+}
+
+func moduleQuerySdkTestModuleFactory() Module {
+	m := &moduleQuerySdkTestModule{}
+	m.AddProperties(&m.props)
+	InitAndroidModule(m)
+	return m
+}
+
+func TestWriteModuleQuery(t *testing.T) {
+	result := GroupFixturePreparers(
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("test", moduleDumpTestModuleFactory)
+		}),
+		FixtureWithRootAndroidBp(`
+			test {
+				name: "foo",
+				srcs: ["a.c"],
+				nested: {
+					flags: ["-a"],
+				},
+				target: {
+					android: {
+						stem: "foo_android",
+					},
+				},
+			}
+
+			test {
+				name: "bar",
+				host_supported: true,
+				stem: "bar",
+			}
+
+			test {
+				name: "baz",
+			}
+		`),
+	).RunTest(t)
+
+	var sb strings.Builder
+	err := WriteModuleQuery(result.TestContext.Context, &sb, []string{"foo", "bar"},
+		[]string{"stem", "nested.flags", "nested.missing", "unknown"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var variants []struct {
+		Name       string
+		Variant    string
+		Properties map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(sb.String()), &variants); err != nil {
+		t.Fatalf("invalid JSON %q: %s", sb.String(), err)
+	}
+
+	buildOS := result.Config.BuildOS.String()
+	AssertIntEquals(t, "number of variants", 3, len(variants))
+	AssertStringEquals(t, "bar device variant", "bar/android_common", variants[0].Name+"/"+variants[0].Variant)
+	AssertStringEquals(t, "bar host variant", "bar/"+buildOS+"_common", variants[1].Name+"/"+variants[1].Variant)
+	AssertStringEquals(t, "foo variant", "foo/android_common", variants[2].Name+"/"+variants[2].Variant)
+
+	AssertDeepEquals(t, "bar properties", map[string]interface{}{
+		"stem":           "bar",
+		"nested.flags":   nil,
+		"nested.missing": nil,
+		"unknown":        nil,
+	}, variants[0].Properties)
+	AssertDeepEquals(t, "foo properties", map[string]interface{}{
+		"stem":           "foo_android",
+		"nested.flags":   []interface{}{"-a"},
+		"nested.missing": nil,
+		"unknown":        nil,
+	}, variants[2].Properties)
+
+	err = WriteModuleQuery(result.TestContext.Context, &sb, []string{"qux", "foo", "quux"}, []string{"stem"})
+	AssertErrorMessageEquals(t, "missing modules", "modules not found: quux, qux", err)
+}
+
+func TestWriteModuleQuery_EffectiveSdkVersions(t *testing.T) {
+	result := GroupFixturePreparers(
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("sdk_test", moduleQuerySdkTestModuleFactory)
+		}),
+		FixtureWithRootAndroidBp(`
+			sdk_test {
+				name: "foo",
+				sdk_version: "system_30",
+			}
+
+			sdk_test {
+				name: "bar",
+				sdk_version: "current",
+				min_sdk_version: "29",
+			}
+		`),
+	).RunTest(t)
+
+	var sb strings.Builder
+	err := WriteModuleQuery(result.TestContext.Context, &sb, []string{"foo", "bar"},
+		[]string{"sdk_version", "min_sdk_version"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var variants []struct {
+		Name       string
+		Properties map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(sb.String()), &variants); err != nil {
+		t.Fatalf("invalid JSON %q: %s", sb.String(), err)
+	}
+
+	AssertIntEquals(t, "number of variants", 2, len(variants))
+	AssertDeepEquals(t, "bar properties", map[string]interface{}{
+		"sdk_version":     "public_current",
+		"min_sdk_version": "29",
+	}, variants[0].Properties)
+	AssertDeepEquals(t, "foo properties", map[string]interface{}{
+		"sdk_version":     "system_30",
+		"min_sdk_version": "30",
+	}, variants[1].Properties)
+}
@@ -15,6 +15,7 @@
 package android
 
 import (
+	"fmt"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -590,6 +591,52 @@ type propsTestModule struct {
 	}
 }
 
+func TestInstalledFilesInPartition(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires linux")
+	}
+	bp := `
+		deps {
+			name: "foo",
+			deps: ["bar"],
+		}
+
+		deps {
+			name: "bar",
+		}
+	`
+
+	for _, katiEnabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("kati enabled %t", katiEnabled), func(t *testing.T) {
+			result := GroupFixturePreparers(
+				prepareForModuleTests,
+				PrepareForTestWithArchMutator,
+				FixtureModifyConfig(func(config Config) {
+					if katiEnabled {
+						SetKatiEnabledForTests(config)
+					}
+				}),
+			).RunTestWithBp(t, bp)
+
+			AssertDeepEquals(t, "files installed by foo",
+				[]string{"foo", "symlinks/foo -> ../foo"},
+				result.ModuleForTests("foo", "android_common").InstalledFilesInPartition("system"))
+
+			AssertDeepEquals(t, "files installed in system", []string{
+				"bar",
+				"foo",
+				"symlinks/bar -> ../bar",
+				"symlinks/foo -> ../foo",
+			}, InstalledFilesInPartitionForTests(result, "system"))
+
+			FixtureExpectInstalledFiles(t, result, "host", []string{
+				"linux-x86/foo",
+				"linux-x86/symlinks/foo -> ../foo",
+			})
+		})
+	}
+}
+
 func propsTestModuleFactory() Module {
 	module := &propsTestModule{}
 	module.AddProperties(&module.props, &module.otherProps)
@@ -0,0 +1,84 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+type moduleUnderDir struct {
+	dir        string
+	name       string
+	moduleType string
+	variants   []string
+}
+
+// WriteModulesUnder writes one line for every module defined in dir or its subdirectories, with
+// the directory, name, type and comma separated variants of the module, separated by tabs. As the
+// modules are listed after the mutators ran, this includes the modules created by other modules,
+// e.g. by soong_config_module_type wrappers or java_sdk_library, which are not visible in the
+// Android.bp files. A dir of "." lists all the modules.
+func WriteModulesUnder(ctx *Context, w io.Writer, dir string) error {
+	dir = filepath.Clean(dir)
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+		return fmt.Errorf("directory %q must be relative to the top of the source tree", dir)
+	}
+
+	modules := make(map[string]*moduleUnderDir)
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		moduleDir := ctx.ModuleDir(module)
+		if dir != "." && moduleDir != dir && !strings.HasPrefix(moduleDir, dir+"/") {
+			return
+		}
+		name := ctx.ModuleName(module)
+		key := moduleDir + "\t" + name
+		m, ok := modules[key]
+		if !ok {
+			m = &moduleUnderDir{
+				dir:        moduleDir,
+				name:       name,
+				moduleType: ctx.ModuleType(module),
+			}
+			modules[key] = m
+		}
+		if variant := ctx.ModuleSubDir(module); variant != "" {
+			m.variants = append(m.variants, variant)
+		}
+	})
+
+	if len(modules) == 0 {
+		return fmt.Errorf("no modules found under %q", dir)
+	}
+
+	keys := SortedStringKeys(modules)
+	buf := bufio.NewWriter(w)
+	for _, key := range keys {
+		m := modules[key]
+		sort.Strings(m.variants)
+		variants := strings.Join(m.variants, ",")
+		if variants == "" {
+			variants = "-"
+		}
+		fmt.Fprintf(buf, "%s\t%s\t%s\t%s\n", m.dir, m.name, m.moduleType, variants)
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteModulesUnder(t *testing.T) {
+	result := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureAddTextFile("foo/Android.bp", `
+			deps {
+				name: "foo",
+				host_supported: true,
+			}
+		`),
+		FixtureAddTextFile("foo/bar/Android.bp", `
+			deps {
+				name: "bar",
+			}
+		`),
+		FixtureAddTextFile("foobar/Android.bp", `
+			deps {
+				name: "foobar",
+			}
+		`),
+	).RunTest(t)
+
+	writeModulesUnder := func(dir string) string {
+		t.Helper()
+		var sb strings.Builder
+		if err := WriteModulesUnder(result.TestContext.Context, &sb, dir); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return sb.String()
+	}
+
+	buildOS := result.Config.BuildOS.String()
+	AssertStringEquals(t, "modules under foo",
+		"foo\tfoo\tdeps\tandroid_common,"+buildOS+"_common\n"+
+			"foo/bar\tbar\tdeps\tandroid_common\n",
+		writeModulesUnder("foo/"))
+	AssertStringEquals(t, "modules under foo/bar",
+		"foo/bar\tbar\tdeps\tandroid_common\n",
+		writeModulesUnder("foo/bar"))
+	AssertStringDoesContain(t, "all modules", writeModulesUnder("."), "foobar\tfoobar\tdeps\tandroid_common\n")
+
+	var sb strings.Builder
+	err := WriteModulesUnder(result.TestContext.Context, &sb, "baz")
+	AssertErrorMessageEquals(t, "no modules", `no modules found under "baz"`, err)
+	err = WriteModulesUnder(result.TestContext.Context, &sb, "../foo")
+	AssertErrorMessageEquals(t, "outside the tree", `directory "../foo" must be relative to the top of the source tree`, err)
+}
@@ -411,12 +411,14 @@ func bottomUpMutatorContextFactory(ctx blueprint.BottomUpMutatorContext, a Modul
 func (x *registerMutatorsContext) BottomUp(name string, m BottomUpMutator) MutatorHandle {
 	finalPhase := x.finalPhase
 	bazelConversionMode := x.bazelConversionMode
+	mutatorName := x.mutatorName(name)
 	f := func(ctx blueprint.BottomUpMutatorContext) {
 		if a, ok := ctx.Module().(Module); ok {
+			defer startAnalysisCost(ctx.Config().(Config), AnalysisCostMutator, mutatorName)()
 			m(bottomUpMutatorContextFactory(ctx, a, finalPhase, bazelConversionMode))
 		}
 	}
-	mutator := &mutator{name: x.mutatorName(name), bottomUpMutator: f}
+	mutator := &mutator{name: mutatorName, bottomUpMutator: f}
 	x.mutators = append(x.mutators, mutator)
 	return mutator
 }
@@ -435,8 +437,10 @@ func (x *registerMutatorsContext) mutatorName(name string) string {
 }
 
 func (x *registerMutatorsContext) TopDown(name string, m TopDownMutator) MutatorHandle {
+	mutatorName := x.mutatorName(name)
 	f := func(ctx blueprint.TopDownMutatorContext) {
 		if a, ok := ctx.Module().(Module); ok {
+			defer startAnalysisCost(ctx.Config().(Config), AnalysisCostMutator, mutatorName)()
 			moduleContext := a.base().baseModuleContextFactory(ctx)
 			moduleContext.bazelConversionMode = x.bazelConversionMode
 			actx := &topDownMutatorContext{
@@ -446,7 +450,7 @@ func (x *registerMutatorsContext) TopDown(name string, m TopDownMutator) Mutator
 			m(actx)
 		}
 	}
-	mutator := &mutator{name: x.mutatorName(name), topDownMutator: f}
+	mutator := &mutator{name: mutatorName, topDownMutator: f}
 	x.mutators = append(x.mutators, mutator)
 	return mutator
 }
@@ -122,6 +122,8 @@ func (r *NameResolver) addNewNamespaceForModule(module *NamespaceModule, path st
 	module.namespace = namespace
 	module.resolver = r
 	namespace.importedNamespaceNames = module.properties.Imports
+	namespace.packageBoundary = String(module.properties.Package_boundary)
+	namespace.strictGlobs = Bool(module.properties.Strict_globs)
 	return r.addNamespace(namespace)
 }
 
@@ -360,6 +362,12 @@ type Namespace struct {
 	// all namespaces that should be searched when a module in this namespace declares a dependency
 	visibleNamespaces []*Namespace
 
+	// the package_boundary property of the namespace
+	packageBoundary string
+
+	// the strict_globs property of the namespace
+	strictGlobs bool
+
 	id string
 
 	exportToKati bool
@@ -373,10 +381,30 @@ func NewNamespace(path string) *Namespace {
 
 var _ blueprint.Namespace = (*Namespace)(nil)
 
+// PackageBoundary returns the package boundary enforced on the modules in the namespace that don't
+// set their own, or an empty string if the namespace doesn't set one.
+func (n *Namespace) PackageBoundary() string {
+	return n.packageBoundary
+}
+
+// StrictGlobs returns true if the modules in the namespace that don't set their own strict_globs
+// property fail on globs that match files outside of their directory.
+func (n *Namespace) StrictGlobs() bool {
+	return n.strictGlobs
+}
+
 type namespaceProperties struct {
 	// a list of namespaces that contain modules that will be referenced
 	// by modules in this namespace.
 	Imports []string `android:"path"`
+
+	// the default package_boundary of the modules in this namespace, see the package_boundary
+	// property of the java modules.
+	Package_boundary *string
+
+	// the default strict_globs of the modules in this namespace, see the strict_globs property of
+	// the modules.
+	Strict_globs *bool
 }
 
 type NamespaceModule struct {
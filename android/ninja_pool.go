@@ -0,0 +1,121 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// This file contains the support for Ninja pools defined by the product, which limit how many of
+// the actions of resource heavy modules, e.g. tools that diff full OTA packages, run in parallel.
+// A product defines a pool, its depth and the modules that are allowed to use it in the NinjaPools
+// product variable, e.g.
+//
+//	"NinjaPools": [
+//	  {
+//	    "Name": "ota_diff_pool",
+//	    "Depth": 2,
+//	    "Modules": ["full_ota_diff"]
+//	  }
+//	]
+//
+// and the modules select the pool with their ninja_pool property. The pools are written to
+// out/soong/ninja_pools.ninja, which soong_ui includes in the combined Ninja file.
+
+func init() {
+	RegisterSingletonType("ninja_pools", ninjaPoolsSingletonFactory)
+}
+
+// NinjaPool is a Ninja pool defined by the product.
+type NinjaPool struct {
+	// The name of the pool.
+	Name string
+
+	// The number of actions in the pool that can run in parallel.
+	Depth int
+
+	// The names of the modules that are allowed to run their actions in the pool.
+	Modules []string
+}
+
+var ninjaPoolNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// reservedNinjaPools are the pools that are defined by Ninja or by soong_ui and so cannot be
+// defined by the product.
+var reservedNinjaPools = []string{"console", "local_pool", "highmem_pool", "remote_pool"}
+
+// NinjaPoolForModule returns the pool that the actions of the module run in when its property is
+// set to the name of the pool, or nil if the name is empty. It reports an error if the product does
+// not define the pool or does not allow the module to use it.
+func NinjaPoolForModule(ctx ModuleContext, property string, name string) blueprint.Pool {
+	if name == "" {
+		return nil
+	}
+	pool, ok := ctx.Config().NinjaPool(name)
+	if !ok {
+		ctx.PropertyErrorf(property, "ninja pool %q is not defined in the NinjaPools of the product", name)
+		return nil
+	}
+	if !InList(ctx.ModuleName(), pool.Modules) {
+		ctx.PropertyErrorf(property, "module %q is not in the modules allowed to use ninja pool %q, "+
+			"add it to the Modules of the pool in the NinjaPools of the product", ctx.ModuleName(), name)
+		return nil
+	}
+	// The pool is declared in ninja_pools.ninja rather than in the Ninja file written by Soong.
+	return blueprint.NewBuiltinPool(name)
+}
+
+func ninjaPoolsSingletonFactory() Singleton {
+	return &ninjaPoolsSingleton{}
+}
+
+type ninjaPoolsSingleton struct{}
+
+// GenerateBuildActions writes the pools defined by the product to ninja_pools.ninja. The file is
+// written even if the product does not define any pools, so that it never declares pools that are
+// no longer defined.
+func (s *ninjaPoolsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	sb := &strings.Builder{}
+	sb.WriteString("# Ninja pools defined by the NinjaPools of the product, generated by Soong.\n")
+	seen := make(map[string]bool)
+	for _, pool := range ctx.Config().productVariables.NinjaPools {
+		if !ninjaPoolNameRegexp.MatchString(pool.Name) {
+			ctx.Errorf("NinjaPools: invalid pool name %q", pool.Name)
+			continue
+		}
+		if InList(pool.Name, reservedNinjaPools) {
+			ctx.Errorf("NinjaPools: pool %q is reserved", pool.Name)
+			continue
+		}
+		if seen[pool.Name] {
+			ctx.Errorf("NinjaPools: pool %q is defined more than once", pool.Name)
+			continue
+		}
+		seen[pool.Name] = true
+		if pool.Depth <= 0 {
+			ctx.Errorf("NinjaPools: depth of pool %q must be positive, not %d", pool.Name, pool.Depth)
+			continue
+		}
+		fmt.Fprintf(sb, "pool %s\n depth = %d\n", pool.Name, pool.Depth)
+	}
+
+	if err := WriteFileToOutputDir(PathForOutput(ctx, "ninja_pools.ninja"), []byte(sb.String()), 0666); err != nil {
+		ctx.Errorf("writing ninja_pools.ninja failed: %s", err)
+	}
+}
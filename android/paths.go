@@ -91,6 +91,10 @@ type ModuleWithDepsPathContext interface {
 	EarlyModulePathContext
 	VisitDirectDepsBlueprint(visit func(blueprint.Module))
 	OtherModuleDependencyTag(m blueprint.Module) blueprint.DependencyTag
+
+	// Target returns the target of the module variant, which selects the arch and target specific
+	// files of the filegroups it depends on.
+	Target() Target
 }
 
 // ModuleMissingDepsPathContext is a subset of *ModuleContext methods required by
@@ -506,6 +510,8 @@ func getPathsFromModuleDep(ctx ModuleWithDepsPathContext, path, moduleName, tag
 	} else if goBinary, ok := module.(bootstrap.GoBinaryTool); ok {
 		goBinaryPath := PathForGoBinary(ctx, goBinary)
 		return Paths{goBinaryPath}, nil
+	} else if srcProducer, ok := module.(TargetSpecificSourceFileProducer); ok {
+		return srcProducer.SrcsForTarget(ctx.Target()), nil
 	} else if srcProducer, ok := module.(SourceFileProducer); ok {
 		return srcProducer.Srcs(), nil
 	} else {
@@ -632,6 +638,58 @@ type sourcePathInput struct {
 	includeDirs      bool
 }
 
+// strictGlobsContext is implemented by the contexts of the modules that can opt into failing on
+// globs that match files outside of their directory, see the strict_globs property.
+type strictGlobsContext interface {
+	strictGlobs() bool
+}
+
+// checkStrictGlob reports an error if the glob matched files that are outside of the module
+// directory once the symlinks to directories in their paths are resolved, and returns the other
+// matches. Globs are evaluated relative to the module directory and can't contain "..", so a
+// symlink is the only way for a glob to match a file outside of the module directory.
+func checkStrictGlob(ctx ModuleWithDepsPathContext, glob string, matches []string) []string {
+	moduleDir := ctx.ModuleDir()
+	fs := ctx.Config().fs
+	ret := make([]string, 0, len(matches))
+	reported := false
+	for _, match := range matches {
+		rel, err := filepath.Rel(moduleDir, match)
+		if err != nil || strings.HasPrefix(rel, "../") {
+			ret = append(ret, match)
+			continue
+		}
+		escaped := false
+		components := strings.Split(filepath.Clean(rel), "/")
+		for i := range components[:len(components)-1] {
+			dir := filepath.Join(moduleDir, filepath.Join(components[:i+1]...))
+			if info, err := fs.Lstat(dir); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			target, err := fs.Readlink(dir)
+			if err != nil {
+				continue
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(dir), target)
+			}
+			if rel, err := filepath.Rel(moduleDir, target); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				if !reported {
+					ReportPathErrorf(ctx, "glob %q matches %q through the symlink %q to %q outside of the module directory %q, which is not allowed with strict_globs",
+						glob, filepath.Clean(match), dir, target, moduleDir)
+					reported = true
+				}
+				escaped = true
+				break
+			}
+		}
+		if !escaped {
+			ret = append(ret, match)
+		}
+	}
+	return ret
+}
+
 // Expands one path string to Paths rooted from the module's local source
 // directory, excluding those listed in the expandedExcludes.
 // Expands globs, references to SourceFileProducer or OutputFileProducer modules using the ":name" and ":name{.tag}" syntax.
@@ -658,7 +716,14 @@ func expandOneSrcPath(input sourcePathInput) (Paths, error) {
 	} else {
 		p := pathForModuleSrc(input.context, input.path)
 		if pathtools.IsGlob(input.path) {
-			paths := GlobFiles(input.context, p.String(), input.expandedExcludes)
+			matches, err := input.context.GlobWithDeps(p.String(), input.expandedExcludes)
+			if err != nil {
+				input.context.ModuleErrorf("glob: %s", err.Error())
+			}
+			if ctx, ok := input.context.(strictGlobsContext); ok && ctx.strictGlobs() {
+				matches = checkStrictGlob(input.context, input.path, matches)
+			}
+			paths := pathsForModuleSrcFromFullPath(input.context, matches, false)
 			return PathsWithModuleSrcSubDir(input.context, paths, ""), nil
 		} else {
 			if exists, _, err := input.context.Config().fs.Exists(p.String()); err != nil {
@@ -1388,7 +1453,8 @@ func (p OutputPath) InSameDir(ctx PathContext, paths ...string) OutputPath {
 }
 
 // PathForIntermediates returns an OutputPath representing the top-level
-// intermediates directory.
+// intermediates directory. When SOONG_PER_PRODUCT_INTERMEDIATES is set it does not contain the
+// intermediates of the device variants of modules, see IntermediatesRoots.
 func PathForIntermediates(ctx PathContext, paths ...string) OutputPath {
 	path, err := validatePath(paths...)
 	if err != nil {
@@ -1516,7 +1582,7 @@ type ModuleOutPathContext interface {
 }
 
 func pathForModuleOut(ctx ModuleOutPathContext) OutputPath {
-	return PathForOutput(ctx, ".intermediates", ctx.ModuleDir(), ctx.ModuleName(), ctx.ModuleSubDir())
+	return PathForOutput(ctx, moduleIntermediatesDir(ctx), ctx.ModuleDir(), ctx.ModuleName(), ctx.ModuleSubDir())
 }
 
 // PathForVndkRefAbiDump returns an OptionalPath representing the path of the
@@ -1524,6 +1590,14 @@ func pathForModuleOut(ctx ModuleOutPathContext) OutputPath {
 func PathForVndkRefAbiDump(ctx ModuleInstallPathContext, version, fileName string,
 	isNdk, isLlndkOrVndk, isGzip bool) OptionalPath {
 
+	return ExistentPathForSource(ctx, VndkRefAbiDumpPath(ctx, version, fileName, isNdk, isLlndkOrVndk, isGzip))
+}
+
+// VndkRefAbiDumpPath returns the path, relative to the root of the source tree, where the reference
+// abi dump for the given module is stored, whether or not it exists.
+func VndkRefAbiDumpPath(ctx ModuleInstallPathContext, version, fileName string,
+	isNdk, isLlndkOrVndk, isGzip bool) string {
+
 	currentArchType := ctx.Arch().ArchType
 	primaryArchType := ctx.Config().DevicePrimaryArchType()
 	archName := currentArchType.String()
@@ -1549,7 +1623,7 @@ func PathForVndkRefAbiDump(ctx ModuleInstallPathContext, version, fileName strin
 		ext = ".lsdump"
 	}
 
-	return ExistentPathForSource(ctx, "prebuilts", "abi-dumps", dirName,
+	return filepath.Join("prebuilts", "abi-dumps", dirName,
 		version, binderBitness, archName, "source-based",
 		fileName+ext)
 }
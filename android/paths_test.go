@@ -1589,3 +1589,85 @@ func BenchmarkFirstUniquePaths(b *testing.B) {
 		})
 	}
 }
+
+func TestStrictGlobs(t *testing.T) {
+	prepareForStrictGlobsTest := GroupFixturePreparers(
+		PrepareForTestWithFilegroup,
+		PrepareForTestWithNamespace,
+		FixtureMergeMockFs(MockFS{
+			"common/c.txt":            nil,
+			"foo/a.txt":               nil,
+			"foo/sub/b.txt":           nil,
+			"foo/common -> ../common": nil,
+			"foo/local -> sub":        nil,
+		}),
+	)
+
+	testCases := []struct {
+		name        string
+		bp          string
+		expectedErr string
+	}{
+		{
+			name: "module",
+			bp: `
+				filegroup {
+					name: "foo",
+					srcs: ["*.txt", "common/*.txt"],
+					strict_globs: true,
+				}`,
+			expectedErr: `glob "common/\*.txt" matches "foo/common/c.txt" through the symlink "foo/common" to "common" outside of the module directory "foo", which is not allowed with strict_globs`,
+		},
+		{
+			name: "namespace",
+			bp: `
+				soong_namespace {
+					strict_globs: true,
+				}
+
+				filegroup {
+					name: "foo",
+					srcs: ["common/*.txt"],
+				}`,
+			expectedErr: `glob "common/\*.txt" matches "foo/common/c.txt" through the symlink "foo/common" to "common" outside of the module directory "foo"`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			GroupFixturePreparers(
+				prepareForStrictGlobsTest,
+				FixtureAddTextFile("foo/Android.bp", test.bp),
+			).
+				ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(test.expectedErr)).
+				RunTest(t)
+		})
+	}
+
+	// Globs through symlinks inside of the module directory are allowed, and a module can opt out
+	// of the strict globs of its namespace.
+	result := GroupFixturePreparers(
+		prepareForStrictGlobsTest,
+		FixtureAddTextFile("foo/Android.bp", `
+			soong_namespace {
+				strict_globs: true,
+			}
+
+			filegroup {
+				name: "foo",
+				srcs: ["*.txt", "local/*.txt"],
+			}
+
+			filegroup {
+				name: "bar",
+				srcs: ["*.txt", "common/*.txt"],
+				strict_globs: false,
+			}
+		`),
+	).RunTest(t)
+
+	foo := result.ModuleForTests("foo", "").Module().(*fileGroup)
+	AssertPathsRelativeToTopEquals(t, "foo srcs", []string{"foo/a.txt", "foo/local/b.txt"}, foo.srcs)
+	bar := result.ModuleForTests("bar", "").Module().(*fileGroup)
+	AssertPathsRelativeToTopEquals(t, "bar srcs", []string{"foo/a.txt", "foo/common/c.txt"}, bar.srcs)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"path/filepath"
+)
+
+// This file contains the support for building multiple products into one out directory. When
+// SOONG_PER_PRODUCT_INTERMEDIATES is set, e.g. with `m --per-product-intermediates`, the
+// intermediates of the device variants of modules are written to
+// out/soong/.product_intermediates/<product> instead of out/soong/.intermediates, so building
+// another product doesn't overwrite them and switching back to a product only rebuilds what
+// changed. The host variants are shared by all the products.
+
+// productIntermediatesDir returns the directory, relative to the Soong out directory, of the
+// intermediates of the device variants of modules when SOONG_PER_PRODUCT_INTERMEDIATES is set.
+func productIntermediatesDir(config Config) string {
+	return filepath.Join(".product_intermediates", config.DeviceProduct())
+}
+
+// IntermediatesRoots returns the directories that contain the intermediates of modules, i.e. the
+// shared intermediates directory and, when SOONG_PER_PRODUCT_INTERMEDIATES is set, the
+// intermediates directory of the device variants of the product.
+func IntermediatesRoots(ctx PathContext) []OutputPath {
+	roots := []OutputPath{PathForOutput(ctx, ".intermediates")}
+	if ctx.Config().PerProductIntermediates() {
+		roots = append(roots, PathForOutput(ctx, productIntermediatesDir(ctx.Config())))
+	}
+	return roots
+}
+
+// RelToIntermediates returns the path of an intermediate file relative to the intermediates
+// directory that contains it, i.e. starting with the directory of its module, and false if the path
+// is not in an intermediates directory.
+func RelToIntermediates(ctx PathContext, path string) (string, bool) {
+	for _, root := range IntermediatesRoots(ctx) {
+		if rel, ok := MaybeRel(ctx, root.String(), path); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// moduleIntermediatesDir returns the directory, relative to the Soong out directory, that contains
+// the intermediates of the module.
+func moduleIntermediatesDir(ctx ModuleOutPathContext) string {
+	if ctx.Config().PerProductIntermediates() {
+		if d, ok := ctx.(interface{ Device() bool }); ok && d.Device() {
+			return productIntermediatesDir(ctx.Config())
+		}
+	}
+	return ".intermediates"
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type productIntermediatesTestModule struct {
+	ModuleBase
+}
+
+func productIntermediatesTestModuleFactory() Module {
+	m := &productIntermediatesTestModule{}
+	InitAndroidArchModule(m, HostAndDeviceSupported, MultilibCommon)
+	return m
+}
+
+func (m *productIntermediatesTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	rule := NewRuleBuilder(pctx, ctx)
+	rule.Command().Text("cp").Input(PathForSource(ctx, "in")).Output(PathForModuleOut(ctx, "out"))
+	rule.Build("copy", "copy")
+}
+
+func TestPerProductIntermediates(t *testing.T) {
+	bp := `
+		test_module {
+			name: "foo",
+			host_supported: true,
+		}
+	`
+
+	prepare := GroupFixturePreparers(
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("test_module", productIntermediatesTestModuleFactory)
+		}),
+		FixtureWithRootAndroidBp(bp),
+		FixtureAddFile("in", nil),
+	)
+
+	t.Run("disabled", func(t *testing.T) {
+		result := prepare.RunTest(t)
+
+		device := result.ModuleForTests("foo", "android_common").Rule("copy")
+		AssertPathRelativeToTopEquals(t, "device output", "out/soong/.intermediates/foo/android_common/out", device.Output)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		result := GroupFixturePreparers(
+			prepare,
+			FixtureMergeEnv(map[string]string{"SOONG_PER_PRODUCT_INTERMEDIATES": "true"}),
+		).RunTest(t)
+
+		device := result.ModuleForTests("foo", "android_common").Rule("copy")
+		AssertPathRelativeToTopEquals(t, "device output",
+			"out/soong/.product_intermediates/test_product/foo/android_common/out", device.Output)
+
+		// The host variants are shared by all the products.
+		host := result.ModuleForTests("foo", result.Config.BuildOSCommonTarget.String()).Rule("copy")
+		AssertPathRelativeToTopEquals(t, "host output",
+			"out/soong/.intermediates/foo/"+result.Config.BuildOSCommonTarget.String()+"/out", host.Output)
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FixtureFromRecordedFS adds the files listed in a manifest recorded from a real checkout by the
+// record_mock_fs tool to the mock filesystem. This makes it practical to write tests that mirror
+// the directory layout of production trees, e.g. prebuilts/sdk.
+//
+// The file is read relative to the directory of the test, e.g. "testdata/prebuilts_sdk.fs". Each
+// line of the manifest contains the tab separated path of a file, its size and the SHA256 of its
+// contents; only the paths are used as the recorded files are added with empty contents.
+//
+// Fail if the filesystem already contains a file with one of the recorded paths.
+func FixtureFromRecordedFS(file string) FixturePreparer {
+	return FixtureModifyMockFS(func(fs MockFS) {
+		f, err := os.Open(file)
+		if err != nil {
+			panic(fmt.Errorf("could not open recorded filesystem: %s", err))
+		}
+		defer f.Close()
+
+		recorded, err := parseRecordedFS(f, file)
+		if err != nil {
+			panic(err)
+		}
+		for path := range recorded {
+			if _, ok := fs[path]; ok {
+				panic(fmt.Errorf("attempted to add recorded file %s to the mock filesystem but it already exists", path))
+			}
+		}
+		fs.Merge(recorded)
+	})
+}
+
+// parseRecordedFS parses a manifest recorded by record_mock_fs into a MockFS.
+func parseRecordedFS(r io.Reader, name string) (MockFS, error) {
+	fs := MockFS{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected <path>\\t<size>\\t<sha256>, got %q", name, lineNum, line)
+		}
+		path := fields[0]
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid size %q for %s", name, lineNum, fields[1], path)
+		}
+		if _, ok := fs[path]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate path %s", name, lineNum, path)
+		}
+		fs[path] = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read recorded filesystem %s: %s", name, err)
+	}
+	return fs, nil
+}
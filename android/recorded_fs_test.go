@@ -0,0 +1,94 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const recordedFSForTests = `# Recorded by record_mock_fs prebuilts/sdk
+prebuilts/sdk/30/public/android.jar	3	98ea6e4f216f2fb4b69fff9b3a44842c38686ca685f3f55dc48c5d3fb1107be4
+
+prebuilts/sdk/30/public/api/android.txt	0	e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+`
+
+func TestParseRecordedFS(t *testing.T) {
+	fs, err := parseRecordedFS(strings.NewReader(recordedFSForTests), "test.fs")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	AssertArrayString(t, "recorded paths", []string{
+		"prebuilts/sdk/30/public/android.jar",
+		"prebuilts/sdk/30/public/api/android.txt",
+	}, SortedStringKeys(fs))
+}
+
+func TestParseRecordedFS_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		recorded string
+		err      string
+	}{
+		{
+			name:     "missing fields",
+			recorded: "a/b.txt\t0\n",
+			err:      `test.fs:1: expected <path>\t<size>\t<sha256>, got "a/b.txt\t0"`,
+		},
+		{
+			name:     "invalid size",
+			recorded: "# comment\na/b.txt\tbig\tabcd\n",
+			err:      `test.fs:2: invalid size "big" for a/b.txt`,
+		},
+		{
+			name:     "duplicate",
+			recorded: "a/b.txt\t0\tabcd\na/b.txt\t0\tabcd\n",
+			err:      `test.fs:2: duplicate path a/b.txt`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseRecordedFS(strings.NewReader(tc.recorded), "test.fs")
+			AssertErrorMessageEquals(t, "error", tc.err, err)
+		})
+	}
+}
+
+func TestFixtureFromRecordedFS(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prebuilts_sdk.fs")
+	if err := ioutil.WriteFile(file, []byte(recordedFSForTests), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	result := GroupFixturePreparers(
+		FixtureFromRecordedFS(file),
+	).RunTest(t)
+
+	ctx := PathContextForTesting(result.Config)
+	for _, path := range []string{"prebuilts/sdk/30/public/android.jar", "prebuilts/sdk/30/public/api/android.txt"} {
+		AssertBoolEquals(t, path+" exists", true, ExistentPathForSource(ctx, path).Valid())
+	}
+	AssertBoolEquals(t, "unrecorded file exists", false,
+		ExistentPathForSource(ctx, "prebuilts/sdk/31/public/android.jar").Valid())
+
+	AssertPanicMessageContains(t, "conflicting file", "already exists", func() {
+		GroupFixturePreparers(
+			FixtureAddFile("prebuilts/sdk/30/public/android.jar", nil),
+			FixtureFromRecordedFS(file),
+		).RunTest(t)
+	})
+}
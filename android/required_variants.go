@@ -0,0 +1,288 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// The modules listed in the required property are installed by Make, which silently drops the
+// ones that don't have a variant for the image and bitness of the requiring module, e.g. a vendor
+// only module required by a system module. The required_variants singleton verifies that every
+// required module defined in Soong has a matching variant, and reports the available variants
+// otherwise. Modules that are only defined in Make are not checked.
+//
+// A module can require the variants of another image with the required_images property. Make only
+// knows the variant of the image of the requiring module, so the required_images mutator resolves
+// the variants of the other images and adds them as install dependencies of the requiring module.
+
+func init() {
+	RegisterRequiredVariantsBuildComponents(InitRegistrationContext)
+}
+
+func RegisterRequiredVariantsBuildComponents(ctx RegistrationContext) {
+	ctx.PostDepsMutators(func(ctx RegisterMutatorsContext) {
+		ctx.BottomUp("required_images", requiredImagesMutator).Parallel()
+	})
+	ctx.RegisterSingletonType("required_variants", requiredVariantsSingletonFactory)
+}
+
+var PrepareForTestWithRequiredVariants = FixtureRegisterWithContext(RegisterRequiredVariantsBuildComponents)
+
+// The images supported by the required_images property.
+var requiredImages = []string{
+	"system", "vendor", "product", RamdiskVariation, VendorRamdiskVariation, DebugRamdiskVariation,
+	RecoveryVariation,
+}
+
+// installImage returns the image the module is installed in, as named in the required_images
+// property, and whether the module has image variants.
+func installImage(m Module) (string, bool) {
+	if _, ok := m.(ImageInterface); ok && m.Target().Os.Class == Device {
+		variation := m.base().commonProperties.ImageVariation
+		if variation == CoreVariation {
+			return "system", true
+		}
+		// Image variations may carry a version suffix, e.g. vendor.31.
+		return strings.SplitN(variation, ".", 2)[0], true
+	}
+	switch {
+	case m.InstallInRecovery():
+		return RecoveryVariation, false
+	case m.InstallInRamdisk():
+		return RamdiskVariation, false
+	case m.InstallInVendorRamdisk():
+		return VendorRamdiskVariation, false
+	case m.InstallInDebugRamdisk():
+		return DebugRamdiskVariation, false
+	case m.InstallInVendor():
+		return "vendor", false
+	case m.base().ProductSpecific():
+		return "product", false
+	default:
+		return "system", false
+	}
+}
+
+type requiredVariant struct {
+	target Target
+	image  string
+	// false if the module has no image variants, in which case Make installs its only variant
+	// whatever the image of the requiring module.
+	hasImageVariants bool
+	// true if the variant is for the first arch of its os, which Make installs for a requiring
+	// module of another bitness when there is no variant for that bitness.
+	firstArch bool
+}
+
+func (v requiredVariant) String() string {
+	return v.target.Os.String() + "_" + v.target.Arch.ArchType.String() + " " + v.image
+}
+
+// matches returns true if the variant is installed by Make for a module of the given target that
+// requires it in one of the given images.
+func (v requiredVariant) matches(target Target, images []string) bool {
+	if v.target.Os != target.Os {
+		return false
+	}
+	if v.hasImageVariants && !InList(v.image, images) {
+		return false
+	}
+	return v.target.Arch.ArchType == Common || target.Arch.ArchType == Common ||
+		v.target.Arch.ArchType.Multilib == target.Arch.ArchType.Multilib || v.firstArch
+}
+
+// requiredImagesDepTag is the dependency tag of the variants of the required modules in the other
+// images listed in the required_images property.
+type requiredImagesDepTag struct {
+	blueprint.BaseDependencyTag
+	InstallAlwaysNeededDependencyTag
+}
+
+var requiredImagesTag = requiredImagesDepTag{}
+
+// imageVariation returns the image variation of the variants of the modules with image variants
+// that are installed in the given image.
+func imageVariation(config DeviceConfig, image string) string {
+	vndkVersion := func(version string) string {
+		if version == "" || version == "current" {
+			return config.PlatformVndkVersion()
+		}
+		return version
+	}
+	switch image {
+	case "system":
+		return CoreVariation
+	case "vendor":
+		return "vendor." + vndkVersion(config.VndkVersion())
+	case "product":
+		return "product." + vndkVersion(config.ProductVndkVersion())
+	default:
+		return image
+	}
+}
+
+// requiredImagesMutator records the namespace of the module, used by the required_variants
+// singleton to resolve the names of its required modules, and adds install dependencies on the
+// variants of the required modules in the images listed in required_images other than the image of
+// the module.
+func requiredImagesMutator(ctx BottomUpMutatorContext) {
+	m := ctx.Module()
+	m.base().namespace = ctx.Namespace()
+	if !m.Enabled() || ctx.Os().Class != Device {
+		return
+	}
+
+	// Prefer the variant of the same bitness, then the common and first arch variants that Make
+	// falls back to.
+	targets := []Target{ctx.Target(), {Os: ctx.Os(), Arch: Arch{ArchType: Common}}}
+	if osTargets := ctx.Config().Targets[ctx.Os()]; len(osTargets) > 0 {
+		targets = append(targets, osTargets[0])
+	}
+
+	image, _ := installImage(m)
+	for _, requiredImage := range m.base().commonProperties.Required_images {
+		if requiredImage == image || !InList(requiredImage, requiredImages) {
+			continue
+		}
+		variation := blueprint.Variation{
+			Mutator:   "image",
+			Variation: imageVariation(ctx.DeviceConfig(), requiredImage),
+		}
+		for _, name := range m.RequiredModuleNames() {
+			if !ctx.OtherModuleExists(name) {
+				// Modules defined in Make are resolved by Make.
+				continue
+			}
+			// Required modules that have no variant in the image are reported by the
+			// required_variants singleton.
+			for _, target := range targets {
+				variations := append(target.Variations(), variation)
+				if ctx.OtherModuleFarDependencyVariantExists(variations, name) {
+					ctx.AddFarVariationDependencies(variations, requiredImagesTag, name)
+					break
+				}
+			}
+		}
+	}
+}
+
+// isFirstArch returns true if the target is the first target of its os.
+func isFirstArch(config Config, target Target) bool {
+	targets := config.Targets[target.Os]
+	return len(targets) > 0 && targets[0].Arch.ArchType == target.Arch.ArchType
+}
+
+func requiredVariantsSingletonFactory() Singleton {
+	return &requiredVariantsSingleton{}
+}
+
+type requiredVariantsSingleton struct{}
+
+// requiredVariantsKey identifies a module by its name and namespace, as modules in different
+// namespaces may have the same name.
+type requiredVariantsKey struct {
+	namespace *Namespace
+	name      string
+}
+
+// lookupRequired returns the variants of the module with the given name, resolved from the given
+// namespace the same way as the dependencies of the modules of the namespace.
+func lookupRequired(variants map[requiredVariantsKey][]requiredVariant, namespace *Namespace,
+	name string) ([]requiredVariant, bool) {
+
+	if strings.HasPrefix(name, "//") {
+		parts := strings.SplitN(strings.TrimPrefix(name, "//"), ":", 2)
+		if len(parts) != 2 {
+			return nil, false
+		}
+		for key, candidates := range variants {
+			if key.namespace.Path == parts[0] && key.name == parts[1] {
+				return candidates, true
+			}
+		}
+		return nil, false
+	}
+	for _, visible := range namespace.visibleNamespaces {
+		if candidates, ok := variants[requiredVariantsKey{visible, name}]; ok {
+			return candidates, true
+		}
+	}
+	return nil, false
+}
+
+func (s *requiredVariantsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	variants := make(map[requiredVariantsKey][]requiredVariant)
+	ctx.VisitAllModules(func(module Module) {
+		if !module.Enabled() || module.base().namespace == nil {
+			return
+		}
+		image, hasImageVariants := installImage(module)
+		key := requiredVariantsKey{module.base().namespace, ctx.ModuleName(module)}
+		variants[key] = append(variants[key], requiredVariant{
+			target:           module.Target(),
+			image:            image,
+			hasImageVariants: hasImageVariants,
+			firstArch:        isFirstArch(ctx.Config(), module.Target()),
+		})
+	})
+
+	ctx.VisitAllModules(func(module Module) {
+		if !module.Enabled() || module.Target().Os.Class != Device || module.base().namespace == nil {
+			return
+		}
+		images := module.base().commonProperties.Required_images
+		for _, image := range images {
+			if !InList(image, requiredImages) {
+				ctx.ModuleErrorf(module, "required_images: invalid image %q, expected one of %s",
+					image, strings.Join(requiredImages, ", "))
+				return
+			}
+		}
+		if len(images) == 0 {
+			image, _ := installImage(module)
+			images = []string{image}
+		}
+
+		for _, name := range module.RequiredModuleNames() {
+			candidates, ok := lookupRequired(variants, module.base().namespace, name)
+			if !ok {
+				// Modules defined in Make are resolved by Make.
+				continue
+			}
+			found := false
+			for _, candidate := range candidates {
+				if candidate.matches(module.Target(), images) {
+					found = true
+					break
+				}
+			}
+			if found || ctx.Config().AllowMissingDependencies() {
+				continue
+			}
+
+			var available []string
+			for _, candidate := range candidates {
+				available = append(available, candidate.String())
+			}
+			ctx.ModuleErrorf(module, "required: %q has no variant for %s %s, available variants:\n  %s\n"+
+				"set required_images to require it from another image",
+				name, module.Target().Arch.ArchType, strings.Join(images, ", "),
+				strings.Join(SortedUniqueStrings(available), "\n  "))
+		}
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type imageTestModule struct {
+	ModuleBase
+	props struct {
+		Vendor_only      *bool
+		Vendor_available *bool
+	}
+}
+
+func (m *imageTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	outputFile := PathForModuleOut(ctx, ctx.ModuleName())
+	ctx.Build(pctx, BuildParams{
+		Rule:   Touch,
+		Output: outputFile,
+	})
+	ctx.InstallFile(PathForModuleInstall(ctx, m.ImageVariation().Variation), ctx.ModuleName(), outputFile)
+}
+
+func (m *imageTestModule) ImageMutatorBegin(ctx BaseModuleContext) {}
+
+func (m *imageTestModule) CoreVariantNeeded(ctx BaseModuleContext) bool {
+	return !Bool(m.props.Vendor_only)
+}
+
+func (m *imageTestModule) RamdiskVariantNeeded(ctx BaseModuleContext) bool       { return false }
+func (m *imageTestModule) VendorRamdiskVariantNeeded(ctx BaseModuleContext) bool { return false }
+func (m *imageTestModule) DebugRamdiskVariantNeeded(ctx BaseModuleContext) bool  { return false }
+func (m *imageTestModule) RecoveryVariantNeeded(ctx BaseModuleContext) bool      { return false }
+
+func (m *imageTestModule) ExtraImageVariations(ctx BaseModuleContext) []string {
+	if Bool(m.props.Vendor_only) || Bool(m.props.Vendor_available) {
+		return []string{"vendor.29"}
+	}
+	return nil
+}
+
+func (m *imageTestModule) SetImageVariation(ctx BaseModuleContext, variation string, module Module) {}
+
+func imageTestModuleFactory() Module {
+	m := &imageTestModule{}
+	m.AddProperties(&m.props)
+	InitAndroidArchModule(m, DeviceSupported, MultilibCommon)
+	return m
+}
+
+var prepareForRequiredVariantsTest = GroupFixturePreparers(
+	prepareForModuleTests,
+	PrepareForTestWithRequiredVariants,
+	FixtureRegisterWithContext(func(ctx RegistrationContext) {
+		ctx.RegisterModuleType("image_module", imageTestModuleFactory)
+	}),
+	FixtureModifyProductVariables(func(variables FixtureProductVariables) {
+		variables.DeviceVndkVersion = stringPtr("29")
+	}),
+)
+
+func TestRequiredVariants(t *testing.T) {
+	bp := `
+		image_module {
+			name: "vendor_only",
+			vendor_only: true,
+		}
+
+		image_module {
+			name: "vendor_available",
+			vendor_available: true,
+		}
+
+		deps {
+			name: "vendor_deps",
+			vendor: true,
+		}
+
+		deps {
+			name: "system",
+			required: ["vendor_available", "vendor_deps", "defined_in_make"],
+		}
+
+		deps {
+			name: "system_requires_vendor",
+			required: ["vendor_only"],
+			required_images: ["vendor"],
+		}
+
+		image_module {
+			name: "vendor",
+			vendor_only: true,
+			required: ["vendor_only", "vendor_available"],
+		}
+	`
+
+	t.Run("valid", func(t *testing.T) {
+		result := prepareForRequiredVariantsTest.RunTestWithBp(t, bp)
+
+		// The vendor variant required from the system image is installed with the module that
+		// requires it.
+		install := result.ModuleForTests("system_requires_vendor", "android_common").
+			Output("out/soong/target/product/test_device/system/system_requires_vendor")
+		vendorInstall := result.ModuleForTests("vendor_only", "android_vendor.29_common").
+			Output("out/soong/target/product/test_device/system/vendor.29/vendor_only")
+		AssertStringListContains(t, "system_requires_vendor install dependencies",
+			install.Implicits.Strings(), vendorInstall.Output.String())
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		// The required modules are resolved in the namespace of the module that requires them.
+		GroupFixturePreparers(
+			prepareForRequiredVariantsTest,
+			PrepareForTestWithNamespace,
+			FixtureAddTextFile("vendor/Android.bp", `
+				soong_namespace {}
+
+				image_module {
+					name: "vendor_only",
+				}
+
+				deps {
+					name: "namespace_system",
+					required: ["vendor_only"],
+				}
+			`),
+		).
+			ExtendWithErrorHandler(FixtureExpectsAllErrorsToMatchAPattern([]string{
+				`required: "vendor_only" has no variant for common system, available variants:\n  android_common vendor\n`,
+			})).
+			RunTestWithBp(t, bp+`
+				deps {
+					name: "bad",
+					required: ["vendor_only"],
+				}
+			`)
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		prepareForRequiredVariantsTest.
+			ExtendWithErrorHandler(FixtureExpectsAllErrorsToMatchAPattern([]string{
+				`required: "vendor_only" has no variant for common system, available variants:\n  android_common vendor\n`,
+			})).
+			RunTestWithBp(t, bp+`
+				deps {
+					name: "bad",
+					required: ["vendor_only"],
+				}
+			`)
+	})
+
+	t.Run("bitness", func(t *testing.T) {
+		multilibBp := `
+			image_module {
+				name: "first_only",
+				compile_multilib: "first",
+			}
+
+			image_module {
+				name: "lib32_only",
+				compile_multilib: "32",
+			}
+
+			image_module {
+				name: "lib32_requirer",
+				compile_multilib: "32",
+				required: ["first_only", "lib32_only"],
+			}
+		`
+		// Make falls back to the first variant for a module of another bitness.
+		prepareForRequiredVariantsTest.RunTestWithBp(t, multilibBp)
+
+		prepareForRequiredVariantsTest.
+			ExtendWithErrorHandler(FixtureExpectsAllErrorsToMatchAPattern([]string{
+				`required: "lib32_only" has no variant for arm64 system, available variants:\n  android_arm system\n`,
+			})).
+			RunTestWithBp(t, multilibBp+`
+				image_module {
+					name: "first_requirer",
+					compile_multilib: "first",
+					required: ["lib32_only"],
+				}
+			`)
+	})
+
+	t.Run("invalid image", func(t *testing.T) {
+		prepareForRequiredVariantsTest.
+			ExtendWithErrorHandler(FixtureExpectsAllErrorsToMatchAPattern([]string{
+				`required_images: invalid image "odm", expected one of system, vendor, product, `,
+			})).
+			RunTestWithBp(t, bp+`
+				deps {
+					name: "bad",
+					required: ["vendor_only"],
+					required_images: ["odm"],
+				}
+			`)
+	})
+}
@@ -50,6 +50,7 @@ type RuleBuilder struct {
 	restat           bool
 	sbox             bool
 	highmem          bool
+	pool             blueprint.Pool
 	remoteable       RemoteRuleSupports
 	rbeParams        *remoteexec.REParams
 	outDir           WritablePath
@@ -113,6 +114,13 @@ func (r *RuleBuilder) HighMem() *RuleBuilder {
 	return r
 }
 
+// Pool sets the Ninja pool of the rule, e.g. a pool returned by NinjaPoolForModule, which takes
+// precedence over the pools selected by HighMem and Remoteable. A nil pool is ignored.
+func (r *RuleBuilder) Pool(pool blueprint.Pool) *RuleBuilder {
+	r.pool = pool
+	return r
+}
+
 // Remoteable marks the rule as supporting remote execution.
 func (r *RuleBuilder) Remoteable(supports RemoteRuleSupports) *RuleBuilder {
 	r.remoteable = supports
@@ -635,6 +643,15 @@ func (r *RuleBuilder) Build(name string, desc string) {
 			sboxCmd.Flag("--write-if-changed")
 		}
 
+		if network := r.ctx.Config().SboxNetwork(); network != "" {
+			sboxCmd.FlagWithArg("--network ", network)
+			if network == "audit" {
+				auditLog := r.sboxManifestPath.ReplaceExtension(r.ctx, "network_audit.log")
+				sboxCmd.FlagWithArg("--network-audit-log ", auditLog.String())
+				outputs = append(outputs, auditLog)
+			}
+		}
+
 		// Replace the command string, and add the sbox tool and manifest textproto to the
 		// dependencies of the final sbox rule.
 		commandString = sboxCmd.buf.String()
@@ -704,7 +721,9 @@ func (r *RuleBuilder) Build(name string, desc string) {
 	}
 
 	var pool blueprint.Pool
-	if r.ctx.Config().UseGoma() && r.remoteable.Goma {
+	if r.pool != nil {
+		pool = r.pool
+	} else if r.ctx.Config().UseGoma() && r.remoteable.Goma {
 		// When USE_GOMA=true is set and the rule is supported by goma, allow jobs to run outside the local pool.
 	} else if r.ctx.Config().UseRBE() && r.remoteable.RBE {
 		// When USE_RBE=true is set and the rule is supported by RBE, use the remotePool.
@@ -1028,7 +1047,8 @@ func (c *RuleBuilderCommand) ImplicitTools(paths Paths) *RuleBuilderCommand {
 }
 
 // BuiltTool adds the specified tool path that was built using a host Soong module to the command line.  The path will
-// be also added to the dependencies returned by RuleBuilder.Tools.
+// be also added to the dependencies returned by RuleBuilder.Tools, along with the files in the
+// HostToolRuntimeDepsInfo of the tool if the module building the rule depends on it.
 //
 // It is equivalent to:
 //  cmd.Tool(ctx.Config().HostToolPath(ctx, tool))
@@ -1040,6 +1060,13 @@ func (c *RuleBuilderCommand) BuiltTool(tool string) *RuleBuilderCommand {
 		// this could be a dependency + TransitivePackagingSpecs.
 		c.ImplicitTool(c.rule.ctx.Config().HostJNIToolPath(c.rule.ctx, "libc_musl"))
 	}
+	if ctx, ok := c.rule.ctx.(ModuleContext); ok {
+		ctx.VisitDirectDepsBlueprint(func(m blueprint.Module) {
+			if ctx.OtherModuleName(m) == tool && ctx.OtherModuleHasProvider(m, HostToolRuntimeDepsInfoProvider) {
+				c.ImplicitTools(ctx.OtherModuleProvider(m, HostToolRuntimeDepsInfoProvider).(HostToolRuntimeDepsInfo).Deps)
+			}
+		})
+	}
 	return c.builtToolWithoutDeps(tool)
 }
 
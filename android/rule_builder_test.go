@@ -720,6 +720,37 @@ func TestRuleBuilder_Build(t *testing.T) {
 	})
 }
 
+func TestRuleBuilder_SboxNetwork(t *testing.T) {
+	bp := `
+		rule_builder_test {
+			name: "foo_sbox",
+			srcs: ["in"],
+			sbox: true,
+		}
+	`
+
+	run := func(network string) TestingBuildParams {
+		result := GroupFixturePreparers(
+			prepareForRuleBuilderTest,
+			FixtureWithRootAndroidBp(bp),
+			MockFS{"in": nil, "cp": nil}.AddToFixture(),
+			FixtureMergeEnv(map[string]string{"SOONG_SBOX_NETWORK": network}),
+		).RunTest(t)
+		return result.ModuleForTests("foo_sbox", "").Output("gen/foo_sbox")
+	}
+
+	deny := run("deny")
+	AssertStringDoesContain(t, "sbox command", deny.RuleParams.Command, " --network deny")
+	AssertStringDoesNotContain(t, "sbox command", deny.RuleParams.Command, "--network-audit-log")
+
+	// The audit log is an output of the rule.
+	audit := run("audit")
+	auditLog := "out/soong/.intermediates/foo_sbox/sbox.network_audit.log"
+	AssertStringDoesContain(t, "sbox command", audit.RuleParams.Command,
+		" --network audit --network-audit-log "+auditLog)
+	AssertStringListContains(t, "sbox outputs", PathsRelativeToTop(audit.ImplicitOutputs.Paths()), auditLog)
+}
+
 func TestRuleBuilderHashInputs(t *testing.T) {
 	// The basic idea here is to verify that the command (in the case of a
 	// non-sbox rule) or the sbox textproto manifest contain a hash of the
@@ -792,3 +823,77 @@ func TestRuleBuilderHashInputs(t *testing.T) {
 		})
 	}
 }
+
+type testRuntimeDepsToolModule struct {
+	ModuleBase
+}
+
+func (t *testRuntimeDepsToolModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	ctx.SetProvider(HostToolRuntimeDepsInfoProvider, HostToolRuntimeDepsInfo{
+		Deps: Paths{PathForModuleOut(ctx, "runtime_dep")},
+	})
+}
+
+type testBuiltToolUserModule struct {
+	ModuleBase
+	properties struct {
+		Tools []string
+	}
+}
+
+type testBuiltToolDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+func (t *testBuiltToolUserModule) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), testBuiltToolDependencyTag{}, t.properties.Tools...)
+}
+
+func (t *testBuiltToolUserModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	rule := NewRuleBuilder(pctx, ctx)
+	out := PathForModuleOut(ctx, "out")
+	rule.Command().BuiltTool("tool").Output(out)
+	rule.Build("gen", "gen")
+}
+
+func TestRuleBuilderBuiltToolRuntimeDeps(t *testing.T) {
+	result := GroupFixturePreparers(
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("runtime_deps_tool", func() Module {
+				module := &testRuntimeDepsToolModule{}
+				InitAndroidModule(module)
+				return module
+			})
+			ctx.RegisterModuleType("built_tool_user", func() Module {
+				module := &testBuiltToolUserModule{}
+				module.AddProperties(&module.properties)
+				InitAndroidModule(module)
+				return module
+			})
+		}),
+		FixtureWithRootAndroidBp(`
+			runtime_deps_tool {
+				name: "tool",
+			}
+
+			built_tool_user {
+				name: "with_dep",
+				tools: ["tool"],
+			}
+
+			built_tool_user {
+				name: "without_dep",
+			}
+		`),
+	).RunTest(t)
+
+	// The runtime dependencies of the tool are only known to the modules that depend on it.
+	withDep := result.ModuleForTests("with_dep", "").Output("out")
+	AssertPathsRelativeToTopEquals(t, "with_dep implicits",
+		[]string{"out/soong/.intermediates/tool/runtime_dep", "out/soong/host/linux-x86/bin/tool"},
+		withDep.Implicits)
+
+	withoutDep := result.ModuleForTests("without_dep", "").Output("out")
+	AssertPathsRelativeToTopEquals(t, "without_dep implicits",
+		[]string{"out/soong/host/linux-x86/bin/tool"}, withoutDep.Implicits)
+}
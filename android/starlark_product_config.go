@@ -0,0 +1,75 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Products can be migrated off Make incrementally by defining some of their product variables in
+// Starlark (.scl) files. soong_ui evaluates the Starlark product config of the current product
+// after the Make product config, and writes the resulting product_variables dict as JSON to
+// soong.starlark.variables. The keys of the dict are the names of the fields of productVariables,
+// e.g.:
+//
+//	product_variables = {
+//	    "Platform_sdk_codename": "Tiramisu",
+//	    "DeviceAbi": ["arm64-v8a"],
+//	    "Unbundled_build": False,
+//	}
+//
+// The values in soong.starlark.variables override the ones from soong.variables.
+
+// loadFromStarlarkConfigFile overrides the product variables in configurable with the ones
+// evaluated from the Starlark product config in filename.
+func loadFromStarlarkConfigFile(configurable *productVariables, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		// Create an empty file, so that blueprint & ninja don't get in a dependency tracking loop.
+		return ioutil.WriteFile(filename, []byte("{}\n"), 0666)
+	} else if err != nil {
+		return fmt.Errorf("starlark config file: could not read %s: %s", filename, err.Error())
+	}
+
+	if err := applyStarlarkProductVariables(configurable, data); err != nil {
+		return fmt.Errorf("starlark config file: %s did not parse correctly: %s", filename, err.Error())
+	}
+	return nil
+}
+
+// applyStarlarkProductVariables decodes the JSON encoded product variables evaluated from a Starlark
+// product config into configurable. Only the variables set in the Starlark product config are
+// modified, and setting a variable that does not exist is an error so that typos in the Starlark
+// product config are not silently ignored.
+func applyStarlarkProductVariables(configurable *productVariables, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(configurable)
+}
+
+// FixtureProductVariablesFromStarlark returns a FixturePreparer that applies the JSON encoded
+// product variables evaluated from a Starlark product config to the config, the same way as they
+// would be applied when read from soong.starlark.variables.
+func FixtureProductVariablesFromStarlark(starlarkVariables string) FixturePreparer {
+	return FixtureModifyProductVariables(func(variables FixtureProductVariables) {
+		if err := applyStarlarkProductVariables(variables.productVariables, []byte(starlarkVariables)); err != nil {
+			panic(fmt.Errorf("invalid Starlark product variables %q: %s", starlarkVariables, err))
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+)
+
+func TestFixtureProductVariablesFromStarlark(t *testing.T) {
+	result := GroupFixturePreparers(
+		FixtureModifyProductVariables(func(variables FixtureProductVariables) {
+			variables.Platform_sdk_codename = proptools.StringPtr("S")
+			variables.DeviceProduct = proptools.StringPtr("make_product")
+		}),
+		FixtureProductVariablesFromStarlark(`{
+			"Platform_sdk_codename": "Tiramisu",
+			"Unbundled_build": true
+		}`),
+	).RunTest(t)
+
+	AssertStringEquals(t, "Platform_sdk_codename", "Tiramisu", result.Config.PlatformSdkCodename())
+	AssertBoolEquals(t, "Unbundled_build", true, result.Config.UnbundledBuild())
+	AssertStringEquals(t, "DeviceProduct", "make_product", result.Config.DeviceProduct())
+}
+
+func TestFixtureProductVariablesFromStarlark_UnknownVariable(t *testing.T) {
+	AssertPanicMessageContains(t, "unknown variable", `unknown field "Not_a_variable"`, func() {
+		GroupFixturePreparers(
+			FixtureProductVariablesFromStarlark(`{"Not_a_variable": true}`),
+		).RunTest(t)
+	})
+}
+
+func TestLoadFromStarlarkConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "soong.variables")
+	starlarkPath := filepath.Join(dir, "soong.starlark.variables")
+
+	v := productVariables{}
+	v.SetDefaultConfig()
+	v.DeviceName = proptools.StringPtr("make_device")
+	if err := saveToConfigFile(&v, path); err != nil {
+		t.Fatalf("Couldn't save product config: %q", err)
+	}
+
+	// A missing Starlark product config file is created empty.
+	var v2 productVariables
+	if err := loadFromConfigFile(&v2, path, starlarkPath); err != nil {
+		t.Fatalf("Couldn't load product config: %q", err)
+	}
+	AssertStringEquals(t, "DeviceName", "make_device", String(v2.DeviceName))
+	data, err := ioutil.ReadFile(starlarkPath)
+	if err != nil {
+		t.Fatalf("Starlark product config file was not created: %q", err)
+	}
+	AssertStringEquals(t, "empty Starlark product config", "{}\n", string(data))
+
+	// The variables from the Starlark product config override the ones from Make.
+	if err := ioutil.WriteFile(starlarkPath, []byte(`{"DeviceName": "starlark_device"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var v3 productVariables
+	if err := loadFromConfigFile(&v3, path, starlarkPath); err != nil {
+		t.Fatalf("Couldn't load product config: %q", err)
+	}
+	AssertStringEquals(t, "DeviceName", "starlark_device", String(v3.DeviceName))
+
+	if err := ioutil.WriteFile(starlarkPath, []byte(`{"DeviceNmae": "typo"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var v4 productVariables
+	err = loadFromConfigFile(&v4, path, starlarkPath)
+	AssertErrorMessageEquals(t, "unknown variable",
+		`starlark config file: `+starlarkPath+` did not parse correctly: json: unknown field "DeviceNmae"`, err)
+}
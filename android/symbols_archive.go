@@ -0,0 +1,192 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// The symbols_archive singleton packages the files needed to symbolize the artifacts installed on
+// a device into ${OUT_DIR}/soong/symbols/<product>/symbols.zip:
+//  - the unstripped version of every installed native binary, library and rust crate, at the
+//    path the stripped file is installed at on the device, e.g. system/lib64/libfoo.so.
+//  - the symbol files of the modules that opt in by setting SymbolsArchiveInfoProvider, e.g. the
+//    proguard dictionaries of apps and the unstripped payload of apexes.
+// The archive contains a manifest.json that maps every artifact to its symbol file in the archive.
+// Both are built by the symbols-archive goal and are disted as <product>-soong-symbols.zip and
+// <product>-soong-symbols-manifest.json.
+//
+// The archive is built in addition to the symbols packaged by Make, it does not replace them:
+// $(TARGET_OUT_UNSTRIPPED) is still populated from LOCAL_SOONG_UNSTRIPPED_BINARY for the tools
+// that symbolize from it, e.g. gdbclient and stack, and Make's symbols.zip is built from that
+// directory by build/make. The paths of the archive are exported to Make as SOONG_SYMBOLS_ZIP and
+// SOONG_SYMBOLS_MANIFEST so that Make can dist them instead of its own archive.
+
+func init() {
+	RegisterSymbolsArchiveBuildComponents(InitRegistrationContext)
+}
+
+func RegisterSymbolsArchiveBuildComponents(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("symbols_archive", symbolsArchiveSingletonFactory)
+}
+
+var PrepareForTestWithSymbolsArchive = FixtureRegisterWithContext(RegisterSymbolsArchiveBuildComponents)
+
+// SymbolsArchiveEntry is a symbol file to include in the symbols archive.
+type SymbolsArchiveEntry struct {
+	// Artifact is the path of the artifact on the device, relative to the root, e.g.
+	// system/app/Foo/Foo.apk.
+	Artifact string
+
+	// Symbols is the file that contains the symbols of the artifact.
+	Symbols Path
+
+	// Dest is the path of the symbol file in the archive.
+	Dest string
+}
+
+// SymbolsArchiveInfo is provided by modules whose symbol files should be included in the symbols
+// archive in addition to the unstripped versions of their installed files.
+type SymbolsArchiveInfo struct {
+	Entries []SymbolsArchiveEntry
+}
+
+var SymbolsArchiveInfoProvider = blueprint.NewProvider(SymbolsArchiveInfo{})
+
+// unstrippedOutputFileProducer is implemented by the native modules that install a stripped
+// version of their output file.
+type unstrippedOutputFileProducer interface {
+	UnstrippedOutputFile() Path
+}
+
+// SymbolsArchiveArtifactPath returns the path of an installed file on the device without the
+// leading /, which is how artifacts are identified in the symbols archive manifest.
+func SymbolsArchiveArtifactPath(ctx PathContext, path InstallPath) string {
+	return strings.TrimPrefix(InstallPathToOnDevicePath(ctx, path), "/")
+}
+
+func symbolsArchiveSingletonFactory() Singleton {
+	return &symbolsArchiveSingleton{}
+}
+
+type symbolsArchiveSingleton struct {
+	archive  WritablePath
+	manifest WritablePath
+}
+
+type symbolsArchiveManifestEntry struct {
+	Artifact string `json:"artifact"`
+	Symbols  string `json:"symbols"`
+}
+
+func (s *symbolsArchiveSingleton) GenerateBuildActions(ctx SingletonContext) {
+	entries := make(map[string]SymbolsArchiveEntry)
+	owners := make(map[string]string)
+	addEntry := func(m Module, entry SymbolsArchiveEntry) {
+		if existing, ok := entries[entry.Dest]; ok {
+			if existing.Symbols.String() != entry.Symbols.String() {
+				ctx.Errorf("symbols archive: %q is provided by both %q (%s) and %q (%s)",
+					entry.Dest, owners[entry.Dest], existing.Symbols, ctx.ModuleName(m), entry.Symbols)
+			}
+			return
+		}
+		entries[entry.Dest] = entry
+		owners[entry.Dest] = ctx.ModuleName(m)
+	}
+
+	ctx.VisitAllModules(func(m Module) {
+		if !m.Enabled() || m.Target().Os.Class != Device {
+			return
+		}
+		if p, ok := m.(unstrippedOutputFileProducer); ok && !m.IsSkipInstall() {
+			if unstripped := p.UnstrippedOutputFile(); unstripped != nil {
+				for _, installed := range m.FilesToInstall() {
+					// Skip the symlinks and the other files installed by the module.
+					if installed.Base() != unstripped.Base() {
+						continue
+					}
+					artifact := SymbolsArchiveArtifactPath(ctx, installed)
+					addEntry(m, SymbolsArchiveEntry{Artifact: artifact, Symbols: unstripped, Dest: artifact})
+				}
+			}
+		}
+		if ctx.ModuleHasProvider(m, SymbolsArchiveInfoProvider) {
+			info := ctx.ModuleProvider(m, SymbolsArchiveInfoProvider).(SymbolsArchiveInfo)
+			for _, entry := range info.Entries {
+				addEntry(m, entry)
+			}
+		}
+	})
+
+	if len(entries) == 0 {
+		return
+	}
+
+	dir := PathForOutput(ctx, "symbols", ctx.Config().DeviceProduct())
+	stagingDir := dir.Join(ctx, "staging")
+
+	var manifestEntries []symbolsArchiveManifestEntry
+	var stagedFiles Paths
+	for _, dest := range SortedStringKeys(entries) {
+		entry := entries[dest]
+		staged := stagingDir.Join(ctx, dest)
+		ctx.Build(pctx, BuildParams{
+			Rule:   Cp,
+			Input:  entry.Symbols,
+			Output: staged,
+		})
+		stagedFiles = append(stagedFiles, staged)
+		manifestEntries = append(manifestEntries, symbolsArchiveManifestEntry{
+			Artifact: entry.Artifact,
+			Symbols:  dest,
+		})
+	}
+
+	manifestJson, err := json.MarshalIndent(manifestEntries, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal the symbols archive manifest: %s", err)
+		return
+	}
+	s.manifest = stagingDir.Join(ctx, "manifest.json")
+	WriteFileRule(ctx, s.manifest, string(manifestJson))
+
+	s.archive = dir.Join(ctx, "symbols.zip")
+	rule := NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("soong_zip").
+		FlagWithOutput("-o ", s.archive).
+		FlagWithArg("-C ", stagingDir.String()).
+		FlagWithRspFileInputList("-r ", dir.Join(ctx, "symbols.zip.rsp"), append(stagedFiles, s.manifest))
+	rule.Build("symbols_archive", "symbols.zip")
+
+	ctx.Phony("symbols-archive", s.archive, s.manifest)
+}
+
+func (s *symbolsArchiveSingleton) MakeVars(ctx MakeVarsContext) {
+	if s.archive == nil {
+		return
+	}
+	// Exported so that the Make rules can reference the archive, e.g. to dist it with their own.
+	ctx.Strict("SOONG_SYMBOLS_ZIP", s.archive.String())
+	ctx.Strict("SOONG_SYMBOLS_MANIFEST", s.manifest.String())
+
+	product := ctx.Config().DeviceProduct()
+	ctx.DistForGoalWithFilename("symbols-archive", s.archive, product+"-soong-symbols.zip")
+	ctx.DistForGoalWithFilename("symbols-archive", s.manifest, product+"-soong-symbols-manifest.json")
+}
+
+var _ SingletonMakeVarsProvider = (*symbolsArchiveSingleton)(nil)
@@ -0,0 +1,135 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+)
+
+type symbolsTestModule struct {
+	ModuleBase
+	properties struct {
+		Install_name *string
+		Dictionary   *bool
+	}
+	unstripped Path
+}
+
+func symbolsTestModuleFactory() Module {
+	m := &symbolsTestModule{}
+	m.AddProperties(&m.properties)
+	InitAndroidArchModule(m, DeviceSupported, MultilibFirst)
+	return m
+}
+
+func (m *symbolsTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	name := proptools.StringDefault(m.properties.Install_name, ctx.ModuleName()) + ".so"
+	m.unstripped = PathForModuleOut(ctx, "unstripped", name)
+	stripped := PathForModuleOut(ctx, name)
+	installed := ctx.InstallFile(PathForModuleInstall(ctx, "lib64"), name, stripped)
+	ctx.InstallSymlink(PathForModuleInstall(ctx, "lib64"), "link.so", installed)
+
+	if Bool(m.properties.Dictionary) {
+		artifact := SymbolsArchiveArtifactPath(ctx, installed)
+		ctx.SetProvider(SymbolsArchiveInfoProvider, SymbolsArchiveInfo{
+			Entries: []SymbolsArchiveEntry{{
+				Artifact: artifact,
+				Symbols:  PathForModuleOut(ctx, "dictionary"),
+				Dest:     "dictionaries/" + artifact,
+			}},
+		})
+	}
+}
+
+func (m *symbolsTestModule) UnstrippedOutputFile() Path {
+	return m.unstripped
+}
+
+var prepareForSymbolsArchiveTest = GroupFixturePreparers(
+	PrepareForTestWithSymbolsArchive,
+	FixtureRegisterWithContext(func(ctx RegistrationContext) {
+		ctx.RegisterModuleType("symbols_test", symbolsTestModuleFactory)
+	}),
+)
+
+func TestSymbolsArchive(t *testing.T) {
+	result := prepareForSymbolsArchiveTest.RunTestWithBp(t, `
+		symbols_test {
+			name: "libfoo",
+		}
+
+		symbols_test {
+			name: "libbar",
+			dictionary: true,
+		}
+
+		symbols_test {
+			name: "libdisabled",
+			enabled: false,
+		}
+	`)
+
+	singleton := result.SingletonForTests("symbols_archive")
+
+	staged := singleton.Output("symbols/test_product/staging/system/lib64/libfoo.so")
+	AssertPathRelativeToTopEquals(t, "libfoo symbols", "out/soong/.intermediates/libfoo/android_arm64_armv8-a/unstripped/libfoo.so", staged.Input)
+	singleton.Output("symbols/test_product/staging/system/lib64/libbar.so")
+	singleton.Output("symbols/test_product/staging/dictionaries/system/lib64/libbar.so")
+	AssertStringEquals(t, "link.so symbols", "", singleton.MaybeOutput("symbols/test_product/staging/system/lib64/link.so").RuleParams.Command)
+	AssertStringEquals(t, "libdisabled symbols", "", singleton.MaybeOutput("symbols/test_product/staging/system/lib64/libdisabled.so").RuleParams.Command)
+
+	manifest := singleton.Output("symbols/test_product/staging/manifest.json")
+	AssertStringEquals(t, "manifest", `[
+  {
+    "artifact": "system/lib64/libbar.so",
+    "symbols": "dictionaries/system/lib64/libbar.so"
+  },
+  {
+    "artifact": "system/lib64/libbar.so",
+    "symbols": "system/lib64/libbar.so"
+  },
+  {
+    "artifact": "system/lib64/libfoo.so",
+    "symbols": "system/lib64/libfoo.so"
+  }
+]`, ContentFromFileRuleForTests(t, manifest))
+
+	archive := singleton.Output("symbols/test_product/symbols.zip")
+	AssertStringDoesContain(t, "archive command", archive.RuleParams.Command, "-C out/soong/symbols/test_product/staging")
+	AssertPathsRelativeToTopEquals(t, "archive inputs", []string{
+		"out/soong/symbols/test_product/staging/dictionaries/system/lib64/libbar.so",
+		"out/soong/symbols/test_product/staging/system/lib64/libbar.so",
+		"out/soong/symbols/test_product/staging/system/lib64/libfoo.so",
+		"out/soong/symbols/test_product/staging/manifest.json",
+	}, archive.Inputs)
+}
+
+func TestSymbolsArchiveConflict(t *testing.T) {
+	prepareForSymbolsArchiveTest.
+		ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`symbols archive: "system/lib64/libfoo.so" is provided by both`)).
+		RunTestWithBp(t, `
+			symbols_test {
+				name: "libfoo",
+			}
+
+			symbols_test {
+				name: "libfoo_copy",
+				install_name: "libfoo",
+			}
+		`)
+}
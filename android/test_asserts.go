@@ -184,6 +184,103 @@ func AssertArrayString(t *testing.T, message string, expected, actual []string)
 	}
 }
 
+// AssertCommandEquals checks if the expected and actual commands consist of the same tokens, as
+// split by CommandTokens, so that differences in whitespace and quoting are ignored. If they are not
+// then it reports an error prefixed with the supplied message and including the first token that
+// differs.
+func AssertCommandEquals(t *testing.T, message string, expected string, actual string) {
+	t.Helper()
+	expectedTokens := CommandTokens(expected)
+	actualTokens := CommandTokens(actual)
+	for i := 0; i < len(expectedTokens) || i < len(actualTokens); i++ {
+		if i >= len(actualTokens) {
+			t.Errorf("%s: missing %d-th token %q\nexpected command:\n%s\nactual command:\n%s",
+				message, i, expectedTokens[i], expected, actual)
+			return
+		} else if i >= len(expectedTokens) {
+			t.Errorf("%s: unexpected %d-th token %q\nexpected command:\n%s\nactual command:\n%s",
+				message, i, actualTokens[i], expected, actual)
+			return
+		} else if expectedTokens[i] != actualTokens[i] {
+			t.Errorf("%s: expected %d-th token %q, actual %q\nexpected command:\n%s\nactual command:\n%s",
+				message, i, expectedTokens[i], actualTokens[i], expected, actual)
+			return
+		}
+	}
+}
+
+// AssertCommandContainsFlagWithArg checks if the command passes arg to flag, either as the token
+// following the flag, as a single flag=arg token, or, for a flag that ends with = or :, as a single
+// flag+arg token. If it does not then it reports an error prefixed with the supplied message and
+// including the values passed to the flag, if any.
+func AssertCommandContainsFlagWithArg(t *testing.T, message string, command string, flag string, arg string) {
+	t.Helper()
+	args := commandFlagArgs(CommandTokens(command), flag)
+	if !InList(arg, args) {
+		t.Errorf("%s: could not find %s with %q in %q, values of %s: %q", message, flag, arg, command, flag, args)
+	}
+}
+
+// commandFlagArgs returns all the values passed to flag in the tokens of a command.
+func commandFlagArgs(tokens []string, flag string) []string {
+	var args []string
+	for i, token := range tokens {
+		if token == flag && i+1 < len(tokens) {
+			args = append(args, tokens[i+1])
+		} else if strings.HasSuffix(flag, "=") || strings.HasSuffix(flag, ":") {
+			if strings.HasPrefix(token, flag) {
+				args = append(args, strings.TrimPrefix(token, flag))
+			}
+		} else if strings.HasPrefix(token, flag+"=") {
+			args = append(args, strings.TrimPrefix(token, flag+"="))
+		}
+	}
+	return args
+}
+
+// CommandTokens splits a command, for example one built by a RuleBuilderCommand, into tokens the way
+// a shell would: tokens are separated by whitespace, single and double quotes are removed and
+// backslashes escape the following character outside of single quotes.
+func CommandTokens(command string) []string {
+	var tokens []string
+	var token strings.Builder
+	inToken := false
+	var quote rune
+	escaped := false
+	for _, c := range command {
+		switch {
+		case escaped:
+			token.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				token.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(c)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
 // AssertDeepEquals checks if the expected and actual values are equal using reflect.DeepEqual and
 // if they are not then it reports an error prefixed with the supplied message and including a
 // reason for why it failed.
@@ -0,0 +1,63 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+func TestCommandTokens(t *testing.T) {
+	testCases := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{
+			name:     "whitespace",
+			command:  "  foo   --bar\tbaz\n  qux ",
+			expected: []string{"foo", "--bar", "baz", "qux"},
+		},
+		{
+			name:     "single quotes",
+			command:  `rustc --cfg 'feature="fizz"' '' a'b c'd`,
+			expected: []string{"rustc", "--cfg", `feature="fizz"`, "", "ab cd"},
+		},
+		{
+			name:     "double quotes",
+			command:  `echo "a 'b' \"c\"" \$d`,
+			expected: []string{"echo", `a 'b' "c"`, "$d"},
+		},
+		{
+			name:     "empty",
+			command:  " ",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			AssertDeepEquals(t, "tokens", tc.expected, CommandTokens(tc.command))
+		})
+	}
+}
+
+func TestCommandFlagArgs(t *testing.T) {
+	tokens := CommandTokens("tool --baseline a.xml --error_check=NewApi -Jfoo --cp: b.jar --out:c.zip --error_check SomeCheck")
+
+	AssertArrayString(t, "--baseline", []string{"a.xml"}, commandFlagArgs(tokens, "--baseline"))
+	AssertArrayString(t, "--error_check", []string{"NewApi", "SomeCheck"}, commandFlagArgs(tokens, "--error_check"))
+	AssertArrayString(t, "--out:", []string{"c.zip"}, commandFlagArgs(tokens, "--out:"))
+	AssertArrayString(t, "--missing", []string{}, commandFlagArgs(tokens, "--missing"))
+}
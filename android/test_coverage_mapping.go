@@ -0,0 +1,156 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+
+	"github.com/google/blueprint"
+)
+
+func init() {
+	RegisterTestCoverageMappingBuildComponents(InitRegistrationContext)
+}
+
+func RegisterTestCoverageMappingBuildComponents(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("test_coverage_mapping", testCoverageMappingSingletonFactory)
+}
+
+// CoveredDependencyTag is implemented by dependency tags whose dependencies have their code linked
+// into or instrumented by the depending module, so that the tests that depend on the module
+// cover the dependencies too.
+type CoveredDependencyTag interface {
+	blueprint.DependencyTag
+
+	// CoveredDependency returns true if the tests of the depending module cover the dependency.
+	CoveredDependency() bool
+}
+
+// IsCoveredDependency returns true if the dependency tag implements the CoveredDependencyTag
+// interface and CoveredDependency returns true.
+func IsCoveredDependency(tag blueprint.DependencyTag) bool {
+	if c, ok := tag.(CoveredDependencyTag); ok {
+		return c.CoveredDependency()
+	}
+	return false
+}
+
+// TestCoverageInfo is provided by the test modules in a test suite.
+type TestCoverageInfo struct {
+	// The directories of the source modules covered by the test, by module name.
+	Covered map[string]string
+}
+
+var TestCoverageInfoProvider = blueprint.NewProvider(TestCoverageInfo{})
+
+// setTestCoverageInfo sets the TestCoverageInfoProvider of a test module in a test suite from the
+// modules that it transitively depends on through CoveredDependencyTags.
+func (m *ModuleBase) setTestCoverageInfo(ctx ModuleContext) {
+	tsm, ok := m.module.(TestSuiteModule)
+	if !ok || len(tsm.TestSuites()) == 0 || len(tsm.FilesToInstall()) == 0 {
+		return
+	}
+	covered := make(map[string]string)
+	ctx.WalkDeps(func(child, parent Module) bool {
+		if !IsCoveredDependency(ctx.OtherModuleDependencyTag(child)) {
+			return false
+		}
+		// Prebuilts have no source to cover.
+		if IsModulePrebuilt(child) {
+			return false
+		}
+		covered[ctx.OtherModuleName(child)] = ctx.OtherModuleDir(child)
+		return true
+	})
+	ctx.SetProvider(TestCoverageInfoProvider, TestCoverageInfo{Covered: covered})
+}
+
+func testCoverageMappingSingletonFactory() Singleton {
+	return &testCoverageMappingSingleton{}
+}
+
+// testCoverageMappingSingleton writes test_coverage_mapping.json, which maps every installed test
+// module to the source modules that it transitively depends on through CoveredDependencyTags,
+// i.e. the modules whose code is linked into or instrumented by the test. CI can use it to select
+// the tests affected by a change to a directory without relying on TEST_MAPPING files.
+type testCoverageMappingSingleton struct {
+	outputFile WritablePath
+}
+
+// testCoverageMappingEntry is the entry for a single test module in test_coverage_mapping.json.
+type testCoverageMappingEntry struct {
+	// The directory of the test module.
+	Path string `json:"path"`
+
+	// The names of the source modules covered by the test, sorted.
+	Covered_modules []string `json:"covered_modules"`
+
+	// The directories of the source modules covered by the test, sorted.
+	Covered_paths []string `json:"covered_paths"`
+}
+
+func (t *testCoverageMappingSingleton) GenerateBuildActions(ctx SingletonContext) {
+	modules := make(map[string]map[string]bool)
+	paths := make(map[string]map[string]bool)
+	testPaths := make(map[string]string)
+
+	ctx.VisitAllModules(func(m Module) {
+		if !ctx.ModuleHasProvider(m, TestCoverageInfoProvider) {
+			return
+		}
+		info := ctx.ModuleProvider(m, TestCoverageInfoProvider).(TestCoverageInfo)
+		name := ctx.ModuleName(m)
+		if modules[name] == nil {
+			modules[name] = make(map[string]bool)
+			paths[name] = make(map[string]bool)
+		}
+		testPaths[name] = ctx.ModuleDir(m)
+
+		for depName, dir := range info.Covered {
+			// Other variants of the test are not covered modules.
+			if depName == name {
+				continue
+			}
+			modules[name][depName] = true
+			paths[name][dir] = true
+		}
+	})
+
+	mapping := make(map[string]testCoverageMappingEntry)
+	for name := range modules {
+		mapping[name] = testCoverageMappingEntry{
+			Path:            testPaths[name],
+			Covered_modules: SortedStringKeys(modules[name]),
+			Covered_paths:   SortedStringKeys(paths[name]),
+		}
+	}
+
+	// encoding/json sorts the keys of maps, so the output is stable.
+	jsonStr, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal test coverage mapping: %s", err)
+		return
+	}
+
+	t.outputFile = PathForOutput(ctx, "test_coverage_mapping.json")
+	WriteFileRule(ctx, t.outputFile, string(jsonStr))
+	ctx.Phony("test_coverage_mapping", t.outputFile)
+}
+
+func (t *testCoverageMappingSingleton) MakeVars(ctx MakeVarsContext) {
+	if t.outputFile != nil {
+		ctx.DistForGoal("test_coverage_mapping", t.outputFile)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+type testCoverageDepTag struct {
+	blueprint.BaseDependencyTag
+	InstallAlwaysNeededDependencyTag
+	covered bool
+}
+
+func (t testCoverageDepTag) CoveredDependency() bool {
+	return t.covered
+}
+
+var _ CoveredDependencyTag = testCoverageDepTag{}
+
+type testCoverageTestModule struct {
+	ModuleBase
+	props struct {
+		Deps        []string
+		Data        []string
+		Test_suites []string
+	}
+}
+
+func (m *testCoverageTestModule) TestSuites() []string {
+	return m.props.Test_suites
+}
+
+func (m *testCoverageTestModule) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), testCoverageDepTag{covered: true}, m.props.Deps...)
+	ctx.AddDependency(ctx.Module(), testCoverageDepTag{covered: false}, m.props.Data...)
+}
+
+func (m *testCoverageTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	outputFile := PathForModuleOut(ctx, ctx.ModuleName())
+	ctx.Build(pctx, BuildParams{
+		Rule:   Touch,
+		Output: outputFile,
+	})
+	ctx.InstallFile(PathForModuleInstall(ctx), ctx.ModuleName(), outputFile)
+}
+
+func testCoverageTestModuleFactory() Module {
+	m := &testCoverageTestModule{}
+	m.AddProperties(&m.props)
+	InitAndroidArchModule(m, HostAndDeviceDefault, MultilibCommon)
+	return m
+}
+
+func TestTestCoverageMapping(t *testing.T) {
+	result := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("test_module", testCoverageTestModuleFactory)
+			RegisterTestCoverageMappingBuildComponents(ctx)
+		}),
+		FixtureAddTextFile("foo/Android.bp", `
+			test_module {
+				name: "foo_test",
+				deps: ["libfoo"],
+				data: ["foo_data"],
+				test_suites: ["general-tests"],
+			}
+
+			test_module {
+				name: "not_in_a_suite",
+				deps: ["libfoo"],
+			}
+		`),
+		FixtureAddTextFile("lib/foo/Android.bp", `
+			test_module {
+				name: "libfoo",
+				deps: ["libbar"],
+				data: ["libfoo_data"],
+			}
+
+			test_module {
+				name: "libfoo_data",
+			}
+		`),
+		FixtureAddTextFile("lib/bar/Android.bp", `
+			test_module {
+				name: "libbar",
+			}
+		`),
+		FixtureAddTextFile("data/Android.bp", `
+			test_module {
+				name: "foo_data",
+			}
+		`),
+	).RunTest(t)
+
+	mapping := result.SingletonForTests("test_coverage_mapping").Output("test_coverage_mapping.json")
+	AssertStringEquals(t, "test coverage mapping", `{
+  "foo_test": {
+    "path": "foo",
+    "covered_modules": [
+      "libbar",
+      "libfoo"
+    ],
+    "covered_paths": [
+      "lib/bar",
+      "lib/foo"
+    ]
+  }
+}
+`, ContentFromFileRuleForTests(t, mapping))
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// UpdateGoldenFilesEnvVar is the environment variable that, when set to "true" in the environment
+// of the test or in the environment of its fixture, makes AssertModuleActionsMatchGolden write the
+// golden files instead of comparing against them, e.g.
+//
+//	UPDATE_SOONG_GOLDEN_FILES=true go test ./java/...
+const UpdateGoldenFilesEnvVar = "UPDATE_SOONG_GOLDEN_FILES"
+
+// AssertModuleActionsMatchGolden checks that the build actions of the given variant of a module,
+// as serialized by ModuleActionsForGolden, match the contents of goldenFile, which is relative to
+// the directory of the test. If they do not then it reports an error including the first line that
+// differs.
+//
+// Golden files make the effect of large refactors of the builders of a module type reviewable, as
+// any change to the generated actions shows up as a diff of the golden file. They are written or
+// updated by running the test with UPDATE_SOONG_GOLDEN_FILES=true.
+func AssertModuleActionsMatchGolden(t *testing.T, result *TestResult, moduleName, variant, goldenFile string) {
+	t.Helper()
+	actual := ModuleActionsForGolden(result.ModuleForTests(moduleName, variant))
+
+	if os.Getenv(UpdateGoldenFilesEnvVar) == "true" || result.Config.IsEnvTrue(UpdateGoldenFilesEnvVar) {
+		if err := os.MkdirAll(filepath.Dir(goldenFile), 0777); err != nil {
+			t.Fatalf("failed to create directory for golden file %q: %s", goldenFile, err)
+		}
+		if err := ioutil.WriteFile(goldenFile, []byte(actual), 0666); err != nil {
+			t.Fatalf("failed to write golden file %q: %s", goldenFile, err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("failed to read golden file %q, run with %s=true to create it: %s",
+			goldenFile, UpdateGoldenFilesEnvVar, err)
+	}
+	if line, e, a := firstGoldenDifference(string(data), actual); line > 0 {
+		t.Errorf("actions of %q variant %q do not match golden file %q, run with %s=true to update it\n"+
+			"first difference on line %d:\nexpected: %q\nactual:   %q",
+			moduleName, variant, goldenFile, UpdateGoldenFilesEnvVar, line, e, a)
+	}
+}
+
+// firstGoldenDifference returns the number, starting at 1, of the first line that differs between
+// the expected and actual contents of a golden file along with the two lines, or 0 if they match.
+// A missing line is returned as an empty string.
+func firstGoldenDifference(expected, actual string) (int, string, string) {
+	if expected == actual {
+		return 0, "", ""
+	}
+
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	for i := 0; ; i++ {
+		if i >= len(expectedLines) || i >= len(actualLines) || expectedLines[i] != actualLines[i] {
+			var e, a string
+			if i < len(expectedLines) {
+				e = expectedLines[i]
+			}
+			if i < len(actualLines) {
+				a = actualLines[i]
+			}
+			return i + 1, e, a
+		}
+	}
+}
+
+// ModuleActionsForGolden returns a normalized textual form of all the build actions of a module,
+// suitable for storing in a golden file. Each action lists its rule, outputs, inputs, args and
+// command, with all paths relative to the notional top of the tree. Actions are sorted by their
+// outputs so that changing the order in which a module generates them does not change the result.
+func ModuleActionsForGolden(module TestingModule) string {
+	var actions []string
+	for _, p := range module.provider.BuildParamsForTests() {
+		actions = append(actions, formatActionForGolden(module.newTestingBuildParams(p)))
+	}
+	sort.Strings(actions)
+	return strings.Join(actions, "\n")
+}
+
+func formatActionForGolden(p TestingBuildParams) string {
+	sb := &strings.Builder{}
+
+	writeList := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(sb, "  %s:\n", name)
+		for _, v := range values {
+			fmt.Fprintf(sb, "    %s\n", v)
+		}
+	}
+	pathStrings := func(path Path, paths Paths) []string {
+		var ret []string
+		if path != nil {
+			ret = append(ret, path.String())
+		}
+		return append(ret, paths.Strings()...)
+	}
+	writablePathStrings := func(path WritablePath, paths WritablePaths) []string {
+		var ret []string
+		if path != nil {
+			ret = append(ret, path.String())
+		}
+		return append(ret, paths.Strings()...)
+	}
+
+	// The outputs come first, so that sorting the formatted actions sorts them by output.
+	writeList("outputs", writablePathStrings(p.Output, p.Outputs))
+	writeList("implicit_outputs", writablePathStrings(p.ImplicitOutput, p.ImplicitOutputs))
+	fmt.Fprintf(sb, "  rule: %s\n", p.Rule.String())
+	writeList("inputs", pathStrings(p.Input, p.Inputs))
+	writeList("implicits", pathStrings(p.Implicit, p.Implicits))
+	writeList("order_only", pathStrings(nil, p.OrderOnly))
+	writeList("validations", pathStrings(p.Validation, p.Validations))
+
+	var args []string
+	for _, k := range SortedStringKeys(p.Args) {
+		args = append(args, k+"="+p.Args[k])
+	}
+	writeList("args", args)
+
+	if p.RuleParams.Command != "" {
+		writeList("command", []string{p.RuleParams.Command})
+	}
+
+	return "action:\n" + sb.String()
+}
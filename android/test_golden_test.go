@@ -0,0 +1,174 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type goldenTestModule struct {
+	ModuleBase
+	properties struct {
+		Srcs []string `android:"path"`
+	}
+}
+
+func goldenTestModuleFactory() Module {
+	module := &goldenTestModule{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+func (m *goldenTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	srcs := PathsForModuleSrc(ctx, m.properties.Srcs)
+
+	// Generate the actions in reverse order of their outputs to check they are sorted.
+	rule := NewRuleBuilder(pctx, ctx)
+	rule.Command().Text("cat").Inputs(srcs).FlagWithOutput("> ", PathForModuleOut(ctx, "b.txt"))
+	rule.Build("cat", "cat")
+
+	ctx.Build(pctx, BuildParams{
+		Rule:   Cp,
+		Input:  srcs[0],
+		Output: PathForModuleOut(ctx, "a.txt"),
+		Args: map[string]string{
+			"cpFlags": "-f",
+		},
+	})
+}
+
+var prepareForGoldenTest = GroupFixturePreparers(
+	FixtureRegisterWithContext(func(ctx RegistrationContext) {
+		ctx.RegisterModuleType("golden_test", goldenTestModuleFactory)
+	}),
+	FixtureWithRootAndroidBp(`
+		golden_test {
+			name: "foo",
+			srcs: ["a.in", "b.in"],
+		}
+	`),
+	FixtureMergeMockFs(MockFS{
+		"a.in": nil,
+		"b.in": nil,
+	}),
+)
+
+func TestModuleActionsForGolden(t *testing.T) {
+	result := prepareForGoldenTest.RunTest(t)
+
+	actions := ModuleActionsForGolden(result.ModuleForTests("foo", ""))
+
+	// Rule names depend on how the rules are defined, so check the rest of each action.
+	cp := `action:
+  outputs:
+    out/soong/.intermediates/foo/a.txt
+  rule: `
+	cpArgs := `
+  inputs:
+    a.in
+  args:
+    cpFlags=-f
+  command:
+    rm -f $out && cp $cpPreserveSymlinks $cpFlags $in $out$extraCmds
+`
+	cat := `action:
+  outputs:
+    out/soong/.intermediates/foo/b.txt
+  rule: `
+	catArgs := `
+  implicits:
+    a.in
+    b.in
+  command:
+    cat a.in b.in > out/soong/.intermediates/foo/b.txt
+`
+	for _, s := range []string{cp, cpArgs, cat, catArgs} {
+		AssertStringDoesContain(t, "actions", actions, s)
+	}
+	if strings.Index(actions, cp) > strings.Index(actions, cat) {
+		t.Errorf("expected actions to be sorted by output, got:\n%s", actions)
+	}
+}
+
+func TestAssertModuleActionsMatchGolden(t *testing.T) {
+	goldenFile := filepath.Join(t.TempDir(), "testdata", "foo.golden")
+
+	result := GroupFixturePreparers(
+		prepareForGoldenTest,
+		FixtureMergeEnv(map[string]string{
+			UpdateGoldenFilesEnvVar: "true",
+		}),
+	).RunTest(t)
+	AssertModuleActionsMatchGolden(t, result, "foo", "", goldenFile)
+
+	data, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertStringEquals(t, "golden file", ModuleActionsForGolden(result.ModuleForTests("foo", "")), string(data))
+
+	result = prepareForGoldenTest.RunTest(t)
+	AssertModuleActionsMatchGolden(t, result, "foo", "", goldenFile)
+}
+
+func TestFirstGoldenDifference(t *testing.T) {
+	testCases := []struct {
+		name             string
+		expected, actual string
+		line             int
+		expectedLine     string
+		actualLine       string
+	}{
+		{
+			name:     "match",
+			expected: "a\nb\n",
+			actual:   "a\nb\n",
+		},
+		{
+			name:         "changed line",
+			expected:     "a\nb\nc\n",
+			actual:       "a\nB\nc\n",
+			line:         2,
+			expectedLine: "b",
+			actualLine:   "B",
+		},
+		{
+			name:         "missing line",
+			expected:     "a\nb",
+			actual:       "a",
+			line:         2,
+			expectedLine: "b",
+		},
+		{
+			name:     "extra newline",
+			expected: "a",
+			actual:   "a\n",
+			line:     2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			line, e, a := firstGoldenDifference(tc.expected, tc.actual)
+			AssertIntEquals(t, "line", tc.line, line)
+			AssertStringEquals(t, "expected line", tc.expectedLine, e)
+			AssertStringEquals(t, "actual line", tc.actualLine, a)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+
+	"github.com/google/blueprint"
+)
+
+func init() {
+	RegisterTestMappingBuildComponents(InitRegistrationContext)
+}
+
+func RegisterTestMappingBuildComponents(ctx RegistrationContext) {
+	ctx.PostDepsMutators(func(ctx RegisterMutatorsContext) {
+		ctx.BottomUp("test_mapping_deps", testMappingDepsMutator).Parallel()
+	})
+	ctx.RegisterSingletonType("test_mapping", testMappingSingletonFactory)
+}
+
+// TestMappingProperties are the properties of the test_mapping property struct of test modules,
+// which declare the modules that the test is for in the generated test mapping.
+type TestMappingProperties struct {
+	// Names of the modules that the test is for, which are listed in the generated test mapping.
+	Test_for []string
+
+	// If set, the test is run in presubmit for the modules listed in test_for in the generated
+	// test mapping, otherwise it is only run in postsubmit.
+	Presubmit *bool
+}
+
+// TestMappingModule is implemented by test modules that can declare the modules that they test
+// in their properties, usually with a test_mapping property of type TestMappingProperties.
+type TestMappingModule interface {
+	Module
+
+	// TestMappingTargets returns the names of the modules that the test is for.
+	TestMappingTargets() []string
+
+	// TestMappingPresubmit returns true if the test should run in presubmit for the modules
+	// returned by TestMappingTargets, and false if it should only run in postsubmit.
+	TestMappingPresubmit() bool
+}
+
+type testMappingDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+// TestMappingDepTag is the tag of the dependencies of a test on the modules that it is for. The
+// dependencies only record the modules in the test mapping, and are ignored by the build of the
+// test.
+var TestMappingDepTag testMappingDependencyTag
+
+// Mark this tag so dependencies that use it are excluded from visibility enforcement.
+func (t testMappingDependencyTag) ExcludeFromVisibilityEnforcement() {}
+
+// Mark this tag so dependencies that use it are excluded from APEX contents.
+func (t testMappingDependencyTag) ExcludeFromApexContents() {}
+
+// A test can be for a module that is disabled in the current product.
+func (t testMappingDependencyTag) AllowDisabledModuleDependency(target Module) bool {
+	return true
+}
+
+var _ ExcludeFromVisibilityEnforcementTag = TestMappingDepTag
+var _ ExcludeFromApexContentsTag = TestMappingDepTag
+var _ AllowDisabledModuleDependency = TestMappingDepTag
+
+// testMappingDepsMutator adds a dependency from a test to each module that it is for. Any variant
+// of the module is enough to find its name and directory.
+func testMappingDepsMutator(ctx BottomUpMutatorContext) {
+	if tmm, ok := ctx.Module().(TestMappingModule); ok && tmm.Enabled() {
+		ctx.AddFarVariationDependencies(nil, TestMappingDepTag, tmm.TestMappingTargets()...)
+	}
+}
+
+// TestMappingInfo is provided by the test modules that are for other modules.
+type TestMappingInfo struct {
+	// The directories of the modules that the test is for, keyed by their names.
+	Targets map[string]string
+
+	// Whether the test runs in presubmit for the modules.
+	Presubmit bool
+}
+
+var TestMappingInfoProvider = blueprint.NewProvider(TestMappingInfo{})
+
+// setTestMappingInfo sets the TestMappingInfoProvider of a TestMappingModule from its dependencies
+// on the modules that it is for.
+func (m *ModuleBase) setTestMappingInfo(ctx ModuleContext) {
+	tmm, ok := m.module.(TestMappingModule)
+	if !ok {
+		return
+	}
+	targets := make(map[string]string)
+	// The modules may be disabled, which the other visitors of the dependencies skip.
+	ctx.VisitDirectDepsBlueprint(func(dep blueprint.Module) {
+		if ctx.OtherModuleDependencyTag(dep) == TestMappingDepTag {
+			targets[ctx.OtherModuleName(dep)] = ctx.OtherModuleDir(dep)
+		}
+	})
+	if len(targets) > 0 {
+		ctx.SetProvider(TestMappingInfoProvider, TestMappingInfo{
+			Targets:   targets,
+			Presubmit: tmm.TestMappingPresubmit(),
+		})
+	}
+}
+
+func testMappingSingletonFactory() Singleton {
+	return &testMappingSingleton{}
+}
+
+// testMappingSingleton writes test_mapping.json, the equivalent of the TEST_MAPPING files for the
+// test relationships declared in Android.bp files. It maps every module that a test is for to the
+// directory of the module and the presubmit and postsubmit tests for it.
+type testMappingSingleton struct {
+	outputFile WritablePath
+}
+
+// testMappingTest is a test in test_mapping.json, in the same format as a test in a TEST_MAPPING
+// file.
+type testMappingTest struct {
+	Name string `json:"name"`
+}
+
+// testMappingEntry is the entry for a single module under test in test_mapping.json.
+type testMappingEntry struct {
+	// The directory of the module under test.
+	Path string `json:"path"`
+
+	// The tests to run in presubmit, sorted by name.
+	Presubmit []testMappingTest `json:"presubmit,omitempty"`
+
+	// The tests to run in postsubmit, sorted by name.
+	Postsubmit []testMappingTest `json:"postsubmit,omitempty"`
+}
+
+func (t *testMappingSingleton) GenerateBuildActions(ctx SingletonContext) {
+	moduleDirs := make(map[string]string)
+	presubmit := make(map[string]map[string]bool)
+	postsubmit := make(map[string]map[string]bool)
+
+	ctx.VisitAllModules(func(m Module) {
+		if !m.Enabled() || !ctx.ModuleHasProvider(m, TestMappingInfoProvider) {
+			return
+		}
+		info := ctx.ModuleProvider(m, TestMappingInfoProvider).(TestMappingInfo)
+		name := ctx.ModuleName(m)
+		tests := postsubmit
+		if info.Presubmit {
+			tests = presubmit
+		}
+		for target, dir := range info.Targets {
+			moduleDirs[target] = dir
+			if tests[target] == nil {
+				tests[target] = make(map[string]bool)
+			}
+			tests[target][name] = true
+		}
+	})
+
+	toTests := func(names map[string]bool) []testMappingTest {
+		var tests []testMappingTest
+		for _, name := range SortedStringKeys(names) {
+			tests = append(tests, testMappingTest{Name: name})
+		}
+		return tests
+	}
+
+	targets := append(SortedStringKeys(presubmit), SortedStringKeys(postsubmit)...)
+
+	mapping := make(map[string]testMappingEntry)
+	for _, target := range targets {
+		mapping[target] = testMappingEntry{
+			Path:       moduleDirs[target],
+			Presubmit:  toTests(presubmit[target]),
+			Postsubmit: toTests(postsubmit[target]),
+		}
+	}
+
+	// encoding/json sorts the keys of maps, so the output is stable.
+	jsonStr, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal test mapping: %s", err)
+		return
+	}
+
+	t.outputFile = PathForOutput(ctx, "test_mapping.json")
+	WriteFileRule(ctx, t.outputFile, string(jsonStr))
+	ctx.Phony("test_mapping", t.outputFile)
+}
+
+func (t *testMappingSingleton) MakeVars(ctx MakeVarsContext) {
+	if t.outputFile != nil {
+		ctx.DistForGoal("test_mapping", t.outputFile)
+	}
+}
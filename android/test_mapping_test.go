@@ -0,0 +1,129 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type testMappingTestModule struct {
+	depsModule
+	testProps struct {
+		Test_mapping TestMappingProperties
+	}
+}
+
+func (m *testMappingTestModule) TestMappingTargets() []string {
+	return m.testProps.Test_mapping.Test_for
+}
+
+func (m *testMappingTestModule) TestMappingPresubmit() bool {
+	return Bool(m.testProps.Test_mapping.Presubmit)
+}
+
+func testMappingTestModuleFactory() Module {
+	m := &testMappingTestModule{}
+	m.AddProperties(&m.props, &m.testProps)
+	InitAndroidArchModule(m, HostAndDeviceDefault, MultilibCommon)
+	return m
+}
+
+func TestTestMapping(t *testing.T) {
+	prepareForTestMappingTest := GroupFixturePreparers(
+		prepareForModuleTests,
+		FixtureRegisterWithContext(func(ctx RegistrationContext) {
+			ctx.RegisterModuleType("test_module", testMappingTestModuleFactory)
+			RegisterTestMappingBuildComponents(ctx)
+		}),
+		FixtureAddTextFile("lib/foo/Android.bp", `
+			deps {
+				name: "libfoo",
+			}
+		`),
+		FixtureAddTextFile("lib/bar/Android.bp", `
+			deps {
+				name: "libbar",
+			}
+		`),
+	)
+
+	t.Run("mapping", func(t *testing.T) {
+		result := GroupFixturePreparers(
+			prepareForTestMappingTest,
+			FixtureAddTextFile("tests/Android.bp", `
+				test_module {
+					name: "foo_test",
+					test_mapping: {
+						test_for: ["libfoo"],
+						presubmit: true,
+					},
+				}
+
+				test_module {
+					name: "foo_bar_test",
+					test_mapping: {
+						test_for: ["libfoo", "libbar"],
+					},
+				}
+
+				test_module {
+					name: "unrelated_test",
+				}
+			`),
+		).RunTest(t)
+
+		mapping := result.SingletonForTests("test_mapping").Output("test_mapping.json")
+		AssertStringEquals(t, "test mapping", `{
+  "libbar": {
+    "path": "lib/bar",
+    "postsubmit": [
+      {
+        "name": "foo_bar_test"
+      }
+    ]
+  },
+  "libfoo": {
+    "path": "lib/foo",
+    "presubmit": [
+      {
+        "name": "foo_test"
+      }
+    ],
+    "postsubmit": [
+      {
+        "name": "foo_bar_test"
+      }
+    ]
+  }
+}
+`, ContentFromFileRuleForTests(t, mapping))
+	})
+
+	t.Run("unknown module", func(t *testing.T) {
+		GroupFixturePreparers(
+			prepareForTestMappingTest,
+			FixtureAddTextFile("tests/Android.bp", `
+				test_module {
+					name: "foo_test",
+					test_mapping: {
+						test_for: ["libbaz"],
+					},
+				}
+			`),
+		).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`depends on undefined module "libbaz"`)).
+			RunTest(t)
+	})
+}
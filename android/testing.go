@@ -113,6 +113,130 @@ var PrepareForTestWithLicenseDefaultModules = GroupFixturePreparers(
 	FixtureAddFile("build/soong/licenses/LICENSE", nil),
 )
 
+// fixtureAppendToAndroidBp appends bp to the Android.bp file in dir, creating the file if it does
+// not exist, so that several preparers can add modules to the same directory.
+func fixtureAppendToAndroidBp(dir, bp string) FixturePreparer {
+	return FixtureModifyMockFS(func(fs MockFS) {
+		path := filepath.Join(dir, "Android.bp")
+		fs[path] = append(fs[path], []byte(bp)...)
+	})
+}
+
+// FixtureAddLicenseKind adds a license_kind module with the given conditions to the Android.bp
+// file in dir.
+func FixtureAddLicenseKind(dir, name string, conditions ...string) FixturePreparer {
+	return fixtureAppendToAndroidBp(dir, fmt.Sprintf(`
+		license_kind {
+			name: %q,
+			conditions: %s,
+		}
+	`, name, quoteStringList(conditions)))
+}
+
+// FixtureLicense describes a license module added by FixtureAddLicense.
+type FixtureLicense struct {
+	Name string
+
+	// The package_name of the license, if any.
+	PackageName string
+
+	// The license_kind modules of the license.
+	Kinds []string
+
+	// The license_text files of the license, relative to the directory of the license. They are
+	// added to the mock filesystem.
+	Text []string
+}
+
+// FixtureAddLicense adds a license module to the Android.bp file in dir.
+func FixtureAddLicense(dir string, license FixtureLicense) FixturePreparer {
+	var packageName string
+	if license.PackageName != "" {
+		packageName = fmt.Sprintf("package_name: %q,", license.PackageName)
+	}
+	preparers := []FixturePreparer{
+		fixtureAppendToAndroidBp(dir, fmt.Sprintf(`
+		license {
+			name: %q,
+			%s
+			license_kinds: %s,
+			license_text: %s,
+		}
+	`, license.Name, packageName, quoteStringList(license.Kinds), quoteStringList(license.Text))),
+	}
+	for _, text := range license.Text {
+		preparers = append(preparers, FixtureOverrideFile(filepath.Join(dir, text), nil))
+	}
+	return GroupFixturePreparers(preparers...)
+}
+
+// FixtureAddPackage adds a package module whose default_applicable_licenses are the given licenses
+// to the Android.bp file in dir, so that they apply to all the modules in dir and its
+// subdirectories that do not set licenses.
+func FixtureAddPackage(dir string, defaultLicenses ...string) FixturePreparer {
+	return fixtureAppendToAndroidBp(dir, fmt.Sprintf(`
+		package {
+			default_applicable_licenses: %s,
+		}
+	`, quoteStringList(defaultLicenses)))
+}
+
+func quoteStringList(list []string) string {
+	quoted := make([]string, 0, len(list))
+	for _, s := range list {
+		quoted = append(quoted, fmt.Sprintf("%q", s))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// EffectiveLicenseMetadata is the license metadata that was resolved for a module from its
+// licenses, the package default licenses and its defaults.
+type EffectiveLicenseMetadata struct {
+	Licenses    []string
+	PackageName string
+	Kinds       []string
+	Conditions  []string
+
+	// The license text files, each followed by the package name they apply to, e.g.
+	// "top/LICENSE:topDog".
+	Notices []string
+}
+
+// EffectiveLicenseMetadataForModule returns the license metadata resolved for the given variant of
+// a module.
+func EffectiveLicenseMetadataForModule(result *TestResult, name, variant string) EffectiveLicenseMetadata {
+	base := result.ModuleForTests(name, variant).Module().base()
+	return EffectiveLicenseMetadata{
+		Licenses:    base.commonProperties.Effective_licenses,
+		PackageName: String(base.commonProperties.Effective_package_name),
+		Kinds:       base.commonProperties.Effective_license_kinds,
+		Conditions:  base.commonProperties.Effective_license_conditions,
+		Notices:     base.commonProperties.Effective_license_text.Strings(),
+	}
+}
+
+// AssertEffectiveLicenseMetadata checks that the license metadata resolved for the given variant of
+// a module matches the expected metadata, ignoring the order of the lists. If it does not then it
+// reports an error including both.
+func AssertEffectiveLicenseMetadata(t *testing.T, result *TestResult, name, variant string, expected EffectiveLicenseMetadata) {
+	t.Helper()
+	actual := EffectiveLicenseMetadataForModule(result, name, variant)
+	sorted := func(list []string) []string {
+		if len(list) == 0 {
+			return nil
+		}
+		return SortedUniqueStrings(list)
+	}
+	normalize := func(m EffectiveLicenseMetadata) EffectiveLicenseMetadata {
+		m.Licenses = sorted(m.Licenses)
+		m.Kinds = sorted(m.Kinds)
+		m.Conditions = sorted(m.Conditions)
+		m.Notices = sorted(m.Notices)
+		return m
+	}
+	AssertDeepEquals(t, fmt.Sprintf("effective license metadata of %q", name), normalize(expected), normalize(actual))
+}
+
 var PrepareForTestWithNamespace = FixtureRegisterWithContext(func(ctx RegistrationContext) {
 	registerNamespaceBuildComponents(ctx)
 	ctx.PreArchMutators(RegisterNamespaceMutator)
@@ -994,6 +1118,82 @@ func (m TestingModule) OutputFiles(t *testing.T, tag string) Paths {
 	return paths.RelativeToTop()
 }
 
+// InstalledFilesInPartition returns the files that the module installs in a partition, e.g.
+// "system" or "vendor", with their paths relative to the partition. Symlinks are listed as
+// "<path> -> <target>". Files installed for the host are in the "host" partition, with paths that
+// start with the <os>-<arch> directory.
+func (m TestingModule) InstalledFilesInPartition(partition string) []string {
+	symlinkTargets := make(map[string]string)
+	for _, symlink := range m.module.base().katiSymlinks {
+		target, err := filepath.Rel(filepath.Dir(symlink.to.String()), symlink.from.String())
+		if err != nil {
+			panic(err)
+		}
+		symlinkTargets[symlink.to.String()] = target
+	}
+
+	var files []string
+	for _, installPath := range m.module.FilesToInstall() {
+		installPartition, relPath := installPathPartitionForTests(m.config, installPath)
+		if installPartition != partition {
+			continue
+		}
+		target, isSymlink := symlinkTargets[installPath.String()]
+		if params := m.MaybeOutput(installPath.String()); params.Rule == Symlink {
+			target, isSymlink = params.Args["fromPath"], true
+		}
+		if isSymlink {
+			relPath += " -> " + target
+		}
+		files = append(files, relPath)
+	}
+	return files
+}
+
+// installPathPartitionForTests returns the partition of an install path, and the path relative to
+// the partition.
+func installPathPartitionForTests(config Config, installPath InstallPath) (string, string) {
+	relPath := strings.TrimPrefix(installPath.path, filepath.Join("target", "product", config.DeviceName())+"/")
+	if i := strings.IndexRune(relPath, '/'); i >= 0 {
+		return relPath[:i], relPath[i+1:]
+	}
+	return "", relPath
+}
+
+// InstalledFilesInPartitionForTests returns the sorted files that all the modules install in a
+// partition, in the form returned by TestingModule.InstalledFilesInPartition.
+func InstalledFilesInPartitionForTests(result *TestResult, partition string) []string {
+	var files []string
+	result.VisitAllModules(func(m blueprint.Module) {
+		if module, ok := m.(Module); ok {
+			files = append(files, newTestingModule(result.Config, module).InstalledFilesInPartition(partition)...)
+		}
+	})
+	sort.Strings(files)
+	return files
+}
+
+// FixtureExpectInstalledFiles checks that the modules install all the expected paths in a
+// partition, so that tests can check the final install layout rather than intermediate outputs.
+// The paths are relative to the partition, e.g. "framework/foo.jar" for system/framework/foo.jar
+// in the "system" partition. Symlinks are expected as "<path> -> <target>". Files installed in the
+// partition that are not expected are ignored, as the test fixtures usually install files of their
+// own.
+func FixtureExpectInstalledFiles(t *testing.T, result *TestResult, partition string, expectedPaths []string) {
+	t.Helper()
+	installed := InstalledFilesInPartitionForTests(result, partition)
+	var missing []string
+	for _, expected := range expectedPaths {
+		if !InList(expected, installed) {
+			missing = append(missing, expected)
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("files not installed in partition %q:\n  %s\ninstalled files:\n  %s",
+			partition, strings.Join(missing, "\n  "), strings.Join(installed, "\n  "))
+	}
+}
+
 // TestingSingleton is wrapper around an android.Singleton that provides methods to find information about individual
 // ctx.Build parameters for verification in tests.
 type TestingSingleton struct {
@@ -0,0 +1,135 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// The tool_versions singleton writes the versions of the tools used by the rules of the build, e.g.
+// clang, rustc, javac, d8, r8, aapt2 and metalava, to ${OUT_DIR}/soong/tool_versions.json, for
+// release notes and for debugging toolchain related regressions. Every tool is listed with the
+// version that is known when the build is generated, e.g. the name of its prebuilt directory, and
+// with the first line that it prints when it is run with its version arguments, which is resolved
+// by the tool_versions script when the file is built. The file is built by the tool-versions goal
+// and is disted as tool_versions.json.
+//
+// The packages that define the tools register them with RegisterToolVersionsProvider.
+
+func init() {
+	RegisterToolVersionsBuildComponents(InitRegistrationContext)
+}
+
+func RegisterToolVersionsBuildComponents(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("tool_versions", toolVersionsSingletonFactory)
+}
+
+var PrepareForTestWithToolVersions = FixtureRegisterWithContext(RegisterToolVersionsBuildComponents)
+
+// ToolVersion is a tool used by the rules of the build.
+type ToolVersion struct {
+	// Name is the name of the tool, e.g. "clang".
+	Name string
+
+	// Version is the version of the tool that is known when the build is generated, e.g. the
+	// version of its prebuilt directory, or empty if it is only known by running the tool.
+	Version string
+
+	// Tool is the path to the tool, or nil if it is not run to print its version.
+	Tool Path
+
+	// VersionArgs are the arguments that make the tool print its version, e.g. "--version".
+	VersionArgs []string
+}
+
+// ToolVersionsProvider returns the tools of a package that are listed in tool_versions.json.
+type ToolVersionsProvider func(ctx PathContext) []ToolVersion
+
+var toolVersionsProviders []ToolVersionsProvider
+
+// RegisterToolVersionsProvider registers a function that returns tools to list in
+// tool_versions.json. It must be called from init().
+func RegisterToolVersionsProvider(provider ToolVersionsProvider) {
+	toolVersionsProviders = append(toolVersionsProviders, provider)
+}
+
+type toolVersionsEntry struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version,omitempty"`
+	Tool        string   `json:"tool,omitempty"`
+	VersionArgs []string `json:"version_args,omitempty"`
+}
+
+func toolVersionsSingletonFactory() Singleton {
+	return &toolVersionsSingleton{}
+}
+
+type toolVersionsSingleton struct {
+	toolVersions WritablePath
+}
+
+func (s *toolVersionsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var tools []ToolVersion
+	for _, provider := range toolVersionsProviders {
+		tools = append(tools, provider(ctx)...)
+	}
+	if len(tools) == 0 {
+		return
+	}
+	sort.SliceStable(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+
+	var entries []toolVersionsEntry
+	var toolPaths Paths
+	for i, tool := range tools {
+		if i > 0 && tools[i-1].Name == tool.Name {
+			ctx.Errorf("tool versions: %q is registered more than once", tool.Name)
+			continue
+		}
+		entry := toolVersionsEntry{Name: tool.Name, Version: tool.Version}
+		if tool.Tool != nil {
+			entry.Tool = tool.Tool.String()
+			entry.VersionArgs = tool.VersionArgs
+			toolPaths = append(toolPaths, tool.Tool)
+		}
+		entries = append(entries, entry)
+	}
+
+	entriesJson, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal the tool versions: %s", err)
+		return
+	}
+	entriesFile := PathForOutput(ctx, "tool_versions", "tools.json")
+	WriteFileRule(ctx, entriesFile, string(entriesJson))
+
+	s.toolVersions = PathForOutput(ctx, "tool_versions.json")
+	rule := NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("tool_versions").
+		Input(entriesFile).
+		Output(s.toolVersions).
+		Implicits(toolPaths)
+	rule.Build("tool_versions", "tool versions")
+
+	ctx.Phony("tool-versions", s.toolVersions)
+}
+
+func (s *toolVersionsSingleton) MakeVars(ctx MakeVarsContext) {
+	if s.toolVersions != nil {
+		ctx.DistForGoal("tool-versions", s.toolVersions)
+	}
+}
+
+var _ SingletonMakeVarsProvider = (*toolVersionsSingleton)(nil)
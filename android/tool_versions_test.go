@@ -0,0 +1,96 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+// withToolVersionsProviders replaces the registered tool versions providers for the duration of a
+// test.
+func withToolVersionsProviders(t *testing.T, providers ...ToolVersionsProvider) {
+	saved := toolVersionsProviders
+	toolVersionsProviders = providers
+	t.Cleanup(func() { toolVersionsProviders = saved })
+}
+
+func TestToolVersions(t *testing.T) {
+	withToolVersionsProviders(t,
+		func(ctx PathContext) []ToolVersion {
+			return []ToolVersion{{
+				Name:        "foo",
+				Version:     "foo-r1",
+				Tool:        PathForSource(ctx, "prebuilts/foo/bin/foo"),
+				VersionArgs: []string{"--version"},
+			}}
+		},
+		func(ctx PathContext) []ToolVersion {
+			return []ToolVersion{
+				{Name: "baz", Tool: ctx.Config().HostToolPath(ctx, "baz"), VersionArgs: []string{"version"}},
+				{Name: "bar", Version: "1.0"},
+			}
+		})
+
+	result := GroupFixturePreparers(
+		PrepareForTestWithToolVersions,
+	).RunTest(t)
+
+	singleton := result.SingletonForTests("tool_versions")
+	tools := ContentFromFileRuleForTests(t, singleton.Output("tool_versions/tools.json"))
+	AssertStringEquals(t, "tools.json", `[
+  {
+    "name": "bar",
+    "version": "1.0"
+  },
+  {
+    "name": "baz",
+    "tool": "out/soong/host/linux-x86/bin/baz",
+    "version_args": [
+      "version"
+    ]
+  },
+  {
+    "name": "foo",
+    "version": "foo-r1",
+    "tool": "prebuilts/foo/bin/foo",
+    "version_args": [
+      "--version"
+    ]
+  }
+]
+`, tools)
+
+	rule := singleton.Output("tool_versions.json")
+	for _, input := range []string{
+		"out/soong/tool_versions/tools.json",
+		"prebuilts/foo/bin/foo",
+		"out/soong/host/linux-x86/bin/baz",
+	} {
+		AssertStringListContains(t, "tool_versions inputs", rule.Implicits.Strings(), input)
+	}
+	AssertStringListContains(t, "tool_versions tools", rule.RuleParams.CommandDeps,
+		"out/soong/host/linux-x86/bin/tool_versions")
+}
+
+func TestToolVersionsDuplicate(t *testing.T) {
+	withToolVersionsProviders(t, func(ctx PathContext) []ToolVersion {
+		return []ToolVersion{{Name: "foo", Version: "1"}, {Name: "foo", Version: "2"}}
+	})
+
+	GroupFixturePreparers(
+		PrepareForTestWithToolVersions,
+	).ExtendWithErrorHandler(FixtureExpectsAtLeastOneErrorMatchingPattern(`"foo" is registered more than once`)).
+		RunTest(t)
+}
@@ -16,6 +16,7 @@ package android
 
 import (
 	"fmt"
+	"hash/fnv"
 	"path/filepath"
 	"reflect"
 	"regexp"
@@ -425,6 +426,20 @@ func ShardPaths(paths Paths, shardSize int) []Paths {
 	return ret
 }
 
+// ShardPathsByHash takes a Paths, and returns a slice of exactly shards Paths, assigning each path
+// to a shard by a hash of the path, so that adding or removing a path does not change the shards
+// of the other paths. The paths keep their order within each shard, and shards can be empty.
+func ShardPathsByHash(paths Paths, shards int) []Paths {
+	ret := make([]Paths, shards)
+	for _, path := range paths {
+		h := fnv.New32a()
+		h.Write([]byte(path.String()))
+		shard := h.Sum32() % uint32(shards)
+		ret[shard] = append(ret[shard], path)
+	}
+	return ret
+}
+
 // ShardString takes a string and returns a slice of strings where the length of each one is
 // at most shardSize.
 func ShardString(s string, shardSize int) []string {
@@ -589,6 +589,38 @@ func Test_Shard(t *testing.T) {
 	}
 }
 
+func TestShardPathsByHash(t *testing.T) {
+	paths := PathsForTesting("a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt", "g.txt", "h.txt")
+	shards := ShardPathsByHash(paths, 3)
+	AssertIntEquals(t, "number of shards", 3, len(shards))
+
+	shardOf := func(shards []Paths, path string) int {
+		for i, shard := range shards {
+			for _, p := range shard {
+				if p.String() == path {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	var sharded Paths
+	for i, shard := range shards {
+		for _, p := range shard {
+			AssertIntEquals(t, "shard of "+p.String(), i, shardOf(ShardPathsByHash(PathsForTesting(p.String()), 3), p.String()))
+		}
+		sharded = append(sharded, shard...)
+	}
+	AssertDeepEquals(t, "sharded paths", SortedUniqueStrings(paths.Strings()), SortedUniqueStrings(sharded.Strings()))
+
+	// Removing a path does not move the other paths to other shards.
+	for _, p := range paths[1:] {
+		AssertIntEquals(t, "shard of "+p.String(), shardOf(shards, p.String()),
+			shardOf(ShardPathsByHash(paths[1:], 3), p.String()))
+	}
+}
+
 func BenchmarkFirstUniqueStrings(b *testing.B) {
 	implementations := []struct {
 		name string
@@ -194,6 +194,7 @@ type productVariables struct {
 	Platform_sdk_extension_version            *int     `json:",omitempty"`
 	Platform_base_sdk_extension_version       *int     `json:",omitempty"`
 	Platform_version_active_codenames         []string `json:",omitempty"`
+	Ndk_draft_api_level                       *string  `json:",omitempty"`
 	Platform_vndk_version                     *string  `json:",omitempty"`
 	Platform_systemsdk_versions               []string `json:",omitempty"`
 	Platform_security_patch                   *string  `json:",omitempty"`
@@ -249,6 +250,8 @@ type productVariables struct {
 	AAPTPreferredConfig *string  `json:",omitempty"`
 	AAPTPrebuiltDPI     []string `json:",omitempty"`
 
+	ProductLocales []string `json:",omitempty"`
+
 	DefaultAppCertificate *string `json:",omitempty"`
 
 	AppsDefaultVersionName *string `json:",omitempty"`
@@ -354,6 +357,7 @@ type productVariables struct {
 	RecoverySnapshotDirsExcluded []string `json:",omitempty"`
 	RecoverySnapshotDirsIncluded []string `json:",omitempty"`
 	HostFakeSnapshotEnabled      bool     `json:",omitempty"`
+	ContentAddressedSnapshots    bool     `json:",omitempty"`
 
 	BoardVendorSepolicyDirs           []string `json:",omitempty"`
 	BoardOdmSepolicyDirs              []string `json:",omitempty"`
@@ -378,6 +382,10 @@ type productVariables struct {
 
 	VendorVars map[string]map[string]string `json:",omitempty"`
 
+	// BuildFlags maps the fully qualified names of the flags declared by java_build_flags
+	// modules to their values for this product.
+	BuildFlags map[string]string `json:",omitempty"`
+
 	Ndk_abis *bool `json:",omitempty"`
 
 	Flatten_apex                 *bool `json:",omitempty"`
@@ -433,6 +441,7 @@ type productVariables struct {
 	BuildBrokenTrebleSyspropNeverallow bool     `json:",omitempty"`
 	BuildBrokenVendorPropertyNamespace bool     `json:",omitempty"`
 	BuildBrokenInputDirModules         []string `json:",omitempty"`
+	BuildBrokenVendorApexEtcDirModules []string `json:",omitempty"`
 
 	BuildDebugfsRestrictionsEnabled bool `json:",omitempty"`
 
@@ -448,6 +457,18 @@ type productVariables struct {
 	GenerateAidlNdkPlatformBackend bool `json:",omitempty"`
 
 	ForceMultilibFirstOnDevice bool `json:",omitempty"`
+
+	NinjaPools []NinjaPool `json:",omitempty"`
+
+	DedupBootJars bool `json:",omitempty"`
+
+	SystemServerDirtyImageObjects *string `json:",omitempty"`
+
+	CheckDuplicateClasses bool `json:",omitempty"`
+
+	RemapDebugPaths bool `json:",omitempty"`
+
+	RustCrossLanguageLto bool `json:",omitempty"`
 }
 
 func boolPtr(v bool) *bool {
@@ -1014,6 +1035,8 @@ func VariableMutator(mctx BottomUpMutatorContext) {
 	// TODO: depend on config variable, create variants, propagate variants up tree
 	a := module.base()
 
+	applyEnabledIf(mctx, a)
+
 	if a.variableProperties == nil {
 		return
 	}
@@ -19,6 +19,7 @@ package apex
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
@@ -81,6 +82,20 @@ func RegisterPostDepsMutators(ctx android.RegisterMutatorsContext) {
 	ctx.TopDown("apex_strict_updatability_lint", apexStrictUpdatibilityLintMutator).Parallel()
 }
 
+type apexLinkerConfigProperties struct {
+	// Whether the linker namespace of this APEX is visible to other namespaces, so that they can
+	// link against its libraries with dlopen. Default is false.
+	Visible *bool
+
+	// File names of the native shared libraries in this APEX that are provided to other linker
+	// namespaces, e.g. libfoo.so. Each of them must be in the payload of the APEX.
+	Provide_libs []string
+
+	// File names of the native shared libraries that this APEX requires from other linker
+	// namespaces. None of them can be in the payload of the APEX.
+	Require_libs []string
+}
+
 type apexBundleProperties struct {
 	// Json manifest file describing meta info of this APEX bundle. Refer to
 	// system/apex/proto/apex_manifest.proto for the schema. Default: "apex_manifest.json"
@@ -94,11 +109,6 @@ type apexBundleProperties struct {
 	// device (/apex/<apex_name>). If unspecified, follows the name property.
 	Apex_name *string
 
-	// Determines the file contexts file for setting the security contexts to files in this APEX
-	// bundle. For platform APEXes, this should points to a file under /system/sepolicy Default:
-	// /system/sepolicy/apex/<module_name>_file_contexts.
-	File_contexts *string `android:"path"`
-
 	// Path to the canned fs config file for customizing file's uid/gid/mod/capabilities. The
 	// format is /<path_or_glob> <uid> <gid> <mode> [capabilities=0x<cap>], where path_or_glob is a
 	// path or glob pattern for a file or set of files, uid/gid are numerial values of user ID
@@ -120,6 +130,9 @@ type apexBundleProperties struct {
 	// List of filesystem images that are embedded inside this APEX bundle.
 	Filesystems []string
 
+	// Linker configuration of this APEX bundle, which is generated as etc/linker.config.pb.
+	Linker_config apexLinkerConfigProperties
+
 	// The minimum SDK version that this APEX must support at minimum. This is usually set to
 	// the SDK version that the APEX was first introduced.
 	Min_sdk_version *string
@@ -137,6 +150,16 @@ type apexBundleProperties struct {
 	// false.
 	Future_updatable *bool
 
+	// Whether the payload of this APEX must only contain files whose licenses are not restricted,
+	// e.g. because the APEX is distributed under notice terms. When true, the build fails if a file
+	// in the payload comes from a module with a restricted license condition. Default is false.
+	Notice_clean *bool
+
+	// How the native libraries and binaries in the payload of this APEX are stripped, regardless of
+	// the strip properties of their modules: "keep_mini_debug_info", "strip_all" or "unstripped".
+	// When unset, the files are packaged as built by their modules.
+	Payload_strip *string
+
 	// Whether this APEX can use platform APIs or not. Can be set to true only when `updatable:
 	// false`. Default is false.
 	Platform_apis *bool
@@ -159,6 +182,14 @@ type apexBundleProperties struct {
 	// or else conflicting build rules may be created.
 	Multi_install_skip_symbol_files *bool
 
+	// Contents of this APEX that are only included when a soong config variable or a build flag
+	// of the product has a given value. See ApexConditionalContents.
+	Conditional_contents []ApexConditionalContents
+
+	// If set, include the unstripped native binaries and libraries of this APEX in the symbols
+	// archive of the build, at their path under /apex/<apex_name>. Default is false.
+	Symbols_archive *bool
+
 	// The type of APEX to build. Controls what the APEX payload is. Either 'image', 'zip' or
 	// 'both'. When set to image, contents are stored in a filesystem image inside a zip
 	// container. When set to zip, contents are stored in a zip container directly. This type is
@@ -298,6 +329,12 @@ type overridableProperties struct {
 	// List of prebuilt files that are embedded inside this APEX bundle.
 	Prebuilts []string
 
+	// Directories inside this APEX of the prebuilt files listed in prebuilts, in the form
+	// "<module>:<dir>", e.g. "my_sepolicy:etc/selinux". The directory must be under etc/. A
+	// prebuilt that is not listed here is put in the directory chosen by the prebuilt module. Either
+	// way, etc/odm, etc/selinux and etc/vintf are only allowed in vendor APEXes.
+	Prebuilt_destinations []string
+
 	// List of runtime resource overlays (RROs) that are embedded inside this APEX.
 	Rros []string
 
@@ -329,6 +366,11 @@ type overridableProperties struct {
 	// A txt file containing list of files that are allowed to be included in this APEX.
 	Allowed_files *string `android:"path"`
 
+	// Determines the file contexts file for setting the security contexts to files in this APEX
+	// bundle. For platform APEXes, this should points to a file under /system/sepolicy Default:
+	// /system/sepolicy/apex/<module_name>_file_contexts.
+	File_contexts *string `android:"path"`
+
 	// Name of the apex_key module that provides the private key to sign this APEX bundle.
 	Key *string
 
@@ -353,6 +395,7 @@ type apexBundle struct {
 	android.OverridableModuleBase
 	android.SdkBase
 	android.BazelModuleBase
+	java.TransparencyLog
 
 	// Properties
 	properties            apexBundleProperties
@@ -446,6 +489,15 @@ type apexBundle struct {
 	// Optional list of lint report zip files for apexes that contain java or app modules
 	lintReports android.Paths
 
+	// Path to the report of the conditional contents of this APEX, nil if it has none.
+	conditionalContentsReport android.WritablePath
+
+	// Path to the manifest of the licenses of the files in the payload of this APEX.
+	licenseManifest android.WritablePath
+
+	// Path to the report of the sizes of the files stripped by payload_strip, nil if it is unset.
+	payloadStripReport android.WritablePath
+
 	prebuiltFileToDelete string
 
 	isCompressed bool
@@ -745,6 +797,15 @@ func (a *apexBundle) DepsMutator(ctx android.BottomUpMutatorContext) {
 			})
 		}
 
+		// Add native modules of the conditional contents that are enabled for this product. Their
+		// binaries target the first ABI like the binaries property.
+		for _, c := range a.enabledConditionalContents(ctx.Config()) {
+			depsList = append(depsList, ApexNativeDependencies{Native_shared_libs: c.Native_shared_libs})
+			if isPrimaryAbi {
+				depsList = append(depsList, ApexNativeDependencies{Binaries: c.Binaries})
+			}
+		}
+
 		// Add native modules targeting either 32-bit or 64-bit ABI
 		switch target.Arch.ArchType.Multilib {
 		case "lib32":
@@ -784,6 +845,9 @@ func (a *apexBundle) DepsMutator(ctx android.BottomUpMutatorContext) {
 	commonVariation := ctx.Config().AndroidCommonTarget.Variations()
 	ctx.AddFarVariationDependencies(commonVariation, fsTag, a.properties.Filesystems...)
 	ctx.AddFarVariationDependencies(commonVariation, compatConfigTag, a.properties.Compat_configs...)
+	for _, c := range a.enabledConditionalContents(ctx.Config()) {
+		ctx.AddFarVariationDependencies(commonVariation, androidAppTag, c.Apps...)
+	}
 }
 
 // DepsMutator for the overridden properties.
@@ -791,6 +855,9 @@ func (a *apexBundle) OverridablePropertiesDepsMutator(ctx android.BottomUpMutato
 	if a.overridableProperties.Allowed_files != nil {
 		android.ExtractSourceDeps(ctx, a.overridableProperties.Allowed_files)
 	}
+	if a.overridableProperties.File_contexts != nil {
+		android.ExtractSourceDeps(ctx, a.overridableProperties.File_contexts)
+	}
 
 	commonVariation := ctx.Config().AndroidCommonTarget.Variations()
 	ctx.AddFarVariationDependencies(commonVariation, androidAppTag, a.overridableProperties.Apps...)
@@ -840,6 +907,24 @@ type ApexBundleInfo struct {
 
 var ApexBundleInfoProvider = blueprint.NewMutatorProvider(ApexBundleInfo{}, "apex_info")
 
+// ApexLinkerConfigInfo contains the linker configuration generated for an APEX bundle from its
+// linker_config property.
+type ApexLinkerConfigInfo struct {
+	// Visible is true if the linker namespace of the APEX is visible to other namespaces.
+	Visible bool
+
+	// ProvideLibs is the sorted list of libraries in the APEX that are provided to other namespaces.
+	ProvideLibs []string
+
+	// RequireLibs is the sorted list of libraries that the APEX requires from other namespaces.
+	RequireLibs []string
+
+	// LinkerConfig is the path to the generated linker.config.pb.
+	LinkerConfig android.Path
+}
+
+var ApexLinkerConfigInfoProvider = blueprint.NewProvider(ApexLinkerConfigInfo{})
+
 var _ ApexInfoMutator = (*apexBundle)(nil)
 
 func (a *apexBundle) ApexVariationName() string {
@@ -928,8 +1013,11 @@ func (a *apexBundle) ApexInfoMutator(mctx android.TopDownMutatorContext) {
 		return true
 	})
 
+	apexVariationName := proptools.StringDefault(a.properties.Apex_name, mctx.ModuleName()) // could be com.android.foo
+	a.properties.ApexVariationName = apexVariationName
+
 	// The membership information is saved for later access
-	apexContents := android.NewApexContents(contents)
+	apexContents := android.NewApexContents(a.Name(), apexVariationName, contents)
 	mctx.SetProvider(ApexBundleInfoProvider, ApexBundleInfo{
 		Contents: apexContents,
 	})
@@ -943,8 +1031,6 @@ func (a *apexBundle) ApexInfoMutator(mctx android.TopDownMutatorContext) {
 	// This is the main part of this mutator. Mark the collected dependencies that they need to
 	// be built for this apexBundle.
 
-	apexVariationName := proptools.StringDefault(a.properties.Apex_name, mctx.ModuleName()) // could be com.android.foo
-	a.properties.ApexVariationName = apexVariationName
 	apexInfo := android.ApexInfo{
 		ApexVariationName: apexVariationName,
 		MinSdkVersion:     minSdkVersion,
@@ -1346,6 +1432,21 @@ func (a *apexBundle) OutputFiles(tag string) (android.Paths, error) {
 	case "", android.DefaultDistTag:
 		// This is the default dist path.
 		return android.Paths{a.outputFile}, nil
+	case ".conditional_contents":
+		if a.conditionalContentsReport != nil {
+			return android.Paths{a.conditionalContentsReport}, nil
+		}
+		return nil, nil
+	case ".license_manifest":
+		if a.licenseManifest != nil {
+			return android.Paths{a.licenseManifest}, nil
+		}
+		return nil, nil
+	case ".payload_strip_report":
+		if a.payloadStripReport != nil {
+			return android.Paths{a.payloadStripReport}, nil
+		}
+		return nil, nil
 	case imageApexSuffix:
 		// uncompressed one
 		if a.outputApexFile != nil {
@@ -1794,6 +1895,8 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	// all the files that will be included in this APEX
 	var filesInfo []apexFile
 
+	prebuiltDestinations := a.prebuiltDestinations(ctx)
+
 	// native lib dependencies
 	var provideNativeLibs []string
 	var requireNativeLibs []string
@@ -1948,7 +2051,12 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 				}
 			case prebuiltTag:
 				if prebuilt, ok := child.(prebuilt_etc.PrebuiltEtcModule); ok {
-					filesInfo = append(filesInfo, apexFileForPrebuiltEtc(ctx, prebuilt, depName))
+					af := apexFileForPrebuiltEtc(ctx, prebuilt, depName)
+					if dest, ok := prebuiltDestinations[depName]; ok {
+						af.installDir = dest
+					}
+					a.checkPrebuiltDestination(ctx, af)
+					filesInfo = append(filesInfo, af)
 				} else {
 					ctx.PropertyErrorf("prebuilts", "%q is not a prebuilt_etc module", depName)
 				}
@@ -2160,6 +2268,14 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	}
 	filesInfo = removeDup(filesInfo)
 
+	// Strip the native files of the payload according to the payload_strip property.
+	a.applyPayloadStrip(ctx, filesInfo)
+
+	// Generate etc/linker.config.pb from the linker_config property, now that the payload is known.
+	if linkerConfig := a.buildLinkerConfig(ctx, filesInfo); linkerConfig != nil {
+		filesInfo = append(filesInfo, *linkerConfig)
+	}
+
 	// Sort to have consistent build rules
 	sort.Slice(filesInfo, func(i, j int) bool {
 		// Sort by destination path so as to ensure consistent ordering even if the source of the files
@@ -2254,6 +2370,9 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	}
 	a.buildApexDependencyInfo(ctx)
 	a.buildLintReports(ctx)
+	a.buildSymbolsArchiveInfo(ctx)
+	a.buildConditionalContentsReport(ctx)
+	a.buildLicenseManifest(ctx)
 
 	// Append meta-files to the filesInfo list so that they are reflected in Android.mk as well.
 	if a.installable() {
@@ -2273,6 +2392,8 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		})
 		a.filesInfo = append(a.filesInfo, newApexFile(ctx, copiedPubkey, "apex_pubkey", ".", etc, nil))
 	}
+
+	a.provideApexPayloadInfo(ctx)
 }
 
 // apexBootclasspathFragmentFiles returns the list of apexFile structures defining the files that
@@ -2432,11 +2553,99 @@ func DefaultsFactory(props ...interface{}) android.Module {
 
 type OverrideApex struct {
 	android.ModuleBase
+	android.DefaultableModuleBase
 	android.OverrideModuleBase
 }
 
 func (o *OverrideApex) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	// All the overrides happen in the base module.
+	o.checkDefaults(ctx)
+}
+
+// checkDefaults reports an error when an apex_defaults used by this override_apex sets a property
+// that can't be overridden to a value other than the one in the base apex. Such a property would
+// otherwise be silently ignored, as only overridableProperties are carried over to the base apex.
+// Properties in overridableProperties are resolved as: the base apex, then the apex_defaults of
+// this override_apex, and finally the properties set directly in this override_apex.
+func (o *OverrideApex) checkDefaults(ctx android.ModuleContext) {
+	var base *apexBundle
+	ctx.VisitDirectDeps(func(dep android.Module) {
+		if a, ok := dep.(*apexBundle); ok && ctx.OtherModuleName(a) == o.GetOverriddenModuleName() {
+			base = a
+		}
+	})
+	if base == nil {
+		return
+	}
+
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		if ctx.OtherModuleDependencyTag(child) != android.DefaultsDepTag {
+			return false
+		}
+		defaults, ok := child.(*Defaults)
+		if !ok {
+			return false
+		}
+		for _, p := range defaults.GetProperties() {
+			var baseProps interface{}
+			switch p.(type) {
+			case *apexBundleProperties:
+				baseProps = &base.properties
+			case *apexTargetBundleProperties:
+				baseProps = &base.targetProperties
+			default:
+				continue
+			}
+			conflicts := conflictingProperties("", reflect.ValueOf(p).Elem(), reflect.ValueOf(baseProps).Elem())
+			if len(conflicts) > 0 {
+				ctx.PropertyErrorf("defaults", "%q sets %s differently from the base apex %q, "+
+					"which can't be overridden by override_apex",
+					ctx.OtherModuleName(defaults), strings.Join(conflicts, ", "), ctx.OtherModuleName(base))
+			}
+		}
+		return true
+	})
+}
+
+// conflictingProperties returns the names of the properties that are set in defaults to a value
+// that isn't in effect in base. List properties conflict only when some of their elements are
+// missing from base, since the lists in defaults are prepended to the ones in the module.
+func conflictingProperties(prefix string, defaults, base reflect.Value) []string {
+	var names []string
+	for i := 0; i < defaults.NumField(); i++ {
+		field := defaults.Type().Field(i)
+		if field.PkgPath != "" || proptools.HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+		d, b := defaults.Field(i), base.Field(i)
+		if d.IsZero() {
+			continue
+		}
+		name := prefix + proptools.PropertyNameForField(field.Name)
+		if field.Anonymous {
+			name = prefix
+		}
+		switch d.Kind() {
+		case reflect.Struct:
+			if !field.Anonymous {
+				name += "."
+			}
+			names = append(names, conflictingProperties(name, d, b)...)
+		case reflect.Slice:
+			if elems, ok := d.Interface().([]string); ok {
+				if len(android.RemoveListFromList(elems, b.Interface().([]string))) > 0 {
+					names = append(names, name)
+				}
+			} else if !reflect.DeepEqual(d.Interface(), b.Interface()) {
+				names = append(names, name)
+			}
+		default:
+			if !reflect.DeepEqual(d.Interface(), b.Interface()) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
 }
 
 // override_apex is used to create an apex module based on another apex module by overriding some of
@@ -2448,6 +2657,9 @@ func overrideApexFactory() android.Module {
 
 	android.InitAndroidMultiTargetsArchModule(m, android.DeviceSupported, android.MultilibCommon)
 	android.InitOverrideModule(m)
+	// Defaults are initialized after the override properties are recorded, so that the defaults
+	// property itself isn't applied to the base apex.
+	android.InitDefaultableModule(m)
 	return m
 }
 
@@ -2686,6 +2898,60 @@ func (a *apexBundle) checkStaticExecutables(ctx android.ModuleContext) {
 	})
 }
 
+// vendorApexEtcDirs are the directories inside an APEX that only vendor APEXes may put prebuilts
+// in, as the files in them are vendor or odm configuration, e.g. sepolicy and VINTF fragments.
+var vendorApexEtcDirs = []string{
+	"etc/odm",
+	"etc/selinux",
+	"etc/vintf",
+}
+
+// prebuiltDestinations returns the directories set by prebuilt_destinations, keyed by the names of
+// the prebuilt modules.
+func (a *apexBundle) prebuiltDestinations(ctx android.ModuleContext) map[string]string {
+	dests := make(map[string]string)
+	for _, entry := range a.overridableProperties.Prebuilt_destinations {
+		pair := strings.SplitN(entry, ":", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			ctx.PropertyErrorf("prebuilt_destinations", "%q is not in the form <module>:<dir>", entry)
+			continue
+		}
+		module, dir := pair[0], pair[1]
+		if !android.InList(module, a.overridableProperties.Prebuilts) {
+			ctx.PropertyErrorf("prebuilt_destinations", "%q is not listed in prebuilts", module)
+			continue
+		}
+		if _, exists := dests[module]; exists {
+			ctx.PropertyErrorf("prebuilt_destinations", "duplicate destination for %q", module)
+			continue
+		}
+		if filepath.IsAbs(dir) || filepath.Clean(dir) != dir || !strings.HasPrefix(dir, "etc/") {
+			ctx.PropertyErrorf("prebuilt_destinations",
+				"destination %q of %q must be a clean relative path under etc/", dir, module)
+			continue
+		}
+		dests[module] = dir
+	}
+	return dests
+}
+
+// checkPrebuiltDestination checks that a prebuilt is not put in a directory that is reserved for
+// vendor APEXes when this is not a vendor APEX, whether the directory was set by
+// prebuilt_destinations or by the prebuilt module itself, e.g. with sub_dir. The existing APEXes
+// that do so can be listed in BUILD_BROKEN_VENDOR_APEX_ETC_DIR_MODULES until they are fixed.
+func (a *apexBundle) checkPrebuiltDestination(ctx android.ModuleContext, af apexFile) {
+	if a.SocSpecific() || a.DeviceSpecific() || ctx.DeviceConfig().BuildBrokenVendorApexEtcDir(ctx.ModuleName()) {
+		return
+	}
+	for _, dir := range vendorApexEtcDirs {
+		if af.installDir == dir || strings.HasPrefix(af.installDir, dir+"/") {
+			ctx.PropertyErrorf("prebuilts", "%q is installed in %q, which is only allowed in vendor APEXes",
+				af.androidMkModuleName, af.installDir)
+			return
+		}
+	}
+}
+
 // A small list of exceptions where static executables are allowed in APEXes.
 func isStaticExecutableAllowed(apex string, exec string) bool {
 	m := map[string][]string{
@@ -3129,8 +3395,8 @@ func (a *apexBundle) ConvertWithBp2build(ctx android.TopDownMutatorContext) {
 	}
 
 	var fileContextsLabelAttribute bazel.LabelAttribute
-	if a.properties.File_contexts != nil {
-		fileContextsLabelAttribute.SetValue(android.BazelLabelForModuleDepSingle(ctx, *a.properties.File_contexts))
+	if a.overridableProperties.File_contexts != nil {
+		fileContextsLabelAttribute.SetValue(android.BazelLabelForModuleDepSingle(ctx, *a.overridableProperties.File_contexts))
 	}
 
 	// TODO(b/219503907) this would need to be set to a.MinSdkVersionValue(ctx) but
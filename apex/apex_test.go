@@ -786,6 +786,110 @@ func TestApexManifestMinSdkVersion(t *testing.T) {
 	}
 }
 
+func TestApexLinkerConfig(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib", "mylib2"],
+			linker_config: {
+				visible: true,
+				provide_libs: ["mylib.so"],
+				require_libs: ["libfoo.so"],
+			},
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+
+		cc_library {
+			name: "mylib2",
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+	`)
+
+	ensureExactContents(t, ctx, "myapex", "android_common_myapex_image", []string{
+		"etc/linker.config.pb",
+		"lib64/mylib.so",
+		"lib64/mylib2.so",
+	})
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	info := ctx.ModuleProvider(module.Module(), ApexLinkerConfigInfoProvider).(ApexLinkerConfigInfo)
+	android.AssertBoolEquals(t, "visible", true, info.Visible)
+	android.AssertDeepEquals(t, "provideLibs", []string{"mylib.so"}, info.ProvideLibs)
+	android.AssertDeepEquals(t, "requireLibs", []string{"libfoo.so"}, info.RequireLibs)
+	android.AssertPathRelativeToTopEquals(t, "linker config",
+		"out/soong/.intermediates/myapex/android_common_myapex_image/linker_config/linker.config.pb", info.LinkerConfig)
+
+	json := module.Output("linker_config/linker.config.json")
+	android.AssertStringEquals(t, "linker config json",
+		`{"visible":true,"provideLibs":["mylib.so"],"requireLibs":["libfoo.so"]}`,
+		android.ContentFromFileRuleForTests(t, json))
+
+	command := module.Rule("linker_config").RuleParams.Command
+	ensureContains(t, command, "conv_linker_config proto -s out/soong/.intermediates/myapex/android_common_myapex_image/linker_config/linker.config.json")
+}
+
+func TestApexLinkerConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		linkerConfig  string
+		expectedError string
+	}{
+		{
+			name:          "provided library not in the apex",
+			linkerConfig:  `provide_libs: ["libfoo.so"]`,
+			expectedError: `linker_config.provide_libs: "libfoo.so" is not a native shared library in the APEX`,
+		},
+		{
+			name:          "required library in the apex",
+			linkerConfig:  `require_libs: ["mylib.so"]`,
+			expectedError: `linker_config.require_libs: "mylib.so" is a native shared library in the APEX, it can't be required`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			testApexError(t, test.expectedError, `
+				apex {
+					name: "myapex",
+					key: "myapex.key",
+					native_shared_libs: ["mylib"],
+					linker_config: {`+test.linkerConfig+`},
+					updatable: false,
+				}
+
+				apex_key {
+					name: "myapex.key",
+					public_key: "testkey.avbpubkey",
+					private_key: "testkey.pem",
+				}
+
+				cc_library {
+					name: "mylib",
+					system_shared_libs: [],
+					stl: "none",
+					apex_available: ["myapex"],
+				}
+			`)
+		})
+	}
+}
+
 func TestBasicZipApex(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
@@ -837,6 +941,124 @@ func TestBasicZipApex(t *testing.T) {
 	ensureContains(t, copyCmds, "image.zipapex/lib64/mylib2.so")
 }
 
+func TestApexReproducibilityCheck(t *testing.T) {
+	bp := `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib", "mylib2"],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+
+		cc_library {
+			name: "mylib2",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+	`
+
+	ctx := testApex(t, bp)
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	if module.MaybeOutput("reproducibility/check.timestamp").Rule != nil {
+		t.Errorf("expected no reproducibility check by default")
+	}
+
+	ctx = testApex(t, bp, android.FixtureMergeEnv(map[string]string{
+		"CHECK_APEX_REPRODUCIBILITY": "true",
+	}))
+	module = ctx.ModuleForTests("myapex", "android_common_myapex_image")
+
+	copyCmds := module.Output("myapex.apex.unsigned").Args["copy_commands"]
+	rebuilt := module.Output("reproducibility/myapex.apex.unsigned")
+	rebuiltCopyCmds := rebuilt.Args["copy_commands"]
+	ensureContains(t, rebuilt.Args["image_dir"], "reproducibility/image.apex")
+	ensureNotContains(t, rebuiltCopyCmds, "android_common_myapex_image/image.apex")
+
+	// The files are copied in the reverse order.
+	if strings.Index(copyCmds, "lib64/mylib.so") > strings.Index(copyCmds, "lib64/mylib2.so") {
+		t.Errorf("expected mylib to be copied before mylib2, got %q", copyCmds)
+	}
+	if strings.Index(rebuiltCopyCmds, "lib64/mylib.so") < strings.Index(rebuiltCopyCmds, "lib64/mylib2.so") {
+		t.Errorf("expected mylib to be copied after mylib2 in the rebuild, got %q", rebuiltCopyCmds)
+	}
+
+	check := module.Output("reproducibility/check.timestamp")
+	android.AssertPathsRelativeToTopEquals(t, "check inputs",
+		[]string{
+			"out/soong/.intermediates/myapex/android_common_myapex_image/myapex.apex.unsigned",
+			"out/soong/.intermediates/myapex/android_common_myapex_image/reproducibility/myapex.apex.unsigned",
+		}, append(android.Paths{check.Input}, check.Implicits...))
+
+	signed := module.Output("myapex.apex")
+	android.AssertPathRelativeToTopEquals(t, "signapk validation",
+		"out/soong/.intermediates/myapex/android_common_myapex_image/reproducibility/check.timestamp",
+		signed.Validation)
+}
+
+func TestRebaseCopyCommand(t *testing.T) {
+	from := "out/myapex/image.apex"
+	to := "out/myapex/reproducibility/image.apex"
+	testCases := []struct {
+		command  string
+		expected string
+		err      string
+	}{
+		{
+			command:  "cp -f out/mylib/mylib.so out/myapex/image.apex/lib64/mylib.so",
+			expected: "cp -f out/mylib/mylib.so out/myapex/reproducibility/image.apex/lib64/mylib.so",
+		},
+		{
+			command:  "mkdir -p out/myapex/image.apex",
+			expected: "mkdir -p out/myapex/reproducibility/image.apex",
+		},
+		{
+			command:  "rm -rf out/myapex/image.apex/app/AppSet",
+			expected: "rm -rf out/myapex/reproducibility/image.apex/app/AppSet",
+		},
+		{
+			command: "rm -rf out/myapex/image.apex",
+			err:     `"rm -rf out/myapex/image.apex" removes files outside of the image directory`,
+		},
+		{
+			command: "rm -rf out/other",
+			err:     `"rm -rf out/other" removes files outside of the image directory`,
+		},
+		{
+			command: "unzip -qDD -d=out/myapex/image.apex/app out/app.zip",
+			err:     `"unzip -qDD -d=out/myapex/image.apex/app out/app.zip" refers to the image directory in an unexpected way`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			rebased, err := rebaseCopyCommand(tc.command, from, to)
+			if tc.err != "" {
+				android.AssertErrorMessageEquals(t, "error", tc.err, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			android.AssertStringEquals(t, "rebased command", tc.expected, rebased)
+		})
+	}
+}
+
 func TestApexWithStubs(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
@@ -2387,6 +2609,107 @@ func TestApexMinSdkVersion_ErrorIfDepIsNewer(t *testing.T) {
 	`)
 }
 
+func TestApexMinSdkVersion_DependencyTree(t *testing.T) {
+	bp := `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib", "mylib3"],
+			min_sdk_version: "29",
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["mylib2"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+			min_sdk_version: "29",
+		}
+
+		cc_library {
+			name: "mylib3",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["mylib2"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+			min_sdk_version: "29",
+		}
+
+		cc_library {
+			name: "mylib2",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+			min_sdk_version: "30",
+		}
+	`
+
+	// Both paths to mylib2 are reported in a single tree rooted at the apex, with the variations
+	// and the min_sdk_version of each module along the way.
+	testApexError(t, `module "mylib2".*: should support min_sdk_version\(29\) for "myapex".*\n\n`+
+		`Dependency path:\n`+
+		`myapex\{.*\} min_sdk_version: 29\n`+
+		`├── mylib\{os:android,.*\} min_sdk_version: 29\n`+
+		`│       via tag .*\n`+
+		`│   └── mylib2\{os:android,.*\} min_sdk_version: 30\n`+
+		`│           via tag .*\n`+
+		`└── mylib3\{os:android,.*\} min_sdk_version: 29\n`+
+		`        via tag .*\n`+
+		`    └── mylib2\{os:android,.*\} min_sdk_version: 30\n`, bp)
+}
+
+func TestApexMinSdkVersion_PayloadMinSdkVersions(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			min_sdk_version: "29",
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["mylib2"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+			min_sdk_version: "28",
+		}
+
+		cc_library {
+			name: "mylib2",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+			min_sdk_version: "apex_inherit",
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	info := ctx.ModuleProvider(module.Module(), android.MinSdkVersionPayloadInfoProvider).(android.MinSdkVersionPayloadInfo)
+	android.AssertStringEquals(t, "min_sdk_version", "29", info.MinSdkVersion.String())
+	android.AssertStringEquals(t, "mylib", "28", info.PayloadMinSdkVersions["mylib"].String())
+	android.AssertStringEquals(t, "mylib2", "29", info.PayloadMinSdkVersions["mylib2"].String())
+}
+
 func TestApexMinSdkVersion_ErrorIfDepIsNewer_Java(t *testing.T) {
 	testApexError(t, `module "bar".*: should support min_sdk_version\(29\) for "myapex"`, `
 		apex {
@@ -2607,19 +2930,17 @@ func TestFilesInSubDir(t *testing.T) {
 	ensureContains(t, cmd, "/bin/foo/bar ")
 }
 
-func TestFilesInSubDirWhenNativeBridgeEnabled(t *testing.T) {
+func TestPrebuiltDestinations(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
 			name: "myapex",
 			key: "myapex.key",
-			multilib: {
-				both: {
-					native_shared_libs: ["mylib"],
-					binaries: ["mybin"],
-				},
-			},
-			compile_multilib: "both",
-			native_bridge_supported: true,
+			prebuilts: ["mysepolicy", "myconfig", "myetc"],
+			prebuilt_destinations: [
+				"mysepolicy:etc/selinux",
+				"myconfig:etc/odm/foo",
+			],
+			vendor: true,
 			updatable: false,
 		}
 
@@ -2629,29 +2950,121 @@ func TestFilesInSubDirWhenNativeBridgeEnabled(t *testing.T) {
 			private_key: "testkey.pem",
 		}
 
-		cc_library {
-			name: "mylib",
-			relative_install_path: "foo/bar",
-			system_shared_libs: [],
-			stl: "none",
-			apex_available: [ "myapex" ],
-			native_bridge_supported: true,
+		prebuilt_etc {
+			name: "mysepolicy",
+			src: "sepolicy.cil",
+			vendor: true,
 		}
 
-		cc_binary {
-			name: "mybin",
-			relative_install_path: "foo/bar",
-			system_shared_libs: [],
-			stl: "none",
-			apex_available: [ "myapex" ],
-			native_bridge_supported: true,
-			compile_multilib: "both", // default is "first" for binary
-			multilib: {
-				lib64: {
-					suffix: "64",
-				},
-			},
-		}
+		prebuilt_etc {
+			name: "myconfig",
+			src: "config.xml",
+			vendor: true,
+		}
+
+		prebuilt_etc {
+			name: "myetc",
+			src: "myprebuilt",
+			sub_dir: "vintf",
+			vendor: true,
+		}
+	`)
+
+	ensureExactContents(t, ctx, "myapex", "android_common_myapex_image", []string{
+		"etc/selinux/sepolicy.cil",
+		"etc/odm/foo/config.xml",
+		"etc/vintf/myprebuilt",
+	})
+
+	systemApex := func(destinations string, subDir string) string {
+		return fmt.Sprintf(`
+			apex {
+				name: "myapex",
+				key: "myapex.key",
+				prebuilts: ["myetc"],
+				prebuilt_destinations: [%s],
+				updatable: false,
+			}
+
+			apex_key {
+				name: "myapex.key",
+				public_key: "testkey.avbpubkey",
+				private_key: "testkey.pem",
+			}
+
+			prebuilt_etc {
+				name: "myetc",
+				src: "myprebuilt",
+				sub_dir: "%s",
+			}
+		`, destinations, subDir)
+	}
+
+	testApexError(t, `"myetc" is installed in "etc/selinux", which is only allowed in vendor APEXes`,
+		systemApex(`"myetc:etc/selinux"`, "foo"))
+	// The directories chosen by the prebuilt modules themselves are restricted too.
+	testApexError(t, `"myetc" is installed in "etc/vintf", which is only allowed in vendor APEXes`,
+		systemApex("", "vintf"))
+	ctx = testApex(t, systemApex("", "vintf"),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.BuildBrokenVendorApexEtcDirModules = []string{"myapex"}
+		}))
+	ensureExactContents(t, ctx, "myapex", "android_common_myapex_image", []string{
+		"etc/vintf/myprebuilt",
+	})
+	testApexError(t, `destination "bin/foo" of "myetc" must be a clean relative path under etc/`,
+		systemApex(`"myetc:bin/foo"`, "foo"))
+	testApexError(t, `"other" is not listed in prebuilts`,
+		systemApex(`"other:etc/foo"`, "foo"))
+	testApexError(t, `"myetc" is not in the form <module>:<dir>`,
+		systemApex(`"myetc"`, "foo"))
+}
+
+func TestFilesInSubDirWhenNativeBridgeEnabled(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			multilib: {
+				both: {
+					native_shared_libs: ["mylib"],
+					binaries: ["mybin"],
+				},
+			},
+			compile_multilib: "both",
+			native_bridge_supported: true,
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			relative_install_path: "foo/bar",
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+			native_bridge_supported: true,
+		}
+
+		cc_binary {
+			name: "mybin",
+			relative_install_path: "foo/bar",
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+			native_bridge_supported: true,
+			compile_multilib: "both", // default is "first" for binary
+			multilib: {
+				lib64: {
+					suffix: "64",
+				},
+			},
+		}
 	`, withNativeBridgeEnabled)
 	ensureExactContents(t, ctx, "myapex", "android_common_myapex_image", []string{
 		"bin/foo/bar/mybin",
@@ -4300,10 +4713,337 @@ func TestApexWithArch(t *testing.T) {
 				arm64: {
 					native_shared_libs: ["mylib.arm64"],
 				},
-				x86_64: {
-					native_shared_libs: ["mylib.x64"],
+				x86_64: {
+					native_shared_libs: ["mylib.x64"],
+				},
+			}
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib.arm64",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			// TODO: remove //apex_available:platform
+			apex_available: [
+				"//apex_available:platform",
+				"myapex",
+			],
+		}
+
+		cc_library {
+			name: "mylib.x64",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			// TODO: remove //apex_available:platform
+			apex_available: [
+				"//apex_available:platform",
+				"myapex",
+			],
+		}
+	`)
+
+	apexRule := ctx.ModuleForTests("myapex", "android_common_myapex_image").Rule("apexRule")
+	copyCmds := apexRule.Args["copy_commands"]
+
+	// Ensure that apex variant is created for the direct dep
+	ensureListContains(t, ctx.ModuleVariantsForTests("mylib.arm64"), "android_arm64_armv8-a_shared_apex10000")
+	ensureListNotContains(t, ctx.ModuleVariantsForTests("mylib.x64"), "android_arm64_armv8-a_shared_apex10000")
+
+	// Ensure that both direct and indirect deps are copied into apex
+	ensureContains(t, copyCmds, "image.apex/lib64/mylib.arm64.so")
+	ensureNotContains(t, copyCmds, "image.apex/lib64/mylib.x64.so")
+}
+
+func TestApexBinaryInitRcTemplate(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			binaries: ["mybin"],
+			updatable: false,
+		}
+
+		apex {
+			name: "otherapex",
+			apex_name: "com.android.other",
+			key: "myapex.key",
+			binaries: ["mybin"],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_binary {
+			name: "mybin",
+			srcs: ["mylib.cpp"],
+			relative_install_path: "hw",
+			init_rc_template: ["mybin.rc.in"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [
+				"//apex_available:platform",
+				"myapex",
+				"otherapex",
+			],
+		}
+	`, android.FixtureMergeMockFs(android.MockFS{
+		"mybin.rc.in": nil,
+	}))
+
+	// The install path in the template is the path of the variant on the device.
+	platformRc := ctx.ModuleForTests("mybin", "android_arm64_armv8-a").Output("rc_template/mybin.rc")
+	ensureContains(t, platformRc.RuleParams.Command, "--var install_path=/system/bin/hw/mybin")
+
+	// The APEX variants are not merged, and the APEX is mounted at /apex/<apex_name>.
+	apexRc := ctx.ModuleForTests("mybin", "android_arm64_armv8-a_myapex").Output("rc_template/mybin.rc")
+	ensureContains(t, apexRc.RuleParams.Command, "--var install_path=/apex/myapex/bin/hw/mybin")
+
+	otherApexRc := ctx.ModuleForTests("mybin", "android_arm64_armv8-a_com.android.other").Output("rc_template/mybin.rc")
+	ensureContains(t, otherApexRc.RuleParams.Command, "--var install_path=/apex/com.android.other/bin/hw/mybin")
+}
+
+func TestApexWithShBinary(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			sh_binaries: ["myscript"],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		sh_binary {
+			name: "myscript",
+			src: "mylib.cpp",
+			filename: "myscript.sh",
+			sub_dir: "script",
+		}
+	`)
+
+	apexRule := ctx.ModuleForTests("myapex", "android_common_myapex_image").Rule("apexRule")
+	copyCmds := apexRule.Args["copy_commands"]
+
+	ensureContains(t, copyCmds, "image.apex/bin/script/myscript.sh")
+}
+
+func TestApexTransparencyLogEntry(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	signapk := module.Output("myapex.apex")
+	entry := module.Output("transparency_log/myapex.apex.json")
+	ensureEquals(t, entry.Input.String(), signapk.Output.String())
+	ensureEquals(t, entry.Args["artifact"], "myapex.apex")
+	ensureEquals(t, entry.Implicits[0].String(), signapk.Implicits[0].String())
+}
+
+func TestApexInVariousPartition(t *testing.T) {
+	testcases := []struct {
+		propName, parition, flattenedPartition string
+	}{
+		{"", "system", "system_ext"},
+		{"product_specific: true", "product", "product"},
+		{"soc_specific: true", "vendor", "vendor"},
+		{"proprietary: true", "vendor", "vendor"},
+		{"vendor: true", "vendor", "vendor"},
+		{"system_ext_specific: true", "system_ext", "system_ext"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.propName+":"+tc.parition, func(t *testing.T) {
+			ctx := testApex(t, `
+				apex {
+					name: "myapex",
+					key: "myapex.key",
+					updatable: false,
+					`+tc.propName+`
+				}
+
+				apex_key {
+					name: "myapex.key",
+					public_key: "testkey.avbpubkey",
+					private_key: "testkey.pem",
+				}
+			`)
+
+			apex := ctx.ModuleForTests("myapex", "android_common_myapex_image").Module().(*apexBundle)
+			expected := "out/soong/target/product/test_device/" + tc.parition + "/apex"
+			actual := apex.installDir.RelativeToTop().String()
+			if actual != expected {
+				t.Errorf("wrong install path. expected %q. actual %q", expected, actual)
+			}
+
+			flattened := ctx.ModuleForTests("myapex", "android_common_myapex_flattened").Module().(*apexBundle)
+			expected = "out/soong/target/product/test_device/" + tc.flattenedPartition + "/apex"
+			actual = flattened.installDir.RelativeToTop().String()
+			if actual != expected {
+				t.Errorf("wrong install path. expected %q. actual %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestApexSymbolsArchive(t *testing.T) {
+	bp := `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			updatable: false,
+			%s
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+	`
+
+	ctx := testApex(t, fmt.Sprintf(bp, "symbols_archive: true,"))
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	info := ctx.ModuleProvider(module.Module(), android.SymbolsArchiveInfoProvider).(android.SymbolsArchiveInfo)
+
+	var artifacts, symbols []string
+	for _, entry := range info.Entries {
+		artifacts = append(artifacts, entry.Artifact)
+		symbols = append(symbols, entry.Symbols.RelativeToTop().String())
+		ensureEquals(t, entry.Dest, entry.Artifact)
+	}
+	ensureListContains(t, artifacts, "apex/myapex/lib/mylib.so")
+	ensureListContains(t, artifacts, "apex/myapex/lib64/mylib.so")
+	ensureListContains(t, symbols, "out/soong/.intermediates/mylib/android_arm64_armv8-a_shared_apex10000/unstripped/mylib.so")
+
+	ctx = testApex(t, fmt.Sprintf(bp, ""))
+	module = ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	info = ctx.ModuleProvider(module.Module(), android.SymbolsArchiveInfoProvider).(android.SymbolsArchiveInfo)
+	if len(info.Entries) != 0 {
+		t.Errorf("expected no symbols archive entries without symbols_archive")
+	}
+}
+
+func TestApexPayloadInfo(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			updatable: false,
+			native_shared_libs: ["mylib"],
+			binaries: ["mybin"],
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["mylib2"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+
+		cc_library {
+			name: "mylib2",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["//apex_available:platform", "myapex"],
+		}
+
+		cc_binary {
+			name: "mybin",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	info := ctx.ModuleProvider(module.Module(), android.ApexPayloadInfoProvider).(android.ApexPayloadInfo)
+
+	var files []string
+	for _, f := range info.Files {
+		files = append(files, fmt.Sprintf("%s:%s:%t", f.PathInPayload, f.SourceModule, f.Installable))
+	}
+	android.AssertArrayString(t, "payload files", []string{
+		"apex_manifest.pb::true",
+		"apex_pubkey::true",
+		"bin/mybin:mybin:true",
+		"lib/mylib.so:mylib:true",
+		"lib/mylib2.so:mylib2:false",
+		"lib64/mylib.so:mylib:true",
+		"lib64/mylib2.so:mylib2:false",
+	}, files)
+}
+
+func TestApexConditionalContents(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			updatable: false,
+			conditional_contents: [
+				{
+					soong_config_variable: "myapex:camera",
+					native_shared_libs: ["libcamera"],
+				},
+				{
+					soong_config_variable: "myapex:audio",
+					native_shared_libs: ["libaudio"],
+				},
+				{
+					build_flag: "com.android.myapex.backend",
+					value: "vulkan",
+					binaries: ["vulkan_service"],
+				},
+				{
+					build_flag: "com.android.myapex.backend",
+					value: "gles",
+					binaries: ["gles_service"],
 				},
-			}
+			],
 		}
 
 		apex_key {
@@ -4313,49 +5053,183 @@ func TestApexWithArch(t *testing.T) {
 		}
 
 		cc_library {
-			name: "mylib.arm64",
+			name: "libcamera",
 			srcs: ["mylib.cpp"],
 			system_shared_libs: [],
 			stl: "none",
-			// TODO: remove //apex_available:platform
-			apex_available: [
-				"//apex_available:platform",
-				"myapex",
-			],
+			apex_available: ["myapex"],
 		}
 
 		cc_library {
-			name: "mylib.x64",
+			name: "libaudio",
 			srcs: ["mylib.cpp"],
 			system_shared_libs: [],
 			stl: "none",
-			// TODO: remove //apex_available:platform
-			apex_available: [
-				"//apex_available:platform",
-				"myapex",
+			apex_available: ["myapex"],
+		}
+
+		cc_binary {
+			name: "vulkan_service",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+
+		cc_binary {
+			name: "gles_service",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+	`, android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+		variables.VendorVars = map[string]map[string]string{
+			"myapex": {"camera": "yes"},
+		}
+		variables.BuildFlags = map[string]string{
+			"com.android.myapex.backend": "vulkan",
+		}
+	}))
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	copyCmds := module.Rule("apexRule").Args["copy_commands"]
+	ensureContains(t, copyCmds, "image.apex/lib64/libcamera.so")
+	ensureNotContains(t, copyCmds, "image.apex/lib64/libaudio.so")
+	ensureContains(t, copyCmds, "image.apex/bin/vulkan_service")
+	ensureNotContains(t, copyCmds, "image.apex/bin/gles_service")
+
+	report := android.ContentFromFileRuleForTests(t, module.Output("conditional_contents.json"))
+	ensureContains(t, report, `"condition": "soong_config_variable:myapex:camera",
+    "expected": "true",
+    "actual": "true",
+    "included": true,
+    "native_shared_libs": [
+      "libcamera"
+    ]`)
+	ensureContains(t, report, `"condition": "build_flag:com.android.myapex.backend",
+    "expected": "gles",
+    "actual": "vulkan",
+    "included": false,
+    "binaries": [
+      "gles_service"
+    ]`)
+}
+
+func TestApexConditionalContentsInvalid(t *testing.T) {
+	testApexError(t, `conditional_contents\[0\]: exactly one of soong_config_variable and build_flag must be set`, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			updatable: false,
+			conditional_contents: [
+				{
+					native_shared_libs: ["libcamera"],
+				},
 			],
 		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
 	`)
+}
 
-	apexRule := ctx.ModuleForTests("myapex", "android_common_myapex_image").Rule("apexRule")
-	copyCmds := apexRule.Args["copy_commands"]
+const licenseManifestTestBp = `
+	apex {
+		name: "myapex",
+		key: "myapex.key",
+		updatable: false,
+		native_shared_libs: ["libnotice", "librestricted"],
+		%s
+	}
 
-	// Ensure that apex variant is created for the direct dep
-	ensureListContains(t, ctx.ModuleVariantsForTests("mylib.arm64"), "android_arm64_armv8-a_shared_apex10000")
-	ensureListNotContains(t, ctx.ModuleVariantsForTests("mylib.x64"), "android_arm64_armv8-a_shared_apex10000")
+	apex_key {
+		name: "myapex.key",
+		public_key: "testkey.avbpubkey",
+		private_key: "testkey.pem",
+	}
 
-	// Ensure that both direct and indirect deps are copied into apex
-	ensureContains(t, copyCmds, "image.apex/lib64/mylib.arm64.so")
-	ensureNotContains(t, copyCmds, "image.apex/lib64/mylib.x64.so")
-}
+	license_kind {
+		name: "notice_kind",
+		conditions: ["notice"],
+	}
 
-func TestApexWithShBinary(t *testing.T) {
-	ctx := testApex(t, `
+	license_kind {
+		name: "restricted_kind",
+		conditions: ["restricted"],
+	}
+
+	license {
+		name: "notice_license",
+		license_kinds: ["notice_kind"],
+	}
+
+	license {
+		name: "restricted_license",
+		license_kinds: ["restricted_kind"],
+	}
+
+	cc_library {
+		name: "libnotice",
+		srcs: ["mylib.cpp"],
+		system_shared_libs: [],
+		stl: "none",
+		licenses: ["notice_license"],
+		apex_available: ["myapex"],
+	}
+
+	cc_library {
+		name: "librestricted",
+		srcs: ["mylib.cpp"],
+		system_shared_libs: [],
+		stl: "none",
+		licenses: ["restricted_license"],
+		apex_available: ["myapex"],
+	}
+`
+
+func TestApexLicenseManifest(t *testing.T) {
+	ctx := testApex(t, fmt.Sprintf(licenseManifestTestBp, ""), android.PrepareForTestWithLicenses)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+	manifest := android.ContentFromFileRuleForTests(t, module.Output("license_manifest.json"))
+	ensureContains(t, manifest, `"path": "lib64/libnotice.so",
+    "module": "libnotice",
+    "license_kinds": [
+      "notice_kind"
+    ],
+    "license_conditions": [
+      "notice"
+    ]`)
+	ensureContains(t, manifest, `"path": "lib64/librestricted.so",
+    "module": "librestricted",
+    "license_kinds": [
+      "restricted_kind"
+    ],
+    "license_conditions": [
+      "restricted"
+    ]`)
+	// The files added by apexer are in the payload too.
+	ensureContains(t, manifest, `"path": "apex_manifest.pb"`)
+	ensureContains(t, manifest, `"path": "apex_pubkey"`)
+}
+
+func TestApexNoticeClean(t *testing.T) {
+	testApexError(t, `notice_clean: "lib64/librestricted.so" in the payload comes from "librestricted", which has the restricted license conditions \["restricted"\]`,
+		fmt.Sprintf(licenseManifestTestBp, "notice_clean: true,"), android.PrepareForTestWithLicenses)
+}
+
+func TestApexNoticeCleanLinking(t *testing.T) {
+	bp := `
 		apex {
 			name: "myapex",
 			key: "myapex.key",
-			sh_binaries: ["myscript"],
 			updatable: false,
+			%s
+			notice_clean: true,
 		}
 
 		apex_key {
@@ -4364,65 +5238,131 @@ func TestApexWithShBinary(t *testing.T) {
 			private_key: "testkey.pem",
 		}
 
-		sh_binary {
-			name: "myscript",
-			src: "mylib.cpp",
-			filename: "myscript.sh",
-			sub_dir: "script",
+		license_kind {
+			name: "dynamic_kind",
+			conditions: ["restricted_allows_dynamic_linking"],
 		}
-	`)
 
-	apexRule := ctx.ModuleForTests("myapex", "android_common_myapex_image").Rule("apexRule")
-	copyCmds := apexRule.Args["copy_commands"]
+		license {
+			name: "dynamic_license",
+			license_kinds: ["dynamic_kind"],
+		}
 
-	ensureContains(t, copyCmds, "image.apex/bin/script/myscript.sh")
+		cc_library {
+			name: "libdynamic",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			licenses: ["dynamic_license"],
+			apex_available: ["myapex"],
+		}
+
+		cc_binary {
+			name: "mybin",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			%s
+			apex_available: ["myapex"],
+		}
+	`
+
+	// A binary that doesn't link the restricted library is allowed.
+	testApex(t, fmt.Sprintf(bp, `binaries: ["mybin"],`, ""), android.PrepareForTestWithLicenses)
+
+	// The exception for dynamic linking covers the code that links against the library, not the
+	// library itself.
+	testApexError(t, `notice_clean: "lib64/libdynamic.so" in the payload comes from "libdynamic", which has the restricted license conditions \["restricted_allows_dynamic_linking"\]`,
+		fmt.Sprintf(bp, `native_shared_libs: ["libdynamic"],`, ""), android.PrepareForTestWithLicenses)
+
+	testApexError(t, `notice_clean: "bin/mybin" in the payload statically links "libdynamic", which has the restricted license conditions \["restricted_allows_dynamic_linking"\]`,
+		fmt.Sprintf(bp, `binaries: ["mybin"],`, `static_libs: ["libdynamic"],`), android.PrepareForTestWithLicenses)
 }
 
-func TestApexInVariousPartition(t *testing.T) {
-	testcases := []struct {
-		propName, parition, flattenedPartition string
+const payloadStripTestBp = `
+	apex {
+		name: "myapex",
+		key: "myapex.key",
+		updatable: false,
+		native_shared_libs: ["mylib"],
+		%s
+	}
+
+	apex_key {
+		name: "myapex.key",
+		public_key: "testkey.avbpubkey",
+		private_key: "testkey.pem",
+	}
+
+	cc_library {
+		name: "mylib",
+		srcs: ["mylib.cpp"],
+		system_shared_libs: [],
+		stl: "none",
+		apex_available: ["myapex"],
+	}
+`
+
+func TestApexPayloadStrip(t *testing.T) {
+	testCases := []struct {
+		name          string
+		payloadStrip  string
+		stripArgs     string
+		notStripArgs  string
+		expectedInput string
 	}{
-		{"", "system", "system_ext"},
-		{"product_specific: true", "product", "product"},
-		{"soc_specific: true", "vendor", "vendor"},
-		{"proprietary: true", "vendor", "vendor"},
-		{"vendor: true", "vendor", "vendor"},
-		{"system_ext_specific: true", "system_ext", "system_ext"},
+		{
+			name:          "keep_mini_debug_info",
+			payloadStrip:  `payload_strip: "keep_mini_debug_info",`,
+			stripArgs:     "--keep-mini-debug-info",
+			expectedInput: "payload_strip/lib64/mylib.so",
+		},
+		{
+			name:          "strip_all",
+			payloadStrip:  `payload_strip: "strip_all",`,
+			notStripArgs:  "--keep-mini-debug-info",
+			expectedInput: "payload_strip/lib64/mylib.so",
+		},
+		{
+			name:          "unstripped",
+			payloadStrip:  `payload_strip: "unstripped",`,
+			expectedInput: "mylib/android_arm64_armv8-a_shared_apex10000/unstripped/mylib.so",
+		},
 	}
-	for _, tc := range testcases {
-		t.Run(tc.propName+":"+tc.parition, func(t *testing.T) {
-			ctx := testApex(t, `
-				apex {
-					name: "myapex",
-					key: "myapex.key",
-					updatable: false,
-					`+tc.propName+`
-				}
 
-				apex_key {
-					name: "myapex.key",
-					public_key: "testkey.avbpubkey",
-					private_key: "testkey.pem",
-				}
-			`)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testApex(t, fmt.Sprintf(payloadStripTestBp, tc.payloadStrip))
+			module := ctx.ModuleForTests("myapex", "android_common_myapex_image")
 
-			apex := ctx.ModuleForTests("myapex", "android_common_myapex_image").Module().(*apexBundle)
-			expected := "out/soong/target/product/test_device/" + tc.parition + "/apex"
-			actual := apex.installDir.RelativeToTop().String()
-			if actual != expected {
-				t.Errorf("wrong install path. expected %q. actual %q", expected, actual)
-			}
+			copyCmds := module.Rule("apexRule").Args["copy_commands"]
+			ensureContains(t, copyCmds, tc.expectedInput)
 
-			flattened := ctx.ModuleForTests("myapex", "android_common_myapex_flattened").Module().(*apexBundle)
-			expected = "out/soong/target/product/test_device/" + tc.flattenedPartition + "/apex"
-			actual = flattened.installDir.RelativeToTop().String()
-			if actual != expected {
-				t.Errorf("wrong install path. expected %q. actual %q", expected, actual)
+			strip := module.MaybeOutput("payload_strip/lib64/mylib.so")
+			if tc.stripArgs != "" || tc.notStripArgs != "" {
+				if strip.Rule == nil {
+					t.Fatalf("mylib.so is not stripped for the payload")
+				}
+				ensureContains(t, strip.Args["args"], tc.stripArgs)
+				if tc.notStripArgs != "" {
+					ensureNotContains(t, strip.Args["args"], tc.notStripArgs)
+				}
+			} else if strip.Rule != nil {
+				t.Errorf("mylib.so is unexpectedly stripped for the payload")
 			}
+
+			entries := android.ContentFromFileRuleForTests(t, module.Output("payload_strip/entries.tsv"))
+			ensureContains(t, entries, "lib64/mylib.so\t")
+			module.Output("payload_strip_report.tsv")
 		})
 	}
 }
 
+func TestApexPayloadStripInvalid(t *testing.T) {
+	testApexError(t, `payload_strip: must be one of "keep_mini_debug_info", "strip_all" or "unstripped", got "some"`,
+		fmt.Sprintf(payloadStripTestBp, `payload_strip: "some",`))
+}
+
 func TestFileContexts_FindInDefaultLocationIfNotSet(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
@@ -6350,6 +7290,109 @@ func TestOverrideApex(t *testing.T) {
 	ensureNotContains(t, androidMk, "LOCAL_MODULE_STEM := myapex.apex")
 }
 
+func TestOverrideApexWithDefaults(t *testing.T) {
+	bp := `
+		apex_defaults {
+			name: "myapex-defaults",
+			key: "myapex.key",
+			updatable: false,
+		}
+
+		apex {
+			name: "myapex",
+			defaults: ["myapex-defaults"],
+		}
+
+		apex_defaults {
+			name: "override_myapex-defaults",
+			key: "mynewapex.key",
+			certificate: ":myapex.certificate",
+			file_contexts: "system/sepolicy/apex/myapex2-file_contexts",
+		}
+
+		override_apex {
+			name: "override_myapex",
+			base: "myapex",
+			defaults: ["override_myapex-defaults"],
+			key: "myotherapex.key",
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		apex_key {
+			name: "mynewapex.key",
+			public_key: "testkey2.avbpubkey",
+			private_key: "testkey2.pem",
+		}
+
+		apex_key {
+			name: "myotherapex.key",
+			public_key: "testkey3.avbpubkey",
+			private_key: "testkey3.pem",
+		}
+
+		android_app_certificate {
+			name: "myapex.certificate",
+			certificate: "testkey",
+		}
+	`
+
+	t.Run("precedence", func(t *testing.T) {
+		ctx := testApex(t, bp, withFiles(android.MockFS{
+			"testkey3.avbpubkey": nil,
+			"testkey3.pem":       nil,
+		}))
+
+		original := ctx.ModuleForTests("myapex", "android_common_myapex_image")
+		ensureContains(t, original.Rule("apexRule").Args["opt_flags"], "--pubkey testkey.avbpubkey")
+		ensureContains(t, original.Output("file_contexts").RuleParams.Command, "cat system/sepolicy/apex/myapex-file_contexts")
+
+		// The key set in override_apex wins over the one from its defaults, while the certificate
+		// and file_contexts come from the defaults.
+		overridden := ctx.ModuleForTests("myapex", "android_common_override_myapex_myapex_image")
+		ensureContains(t, overridden.Rule("apexRule").Args["opt_flags"], "--pubkey testkey3.avbpubkey")
+		ensureEquals(t, overridden.Rule("signapk").Args["certificates"], "testkey.x509.pem testkey.pk8")
+		ensureContains(t, overridden.Output("file_contexts").RuleParams.Command, "cat system/sepolicy/apex/myapex2-file_contexts")
+	})
+
+	t.Run("shared defaults", func(t *testing.T) {
+		// Non-overridable properties in defaults are fine as long as they match the base apex.
+		testApex(t, bp+`
+			override_apex {
+				name: "override_myapex2",
+				base: "myapex",
+				defaults: ["myapex-defaults"],
+			}
+		`, withFiles(android.MockFS{
+			"testkey3.avbpubkey": nil,
+			"testkey3.pem":       nil,
+		}))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		testApexError(t, `"override_myapex2-defaults" sets min_sdk_version, updatable differently from the base apex "myapex"`, bp+`
+			apex_defaults {
+				name: "override_myapex2-defaults",
+				min_sdk_version: "29",
+				updatable: true,
+			}
+
+			override_apex {
+				name: "override_myapex2",
+				base: "myapex",
+				defaults: ["override_myapex2-defaults"],
+			}
+		`, withFiles(android.MockFS{
+			"testkey3.avbpubkey": nil,
+			"testkey3.pem":       nil,
+		}))
+	})
+}
+
 func TestMinSdkVersionOverride(t *testing.T) {
 	// Override from 29 to 31
 	minSdkOverride31 := "31"
@@ -410,9 +410,11 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 			// bootclasspath_fragment's contents property.
 			java.FixtureConfigureBootJars("com.android.art:foo", "com.android.art:bar"),
 			addSource("foo", "bar"),
-			java.FixtureSetBootImageInstallDirOnDevice("art", "apex/com.android.art/javalib"),
+			java.FixtureSetBootImageInstallInApex("art", "com.android.art"),
 		).RunTest(t)
 
+		java.CheckBootImageInstallLocation(t, result, "art", "apex/com.android.art/javalib")
+
 		ensureExactContents(t, result.TestContext, "com.android.art", "android_common_com.android.art_image", []string{
 			"etc/boot-image.prof",
 			"etc/classpaths/bootclasspath.pb",
@@ -458,6 +460,12 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 		// locations for the art image.
 		module := result.ModuleForTests("mybootclasspathfragment", "android_common_apex10000")
 		checkCopiesToPredefinedLocationForArt(t, result.Config, module, "bar", "foo")
+
+		// The APEX of the boot image is resolved against the APEXes of the merged variant of the
+		// bootclasspath_fragment.
+		info := result.ModuleProvider(module.Module(), java.BootclasspathFragmentApexContentInfoProvider).(java.BootclasspathFragmentApexContentInfo)
+		android.AssertStringEquals(t, "boot image install apex module", "com.android.art", info.BootImageInstallApex().ApexModuleName())
+		android.AssertStringEquals(t, "boot image install apex name", "com.android.art", info.BootImageInstallApex().ApexName())
 	})
 
 	t.Run("boot image files from source no boot image in apex", func(t *testing.T) {
@@ -468,9 +476,11 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 			// bootclasspath_fragment's contents property.
 			java.FixtureConfigureBootJars("com.android.art:foo", "com.android.art:bar"),
 			addSource("foo", "bar"),
-			java.FixtureSetBootImageInstallDirOnDevice("art", "system/framework"),
+			java.FixtureSetBootImageInstallOnSystem("art"),
 		).RunTest(t)
 
+		java.CheckBootImageInstallLocation(t, result, "art", "system/framework")
+
 		ensureExactContents(t, result.TestContext, "com.android.art", "android_common_com.android.art_image", []string{
 			"etc/boot-image.prof",
 			"etc/classpaths/bootclasspath.pb",
@@ -494,6 +504,19 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 		})
 	})
 
+	t.Run("boot image installed in a different apex", func(t *testing.T) {
+		android.GroupFixturePreparers(
+			commonPreparer,
+
+			// Install the boot image in an APEX that does not contain the bootclasspath_fragment.
+			java.FixtureConfigureBootJars("com.android.art:foo", "com.android.art:bar"),
+			addSource("foo", "bar"),
+			java.FixtureSetBootImageInstallInApex("art", "com.android.other"),
+		).
+			ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(`\Qcannot provide the "art" boot image as it is installed in the APEX with apex_name "com.android.other" which does not contain this module\E`)).
+			RunTest(t)
+	})
+
 	t.Run("boot image disable generate profile", func(t *testing.T) {
 		result := android.GroupFixturePreparers(
 			commonPreparer,
@@ -524,7 +547,7 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 			// Make sure that a preferred prebuilt with consistent contents doesn't affect the apex.
 			addPrebuilt(true, "foo", "bar"),
 
-			java.FixtureSetBootImageInstallDirOnDevice("art", "apex/com.android.art/javalib"),
+			java.FixtureSetBootImageInstallInApex("art", "com.android.art"),
 		).RunTest(t)
 
 		ensureExactContents(t, result.TestContext, "com.android.art", "android_common_com.android.art_image", []string{
@@ -587,7 +610,7 @@ func TestBootclasspathFragmentInArtApex(t *testing.T) {
 			// Make sure that a preferred prebuilt with consistent contents doesn't affect the apex.
 			addPrebuilt(true, "foo", "bar"),
 
-			java.FixtureSetBootImageInstallDirOnDevice("art", "system/framework"),
+			java.FixtureSetBootImageInstallOnSystem("art"),
 		).RunTest(t)
 
 		ensureExactContents(t, result.TestContext, "com.android.art", "android_common_com.android.art_image", []string{
@@ -685,7 +708,7 @@ func TestBootclasspathFragmentInPrebuiltArtApex(t *testing.T) {
 
 		// Configure some libraries in the art bootclasspath_fragment.
 		java.FixtureConfigureBootJars("com.android.art:foo", "com.android.art:bar"),
-		java.FixtureSetBootImageInstallDirOnDevice("art", "apex/com.android.art/javalib"),
+		java.FixtureSetBootImageInstallInApex("art", "com.android.art"),
 	)
 
 	bp := `
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"android/soong/android"
+	"android/soong/cc"
 	"android/soong/java"
 
 	"github.com/google/blueprint"
@@ -167,6 +168,14 @@ var (
 		Description: "Diff ${image_content_file} and ${allowed_files_file}",
 	}, "image_content_file", "allowed_files_file", "apex_module_name")
 
+	checkApexReproducibilityRule = pctx.StaticRule("checkApexReproducibilityRule", blueprint.RuleParams{
+		Command: `cmp -s ${in} ${rebuilt} || (` +
+			`echo "${apex_module_name} is not reproducible: ${in} and ${rebuilt} differ after building ` +
+			`the payload again with the files copied in a different order." && ` +
+			`exit 1) && touch ${out}`,
+		Description: "Check reproducibility of ${apex_module_name}",
+	}, "rebuilt", "apex_module_name")
+
 	generateAPIsUsedbyApexRule = pctx.StaticRule("generateAPIsUsedbyApexRule", blueprint.RuleParams{
 		Command:     "$genNdkUsedbyApexPath ${image_dir} ${readelf} ${out}",
 		CommandDeps: []string{"${genNdkUsedbyApexPath}"},
@@ -238,6 +247,83 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 	})
 }
 
+// apexLinkerConfig is the JSON form of the linker configuration of an APEX, which is converted to
+// etc/linker.config.pb by conv_linker_config.
+type apexLinkerConfig struct {
+	Visible     bool     `json:"visible,omitempty"`
+	ProvideLibs []string `json:"provideLibs,omitempty"`
+	RequireLibs []string `json:"requireLibs,omitempty"`
+}
+
+// buildLinkerConfig creates build rules to generate etc/linker.config.pb from the linker_config
+// property. The libraries in provide_libs are checked against the native shared libraries in the
+// payload given by filesInfo, and the ones in require_libs must not be in the payload. Returns the
+// apexFile for the generated file, or nil when the linker_config property is not set.
+func (a *apexBundle) buildLinkerConfig(ctx android.ModuleContext, filesInfo []apexFile) *apexFile {
+	props := a.properties.Linker_config
+	if props.Visible == nil && len(props.Provide_libs) == 0 && len(props.Require_libs) == 0 {
+		return nil
+	}
+
+	nativeLibs := make(map[string]bool)
+	for _, fi := range filesInfo {
+		if fi.path() == "etc/linker.config.pb" {
+			ctx.PropertyErrorf("linker_config", "can't be set when %s is already in the APEX from %q",
+				fi.path(), fi.androidMkModuleName)
+			return nil
+		}
+		if fi.class == nativeSharedLib {
+			nativeLibs[fi.stem()] = true
+		}
+	}
+
+	config := apexLinkerConfig{
+		Visible:     proptools.Bool(props.Visible),
+		ProvideLibs: android.SortedUniqueStrings(props.Provide_libs),
+		RequireLibs: android.SortedUniqueStrings(props.Require_libs),
+	}
+	for _, lib := range config.ProvideLibs {
+		if !nativeLibs[lib] {
+			ctx.PropertyErrorf("linker_config.provide_libs", "%q is not a native shared library in the APEX", lib)
+		}
+	}
+	for _, lib := range config.RequireLibs {
+		if nativeLibs[lib] {
+			ctx.PropertyErrorf("linker_config.require_libs", "%q is a native shared library in the APEX, it can't be required", lib)
+		}
+	}
+	if ctx.Failed() {
+		return nil
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal the linker configuration: %s", err)
+		return nil
+	}
+	linkerConfigJson := android.PathForModuleOut(ctx, "linker_config", "linker.config.json")
+	android.WriteFileRule(ctx, linkerConfigJson, string(content))
+
+	linkerConfigPb := android.PathForModuleOut(ctx, "linker_config", "linker.config.pb")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("conv_linker_config").
+		Flag("proto").
+		FlagWithInput("-s ", linkerConfigJson).
+		FlagWithOutput("-o ", linkerConfigPb)
+	rule.Build("linker_config", "Generate linker config protobuf for "+a.Name())
+
+	ctx.SetProvider(ApexLinkerConfigInfoProvider, ApexLinkerConfigInfo{
+		Visible:      config.Visible,
+		ProvideLibs:  config.ProvideLibs,
+		RequireLibs:  config.RequireLibs,
+		LinkerConfig: linkerConfigPb,
+	})
+
+	linkerConfig := newApexFile(ctx, linkerConfigPb, "linker.config.pb", "etc", etc, nil)
+	return &linkerConfig
+}
+
 // buildFileContexts create build rules to append an entry for apex_manifest.pb to the file_contexts
 // file for this APEX which is either from /systme/sepolicy/apex/<apexname>-file_contexts or from
 // the file_contexts property of this APEX. This is to make sure that the manifest file is correctly
@@ -245,14 +331,14 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 func (a *apexBundle) buildFileContexts(ctx android.ModuleContext) android.OutputPath {
 	var fileContexts android.Path
 	var fileContextsDir string
-	if a.properties.File_contexts == nil {
+	if a.overridableProperties.File_contexts == nil {
 		fileContexts = android.PathForSource(ctx, "system/sepolicy/apex", ctx.ModuleName()+"-file_contexts")
 	} else {
-		if m, t := android.SrcIsModuleWithTag(*a.properties.File_contexts); m != "" {
+		if m, t := android.SrcIsModuleWithTag(*a.overridableProperties.File_contexts); m != "" {
 			otherModule := android.GetModuleFromPathDep(ctx, m, t)
 			fileContextsDir = ctx.OtherModuleDir(otherModule)
 		}
-		fileContexts = android.PathForModuleSrc(ctx, *a.properties.File_contexts)
+		fileContexts = android.PathForModuleSrc(ctx, *a.overridableProperties.File_contexts)
 	}
 	if fileContextsDir == "" {
 		fileContextsDir = filepath.Dir(fileContexts.String())
@@ -408,9 +494,13 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 
 	// TODO(jiyong): use the RuleBuilder
 	var copyCommands []string
+	// copy commands of each file, used to rebuild the APEX with the files copied in a different
+	// order when checking its reproducibility
+	var copyCommandsPerFile [][]string
 	var implicitInputs []android.Path
 	pathWhenActivated := android.PathForModuleInPartitionInstall(ctx, "apex", apexName)
 	for _, fi := range a.filesInfo {
+		firstCopyCommand := len(copyCommands)
 		destPath := imageDir.Join(ctx, fi.path()).String()
 		// Prepare the destination path
 		destPathDir := filepath.Dir(destPath)
@@ -478,6 +568,7 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 		}
 
 		installMapSet[installMapPath.String()+":"+fi.installDir+"/"+fi.builtFile.Base()] = true
+		copyCommandsPerFile = append(copyCommandsPerFile, android.CopyOf(copyCommands[firstCopyCommand:]))
 	}
 	implicitInputs = append(implicitInputs, a.manifestPbOut)
 	if installSymbolFiles {
@@ -547,6 +638,9 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 	outHostBinDir := ctx.Config().HostToolPath(ctx, "").String()
 	prebuiltSdkToolsBinDir := filepath.Join("prebuilts", "sdk", "tools", runtime.GOOS, "bin")
 
+	// Timestamp of the reproducibility check of the unsigned APEX, if enabled.
+	var reproducibilityCheck android.Path
+
 	// Figure out if we need to compress the apex.
 	compressionEnabled := ctx.Config().CompressedApex() && proptools.BoolDefault(a.overridableProperties.Compressible, false) && !a.testApex && !ctx.Config().UnbundledBuildApps()
 	if apexType == imageApex {
@@ -657,23 +751,32 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 
 		optFlags = append(optFlags, "--payload_fs_type "+a.payloadFsType.string())
 
+		apexRuleArgs := map[string]string{
+			"tool_path":        outHostBinDir + ":" + prebuiltSdkToolsBinDir,
+			"image_dir":        imageDir.String(),
+			"copy_commands":    strings.Join(copyCommands, " && "),
+			"manifest":         a.manifestPbOut.String(),
+			"file_contexts":    fileContexts.String(),
+			"canned_fs_config": cannedFsConfig.String(),
+			"key":              a.privateKeyFile.String(),
+			"opt_flags":        strings.Join(optFlags, " "),
+		}
 		ctx.Build(pctx, android.BuildParams{
 			Rule:        apexRule,
 			Implicits:   implicitInputs,
 			Output:      unsignedOutputFile,
 			Description: "apex (" + apexType.name() + ")",
-			Args: map[string]string{
-				"tool_path":        outHostBinDir + ":" + prebuiltSdkToolsBinDir,
-				"image_dir":        imageDir.String(),
-				"copy_commands":    strings.Join(copyCommands, " && "),
-				"manifest":         a.manifestPbOut.String(),
-				"file_contexts":    fileContexts.String(),
-				"canned_fs_config": cannedFsConfig.String(),
-				"key":              a.privateKeyFile.String(),
-				"opt_flags":        strings.Join(optFlags, " "),
-			},
+			Args:        apexRuleArgs,
 		})
 
+		////////////////////////////////////////////////////////////////////////////////////
+		// Step 3.a: When requested, build the APEX a second time with the files copied into
+		// the image directory in the reverse order, and fail the build if the two differ.
+		if ctx.Config().IsEnvTrue("CHECK_APEX_REPRODUCIBILITY") {
+			reproducibilityCheck = a.buildReproducibilityCheck(ctx, unsignedOutputFile, imageDir,
+				copyCommandsPerFile, implicitInputs, apexRuleArgs)
+		}
+
 		// TODO(jiyong): make the two rules below as separate functions
 		apexProtoFile := android.PathForModuleOut(ctx, a.Name()+".pb"+suffix)
 		bundleModuleFile := android.PathForModuleOut(ctx, a.Name()+suffix+"-base.zip")
@@ -792,8 +895,12 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 		Output:      signedOutputFile,
 		Input:       unsignedOutputFile,
 		Implicits:   implicits,
+		Validation:  reproducibilityCheck,
 		Args:        args,
 	})
+	if _, err := java.BuildTransparencyLogEntry(ctx, signedOutputFile, android.Paths{pem}); err != nil {
+		ctx.ModuleErrorf("%s", err)
+	}
 	if suffix == imageApexSuffix {
 		a.outputApexFile = signedOutputFile
 	}
@@ -832,6 +939,9 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 			Implicits:   implicits,
 			Args:        args,
 		})
+		if _, err := java.BuildTransparencyLogEntry(ctx, signedCompressedOutputFile, android.Paths{pem}); err != nil {
+			ctx.ModuleErrorf("%s", err)
+		}
 		a.outputFile = signedCompressedOutputFile
 	}
 
@@ -1020,6 +1130,146 @@ func (a *apexBundle) buildLintReports(ctx android.ModuleContext) {
 	a.lintReports = java.BuildModuleLintReportZips(ctx, depSetsBuilder.Build())
 }
 
+// buildSymbolsArchiveInfo lists the unstripped native files of the APEX payload for the symbols
+// archive when the APEX opts in with the symbols_archive property.
+func (a *apexBundle) buildSymbolsArchiveInfo(ctx android.ModuleContext) {
+	if !proptools.Bool(a.properties.Symbols_archive) || !a.installable() {
+		return
+	}
+	// Multi-installed APEXes and overriding VNDK APEXes share the symbol paths of another APEX.
+	if proptools.Bool(a.properties.Multi_install_skip_symbol_files) ||
+		(a.vndkApex && len(a.overridableProperties.Overrides) > 0) {
+		return
+	}
+
+	apexName := proptools.StringDefault(a.properties.Apex_name, a.BaseModuleName())
+	var entries []android.SymbolsArchiveEntry
+	for _, fi := range a.filesInfo {
+		switch fi.class {
+		case nativeSharedLib, nativeExecutable, nativeTest:
+		default:
+			continue
+		}
+		// Files linked to the system partition use the symbols of the platform variant.
+		if a.linkToSystemLib && fi.transitiveDep && fi.availableToPlatform() {
+			continue
+		}
+		linkable, ok := fi.module.(cc.LinkableInterface)
+		if !ok || linkable.UnstrippedOutputFile() == nil {
+			continue
+		}
+		artifact := filepath.Join("apex", apexName, fi.path())
+		entries = append(entries, android.SymbolsArchiveEntry{
+			Artifact: artifact,
+			Symbols:  linkable.UnstrippedOutputFile(),
+			Dest:     artifact,
+		})
+	}
+
+	if len(entries) > 0 {
+		ctx.SetProvider(android.SymbolsArchiveInfoProvider, android.SymbolsArchiveInfo{Entries: entries})
+	}
+}
+
+// provideApexPayloadInfo provides the list of files in the payload of the APEX in
+// android.ApexPayloadInfo.
+func (a *apexBundle) provideApexPayloadInfo(ctx android.ModuleContext) {
+	files := make([]android.ApexPayloadFile, 0, len(a.filesInfo))
+	for _, fi := range a.filesInfo {
+		file := android.ApexPayloadFile{
+			PathInPayload: fi.path(),
+			BuiltFile:     fi.builtFile,
+			Installable:   !(a.linkToSystemLib && fi.transitiveDep && fi.availableToPlatform()),
+		}
+		if fi.module != nil {
+			file.SourceModule = ctx.OtherModuleName(fi.module)
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].PathInPayload < files[j].PathInPayload
+	})
+	ctx.SetProvider(android.ApexPayloadInfoProvider, android.ApexPayloadInfo{Files: files})
+}
+
+// buildReproducibilityCheck builds the unsigned APEX again in a separate image directory with the
+// files copied in the reverse order and returns a timestamp file whose rule fails when the rebuilt
+// APEX is not identical to unsignedOutputFile. Nondeterminism in the tools creating the payload,
+// e.g. dependencies on the directory order, would otherwise end up in mainline release artifacts.
+func (a *apexBundle) buildReproducibilityCheck(ctx android.ModuleContext, unsignedOutputFile android.WritablePath,
+	imageDir android.ModuleOutPath, copyCommandsPerFile [][]string, implicitInputs android.Paths,
+	apexRuleArgs map[string]string) android.Path {
+
+	rebuiltImageDir := android.PathForModuleOut(ctx, "reproducibility", imageDir.Base())
+	rebuiltOutputFile := android.PathForModuleOut(ctx, "reproducibility", unsignedOutputFile.Base())
+
+	var copyCommands []string
+	for i := len(copyCommandsPerFile) - 1; i >= 0; i-- {
+		for _, command := range copyCommandsPerFile[i] {
+			rebased, err := rebaseCopyCommand(command, imageDir.String(), rebuiltImageDir.String())
+			if err != nil {
+				ctx.ModuleErrorf("cannot check the reproducibility of the APEX: %s", err)
+				return nil
+			}
+			copyCommands = append(copyCommands, rebased)
+		}
+	}
+
+	args := make(map[string]string, len(apexRuleArgs))
+	for k, v := range apexRuleArgs {
+		args[k] = v
+	}
+	args["image_dir"] = rebuiltImageDir.String()
+	args["copy_commands"] = strings.Join(copyCommands, " && ")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        apexRule,
+		Implicits:   implicitInputs,
+		Output:      rebuiltOutputFile,
+		Description: "apex reproducibility rebuild",
+		Args:        args,
+	})
+
+	timestamp := android.PathForModuleOut(ctx, "reproducibility", "check.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        checkApexReproducibilityRule,
+		Input:       unsignedOutputFile,
+		Implicit:    rebuiltOutputFile,
+		Output:      timestamp,
+		Description: "check apex reproducibility",
+		Args: map[string]string{
+			"rebuilt":          rebuiltOutputFile.String(),
+			"apex_module_name": a.Name(),
+		},
+	})
+	return timestamp
+}
+
+// rebaseCopyCommand rewrites a command that copies a file into the image directory from so that it
+// copies the file into the image directory to instead. It returns an error if the command still
+// refers to from after rewriting it, or if it removes files outside of to, so that the rebuild can
+// never modify or remove the files of the original image directory.
+func rebaseCopyCommand(command, from, to string) (string, error) {
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		if field == from || strings.HasPrefix(field, from+"/") {
+			fields[i] = to + strings.TrimPrefix(field, from)
+		}
+	}
+	rebased := strings.Join(fields, " ")
+	if strings.Contains(rebased, from) {
+		return "", fmt.Errorf("%q refers to the image directory in an unexpected way", command)
+	}
+	if len(fields) > 0 && fields[0] == "rm" {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.HasPrefix(field, to+"/") {
+				return "", fmt.Errorf("%q removes files outside of the image directory", command)
+			}
+		}
+	}
+	return rebased, nil
+}
+
 func (a *apexBundle) buildCannedFsConfig(ctx android.ModuleContext) android.OutputPath {
 	var readOnlyPaths = []string{"apex_manifest.json", "apex_manifest.pb"}
 	var executablePaths []string // this also includes dirs
@@ -0,0 +1,160 @@
+// Copyright (C) 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"android/soong/android"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// ApexConditionalContents are contents of an APEX that are only included when a soong config
+// variable or a build flag of the product has a given value. This allows a single APEX definition
+// to serve devices with different feature sets, e.g.
+//
+//	apex {
+//	    name: "com.android.foo",
+//	    conditional_contents: [
+//	        {
+//	            soong_config_variable: "foo:camera",
+//	            native_shared_libs: ["libfoo_camera"],
+//	        },
+//	        {
+//	            build_flag: "com.android.foo.backend",
+//	            value: "vulkan",
+//	            binaries: ["foo_vulkan_service"],
+//	        },
+//	    ],
+//	}
+//
+// The conditions are evaluated at analysis time, and the list of conditions, their values and the
+// contents they select is written to conditional_contents.json in the intermediates directory of
+// the APEX.
+type ApexConditionalContents struct {
+	// The soong config variable that selects the contents, in the form <namespace>:<variable>.
+	Soong_config_variable *string
+
+	// The fully qualified name of the build flag that selects the contents, see java_build_flags.
+	// Exactly one of soong_config_variable and build_flag must be set.
+	Build_flag *string
+
+	// The value the variable or flag must have for the contents to be included. If unset, the
+	// contents are included when the variable or flag is true.
+	Value *string
+
+	// List of native libraries that are embedded inside this APEX when the condition is met.
+	Native_shared_libs []string
+
+	// List of native executables that are embedded inside this APEX when the condition is met.
+	Binaries []string
+
+	// List of APKs that are embedded inside this APEX when the condition is met.
+	Apps []string
+}
+
+// condition returns a description of the condition of the contents, and the value it has for the
+// product being built.
+func (c *ApexConditionalContents) condition(config android.Config) (string, string, error) {
+	if (c.Soong_config_variable == nil) == (c.Build_flag == nil) {
+		return "", "", fmt.Errorf("exactly one of soong_config_variable and build_flag must be set")
+	}
+
+	if c.Build_flag != nil {
+		value, _ := config.BuildFlag(*c.Build_flag)
+		return "build_flag:" + *c.Build_flag, value, nil
+	}
+
+	parts := strings.SplitN(*c.Soong_config_variable, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("soong_config_variable %q must be in the form <namespace>:<variable>",
+			*c.Soong_config_variable)
+	}
+	namespace, variable := parts[0], parts[1]
+	vendorConfig := config.VendorConfig(namespace)
+	if c.Value == nil && vendorConfig.Bool(variable) {
+		// Normalize the boolean values accepted by soong config variables.
+		return "soong_config_variable:" + *c.Soong_config_variable, "true", nil
+	}
+	return "soong_config_variable:" + *c.Soong_config_variable, vendorConfig.String(variable), nil
+}
+
+// enabled returns true if the contents should be included in the APEX for the product being built.
+func (c *ApexConditionalContents) enabled(config android.Config) bool {
+	_, value, err := c.condition(config)
+	if err != nil {
+		return false
+	}
+	return value == proptools.StringDefault(c.Value, "true")
+}
+
+// enabledConditionalContents returns the conditional contents of the APEX that are included for
+// the product being built. Invalid conditions are reported by buildConditionalContentsReport.
+func (a *apexBundle) enabledConditionalContents(config android.Config) []ApexConditionalContents {
+	var enabled []ApexConditionalContents
+	for _, c := range a.properties.Conditional_contents {
+		if c.enabled(config) {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled
+}
+
+type conditionalContentsReportEntry struct {
+	Condition        string   `json:"condition"`
+	Expected         string   `json:"expected"`
+	Actual           string   `json:"actual"`
+	Included         bool     `json:"included"`
+	NativeSharedLibs []string `json:"native_shared_libs,omitempty"`
+	Binaries         []string `json:"binaries,omitempty"`
+	Apps             []string `json:"apps,omitempty"`
+}
+
+// buildConditionalContentsReport checks the conditional_contents property and writes a report
+// mapping each condition to its value and the contents it selects.
+func (a *apexBundle) buildConditionalContentsReport(ctx android.ModuleContext) {
+	if len(a.properties.Conditional_contents) == 0 {
+		return
+	}
+
+	var entries []conditionalContentsReportEntry
+	for i, c := range a.properties.Conditional_contents {
+		condition, value, err := c.condition(ctx.Config())
+		if err != nil {
+			ctx.PropertyErrorf(fmt.Sprintf("conditional_contents[%d]", i), "%s", err)
+			continue
+		}
+		entries = append(entries, conditionalContentsReportEntry{
+			Condition:        condition,
+			Expected:         proptools.StringDefault(c.Value, "true"),
+			Actual:           value,
+			Included:         c.enabled(ctx.Config()),
+			NativeSharedLibs: c.Native_shared_libs,
+			Binaries:         c.Binaries,
+			Apps:             c.Apps,
+		})
+	}
+
+	report, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal the conditional contents report: %s", err)
+		return
+	}
+	a.conditionalContentsReport = android.PathForModuleOut(ctx, "conditional_contents.json")
+	android.WriteFileRule(ctx, a.conditionalContentsReport, string(report))
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apex
+
+import (
+	"encoding/json"
+
+	"android/soong/android"
+	"android/soong/cc"
+	"android/soong/java"
+	"android/soong/rust"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// This file contains the license manifest of an APEX, which maps every file in the payload of the
+// APEX to the module it comes from and the license kinds and conditions of that module. It is
+// written to license_manifest.json in the intermediates directory of the APEX, and can be
+// referenced with the ".license_manifest" tag, e.g. to dist it.
+//
+// An APEX that sets notice_clean, e.g.
+//
+//	apex {
+//	    name: "com.android.foo",
+//	    notice_clean: true,
+//	}
+//
+// fails to build when a file in its payload comes from a module with a restricted license
+// condition, or statically links one.
+
+type licenseManifestEntry struct {
+	Path       string   `json:"path"`
+	Module     string   `json:"module,omitempty"`
+	Kinds      []string `json:"license_kinds,omitempty"`
+	Conditions []string `json:"license_conditions,omitempty"`
+}
+
+// isRestrictedLicenseCondition returns true if a license condition restricts the code it applies
+// to. The exceptions of conditions like "restricted_allows_dynamic_linking" cover the code that
+// links against the restricted code, not the restricted code itself, so they restrict a file in
+// the payload that comes from a module with the condition as much as "restricted" does.
+func isRestrictedLicenseCondition(condition string) bool {
+	switch condition {
+	case "restricted",
+		"restricted_allows_dynamic_linking",
+		"restricted_if_statically_linked",
+		"restricted_with_classpath_exception":
+		return true
+	default:
+		return false
+	}
+}
+
+// isStaticLinkDepTag returns true if the code of a dependency with the tag is linked into the
+// module that depends on it, e.g. the static_libs of cc and java modules or the rlibs of rust
+// modules.
+func isStaticLinkDepTag(tag blueprint.DependencyTag) bool {
+	return cc.IsStaticDepTag(tag) || java.IsStaticLibDepTag(tag) || rust.IsRlibDepTag(tag)
+}
+
+// restrictedLicenseConditions returns the restricted license conditions of the module.
+func restrictedLicenseConditions(module android.Module) []string {
+	var restricted []string
+	for _, condition := range module.EffectiveLicenseConditions() {
+		if isRestrictedLicenseCondition(condition) {
+			restricted = append(restricted, condition)
+		}
+	}
+	return restricted
+}
+
+// apexerPayloadFiles are the files that apexer adds to the payload of every APEX. They are only
+// added to filesInfo of installable APEXes, after the license manifest is built.
+var apexerPayloadFiles = []string{"apex_manifest.pb", "apex_pubkey"}
+
+// buildLicenseManifest writes the license manifest of the payload of the APEX, and checks that
+// the payload of a notice_clean APEX has no files with restricted licenses.
+func (a *apexBundle) buildLicenseManifest(ctx android.ModuleContext) {
+	noticeClean := proptools.Bool(a.properties.Notice_clean)
+
+	// The modules that are statically linked into each module, which are part of the files in the
+	// payload that come from it.
+	staticDeps := make(map[android.Module][]android.Module)
+	if noticeClean {
+		ctx.WalkDeps(func(child, parent android.Module) bool {
+			if isStaticLinkDepTag(ctx.OtherModuleDependencyTag(child)) {
+				staticDeps[parent] = append(staticDeps[parent], child)
+			}
+			return true
+		})
+	}
+
+	entries := make([]licenseManifestEntry, 0, len(a.filesInfo))
+	for _, fi := range a.filesInfo {
+		entry := licenseManifestEntry{Path: fi.path()}
+		// Files generated by the APEX itself, e.g. etc/linker.config.pb, have no module.
+		if fi.module == nil {
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Module = ctx.OtherModuleName(fi.module)
+		entry.Kinds = fi.module.EffectiveLicenseKinds()
+		entry.Conditions = fi.module.EffectiveLicenseConditions()
+		entries = append(entries, entry)
+
+		if !noticeClean {
+			continue
+		}
+		if restricted := restrictedLicenseConditions(fi.module); len(restricted) > 0 {
+			ctx.PropertyErrorf("notice_clean", "%q in the payload comes from %q, which has the "+
+				"restricted license conditions %q of the license kinds %q",
+				entry.Path, entry.Module, restricted, entry.Kinds)
+		}
+		visited := map[android.Module]bool{fi.module: true}
+		queue := staticDeps[fi.module]
+		for len(queue) > 0 {
+			dep := queue[0]
+			queue = queue[1:]
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if restricted := restrictedLicenseConditions(dep); len(restricted) > 0 {
+				ctx.PropertyErrorf("notice_clean", "%q in the payload statically links %q, which has "+
+					"the restricted license conditions %q of the license kinds %q",
+					entry.Path, ctx.OtherModuleName(dep), restricted, dep.EffectiveLicenseKinds())
+			}
+			queue = append(queue, staticDeps[dep]...)
+		}
+	}
+
+	// The files added by apexer are generated by the build, so they have no module.
+	for _, path := range apexerPayloadFiles {
+		entries = append(entries, licenseManifestEntry{Path: path})
+	}
+
+	manifest, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal the license manifest: %s", err)
+		return
+	}
+	a.licenseManifest = android.PathForModuleOut(ctx, "license_manifest.json")
+	android.WriteFileRule(ctx, a.licenseManifest, string(manifest))
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apex
+
+import (
+	"strings"
+
+	"android/soong/android"
+	"android/soong/cc"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// This file contains the support for the payload_strip property, which applies the same stripping
+// to all the native libraries and binaries in the payload of an APEX, regardless of the strip
+// properties of their modules, e.g.
+//
+//	apex {
+//	    name: "com.android.foo",
+//	    payload_strip: "strip_all",
+//	}
+//
+// The files are stripped from the unstripped outputs of their modules, except for the files that
+// are modified after the link, e.g. by inject_bssl_hash, which are packaged as built. The sizes of
+// the unstripped and the packaged files are written to payload_strip_report.tsv in the
+// intermediates directory of the APEX, which can be referenced with the ".payload_strip_report"
+// tag, e.g. to dist it.
+
+const (
+	// payloadStripKeepMiniDebugInfo strips the files but keeps the mini debug info, like the
+	// default stripping of device modules.
+	payloadStripKeepMiniDebugInfo = "keep_mini_debug_info"
+
+	// payloadStripAll strips everything, including the mini debug info.
+	payloadStripAll = "strip_all"
+
+	// payloadStripUnstripped packages the unstripped files.
+	payloadStripUnstripped = "unstripped"
+)
+
+// unstrippedOutputFileProducer is implemented by the modules that provide the unstripped version
+// of their output file, i.e. the cc and rust modules.
+type unstrippedOutputFileProducer interface {
+	UnstrippedOutputFile() android.Path
+}
+
+// applyPayloadStrip replaces the native libraries and binaries of filesInfo by the files stripped
+// according to the payload_strip property, and writes the report of their sizes.
+func (a *apexBundle) applyPayloadStrip(ctx android.ModuleContext, filesInfo []apexFile) {
+	policy := proptools.String(a.properties.Payload_strip)
+	if policy == "" {
+		return
+	}
+	if !android.InList(policy, []string{payloadStripKeepMiniDebugInfo, payloadStripAll, payloadStripUnstripped}) {
+		ctx.PropertyErrorf("payload_strip", "must be one of %q, %q or %q, got %q",
+			payloadStripKeepMiniDebugInfo, payloadStripAll, payloadStripUnstripped, policy)
+		return
+	}
+
+	var lines []string
+	var inputs android.Paths
+	for i := range filesInfo {
+		fi := &filesInfo[i]
+		if fi.class != nativeSharedLib && fi.class != nativeExecutable && fi.class != nativeTest {
+			continue
+		}
+		producer, ok := fi.module.(unstrippedOutputFileProducer)
+		if !ok {
+			continue
+		}
+		if ccMod, ok := fi.module.(*cc.Module); ok && ccMod.ModifiesOutputFileAfterLink() {
+			continue
+		}
+		unstripped := producer.UnstrippedOutputFile()
+		if unstripped == nil {
+			continue
+		}
+
+		payloadFile := unstripped
+		if policy != payloadStripUnstripped {
+			stripped := android.PathForModuleOut(ctx, "payload_strip", fi.path())
+			cc.TransformStripForPayload(ctx, unstripped, stripped, policy == payloadStripKeepMiniDebugInfo)
+			payloadFile = stripped
+		}
+		fi.builtFile = payloadFile
+
+		lines = append(lines, strings.Join([]string{fi.path(), unstripped.String(), payloadFile.String()}, "\t"))
+		inputs = append(inputs, unstripped, payloadFile)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	entriesFile := android.PathForModuleOut(ctx, "payload_strip", "entries.tsv")
+	android.WriteFileRule(ctx, entriesFile, strings.Join(lines, "\n"))
+
+	a.payloadStripReport = android.PathForModuleOut(ctx, "payload_strip_report.tsv")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	android.FileSizesCommand(rule, entriesFile, 1, inputs).
+		Text(`| awk -F '\t' -v OFS='\t' '{ print $1, $2, $3, $2 - $3 }' >`).
+		Output(a.payloadStripReport)
+	rule.Build("payload_strip_report", "payload strip report")
+}
@@ -238,6 +238,108 @@ func TestPlatformBootclasspath_LegacyPrebuiltFragment(t *testing.T) {
 	android.AssertArrayString(t, "all flags", []string{"prebuilt-all-flags.csv:out/soong/.intermediates/mybootclasspath-fragment/android_common_myapex/modular-hiddenapi/signature-patterns.csv"}, info.FlagSubsets.RelativeToTop())
 }
 
+// TestPlatformBootclasspath_IncrementalHiddenAPIStubFlags verifies that when
+// SOONG_INCREMENTAL_HIDDENAPI_FLAGS=true the monolithic stub flags are merged from the stub flags
+// of the fragments and of the libraries that are not part of a fragment.
+func TestPlatformBootclasspath_IncrementalHiddenAPIStubFlags(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForTestWithPlatformBootclasspath,
+		prepareForTestWithMyapex,
+		java.PrepareForTestWithJavaSdkLibraryFiles,
+		java.FixtureWithLastReleaseApis("foo"),
+		java.FixtureConfigureBootJars("platform:baz"),
+		java.FixtureConfigureApexBootJars("myapex:bar"),
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_INCREMENTAL_HIDDENAPI_FLAGS": "true",
+		}),
+	).RunTestWithBp(t, `
+		platform_bootclasspath {
+			name: "platform-bootclasspath",
+			fragments: [
+				{
+					apex: "myapex",
+					module:"bar-fragment",
+				},
+			],
+		}
+
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			bootclasspath_fragments: [
+				"bar-fragment",
+			],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		bootclasspath_fragment {
+			name: "bar-fragment",
+			contents: ["bar"],
+			apex_available: ["myapex"],
+			api: {
+				stub_libs: ["foo"],
+			},
+		}
+
+		java_library {
+			name: "bar",
+			apex_available: ["myapex"],
+			srcs: ["a.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+			permitted_packages: ["bar"],
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["a.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+		}
+
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			public: {
+				enabled: true,
+			},
+			compile_dex: true,
+		}
+	`)
+
+	pbcp := result.ModuleForTests("platform-bootclasspath", "android_common")
+
+	// The stub flags of the libraries are generated from their boot dex jars only.
+	rule := pbcp.Output("hiddenapi-monolithic/stub-flags-from-libraries.csv")
+	command := rule.RuleParams.Command
+	android.AssertStringDoesContain(t, "library stub flags", command, "--boot-dex=out/soong/.intermediates/baz/android_common/aligned/baz.jar")
+	android.AssertStringDoesNotContain(t, "library stub flags", command, "bar.jar")
+	android.AssertStringDoesContain(t, "library stub flags", command, "--fragment")
+
+	// The monolithic stub flags are merged from the stub flags of the libraries and fragments.
+	rule = pbcp.Output("out/soong/hiddenapi/hiddenapi-stub-flags.txt")
+	java.CheckHiddenAPIRuleInputs(t, "monolithic stub flags", `
+		out/soong/.intermediates/bar-fragment/android_common_apex10000/modular-hiddenapi/stub-flags.csv
+		out/soong/.intermediates/platform-bootclasspath/android_common/hiddenapi-monolithic/stub-flags-from-libraries.csv
+	`, rule)
+
+	// The merged stub flags are validated against the stub flags of the fragments.
+	android.AssertPathsRelativeToTopEquals(t, "monolithic stub flags validations",
+		[]string{"out/soong/hiddenapi/hiddenapi-stub-flags.txt.valid"}, rule.Validations)
+	validation := pbcp.Output("out/soong/hiddenapi/hiddenapi-stub-flags.txt.valid")
+	android.AssertStringDoesContain(t, "validation command", validation.RuleParams.Command,
+		"--module-flags out/soong/.intermediates/bar-fragment/android_common_apex10000/modular-hiddenapi/stub-flags.csv:"+
+			"out/soong/.intermediates/bar-fragment/android_common_apex10000/modular-hiddenapi/signature-patterns.csv")
+}
+
 func TestPlatformBootclasspathDependencies(t *testing.T) {
 	result := android.GroupFixturePreparers(
 		prepareForTestWithPlatformBootclasspath,
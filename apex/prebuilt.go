@@ -427,13 +427,13 @@ func (p *prebuiltCommon) apexInfoMutator(mctx android.TopDownMutatorContext) {
 	})
 
 	// Create contents for the prebuilt_apex and store it away for later use.
-	apexContents := android.NewApexContents(contents)
+	apexVariationName := p.ApexVariationName()
+	apexContents := android.NewApexContents(p.ModuleBase.BaseModuleName(), apexVariationName, contents)
 	mctx.SetProvider(ApexBundleInfoProvider, ApexBundleInfo{
 		Contents: apexContents,
 	})
 
 	// Create an ApexInfo for the prebuilt_apex.
-	apexVariationName := p.ApexVariationName()
 	apexInfo := android.ApexInfo{
 		ApexVariationName: apexVariationName,
 		InApexVariants:    []string{apexVariationName},
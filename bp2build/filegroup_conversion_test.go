@@ -56,3 +56,37 @@ filegroup {
 		expectedErr: fmt.Errorf("filegroup 'foo' cannot contain a file with the same name"),
 	})
 }
+
+func TestFilegroupWithArchSrcs(t *testing.T) {
+	runFilegroupTestCase(t, bp2buildTestCase{
+		description: "filegroup - arch specific srcs and exclude_srcs",
+		filesystem:  map[string]string{},
+		blueprint: `
+filegroup {
+    name: "fg_foo",
+    srcs: ["common.txt", "not_arm.txt"],
+    arch: {
+        arm: {
+            srcs: ["arm.txt"],
+            exclude_srcs: ["not_arm.txt"],
+        },
+        arm64: {
+            srcs: ["arm64.txt"],
+        },
+    },
+    bazel_module: { bp2build_available: true },
+}
+`,
+		expectedBazelTargets: []string{
+			makeBazelTarget("filegroup", "fg_foo", attrNameToString{
+				"srcs": `["common.txt"] + select({
+        "//build/bazel/platforms/arch:arm": ["arm.txt"],
+        "//build/bazel/platforms/arch:arm64": [
+            "not_arm.txt",
+            "arm64.txt",
+        ],
+        "//conditions:default": ["not_arm.txt"],
+    })`,
+			}),
+		}})
+}
@@ -92,6 +92,8 @@ type binaryDecorator struct {
 
 	Properties BinaryLinkerProperties
 
+	initRcTemplateProperties android.InitRcTemplateProperties
+
 	toolPath android.OptionalPath
 
 	// Location of the linked, unstripped binary
@@ -122,6 +124,7 @@ var _ linker = (*binaryDecorator)(nil)
 func (binary *binaryDecorator) linkerProps() []interface{} {
 	return append(binary.baseLinker.linkerProps(),
 		&binary.Properties,
+		&binary.initRcTemplateProperties,
 		&binary.stripper.StripProperties)
 
 }
@@ -511,6 +514,7 @@ func (binary *binaryDecorator) install(ctx ModuleContext, file android.Path) {
 		binary.baseInstaller.subDir = "bootstrap"
 	}
 	binary.baseInstaller.install(ctx, file)
+	android.GenerateInitRcFromTemplates(ctx, &binary.initRcTemplateProperties, binary.baseInstaller.path)
 
 	var preferredArchSymlinkPath android.OptionalPath
 	for _, symlink := range binary.symlinks {
@@ -49,3 +49,49 @@ cc_binary {
 	expectedUnStrippedFile := "outputbase/execroot/__main__/foo"
 	android.AssertStringEquals(t, "Unstripped output file", expectedUnStrippedFile, unStrippedFilePath.String())
 }
+
+func TestCcBinaryInitRcTemplate(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"foo.rc.in":  nil,
+			"foo.xml.in": nil,
+		}),
+	).RunTestWithBp(t, `
+		cc_binary {
+			name: "foo",
+			srcs: ["foo.cc"],
+			relative_install_path: "hw",
+			init_rc_template: ["foo.rc.in"],
+			vintf_fragments_template: ["foo.xml.in"],
+			template_vars: {
+				user: "system",
+				group: ["system", "inet"],
+			},
+		}
+	`)
+
+	module := result.ModuleForTests("foo", "android_arm64_armv8-a")
+	rc := module.Output("rc_template/foo.rc")
+	android.AssertPathRelativeToTopEquals(t, "template", "foo.rc.in", rc.Input)
+	for _, arg := range []string{
+		"--format rc",
+		"--var module_name=foo",
+		"--var install_path=/system/bin/hw/foo",
+		"--var user=system",
+		"--var 'group=system inet'",
+	} {
+		android.AssertStringDoesContain(t, "rc command", rc.RuleParams.Command, arg)
+	}
+	android.AssertStringDoesNotContain(t, "rc command", rc.RuleParams.Command, "--var capabilities=")
+
+	vintf := module.Output("vintf_template/foo.xml")
+	android.AssertStringDoesContain(t, "vintf command", vintf.RuleParams.Command, "--format vintf")
+
+	// The generated files are installed like the files listed in init_rc and vintf_fragments.
+	entries := android.AndroidMkEntriesForTest(t, result.TestContext, module.Module())[0]
+	android.AssertStringPathsRelativeToTopEquals(t, "LOCAL_FULL_INIT_RC", result.Config,
+		[]string{rc.Output.String()}, entries.EntryMap["LOCAL_FULL_INIT_RC"])
+	android.AssertStringPathsRelativeToTopEquals(t, "LOCAL_FULL_VINTF_FRAGMENTS", result.Config,
+		[]string{vintf.Output.String()}, entries.EntryMap["LOCAL_FULL_VINTF_FRAGMENTS"])
+}
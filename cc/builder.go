@@ -296,7 +296,8 @@ var (
 	sAbiDiff = pctx.RuleFunc("sAbiDiff",
 		func(ctx android.PackageRuleContext) blueprint.RuleParams {
 			commandStr := "($sAbiDiffer ${extraFlags} -lib ${libName} -arch ${arch} -o ${out} -new ${in} -old ${referenceDump})"
-			commandStr += "|| (echo 'error: Please update ABI references with: $$ANDROID_BUILD_TOP/development/vndk/tools/header-checker/utils/create_reference_dumps.py ${createReferenceDumpFlags} -l ${libName}'"
+			commandStr += "|| (echo 'error: Please update ABI references with: " + updateAbiReferenceDumpsEnv + "=true m " + updateAbiReferenceDumpsPhony +
+				" && cp $$OUT_DIR/soong/" + updateAbiReferenceDumpsDir + "/${referenceSrcPath} $$ANDROID_BUILD_TOP/${referenceSrcPath}'"
 			commandStr += " && (mkdir -p $$DIST_DIR/abidiffs && cp ${out} $$DIST_DIR/abidiffs/)"
 			commandStr += " && exit 1)"
 			return blueprint.RuleParams{
@@ -304,7 +305,18 @@ var (
 				CommandDeps: []string{"$sAbiDiffer"},
 			}
 		},
-		"extraFlags", "referenceDump", "libName", "arch", "createReferenceDumpFlags")
+		"extraFlags", "referenceDump", "referenceSrcPath", "libName", "arch")
+
+	// Rule to check that the exported flags of a library do not change the ABI of its exported
+	// headers, by comparing linked sAbi dumps of the headers with and without the exported flags.
+	sAbiExportedFlagsDiff = pctx.AndroidStaticRule("sAbiExportedFlagsDiff",
+		blueprint.RuleParams{
+			Command: "($sAbiDiffer -check-all-apis -lib ${libName} -arch ${arch} -o ${out} -new ${in} -old ${referenceDump})" +
+				" || (echo 'error: The export_cflags of ${libName} change the ABI of its exported headers, see ${out}'" +
+				" && exit 1)",
+			CommandDeps: []string{"$sAbiDiffer"},
+		},
+		"referenceDump", "libName", "arch")
 
 	// Rule to unzip a reference abi dump.
 	unzipRefSAbiDump = pctx.AndroidStaticRule("unzipRefSAbiDump",
@@ -312,6 +324,12 @@ var (
 			Command: "gunzip -c $in > $out",
 		})
 
+	// Rule to zip an updated reference abi dump.
+	zipRefSAbiDump = pctx.AndroidStaticRule("zipRefSAbiDump",
+		blueprint.RuleParams{
+			Command: "gzip -n -c $in > $out",
+		})
+
 	// Rule to zip files.
 	zip = pctx.AndroidStaticRule("zip",
 		blueprint.RuleParams{
@@ -412,6 +430,8 @@ type builderFlags struct {
 
 	yacc *YaccProperties
 	lex  *LexProperties
+
+	precompiledHeader android.OptionalPath
 }
 
 // StripFlags represents flags related to stripping. This is separate from builderFlags, as these
@@ -572,6 +592,43 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 		return "$" + kind + n
 	}
 
+	// Build the precompiled header with the same flags as the C++ sources that use it, as clang
+	// rejects a precompiled header that was built with incompatible flags.  One is built per set of
+	// C++ flags of the module, the first time a source compiled with them uses it, and shared by the
+	// compiles with the same flags, e.g. of the srcs and of the static or shared only srcs of a
+	// library.  The cc rule writes a depfile listing every header included by the precompiled
+	// header, so it is rebuilt, and so are the objects that depend on it, whenever any of them
+	// change.
+	precompiledHeader := func() android.Path {
+		pch, ok := shared.precompiledHeaders[cppflags]
+		if !ok {
+			header := flags.precompiledHeader.Path()
+			pchSubdir := ""
+			if n := len(shared.precompiledHeaders); n > 0 {
+				pchSubdir = "pch" + strconv.Itoa(n+1)
+			}
+			pchFile := android.ObjPathWithExt(ctx, pchSubdir, header, "pch")
+			ctx.Build(pctx, android.BuildParams{
+				Rule:        cc,
+				Description: "clang++ pch " + header.Rel(),
+				Output:      pchFile,
+				Input:       header,
+				Implicits:   cFlagsDeps,
+				OrderOnly:   pathDeps,
+				Args: map[string]string{
+					"cFlags": cppflags + " -x c++-header",
+					"ccCmd":  "${config.ClangBin}/clang++",
+				},
+			})
+			if shared.precompiledHeaders == nil {
+				shared.precompiledHeaders = make(map[string]android.Path)
+			}
+			pch = pchFile
+			shared.precompiledHeaders[cppflags] = pch
+		}
+		return pch
+	}
+
 	for i, srcFile := range srcFiles {
 		objFile := android.ObjPathWithExt(ctx, subdir, srcFile, "o")
 
@@ -599,6 +656,7 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 
 		var moduleFlags string
 		var moduleToolingFlags string
+		var usePch bool
 
 		var ccCmd string
 		tidy := flags.tidy
@@ -628,6 +686,8 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 			ccCmd = "clang++"
 			moduleFlags = cppflags
 			moduleToolingFlags = toolingCppflags
+			// The precompiled header is built as C++, and can't be used for Objective-C++.
+			usePch = flags.precompiledHeader.Valid() && srcFile.Ext() != ".mm"
 		case ".h", ".hpp":
 			ctx.PropertyErrorf("srcs", "Header file %s is not supported, instead use export_include_dirs or local_include_dirs.", srcFile)
 			continue
@@ -647,16 +707,26 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 			coverageFiles = append(coverageFiles, gcnoFile)
 		}
 
+		// Only the compile uses the precompiled header, clang based tools such as clang-tidy may
+		// not be able to read it.
+		compileFlags := moduleFlags
+		implicits := cFlagsDeps
+		if usePch {
+			pch := precompiledHeader()
+			compileFlags += " -include-pch " + pch.String()
+			implicits = append(android.Paths{pch}, cFlagsDeps...)
+		}
+
 		ctx.Build(pctx, android.BuildParams{
 			Rule:            rule,
 			Description:     ccDesc + " " + srcFile.Rel(),
 			Output:          objFile,
 			ImplicitOutputs: implicitOutputs,
 			Input:           srcFile,
-			Implicits:       cFlagsDeps,
+			Implicits:       implicits,
 			OrderOnly:       pathDeps,
 			Args: map[string]string{
-				"cFlags": shareFlags("cFlags", moduleFlags),
+				"cFlags": shareFlags("cFlags", compileFlags),
 				"ccCmd":  ccCmd, // short and not shared
 			},
 		})
@@ -930,6 +1000,59 @@ func transformDumpToLinkedDump(ctx android.ModuleContext, sAbiDumps android.Path
 	return android.OptionalPathForPath(outputFile)
 }
 
+// transformHeadersToSAbiDump generates a rule to dump the ABI of the headers included by a C++
+// source file, compiled with the module's C++ tooling flags plus extraCFlags.
+func transformHeadersToSAbiDump(ctx android.ModuleContext, srcFile android.Path, flags builderFlags,
+	extraCFlags []string, outputFile android.WritablePath, pathDeps, cFlagsDeps android.Paths) {
+
+	toolingCppflags := flags.globalCommonFlags + " " +
+		flags.globalToolingCFlags + " " +
+		flags.globalToolingCppFlags + " " +
+		flags.localCommonFlags + " " +
+		flags.localToolingCFlags + " " +
+		flags.localToolingCppFlags + " " +
+		flags.systemIncludeFlags + " " +
+		strings.Join(extraCFlags, " ") + " " +
+		"${config.NoOverrideGlobalCflags}"
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        sAbiDump,
+		Description: "header-abi-dumper " + outputFile.Base(),
+		Output:      outputFile,
+		Input:       srcFile,
+		Implicits:   cFlagsDeps,
+		OrderOnly:   pathDeps,
+		Args: map[string]string{
+			"cFlags":     toolingCppflags,
+			"exportDirs": flags.sAbiFlags,
+		},
+	})
+}
+
+// sourceAbiExportedFlagsDiff registers a build statement to compare the linked sAbi dump of the
+// exported headers of a library compiled with its exported flags against the one compiled without
+// them.
+func sourceAbiExportedFlagsDiff(ctx android.ModuleContext, exportedFlagsDump, libraryFlagsDump android.Path,
+	baseName string) android.OptionalPath {
+
+	outputFile := android.PathForModuleOut(ctx, baseName+".exported_flags.abidiff")
+	libName := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        sAbiExportedFlagsDiff,
+		Description: "header-abi-diff " + outputFile.Base(),
+		Output:      outputFile,
+		Input:       exportedFlagsDump,
+		Implicit:    libraryFlagsDump,
+		Args: map[string]string{
+			"referenceDump": libraryFlagsDump.String(),
+			"libName":       libName,
+			"arch":          ctx.Arch().ArchType.Name,
+		},
+	})
+	return android.OptionalPathForPath(outputFile)
+}
+
 // unzipRefDump registers a build statement to unzip a reference abi dump.
 func unzipRefDump(ctx android.ModuleContext, zippedRefDump android.Path, baseName string) android.Path {
 	outputFile := android.PathForModuleOut(ctx, baseName+"_ref.lsdump")
@@ -942,14 +1065,31 @@ func unzipRefDump(ctx android.ModuleContext, zippedRefDump android.Path, baseNam
 	return outputFile
 }
 
+// updateRefDump registers a build statement to copy a linked sAbi dump file (.lsdump) to the
+// location of the reference dump at referenceSrcPath under the update directory, compressing it
+// if the reference dump is compressed.
+func updateRefDump(ctx android.ModuleContext, inputDump android.Path, referenceSrcPath string) android.Path {
+	outputFile := android.PathForOutput(ctx, updateAbiReferenceDumpsDir, referenceSrcPath)
+	rule := android.Cp
+	if strings.HasSuffix(referenceSrcPath, ".gz") {
+		rule = zipRefSAbiDump
+	}
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        rule,
+		Description: "update reference abi dump " + referenceSrcPath,
+		Output:      outputFile,
+		Input:       inputDump,
+	})
+	return outputFile
+}
+
 // sourceAbiDiff registers a build statement to compare linked sAbi dump files (.lsdump).
 func sourceAbiDiff(ctx android.ModuleContext, inputDump android.Path, referenceDump android.Path,
-	baseName, exportedHeaderFlags string, diffFlags []string,
-	checkAllApis, isLlndk, isNdk, isVndkExt bool) android.OptionalPath {
+	referenceSrcPath, baseName, nameSuffix, exportedHeaderFlags string, diffFlags []string,
+	checkAllApis, isLlndk, isVndkExt bool) android.Path {
 
-	outputFile := android.PathForModuleOut(ctx, baseName+".abidiff")
+	outputFile := android.PathForModuleOut(ctx, baseName+nameSuffix+".abidiff")
 	libName := strings.TrimSuffix(baseName, filepath.Ext(baseName))
-	createReferenceDumpFlags := ""
 
 	var extraFlags []string
 	if checkAllApis {
@@ -964,14 +1104,11 @@ func sourceAbiDiff(ctx android.ModuleContext, inputDump android.Path, referenceD
 		extraFlags = append(extraFlags, "-advice-only")
 	}
 
-	if isLlndk || isNdk {
-		createReferenceDumpFlags = "--llndk"
-		if isLlndk {
-			// TODO(b/130324828): "-consider-opaque-types-different" should apply to
-			// both LLNDK and NDK shared libs. However, a known issue in header-abi-diff
-			// breaks libaaudio. Remove the if-guard after the issue is fixed.
-			extraFlags = append(extraFlags, "-consider-opaque-types-different")
-		}
+	if isLlndk {
+		// TODO(b/130324828): "-consider-opaque-types-different" should apply to
+		// both LLNDK and NDK shared libs. However, a known issue in header-abi-diff
+		// breaks libaaudio. Remove the if-guard after the issue is fixed.
+		extraFlags = append(extraFlags, "-consider-opaque-types-different")
 	}
 	if isVndkExt {
 		extraFlags = append(extraFlags, "-allow-extensions")
@@ -986,14 +1123,14 @@ func sourceAbiDiff(ctx android.ModuleContext, inputDump android.Path, referenceD
 		Input:       inputDump,
 		Implicit:    referenceDump,
 		Args: map[string]string{
-			"referenceDump":            referenceDump.String(),
-			"libName":                  libName,
-			"arch":                     ctx.Arch().ArchType.Name,
-			"extraFlags":               strings.Join(extraFlags, " "),
-			"createReferenceDumpFlags": createReferenceDumpFlags,
+			"referenceDump":    referenceDump.String(),
+			"referenceSrcPath": referenceSrcPath,
+			"libName":          libName,
+			"arch":             ctx.Arch().ArchType.Name,
+			"extraFlags":       strings.Join(extraFlags, " "),
 		},
 	})
-	return android.OptionalPathForPath(outputFile)
+	return outputFile
 }
 
 // Generate a rule for extracting a table of contents from a shared library (.so)
@@ -234,6 +234,8 @@ type Flags struct {
 
 	Yacc *YaccProperties
 	Lex  *LexProperties
+
+	PrecompiledHeader android.OptionalPath // Header to precompile and include in C++ compiles
 }
 
 // Properties used to compile all C or C++ modules
@@ -267,6 +269,10 @@ type BaseProperties struct {
 	// If true, always create an sdk variant and don't create a platform variant.
 	Sdk_variant_only *bool
 
+	// If true, sdk_version may be the draft NDK API level of the product, whose APIs are still in
+	// development and may change or be removed before they are finalized.
+	Allow_draft_ndk_apis *bool
+
 	AndroidMkSharedLibs       []string `blueprint:"mutated"`
 	AndroidMkStaticLibs       []string `blueprint:"mutated"`
 	AndroidMkRuntimeLibs      []string `blueprint:"mutated"`
@@ -524,6 +530,10 @@ type ModuleContextIntf interface {
 type SharedFlags struct {
 	numSharedFlags int
 	flagsMap       map[string]string
+
+	// The precompiled headers of the module by C++ flags, built by the first compile with the flags
+	// that uses it.
+	precompiledHeaders map[string]android.Path
 }
 
 type ModuleContext interface {
@@ -713,6 +723,14 @@ func (d libraryDependencyTag) InstallDepNeeded() bool {
 
 var _ android.InstallNeededDependencyTag = libraryDependencyTag{}
 
+// CoveredDependency returns true for the static and shared libraries whose code is linked into the
+// depending module, so that the tests of the module cover them.
+func (d libraryDependencyTag) CoveredDependency() bool {
+	return (d.static() || d.shared()) && !d.dataLib
+}
+
+var _ android.CoveredDependencyTag = libraryDependencyTag{}
+
 // dependencyTag is used for tagging miscellaneous dependency types that don't fit into
 // libraryDependencyTag.  Each tag object is created globally and reused for multiple
 // dependencies (although since the object contains no references, assigning a tag to a
@@ -1824,6 +1842,13 @@ func (c *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 	}
 	ctx.ctx = ctx
 
+	if ctx.Device() {
+		actx.SetProvider(android.EffectiveSdkVersionsInfoProvider, android.EffectiveSdkVersionsInfo{
+			SdkVersion:    ctx.sdkVersion(),
+			MinSdkVersion: ctx.minSdkVersion(),
+		})
+	}
+
 	if c.maybeGenerateBazelActions(actx) {
 		c.maybeInstall(ctx, apexInfo)
 		return
@@ -2002,6 +2027,11 @@ func (c *Module) begin(ctx BaseModuleContext) {
 			ctx.PropertyErrorf("sdk_version", err.Error())
 			c.Properties.Sdk_version = nil
 		} else {
+			// The crt objects are built for every API level, including the draft one, for the modules
+			// that opt in to use it.
+			if version == ctx.Config().NdkDraftApiLevel() && !Bool(c.Properties.Allow_draft_ndk_apis) && !c.SplitPerApiLevel() {
+				ctx.PropertyErrorf("sdk_version", "%q is the draft NDK API level, set allow_draft_ndk_apis: true to use it", version)
+			}
 			c.Properties.Sdk_version = StringPtr(version.String())
 		}
 	}
@@ -2703,7 +2733,7 @@ func (c *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 			return
 		}
 
-		if depTag == android.ProtoPluginDepTag {
+		if depTag == android.ProtoPluginDepTag || depTag == android.TestMappingDepTag {
 			return
 		}
 
@@ -3364,6 +3394,22 @@ func (c *Module) TestFor() []string {
 	return c.Properties.Test_for
 }
 
+func (c *Module) TestMappingTargets() []string {
+	if test, ok := c.linker.(*testBinary); ok {
+		return test.Properties.Test_mapping.Test_for
+	}
+	return nil
+}
+
+func (c *Module) TestMappingPresubmit() bool {
+	if test, ok := c.linker.(*testBinary); ok {
+		return Bool(test.Properties.Test_mapping.Presubmit)
+	}
+	return false
+}
+
+var _ android.TestMappingModule = (*Module)(nil)
+
 func (c *Module) EverInstallable() bool {
 	return c.installer != nil &&
 		// Check to see whether the module is actually ever installable.
@@ -3461,6 +3507,16 @@ func (c *Module) DepIsInSameApex(ctx android.BaseModuleContext, dep android.Modu
 	return true
 }
 
+// Implements android.ApexModule
+func (c *Module) UniqueApexVariations() bool {
+	// The files generated from the init_rc_template and vintf_fragments_template of a binary
+	// contain the path of the variant in its APEX.
+	if binary, ok := c.linker.(*binaryDecorator); ok {
+		return binary.initRcTemplateProperties.HasTemplates()
+	}
+	return false
+}
+
 // Implements android.ApexModule
 func (c *Module) ShouldSupportSdkVersion(ctx android.BaseModuleContext,
 	sdkVersion android.ApiLevel) error {
@@ -810,6 +810,62 @@ func TestTestBinaryTestSuites(t *testing.T) {
 	}
 }
 
+func TestHostTestRun(t *testing.T) {
+	bp := `
+		cc_test {
+			name: "main_test",
+			host_supported: true,
+			srcs: ["main_test.cpp"],
+			shared_libs: ["libshared"],
+			data: ["data.txt"],
+			gtest: false,
+			test_options: {
+				unit_test: true,
+			},
+		}
+
+		cc_library_shared {
+			name: "libshared",
+			host_supported: true,
+		}
+	`
+
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"data.txt": nil,
+		}),
+	).RunTestWithBp(t, bp)
+
+	buildOS := result.Config.BuildOSTarget.String()
+	run := result.ModuleForTests("main_test", buildOS).Rule("hostTestRun")
+	installed := result.ModuleForTests("main_test", buildOS).Description("install").Output
+	sharedInstalled := result.ModuleForTests("libshared", buildOS+"_shared").Description("install").Output
+
+	android.AssertStringEquals(t, "test command", installed.String(), run.Args["testCommand"])
+	android.AssertStringEquals(t, "flags", "", run.Args["flags"])
+	android.AssertStringListContains(t, "inputs", run.Inputs.Strings(), installed.String())
+	android.AssertStringListContains(t, "inputs", run.Inputs.Strings(), sharedInstalled.String())
+	android.AssertStringListContains(t, "inputs", run.Inputs.Strings(), "data.txt")
+
+	// Device tests are not run by the build.
+	device := result.ModuleForTests("main_test", "android_arm64_armv8-a")
+	android.AssertBoolEquals(t, "device test run", true, device.MaybeRule("hostTestRun").Rule == nil)
+
+	result = android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"data.txt": nil,
+		}),
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_NO_TEST_CACHE": "true",
+		}),
+	).RunTestWithBp(t, bp)
+
+	run = result.ModuleForTests("main_test", buildOS).Rule("hostTestRun")
+	android.AssertStringEquals(t, "flags", "--no-cache", run.Args["flags"])
+}
+
 func TestTestLibraryTestSuites(t *testing.T) {
 	bp := `
 		cc_test_library {
@@ -3355,6 +3411,65 @@ func TestFuzzTarget(t *testing.T) {
 	ctx.ModuleForTests("fuzz_smoke_test", variant).Rule("cc")
 }
 
+func TestFuzzEntryPoints(t *testing.T) {
+	ctx := testCc(t, `
+		cc_library {
+			name: "libfoo",
+			srcs: ["foo.c"],
+			export_include_dirs: ["."],
+			fuzz_entry_points: [
+				"foo_parse",
+				"foo::decode",
+			],
+			fuzz_entry_point_headers: ["foo/parser.h"],
+		}`)
+
+	variant := "android_arm64_armv8-a_fuzzer"
+	fuzzer := ctx.ModuleForTests("libfoo_fuzzer", variant)
+
+	harness := fuzzer.Output("gen/fuzz_harness/libfoo_fuzzer.cpp")
+	android.AssertStringEquals(t, "generated source", `// Generated by Soong for libfoo_fuzzer, do not edit.
+
+#include <stddef.h>
+#include <stdint.h>
+
+#include <foo/parser.h>
+
+extern "C" int LLVMFuzzerTestOneInput(const uint8_t* data, size_t size) {
+  foo_parse(data, size);
+  foo::decode(data, size);
+  return 0;
+}
+`, android.ContentFromFileRuleForTests(t, harness))
+
+	cc := fuzzer.Rule("cc")
+	android.AssertPathRelativeToTopEquals(t, "compiled source", "out/soong/.intermediates/libfoo_fuzzer/android_arm64_armv8-a_fuzzer/gen/fuzz_harness/libfoo_fuzzer.cpp", cc.Input)
+
+	ld := fuzzer.Rule("ld")
+	android.AssertStringDoesContain(t, "linked library", ld.Args["libFlags"], "libfoo.a")
+}
+
+func TestFuzzEntryPointsErrors(t *testing.T) {
+	testCcError(t, `"foo\(\)" is not the name of a function`, `
+		cc_library {
+			name: "libfoo",
+			fuzz_entry_points: ["foo()"],
+			fuzz_entry_point_headers: ["foo.h"],
+		}`)
+
+	testCcError(t, `fuzz_entry_point_headers: must be set when fuzz_entry_points is set`, `
+		cc_library {
+			name: "libfoo",
+			fuzz_entry_points: ["foo_parse"],
+		}`)
+
+	testCcError(t, `unrecognized property "harness_entry_points"`, `
+		cc_fuzz {
+			name: "foo_fuzzer",
+			harness_entry_points: ["foo_parse"],
+		}`)
+}
+
 func TestAidl(t *testing.T) {
 }
 
@@ -3640,6 +3755,26 @@ func TestStubsLibReexportsHeaders(t *testing.T) {
 	}
 }
 
+func TestRemapDebugPaths(t *testing.T) {
+	bp := `
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.c"],
+		}`
+
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.RemapDebugPaths = true
+		}),
+	).RunTestWithBp(t, bp)
+
+	// The output directory of the test is outside the source tree, so it is remapped.
+	cFlags := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared").Rule("cc").Args["cFlags"]
+	android.AssertStringDoesContain(t, "cflags", cFlags,
+		"-fdebug-prefix-map="+result.Config.OutDir()+"=out")
+}
+
 func TestAidlFlagsPassedToTheAidlCompiler(t *testing.T) {
 	ctx := testCc(t, `
 		cc_library {
@@ -4196,3 +4331,60 @@ func TestIncludeDirectoryOrdering(t *testing.T) {
 	}
 
 }
+
+func TestPrecompiledHeader(t *testing.T) {
+	t.Parallel()
+	ctx := testCc(t, `
+		cc_library {
+			name: "libfoo",
+			srcs: ["foo.cpp"],
+			precompiled_header: "pch.h",
+			static: {
+				srcs: ["static.cpp"],
+				cflags: ["-DSTATIC"],
+			},
+		}
+
+		cc_binary {
+			name: "bar",
+			srcs: ["bar.c"],
+			precompiled_header: "pch.h",
+		}
+	`)
+
+	libfoo := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+	pch := libfoo.Output("obj/pch.pch")
+	android.AssertStringEquals(t, "pch input", "pch.h", pch.Input.String())
+	android.AssertStringDoesContain(t, "pch cFlags", pch.Args["cFlags"], "-x c++-header")
+
+	obj := libfoo.Output("obj/foo.o")
+	android.AssertStringDoesContain(t, "obj cFlags", obj.Args["cFlags"], "-include-pch "+pch.Output.String())
+	android.AssertStringListContains(t, "obj implicits", obj.Implicits.Strings(), pch.Output.String())
+
+	// The static only srcs share the precompiled header of the srcs.
+	libfooStatic := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_static")
+	staticPch := libfooStatic.Output("obj/pch.pch")
+	staticObj := libfooStatic.Output("obj/static_library/static.o")
+	android.AssertStringDoesContain(t, "static obj cFlags", staticObj.Args["cFlags"],
+		"-include-pch "+staticPch.Output.String())
+	pchOutputs := android.FilterListPred(libfooStatic.AllOutputs(), func(s string) bool {
+		return strings.HasSuffix(s, ".pch")
+	})
+	android.AssertIntEquals(t, "pch rules", 1, len(pchOutputs))
+
+	// Each variant builds the precompiled header with its own flags.
+	android.AssertStringDoesContain(t, "static pch cFlags", staticPch.Args["cFlags"], "-DSTATIC")
+	android.AssertStringDoesNotContain(t, "shared pch cFlags", pch.Args["cFlags"], "-DSTATIC")
+
+	// The precompiled header is only used for C++ sources.
+	barObj := ctx.ModuleForTests("bar", "android_arm64_armv8-a").Output("obj/bar.o")
+	android.AssertStringDoesNotContain(t, "C obj cFlags", barObj.Args["cFlags"], "-include-pch")
+
+	testCcError(t, `precompiled_header: File pch.cpp is not a header`, `
+		cc_library {
+			name: "libfoo",
+			srcs: ["foo.cpp"],
+			precompiled_header: "pch.cpp",
+		}
+	`)
+}
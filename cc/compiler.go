@@ -116,6 +116,12 @@ type BaseCompilerProperties struct {
 	// if set to false, use -std=c++* instead of -std=gnu++*
 	Gnu_extensions *bool
 
+	// header file to precompile once per variant with clang.  The precompiled header is passed
+	// to the compiles of all C++ sources with -include-pch, which makes them behave as if the
+	// header was included at the start of every source file.  It is rebuilt whenever any header
+	// that it transitively includes changes.
+	Precompiled_header *string `android:"path,arch_variant"`
+
 	Yacc *YaccProperties
 	Lex  *LexProperties
 
@@ -367,6 +373,16 @@ func (compiler *baseCompiler) compilerFlags(ctx ModuleContext, flags Flags, deps
 	flags.Yacc = compiler.Properties.Yacc
 	flags.Lex = compiler.Properties.Lex
 
+	if compiler.Properties.Precompiled_header != nil {
+		header := android.PathForModuleSrc(ctx, *compiler.Properties.Precompiled_header)
+		switch header.Ext() {
+		case ".h", ".hh", ".hpp", ".hxx":
+			flags.PrecompiledHeader = android.OptionalPathForPath(header)
+		default:
+			ctx.PropertyErrorf("precompiled_header", "File %s is not a header. Supported extensions: .h, .hh, .hpp, .hxx", header)
+		}
+	}
+
 	// Include dir cflags
 	localIncludeDirs := android.PathsForModuleSrc(ctx, compiler.Properties.Local_include_dirs)
 	if len(localIncludeDirs) > 0 {
@@ -486,6 +502,9 @@ func (compiler *baseCompiler) compilerFlags(ctx ModuleContext, flags Flags, deps
 		tc.Cflags(),
 		"${config.CommonGlobalCflags}",
 		fmt.Sprintf("${config.%sGlobalCflags}", hod))
+	for _, prefixMap := range ctx.Config().DebugPathPrefixMaps() {
+		flags.Global.CommonFlags = append(flags.Global.CommonFlags, "-fdebug-prefix-map="+prefixMap)
+	}
 
 	if android.IsThirdPartyPath(modulePath) {
 		flags.Global.CommonFlags = append(flags.Global.CommonFlags, "${config.ExternalCflags}")
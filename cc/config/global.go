@@ -399,6 +399,15 @@ func init() {
 	pctx.StaticVariableWithEnvOverride("ClangShortVersion", "LLVM_RELEASE_VERSION", ClangDefaultShortVersion)
 	pctx.StaticVariable("ClangAsanLibDir", "${ClangBase}/linux-x86/${ClangVersion}/lib64/clang/${ClangShortVersion}/lib/linux")
 
+	android.RegisterToolVersionsProvider(func(ctx android.PathContext) []android.ToolVersion {
+		return []android.ToolVersion{{
+			Name:        "clang",
+			Version:     clangPath(ctx).Base(),
+			Tool:        ClangPath(ctx, "bin/clang"),
+			VersionArgs: []string{"--version"},
+		}}
+	})
+
 	// These are tied to the version of LLVM directly in external/llvm, so they might trail the host prebuilts
 	// being used for the rest of the build process.
 	pctx.SourcePathVariable("RSClangBase", "prebuilts/clang/host")
@@ -443,6 +452,15 @@ func ClangPath(ctx android.PathContext, file string) android.SourcePath {
 
 var clangPathKey = android.NewOnceKey("clangPath")
 
+// ClangLlvmVersion returns the major version of the LLVM of the clang used by the build.
+func ClangLlvmVersion(ctx android.PathContext) string {
+	version := ClangDefaultShortVersion
+	if override := ctx.Config().Getenv("LLVM_RELEASE_VERSION"); override != "" {
+		version = override
+	}
+	return strings.SplitN(version, ".", 2)[0]
+}
+
 func clangPath(ctx android.PathContext) android.SourcePath {
 	return ctx.Config().OnceSourcePath(clangPathKey, func() android.SourcePath {
 		clangBase := ClangDefaultBase
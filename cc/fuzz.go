@@ -48,6 +48,7 @@ type fuzzBinary struct {
 	*baseCompiler
 
 	fuzzPackagedModule fuzz.FuzzPackagedModule
+	harnessProperties  fuzzHarnessProperties
 
 	installedSharedDeps []string
 }
@@ -0,0 +1,133 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"android/soong/android"
+)
+
+// This file generates fuzz targets for libraries that declare fuzz_entry_points, e.g.
+//
+//	cc_library {
+//	    name: "libfoo",
+//	    export_include_dirs: ["include"],
+//	    fuzz_entry_points: ["foo_parse"],
+//	    fuzz_entry_point_headers: ["foo/parser.h"],
+//	}
+//
+// creates a cc_fuzz module named libfoo_fuzzer that links against libfoo and whose generated
+// source includes foo/parser.h and calls foo_parse(data, size) for each input of the fuzzer. The
+// generated fuzzer is a starting point that provides coverage of small parsing libraries at no
+// cost, libraries that need more setup should replace it with a handwritten cc_fuzz module.
+
+// fuzzHarnessProperties are the properties of a generated cc_fuzz module that generate its source.
+// They are only added by fuzzHarnessFactory, so they cannot be set in Android.bp files.
+type fuzzHarnessProperties struct {
+	// Functions with the signature `f(const uint8_t* data, size_t size)` that are called with each
+	// input of the fuzzer by a generated source file.
+	Harness_entry_points []string
+
+	// Headers that declare the harness_entry_points, which are included by the generated source.
+	Harness_headers []string
+}
+
+// fuzzEntryPointRegexp matches the name of a function, optionally qualified by a namespace.
+var fuzzEntryPointRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(::[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// fuzzHarnessFactory creates the cc_fuzz modules generated by createFuzzHarness. It is not
+// registered as a module type.
+func fuzzHarnessFactory() android.Module {
+	module := NewFuzz(android.HostAndDeviceSupported)
+	fuzz := module.compiler.(*fuzzBinary)
+	module.AddProperties(&fuzz.harnessProperties)
+	return module.Init()
+}
+
+// createFuzzHarness creates the cc_fuzz module for a library that sets fuzz_entry_points.
+func (library *libraryDecorator) createFuzzHarness(ctx android.LoadHookContext) {
+	entryPoints := library.Properties.Fuzz_entry_points
+	if len(entryPoints) == 0 {
+		return
+	}
+	for _, entryPoint := range entryPoints {
+		if !fuzzEntryPointRegexp.MatchString(entryPoint) {
+			ctx.PropertyErrorf("fuzz_entry_points", "%q is not the name of a function", entryPoint)
+			return
+		}
+	}
+	if len(library.Properties.Fuzz_entry_point_headers) == 0 {
+		ctx.PropertyErrorf("fuzz_entry_point_headers", "must be set when fuzz_entry_points is set")
+		return
+	}
+
+	m := ctx.Module().(*Module)
+	props := struct {
+		Name                 *string
+		Static_libs          []string
+		Shared_libs          []string
+		Host_supported       *bool
+		Device_supported     *bool
+		Harness_entry_points []string
+		Harness_headers      []string
+	}{
+		Name:                 StringPtr(ctx.ModuleName() + "_fuzzer"),
+		Harness_entry_points: entryPoints,
+		Harness_headers:      library.Properties.Fuzz_entry_point_headers,
+	}
+	if library.buildStatic() {
+		props.Static_libs = []string{ctx.ModuleName()}
+	} else {
+		props.Shared_libs = []string{ctx.ModuleName()}
+	}
+	if m.HostSupported() {
+		props.Host_supported = BoolPtr(true)
+	}
+	if !m.DeviceSupported() {
+		props.Device_supported = BoolPtr(false)
+	}
+
+	ctx.CreateModule(fuzzHarnessFactory, &props)
+}
+
+// fuzzHarnessSource returns the source of a fuzzer that includes the headers and calls each of the
+// entry points with the input of the fuzzer.
+func fuzzHarnessSource(moduleName string, headers, entryPoints []string) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "// Generated by Soong for %s, do not edit.\n\n", moduleName)
+	sb.WriteString("#include <stddef.h>\n#include <stdint.h>\n\n")
+	for _, header := range headers {
+		fmt.Fprintf(sb, "#include <%s>\n", header)
+	}
+	sb.WriteString("\nextern \"C\" int LLVMFuzzerTestOneInput(const uint8_t* data, size_t size) {\n")
+	for _, entryPoint := range entryPoints {
+		fmt.Fprintf(sb, "  %s(data, size);\n", entryPoint)
+	}
+	sb.WriteString("  return 0;\n}\n")
+	return sb.String()
+}
+
+func (fuzz *fuzzBinary) compile(ctx ModuleContext, flags Flags, deps PathDeps) Objects {
+	if entryPoints := fuzz.harnessProperties.Harness_entry_points; len(entryPoints) > 0 {
+		src := android.PathForModuleGen(ctx, "fuzz_harness", ctx.ModuleName()+".cpp")
+		android.WriteFileRule(ctx, src,
+			fuzzHarnessSource(ctx.ModuleName(), fuzz.harnessProperties.Harness_headers, entryPoints))
+		fuzz.baseCompiler.srcsBeforeGen = append(fuzz.baseCompiler.srcsBeforeGen, src)
+	}
+	return fuzz.baseCompiler.compile(ctx, flags, deps)
+}
@@ -113,6 +113,17 @@ type LibraryProperties struct {
 
 		// Extra flags passed to header-abi-diff
 		Diff_flags []string
+
+		// Directories, relative to the module directory, containing the reference ABI dumps to
+		// compare the ABI dump of the library against, in <dir>/<arch>/<library>.so.lsdump (or
+		// .lsdump.gz). The ABI dump is compared against each of them. Defaults to the reference
+		// ABI dumps in prebuilts/abi-dumps.
+		Ref_dump_dirs []string
+
+		// If true, check that the defines in export_cflags of a library with stubs do not change the
+		// ABI of its exported headers, e.g. by changing the layout of exported structs, as the library
+		// itself is compiled without them. Defaults to false.
+		Check_exported_flags *bool
 	}
 
 	// Inject boringssl hash into the shared library.  This is only intended for use by external/boringssl.
@@ -124,6 +135,15 @@ type LibraryProperties struct {
 
 	// If this is a vendor public library, properties to describe the vendor public library stubs.
 	Vendor_public_library vendorPublicLibraryProperties
+
+	// Names of functions of the library with the signature `f(const uint8_t* data, size_t size)`
+	// that parse untrusted input. If set, a cc_fuzz module named <name>_fuzzer is generated whose
+	// source calls each of them with the input of the fuzzer.
+	Fuzz_entry_points []string
+
+	// Exported headers that declare the fuzz_entry_points, which are included by the generated
+	// source of the fuzzer, e.g. "foo/parser.h".
+	Fuzz_entry_point_headers []string
 }
 
 // StaticProperties is a properties stanza to affect only attributes of the "static" variants of a
@@ -617,8 +637,15 @@ type libraryDecorator struct {
 	// linked Source Abi Dump
 	sAbiOutputFile android.OptionalPath
 
-	// Source Abi Diff
-	sAbiDiff android.OptionalPath
+	// Source Abi Diffs against each reference ABI dump
+	sAbiDiff android.Paths
+
+	// Source ABI dumps of the exported headers compiled with and without the exported defines.
+	exportedFlagsSAbiDump android.OptionalPath
+	libraryFlagsSAbiDump  android.OptionalPath
+
+	// Location of the ABI diff between exportedFlagsSAbiDump and libraryFlagsSAbiDump.
+	exportedFlagsSAbiDiff android.OptionalPath
 
 	// Location of the static library in the sysroot. Empty if the library is
 	// not included in the NDK.
@@ -1101,6 +1128,10 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 	library.reuseObjects = objs
 	buildFlags := flagsToBuilderFlags(flags)
 
+	if library.shared() && flags.SAbiDump {
+		library.dumpExportedHeadersWithExportedFlags(ctx, buildFlags)
+	}
+
 	if library.static() {
 		srcs := android.PathsForModuleSrc(ctx, library.StaticProperties.Static.Srcs)
 		objs = objs.Append(compileObjs(ctx, buildFlags, android.DeviceStaticLibrary, srcs,
@@ -1562,6 +1593,15 @@ func (library *libraryDecorator) linkShared(ctx ModuleContext,
 		Target:                               ctx.Target(),
 	})
 
+	library.setSharedLibraryStubsProvider(ctx)
+
+	return unstrippedOutputFile
+}
+
+// setSharedLibraryStubsProvider provides the stubs variants of the implementation variant of a
+// shared library to the modules that depend on it, which choose between them and the
+// implementation variant in ChooseStubOrImpl.
+func (library *libraryDecorator) setSharedLibraryStubsProvider(ctx ModuleContext) {
 	stubs := ctx.GetDirectDepsWithTag(stubImplDepTag)
 	if len(stubs) > 0 {
 		var stubsInfo []SharedStubLibrary
@@ -1580,8 +1620,6 @@ func (library *libraryDecorator) linkShared(ctx ModuleContext,
 			IsLLNDK: ctx.IsLlndk(),
 		})
 	}
-
-	return unstrippedOutputFile
 }
 
 func (library *libraryDecorator) unstrippedOutputFilePath() android.Path {
@@ -1603,27 +1641,65 @@ func (library *libraryDecorator) coverageOutputFilePath() android.OptionalPath {
 	return library.coverageOutputFile
 }
 
-func getRefAbiDumpFile(ctx ModuleContext, vndkVersion, fileName string) android.Path {
-	// The logic must be consistent with classifySourceAbiDump.
-	isNdk := ctx.isNdk(ctx.Config())
-	isLlndkOrVndk := ctx.IsLlndkPublic() || (ctx.useVndk() && ctx.isVndk())
+// refAbiDump is a reference ABI dump that the linked ABI dump of a library is compared against.
+type refAbiDump struct {
+	// The path of the reference ABI dump relative to the root of the source tree, whether or not
+	// it exists.
+	srcPath string
 
-	refAbiDumpTextFile := android.PathForVndkRefAbiDump(ctx, vndkVersion, fileName, isNdk, isLlndkOrVndk, false)
-	refAbiDumpGzipFile := android.PathForVndkRefAbiDump(ctx, vndkVersion, fileName, isNdk, isLlndkOrVndk, true)
+	// The uncompressed reference ABI dump, or nil if it doesn't exist.
+	dump android.Path
 
-	if refAbiDumpTextFile.Valid() {
-		if refAbiDumpGzipFile.Valid() {
+	// The suffix of the names of the outputs of the comparison, to tell apart multiple reference ABI
+	// dumps.
+	nameSuffix string
+}
+
+// findRefAbiDump returns the reference ABI dump stored in either the text or the gzip format. When
+// neither exists the text format path is returned, so that the update mode can create it.
+func findRefAbiDump(ctx ModuleContext, textPath, gzipPath, baseName string) refAbiDump {
+	textFile := android.ExistentPathForSource(ctx, textPath)
+	gzipFile := android.ExistentPathForSource(ctx, gzipPath)
+
+	if textFile.Valid() {
+		if gzipFile.Valid() {
 			ctx.ModuleErrorf(
 				"Two reference ABI dump files are found: %q and %q. Please delete the stale one.",
-				refAbiDumpTextFile, refAbiDumpGzipFile)
-			return nil
+				textFile, gzipFile)
+			return refAbiDump{srcPath: textPath}
 		}
-		return refAbiDumpTextFile.Path()
+		return refAbiDump{srcPath: textPath, dump: textFile.Path()}
 	}
-	if refAbiDumpGzipFile.Valid() {
-		return unzipRefDump(ctx, refAbiDumpGzipFile.Path(), fileName)
+	if gzipFile.Valid() {
+		return refAbiDump{srcPath: gzipPath, dump: unzipRefDump(ctx, gzipFile.Path(), baseName)}
 	}
-	return nil
+	return refAbiDump{srcPath: textPath}
+}
+
+// getRefAbiDumps returns the reference ABI dumps that the linked ABI dump of the library is
+// compared against.
+func (library *libraryDecorator) getRefAbiDumps(ctx ModuleContext, vndkVersion, fileName string) []refAbiDump {
+	if dirs := library.Properties.Header_abi_checker.Ref_dump_dirs; len(dirs) > 0 {
+		var refs []refAbiDump
+		for _, dir := range dirs {
+			dir = filepath.Clean(dir)
+			nameSuffix := "." + strings.ReplaceAll(dir, "/", "_")
+			textPath := filepath.Join(ctx.ModuleDir(), dir, ctx.Arch().ArchType.String(), fileName+".lsdump")
+			ref := findRefAbiDump(ctx, textPath, textPath+".gz", fileName+nameSuffix)
+			ref.nameSuffix = nameSuffix
+			refs = append(refs, ref)
+		}
+		return refs
+	}
+
+	// The logic must be consistent with classifySourceAbiDump.
+	isNdk := ctx.isNdk(ctx.Config())
+	isLlndkOrVndk := ctx.IsLlndkPublic() || (ctx.useVndk() && ctx.isVndk())
+
+	return []refAbiDump{findRefAbiDump(ctx,
+		android.VndkRefAbiDumpPath(ctx, vndkVersion, fileName, isNdk, isLlndkOrVndk, false),
+		android.VndkRefAbiDumpPath(ctx, vndkVersion, fileName, isNdk, isLlndkOrVndk, true),
+		fileName)}
 }
 
 func (library *libraryDecorator) linkSAbiDumpFiles(ctx ModuleContext, objs Objects, fileName string, soFile android.Path) {
@@ -1654,17 +1730,86 @@ func (library *libraryDecorator) linkSAbiDumpFiles(ctx ModuleContext, objs Objec
 
 		addLsdumpPath(classifySourceAbiDump(ctx) + ":" + library.sAbiOutputFile.String())
 
-		refAbiDumpFile := getRefAbiDumpFile(ctx, vndkVersion, fileName)
-		if refAbiDumpFile != nil {
-			library.sAbiDiff = sourceAbiDiff(ctx, library.sAbiOutputFile.Path(),
-				refAbiDumpFile, fileName, exportedHeaderFlags,
-				library.Properties.Header_abi_checker.Diff_flags,
-				Bool(library.Properties.Header_abi_checker.Check_all_apis),
-				ctx.IsLlndk(), ctx.isNdk(ctx.Config()), ctx.IsVndkExt())
+		updateRefDumps := ctx.Config().IsEnvTrue(updateAbiReferenceDumpsEnv)
+		for _, ref := range library.getRefAbiDumps(ctx, vndkVersion, fileName) {
+			if updateRefDumps {
+				ctx.Phony(updateAbiReferenceDumpsPhony,
+					updateRefDump(ctx, library.sAbiOutputFile.Path(), ref.srcPath))
+			} else if ref.dump != nil {
+				library.sAbiDiff = append(library.sAbiDiff, sourceAbiDiff(ctx, library.sAbiOutputFile.Path(),
+					ref.dump, ref.srcPath, fileName, ref.nameSuffix, exportedHeaderFlags,
+					library.Properties.Header_abi_checker.Diff_flags,
+					Bool(library.Properties.Header_abi_checker.Check_all_apis),
+					ctx.IsLlndk(), ctx.IsVndkExt()))
+			}
+		}
+
+		if library.exportedFlagsSAbiDump.Valid() && library.libraryFlagsSAbiDump.Valid() {
+			libraryFlagsLinkedDump := transformDumpToLinkedDump(ctx,
+				android.Paths{library.libraryFlagsSAbiDump.Path()}, soFile, fileName+".library_flags",
+				exportedHeaderFlags, android.OptionalPath{}, nil, nil)
+			exportedFlagsLinkedDump := transformDumpToLinkedDump(ctx,
+				android.Paths{library.exportedFlagsSAbiDump.Path()}, soFile, fileName+".exported_flags",
+				exportedHeaderFlags, android.OptionalPath{}, nil, nil)
+			library.exportedFlagsSAbiDiff = sourceAbiExportedFlagsDiff(ctx, exportedFlagsLinkedDump.Path(),
+				libraryFlagsLinkedDump.Path(), fileName)
 		}
 	}
 }
 
+// exportedDefines returns the defines in export_cflags, which are the exported flags that may
+// change the ABI of the exported headers.
+func (library *libraryDecorator) exportedDefines() []string {
+	var defines []string
+	for _, flag := range library.flagExporter.Properties.Export_cflags {
+		if strings.HasPrefix(flag, "-D") || strings.HasPrefix(flag, "-U") {
+			defines = append(defines, flag)
+		}
+	}
+	return defines
+}
+
+// dumpExportedHeadersWithExportedFlags dumps the ABI of the exported headers of a library with
+// stubs twice, once as seen by the library itself and once with the defines the library exports to
+// its users, so that linkSAbiDumpFiles can check that they match.
+func (library *libraryDecorator) dumpExportedHeadersWithExportedFlags(ctx ModuleContext, flags builderFlags) {
+	if !library.hasStubsVariants() || !Bool(library.Properties.Header_abi_checker.Check_exported_flags) {
+		return
+	}
+	exportedDefines := library.exportedDefines()
+	if len(exportedDefines) == 0 {
+		return
+	}
+
+	// Create a source file that includes every exported header.
+	var includes []string
+	for _, dir := range library.flagExporter.exportedIncludes(ctx) {
+		for _, header := range ctx.GlobFiles(filepath.Join(dir.String(), "**/*.h"), nil) {
+			rel, err := filepath.Rel(dir.String(), header.String())
+			if err != nil {
+				ctx.ModuleErrorf("filepath.Rel(%q, %q) failed: %s", dir, header, err)
+				continue
+			}
+			includes = append(includes, fmt.Sprintf("#include %q", rel))
+		}
+	}
+	if len(includes) == 0 {
+		return
+	}
+	src := android.PathForModuleOut(ctx, "exported_flags_abi", "exported_headers.cpp")
+	android.WriteFileRule(ctx, src, strings.Join(android.SortedUniqueStrings(includes), "\n"))
+
+	libraryFlagsDump := android.PathForModuleOut(ctx, "exported_flags_abi", "library_flags.sdump")
+	transformHeadersToSAbiDump(ctx, src, flags, nil, libraryFlagsDump,
+		library.baseCompiler.pathDeps, library.baseCompiler.cFlagsDeps)
+	library.libraryFlagsSAbiDump = android.OptionalPathForPath(libraryFlagsDump)
+
+	exportedFlagsDump := android.PathForModuleOut(ctx, "exported_flags_abi", "exported_flags.sdump")
+	transformHeadersToSAbiDump(ctx, src, flags, exportedDefines, exportedFlagsDump,
+		library.baseCompiler.pathDeps, library.baseCompiler.cFlagsDeps)
+	library.exportedFlagsSAbiDump = android.OptionalPathForPath(exportedFlagsDump)
+}
+
 func processLLNDKHeaders(ctx ModuleContext, srcHeaderDir string, outDir android.ModuleGenPath) (timestamp android.Path, installPaths android.WritablePaths) {
 	srcDir := android.PathForModuleSrc(ctx, srcHeaderDir)
 	srcFiles := ctx.GlobFiles(filepath.Join(srcDir.String(), "**/*.h"), nil)
@@ -2169,6 +2314,10 @@ func NewLibrary(hod android.HostOrDeviceSupported) (*Module, *libraryDecorator)
 	module.installer = library
 	module.library = library
 
+	android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+		library.createFuzzHarness(ctx)
+	})
+
 	return module, library
 }
 
@@ -370,10 +370,13 @@ func addPossiblyArchSpecificProperties(sdkModuleContext android.ModuleContext, b
 			// header files they end up in the same place in the snapshot and so do not get duplicated.
 			targetRelativePath := inputPath
 			if isGeneratedHeaderDirectory(path) {
-				// Remove everything up to the .intermediates/ from the generated output directory to
-				// leave a module relative path.
-				base := android.PathForIntermediates(sdkModuleContext, "")
-				targetRelativePath = android.Rel(sdkModuleContext, base.String(), inputPath)
+				// Remove everything up to the intermediates directory from the generated output
+				// directory to leave a module relative path.
+				rel, ok := android.RelToIntermediates(sdkModuleContext, inputPath)
+				if !ok {
+					android.ReportPathErrorf(sdkModuleContext, "generated header directory %q is not in an intermediates directory", inputPath)
+				}
+				targetRelativePath = rel
 			}
 
 			snapshotRelativePath := filepath.Join(targetDir, targetRelativePath)
@@ -15,6 +15,7 @@
 package cc
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -335,6 +336,83 @@ func TestLibraryDynamicList(t *testing.T) {
 
 }
 
+func TestLibraryAbiCheckerRefDumpDirs(t *testing.T) {
+	bp := `
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.cpp"],
+			export_include_dirs: ["include"],
+			header_abi_checker: {
+				enabled: true,
+				ref_dump_dirs: [
+					"abi/current",
+					"abi/prev",
+				],
+			},
+		}`
+	preparer := android.GroupFixturePreparers(
+		PrepareForIntegrationTestWithCc,
+		android.FixtureMergeMockFs(android.MockFS{
+			"foo/foo.cpp":                            nil,
+			"foo/include/foo.h":                      nil,
+			"foo/abi/current/arm64/libfoo.so.lsdump": nil,
+			"foo/abi/prev/arm64/libfoo.so.lsdump.gz": nil,
+		}),
+		android.FixtureAddTextFile("foo/Android.bp", bp),
+	)
+
+	t.Run("check", func(t *testing.T) {
+		result := preparer.RunTest(t)
+		libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+		current := libfoo.Output("libfoo.so.abi_current.abidiff")
+		android.AssertPathsRelativeToTopEquals(t, "current reference dump",
+			[]string{"foo/abi/current/arm64/libfoo.so.lsdump"}, current.Implicits)
+		android.AssertStringEquals(t, "current reference source path",
+			"foo/abi/current/arm64/libfoo.so.lsdump", current.Args["referenceSrcPath"])
+
+		prev := libfoo.Output("libfoo.so.abi_prev.abidiff")
+		android.AssertPathsRelativeToTopEquals(t, "prev reference dump",
+			[]string{"out/soong/.intermediates/foo/libfoo/android_arm64_armv8-a_shared/libfoo.so.abi_prev_ref.lsdump"},
+			prev.Implicits)
+		android.AssertStringEquals(t, "prev reference source path",
+			"foo/abi/prev/arm64/libfoo.so.lsdump.gz", prev.Args["referenceSrcPath"])
+
+		// There is no reference dump for arm.
+		libfooArm := result.ModuleForTests("libfoo", "android_arm_armv7-a-neon_shared")
+		if libfooArm.MaybeOutput("libfoo.so.abi_current.abidiff").Rule != nil {
+			t.Errorf("expected no ABI diff for arm")
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		result := android.GroupFixturePreparers(
+			preparer,
+			android.FixtureMergeEnv(map[string]string{
+				"UPDATE_ABI_REFERENCE_DUMPS": "true",
+			}),
+		).RunTest(t)
+		libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+		if libfoo.MaybeOutput("libfoo.so.abi_current.abidiff").Rule != nil {
+			t.Errorf("expected no ABI diff in update mode")
+		}
+
+		current := libfoo.Output("out/soong/abi-reference-dumps/foo/abi/current/arm64/libfoo.so.lsdump")
+		if current.Rule != android.Cp {
+			t.Errorf("expected the current reference dump to be copied, got %q", current.Rule.String())
+		}
+		prev := libfoo.Output("out/soong/abi-reference-dumps/foo/abi/prev/arm64/libfoo.so.lsdump.gz")
+		if prev.Rule != zipRefSAbiDump {
+			t.Errorf("expected the prev reference dump to be compressed, got %q", prev.Rule.String())
+		}
+
+		// The reference dump for arm is created.
+		libfooArm := result.ModuleForTests("libfoo", "android_arm_armv7-a-neon_shared")
+		libfooArm.Output("out/soong/abi-reference-dumps/foo/abi/current/arm/libfoo.so.lsdump")
+	})
+}
+
 func TestCcLibrarySharedWithBazel(t *testing.T) {
 	bp := `
 cc_library_shared {
@@ -453,3 +531,70 @@ func TestWholeStaticLibPrebuilts(t *testing.T) {
 	android.AssertStringDoesContain(t, "missing flag for baz.o",
 		libtransitiveWithSrcs.Args["arObjs"], bazObj.Output.String())
 }
+
+func TestLibraryAbiCheckerExportedFlags(t *testing.T) {
+	bp := `
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.cpp"],
+			export_include_dirs: ["include"],
+			export_cflags: ["-DFOO_ABI=2", "-fexported-flag-test"],
+			stubs: {
+				versions: ["1"],
+			},
+			header_abi_checker: {
+				enabled: true,
+				check_exported_flags: %t,
+			},
+		}`
+	preparer := func(checkExportedFlags bool) android.FixturePreparer {
+		return android.GroupFixturePreparers(
+			PrepareForIntegrationTestWithCc,
+			android.FixtureMergeMockFs(android.MockFS{
+				"foo/foo.cpp":           nil,
+				"foo/include/foo.h":     nil,
+				"foo/include/sub/bar.h": nil,
+			}),
+			android.FixtureAddTextFile("foo/Android.bp", fmt.Sprintf(bp, checkExportedFlags)),
+		)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		result := preparer(false).RunTest(t)
+		libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+		if libfoo.MaybeOutput("libfoo.so.exported_flags.abidiff").Rule != nil {
+			t.Errorf("expected no exported flags ABI diff when check_exported_flags is not set")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		result := preparer(true).RunTest(t)
+		libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+		src := libfoo.Output("exported_flags_abi/exported_headers.cpp")
+		android.AssertStringEquals(t, "exported headers source", "#include \"foo.h\"\n#include \"sub/bar.h\"",
+			android.ContentFromFileRuleForTests(t, src))
+
+		libraryFlagsDump := libfoo.Output("exported_flags_abi/library_flags.sdump")
+		android.AssertPathRelativeToTopEquals(t, "library flags dump input",
+			"out/soong/.intermediates/foo/libfoo/android_arm64_armv8-a_shared/exported_flags_abi/exported_headers.cpp",
+			libraryFlagsDump.Input)
+		android.AssertStringDoesNotContain(t, "library flags dump cFlags",
+			libraryFlagsDump.Args["cFlags"], "-DFOO_ABI=2")
+
+		// Only the defines are added to the exported flags dump.
+		exportedFlagsDump := libfoo.Output("exported_flags_abi/exported_flags.sdump")
+		android.AssertStringDoesContain(t, "exported flags dump cFlags",
+			exportedFlagsDump.Args["cFlags"], "-DFOO_ABI=2")
+		android.AssertStringDoesNotContain(t, "exported flags dump cFlags",
+			exportedFlagsDump.Args["cFlags"], "-fexported-flag-test")
+
+		diff := libfoo.Output("libfoo.so.exported_flags.abidiff")
+		android.AssertPathRelativeToTopEquals(t, "exported flags diff input",
+			"out/soong/.intermediates/foo/libfoo/android_arm64_armv8-a_shared/libfoo.so.exported_flags.lsdump",
+			diff.Input)
+		android.AssertStringEquals(t, "exported flags diff reference",
+			"out/soong/.intermediates/foo/libfoo/android_arm64_armv8-a_shared/libfoo.so.library_flags.lsdump",
+			android.StringRelativeToTop(result.Config, diff.Args["referenceDump"]))
+	})
+}
@@ -227,6 +227,10 @@ type BaseLinkerProperties struct {
 	// local file name to pass to the linker as --dynamic-list
 	Dynamic_list *string `android:"path,arch_variant"`
 
+	// list of local linker scripts to pass to the linker with -T. The module is relinked when one
+	// of them or one of the files they include with INCLUDE changes.
+	Linker_scripts []string `android:"path,arch_variant"`
+
 	// list of static libs that should not be used to build this module
 	Exclude_static_libs []string `android:"arch_variant"`
 
@@ -604,6 +608,17 @@ func (linker *baseLinker) linkerFlags(ctx ModuleContext, flags Flags) Flags {
 		}
 	}
 
+	if len(linker.Properties.Linker_scripts) > 0 {
+		if ctx.Darwin() {
+			ctx.PropertyErrorf("linker_scripts", "Not supported on Darwin")
+		} else {
+			linkerScripts := android.PathsForModuleSrc(ctx, linker.Properties.Linker_scripts)
+			ldFlags, deps := linkerScriptFlags(ctx, "linker_scripts", linkerScripts)
+			flags.Local.LdFlags = append(flags.Local.LdFlags, ldFlags...)
+			flags.LdFlagsDeps = append(flags.LdFlagsDeps, deps...)
+		}
+	}
+
 	return flags
 }
 
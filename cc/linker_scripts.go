@@ -0,0 +1,122 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"android/soong/android"
+)
+
+// This file contains the support for the linker_scripts property, which passes linker scripts to
+// the linker with -T and makes the link depend on them and on the files they include with the
+// INCLUDE command, so that the module is relinked when any of them changes, e.g.
+//
+//	cc_binary {
+//	    name: "foo",
+//	    linker_scripts: ["foo.lds"],
+//	}
+//
+// The linker looks up an included file relative to the current directory, i.e. the root of the
+// source tree, and then in the library search paths, so a file that is found next to the
+// including script is only found by the linker because the directory of the script is added to
+// the library search paths.
+
+var (
+	// linkerScriptCommentRegexp matches the C style comments of a linker script.
+	linkerScriptCommentRegexp = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+	// linkerScriptIncludeRegexp matches the INCLUDE commands of a linker script, with the included
+	// file in the first submatch if it is quoted and in the second one otherwise.
+	linkerScriptIncludeRegexp = regexp.MustCompile(`\bINCLUDE\s+(?:"([^"]+)"|([^\s;"]+))`)
+)
+
+// parseLinkerScriptIncludes returns the files included by the INCLUDE commands of the contents of
+// a linker script.
+func parseLinkerScriptIncludes(contents string) []string {
+	contents = linkerScriptCommentRegexp.ReplaceAllString(contents, "")
+	var includes []string
+	for _, match := range linkerScriptIncludeRegexp.FindAllStringSubmatch(contents, -1) {
+		if match[1] != "" {
+			includes = append(includes, match[1])
+		} else {
+			includes = append(includes, match[2])
+		}
+	}
+	return includes
+}
+
+// linkerScriptFlags returns the linker flags that pass the linker scripts to the linker, and the
+// linker scripts and the files they include, which the link depends on. It reports an error if a
+// linker script includes a file that does not exist.
+func linkerScriptFlags(ctx ModuleContext, property string, linkerScripts android.Paths) ([]string, android.Paths) {
+	var flags []string
+	var deps android.Paths
+	var searchDirs []string
+	seen := make(map[string]bool)
+
+	var visit func(script android.Path)
+	visit = func(script android.Path) {
+		if seen[script.String()] {
+			return
+		}
+		seen[script.String()] = true
+		deps = append(deps, script)
+
+		// A missing linker script has already been reported by PathsForModuleSrc.
+		if exists, _, _ := ctx.Config().Fs().Exists(script.String()); !exists {
+			return
+		}
+		// Soong reruns when the script changes, as its includes may have changed.
+		ctx.AddNinjaFileDeps(script.String())
+		r, err := ctx.Config().Fs().Open(script.String())
+		if err != nil {
+			ctx.PropertyErrorf(property, "failed to open linker script %q: %s", script, err)
+			return
+		}
+		contents, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			ctx.PropertyErrorf(property, "failed to read linker script %q: %s", script, err)
+			return
+		}
+
+		scriptDir := filepath.Dir(script.String())
+		for _, include := range parseLinkerScriptIncludes(string(contents)) {
+			if path := android.ExistentPathForSource(ctx, include); path.Valid() {
+				visit(path.Path())
+			} else if path := android.ExistentPathForSource(ctx, scriptDir, include); path.Valid() {
+				if !android.InList(scriptDir, searchDirs) {
+					searchDirs = append(searchDirs, scriptDir)
+				}
+				visit(path.Path())
+			} else {
+				ctx.PropertyErrorf(property, "linker script %q includes %q, which does not exist",
+					script, include)
+			}
+		}
+	}
+
+	for _, script := range linkerScripts {
+		flags = append(flags, "-Wl,-T,"+script.String())
+		visit(script)
+	}
+	for _, dir := range searchDirs {
+		flags = append(flags, "-Wl,-L,"+dir)
+	}
+	return flags, deps
+}
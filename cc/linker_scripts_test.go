@@ -0,0 +1,104 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"reflect"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestParseLinkerScriptIncludes(t *testing.T) {
+	includes := parseLinkerScriptIncludes(`
+		/* INCLUDE commented.lds */
+		INCLUDE common/sections.lds
+		SECTIONS {
+			INCLUDE "memory map.lds";
+		}
+		NOT_AN_INCLUDE other.lds
+	`)
+	expected := []string{"common/sections.lds", "memory map.lds"}
+	if !reflect.DeepEqual(includes, expected) {
+		t.Errorf("expected includes %q, got %q", expected, includes)
+	}
+}
+
+func TestLinkerScripts(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForIntegrationTestWithCc,
+		android.FixtureMergeMockFs(android.MockFS{
+			"lds/foo.lds":         []byte("INCLUDE common/sections.lds\nINCLUDE memory.lds\n"),
+			"lds/memory.lds":      []byte("MEMORY {}\n"),
+			"common/sections.lds": []byte("INCLUDE lds/memory.lds\n"),
+		}),
+	).RunTestWithBp(t, `
+		cc_binary {
+			name: "foo",
+			srcs: ["foo.c"],
+			linker_scripts: ["lds/foo.lds"],
+		}`)
+
+	foo := result.ModuleForTests("foo", "android_arm64_armv8-a").Rule("ld")
+
+	for _, script := range []string{"lds/foo.lds", "common/sections.lds", "lds/memory.lds"} {
+		android.AssertStringListContains(t, "missing dependency on linker script",
+			foo.Implicits.Strings(), script)
+	}
+	android.AssertStringDoesContain(t, "missing flag for linker_scripts",
+		foo.Args["ldFlags"], "-Wl,-T,lds/foo.lds")
+	android.AssertStringDoesNotContain(t, "included linker scripts are passed with -T",
+		foo.Args["ldFlags"], "-Wl,-T,lds/memory.lds")
+	android.AssertStringDoesContain(t, "missing search path for the includes of linker_scripts",
+		foo.Args["ldFlags"], "-Wl,-L,lds")
+}
+
+func TestLinkerScriptsMissingFiles(t *testing.T) {
+	testCases := []struct {
+		name  string
+		fs    android.MockFS
+		error string
+	}{
+		{
+			name:  "missing linker script",
+			fs:    android.MockFS{},
+			error: `module source path "lds/foo.lds" does not exist`,
+		},
+		{
+			name: "missing include",
+			fs: android.MockFS{
+				"lds/foo.lds": []byte("INCLUDE missing.lds\n"),
+			},
+			error: `linker script "lds/foo.lds" includes "missing.lds", which does not exist`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			android.GroupFixturePreparers(
+				PrepareForIntegrationTestWithCc,
+				android.PrepareForTestDisallowNonExistentPaths,
+				android.FixtureMergeMockFs(android.MockFS{"foo.c": nil}),
+				android.FixtureMergeMockFs(tc.fs),
+			).ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(tc.error)).
+				RunTestWithBp(t, `
+				cc_binary {
+					name: "foo",
+					srcs: ["foo.c"],
+					linker_scripts: ["lds/foo.lds"],
+				}`)
+		})
+	}
+}
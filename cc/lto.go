@@ -53,6 +53,10 @@ type LTOProperties struct {
 	ThinDep  bool `blueprint:"mutated"`
 	NoLtoDep bool `blueprint:"mutated"`
 
+	// RustCrossLanguageLTO indicates that this module needs to be built with ThinLTO since it
+	// links Rust static libraries compiled to LLVM bitcode, see rust/lto.go.
+	RustCrossLanguageLTO bool `blueprint:"mutated"`
+
 	// Use clang lld instead of gnu ld.
 	Use_clang_lld *bool
 
@@ -155,7 +159,7 @@ func (lto *lto) FullLTO() bool {
 }
 
 func (lto *lto) ThinLTO() bool {
-	return lto != nil && Bool(lto.Properties.Lto.Thin)
+	return lto != nil && (Bool(lto.Properties.Lto.Thin) || lto.Properties.RustCrossLanguageLTO)
 }
 
 func (lto *lto) Never() bool {
@@ -166,11 +170,39 @@ func GlobalThinLTO(ctx android.BaseModuleContext) bool {
 	return ctx.Config().IsEnvTrue("GLOBAL_THINLTO")
 }
 
+// linksRustCrossLanguageLTOLibs returns true if a module that is linked links a Rust static library
+// that is compiled to LLVM bitcode when the RustCrossLanguageLto product variable is set.
+func linksRustCrossLanguageLTOLibs(mctx android.TopDownMutatorContext, m *Module) bool {
+	if !mctx.Config().RustCrossLanguageLTO() || !m.Device() || m.Static() || m.Header() || m.Object() {
+		return false
+	}
+	found := false
+	mctx.WalkDeps(func(dep android.Module, parent android.Module) bool {
+		if libTag, ok := mctx.OtherModuleDependencyTag(dep).(libraryDependencyTag); !ok || !libTag.static() {
+			return false
+		}
+		if _, isCc := dep.(*Module); !isCc {
+			if linkable, ok := dep.(LinkableInterface); ok && linkable.Static() {
+				found = true
+			}
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
 // Propagate lto requirements down from binaries
 func ltoDepsMutator(mctx android.TopDownMutatorContext) {
 	globalThinLTO := GlobalThinLTO(mctx)
 
 	if m, ok := mctx.Module().(*Module); ok {
+		// Modules that link Rust static libraries compiled to LLVM bitcode use ThinLTO, so that
+		// their C/C++ code is optimized together with the Rust code.
+		if m.lto != nil && !m.lto.FullLTO() && !m.lto.Never() && linksRustCrossLanguageLTOLibs(mctx, m) {
+			m.lto.Properties.RustCrossLanguageLTO = true
+		}
+
 		full := m.lto.FullLTO()
 		thin := m.lto.ThinLTO()
 		never := m.lto.Never()
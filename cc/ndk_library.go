@@ -147,6 +147,9 @@ func ndkLibraryVersions(ctx android.BaseMutatorContext, from android.ApiLevel) [
 			versionStrs = append(versionStrs, version.String())
 		}
 	}
+	if draft := ctx.Config().NdkDraftApiLevel(); !draft.IsNone() && draft.GreaterThanOrEqualTo(from) {
+		versionStrs = append(versionStrs, draft.String())
+	}
 	versionStrs = append(versionStrs, android.FutureApiLevel.String())
 
 	return versionStrs
@@ -468,7 +471,7 @@ func (c *stubDecorator) compile(ctx ModuleContext, flags Flags, deps PathDeps) O
 	nativeAbiResult := parseNativeAbiDefinition(ctx, symbolFile, c.apiLevel, "")
 	objs := compileStubLibrary(ctx, flags, nativeAbiResult.stubSrc)
 	c.versionScriptPath = nativeAbiResult.versionScript
-	if canDumpAbi(ctx.Config()) {
+	if canDumpAbi(ctx.Config()) && c.apiLevel != ctx.Config().NdkDraftApiLevel() {
 		c.dumpAbi(ctx, nativeAbiResult.symbolList)
 		if canDiffAbi() {
 			c.diffAbi(ctx)
@@ -516,6 +519,11 @@ func (stub *stubDecorator) nativeCoverage() bool {
 }
 
 func (stub *stubDecorator) install(ctx ModuleContext, path android.Path) {
+	// The draft API level may still change, don't ship its stubs in the NDK.
+	if stub.apiLevel == ctx.Config().NdkDraftApiLevel() {
+		return
+	}
+
 	arch := ctx.Target().Arch.ArchType.Name
 	// arm64 isn't actually a multilib toolchain, so unlike the other LP64
 	// architectures it's just installed to lib.
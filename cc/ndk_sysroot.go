@@ -129,7 +129,7 @@ func (n *ndkSingleton) GenerateBuildActions(ctx android.SingletonContext) {
 		}
 
 		if m, ok := module.(*Module); ok {
-			if installer, ok := m.installer.(*stubDecorator); ok && m.library.buildStubs() {
+			if installer, ok := m.installer.(*stubDecorator); ok && m.library.buildStubs() && installer.installPath != nil {
 				installPaths = append(installPaths, installer.installPath)
 			}
 
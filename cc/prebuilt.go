@@ -76,15 +76,60 @@ type prebuiltLibraryInterface interface {
 	disablePrebuilt()
 }
 
+// prebuiltLibraryStubsProperties are the properties of a prebuilt library that control how its
+// stubs variants are built.
+type prebuiltLibraryStubsProperties struct {
+	Stubs struct {
+		// If true, the stubs variants of this library are compiled from stubs.symbol_file like the
+		// stubs of a source library instead of using the prebuilt, so that modules in other APEXes
+		// or in the platform can only link against the symbols listed in the symbol file rather than
+		// all the symbols exported by the prebuilt. Defaults to false, which is used by the
+		// prebuilts in module sdk snapshots whose srcs already are a stubs library.
+		Generate_from_symbol_file *bool
+	}
+}
+
 type prebuiltLibraryLinker struct {
 	*libraryDecorator
 	prebuiltLinker
+
+	stubsProperties prebuiltLibraryStubsProperties
 }
 
 var _ prebuiltLinkerInterface = (*prebuiltLibraryLinker)(nil)
 var _ prebuiltLibraryInterface = (*prebuiltLibraryLinker)(nil)
 
-func (p *prebuiltLibraryLinker) linkerInit(ctx BaseModuleContext) {}
+func (p *prebuiltLibraryLinker) linkerInit(ctx BaseModuleContext) {
+	if p.buildGeneratedStubs() {
+		p.libraryDecorator.linkerInit(ctx)
+	}
+}
+
+// generatesStubsFromSymbolFile returns true if the stubs variants of this library are compiled
+// from stubs.symbol_file.
+func (p *prebuiltLibraryLinker) generatesStubsFromSymbolFile() bool {
+	return Bool(p.stubsProperties.Stubs.Generate_from_symbol_file)
+}
+
+// buildGeneratedStubs returns true if this is a stubs variant that is compiled from
+// stubs.symbol_file.
+func (p *prebuiltLibraryLinker) buildGeneratedStubs() bool {
+	return p.buildStubs() && p.generatesStubsFromSymbolFile()
+}
+
+// linkGeneratedStubs compiles the stubs variant from stubs.symbol_file and links it like the
+// stubs variant of a source library.
+func (p *prebuiltLibraryLinker) linkGeneratedStubs(ctx ModuleContext,
+	flags Flags, deps PathDeps) android.Path {
+
+	flags = p.libraryDecorator.compilerFlags(ctx, flags, deps)
+	flags = p.libraryDecorator.linkerFlags(ctx, flags)
+	objs := p.libraryDecorator.compile(ctx, flags, deps)
+	if ctx.Failed() {
+		return nil
+	}
+	return p.libraryDecorator.link(ctx, flags, deps, objs)
+}
 
 func (p *prebuiltLibraryLinker) linkerDeps(ctx DepsContext, deps Deps) Deps {
 	return p.libraryDecorator.linkerDeps(ctx, deps)
@@ -101,6 +146,14 @@ func (p *prebuiltLibraryLinker) linkerProps() []interface{} {
 func (p *prebuiltLibraryLinker) link(ctx ModuleContext,
 	flags Flags, deps PathDeps, objs Objects) android.Path {
 
+	if p.generatesStubsFromSymbolFile() && p.libraryDecorator.Properties.Stubs.Symbol_file == nil {
+		ctx.PropertyErrorf("stubs.generate_from_symbol_file", "requires stubs.symbol_file to be set")
+		return nil
+	}
+	if p.buildGeneratedStubs() {
+		return p.linkGeneratedStubs(ctx, flags, deps)
+	}
+
 	p.libraryDecorator.flagExporter.exportIncludes(ctx)
 	p.libraryDecorator.flagExporter.reexportDirs(deps.ReexportedDirs...)
 	p.libraryDecorator.flagExporter.reexportSystemDirs(deps.ReexportedSystemDirs...)
@@ -189,13 +242,18 @@ func (p *prebuiltLibraryLinker) link(ctx ModuleContext,
 				TableOfContents: p.tocFile,
 			})
 
-			// TODO(b/220898484): Mainline module sdk prebuilts of stub libraries use a stub
-			// library as their source and must not be installed, but libclang_rt.* libraries
-			// have stubs because they are LLNDK libraries, but use an implementation library
-			// as their source and need to be installed.  This discrepancy should be resolved
-			// without the prefix hack below.
-			if p.hasStubsVariants() && !p.buildStubs() && !ctx.Host() &&
+			if p.generatesStubsFromSymbolFile() {
+				// The srcs are the implementation of the library, which other modules are
+				// redirected away from to the generated stubs variants when they cross an APEX
+				// boundary.
+				p.libraryDecorator.setSharedLibraryStubsProvider(ctx)
+			} else if p.hasStubsVariants() && !p.buildStubs() && !ctx.Host() &&
 				!strings.HasPrefix(ctx.baseModuleName(), "libclang_rt.") {
+				// TODO(b/220898484): Mainline module sdk prebuilts of stub libraries use a stub
+				// library as their source and must not be installed, but libclang_rt.* libraries
+				// have stubs because they are LLNDK libraries, but use an implementation library
+				// as their source and need to be installed.  This discrepancy should be resolved
+				// without the prefix hack below.
 				ctx.Module().MakeUninstallable()
 			}
 
@@ -261,7 +319,7 @@ func NewPrebuiltLibrary(hod android.HostOrDeviceSupported, srcsProperty string)
 	module.linker = prebuilt
 	module.library = prebuilt
 
-	module.AddProperties(&prebuilt.properties)
+	module.AddProperties(&prebuilt.properties, &prebuilt.stubsProperties)
 
 	if srcsProperty == "" {
 		android.InitPrebuiltModuleWithoutSrcs(module)
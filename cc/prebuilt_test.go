@@ -520,3 +520,65 @@ func TestPrebuiltStubNoinstall(t *testing.T) {
 		testFunc(t, disabledSourceStublibBp+prebuiltStublibBp+installedlibBp)
 	})
 }
+
+func TestPrebuiltLibrarySharedGeneratedStubs(t *testing.T) {
+	ctx := testPrebuilt(t, `
+		cc_prebuilt_library_shared {
+			name: "libvendorblob",
+			srcs: ["libvendorblob.so"],
+			stubs: {
+				symbol_file: "libvendorblob.map.txt",
+				versions: ["29"],
+				generate_from_symbol_file: true,
+			},
+		}
+
+		cc_library_shared {
+			name: "libclient",
+			srcs: ["client.c"],
+			shared_libs: ["libvendorblob#29"],
+		}
+	`, android.MockFS{
+		"libvendorblob.so":      nil,
+		"libvendorblob.map.txt": nil,
+	})
+
+	// The stubs variant is compiled from the symbol file rather than copied from the prebuilt.
+	stubs := ctx.ModuleForTests("libvendorblob", "android_arm64_armv8-a_shared_29")
+	genStubSrc := stubs.Rule("genStubSrc")
+	android.AssertPathRelativeToTopEquals(t, "symbol file", "libvendorblob.map.txt", genStubSrc.Input)
+	stubsLink := stubs.Rule("ld")
+	android.AssertStringDoesContain(t, "stubs ldFlags", stubsLink.Args["ldFlags"], "-Wl,--version-script,")
+
+	libFlags := ctx.ModuleForTests("libclient", "android_arm64_armv8-a_shared").Rule("ld").Args["libFlags"]
+	android.AssertStringDoesContain(t, "libclient libFlags", libFlags, stubsLink.Output.String())
+
+	// The implementation variant is the prebuilt, which remains installable and provides the stubs
+	// to the modules that depend on it.
+	impl := ctx.ModuleForTests("libvendorblob", "android_arm64_armv8-a_shared")
+	android.AssertPathRelativeToTopEquals(t, "implementation", "libvendorblob.so", impl.Module().(*Module).UnstrippedOutputFile())
+	android.AssertBoolEquals(t, "implementation installable", false, impl.Module().IsSkipInstall())
+
+	stubsInfo := ctx.ModuleProvider(impl.Module(), SharedLibraryStubsProvider).(SharedLibraryStubsInfo)
+	var versions []string
+	for _, stub := range stubsInfo.SharedStubLibraries {
+		versions = append(versions, stub.Version)
+	}
+	android.AssertDeepEquals(t, "stubs versions", []string{"29", "current"}, versions)
+}
+
+func TestPrebuiltLibrarySharedGeneratedStubsWithoutSymbolFile(t *testing.T) {
+	prepareForPrebuiltTest.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`stubs.generate_from_symbol_file: requires stubs.symbol_file to be set`)).
+		RunTestWithBp(t, `
+			cc_prebuilt_library_shared {
+				name: "libvendorblob",
+				srcs: ["libvendorblob.so"],
+				stubs: {
+					versions: ["29"],
+					generate_from_symbol_file: true,
+				},
+			}
+		`)
+}
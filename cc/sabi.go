@@ -26,6 +26,15 @@ var (
 	lsdumpPathsLock sync.Mutex
 )
 
+const (
+	// When this environment variable is true, the reference ABI dumps of the ABI checked libraries
+	// are regenerated under updateAbiReferenceDumpsDir by the updateAbiReferenceDumpsPhony goal,
+	// with the same layout as in the source tree, instead of being compared against the ABI dumps.
+	updateAbiReferenceDumpsEnv   = "UPDATE_ABI_REFERENCE_DUMPS"
+	updateAbiReferenceDumpsPhony = "update-abi-reference-dumps"
+	updateAbiReferenceDumpsDir   = "abi-reference-dumps"
+)
+
 type SAbiProperties struct {
 	// Whether ABI dump should be created for this module.
 	// Set by `sabiDepsMutator` if this module is a shared library that needs ABI check, or a static
@@ -101,3 +101,63 @@ func TestSdkMutator(t *testing.T) {
 	assertDep(t, libsdkNDK, libcxxNDK)
 	assertDep(t, libsdkPlatform, libcxxPlatform)
 }
+
+func TestNdkDraftApiLevel(t *testing.T) {
+	bp := `
+		cc_library_shared {
+			name: "libdraft",
+			srcs: ["foo.c"],
+			sdk_version: "Draft",
+			allow_draft_ndk_apis: true,
+			stl: "none",
+		}
+
+		cc_object {
+			name: "crt_draft",
+			srcs: ["foo.c"],
+			crt: true,
+			stl: "none",
+			sdk_version: "minimum",
+			min_sdk_version: "16",
+			system_shared_libs: [],
+		}
+	`
+	withDraftApiLevel := android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+		variables.Ndk_draft_api_level = StringPtr("Draft")
+	})
+
+	result := android.GroupFixturePreparers(prepareForCcTest, withDraftApiLevel).RunTestWithBp(t, bp)
+
+	android.AssertStringListContains(t, "libc.ndk variants",
+		result.ModuleVariantsForTests("libc.ndk"), "android_arm64_armv8-a_shared_Draft")
+
+	stub := result.ModuleForTests("libc.ndk", "android_arm64_armv8-a_shared_Draft")
+	android.AssertStringEquals(t, "stub api level", "Draft", stub.Rule("genStubSrc").Args["apiLevel"])
+	if installPath := stub.Module().(*Module).installer.(*stubDecorator).installPath; installPath != nil {
+		t.Errorf("expected draft stubs not to be installed in the NDK, got %q", installPath)
+	}
+
+	libdraft := result.ModuleForTests("libdraft", "android_arm64_armv8-a_sdk_shared").Module().(*Module)
+	android.AssertStringEquals(t, "libdraft sdk_version", "Draft", String(libdraft.Properties.Sdk_version))
+
+	// The crt objects have a variant for the draft API level without opting in, so that the modules
+	// that use it can link against them.
+	android.AssertStringListContains(t, "crt_draft variants",
+		result.ModuleVariantsForTests("crt_draft"), "android_arm64_armv8-a_sdk_Draft")
+	crtDraft := result.ModuleForTests("crt_draft", "android_arm64_armv8-a_sdk_Draft").Module().(*Module)
+	android.AssertStringEquals(t, "crt_draft sdk_version", "Draft", String(crtDraft.Properties.Sdk_version))
+
+	t.Run("not allowed", func(t *testing.T) {
+		android.GroupFixturePreparers(prepareForCcTest, withDraftApiLevel).
+			ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`sdk_version: "Draft" is the draft NDK API level, set allow_draft_ndk_apis: true to use it`)).
+			RunTestWithBp(t, `
+				cc_library_shared {
+					name: "libdraft",
+					srcs: ["foo.c"],
+					sdk_version: "Draft",
+					stl: "none",
+				}
+			`)
+	})
+}
@@ -18,12 +18,16 @@ package cc
 // snapshot mutators and snapshot information maps which are also defined in this file.
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"android/soong/android"
 	"android/soong/snapshot"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
 )
 
 // This interface overrides snapshot.SnapshotImage to implement cc module specific functions
@@ -75,6 +79,7 @@ func RegisterVendorSnapshotModules(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("vendor_snapshot_header", VendorSnapshotHeaderFactory)
 	ctx.RegisterModuleType("vendor_snapshot_binary", VendorSnapshotBinaryFactory)
 	ctx.RegisterModuleType("vendor_snapshot_object", VendorSnapshotObjectFactory)
+	ctx.RegisterModuleType("vendor_snapshot_manifest", SnapshotManifestFactory)
 }
 
 func RegisterRecoverySnapshotModules(ctx android.RegistrationContext) {
@@ -84,6 +89,7 @@ func RegisterRecoverySnapshotModules(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("recovery_snapshot_header", RecoverySnapshotHeaderFactory)
 	ctx.RegisterModuleType("recovery_snapshot_binary", RecoverySnapshotBinaryFactory)
 	ctx.RegisterModuleType("recovery_snapshot_object", RecoverySnapshotObjectFactory)
+	ctx.RegisterModuleType("recovery_snapshot_manifest", SnapshotManifestFactory)
 }
 
 func init() {
@@ -257,6 +263,10 @@ type BaseSnapshotDecoratorProperties struct {
 	// Suffix to be added to the module name, e.g., vendor_shared,
 	// recovery_shared, etc.
 	ModuleSuffix string `blueprint:"mutated"`
+
+	// Name of the (vendor|recovery)_snapshot_manifest module of a content-addressed snapshot.
+	// If set, src is looked up in the manifest instead of being a file in the module directory.
+	Snapshot_manifest *string
 }
 
 // BaseSnapshotDecorator provides common basic functions for all snapshot modules, such as snapshot
@@ -350,6 +360,42 @@ func (p *BaseSnapshotDecorator) SetSnapshotAndroidMkSuffix(ctx android.ModuleCon
 	p.baseProperties.Androidmk_suffix = ""
 }
 
+// AddSnapshotManifestDependency adds a dependency on the snapshot manifest module, if any, that
+// SnapshotSrcPath resolves src through.
+func (p *BaseSnapshotDecorator) AddSnapshotManifestDependency(ctx android.BottomUpMutatorContext) {
+	if manifest := p.baseProperties.Snapshot_manifest; manifest != nil {
+		ctx.AddFarVariationDependencies(nil, snapshotManifestDepTag, *manifest)
+	}
+}
+
+// SnapshotSrcPath returns the path to the prebuilt file src of the snapshot module. For modules of
+// a content-addressed snapshot, the blob src resolves to through the snapshot manifest is copied
+// to the module output directory, so that the returned file keeps the name of src.
+func (p *BaseSnapshotDecorator) SnapshotSrcPath(ctx android.ModuleContext, src string) android.Path {
+	if p.baseProperties.Snapshot_manifest == nil {
+		return android.PathForModuleSrc(ctx, src)
+	}
+
+	var ret android.Path
+	ctx.VisitDirectDepsWithTag(snapshotManifestDepTag, func(m android.Module) {
+		info := ctx.OtherModuleProvider(m, SnapshotManifestInfoProvider).(SnapshotManifestInfo)
+		digest, ok := info.Files[src]
+		if !ok {
+			ctx.PropertyErrorf("src", "%q is not listed in snapshot manifest %q", src, ctx.OtherModuleName(m))
+			return
+		}
+		out := android.PathForModuleOut(ctx, "snapshot_manifest", src)
+		ctx.Build(pctx, android.BuildParams{
+			Rule:        android.Cp,
+			Description: "snapshot blob " + src,
+			Input:       android.PathForSource(ctx, info.BlobsDir, digest),
+			Output:      out,
+		})
+		ret = out
+	})
+	return ret
+}
+
 // Call this with a module suffix after creating a snapshot module, such as
 // vendorSnapshotSharedSuffix, recoverySnapshotBinarySuffix, etc.
 func (p *BaseSnapshotDecorator) Init(m LinkableInterface, image SnapshotImage, moduleSuffix string) {
@@ -416,6 +462,11 @@ type snapshotLibraryDecorator struct {
 	}
 }
 
+func (p *snapshotLibraryDecorator) linkerDeps(ctx DepsContext, deps Deps) Deps {
+	p.AddSnapshotManifestDependency(ctx)
+	return p.libraryDecorator.linkerDeps(ctx, deps)
+}
+
 func (p *snapshotLibraryDecorator) linkerFlags(ctx ModuleContext, flags Flags) Flags {
 	p.libraryDecorator.libName = strings.TrimSuffix(ctx.ModuleName(), p.NameSuffix())
 	return p.libraryDecorator.linkerFlags(ctx, flags)
@@ -471,7 +522,10 @@ func (p *snapshotLibraryDecorator) link(ctx ModuleContext, flags Flags, deps Pat
 	p.libraryDecorator.reexportDeps(deps.ReexportedDeps...)
 	p.libraryDecorator.addExportedGeneratedHeaders(deps.ReexportedGeneratedHeaders...)
 
-	in := android.PathForModuleSrc(ctx, *p.properties.Src)
+	in := p.SnapshotSrcPath(ctx, *p.properties.Src)
+	if in == nil {
+		return nil
+	}
 	p.unstrippedOutputFile = in
 
 	if p.shared() {
@@ -658,6 +712,11 @@ func (p *snapshotBinaryDecorator) MatchesWithDevice(config android.DeviceConfig)
 	return true
 }
 
+func (p *snapshotBinaryDecorator) linkerDeps(ctx DepsContext, deps Deps) Deps {
+	p.AddSnapshotManifestDependency(ctx)
+	return p.binaryDecorator.linkerDeps(ctx, deps)
+}
+
 // cc modules' link functions are to link compiled objects into final binaries.
 // As snapshots are prebuilts, this just returns the prebuilt binary
 func (p *snapshotBinaryDecorator) link(ctx ModuleContext, flags Flags, deps PathDeps, objs Objects) android.Path {
@@ -667,7 +726,10 @@ func (p *snapshotBinaryDecorator) link(ctx ModuleContext, flags Flags, deps Path
 		return nil
 	}
 
-	in := android.PathForModuleSrc(ctx, *p.properties.Src)
+	in := p.SnapshotSrcPath(ctx, *p.properties.Src)
+	if in == nil {
+		return nil
+	}
 	p.unstrippedOutputFile = in
 	binName := in.Base()
 
@@ -756,6 +818,11 @@ func (p *snapshotObjectLinker) MatchesWithDevice(config android.DeviceConfig) bo
 	return true
 }
 
+func (p *snapshotObjectLinker) linkerDeps(ctx DepsContext, deps Deps) Deps {
+	p.AddSnapshotManifestDependency(ctx)
+	return p.objectLinker.linkerDeps(ctx, deps)
+}
+
 // cc modules' link functions are to link compiled objects into final binaries.
 // As snapshots are prebuilts, this just returns the prebuilt binary
 func (p *snapshotObjectLinker) link(ctx ModuleContext, flags Flags, deps PathDeps, objs Objects) android.Path {
@@ -765,7 +832,7 @@ func (p *snapshotObjectLinker) link(ctx ModuleContext, flags Flags, deps PathDep
 		return nil
 	}
 
-	return android.PathForModuleSrc(ctx, *p.properties.Src)
+	return p.SnapshotSrcPath(ctx, *p.properties.Src)
 }
 
 func (p *snapshotObjectLinker) nativeCoverage() bool {
@@ -808,6 +875,92 @@ func RecoverySnapshotObjectFactory() android.Module {
 	return module.Init()
 }
 
+//
+// Module definitions for manifests of content-addressed snapshots.
+//
+// When the ContentAddressedSnapshots product variable is set, the prebuilt files of a snapshot are
+// stored by the digest of their contents in a blob directory, and a manifest.json describes which
+// blob each of them is. The headers and the json flag files stay in the snapshot tree. As blobs
+// are named by content, several snapshot versions can share one blob directory and only store
+// identical files once.
+//
+// Modules (vendor|recovery)_snapshot_manifest read such a manifest, and snapshot modules that set
+// snapshot_manifest resolve their src through it.
+type snapshotManifestProperties struct {
+	// Path to the manifest.json of the snapshot, relative to the module directory. Defaults to
+	// "manifest.json".
+	Manifest *string
+
+	// Path to the directory containing the blobs the manifest refers to, relative to the root of
+	// the source tree.
+	Blobs_dir *string
+}
+
+type snapshotManifestModule struct {
+	android.ModuleBase
+
+	properties snapshotManifestProperties
+}
+
+type snapshotManifestJson struct {
+	Files map[string]string
+}
+
+// SnapshotManifestInfo maps each file of a content-addressed snapshot to the blob storing it.
+type SnapshotManifestInfo struct {
+	// Path to the blob directory, relative to the root of the source tree.
+	BlobsDir string
+
+	// Map from the path of a file relative to the manifest to the digest of its blob.
+	Files map[string]string
+}
+
+var SnapshotManifestInfoProvider = blueprint.NewProvider(SnapshotManifestInfo{})
+
+var snapshotManifestDepTag = dependencyTag{name: "snapshot manifest"}
+
+func (m *snapshotManifestModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if m.properties.Blobs_dir == nil {
+		ctx.PropertyErrorf("blobs_dir", "must be set")
+		return
+	}
+
+	manifestPath := filepath.Join(ctx.ModuleDir(), proptools.StringDefault(m.properties.Manifest, "manifest.json"))
+	ctx.AddNinjaFileDeps(manifestPath)
+	r, err := ctx.Config().Fs().Open(manifestPath)
+	if err != nil {
+		ctx.PropertyErrorf("manifest", "failed to open %q: %s", manifestPath, err)
+		return
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		ctx.PropertyErrorf("manifest", "failed to read %q: %s", manifestPath, err)
+		return
+	}
+
+	var manifest snapshotManifestJson
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		ctx.PropertyErrorf("manifest", "failed to parse %q: %s", manifestPath, err)
+		return
+	}
+
+	ctx.SetProvider(SnapshotManifestInfoProvider, SnapshotManifestInfo{
+		BlobsDir: *m.properties.Blobs_dir,
+		Files:    manifest.Files,
+	})
+}
+
+// (vendor|recovery)_snapshot_manifest describes a content-addressed snapshot, which is
+// auto-generated by development/vendor_snapshot/update.py. Snapshot modules that set
+// snapshot_manifest to the name of this module take their src from the blobs it lists.
+func SnapshotManifestFactory() android.Module {
+	module := &snapshotManifestModule{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidModule(module)
+	return module
+}
+
 type SnapshotInterface interface {
 	MatchesWithDevice(config android.DeviceConfig) bool
 	IsSnapshotPrebuilt() bool
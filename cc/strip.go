@@ -96,3 +96,24 @@ func (stripper *Stripper) StripStaticLib(actx android.ModuleContext, in android.
 	flags StripFlags) {
 	stripper.strip(actx, in, out, flags, true)
 }
+
+// TransformStripForPayload strips a binary or shared library that is packaged by another module,
+// e.g. in the payload of an APEX, regardless of the strip properties of the module that built it.
+// The mini debug info is kept if keepMiniDebugInfo is true, and everything is stripped otherwise.
+func TransformStripForPayload(ctx android.ModuleContext, in android.Path, out android.WritablePath,
+	keepMiniDebugInfo bool) {
+	transformStrip(ctx, in, out, StripFlags{StripKeepMiniDebugInfo: keepMiniDebugInfo})
+}
+
+// ModifiesOutputFileAfterLink returns true if the output file of the module is modified after the
+// link by inject_bssl_hash or use_version_lib, so that it is not just a stripped copy of the
+// unstripped output file.
+func (c *Module) ModifiesOutputFileAfterLink() bool {
+	switch linker := c.linker.(type) {
+	case *libraryDecorator:
+		return Bool(linker.Properties.Inject_bssl_hash) || Bool(linker.baseLinker.Properties.Use_version_lib)
+	case *binaryDecorator:
+		return Bool(linker.Properties.Inject_bssl_hash) || Bool(linker.baseLinker.Properties.Use_version_lib)
+	}
+	return false
+}
@@ -119,6 +119,9 @@ type TestBinaryProperties struct {
 
 	// Install the test into a folder named for the module in all test suites.
 	Per_testcase_directory *bool
+
+	// The modules that the test is for in the generated test mapping.
+	Test_mapping android.TestMappingProperties
 }
 
 func init() {
@@ -471,6 +474,19 @@ func (test *testBinary) install(ctx ModuleContext, file android.Path) {
 		test.Properties.Test_options.Unit_test = proptools.BoolPtr(true)
 	}
 	test.binaryDecorator.baseInstaller.install(ctx, file)
+
+	if ctx.Host() && Bool(test.Properties.Test_options.Unit_test) {
+		// Run the installed binary so that it finds its shared libraries.
+		installed := test.binaryDecorator.baseInstaller.path
+		inputs := android.Paths{installed}
+		for _, data := range test.data {
+			inputs = append(inputs, data.SrcPath)
+		}
+		android.BuildHostTestRun(ctx, android.HostTestRunParams{
+			Command: installed.String(),
+			Inputs:  inputs,
+		})
+	}
 }
 
 func NewTest(hod android.HostOrDeviceSupported) *Module {
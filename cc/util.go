@@ -99,6 +99,8 @@ func flagsToBuilderFlags(in Flags) builderFlags {
 
 		yacc: in.Yacc,
 		lex:  in.Lex,
+
+		precompiledHeader: in.PrecompiledHeader,
 	}
 }
 
@@ -95,7 +95,7 @@ func isSnapshotAware(cfg android.DeviceConfig, m LinkableInterface, inProprietar
 		if sanitizable.SanitizePropDefined() {
 			// scs and hwasan export both sanitized and unsanitized variants for static and header
 			// Always use unsanitized variants of them.
-			for _, t := range []SanitizerType{scs, Hwasan} {
+			for _, t := range []SanitizerType{Scs, Hwasan} {
 				if !sanitizable.Shared() && sanitizable.IsSanitizerEnabled(t) {
 					return false
 				}
@@ -262,6 +262,118 @@ func TestVendorSnapshotDirected(t *testing.T) {
 	}
 }
 
+func TestVendorSnapshotContentAddressed(t *testing.T) {
+	bp := `
+	cc_library_shared {
+		name: "libvendor",
+		vendor: true,
+		nocrt: true,
+		export_include_dirs: ["include"],
+	}
+`
+	fs := map[string][]byte{
+		"include/libvendor.h": nil,
+	}
+	config := TestConfig(t.TempDir(), android.Android, nil, bp, fs)
+	config.TestProductVariables.DeviceVndkVersion = StringPtr("current")
+	config.TestProductVariables.Platform_vndk_version = StringPtr("29")
+	config.TestProductVariables.ContentAddressedSnapshots = true
+	ctx := testCcWithConfig(t, config)
+
+	snapshotSingleton := ctx.SingletonForTests("vendor-snapshot")
+
+	// The prebuilts are stored as blobs, the json flag files and the headers stay in the snapshot
+	// tree.
+	store := snapshotSingleton.Output("out/soong/vendor-snapshot/arm64/manifest.json")
+	android.AssertStringListContains(t, "blob store inputs", store.Implicits.Strings(),
+		"out/soong/vendor-snapshot/arm64/arch-arm64-armv8-a/shared/libvendor.so")
+	android.AssertStringListDoesNotContain(t, "blob store inputs", store.Implicits.Strings(),
+		"out/soong/vendor-snapshot/arm64/arch-arm64-armv8-a/shared/libvendor.so.json")
+	android.AssertStringListDoesNotContain(t, "blob store inputs", store.Implicits.Strings(),
+		"out/soong/vendor-snapshot/arm64/include/include/libvendor.h")
+	android.AssertStringDoesContain(t, "blob store command", store.RuleParams.Command,
+		"--blobs-zip out/soong/vendor-snapshot/arm64/blobs.zip")
+
+	zip := snapshotSingleton.Output("out/soong/vendor-snapshot/vendor-" + config.DeviceName() + ".zip")
+	android.AssertStringListContains(t, "snapshot zip inputs", zip.Inputs.Strings(),
+		"out/soong/vendor-snapshot/arm64/include/include/libvendor.h")
+	android.AssertStringListContains(t, "snapshot zip inputs", zip.Implicits.Strings(),
+		"out/soong/vendor-snapshot/arm64/blobs.zip")
+
+	// Fake snapshots are not content-addressed.
+	fakeSnapshotSingleton := ctx.SingletonForTests("vendor-fake-snapshot")
+	if fakeSnapshotSingleton.MaybeOutput("out/soong/fake/vendor-snapshot/arm64/manifest.json").Rule != nil {
+		t.Errorf("fake snapshot should not have a manifest")
+	}
+}
+
+func TestVendorSnapshotManifestUse(t *testing.T) {
+	bp := `
+	vendor_snapshot_manifest {
+		name: "vendor_snapshot_manifest_28_arm64",
+		blobs_dir: "prebuilts/vendor/blobs",
+	}
+
+	vendor_snapshot_static {
+		name: "libsnapshot",
+		vendor: true,
+		target_arch: "arm64",
+		version: "28",
+		snapshot_manifest: "vendor_snapshot_manifest_28_arm64",
+		arch: {
+			arm64: {
+				src: "arch-arm64-armv8-a/static/libsnapshot.a",
+			},
+		},
+	}
+`
+	missingBp := `
+	vendor_snapshot_static {
+		name: "libmissing",
+		vendor: true,
+		target_arch: "arm64",
+		version: "28",
+		snapshot_manifest: "vendor_snapshot_manifest_28_arm64",
+		arch: {
+			arm64: {
+				src: "arch-arm64-armv8-a/static/libmissing.a",
+			},
+		},
+	}
+`
+	manifest := `{
+		"files": {
+			"arch-arm64-armv8-a/static/libsnapshot.a": "5f0c1a"
+		}
+	}`
+
+	mockFS := map[string][]byte{
+		"vendor/Android.bp":             []byte(bp),
+		"vendor/manifest.json":          []byte(manifest),
+		"prebuilts/vendor/blobs/5f0c1a": nil,
+	}
+
+	config := TestConfig(t.TempDir(), android.Android, nil, "", mockFS)
+	config.TestProductVariables.DeviceVndkVersion = StringPtr("28")
+	config.TestProductVariables.Platform_vndk_version = StringPtr("29")
+	ctx := testCcWithConfig(t, config)
+
+	// The blob is copied so that the library keeps its name.
+	staticModule := ctx.ModuleForTests("libsnapshot.vendor_static.28.arm64", "android_vendor.28_arm64_armv8-a_static")
+	blob := staticModule.Output("snapshot_manifest/arch-arm64-armv8-a/static/libsnapshot.a")
+	android.AssertStringEquals(t, "blob input", "prebuilts/vendor/blobs/5f0c1a", blob.Input.String())
+	android.AssertPathRelativeToTopEquals(t, "output file",
+		"out/soong/.intermediates/vendor/libsnapshot.vendor_static.28.arm64/android_vendor.28_arm64_armv8-a_static/snapshot_manifest/arch-arm64-armv8-a/static/libsnapshot.a",
+		staticModule.Module().(*Module).outputFile.Path())
+
+	// Files missing from the manifest are reported.
+	mockFS["vendor/Android.bp"] = []byte(bp + missingBp)
+	config = TestConfig(t.TempDir(), android.Android, nil, "", mockFS)
+	config.TestProductVariables.DeviceVndkVersion = StringPtr("28")
+	config.TestProductVariables.Platform_vndk_version = StringPtr("29")
+	testCcErrorWithConfig(t, `"arch-arm64-armv8-a/static/libmissing.a" is not listed in snapshot manifest "vendor_snapshot_manifest_28_arm64"`, config)
+}
+
 func TestVendorSnapshotUse(t *testing.T) {
 	frameworkBp := `
 	cc_library {
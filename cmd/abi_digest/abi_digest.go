@@ -0,0 +1,106 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// abi_digest computes a digest of the ABI of the classes in a jar, i.e. of the parts of the classes
+// that javac reads when compiling against the jar. Changes to method bodies, private members or
+// debug information do not change the digest, which allows the build to skip recompiling the
+// modules that depend on a jar when its ABI has not changed.
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	outputFile = flag.String("o", "", "output file")
+	inputFile  = flag.String("i", "", "input jar")
+)
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeDigest writes the ABI of the contents of the jar to h.
+func writeDigest(h hash.Hash, r *zip.Reader) error {
+	files := make([]*zip.File, 0, len(r.File))
+	files = append(files, r.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if !strings.HasSuffix(f.Name, ".class") {
+			// Resources may be read by annotation processors, so any change to them is significant.
+			fmt.Fprintf(h, "resource %s %08x\n", f.Name, f.CRC32)
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		lines, err := abiLines(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.Name, err)
+		}
+		for _, line := range lines {
+			io.WriteString(h, line+"\n")
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: abi_digest -i <input jar> -o <output file>")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *outputFile == "" || *inputFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	r, err := zip.OpenReader(*inputFile)
+	must(err)
+	defer r.Close()
+
+	h := sha256.New()
+	if err := writeDigest(h, &r.Reader); err != nil {
+		log.Fatalf("%s: %s", *inputFile, err)
+	}
+
+	must(ioutil.WriteFile(*outputFile, []byte(hex.EncodeToString(h.Sum(nil))+"\n"), 0666))
+}
@@ -0,0 +1,298 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type testMember struct {
+	access     uint16
+	name       string
+	descriptor string
+	// constant is the value of a ConstantValue attribute if non-zero.
+	constant int32
+	// code is the content of a Code attribute if non-nil.
+	code []byte
+}
+
+// testClass builds a minimal class file. The constant pool is laid out in the order in which the
+// entries are first used, so changing a member changes the indices of the later constants.
+type testClass struct {
+	name    string
+	fields  []testMember
+	methods []testMember
+	// kotlin adds the kotlin.Metadata annotation to the class if true.
+	kotlin bool
+}
+
+func (c testClass) bytes() []byte {
+	var pool bytes.Buffer
+	poolCount := uint16(1)
+	utf8s := map[string]uint16{}
+	utf8 := func(s string) uint16 {
+		if i, ok := utf8s[s]; ok {
+			return i
+		}
+		pool.WriteByte(constantUtf8)
+		binary.Write(&pool, binary.BigEndian, uint16(len(s)))
+		pool.WriteString(s)
+		utf8s[s] = poolCount
+		poolCount++
+		return utf8s[s]
+	}
+	class := func(s string) uint16 {
+		name := utf8(s)
+		pool.WriteByte(constantClass)
+		binary.Write(&pool, binary.BigEndian, name)
+		poolCount++
+		return poolCount - 1
+	}
+	integer := func(v int32) uint16 {
+		pool.WriteByte(constantInteger)
+		binary.Write(&pool, binary.BigEndian, v)
+		poolCount++
+		return poolCount - 1
+	}
+
+	var body bytes.Buffer
+	u2 := func(v uint16) { binary.Write(&body, binary.BigEndian, v) }
+	u4 := func(v uint32) { binary.Write(&body, binary.BigEndian, v) }
+
+	u2(0x0021)
+	u2(class(c.name))
+	u2(class("java/lang/Object"))
+	u2(0)
+	for _, members := range [][]testMember{c.fields, c.methods} {
+		u2(uint16(len(members)))
+		for _, m := range members {
+			u2(m.access)
+			u2(utf8(m.name))
+			u2(utf8(m.descriptor))
+			var attributes uint16
+			if m.constant != 0 {
+				attributes++
+			}
+			if m.code != nil {
+				attributes++
+			}
+			u2(attributes)
+			if m.constant != 0 {
+				u2(utf8("ConstantValue"))
+				u4(2)
+				u2(integer(m.constant))
+			}
+			if m.code != nil {
+				u2(utf8("Code"))
+				u4(uint32(len(m.code)))
+				body.Write(m.code)
+			}
+		}
+	}
+	if c.kotlin {
+		u2(2)
+		u2(utf8("RuntimeVisibleAnnotations"))
+		u4(6)
+		u2(1)
+		u2(utf8("Lkotlin/Metadata;"))
+		u2(0)
+	} else {
+		u2(1)
+	}
+	u2(utf8("SourceFile"))
+	u4(2)
+	u2(utf8(c.name + ".java"))
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint32(0xCAFEBABE))
+	binary.Write(&out, binary.BigEndian, uint16(0))
+	binary.Write(&out, binary.BigEndian, uint16(52))
+	binary.Write(&out, binary.BigEndian, poolCount)
+	out.Write(pool.Bytes())
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func digest(t *testing.T, classes ...testClass) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, c := range classes {
+		f, err := w.Create(c.name + ".class")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(c.bytes())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.New()
+	if err := writeDigest(h, r); err != nil {
+		t.Fatal(err)
+	}
+	return h.Sum(nil)
+}
+
+func TestAbiLines(t *testing.T) {
+	c := testClass{
+		name: "foo/Foo",
+		fields: []testMember{
+			{access: 0x0019, name: "CONSTANT", descriptor: "I", constant: 42},
+			{access: 0x0002, name: "secret", descriptor: "I"},
+		},
+		methods: []testMember{
+			{access: 0x0001, name: "bar", descriptor: "()V", code: codeAttribute(0xb1)},
+		},
+	}
+
+	lines, err := abiLines(c.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"class foo/Foo access=0x21 extends=java/lang/Object implements=",
+		"field foo/Foo CONSTANTI access=0x19",
+		"field foo/Foo CONSTANTI access=0x19 ConstantValue=42",
+		"method foo/Foo bar()V access=0x1",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
+
+// codeAttribute returns the content of a Code attribute with the given bytecode, no exception
+// handlers and no attributes.
+func codeAttribute(code ...byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(1))
+	binary.Write(&buf, binary.BigEndian, uint16(1))
+	binary.Write(&buf, binary.BigEndian, uint32(len(code)))
+	buf.Write(code)
+	binary.Write(&buf, binary.BigEndian, uint16(0))
+	binary.Write(&buf, binary.BigEndian, uint16(0))
+	return buf.Bytes()
+}
+
+func TestDigest(t *testing.T) {
+	base := testClass{
+		name: "foo/Foo",
+		fields: []testMember{
+			{access: 0x0019, name: "CONSTANT", descriptor: "I", constant: 42},
+		},
+		methods: []testMember{
+			{access: 0x0001, name: "bar", descriptor: "()V", code: codeAttribute(0xb1)},
+			{access: 0x1008, name: "access$baz", descriptor: "()V", code: codeAttribute(0xb1)},
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		kotlin  bool
+		modify  func(c *testClass)
+		changed bool
+	}{
+		{
+			name: "method body",
+			modify: func(c *testClass) {
+				c.methods[0].code = codeAttribute(0x00, 0xb1)
+			},
+			changed: false,
+		},
+		{
+			name: "synthetic method",
+			modify: func(c *testClass) {
+				c.methods[1].descriptor = "(I)V"
+			},
+			changed: false,
+		},
+		{
+			name:   "kotlin method body",
+			kotlin: true,
+			modify: func(c *testClass) {
+				c.methods[0].code = codeAttribute(0x00, 0xb1)
+			},
+			changed: true,
+		},
+		{
+			name:   "kotlin synthetic accessor",
+			kotlin: true,
+			modify: func(c *testClass) {
+				c.methods[1].code = codeAttribute(0x00, 0xb1)
+			},
+			changed: true,
+		},
+		{
+			name:   "kotlin private field",
+			kotlin: true,
+			modify: func(c *testClass) {
+				c.fields = append(c.fields, testMember{access: 0x0002, name: "secret", descriptor: "J"})
+			},
+			changed: false,
+		},
+		{
+			name: "private field",
+			modify: func(c *testClass) {
+				c.fields = append([]testMember{{access: 0x0002, name: "secret", descriptor: "J"}}, c.fields...)
+			},
+			changed: false,
+		},
+		{
+			name: "constant value",
+			modify: func(c *testClass) {
+				c.fields[0].constant = 43
+			},
+			changed: true,
+		},
+		{
+			name: "method descriptor",
+			modify: func(c *testClass) {
+				c.methods[0].descriptor = "(I)V"
+			},
+			changed: true,
+		},
+		{
+			name: "method visibility",
+			modify: func(c *testClass) {
+				c.methods[0].access = 0x0004
+			},
+			changed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := base
+			c.kotlin = tc.kotlin
+			baseDigest := digest(t, c)
+			c.fields = append([]testMember(nil), base.fields...)
+			c.methods = append([]testMember(nil), base.methods...)
+			tc.modify(&c)
+			changed := !bytes.Equal(baseDigest, digest(t, c))
+			if changed != tc.changed {
+				t.Errorf("expected digest changed to be %v, got %v", tc.changed, changed)
+			}
+		})
+	}
+}
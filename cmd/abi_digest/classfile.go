@@ -0,0 +1,322 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	accPrivate   = 0x0002
+	accSynthetic = 0x1000
+
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+var errTruncated = errors.New("truncated class file")
+
+// reader reads the big-endian values of a class file.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) u1() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u2() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u4() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+type constant struct {
+	tag   uint8
+	value string
+	ref   uint16
+}
+
+// classFile is a parsed class file that can resolve its constant pool.
+type classFile struct {
+	constants []constant
+}
+
+// resolve returns a textual representation of a constant pool entry that does not depend on the
+// layout of the constant pool.
+func (c *classFile) resolve(index uint16) string {
+	if int(index) >= len(c.constants) || index == 0 {
+		return ""
+	}
+	switch e := c.constants[index]; e.tag {
+	case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+		return c.resolve(e.ref)
+	default:
+		return e.value
+	}
+}
+
+// kotlinMetadataAttribute is the description of the annotation that kotlinc adds to every class it
+// compiles.
+const kotlinMetadataAttribute = "RuntimeVisibleAnnotations=@Lkotlin/Metadata;("
+
+// abiLines parses a class file and returns a sorted list of lines describing the parts of the class
+// that are visible to the compiler when compiling against it, i.e. the class, its non-private
+// members and their signatures, constant values and annotations. Method bodies, private members
+// and debug information are excluded so that a change to them does not change the result.
+//
+// Classes compiled by kotlinc are the exception: the bodies of their inline functions are copied
+// into their callers, along with calls to the synthetic accessors they use, so the bodies of all
+// their non-private methods and their synthetic methods are included. The header jars of Kotlin
+// modules only keep the bodies of the inline functions, so a change to another method body still
+// does not change the result.
+func abiLines(data []byte) ([]string, error) {
+	r := &reader{data: data}
+	if r.u4() != 0xCAFEBABE {
+		return nil, fmt.Errorf("not a class file")
+	}
+	// Skip the minor and major versions, they are a property of the compiler not of the API.
+	r.u2()
+	r.u2()
+
+	c := &classFile{}
+	count := int(r.u2())
+	c.constants = make([]constant, count)
+	for i := 1; i < count && r.err == nil; i++ {
+		tag := r.u1()
+		e := constant{tag: tag}
+		switch tag {
+		case constantUtf8:
+			e.value = string(r.bytes(int(r.u2())))
+		case constantInteger:
+			e.value = strconv.Itoa(int(int32(r.u4())))
+		case constantFloat:
+			e.value = strconv.FormatFloat(float64(math.Float32frombits(r.u4())), 'g', -1, 32)
+		case constantLong, constantDouble:
+			high, low := uint64(r.u4()), uint64(r.u4())
+			if tag == constantLong {
+				e.value = strconv.FormatInt(int64(high<<32|low), 10)
+			} else {
+				e.value = strconv.FormatFloat(math.Float64frombits(high<<32|low), 'g', -1, 64)
+			}
+			// Long and double constants take two entries in the constant pool.
+			c.constants[i] = e
+			i++
+			continue
+		case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+			e.ref = r.u2()
+		case constantFieldref, constantMethodref, constantInterfaceMethodref, constantNameAndType,
+			constantDynamic, constantInvokeDynamic:
+			r.u2()
+			r.u2()
+		case constantMethodHandle:
+			r.u1()
+			r.u2()
+		default:
+			return nil, fmt.Errorf("unknown constant pool tag %d", tag)
+		}
+		c.constants[i] = e
+	}
+
+	access := r.u2()
+	name := c.resolve(r.u2())
+	super := c.resolve(r.u2())
+	var interfaces []string
+	for i := r.u2(); i > 0; i-- {
+		interfaces = append(interfaces, c.resolve(r.u2()))
+	}
+	lines := []string{fmt.Sprintf("class %s access=%#x extends=%s implements=%s",
+		name, access, super, strings.Join(interfaces, ","))}
+
+	type member struct {
+		access     uint16
+		line       string
+		attributes []string
+	}
+	var members []member
+	for _, kind := range []string{"field", "method"} {
+		for i := r.u2(); i > 0 && r.err == nil; i-- {
+			memberAccess := r.u2()
+			memberName := c.resolve(r.u2())
+			descriptor := c.resolve(r.u2())
+			members = append(members, member{
+				access:     memberAccess,
+				line:       fmt.Sprintf("%s %s %s%s access=%#x", kind, name, memberName, descriptor, memberAccess),
+				attributes: c.attributes(r),
+			})
+		}
+	}
+
+	kotlin := false
+	for _, attribute := range c.attributes(r) {
+		kotlin = kotlin || strings.HasPrefix(attribute, kotlinMetadataAttribute)
+		lines = append(lines, fmt.Sprintf("class %s %s", name, attribute))
+	}
+
+	for _, m := range members {
+		if m.access&accPrivate != 0 || (m.access&accSynthetic != 0 && !kotlin) {
+			continue
+		}
+		for _, attribute := range m.attributes {
+			if strings.HasPrefix(attribute, "Code=") && !kotlin {
+				continue
+			}
+			lines = append(lines, m.line+" "+attribute)
+		}
+		lines = append(lines, m.line)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// attributes reads a list of attributes and returns a description of those that may be part of the
+// ABI. The Code attribute is only part of the ABI of the methods of Kotlin classes, see abiLines.
+func (c *classFile) attributes(r *reader) []string {
+	var ret []string
+	for i := r.u2(); i > 0 && r.err == nil; i-- {
+		name := c.resolve(r.u2())
+		ar := &reader{data: r.bytes(int(r.u4()))}
+		switch name {
+		case "ConstantValue", "Signature":
+			ret = append(ret, name+"="+c.resolve(ar.u2()))
+		case "Deprecated":
+			ret = append(ret, name)
+		case "Code":
+			// The bytecode refers to the constant pool by index, so a change to the layout of the
+			// constant pool may change the result even if the code does not change.
+			ar.u2()
+			ar.u2()
+			code := ar.bytes(int(ar.u4()))
+			ret = append(ret, fmt.Sprintf("%s=%x", name, sha256.Sum256(code)))
+		case "Exceptions":
+			var exceptions []string
+			for j := ar.u2(); j > 0; j-- {
+				exceptions = append(exceptions, c.resolve(ar.u2()))
+			}
+			ret = append(ret, name+"="+strings.Join(exceptions, ","))
+		case "InnerClasses":
+			for j := ar.u2(); j > 0; j-- {
+				inner, outer, innerName, innerAccess := ar.u2(), ar.u2(), ar.u2(), ar.u2()
+				ret = append(ret, fmt.Sprintf("%s=%s,%s,%s,%#x", name,
+					c.resolve(inner), c.resolve(outer), c.resolve(innerName), innerAccess))
+			}
+		case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+			for j := ar.u2(); j > 0; j-- {
+				ret = append(ret, name+"="+c.annotation(ar))
+			}
+		case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+			numParameters := int(ar.u1())
+			for p := 0; p < numParameters; p++ {
+				for j := ar.u2(); j > 0; j-- {
+					ret = append(ret, fmt.Sprintf("%s[%d]=%s", name, p, c.annotation(ar)))
+				}
+			}
+		case "AnnotationDefault":
+			ret = append(ret, name+"="+c.elementValue(ar))
+		case "PermittedSubclasses", "NestMembers":
+			var classes []string
+			for j := ar.u2(); j > 0; j-- {
+				classes = append(classes, c.resolve(ar.u2()))
+			}
+			ret = append(ret, name+"="+strings.Join(classes, ","))
+		}
+		if ar.err != nil {
+			r.err = ar.err
+		}
+	}
+	return ret
+}
+
+func (c *classFile) annotation(r *reader) string {
+	annotationType := c.resolve(r.u2())
+	var elements []string
+	for i := r.u2(); i > 0 && r.err == nil; i-- {
+		elementName := c.resolve(r.u2())
+		elements = append(elements, elementName+"="+c.elementValue(r))
+	}
+	return fmt.Sprintf("@%s(%s)", annotationType, strings.Join(elements, ","))
+}
+
+func (c *classFile) elementValue(r *reader) string {
+	switch tag := r.u1(); tag {
+	case 'e':
+		enumType := c.resolve(r.u2())
+		return enumType + "." + c.resolve(r.u2())
+	case 'c':
+		return c.resolve(r.u2()) + ".class"
+	case '@':
+		return c.annotation(r)
+	case '[':
+		var values []string
+		for i := r.u2(); i > 0 && r.err == nil; i-- {
+			values = append(values, c.elementValue(r))
+		}
+		return "{" + strings.Join(values, ",") + "}"
+	default:
+		return string(rune(tag)) + ":" + strconv.Quote(c.resolve(r.u2()))
+	}
+}
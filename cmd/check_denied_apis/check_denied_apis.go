@@ -0,0 +1,348 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// check_denied_apis verifies that the classes in a jar do not reference any of a list of denied
+// classes or packages, e.g. device APIs that are not available in a host runtime. The references
+// are read from the constant pools of the classes: the classes they use and the types in the
+// descriptors of the fields and methods they declare or use. String constants are not references.
+//
+//	check_denied_apis -denied_apis denied_apis.txt foo.jar
+//
+// The denied APIs file lists one class per line by its internal name, e.g. android/os/Build, which
+// also denies its nested classes, or one package followed by a slash, e.g. android/net/, which also
+// denies its subpackages.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	deniedApisFile = flag.String("denied_apis", "", "file listing the denied classes and packages")
+)
+
+const (
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+var errTruncated = errors.New("truncated class file")
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reader reads the big-endian values of a class file.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) u1() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u2() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u4() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// descriptorClasses returns the classes named in a field or method descriptor, e.g.
+// (Landroid/os/Bundle;I)Ljava/lang/String;.
+func descriptorClasses(descriptor string) []string {
+	var classes []string
+	for {
+		start := strings.IndexByte(descriptor, 'L')
+		if start < 0 {
+			return classes
+		}
+		end := strings.IndexByte(descriptor[start:], ';')
+		if end < 0 {
+			return classes
+		}
+		classes = append(classes, descriptor[start+1:start+end])
+		descriptor = descriptor[start+end+1:]
+	}
+}
+
+type constant struct {
+	tag   uint8
+	value string
+	// ref is the index of the name of a class or of the descriptor of a name and type or method type
+	ref uint16
+}
+
+// referencedClasses parses a class file and returns its name and the sorted list of the classes it
+// references.
+func referencedClasses(data []byte) (string, []string, error) {
+	r := &reader{data: data}
+	if r.u4() != 0xCAFEBABE {
+		return "", nil, fmt.Errorf("not a class file")
+	}
+	// Skip the minor and major versions.
+	r.u2()
+	r.u2()
+
+	count := int(r.u2())
+	constants := make([]constant, count)
+	for i := 1; i < count && r.err == nil; i++ {
+		tag := r.u1()
+		e := constant{tag: tag}
+		switch tag {
+		case constantUtf8:
+			e.value = string(r.bytes(int(r.u2())))
+		case constantInteger, constantFloat:
+			r.u4()
+		case constantLong, constantDouble:
+			r.u4()
+			r.u4()
+			// Long and double constants take two entries in the constant pool.
+			constants[i] = e
+			i++
+			continue
+		case constantClass, constantMethodType:
+			e.ref = r.u2()
+		case constantString, constantModule, constantPackage:
+			r.u2()
+		case constantNameAndType:
+			r.u2()
+			e.ref = r.u2()
+		case constantFieldref, constantMethodref, constantInterfaceMethodref,
+			constantDynamic, constantInvokeDynamic:
+			r.u2()
+			r.u2()
+		case constantMethodHandle:
+			r.u1()
+			r.u2()
+		default:
+			return "", nil, fmt.Errorf("unknown constant pool tag %d", tag)
+		}
+		constants[i] = e
+	}
+
+	utf8 := func(index uint16) string {
+		if int(index) < len(constants) && constants[index].tag == constantUtf8 {
+			return constants[index].value
+		}
+		return ""
+	}
+
+	// Skip the access flags.
+	r.u2()
+	thisClass := r.u2()
+	// Skip the super class and the interfaces, they are class constants.
+	r.u2()
+	for i := r.u2(); i > 0; i-- {
+		r.u2()
+	}
+
+	var descriptors []string
+	// Read the descriptors of the fields and then the methods, skipping their attributes.
+	for kind := 0; kind < 2; kind++ {
+		for i := r.u2(); i > 0 && r.err == nil; i-- {
+			// Skip the access flags and the name.
+			r.u2()
+			r.u2()
+			descriptors = append(descriptors, utf8(r.u2()))
+			for j := r.u2(); j > 0 && r.err == nil; j-- {
+				r.u2()
+				r.bytes(int(r.u4()))
+			}
+		}
+	}
+	if r.err != nil {
+		return "", nil, r.err
+	}
+
+	var classes []string
+	for _, e := range constants {
+		switch e.tag {
+		case constantClass:
+			if class := utf8(e.ref); strings.HasPrefix(class, "[") {
+				// Array classes are named by their descriptor, e.g. [Landroid/os/Bundle;.
+				classes = append(classes, descriptorClasses(class)...)
+			} else {
+				classes = append(classes, class)
+			}
+		case constantNameAndType, constantMethodType:
+			descriptors = append(descriptors, utf8(e.ref))
+		}
+	}
+	for _, descriptor := range descriptors {
+		classes = append(classes, descriptorClasses(descriptor)...)
+	}
+
+	var name string
+	if int(thisClass) < len(constants) {
+		name = utf8(constants[thisClass].ref)
+	}
+	return name, sortedUnique(classes), nil
+}
+
+func sortedUnique(list []string) []string {
+	sort.Strings(list)
+	ret := list[:0]
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// deniedApis matches classes against a list of denied classes and packages.
+type deniedApis []string
+
+// denies returns the denied class or package that matches the class, if any.
+func (d deniedApis) denies(class string) (string, bool) {
+	for _, denied := range d {
+		if strings.HasSuffix(denied, "/") {
+			if strings.HasPrefix(class, denied) {
+				return denied, true
+			}
+		} else if class == denied || strings.HasPrefix(class, denied+"$") {
+			return denied, true
+		}
+	}
+	return "", false
+}
+
+func readDeniedApis(file string) deniedApis {
+	f, err := os.Open(file)
+	must(err)
+	defer f.Close()
+
+	var ret deniedApis
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			ret = append(ret, line)
+		}
+	}
+	must(scanner.Err())
+	return ret
+}
+
+// checkJar returns a description of each reference from a class in the jar to a denied API.
+func checkJar(r *zip.Reader, denied deniedApis) ([]string, error) {
+	var violations []string
+	for _, f := range r.File {
+		if !strings.HasSuffix(f.Name, ".class") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		name, classes, err := referencedClasses(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		for _, class := range classes {
+			if d, ok := denied.denies(class); ok && class != name {
+				violations = append(violations, fmt.Sprintf("%s references %s (denied by %s)",
+					strings.ReplaceAll(name, "/", "."), strings.ReplaceAll(class, "/", "."), d))
+			}
+		}
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: check_denied_apis -denied_apis <file> <jar>")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 1 || *deniedApisFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	denied := readDeniedApis(*deniedApisFile)
+
+	r, err := zip.OpenReader(flag.Arg(0))
+	must(err)
+	defer r.Close()
+
+	violations, err := checkJar(&r.Reader, denied)
+	must(err)
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "%s references APIs that are not available on the host:\n", flag.Arg(0))
+		for _, v := range violations {
+			fmt.Fprintln(os.Stderr, "  "+v)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testClass builds a minimal class file with the given class and method references, string
+// constants and method descriptors.
+type testClass struct {
+	name       string
+	classes    []string
+	strings    []string
+	methodRefs []string
+	methods    []string
+}
+
+func (c testClass) bytes() []byte {
+	var pool bytes.Buffer
+	poolCount := uint16(1)
+	add := func(tag uint8, values ...uint16) uint16 {
+		pool.WriteByte(tag)
+		for _, v := range values {
+			binary.Write(&pool, binary.BigEndian, v)
+		}
+		poolCount++
+		return poolCount - 1
+	}
+	utf8 := func(s string) uint16 {
+		pool.WriteByte(constantUtf8)
+		binary.Write(&pool, binary.BigEndian, uint16(len(s)))
+		pool.WriteString(s)
+		poolCount++
+		return poolCount - 1
+	}
+
+	thisClass := add(constantClass, utf8(c.name))
+	superClass := add(constantClass, utf8("java/lang/Object"))
+	for _, class := range c.classes {
+		add(constantClass, utf8(class))
+	}
+	for _, s := range c.strings {
+		add(constantString, utf8(s))
+	}
+	// A long constant takes two entries in the constant pool.
+	pool.WriteByte(constantLong)
+	pool.Write(make([]byte, 8))
+	poolCount += 2
+	for _, descriptor := range c.methodRefs {
+		add(constantNameAndType, utf8("m"), utf8(descriptor))
+	}
+	var methods bytes.Buffer
+	binary.Write(&methods, binary.BigEndian, uint16(len(c.methods)))
+	for _, descriptor := range c.methods {
+		binary.Write(&methods, binary.BigEndian, []uint16{0x0001, utf8("m"), utf8(descriptor), 1, utf8("Code")})
+		binary.Write(&methods, binary.BigEndian, uint32(2))
+		methods.Write([]byte{0xb1, 0x00})
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{0xCAFEBABE})
+	binary.Write(&b, binary.BigEndian, []uint16{0, 52, poolCount})
+	b.Write(pool.Bytes())
+	binary.Write(&b, binary.BigEndian, []uint16{0x0021, thisClass, superClass, 0, 0})
+	b.Write(methods.Bytes())
+	binary.Write(&b, binary.BigEndian, uint16(0))
+	return b.Bytes()
+}
+
+func TestReferencedClasses(t *testing.T) {
+	name, classes, err := referencedClasses(testClass{
+		name:       "com/example/Foo",
+		classes:    []string{"android/os/Build", "[[Landroid/os/Bundle;"},
+		strings:    []string{"android/net/Uri"},
+		methodRefs: []string{"(Landroid/content/Context;I)V"},
+		methods:    []string{"(Landroid/view/View;)Landroid/util/Log;"},
+	}.bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name != "com/example/Foo" {
+		t.Errorf("expected name com/example/Foo, got %q", name)
+	}
+	expected := []string{
+		"android/content/Context",
+		"android/os/Build",
+		"android/os/Bundle",
+		"android/util/Log",
+		"android/view/View",
+		"com/example/Foo",
+		"java/lang/Object",
+	}
+	if !reflect.DeepEqual(classes, expected) {
+		t.Errorf("expected classes %q, got %q", expected, classes)
+	}
+
+	if _, _, err := referencedClasses([]byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0}); err != errTruncated {
+		t.Errorf("expected %q error for a truncated class, got %v", errTruncated, err)
+	}
+}
+
+func TestCheckJar(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, c := range []testClass{
+		{name: "com/example/Foo", classes: []string{"android/os/SystemProperties$Handle"}},
+		{name: "com/example/Bar", methods: []string{"(Landroid/net/wifi/WifiManager;)V"}},
+		{name: "com/example/Baz", classes: []string{"android/os/SystemPropertiesHelper"}, strings: []string{"android/net/Uri"}},
+	} {
+		w, err := zw.Create(c.name + ".class")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(c.bytes())
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := checkJar(zr, deniedApis{"android/os/SystemProperties", "android/net/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{
+		"com.example.Bar references android.net.wifi.WifiManager (denied by android/net/)",
+		"com.example.Foo references android.os.SystemProperties$Handle (denied by android/os/SystemProperties)",
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("expected violations %q, got %q", expected, violations)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gen_prebuilt_apis_index generates the index file used by the index property of a prebuilt_apis
+// module, so that soong doesn't have to glob the api directories on every run, e.g.
+//
+//	gen_prebuilt_apis_index -o prebuilts/sdk/prebuilt_apis.index prebuilts/sdk
+//
+// The index contains one line per jar or api txt file with its path relative to the given
+// directory, which must be the directory of the prebuilt_apis module. Lines starting with # are
+// comments.
+//
+// With -check, it verifies that an existing index lists exactly the files in the directory and
+// writes an empty output file if it does, which the prebuilt_apis module uses to detect a stale
+// index at build time:
+//
+//	gen_prebuilt_apis_index -check prebuilts/sdk/prebuilt_apis.index -o index_check.timestamp prebuilts/sdk
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	outputFile = flag.String("o", "", "output file, defaults to stdout")
+	checkFile  = flag.String("check", "", "index to verify instead of generating one")
+)
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// isApiFile returns true for the files that prebuilt_apis creates modules for: the stub jars in
+// <dir>/<scope>/ and the api txt files in <dir>/<scope>/api/.
+func isApiFile(rel string) bool {
+	switch filepath.Ext(rel) {
+	case ".jar":
+		return true
+	case ".txt":
+		return filepath.Base(filepath.Dir(rel)) == "api"
+	}
+	return false
+}
+
+func index(dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !isApiFile(rel) {
+			return nil
+		}
+		if strings.ContainsAny(rel, "\n") {
+			return fmt.Errorf("cannot index %q, it contains a newline", rel)
+		}
+		files = append(files, rel)
+		return nil
+	})
+	must(err)
+	sort.Strings(files)
+	return files
+}
+
+// readIndex returns the files listed in an existing index.
+func readIndex(indexFile string) []string {
+	f, err := os.Open(indexFile)
+	must(err)
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, line)
+	}
+	must(scanner.Err())
+	sort.Strings(files)
+	return files
+}
+
+// diffIndex returns the files that are only in the directory and the files that are only in the
+// index, given both sorted lists.
+func diffIndex(files, indexed []string) (added, removed []string) {
+	for len(files) > 0 || len(indexed) > 0 {
+		switch {
+		case len(indexed) == 0 || len(files) > 0 && files[0] < indexed[0]:
+			added = append(added, files[0])
+			files = files[1:]
+		case len(files) == 0 || indexed[0] < files[0]:
+			removed = append(removed, indexed[0])
+			indexed = indexed[1:]
+		default:
+			files, indexed = files[1:], indexed[1:]
+		}
+	}
+	return added, removed
+}
+
+func check(dir string, files []string) {
+	added, removed := diffIndex(files, readIndex(*checkFile))
+	if len(added) > 0 || len(removed) > 0 {
+		fmt.Fprintf(os.Stderr, "%s is out of date:\n", *checkFile)
+		for _, f := range added {
+			fmt.Fprintf(os.Stderr, "  missing %s\n", f)
+		}
+		for _, f := range removed {
+			fmt.Fprintf(os.Stderr, "  lists nonexistent %s\n", f)
+		}
+		fmt.Fprintf(os.Stderr, "Regenerate it with:\n  gen_prebuilt_apis_index -o %s %s\n", *checkFile, dir)
+		os.Exit(1)
+	}
+	if *outputFile != "" {
+		must(os.WriteFile(*outputFile, nil, 0666))
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gen_prebuilt_apis_index [-check <index>] [-o <output file>] <dir>")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	files := index(flag.Arg(0))
+
+	if *checkFile != "" {
+		check(flag.Arg(0), files)
+		return
+	}
+
+	out := os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		must(err)
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# Generated by gen_prebuilt_apis_index %s\n", flag.Arg(0))
+	for _, f := range files {
+		fmt.Fprintln(w, f)
+	}
+	must(w.Flush())
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffIndex(t *testing.T) {
+	testCases := []struct {
+		name           string
+		files, indexed []string
+		added, removed []string
+	}{
+		{
+			name:    "up to date",
+			files:   []string{"30/public/api/foo.txt", "30/public/foo.jar"},
+			indexed: []string{"30/public/api/foo.txt", "30/public/foo.jar"},
+		},
+		{
+			name:    "added",
+			files:   []string{"30/public/api/foo.txt", "30/public/foo.jar", "31/public/foo.jar"},
+			indexed: []string{"30/public/api/foo.txt", "30/public/foo.jar"},
+			added:   []string{"31/public/foo.jar"},
+		},
+		{
+			name:    "removed",
+			files:   []string{"30/public/foo.jar"},
+			indexed: []string{"30/public/api/foo.txt", "30/public/foo.jar"},
+			removed: []string{"30/public/api/foo.txt"},
+		},
+		{
+			name:  "empty index",
+			files: []string{"30/public/foo.jar"},
+			added: []string{"30/public/foo.jar"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := diffIndex(tc.files, tc.indexed)
+			if !reflect.DeepEqual(added, tc.added) {
+				t.Errorf("expected added %q, got %q", tc.added, added)
+			}
+			if !reflect.DeepEqual(removed, tc.removed) {
+				t.Errorf("expected removed %q, got %q", tc.removed, removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// record_mock_fs records the layout of directories of a real checkout into a manifest that can be
+// loaded into the mock filesystem of a test with android.FixtureFromRecordedFS, e.g.
+//
+//	record_mock_fs -o build/soong/java/testdata/prebuilts_sdk.fs prebuilts/sdk
+//
+// The manifest contains one line per file with the tab separated path of the file relative to the
+// root of the checkout, its size and the SHA256 of its contents. Lines starting with # are
+// comments.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	outputFile = flag.String("o", "", "output file, defaults to stdout")
+	root       = flag.String("root", ".", "root of the checkout that recorded paths are relative to")
+	excludes   = flag.String("exclude", ".git,.repo", "comma separated list of directory names to skip")
+)
+
+type entry struct {
+	path   string
+	size   int64
+	sha256 string
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func hashFile(path string, info os.FileInfo) string {
+	h := sha256.New()
+	if info.Mode()&os.ModeSymlink != 0 {
+		// Hash the target of the symlink, not the file it points to.
+		target, err := os.Readlink(path)
+		must(err)
+		io.WriteString(h, target)
+	} else {
+		f, err := os.Open(path)
+		must(err)
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		must(err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func record(dir string, excluded map[string]bool) []entry {
+	var entries []entry
+	err := filepath.Walk(filepath.Join(*root, dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if excluded[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(*root, path)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(rel, "\t\n") {
+			return fmt.Errorf("cannot record %q, it contains a tab or a newline", rel)
+		}
+		entries = append(entries, entry{
+			path:   filepath.ToSlash(rel),
+			size:   info.Size(),
+			sha256: hashFile(path, info),
+		})
+		return nil
+	})
+	must(err)
+	return entries
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: record_mock_fs [-o <output file>] [-root <checkout root>] <dir>...")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	excluded := make(map[string]bool)
+	for _, name := range strings.Split(*excludes, ",") {
+		if name != "" {
+			excluded[name] = true
+		}
+	}
+
+	var entries []entry
+	for _, dir := range flag.Args() {
+		entries = append(entries, record(dir, excluded)...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+
+	out := os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		must(err)
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# Recorded by record_mock_fs %s\n", strings.Join(flag.Args(), " "))
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", e.path, e.size, e.sha256)
+	}
+	must(w.Flush())
+}
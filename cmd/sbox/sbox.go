@@ -43,6 +43,9 @@ var (
 	manifestFile   string
 	keepOutDir     bool
 	writeIfChanged bool
+
+	network         string
+	networkAuditLog string
 )
 
 const (
@@ -50,6 +53,12 @@ const (
 	sandboxDirPlaceholder = "__SBOX_SANDBOX_DIR__"
 )
 
+const (
+	networkAllow = "allow"
+	networkAudit = "audit"
+	networkDeny  = "deny"
+)
+
 func init() {
 	flag.StringVar(&sandboxesRoot, "sandbox-path", "",
 		"root of temp directory to put the sandbox into")
@@ -61,6 +70,11 @@ func init() {
 		"whether to keep the sandbox directory when done")
 	flag.BoolVar(&writeIfChanged, "write-if-changed", false,
 		"only write the output files if they have changed")
+	flag.StringVar(&network, "network", networkAllow,
+		"network access of the commands: allow, audit to run them without network access where "+
+			"supported and log the ones that need it, or deny to also fail them")
+	flag.StringVar(&networkAuditLog, "network-audit-log", "",
+		"file to write the commands that need network access to with --network audit")
 }
 
 func usageViolation(violation string) {
@@ -117,6 +131,19 @@ func run() error {
 		// and by passing it as a parameter we don't need to duplicate its value
 		usageViolation("--sandbox-path <sandboxPath> is required and must be non-empty")
 	}
+	if network != networkAllow && network != networkAudit && network != networkDeny {
+		usageViolation(fmt.Sprintf("--network must be %s, %s or %s, was %q",
+			networkAllow, networkAudit, networkDeny, network))
+	}
+	if networkAuditLog != "" && network != networkAudit {
+		usageViolation(fmt.Sprintf("--network-audit-log requires --network %s", networkAudit))
+	}
+	if networkAuditLog != "" {
+		// The audit log is an output of the rule, start from an empty one.
+		if err := os.WriteFile(networkAuditLog, nil, 0666); err != nil {
+			return fmt.Errorf("failed to create network audit log: %w", err)
+		}
+	}
 
 	manifest, err := readManifest(manifestFile)
 
@@ -254,21 +281,6 @@ func runCommand(command *sbox_proto.Command, tempDir string, commandIndex int) (
 		pathToTempDirInSbox = "."
 	}
 
-	err = os.MkdirAll(tempDir, 0777)
-	if err != nil {
-		return "", fmt.Errorf("failed to create %q: %w", tempDir, err)
-	}
-
-	// Copy in any files specified by the manifest.
-	err = copyFiles(command.CopyBefore, "", tempDir, requireFromExists, alwaysWrite)
-	if err != nil {
-		return "", err
-	}
-	err = copyRspFiles(command.RspFiles, tempDir, pathToTempDirInSbox)
-	if err != nil {
-		return "", err
-	}
-
 	if strings.Contains(rawCommand, depFilePlaceholder) {
 		depFile = filepath.Join(pathToTempDirInSbox, "deps.d")
 		rawCommand = strings.Replace(rawCommand, depFilePlaceholder, depFile, -1)
@@ -278,28 +290,11 @@ func runCommand(command *sbox_proto.Command, tempDir string, commandIndex int) (
 		rawCommand = strings.Replace(rawCommand, sandboxDirPlaceholder, pathToTempDirInSbox, -1)
 	}
 
-	// Emulate ninja's behavior of creating the directories for any output files before
-	// running the command.
-	err = makeOutputDirs(command.CopyAfter, tempDir)
-	if err != nil {
-		return "", err
-	}
-
 	scriptName := fmt.Sprintf("sbox_command.%d.bash", commandIndex)
 	scriptPath := joinPath(tempDir, scriptName)
 	scriptPathInSandbox := joinPath(pathToTempDirInSbox, scriptName)
-	cmd, err := createCommandScript(rawCommand, scriptPath, scriptPathInSandbox)
-	if err != nil {
-		return "", err
-	}
-
-	buf := &bytes.Buffer{}
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = buf
-	cmd.Stderr = buf
 
 	if command.GetChdir() {
-		cmd.Dir = tempDir
 		path := os.Getenv("PATH")
 		absPath, err := makeAbsPathEnv(path)
 		if err != nil {
@@ -310,8 +305,48 @@ func runCommand(command *sbox_proto.Command, tempDir string, commandIndex int) (
 			return "", fmt.Errorf("Failed to update PATH: %w", err)
 		}
 	}
+
+	cmd, err := prepareSandbox(command, rawCommand, tempDir, pathToTempDirInSbox, scriptPath, scriptPathInSandbox)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+
+	// Run the command without network access if requested.
+	isolated := network != networkAllow && isolateNetwork(cmd)
+	if network == networkDeny && !isolated {
+		return "", fmt.Errorf("--network %s is not supported on this host", networkDeny)
+	}
 	err = cmd.Run()
 
+	if isolated && network == networkAudit && err != nil {
+		_, exited := err.(*exec.ExitError)
+
+		// Rerun the command with network access in a fresh sandbox, as the first run may have left
+		// partial outputs behind.
+		err = os.RemoveAll(tempDir)
+		if err != nil {
+			return "", err
+		}
+		cmd, err = prepareSandbox(command, rawCommand, tempDir, pathToTempDirInSbox, scriptPath, scriptPathInSandbox)
+		if err != nil {
+			return "", err
+		}
+		buf = &bytes.Buffer{}
+		cmd.Stdout = buf
+		cmd.Stderr = buf
+		err = cmd.Run()
+
+		// If the command failed without network access but succeeds with it, it needs the
+		// network.  If it could not be started without network access, e.g. because
+		// unprivileged user namespaces are disabled, nothing is known about it.
+		if exited && err == nil {
+			err = auditNetworkAccess(commandIndex)
+		}
+	}
+
 	if err != nil {
 		// The command failed, do a best effort copy of output files out of the sandbox.  This is
 		// especially useful for linters with baselines that print an error message on failure
@@ -352,6 +387,67 @@ func runCommand(command *sbox_proto.Command, tempDir string, commandIndex int) (
 	return depFile, nil
 }
 
+// prepareSandbox copies the inputs of a command into the sandbox in tempDir, and returns an
+// exec.Cmd that runs rawCommand in it.
+func prepareSandbox(command *sbox_proto.Command, rawCommand, tempDir, pathToTempDirInSbox,
+	scriptPath, scriptPathInSandbox string) (*exec.Cmd, error) {
+
+	err := os.MkdirAll(tempDir, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %q: %w", tempDir, err)
+	}
+
+	// Copy in any files specified by the manifest.
+	err = copyFiles(command.CopyBefore, "", tempDir, requireFromExists, alwaysWrite)
+	if err != nil {
+		return nil, err
+	}
+	err = copyRspFiles(command.RspFiles, tempDir, pathToTempDirInSbox)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emulate ninja's behavior of creating the directories for any output files before
+	// running the command.
+	err = makeOutputDirs(command.CopyAfter, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := createCommandScript(rawCommand, scriptPath, scriptPathInSandbox)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = os.Stdin
+	if command.GetChdir() {
+		cmd.Dir = tempDir
+	}
+	return cmd, nil
+}
+
+// auditNetworkAccess appends a line with the manifest and the index of a command that needs network
+// access to the --network-audit-log file, or prints it to stderr if there is no audit log.
+func auditNetworkAccess(commandIndex int) error {
+	line := fmt.Sprintf("%s\t%d\t%s\n", manifestFile, commandIndex, network)
+	if networkAuditLog == "" {
+		fmt.Fprintf(os.Stderr, "sbox: command needs network access: %s", line)
+		return nil
+	}
+
+	f, err := os.OpenFile(networkAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open network audit log: %w", err)
+	}
+	_, err = f.WriteString(line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write network audit log: %w", err)
+	}
+	return nil
+}
+
 // makeOutputDirs creates directories in the sandbox dir for every file that has a rule to be copied
 // out of the sandbox.  This emulate's Ninja's behavior of creating directories for output files
 // so that the tools don't have to.
@@ -125,3 +125,35 @@ func Test_filesHaveSameContents(t *testing.T) {
 		})
 	}
 }
+
+func Test_auditNetworkAccess(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testAuditNetworkAccess")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	defer func(m, n, l string) { manifestFile, network, networkAuditLog = m, n, l }(
+		manifestFile, network, networkAuditLog)
+	network = networkAudit
+	networkAuditLog = filepath.Join(tempDir, "audit.log")
+
+	manifestFile = "out/soong/.intermediates/foo/genrule.sbox.textproto"
+	if err := auditNetworkAccess(0); err != nil {
+		t.Fatalf("auditNetworkAccess() failed: %s", err)
+	}
+	manifestFile = "out/soong/.intermediates/bar/genrule.sbox.textproto"
+	if err := auditNetworkAccess(1); err != nil {
+		t.Fatalf("auditNetworkAccess() failed: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(networkAuditLog)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", networkAuditLog, err)
+	}
+	want := "out/soong/.intermediates/foo/genrule.sbox.textproto\t0\taudit\n" +
+		"out/soong/.intermediates/bar/genrule.sbox.textproto\t1\taudit\n"
+	if string(got) != want {
+		t.Errorf("audit log = %q, want %q", got, want)
+	}
+}
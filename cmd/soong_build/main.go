@@ -54,9 +54,27 @@ var (
 	bazelQueryViewDir string
 	bp2buildMarker    string
 
+	graphModule string
+	graphDepth  int
+	graphFormat string
+	graphFile   string
+
+	modulesUnderDir  string
+	modulesUnderFile string
+
+	dumpModule     string
+	dumpModuleFile string
+
+	queryModules    string
+	queryProperties string
+	queryFile       string
+
 	cmdlineArgs bootstrap.Args
 )
 
+// The number of mutators and module types listed in the analysis cost report.
+const analysisCostReportSize = 50
+
 func init() {
 	// Flags that make sense in every mode
 	flag.StringVar(&topDir, "top", "", "Top directory of the Android source tree")
@@ -82,6 +100,17 @@ func init() {
 	flag.StringVar(&docFile, "soong_docs", "", "build documentation file to output")
 	flag.StringVar(&bazelQueryViewDir, "bazel_queryview_dir", "", "path to the bazel queryview directory relative to --top")
 	flag.StringVar(&bp2buildMarker, "bp2build_marker", "", "If set, run bp2build, touch the specified marker file then exit")
+	flag.StringVar(&graphModule, "graph", "", "If set, write the dependency graph of the specified module, or //<dir>:<module> in a namespace, then exit")
+	flag.IntVar(&graphDepth, "graph_depth", 1, "number of levels of dependencies to include in --graph, 0 for all")
+	flag.StringVar(&graphFormat, "graph_format", android.DependencyGraphFormatDot, "format of --graph, dot or mermaid")
+	flag.StringVar(&graphFile, "graph_file", "", "file to write --graph to, defaults to dependency_graph.<format> in the soong output directory")
+	flag.StringVar(&modulesUnderDir, "modules_under", "", "If set, list the modules defined under the specified directory then exit")
+	flag.StringVar(&modulesUnderFile, "modules_under_file", "", "file to write --modules_under to, defaults to modules_under.txt in the soong output directory")
+	flag.StringVar(&dumpModule, "dump_module", "", "If set, write the effective properties of every variant of the specified module as JSON then exit")
+	flag.StringVar(&dumpModuleFile, "dump_module_file", "", "file to write --dump_module to, defaults to module_dump.json in the soong output directory")
+	flag.StringVar(&queryModules, "query", "", "If set, write the effective values of --query_properties of every variant of the specified comma-separated modules as JSON then exit")
+	flag.StringVar(&queryProperties, "query_properties", "sdk_version,min_sdk_version,apex_available", "comma-separated properties to write for --query, nested properties are selected with their dotted names")
+	flag.StringVar(&queryFile, "query_file", "", "file to write --query to, defaults to soong_query.json in the soong output directory")
 	flag.StringVar(&cmdlineArgs.OutFile, "o", "build.ninja", "the Ninja file to output")
 	flag.BoolVar(&cmdlineArgs.EmptyNinjaFile, "empty-ninja-file", false, "write out a 0-byte ninja file")
 
@@ -195,6 +224,15 @@ func writeMetrics(configuration android.Config, eventHandler metrics.EventHandle
 		fmt.Fprintf(os.Stderr, "error writing soong_build metrics %s: %s", metricsFile, err)
 		os.Exit(1)
 	}
+
+	if android.AnalysisCostsEnabled(configuration) {
+		analysisCostFile := filepath.Join(metricsDir, "soong_build_analysis_cost.txt")
+		err = android.WriteAnalysisCostReport(configuration, analysisCostFile, analysisCostReportSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing soong_build analysis cost report %s: %s", analysisCostFile, err)
+			os.Exit(1)
+		}
+	}
 }
 
 func writeJsonModuleGraphAndActions(ctx *android.Context, graphPath string, actionsPath string) {
@@ -210,6 +248,60 @@ func writeJsonModuleGraphAndActions(ctx *android.Context, graphPath string, acti
 	ctx.Context.PrintJSONGraphAndActions(graphFile, actionsFile)
 }
 
+func writeDependencyGraph(ctx *android.Context, graphPath string) {
+	f, err := os.Create(shared.JoinPath(topDir, graphPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating dependency graph file: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := android.WriteDependencyGraph(ctx, f, graphModule, graphDepth, graphFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing dependency graph: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func writeModulesUnder(ctx *android.Context, listPath string) {
+	f, err := os.Create(shared.JoinPath(topDir, listPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating module list file: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := android.WriteModulesUnder(ctx, f, modulesUnderDir); err != nil {
+		fmt.Fprintf(os.Stderr, "error listing modules: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func writeModuleDump(ctx *android.Context, dumpPath string) {
+	f, err := os.Create(shared.JoinPath(topDir, dumpPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating module dump file: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := android.WriteModuleDump(ctx, f, dumpModule); err != nil {
+		fmt.Fprintf(os.Stderr, "error dumping module: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func writeModuleQuery(ctx *android.Context, queryPath string) {
+	f, err := os.Create(shared.JoinPath(topDir, queryPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating module query file: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	modules := strings.Split(queryModules, ",")
+	properties := strings.Split(queryProperties, ",")
+	if err := android.WriteModuleQuery(ctx, f, modules, properties); err != nil {
+		fmt.Fprintf(os.Stderr, "error querying modules: %s\n", err)
+		os.Exit(1)
+	}
+}
+
 func writeBuildGlobsNinjaFile(ctx *android.Context, buildDir string, config interface{}) []string {
 	ctx.EventHandler.Begin("globs_ninja_file")
 	defer ctx.EventHandler.End("globs_ninja_file")
@@ -244,6 +336,10 @@ func doChosenActivity(configuration android.Config, extraNinjaDeps []string) str
 	generateQueryView := bazelQueryViewDir != ""
 	generateModuleGraphFile := moduleGraphFile != ""
 	generateDocFile := docFile != ""
+	generateDependencyGraph := graphModule != ""
+	generateModulesUnder := modulesUnderDir != ""
+	generateModuleDump := dumpModule != ""
+	generateModuleQuery := queryModules != ""
 
 	if generateBazelWorkspace {
 		// Run the alternate pipeline of bp2build mutators and singleton to convert
@@ -265,6 +361,15 @@ func doChosenActivity(configuration android.Config, extraNinjaDeps []string) str
 			stopBefore = bootstrap.StopBeforePrepareBuildActions
 		} else if generateDocFile {
 			stopBefore = bootstrap.StopBeforePrepareBuildActions
+		} else if generateDependencyGraph {
+			stopBefore = bootstrap.StopBeforePrepareBuildActions
+		} else if generateModulesUnder {
+			stopBefore = bootstrap.StopBeforePrepareBuildActions
+		} else if generateModuleDump {
+			stopBefore = bootstrap.StopBeforePrepareBuildActions
+		} else if generateModuleQuery {
+			// The effective SDK versions are only known after the modules were analyzed.
+			stopBefore = bootstrap.StopBeforeWriteNinja
 		} else {
 			stopBefore = bootstrap.DoEverything
 		}
@@ -295,6 +400,38 @@ func doChosenActivity(configuration android.Config, extraNinjaDeps []string) str
 			}
 			writeDepFile(docFile, *ctx.EventHandler, ninjaDeps)
 			return docFile
+		} else if generateDependencyGraph {
+			graphPath := graphFile
+			if graphPath == "" {
+				graphPath = filepath.Join(configuration.SoongOutDir(), "dependency_graph."+graphFormat)
+			}
+			writeDependencyGraph(ctx, graphPath)
+			writeDepFile(graphPath, *ctx.EventHandler, ninjaDeps)
+			return graphPath
+		} else if generateModulesUnder {
+			listPath := modulesUnderFile
+			if listPath == "" {
+				listPath = filepath.Join(configuration.SoongOutDir(), "modules_under.txt")
+			}
+			writeModulesUnder(ctx, listPath)
+			writeDepFile(listPath, *ctx.EventHandler, ninjaDeps)
+			return listPath
+		} else if generateModuleDump {
+			dumpPath := dumpModuleFile
+			if dumpPath == "" {
+				dumpPath = filepath.Join(configuration.SoongOutDir(), "module_dump.json")
+			}
+			writeModuleDump(ctx, dumpPath)
+			writeDepFile(dumpPath, *ctx.EventHandler, ninjaDeps)
+			return dumpPath
+		} else if generateModuleQuery {
+			queryPath := queryFile
+			if queryPath == "" {
+				queryPath = filepath.Join(configuration.SoongOutDir(), "soong_query.json")
+			}
+			writeModuleQuery(ctx, queryPath)
+			writeDepFile(queryPath, *ctx.EventHandler, ninjaDeps)
+			return queryPath
 		} else {
 			// The actual output (build.ninja) was written in the RunBlueprint() call
 			// above
@@ -345,6 +482,7 @@ func main() {
 	configuration := newConfig(availableEnv)
 	extraNinjaDeps := []string{
 		configuration.ProductVariablesFileName,
+		configuration.StarlarkProductVariablesFileName,
 		usedEnvFile,
 	}
 
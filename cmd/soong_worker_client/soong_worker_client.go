@@ -0,0 +1,93 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// soong_worker_client runs a tool command line in a persistent worker of the pool started by
+// soong_ui, e.g.
+//
+//	soong_worker_client -mnemonic Javac -worker "java -jar javac-worker.jar" -- javac -J-Xmx2g ...
+//
+// The arguments of the tool, except for the JVM flags starting with -J or -D which only apply when
+// the tool starts a new JVM, are sent to a worker started with the -worker command. If there is no
+// worker pool, e.g. because the build was not started by soong_ui, or the request fails, the tool
+// command line is run directly.
+//
+// As the worker and the tool produce the same outputs, the rules that use soong_worker_client
+// only have an order-only dependency on it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"android/soong/ui/build/worker"
+)
+
+var (
+	mnemonic      = flag.String("mnemonic", "", "kind of the worker, e.g. Javac")
+	workerCommand = flag.String("worker", "", "command that starts a worker, without --persistent_worker")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: soong_worker_client -mnemonic <mnemonic> -worker <command> -- <tool> [args...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// workerArguments returns the arguments of the tool that are sent to the worker.
+func workerArguments(toolArgs []string) []string {
+	var args []string
+	for _, arg := range toolArgs {
+		if strings.HasPrefix(arg, "-J") || strings.HasPrefix(arg, "-D") {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	tool := flag.Args()
+	if len(tool) == 0 || *mnemonic == "" || *workerCommand == "" {
+		usage()
+	}
+
+	if socket := os.Getenv(worker.SocketEnvVar); socket != "" {
+		resp, err := worker.Run(socket, worker.Request{
+			Mnemonic:      *mnemonic,
+			WorkerCommand: strings.Fields(*workerCommand),
+			Arguments:     workerArguments(tool[1:]),
+		})
+		if err == nil {
+			os.Stderr.WriteString(resp.Output)
+			os.Exit(resp.ExitCode)
+		}
+		fmt.Fprintf(os.Stderr, "soong_worker_client: %s, running %s directly\n", err, tool[0])
+	}
+
+	path, err := exec.LookPath(tool[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soong_worker_client: %s\n", err)
+		os.Exit(1)
+	}
+	err = syscall.Exec(path, tool, os.Environ())
+	fmt.Fprintf(os.Stderr, "soong_worker_client: failed to run %s: %s\n", tool[0], err)
+	os.Exit(1)
+}
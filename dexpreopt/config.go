@@ -58,6 +58,8 @@ type GlobalConfig struct {
 
 	BrokenSuboptimalOrderOfSystemServerJars bool // if true, sub-optimal order does not cause a build error
 
+	SystemServerDirtyImageObjects android.Path // dirty-image-objects file of the app images of system server jars
+
 	PreoptFlags []string // global dex2oat flags that should be used if no module-specific dex2oat flags are specified
 
 	DefaultCompilerFilter      string // default compiler filter to pass to dex2oat, overridden by --compiler-filter= in module-specific dex2oat flags
@@ -248,6 +250,9 @@ func ParseGlobalConfig(ctx android.PathContext, data []byte) (*GlobalConfig, err
 	// Construct paths that require a PathContext.
 	config.GlobalConfig.BootImageProfiles = constructPaths(ctx, config.BootImageProfiles)
 
+	// The dirty image objects of the app images of the system server jars are set by the product.
+	config.GlobalConfig.SystemServerDirtyImageObjects = constructPath(ctx, ctx.Config().SystemServerDirtyImageObjects())
+
 	return config.GlobalConfig, nil
 }
 
@@ -391,6 +396,7 @@ func WriteModuleConfig(ctx android.ModuleContext, config *ModuleConfig, path and
 	}
 
 	android.WriteFileRule(ctx, path, string(data))
+	ctx.SetProvider(ModuleConfigFileInfoProvider, ModuleConfigFileInfo{Path: path})
 }
 
 // dex2oatModuleName returns the name of the module to use for the dex2oat host
@@ -667,6 +673,7 @@ func GlobalConfigForTests(ctx android.PathContext) *GlobalConfig {
 		StandaloneSystemServerJars:         android.EmptyConfiguredJarList(),
 		ApexStandaloneSystemServerJars:     android.EmptyConfiguredJarList(),
 		SpeedApps:                          nil,
+		SystemServerDirtyImageObjects:      nil,
 		PreoptFlags:                        nil,
 		DefaultCompilerFilter:              "",
 		SystemServerCompilerFilter:         "",
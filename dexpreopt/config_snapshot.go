@@ -0,0 +1,144 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dexpreopt
+
+import (
+	"encoding/json"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// The dexpreopt-config-snapshot goal zips the resolved global dexpreopt config and the per-module
+// dexpreopt.config files, all as canonical JSON, into
+// ${OUT_DIR}/soong/dexpreopt/config_snapshot/dexpreopt_config_snapshot.zip, so that dexpreopt
+// behavior changes can be debugged by comparing the snapshots of two builds. When
+// DEXPREOPT_CONFIG_SNAPSHOT_BASELINE is set to the path of the snapshot of another build, which must
+// not be in the output directory of this build, the dexpreopt-config-diff goal prints the
+// differences between it and the snapshot of this build.
+
+const envDexpreoptConfigSnapshotBaseline = "DEXPREOPT_CONFIG_SNAPSHOT_BASELINE"
+
+func init() {
+	registerDexpreoptConfigSnapshotBuildComponents(android.InitRegistrationContext)
+}
+
+func registerDexpreoptConfigSnapshotBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("dexpreopt_config_snapshot", dexpreoptConfigSnapshotSingletonFactory)
+}
+
+var PrepareForTestWithDexpreoptConfigSnapshot = android.FixtureRegisterWithContext(registerDexpreoptConfigSnapshotBuildComponents)
+
+// globalConfigToJSON is the inverse of ParseGlobalConfig.
+func globalConfigToJSON(config *GlobalConfig) ([]byte, error) {
+	type GlobalJSONConfig struct {
+		*GlobalConfig
+
+		BootImageProfiles             []string
+		SystemServerDirtyImageObjects string
+	}
+
+	pathString := func(path android.Path) string {
+		if path == nil {
+			return ""
+		}
+		return path.String()
+	}
+
+	return json.MarshalIndent(&GlobalJSONConfig{
+		GlobalConfig:                  config,
+		BootImageProfiles:             config.BootImageProfiles.Strings(),
+		SystemServerDirtyImageObjects: pathString(config.SystemServerDirtyImageObjects),
+	}, "", "    ")
+}
+
+// ModuleConfigFileInfo is provided by the modules that write a per-module dexpreopt.config file, to
+// include it in the dexpreopt config snapshot.
+type ModuleConfigFileInfo struct {
+	// The path of the dexpreopt.config file written by WriteModuleConfig.
+	Path android.Path
+}
+
+var ModuleConfigFileInfoProvider = blueprint.NewProvider(ModuleConfigFileInfo{})
+
+func dexpreoptConfigSnapshotSingletonFactory() android.Singleton {
+	return &dexpreoptConfigSnapshotSingleton{}
+}
+
+type dexpreoptConfigSnapshotSingleton struct {
+	snapshot android.WritablePath
+}
+
+func (s *dexpreoptConfigSnapshotSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	data, err := globalConfigToJSON(GetGlobalConfig(ctx))
+	if err != nil {
+		ctx.Errorf("failed to JSON marshal GlobalConfig: %v", err)
+		return
+	}
+	globalConfig := android.PathForOutput(ctx, "dexpreopt", "config_snapshot", "global.json")
+	android.WriteFileRule(ctx, globalConfig, string(data))
+
+	var moduleConfigs android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if ctx.ModuleHasProvider(module, ModuleConfigFileInfoProvider) {
+			info := ctx.ModuleProvider(module, ModuleConfigFileInfoProvider).(ModuleConfigFileInfo)
+			moduleConfigs = append(moduleConfigs, info.Path)
+		}
+	})
+	inputs := append(android.Paths{globalConfig}, android.SortedUniquePaths(moduleConfigs)...)
+
+	s.snapshot = android.PathForOutput(ctx, "dexpreopt", "config_snapshot", "dexpreopt_config_snapshot.zip")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("soong_zip").
+		FlagWithOutput("-o ", s.snapshot).
+		FlagWithArg("-C ", android.PathForOutput(ctx).String()).
+		FlagWithRspFileInputList("-r ", android.PathForOutput(ctx, "dexpreopt", "config_snapshot", "files.rsp"), inputs)
+	rule.Build("dexpreopt_config_snapshot", "dexpreopt config snapshot")
+
+	ctx.Phony("dexpreopt-config-snapshot", s.snapshot)
+
+	baselineEnv := ctx.Config().Getenv(envDexpreoptConfigSnapshotBaseline)
+	if baselineEnv == "" {
+		return
+	}
+	baseline := android.PathForSourceRelaxed(ctx, baselineEnv)
+
+	diffDir := android.PathForOutput(ctx, "dexpreopt", "config_snapshot", "diff")
+	diff := android.PathForOutput(ctx, "dexpreopt", "config_snapshot", "diff.txt")
+	rule = android.NewRuleBuilder(pctx, ctx)
+	rule.Command().Text("rm -rf").Text(diffDir.String())
+	rule.Command().Text("unzip -qo").Input(baseline).FlagWithArg("-d ", diffDir.Join(ctx, "baseline").String())
+	rule.Command().Text("unzip -qo").Input(s.snapshot).FlagWithArg("-d ", diffDir.Join(ctx, "current").String())
+	rule.Command().
+		Text("(diff -ru").
+		Text(diffDir.Join(ctx, "baseline").String()).
+		Text(diffDir.Join(ctx, "current").String()).
+		FlagWithOutput("> ", diff).
+		Text("|| true)")
+	rule.Command().Text("cat").Text(diff.String())
+	rule.Build("dexpreopt_config_diff", "dexpreopt config diff")
+
+	ctx.Phony("dexpreopt-config-diff", diff)
+}
+
+func (s *dexpreoptConfigSnapshotSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.snapshot != nil {
+		ctx.DistForGoal("dexpreopt-config-snapshot", s.snapshot)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*dexpreoptConfigSnapshotSingleton)(nil)
@@ -0,0 +1,99 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dexpreopt
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+// moduleConfigTestModule writes the dexpreopt.config file of a system module.
+type moduleConfigTestModule struct {
+	android.ModuleBase
+}
+
+func (m *moduleConfigTestModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	WriteModuleConfig(ctx, testSystemModuleConfig(ctx, ctx.ModuleName()),
+		android.PathForModuleOut(ctx, "dexpreopt.config"))
+}
+
+func moduleConfigTestModuleFactory() android.Module {
+	m := &moduleConfigTestModule{}
+	android.InitAndroidModule(m)
+	return m
+}
+
+var prepareForConfigSnapshotTest = android.GroupFixturePreparers(
+	PrepareForTestWithDexpreoptConfigSnapshot,
+	FixtureSetBootJars("platform:foo"),
+	FixtureSetBootImageProfiles("art/profile.txt"),
+	android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+		ctx.RegisterModuleType("module_config", moduleConfigTestModuleFactory)
+	}),
+)
+
+const configSnapshotTestBp = `
+	module_config {
+		name: "bar",
+	}
+
+	module_config {
+		name: "baz",
+	}
+`
+
+func TestDexpreoptConfigSnapshot(t *testing.T) {
+	result := prepareForConfigSnapshotTest.RunTestWithBp(t, configSnapshotTestBp)
+
+	singleton := result.SingletonForTests("dexpreopt_config_snapshot")
+	global := android.ContentFromFileRuleForTests(t, singleton.Output("dexpreopt/config_snapshot/global.json"))
+	android.AssertStringDoesContain(t, "boot jars", global, `"BootJars": [
+        "platform:foo"
+    ],`)
+	android.AssertStringDoesContain(t, "boot image profiles", global, `"BootImageProfiles": [
+        "art/profile.txt"
+    ],`)
+
+	snapshot := singleton.Output("dexpreopt/config_snapshot/dexpreopt_config_snapshot.zip")
+	android.AssertPathsRelativeToTopEquals(t, "snapshot inputs", []string{
+		"out/soong/.intermediates/bar/dexpreopt.config",
+		"out/soong/.intermediates/baz/dexpreopt.config",
+		"out/soong/dexpreopt/config_snapshot/global.json",
+	}, snapshot.Inputs)
+
+	if singleton.MaybeOutput("dexpreopt/config_snapshot/diff.txt").Rule != nil {
+		t.Errorf("unexpected diff rule without %s", envDexpreoptConfigSnapshotBaseline)
+	}
+}
+
+func TestDexpreoptConfigDiff(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForConfigSnapshotTest,
+		android.FixtureMergeEnv(map[string]string{
+			envDexpreoptConfigSnapshotBaseline: "baseline/dexpreopt_config_snapshot.zip",
+		}),
+		android.FixtureAddFile("baseline/dexpreopt_config_snapshot.zip", nil),
+	).RunTestWithBp(t, configSnapshotTestBp)
+
+	// The baseline is an input of the diff, so that it is updated when the baseline changes.
+	diff := result.SingletonForTests("dexpreopt_config_snapshot").Output("dexpreopt/config_snapshot/diff.txt")
+	android.AssertPathsRelativeToTopEquals(t, "diff inputs", []string{
+		"baseline/dexpreopt_config_snapshot.zip",
+		"out/soong/dexpreopt/config_snapshot/dexpreopt_config_snapshot.zip",
+	}, diff.Inputs)
+	android.AssertStringDoesContain(t, "diff command", android.StringRelativeToTop(result.Config, diff.RuleParams.Command),
+		"unzip -qo baseline/dexpreopt_config_snapshot.zip -d out/soong/dexpreopt/config_snapshot/diff/baseline")
+}
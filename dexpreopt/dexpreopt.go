@@ -483,6 +483,12 @@ func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, g
 		if !global.DontResolveStartupStrings {
 			cmd.FlagWithArg("--resolve-startup-const-strings=", "true")
 		}
+		// The objects of the app images of system server jars that are known to be dirtied at run
+		// time are laid out together. Preloaded classes only apply to the boot image, the classes of
+		// an app image are selected by its profile.
+		if systemServerJars.ContainsJar(module.Name) && global.SystemServerDirtyImageObjects != nil {
+			cmd.FlagWithInput("--dirty-image-objects=", global.SystemServerDirtyImageObjects)
+		}
 		rule.Install(appImagePath, appImageInstallPath)
 	}
 
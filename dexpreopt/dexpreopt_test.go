@@ -17,6 +17,7 @@ package dexpreopt
 import (
 	"android/soong/android"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -236,6 +237,42 @@ func TestDexPreoptApexStandaloneSystemServerJars(t *testing.T) {
 	android.AssertStringEquals(t, "installs", wantInstalls.String(), rule.Installs().String())
 }
 
+func TestDexPreoptSystemServerDirtyImageObjects(t *testing.T) {
+	config := android.TestConfig("out", nil, "", nil)
+	ctx := android.BuilderContextForTesting(config)
+	globalSoong := globalSoongConfigForTests()
+	global := GlobalConfigForTests(ctx)
+
+	global.SystemServerJars = android.CreateTestConfiguredJarList([]string{"platform:service-A"})
+	global.SystemServerDirtyImageObjects = android.PathForTesting("dirty-image-objects")
+
+	module := testPlatformSystemServerModuleConfig(ctx, "service-A")
+	module.ForceCreateAppImage = true
+	rule, err := GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := strings.Join(rule.Commands(), "\n")
+	android.AssertStringDoesContain(t, "system server command", commands, "--dirty-image-objects=dirty-image-objects")
+
+	// The dirty image objects are only used to lay out an app image.
+	rule, err = GenerateDexpreoptRule(ctx, globalSoong, global, testPlatformSystemServerModuleConfig(ctx, "service-A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands = strings.Join(rule.Commands(), "\n")
+	android.AssertStringDoesNotContain(t, "system server command", commands, "--dirty-image-objects=")
+
+	module = testSystemModuleConfig(ctx, "test")
+	module.ForceCreateAppImage = true
+	rule, err = GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands = strings.Join(rule.Commands(), "\n")
+	android.AssertStringDoesNotContain(t, "app command", commands, "--dirty-image-objects=")
+}
+
 func TestDexPreoptProfile(t *testing.T) {
 	config := android.TestConfig("out", nil, "", nil)
 	ctx := android.BuilderContextForTesting(config)
@@ -149,6 +149,15 @@ type generatorProperties struct {
 
 	// input files to exclude
 	Exclude_srcs []string `android:"path,arch_variant"`
+
+	// Whether to add the runtime dependencies of the tools, e.g. the runtime classpath and JNI
+	// libraries of a java_binary_host, to the inputs of the sandbox.  Defaults to true.
+	Tool_runtime_deps *bool
+
+	// The Ninja pool to run the command in, which limits how many commands of resource heavy
+	// generators run in parallel. The pool must be defined in the NinjaPools of the product, which
+	// must list this module in the modules allowed to use it.
+	Ninja_pool *string
 }
 
 type Module struct {
@@ -344,6 +353,13 @@ func (g *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 						tools = append(tools, path.Path())
 						addLocationLabel(tag.label, toolLocation{android.Paths{path.Path()}})
 					}
+					if ctx.OtherModuleHasProvider(module, android.HostToolRuntimeDepsInfoProvider) &&
+						proptools.BoolDefault(g.properties.Tool_runtime_deps, true) {
+						// The runtime dependencies of the tool are copied into the sandbox at their
+						// original locations.
+						runtimeDeps := ctx.OtherModuleProvider(module, android.HostToolRuntimeDepsInfoProvider).(android.HostToolRuntimeDepsInfo)
+						tools = append(tools, runtimeDeps.Deps...)
+					}
 				case bootstrap.GoBinaryTool:
 					// A GoBinaryTool provides the install path to a tool, which will be copied.
 					p := android.PathForGoBinary(ctx, t)
@@ -416,6 +432,8 @@ func (g *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		cmd = g.CmdModifier(ctx, cmd)
 	}
 
+	pool := android.NinjaPoolForModule(ctx, "ninja_pool", String(g.properties.Ninja_pool))
+
 	// Generate tasks, either from genrule or gensrcs.
 	for _, task := range g.taskGenerator(ctx, cmd, srcFiles) {
 		if len(task.out) == 0 {
@@ -440,6 +458,7 @@ func (g *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 		// Use a RuleBuilder to create a rule that runs the command inside an sbox sandbox.
 		rule := android.NewRuleBuilder(pctx, ctx).Sbox(task.genDir, manifestPath).SandboxTools()
+		rule.Pool(pool)
 		cmd := rule.Command()
 
 		for _, out := range task.out {
@@ -683,10 +702,28 @@ func NewGenSrcs() *Module {
 
 		// gensrcs rules can easily hit command line limits by repeating the command for
 		// every input file.  Shard the input files into groups.
-		shards := android.ShardPaths(srcFiles, shardSize)
+		var shards []android.Paths
+		if n := properties.Shards; n != nil {
+			// Assign the input files to a fixed number of shards by a hash of their paths, so
+			// that adding or removing an input file only reruns the command of its own shard.
+			if properties.Shard_size != nil {
+				ctx.PropertyErrorf("shards", "cannot be set together with shard_size")
+			}
+			if *n < 1 {
+				ctx.PropertyErrorf("shards", "must be positive, got %d", *n)
+				return nil
+			}
+			shards = android.ShardPathsByHash(srcFiles, int(*n))
+		} else {
+			shards = android.ShardPaths(srcFiles, shardSize)
+		}
 		var generateTasks []generateTask
 
 		for i, shard := range shards {
+			if len(shard) == 0 {
+				continue
+			}
+
 			var commands []string
 			var outFiles android.WritablePaths
 			var commandDepFiles []string
@@ -796,6 +833,13 @@ type genSrcsProperties struct {
 
 	// maximum number of files that will be passed on a single command line.
 	Shard_size *int64
+
+	// number of commands that the input files are split between, which run in parallel. Each
+	// input file is assigned to a command by a hash of its path, so adding or removing an input
+	// file only reruns the command it is assigned to. Each command writes its own depfile when
+	// depfile is set, and the outputs of all the commands are merged into a single directory.
+	// Cannot be set together with shard_size.
+	Shards *int64
 }
 
 const defaultShardSize = 50
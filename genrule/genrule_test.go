@@ -593,6 +593,50 @@ func TestGenSrcs(t *testing.T) {
 				"out/soong/.intermediates/gen/gen/gensrcs/in3.h",
 			},
 		},
+		{
+			name: "stable shards",
+			prop: `
+				tools: ["tool"],
+				srcs: ["in1.txt", "in2.txt", "in3.txt"],
+				cmd: "$(location) $(in) > $(out)",
+				shards: 2,
+			`,
+			cmds: []string{
+				"bash -c '__SBOX_SANDBOX_DIR__/tools/out/bin/tool in2.txt > __SBOX_SANDBOX_DIR__/out/in2.h'",
+				"bash -c '__SBOX_SANDBOX_DIR__/tools/out/bin/tool in1.txt > __SBOX_SANDBOX_DIR__/out/in1.h' && bash -c '__SBOX_SANDBOX_DIR__/tools/out/bin/tool in3.txt > __SBOX_SANDBOX_DIR__/out/in3.h'",
+			},
+			deps: []string{
+				"out/soong/.intermediates/gen/gen/gensrcs/in2.h",
+				"out/soong/.intermediates/gen/gen/gensrcs/in1.h",
+				"out/soong/.intermediates/gen/gen/gensrcs/in3.h",
+			},
+			files: []string{
+				"out/soong/.intermediates/gen/gen/gensrcs/in2.h",
+				"out/soong/.intermediates/gen/gen/gensrcs/in1.h",
+				"out/soong/.intermediates/gen/gen/gensrcs/in3.h",
+			},
+		},
+		{
+			name: "shards and shard_size",
+			prop: `
+				tools: ["tool"],
+				srcs: ["in1.txt"],
+				cmd: "$(location) $(in) > $(out)",
+				shards: 2,
+				shard_size: 2,
+			`,
+			err: "cannot be set together with shard_size",
+		},
+		{
+			name: "no shards",
+			prop: `
+				tools: ["tool"],
+				srcs: ["in1.txt"],
+				cmd: "$(location) $(in) > $(out)",
+				shards: 0,
+			`,
+			err: "must be positive, got 0",
+		},
 	}
 
 	for _, test := range testcases {
@@ -686,6 +730,67 @@ func TestGenruleAllowMissingDependencies(t *testing.T) {
 	}
 }
 
+func TestGenruleNinjaPool(t *testing.T) {
+	bp := `
+		genrule {
+			name: "gen",
+			out: ["out"],
+			cmd: "echo foo > $(out)",
+			ninja_pool: "heavy_pool",
+		}
+
+		genrule {
+			name: "gen_default_pool",
+			out: ["out"],
+			cmd: "echo foo > $(out)",
+		}
+	`
+	prepareNinjaPools := android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+		variables.NinjaPools = []android.NinjaPool{
+			{Name: "heavy_pool", Depth: 2, Modules: []string{"gen"}},
+			{Name: "other_pool", Depth: 1},
+		}
+	})
+
+	result := android.GroupFixturePreparers(prepareForGenRuleTest, prepareNinjaPools).RunTestWithBp(t, bp)
+
+	pool := result.ModuleForTests("gen", "").Output("out").RuleParams.Pool
+	if pool == nil || pool.String() != "heavy_pool" {
+		t.Errorf("expected gen to run in heavy_pool, got %v", pool)
+	}
+	if pool := result.ModuleForTests("gen_default_pool", "").Output("out").RuleParams.Pool; pool != nil {
+		t.Errorf("expected gen_default_pool to run in the default pool, got %q", pool.String())
+	}
+
+	t.Run("undefined pool", func(t *testing.T) {
+		android.GroupFixturePreparers(prepareForGenRuleTest, prepareNinjaPools).
+			ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`ninja_pool: ninja pool "missing_pool" is not defined in the NinjaPools of the product`)).
+			RunTestWithBp(t, `
+				genrule {
+					name: "gen",
+					out: ["out"],
+					cmd: "echo foo > $(out)",
+					ninja_pool: "missing_pool",
+				}
+			`)
+	})
+
+	t.Run("module not allowed", func(t *testing.T) {
+		android.GroupFixturePreparers(prepareForGenRuleTest, prepareNinjaPools).
+			ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`ninja_pool: module "gen" is not in the modules allowed to use ninja pool "other_pool"`)).
+			RunTestWithBp(t, `
+				genrule {
+					name: "gen",
+					out: ["out"],
+					cmd: "echo foo > $(out)",
+					ninja_pool: "other_pool",
+				}
+			`)
+	})
+}
+
 func TestGenruleOutputFiles(t *testing.T) {
 	bp := `
 				genrule {
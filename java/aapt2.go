@@ -177,15 +177,27 @@ var mergeAssetsRule = pctx.AndroidStaticRule("mergeAssets",
 func aapt2Link(ctx android.ModuleContext,
 	packageRes, genJar, proguardOptions, rTxt, extraPackages android.WritablePath,
 	flags []string, deps android.Paths,
-	compiledRes, compiledOverlay, assetPackages android.Paths, splitPackages android.WritablePaths) {
+	compiledRes, compiledOverlay, assetPackages android.Paths, extraOutputs android.WritablePaths) {
 
-	genDir := android.PathForModuleGen(ctx, "aapt2", "R")
+	aapt2LinkInDir(ctx, "aapt2", packageRes, genJar, proguardOptions, rTxt, extraPackages,
+		flags, deps, compiledRes, compiledOverlay, assetPackages, extraOutputs)
+}
+
+// aapt2LinkInDir is aapt2Link with the intermediate files placed in dir, relative to the module
+// out and gen directories, so that the same resources can be linked more than once in a module.
+// extraOutputs are the outputs of the flags passed by the caller, e.g. the split packages.
+func aapt2LinkInDir(ctx android.ModuleContext, dir string,
+	packageRes, genJar, proguardOptions, rTxt, extraPackages android.WritablePath,
+	flags []string, deps android.Paths,
+	compiledRes, compiledOverlay, assetPackages android.Paths, extraOutputs android.WritablePaths) {
+
+	genDir := android.PathForModuleGen(ctx, dir, "R")
 
 	var inFlags []string
 
 	if len(compiledRes) > 0 {
 		// Create a file that contains the list of all compiled resource file paths.
-		resFileList := android.PathForModuleOut(ctx, "aapt2", "res.list")
+		resFileList := android.PathForModuleOut(ctx, dir, "res.list")
 		// Write out file lists to files
 		ctx.Build(pctx, android.BuildParams{
 			Rule:        fileListToFileRule,
@@ -202,7 +214,7 @@ func aapt2Link(ctx android.ModuleContext,
 
 	if len(compiledOverlay) > 0 {
 		// Compiled overlay files are processed the same way as compiled resources.
-		overlayFileList := android.PathForModuleOut(ctx, "aapt2", "overlay.list")
+		overlayFileList := android.PathForModuleOut(ctx, dir, "overlay.list")
 		ctx.Build(pctx, android.BuildParams{
 			Rule:        fileListToFileRule,
 			Description: "overlay resource file list",
@@ -217,12 +229,12 @@ func aapt2Link(ctx android.ModuleContext,
 	}
 
 	// Set auxiliary outputs as implicit outputs to establish correct dependency chains.
-	implicitOutputs := append(splitPackages, proguardOptions, genJar, rTxt, extraPackages)
+	implicitOutputs := append(extraOutputs, proguardOptions, genJar, rTxt, extraPackages)
 	linkOutput := packageRes
 
 	// AAPT2 ignores assets in overlays. Merge them after linking.
 	if len(assetPackages) > 0 {
-		linkOutput = android.PathForModuleOut(ctx, "aapt2", "package-res.apk")
+		linkOutput = android.PathForModuleOut(ctx, dir, "package-res.apk")
 		inputZips := append(android.Paths{linkOutput}, assetPackages...)
 		ctx.Build(pctx, android.BuildParams{
 			Rule:        mergeAssetsRule,
@@ -238,7 +250,7 @@ func aapt2Link(ctx android.ModuleContext,
 		Implicits:       deps,
 		Output:          linkOutput,
 		ImplicitOutputs: implicitOutputs,
-		// Note the absence of splitPackages. The caller is supposed to compose and provide --split flag
+		// Note the absence of extraOutputs. The caller is supposed to compose and provide --split flag
 		// values via the flags parameter when it wants to split outputs.
 		// TODO(b/174509108): Perhaps we can process it in this func while keeping the code reasonably
 		// tidy.
@@ -256,17 +268,21 @@ func aapt2Link(ctx android.ModuleContext,
 
 var aapt2ConvertRule = pctx.AndroidStaticRule("aapt2Convert",
 	blueprint.RuleParams{
-		Command:     `${config.Aapt2Cmd} convert --output-format proto $in -o $out`,
+		Command:     `${config.Aapt2Cmd} convert --output-format $format $in -o $out`,
 		CommandDeps: []string{"${config.Aapt2Cmd}"},
-	})
+	}, "format")
 
-// Converts xml files and resource tables (resources.arsc) in the given jar/apk file to a proto
-// format. The proto definition is available at frameworks/base/tools/aapt2/Resources.proto.
-func aapt2Convert(ctx android.ModuleContext, out android.WritablePath, in android.Path) {
+// Converts xml files and resource tables (resources.arsc) in the given jar/apk file to the given
+// format, either "proto" or "binary". The proto definition is available at
+// frameworks/base/tools/aapt2/Resources.proto.
+func aapt2Convert(ctx android.ModuleContext, out android.WritablePath, in android.Path, format string) {
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        aapt2ConvertRule,
 		Input:       in,
 		Output:      out,
-		Description: "convert to proto",
+		Description: "convert to " + format,
+		Args: map[string]string{
+			"format": format,
+		},
 	})
 }
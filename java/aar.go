@@ -17,6 +17,7 @@ package java
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -59,7 +60,8 @@ type androidLibraryProperties struct {
 }
 
 type aaptProperties struct {
-	// flags passed to aapt when creating the apk
+	// flags passed to aapt when creating the apk. Only the aapt2 link flags that don't control the
+	// inputs and outputs of aapt2 are allowed.
 	Aaptflags []string
 
 	// include all resource configurations, not just the product-configured
@@ -88,12 +90,38 @@ type aaptProperties struct {
 	// do not include AndroidManifest from dependent libraries
 	Dont_merge_manifests *bool
 
+	// Options of the manifest merger, which merges additional_manifests and the manifests of the
+	// static libraries into the main manifest.
+	Manifest_merger manifestMergerProperties
+
+	// Options passed to aapt2 link. Prefer these to the equivalent flags in aaptflags as they are
+	// validated and exported to dependent modules through AaptLinkOptionsProvider.
+	Aapt2_link_options aapt2LinkOptionsProperties
+
 	// true if RRO is enforced for any of the dependent modules
 	RROEnforcedForDependent bool `blueprint:"mutated"`
 }
 
+type aapt2LinkOptionsProperties struct {
+	// file assigning stable resource IDs, passed to aapt2 link --stable-ids.
+	Stable_ids *string `android:"path"`
+
+	// base APK that this APK is a feature split of, passed to aapt2 link --feature-of. May be a
+	// reference to an android_app module, e.g. ":MyApp".
+	Feature_of *string `android:"path"`
+
+	// package ID assigned to the resources, e.g. "0x80", passed to aapt2 link --package-id.
+	// Must be between 0x02 and 0xff, IDs below 0x7f are reserved for the platform.
+	Package_id *string
+
+	// resource configurations to exclude from the APK, e.g. ["en-rGB", "sw600dp"], passed to
+	// aapt2 link --exclude-configs.
+	Exclude_configs []string
+}
+
 type aapt struct {
 	aaptSrcJar              android.Path
+	linkOptions             AaptLinkOptionsInfo
 	exportPackage           android.Path
 	manifestPath            android.Path
 	transitiveManifestPaths android.Paths
@@ -102,6 +130,7 @@ type aapt struct {
 	rTxt                    android.Path
 	extraAaptPackagesFile   android.Path
 	mergedManifestFile      android.Path
+	manifestMergeReport     android.Path
 	noticeFile              android.OptionalPath
 	assetPackage            android.OptionalPath
 	isLibrary               bool
@@ -115,6 +144,28 @@ type aapt struct {
 	splitNames []string
 	splits     []split
 
+	// The number of test shards to build resource packages for, and the manifests and resource
+	// packages, one per shard, each with the shard index and count in the metadata of its manifest.
+	shardCount     int
+	shardManifests android.Paths
+	shards         android.Paths
+
+	// The manifest and resource values of the runtime resource overlay generated for a test, and
+	// the resulting resource package.
+	testOverlayManifest android.Path
+	testOverlayRes      *globbedResourceDir
+	testOverlayPackage  android.Path
+
+	// The locale configs the resources are filtered to, and the resource package linked without
+	// filtering them, used to report the size saved by the filtering.
+	filterLocales     []string
+	unfilteredPackage android.Path
+
+	// Whether to generate the rules that keep the classes referenced by the manifest in the main
+	// dex file, and the generated rules.
+	generateMainDexRules       bool
+	mainDexProguardOptionsFile android.Path
+
 	aaptProperties aaptProperties
 }
 
@@ -163,6 +214,171 @@ func (a *aapt) IsRROEnforced(ctx android.BaseModuleContext) bool {
 		a.aaptProperties.RROEnforcedForDependent
 }
 
+// AaptLinkOptionsInfo contains the structured aapt2 link options of a module with Android
+// resources.
+type AaptLinkOptionsInfo struct {
+	// The file assigning stable resource IDs, if any.
+	StableIds android.Path
+
+	// The base APK that the APK of the module is a feature split of, if any.
+	FeatureOf android.Path
+
+	// The package ID assigned to the resources, or 0 if the default is used.
+	PackageId int
+
+	// The resource configurations excluded from the APK.
+	ExcludeConfigs []string
+}
+
+var AaptLinkOptionsProvider = blueprint.NewProvider(AaptLinkOptionsInfo{})
+
+// Flags in aaptflags that are replaced by the properties in aapt2_link_options, mapped to the name
+// of the property.
+var aapt2LinkOptionFlags = map[string]string{
+	"--stable-ids":      "stable_ids",
+	"--feature-of":      "feature_of",
+	"--package-id":      "package_id",
+	"--exclude-configs": "exclude_configs",
+}
+
+// The aapt2 link flags that may be set in aaptflags. The flags that control the inputs and outputs
+// of aapt2, like -o, -I, --manifest or --java, are set by the build and are not allowed.
+var aapt2AllowedLinkFlags = []string{
+	"-0",
+	"-c",
+	"-z",
+	"--add-javadoc-annotation",
+	"--allow-reserved-package-id",
+	"--auto-add-overlay",
+	"--compile-sdk-version-code",
+	"--compile-sdk-version-name",
+	"--custom-package",
+	"--debug-mode",
+	"--emit-ids",
+	"--enable-sparse-encoding",
+	"--exclude-configs",
+	"--exclude-sources",
+	"--extra-packages",
+	"--feature-of",
+	"--keep-raw-values",
+	"--min-sdk-version",
+	"--no-auto-version",
+	"--no-compress",
+	"--no-compress-regex",
+	"--no-proguard-location-reference",
+	"--no-resource-deduping",
+	"--no-resource-removal",
+	"--no-static-lib-packages",
+	"--no-version-transitions",
+	"--no-version-vectors",
+	"--no-xml-namespaces",
+	"--non-final-ids",
+	"--override-styles-instead-of-overlaying",
+	"--package-id",
+	"--preferred-density",
+	"--private-symbols",
+	"--product",
+	"--rename-instrumentation-target-package",
+	"--rename-manifest-package",
+	"--rename-resources-package",
+	"--replace-version",
+	"--shared-lib",
+	"--stable-ids",
+	"--strict-visibility",
+	"--target-sdk-version",
+	"--version-code",
+	"--version-code-major",
+	"--version-name",
+	"--warn-manifest-validation",
+}
+
+// aapt2LinkOptionSet returns true if the property in aapt2_link_options is set.
+func aapt2LinkOptionSet(props *aapt2LinkOptionsProperties, prop string) bool {
+	switch prop {
+	case "stable_ids":
+		return props.Stable_ids != nil
+	case "feature_of":
+		return props.Feature_of != nil
+	case "package_id":
+		return props.Package_id != nil
+	case "exclude_configs":
+		return len(props.Exclude_configs) > 0
+	}
+	return false
+}
+
+var aapt2ResourceConfigRegexp = regexp.MustCompile(`^[a-zA-Z0-9+-]+$`)
+
+// aapt2LinkOptions validates the properties in aapt2_link_options and converts them into
+// AaptLinkOptionsInfo.
+func (a *aapt) aapt2LinkOptions(ctx android.ModuleContext) AaptLinkOptionsInfo {
+	props := &a.aaptProperties.Aapt2_link_options
+	var info AaptLinkOptionsInfo
+
+	for _, flag := range a.aaptProperties.Aaptflags {
+		fields := strings.Fields(flag)
+		if len(fields) == 0 {
+			continue
+		}
+		// Values may be in the same element as their flag or in the next one, so only the elements
+		// that start with a dash are checked.
+		if strings.HasPrefix(fields[0], "-") && !android.InList(fields[0], aapt2AllowedLinkFlags) {
+			ctx.PropertyErrorf("aaptflags", "%q is not an allowed aapt2 link flag", fields[0])
+		}
+		// An option must not be set in both places, otherwise the flags passed to aapt2 would not
+		// match the exported information.
+		if prop, ok := aapt2LinkOptionFlags[fields[0]]; ok && aapt2LinkOptionSet(props, prop) {
+			ctx.PropertyErrorf("aaptflags", "%q conflicts with aapt2_link_options.%s", flag, prop)
+		}
+	}
+
+	if props.Stable_ids != nil {
+		info.StableIds = android.PathForModuleSrc(ctx, *props.Stable_ids)
+	}
+	if props.Feature_of != nil {
+		info.FeatureOf = android.PathForModuleSrc(ctx, *props.Feature_of)
+	}
+	if props.Package_id != nil {
+		id, err := strconv.ParseInt(*props.Package_id, 0, 0)
+		if err != nil || id < 0x02 || id > 0xff {
+			ctx.PropertyErrorf("aapt2_link_options.package_id",
+				"must be an integer between 0x02 and 0xff, got %q", *props.Package_id)
+		} else {
+			info.PackageId = int(id)
+		}
+	}
+	for _, config := range props.Exclude_configs {
+		if !aapt2ResourceConfigRegexp.MatchString(config) {
+			ctx.PropertyErrorf("aapt2_link_options.exclude_configs", "invalid resource configuration %q", config)
+		}
+	}
+	info.ExcludeConfigs = android.FirstUniqueStrings(props.Exclude_configs)
+
+	return info
+}
+
+// flags returns the aapt2 link flags and their dependencies for the options.
+func (info AaptLinkOptionsInfo) flags() (flags []string, deps android.Paths) {
+	if info.StableIds != nil {
+		flags = append(flags, "--stable-ids", info.StableIds.String())
+		deps = append(deps, info.StableIds)
+	}
+	if info.FeatureOf != nil {
+		flags = append(flags, "--feature-of", info.FeatureOf.String())
+		deps = append(deps, info.FeatureOf)
+	}
+	if info.PackageId != 0 {
+		flags = append(flags, "--package-id", fmt.Sprintf("0x%02x", info.PackageId))
+		if info.PackageId < 0x7f {
+			flags = append(flags, "--allow-reserved-package-id")
+		}
+	}
+	if len(info.ExcludeConfigs) > 0 {
+		flags = append(flags, "--exclude-configs", strings.Join(info.ExcludeConfigs, ","))
+	}
+	return flags, deps
+}
+
 func (a *aapt) aapt2Flags(ctx android.ModuleContext, sdkContext android.SdkContext,
 	manifestPath android.Path) (compileFlags, linkFlags []string, linkDeps android.Paths,
 	resDirs, overlayDirs []globbedResourceDir, rroDirs []rroDir, resZips android.Paths) {
@@ -173,6 +389,11 @@ func (a *aapt) aapt2Flags(ctx android.ModuleContext, sdkContext android.SdkConte
 	// Flags specified in Android.bp
 	linkFlags = append(linkFlags, a.aaptProperties.Aaptflags...)
 
+	a.linkOptions = a.aapt2LinkOptions(ctx)
+	linkOptionFlags, linkOptionDeps := a.linkOptions.flags()
+	linkFlags = append(linkFlags, linkOptionFlags...)
+	linkDeps = append(linkDeps, linkOptionDeps...)
+
 	linkFlags = append(linkFlags, "--no-static-lib-packages")
 
 	// Find implicit or explicit asset and resource dirs
@@ -269,6 +490,145 @@ var extractAssetsRule = pctx.AndroidStaticRule("extractAssets",
 		CommandDeps: []string{"${config.Zip2ZipCmd}"},
 	})
 
+var addTestShardMetadataRule = pctx.AndroidStaticRule("addTestShardMetadata",
+	blueprint.RuleParams{
+		Command: `grep -q '</application>' $in || ` +
+			`{ echo "$in: test shards require an <application> element with a closing tag" >&2; exit 1; } && ` +
+			`sed -e 's#</application>#<meta-data android:name="android.test.shard_index" android:value="$shardIndex" />` +
+			`<meta-data android:name="android.test.shard_count" android:value="$shardCount" /></application>#' $in > $out`,
+	}, "shardIndex", "shardCount")
+
+var replaceManifestRule = pctx.AndroidStaticRule("replaceManifest",
+	blueprint.RuleParams{
+		Command: `${config.Zip2ZipCmd} -i $manifestPackage -o $out.manifest AndroidManifest.xml && ` +
+			`${config.MergeZipsCmd} -ignore-duplicates $out $out.manifest $in && rm -f $out.manifest`,
+		CommandDeps: []string{"${config.Zip2ZipCmd}", "${config.MergeZipsCmd}"},
+	}, "manifestPackage")
+
+// buildShardPackage returns the resource package of test shard shardIndex, which is packageRes
+// with its manifest replaced by one that has the metadata of the shard added to it. Only the
+// manifest is linked again, the resources are linked once for all the shards.
+func (a *aapt) buildShardPackage(ctx android.ModuleContext, shardIndex int, manifestPath, packageRes android.Path,
+	linkFlags []string, linkDeps android.Paths) android.Path {
+
+	dir := filepath.Join("shards", strconv.Itoa(shardIndex))
+	shardManifest := android.PathForModuleOut(ctx, dir, "AndroidManifest.xml")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        addTestShardMetadataRule,
+		Description: "add test shard metadata",
+		Input:       manifestPath,
+		Output:      shardManifest,
+		Args: map[string]string{
+			"shardIndex": strconv.Itoa(shardIndex),
+			"shardCount": strconv.Itoa(a.shardCount),
+		},
+	})
+	a.shardManifests = append(a.shardManifests, shardManifest)
+
+	// The resources referenced by the manifest are resolved against the resource package of the
+	// test, the same way a feature split links against its base, so the manifest is linked on its
+	// own with only the flags that affect it.
+	flags := []string{
+		"--manifest " + shardManifest.String(),
+		"-I " + packageRes.String(),
+		"--package-id 0x80",
+	}
+	for i := 0; i < len(linkFlags); i++ {
+		switch {
+		case (linkFlags[i] == "--version-code" || linkFlags[i] == "--version-name ") && i+1 < len(linkFlags):
+			flags = append(flags, linkFlags[i], linkFlags[i+1])
+			i++
+		case strings.HasPrefix(linkFlags[i], "-I ") || strings.HasPrefix(linkFlags[i], "--min-sdk-version ") ||
+			strings.HasPrefix(linkFlags[i], "--target-sdk-version ") || strings.HasPrefix(linkFlags[i], "--rename-"):
+			flags = append(flags, linkFlags[i])
+		}
+	}
+	deps := append(android.Paths{shardManifest, packageRes}, linkDeps...)
+
+	manifestPackage := android.PathForModuleOut(ctx, dir, "manifest.apk")
+	aapt2LinkInDir(ctx, filepath.Join(dir, "aapt2"), manifestPackage,
+		android.PathForModuleGen(ctx, dir, "R.srcjar"),
+		android.PathForModuleGen(ctx, dir, "proguard.options"),
+		android.PathForModuleOut(ctx, dir, "R.txt"),
+		android.PathForModuleOut(ctx, dir, "extra_packages"),
+		flags, deps, nil, nil, nil, nil)
+
+	shardPackageRes := android.PathForModuleOut(ctx, dir, "package-res.apk")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        replaceManifestRule,
+		Description: "test shard resources",
+		Input:       packageRes,
+		Implicit:    manifestPackage,
+		Output:      shardPackageRes,
+		Args: map[string]string{
+			"manifestPackage": manifestPackage.String(),
+		},
+	})
+	return shardPackageRes
+}
+
+// buildTestOverlayPackage compiles the resource values of the runtime resource overlay generated
+// for a test and links them against the same SDK as the test, and returns the resulting resource
+// package.
+func (a *aapt) buildTestOverlayPackage(ctx android.ModuleContext, linkFlags []string,
+	linkDeps android.Paths) android.Path {
+
+	dir := "overlay_for_test"
+	compiledRes := aapt2Compile(ctx, a.testOverlayRes.dir, a.testOverlayRes.files, nil).Paths()
+
+	// The overlay contains no code and only the overridden values, it only needs the SDK and the
+	// shared libraries of the test to resolve the resources it references.
+	flags := []string{
+		"--manifest " + a.testOverlayManifest.String(),
+		"--no-resource-deduping",
+		"--no-resource-removal",
+	}
+	for _, flag := range linkFlags {
+		if strings.HasPrefix(flag, "-I ") || strings.HasPrefix(flag, "--min-sdk-version ") ||
+			strings.HasPrefix(flag, "--target-sdk-version ") {
+			flags = append(flags, flag)
+		}
+	}
+	deps := append(android.Paths{a.testOverlayManifest}, linkDeps...)
+
+	packageRes := android.PathForModuleOut(ctx, dir, "package-res.apk")
+	aapt2LinkInDir(ctx, filepath.Join(dir, "aapt2"), packageRes,
+		android.PathForModuleGen(ctx, dir, "R.srcjar"),
+		android.PathForModuleGen(ctx, dir, "proguard.options"),
+		android.PathForModuleOut(ctx, dir, "R.txt"),
+		android.PathForModuleOut(ctx, dir, "extra_packages"),
+		flags, deps, compiledRes, nil, nil, nil)
+	return packageRes
+}
+
+// buildUnfilteredPackage links the resources again without filtering them to localeConfig, so that
+// the size saved by the filtering can be reported.
+func (a *aapt) buildUnfilteredPackage(ctx android.ModuleContext, localeConfig string,
+	linkFlags []string, linkDeps, compiledRes, compiledOverlay, assetPackages android.Paths) android.Path {
+
+	var flags []string
+	for i := 0; i < len(linkFlags); i++ {
+		switch {
+		case linkFlags[i] == "--split":
+			i++
+		case linkFlags[i] == "-c" && i+1 < len(linkFlags) && linkFlags[i+1] == localeConfig:
+			i++
+		default:
+			flags = append(flags, linkFlags[i])
+		}
+	}
+
+	dir := "unfiltered"
+	packageRes := android.PathForModuleOut(ctx, dir, "package-res.apk")
+	aapt2LinkInDir(ctx, filepath.Join(dir, "aapt2"), packageRes,
+		android.PathForModuleGen(ctx, dir, "R.srcjar"),
+		android.PathForModuleGen(ctx, dir, "proguard.options"),
+		android.PathForModuleOut(ctx, dir, "R.txt"),
+		android.PathForModuleOut(ctx, dir, "extra_packages"),
+		flags, linkDeps, compiledRes, compiledOverlay, assetPackages, nil)
+	return packageRes
+}
+
 func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkContext,
 	classLoaderContexts dexpreopt.ClassLoaderContextMap, excludedLibs []string,
 	extraLinkFlags ...string) {
@@ -279,6 +639,8 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 	// Exclude any libraries from the supplied list.
 	classLoaderContexts = classLoaderContexts.ExcludeLibs(excludedLibs)
 
+	checkManifestMergerProperties(ctx, a.aaptProperties.Manifest_merger)
+
 	// App manifest file
 	manifestFile := proptools.StringDefault(a.aaptProperties.Manifest, "AndroidManifest.xml")
 	manifestSrcPath := android.PathForModuleSrc(ctx, manifestFile)
@@ -292,6 +654,8 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 		UseEmbeddedDex:        a.useEmbeddedDex,
 		HasNoCode:             a.hasNoCode,
 		LoggingParent:         a.LoggingParent,
+		ToolsReplace:          a.aaptProperties.Manifest_merger.Replace,
+		ToolsNode:             a.aaptProperties.Manifest_merger.Tools_node,
 	})
 
 	// Add additional manifest files to transitive manifests.
@@ -299,13 +663,25 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 	a.transitiveManifestPaths = append(android.Paths{manifestPath}, additionalManifests...)
 	a.transitiveManifestPaths = append(a.transitiveManifestPaths, transitiveStaticLibManifests...)
 
-	if len(a.transitiveManifestPaths) > 1 && !Bool(a.aaptProperties.Dont_merge_manifests) {
-		a.mergedManifestFile = manifestMerger(ctx, a.transitiveManifestPaths[0], a.transitiveManifestPaths[1:], a.isLibrary)
+	placeholders := a.aaptProperties.Manifest_merger.Placeholders
+	if len(placeholders) > 0 {
+		if a.isLibrary {
+			ctx.PropertyErrorf("manifest_merger.placeholders",
+				"cannot be set on libraries, set them on the apps that use the library instead")
+		} else if Bool(a.aaptProperties.Dont_merge_manifests) {
+			ctx.PropertyErrorf("manifest_merger.placeholders", "cannot be set with dont_merge_manifests")
+		}
+	}
+
+	if (len(a.transitiveManifestPaths) > 1 || len(placeholders) > 0) && !Bool(a.aaptProperties.Dont_merge_manifests) {
+		a.mergedManifestFile, a.manifestMergeReport = manifestMerger(ctx, a.transitiveManifestPaths[0],
+			a.transitiveManifestPaths[1:], a.isLibrary, placeholders)
 		if !a.isLibrary {
 			// Only use the merged manifest for applications.  For libraries, the transitive closure of manifests
 			// will be propagated to the final application and merged there.  The merged manifest for libraries is
 			// only passed to Make, which can't handle transitive dependencies.
 			manifestPath = a.mergedManifestFile
+			ctx.CheckbuildFile(a.manifestMergeReport)
 		}
 	} else {
 		a.mergedManifestFile = manifestPath
@@ -317,6 +693,10 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 	linkFlags = append(linkFlags, libFlags...)
 	linkDeps = append(linkDeps, libDeps...)
 	linkFlags = append(linkFlags, extraLinkFlags...)
+	localeConfig := strings.Join(a.filterLocales, ",")
+	if localeConfig != "" {
+		linkFlags = append(linkFlags, "-c", localeConfig)
+	}
 	if a.isLibrary {
 		linkFlags = append(linkFlags, "--static-lib")
 	}
@@ -384,8 +764,32 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 		})
 	}
 
+	// The main dex rules are only generated by the main link, not by the shards and overlays that
+	// reuse linkFlags.
+	mainLinkFlags := linkFlags
+	extraOutputs := splitPackages
+	if a.generateMainDexRules {
+		mainDexProguardOptionsFile := android.PathForModuleGen(ctx, "main_dex_proguard.options")
+		mainLinkFlags = append(android.CopyOf(linkFlags), "--proguard-main-dex", mainDexProguardOptionsFile.String())
+		extraOutputs = append(android.WritablePaths{mainDexProguardOptionsFile}, splitPackages...)
+		a.mainDexProguardOptionsFile = mainDexProguardOptionsFile
+	}
+
 	aapt2Link(ctx, packageRes, srcJar, proguardOptionsFile, rTxt, extraPackages,
-		linkFlags, linkDeps, compiledRes, compiledOverlay, assetPackages, splitPackages)
+		mainLinkFlags, linkDeps, compiledRes, compiledOverlay, assetPackages, extraOutputs)
+
+	for i := 0; i < a.shardCount; i++ {
+		a.shards = append(a.shards, a.buildShardPackage(ctx, i, manifestPath, packageRes, linkFlags, linkDeps))
+	}
+
+	if a.testOverlayManifest != nil {
+		a.testOverlayPackage = a.buildTestOverlayPackage(ctx, linkFlags, linkDeps)
+	}
+
+	if localeConfig != "" {
+		a.unfilteredPackage = a.buildUnfilteredPackage(ctx, localeConfig, linkFlags, linkDeps,
+			compiledRes, compiledOverlay, assetPackages)
+	}
 
 	// Extract assets from the resource package output so that they can be used later in aapt2link
 	// for modules that depend on this one.
@@ -408,6 +812,8 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext android.SdkCon
 	a.extraAaptPackagesFile = extraPackages
 	a.rTxt = rTxt
 	a.splits = splits
+
+	ctx.SetProvider(AaptLinkOptionsProvider, a.linkOptions)
 }
 
 // aaptLibs collects libraries from dependencies and sdk_version and converts them into paths
@@ -16,10 +16,12 @@ package java
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
 	"android/soong/dexpreopt"
@@ -40,6 +42,86 @@ var manifestMergerRule = pctx.AndroidStaticRule("manifestMerger",
 	},
 	"args", "libs")
 
+var manifestMergeReportRule = pctx.AndroidStaticRule("manifestMergeReport",
+	blueprint.RuleParams{
+		Command:     `${config.ManifestMergeReportCmd} --main $main $libs --merged $in --out $out`,
+		CommandDeps: []string{"${config.ManifestMergeReportCmd}"},
+	},
+	"main", "libs")
+
+type manifestMergerProperties struct {
+	// attributes of elements of the main manifest that replace the ones of the merged manifests,
+	// in the form <element>=<attribute>[,<attribute>...], e.g. "application=android:label". They
+	// are added to the tools:replace attribute of the element. The element is either a tag, e.g.
+	// "application", or a tag followed by an android:name in brackets, e.g.
+	// "activity[com.example.Main]".
+	Replace []string
+
+	// merge rules of elements, in the form <element>=<rule>, e.g.
+	// "service[com.example.lib.Service]=remove", where the rule is one of merge,
+	// merge-only-attributes, remove, removeAll, replace or strict. It is set as the tools:node
+	// attribute of the element, which is added to the main manifest if it is missing.
+	Tools_node []string
+
+	// values of the ${name} placeholders of the manifests, in the form <name>=<value>. They are
+	// substituted by the manifest merger, which runs for apps even when there are no manifests to
+	// merge. They cannot be set on libraries, whose manifests are merged into the manifest of the
+	// app, nor with dont_merge_manifests.
+	Placeholders []string
+}
+
+var (
+	manifestElementRegexp     = regexp.MustCompile(`^[a-z][a-z-]*(\[[^\[\]=]+\])?$`)
+	manifestAttributeRegexp   = regexp.MustCompile(`^[a-zA-Z]+:[a-zA-Z]+$`)
+	manifestPlaceholderRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+	manifestMergeRules = []string{"merge", "merge-only-attributes", "remove", "removeAll", "replace", "strict"}
+)
+
+// splitManifestMergerEntry splits an entry of the manifest_merger properties at its first '='.
+func splitManifestMergerEntry(entry string) (string, string, bool) {
+	if i := strings.Index(entry, "="); i >= 0 {
+		return entry[:i], entry[i+1:], true
+	}
+	return entry, "", false
+}
+
+// checkManifestMergerProperties reports errors for the malformed entries of the manifest_merger
+// properties.
+func checkManifestMergerProperties(ctx android.ModuleContext, props manifestMergerProperties) {
+	for _, replace := range props.Replace {
+		element, attributes, ok := splitManifestMergerEntry(replace)
+		if !ok || !manifestElementRegexp.MatchString(element) || attributes == "" {
+			ctx.PropertyErrorf("manifest_merger.replace",
+				"%q must be in the form <element>=<attribute>[,<attribute>...]", replace)
+			continue
+		}
+		for _, attribute := range strings.Split(attributes, ",") {
+			if !manifestAttributeRegexp.MatchString(attribute) {
+				ctx.PropertyErrorf("manifest_merger.replace",
+					"%q has invalid attribute %q, must be in the form <namespace>:<name>", replace, attribute)
+			}
+		}
+	}
+
+	for _, node := range props.Tools_node {
+		element, rule, ok := splitManifestMergerEntry(node)
+		if !ok || !manifestElementRegexp.MatchString(element) {
+			ctx.PropertyErrorf("manifest_merger.tools_node", "%q must be in the form <element>=<rule>", node)
+		} else if !android.InList(rule, manifestMergeRules) {
+			ctx.PropertyErrorf("manifest_merger.tools_node", "%q has invalid rule %q, must be one of %s",
+				node, rule, strings.Join(manifestMergeRules, ", "))
+		}
+	}
+
+	for _, placeholder := range props.Placeholders {
+		name, _, ok := splitManifestMergerEntry(placeholder)
+		if !ok || !manifestPlaceholderRegexp.MatchString(name) {
+			ctx.PropertyErrorf("manifest_merger.placeholders", "%q must be in the form <name>=<value>", placeholder)
+		}
+	}
+}
+
 // targetSdkVersion for manifest_fixer
 // When TARGET_BUILD_APPS is not empty, this method returns 10000 for modules targeting an unreleased SDK
 // This enables release builds (that run with TARGET_BUILD_APPS=[val...]) to target APIs that have not yet been finalized as part of an SDK
@@ -65,6 +147,8 @@ type ManifestFixerParams struct {
 	HasNoCode             bool
 	TestOnly              bool
 	LoggingParent         string
+	ToolsReplace          []string
+	ToolsNode             []string
 }
 
 // Uses manifest_fixer.py to inject minSdkVersion, etc. into an AndroidManifest.xml
@@ -119,6 +203,15 @@ func ManifestFixer(ctx android.ModuleContext, manifest android.Path,
 	if params.LoggingParent != "" {
 		args = append(args, "--logging-parent", params.LoggingParent)
 	}
+
+	for _, replace := range params.ToolsReplace {
+		args = append(args, "--tools-replace", proptools.ShellEscape(replace))
+	}
+
+	for _, node := range params.ToolsNode {
+		args = append(args, "--tools-node", proptools.ShellEscape(node))
+	}
+
 	var deps android.Paths
 	var argsMapper = make(map[string]string)
 
@@ -163,27 +256,45 @@ func ManifestFixer(ctx android.ModuleContext, manifest android.Path,
 	return fixedManifest.WithoutRel()
 }
 
+// manifestMerger merges the manifests of the static libraries into the main manifest, and
+// generates a report of the origin of each element and attribute of the merged manifest.
 func manifestMerger(ctx android.ModuleContext, manifest android.Path, staticLibManifests android.Paths,
-	isLibrary bool) android.Path {
+	isLibrary bool, placeholders []string) (mergedManifest android.Path, mergeReport android.Path) {
 
-	var args string
+	var args []string
 	if !isLibrary {
 		// Follow Gradle's behavior, only pass --remove-tools-declarations when merging app manifests.
-		args = "--remove-tools-declarations"
+		args = append(args, "--remove-tools-declarations")
+	}
+	for _, placeholder := range placeholders {
+		args = append(args, "--placeholder", proptools.ShellEscape(placeholder))
 	}
 
-	mergedManifest := android.PathForModuleOut(ctx, "manifest_merger", "AndroidManifest.xml")
+	merged := android.PathForModuleOut(ctx, "manifest_merger", "AndroidManifest.xml")
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        manifestMergerRule,
 		Description: "merge manifest",
 		Input:       manifest,
 		Implicits:   staticLibManifests,
-		Output:      mergedManifest,
+		Output:      merged,
+		Args: map[string]string{
+			"libs": android.JoinWithPrefix(staticLibManifests.Strings(), "--libs "),
+			"args": strings.Join(args, " "),
+		},
+	})
+
+	report := android.PathForModuleOut(ctx, "manifest_merger", "merge_report.tsv")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        manifestMergeReportRule,
+		Description: "manifest merge report",
+		Input:       merged,
+		Implicits:   append(android.Paths{manifest}, staticLibManifests...),
+		Output:      report,
 		Args: map[string]string{
+			"main": manifest.String(),
 			"libs": android.JoinWithPrefix(staticLibManifests.Strings(), "--libs "),
-			"args": args,
 		},
 	})
 
-	return mergedManifest.WithoutRel()
+	return merged.WithoutRel(), report
 }
@@ -18,7 +18,11 @@ package java
 // related module types, including their override variants.
 
 import (
+	"fmt"
+	"html"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/google/blueprint"
@@ -55,6 +59,12 @@ type appProperties struct {
 	// use to get PRODUCT-agnostic resource data like IDs and type definitions.
 	Export_package_resources *bool
 
+	// If set, generate the rules that keep the classes referenced by the manifest, like the
+	// application and its components, in the main dex file, and check that they are in it.  Only
+	// used when min_sdk_version is lower than 21, as later releases support multidex natively.
+	// Defaults to true.
+	Generate_main_dex_rules *bool
+
 	// Specifies that this app should be installed to the priv-app directory,
 	// where the system will grant it additional privileges not available to
 	// normal apps.
@@ -63,6 +73,10 @@ type appProperties struct {
 	// list of resource labels to generate individual resource packages
 	Package_splits []string
 
+	// If false, keep the resources of all locales instead of only those of the product locales
+	// (PRODUCT_LOCALES) when the app is preinstalled. Defaults to true.
+	Filter_product_locales *bool
+
 	// list of native libraries that will be provided in or alongside the resulting jar
 	Jni_libs []string `android:"arch_variant"`
 
@@ -97,6 +111,17 @@ type appProperties struct {
 	// it in the APK as an asset.
 	Embed_notices *bool
 
+	// If set, include the proguard dictionary of the app in the symbols archive of the build, which
+	// is used to deobfuscate its stack traces.
+	Symbols_archive *bool
+
+	// Classes that may be contributed with different contents by more than one of the sources and
+	// static_libs of the app, e.g. "com.example.Foo", "com.example.*" for the classes in a package
+	// or "com.example.**" for the classes in a package and its subpackages. When the
+	// CheckDuplicateClasses product variable is set, any other such class is reported as an error,
+	// along with the modules that contribute it, before the app is dexed.
+	Allowed_duplicate_classes []string
+
 	// cc.Coverage related properties
 	PreventInstall    bool `blueprint:"mutated"`
 	IsCoverageVariant bool `blueprint:"mutated"`
@@ -120,6 +145,12 @@ type overridableAppProperties struct {
 	// For overriding the --rotation-min-sdk-version property of apksig
 	RotationMinSdkVersion *string
 
+	// The android_app_certificate module, in the form ":module", that signed the app before its
+	// signing key was rotated to certificate. The app is signed with both, so that devices that do
+	// not support the rotation, e.g. those older than rotationMinSdkVersion, verify the app with
+	// the original certificate. Requires lineage.
+	Original_certificate *string
+
 	// the package name of this app. The package name in the manifest file is used if one was not given.
 	Package_name *string
 
@@ -142,9 +173,13 @@ type AndroidApp struct {
 	Library
 	aapt
 	android.OverridableModuleBase
+	TransparencyLog
 
 	certificate Certificate
 
+	// The certificate that signed the app before its signing key was rotated to certificate, if any.
+	originalCertificate Certificate
+
 	appProperties appProperties
 
 	overridableAppProperties overridableAppProperties
@@ -156,6 +191,9 @@ type AndroidApp struct {
 
 	bundleFile android.Path
 
+	// The signed test shard APKs, which are shipped with the test instead of being installed.
+	testShardFiles android.Paths
+
 	// the install APK name is normally the same as the module name, but can be overridden with PRODUCT_PACKAGE_NAME_OVERRIDES.
 	installApkName string
 
@@ -192,6 +230,12 @@ func (a *AndroidApp) Certificate() Certificate {
 	return a.certificate
 }
 
+// OriginalCertificate returns the certificate that signed the app before its signing key was
+// rotated to the one returned by Certificate, or false if the key was not rotated.
+func (a *AndroidApp) OriginalCertificate() (Certificate, bool) {
+	return a.originalCertificate, a.originalCertificate.Pem != nil
+}
+
 func (a *AndroidApp) JniCoverageOutputs() android.Paths {
 	return a.jniCoverageOutputs
 }
@@ -269,6 +313,15 @@ func (a *AndroidApp) OverridablePropertiesDepsMutator(ctx android.BottomUpMutato
 				`must be names of android_app_certificate modules in the form ":module"`)
 		}
 	}
+
+	if cert := String(a.overridableAppProperties.Original_certificate); cert != "" {
+		if module := android.SrcIsModule(cert); module != "" {
+			ctx.AddDependency(ctx.Module(), originalCertificateTag, module)
+		} else {
+			ctx.PropertyErrorf("original_certificate",
+				`must be the name of an android_app_certificate module in the form ":module"`)
+		}
+	}
 }
 
 func (a *AndroidTestHelperApp) GenerateAndroidBuildActions(ctx android.ModuleContext) {
@@ -407,6 +460,11 @@ func (a *AndroidApp) aaptBuildActions(ctx android.ModuleContext) {
 		if len(ctx.Config().ProductAAPTPreferredConfig()) > 0 {
 			aaptLinkFlags = append(aaptLinkFlags, "--preferred-density", ctx.Config().ProductAAPTPreferredConfig())
 		}
+
+		// Product locales
+		if a.shouldFilterProductLocales(ctx) {
+			a.aapt.filterLocales = aaptLocaleConfigs(ctx.Config().ProductLocales())
+		}
 	}
 
 	manifestPackageName, overridden := ctx.DeviceConfig().OverrideManifestPackageNameFor(ctx.ModuleName())
@@ -421,6 +479,7 @@ func (a *AndroidApp) aaptBuildActions(ctx android.ModuleContext) {
 
 	aaptLinkFlags = append(aaptLinkFlags, a.additionalAaptFlags...)
 
+	a.aapt.generateMainDexRules = a.generatesMainDexRules(ctx)
 	a.aapt.splitNames = a.appProperties.Package_splits
 	a.aapt.LoggingParent = String(a.overridableAppProperties.Logging_parent)
 	a.aapt.buildActions(ctx, android.SdkContext(a), a.classLoaderContexts,
@@ -430,6 +489,15 @@ func (a *AndroidApp) aaptBuildActions(ctx android.ModuleContext) {
 	a.properties.Manifest = nil
 }
 
+// Preinstalled apps only keep the resources of the product locales, unless they set
+// filter_product_locales: false.
+func (a *AndroidApp) shouldFilterProductLocales(ctx android.ModuleContext) bool {
+	if len(ctx.Config().ProductLocales()) == 0 || ctx.Config().UnbundledBuild() || ctx.InstallInTestcases() {
+		return false
+	}
+	return proptools.BoolDefault(a.appProperties.Filter_product_locales, true)
+}
+
 func (a *AndroidApp) proguardBuildActions(ctx android.ModuleContext) {
 	var staticLibProguardFlagFiles android.Paths
 	ctx.VisitDirectDeps(func(m android.Module) {
@@ -461,6 +529,27 @@ func (a *AndroidApp) installPath(ctx android.ModuleContext) android.InstallPath
 	return android.PathForModuleInstall(ctx, installDir, a.installApkName+".apk")
 }
 
+// generatesMainDexRules returns true if the rules that keep the classes referenced by the manifest
+// in the main dex file must be generated for the app.
+func (a *AndroidApp) generatesMainDexRules(ctx android.ModuleContext) bool {
+	if !BoolDefault(a.appProperties.Generate_main_dex_rules, true) || !a.hasCode(ctx) {
+		return false
+	}
+	minSdkVersion, err := a.MinSdkVersion(ctx).EffectiveVersion(ctx)
+	if err != nil {
+		// Reported when the dex flags are computed.
+		return false
+	}
+	if minSdkVersion.FinalOrFutureInt() >= 21 {
+		if Bool(a.appProperties.Generate_main_dex_rules) {
+			ctx.PropertyErrorf("generate_main_dex_rules",
+				"is only supported when min_sdk_version is lower than 21, got %s", minSdkVersion)
+		}
+		return false
+	}
+	return true
+}
+
 func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	a.dexpreopter.installPath = a.installPath(ctx)
 	a.dexpreopter.isApp = true
@@ -473,6 +562,12 @@ func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	a.dexpreopter.classLoaderContexts = a.classLoaderContexts
 	a.dexpreopter.manifestFile = a.mergedManifestFile
 	a.dexpreopter.preventInstall = a.appProperties.PreventInstall
+	if a.aapt.mainDexProguardOptionsFile != nil {
+		a.dexer.generatedMainDexRules = android.Paths{a.aapt.mainDexProguardOptionsFile}
+	}
+
+	a.dexer.checkDuplicateClasses = ctx.Config().CheckDuplicateClasses()
+	a.dexer.allowedDuplicateClasses = a.appProperties.Allowed_duplicate_classes
 
 	if ctx.ModuleName() != "framework-res" && ctx.ModuleName() != "com.evervolv.platform-res" {
 		a.Module.compile(ctx, a.aaptSrcJar)
@@ -635,6 +730,22 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 
 	dexJarFile := a.dexBuildActions(ctx)
 
+	// Check that the classes referenced by the manifest were kept in the main dex file.
+	if a.aapt.mainDexProguardOptionsFile != nil && a.dexer.mainDexList.Valid() {
+		apkDeps = append(apkDeps, checkMainDexList(ctx, a.dexer.mainDexList.Path(),
+			a.aapt.mainDexProguardOptionsFile, a.dexer.mainDexClassesJar))
+	}
+
+	// Shrink the resources against the code that is left after R8.
+	packageResources := a.exportPackage
+	if a.resourceShrinkingEnabled() {
+		if !Bool(a.dexProperties.Optimize.Shrink) {
+			ctx.PropertyErrorf("optimize.shrink_resources", "requires optimize.shrink to be true")
+		} else if dexJarFile != nil && a.dexer.proguardDictionary.Valid() {
+			packageResources = shrinkResources(ctx, a.exportPackage, dexJarFile, a.dexer.proguardDictionary.Path())
+		}
+	}
+
 	jniLibs, certificateDeps := collectAppDeps(ctx, a, a.shouldEmbedJnis(ctx), !Bool(a.appProperties.Jni_uses_platform_apis))
 	jniJarFile := a.jniBuildActions(jniLibs, ctx)
 
@@ -673,7 +784,19 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 
 	rotationMinSdkVersion := String(a.overridableAppProperties.RotationMinSdkVersion)
 
-	CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, dexJarFile, certificates, apkDeps, v4SignatureFile, lineageFile, rotationMinSdkVersion)
+	if originalCertificate, ok := originalCertificateFromDeps(ctx); ok {
+		if lineageFile == nil {
+			ctx.PropertyErrorf("original_certificate", "requires lineage to be set")
+		}
+		a.originalCertificate = originalCertificate
+		// The lineage chooses the signer of each signature scheme block, so signapk needs both the
+		// rotated and the original certificate.
+		if len(certificates) > 0 {
+			certificates = append([]Certificate{certificates[0], originalCertificate}, certificates[1:]...)
+		}
+	}
+
+	CreateAndSignAppPackage(ctx, packageFile, packageResources, jniJarFile, dexJarFile, certificates, apkDeps, v4SignatureFile, lineageFile, rotationMinSdkVersion)
 	a.outputFile = packageFile
 	if v4SigningRequested {
 		a.extraOutputFiles = append(a.extraOutputFiles, v4SignatureFile)
@@ -709,9 +832,23 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 		}
 	}
 
+	for i, shard := range a.aapt.shards {
+		// Build and sign the test shard APKs
+		packageFile := android.PathForModuleOut(ctx, testShardName(a.installApkName, i)+".apk")
+		CreateAndSignAppPackage(ctx, packageFile, shard, jniJarFile, dexJarFile, certificates, apkDeps, nil, lineageFile, rotationMinSdkVersion)
+		a.testShardFiles = append(a.testShardFiles, packageFile)
+	}
+
+	if a.aapt.testOverlayPackage != nil {
+		// Sign the runtime resource overlay generated for the test
+		packageFile := android.PathForModuleOut(ctx, testOverlayApkName(a.installApkName))
+		SignAppPackage(ctx, packageFile, a.aapt.testOverlayPackage, certificates, nil, lineageFile, rotationMinSdkVersion)
+		a.extraOutputFiles = append(a.extraOutputFiles, packageFile)
+	}
+
 	// Build an app bundle.
 	bundleFile := android.PathForModuleOut(ctx, "base.zip")
-	BuildBundleModule(ctx, bundleFile, a.exportPackage, jniJarFile, dexJarFile)
+	BuildBundleModule(ctx, bundleFile, packageResources, jniJarFile, dexJarFile)
 	a.bundleFile = bundleFile
 
 	apexInfo := ctx.Provider(android.ApexInfoProvider).(android.ApexInfo)
@@ -725,7 +862,18 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 			installed := ctx.InstallFile(a.installDir, extra.Base(), extra)
 			extraInstalledPaths = append(extraInstalledPaths, installed)
 		}
-		ctx.InstallFile(a.installDir, a.outputFile.Base(), a.outputFile, extraInstalledPaths...)
+		installed := ctx.InstallFile(a.installDir, a.outputFile.Base(), a.outputFile, extraInstalledPaths...)
+
+		if Bool(a.appProperties.Symbols_archive) && a.dexer.proguardDictionary.Valid() {
+			artifact := android.SymbolsArchiveArtifactPath(ctx, installed)
+			ctx.SetProvider(android.SymbolsArchiveInfoProvider, android.SymbolsArchiveInfo{
+				Entries: []android.SymbolsArchiveEntry{{
+					Artifact: artifact,
+					Symbols:  a.dexer.proguardDictionary.Path(),
+					Dest:     filepath.Join("proguard", artifact, "proguard_dictionary"),
+				}},
+			})
+		}
 	}
 
 	a.buildAppDependencyInfo(ctx)
@@ -804,6 +952,23 @@ func collectAppDeps(ctx android.ModuleContext, app appDepsInterface,
 	return jniLibs, certificates
 }
 
+// originalCertificateFromDeps returns the certificate of the original_certificate dependency of
+// an app, or false if it doesn't have one.
+func originalCertificateFromDeps(ctx android.ModuleContext) (Certificate, bool) {
+	var certificate Certificate
+	found := false
+	ctx.VisitDirectDepsWithTag(originalCertificateTag, func(module android.Module) {
+		if dep, ok := module.(*AndroidAppCertificate); ok {
+			certificate = dep.Certificate
+			found = true
+		} else {
+			ctx.ModuleErrorf("original_certificate dependency %q must be an android_app_certificate module",
+				ctx.OtherModuleName(module))
+		}
+	})
+	return certificate, found
+}
+
 func (a *AndroidApp) WalkPayloadDeps(ctx android.ModuleContext, do android.PayloadDepsCallback) {
 	ctx.WalkDeps(func(child, parent android.Module) bool {
 		isExternal := !a.DepIsInSameApex(ctx, child)
@@ -893,6 +1058,11 @@ func (a *AndroidApp) OutputFiles(tag string) (android.Paths, error) {
 		return []android.Path{a.aaptSrcJar}, nil
 	case ".export-package.apk":
 		return []android.Path{a.exportPackage}, nil
+	case ".manifest_merge_report":
+		if a.manifestMergeReport == nil {
+			return nil, fmt.Errorf("the manifest of %s is not merged with other manifests", a.Name())
+		}
+		return []android.Path{a.manifestMergeReport}, nil
 	}
 	return a.Library.OutputFiles(tag)
 }
@@ -951,6 +1121,34 @@ type appTestProperties struct {
 
 	// if specified, the instrumentation target package name in the manifest is overwritten by it.
 	Instrumentation_target_package *string
+
+	// if greater than 1, the test is also built into this many shard APKs, each with the
+	// android.test.shard_index and android.test.shard_count metadata in its manifest, so that the
+	// shards can be run in parallel on separate devices. The shard APKs are shipped with the test
+	// rather than installed, and a test config is generated for each of them and listed in the
+	// extra test configs of the test.
+	Shard_count *int
+
+	// if set, a runtime resource overlay of the package that overrides the values is built, signed
+	// with the certificate of the test and installed alongside it. The auto-generated test config
+	// installs and enables the overlay for the duration of the test.
+	Overlays_for_test struct {
+		// the name of the package to overlay, e.g. "android" for the framework.
+		Package *string
+
+		// the resource values to override, each in the form "<type>/<name>=<value>", e.g.
+		// "bool/config_enableFoo=true". The type is one of bool, color, dimen, integer or string.
+		Values []string
+	}
+}
+
+// android_test properties of the auto-generated test config that can be overridden by
+// override_android_test.
+type overridableTestConfigProperties struct {
+	// list of tradefed options to add to the auto-generated test config in place of the
+	// {EXTRA_CONFIGS} of the template, each in the form "<name>=<value>", or "<name>:<key>=<value>"
+	// for map options, e.g. "instrumentation-arg:foo=bar".
+	Test_config_options []string
 }
 
 type AndroidTest struct {
@@ -958,6 +1156,8 @@ type AndroidTest struct {
 
 	appTestProperties appTestProperties
 
+	overridableTestConfigProperties overridableTestConfigProperties
+
 	testProperties testProperties
 
 	testConfig       android.Path
@@ -969,6 +1169,16 @@ func (a *AndroidTest) InstallInTestcases() bool {
 	return true
 }
 
+func (a *AndroidTest) TestMappingTargets() []string {
+	return a.testProperties.Test_mapping.Test_for
+}
+
+func (a *AndroidTest) TestMappingPresubmit() bool {
+	return Bool(a.testProperties.Test_mapping.Presubmit)
+}
+
+var _ android.TestMappingModule = (*AndroidTest)(nil)
+
 func (a *AndroidTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	var configs []tradefed.Config
 	if a.appTestProperties.Instrumentation_target_package != nil {
@@ -981,17 +1191,130 @@ func (a *AndroidTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			a.additionalAaptFlags = append(a.additionalAaptFlags, "--rename-instrumentation-target-package "+manifestPackageName)
 		}
 	}
+	if shardCount := proptools.IntDefault(a.appTestProperties.Shard_count, 0); shardCount > 1 {
+		a.aapt.shardCount = shardCount
+	} else if shardCount < 0 {
+		ctx.PropertyErrorf("shard_count", "must not be negative, got %d", shardCount)
+	}
+	overlayPackageName := a.generateTestOverlay(ctx)
 	a.generateAndroidBuildActions(ctx)
 
 	for _, module := range a.testProperties.Test_mainline_modules {
 		configs = append(configs, tradefed.Option{Name: "config-descriptor:metadata", Key: "mainline-param", Value: module})
 	}
+	configs = append(configs, testConfigOptions(ctx, a.overridableTestConfigProperties.Test_config_options)...)
+	if a.aapt.testOverlayPackage != nil {
+		configs = append(configs,
+			tradefed.Object{"target_preparer", "com.android.tradefed.targetprep.suite.SuiteApkInstaller", []tradefed.Option{
+				{Name: "test-file-name", Value: testOverlayApkName(a.installApkName)},
+				{Name: "cleanup-apks", Value: "true"},
+			}},
+			tradefed.Object{"target_preparer", "com.android.tradefed.targetprep.RunCommandTargetPreparer", []tradefed.Option{
+				{Name: "run-command", Value: "cmd overlay enable --user current " + overlayPackageName},
+				{Name: "teardown-command", Value: "cmd overlay disable --user current " + overlayPackageName},
+			}})
+	}
 
 	testConfig := tradefed.AutoGenInstrumentationTestConfig(ctx, a.testProperties.Test_config,
 		a.testProperties.Test_config_template, a.manifestPath, a.testProperties.Test_suites, a.testProperties.Auto_gen_config, configs)
 	a.testConfig = a.FixTestConfig(ctx, testConfig)
 	a.extraTestConfigs = android.PathsForModuleSrc(ctx, a.testProperties.Test_options.Extra_test_configs)
+	for i, shardManifest := range a.aapt.shardManifests {
+		a.extraTestConfigs = append(a.extraTestConfigs, tradefed.AutoGenInstrumentationTestShardConfig(ctx,
+			testShardName(a.installApkName, i), a.testProperties.Test_config_template, shardManifest, configs))
+	}
 	a.data = android.PathsForModuleSrc(ctx, a.testProperties.Data)
+	a.data = append(a.data, a.testShardFiles...)
+}
+
+// testConfigOptions returns the tradefed options of the test_config_options property.
+func testConfigOptions(ctx android.ModuleContext, options []string) []tradefed.Config {
+	var configs []tradefed.Config
+	for _, option := range options {
+		nameAndValue := strings.SplitN(option, "=", 2)
+		if len(nameAndValue) != 2 || nameAndValue[0] == "" || strings.ContainsAny(option, `'"`) {
+			ctx.PropertyErrorf("test_config_options",
+				"%q must be in the form <name>=<value> or <name>:<key>=<value> without quotes", option)
+			continue
+		}
+		config := tradefed.Option{Name: nameAndValue[0], Value: nameAndValue[1]}
+		if nameAndKey := strings.SplitN(config.Name, ":", 2); len(nameAndKey) == 2 {
+			config.Name, config.Key = nameAndKey[0], nameAndKey[1]
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// testShardName returns the name of the APK and test config of test shard shardIndex, without
+// their extensions.
+func testShardName(installApkName string, shardIndex int) string {
+	return installApkName + "_shard" + strconv.Itoa(shardIndex)
+}
+
+func testOverlayApkName(installApkName string) string {
+	return installApkName + "_overlay_for_test.apk"
+}
+
+var testOverlayValueTypes = []string{"bool", "color", "dimen", "integer", "string"}
+
+var invalidPackageNameCharsRegexp = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// generateTestOverlay writes the manifest and resource values of the runtime resource overlay
+// requested by the overlays_for_test property so that they are linked along with the resources of
+// the test, and returns the package name of the overlay.
+func (a *AndroidTest) generateTestOverlay(ctx android.ModuleContext) string {
+	props := a.appTestProperties.Overlays_for_test
+	if props.Package == nil {
+		if len(props.Values) > 0 {
+			ctx.PropertyErrorf("overlays_for_test.package", "must be set when values are set")
+		}
+		return ""
+	}
+	if len(props.Values) == 0 {
+		ctx.PropertyErrorf("overlays_for_test.values", "must not be empty")
+		return ""
+	}
+
+	values := &strings.Builder{}
+	values.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<resources>\n")
+	for _, value := range props.Values {
+		parts := strings.SplitN(value, "=", 2)
+		var resType, name string
+		if i := strings.Index(parts[0], "/"); i >= 0 {
+			resType, name = parts[0][:i], parts[0][i+1:]
+		}
+		if len(parts) != 2 || resType == "" || name == "" {
+			ctx.PropertyErrorf("overlays_for_test.values", "%q must be in the form <type>/<name>=<value>", value)
+			continue
+		}
+		if !android.InList(resType, testOverlayValueTypes) {
+			ctx.PropertyErrorf("overlays_for_test.values", "%q has unsupported type %q, must be one of %s",
+				value, resType, strings.Join(testOverlayValueTypes, ", "))
+			continue
+		}
+		fmt.Fprintf(values, "    <%s name=\"%s\">%s</%s>\n", resType, html.EscapeString(name), html.EscapeString(parts[1]), resType)
+	}
+	values.WriteString("</resources>\n")
+
+	// Package names require every segment to start with a letter.
+	packageName := "android.test.overlay.for_" + invalidPackageNameCharsRegexp.ReplaceAllString(ctx.ModuleName(), "_")
+
+	manifest := android.PathForModuleOut(ctx, "overlay_for_test", "AndroidManifest.xml")
+	android.WriteFileRule(ctx, manifest, fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="%s">
+    <application android:hasCode="false" />
+    <overlay android:targetPackage="%s" />
+</manifest>
+`, packageName, html.EscapeString(*props.Package)))
+
+	resDir := android.PathForModuleGen(ctx, "overlay_for_test", "res")
+	valuesFile := resDir.Join(ctx, "values", "overlays_for_test.xml")
+	android.WriteFileRule(ctx, valuesFile, values.String())
+
+	a.aapt.testOverlayManifest = manifest
+	a.aapt.testOverlayRes = &globbedResourceDir{dir: resDir, files: android.Paths{valuesFile}}
+	return packageName
 }
 
 func (a *AndroidTest) FixTestConfig(ctx android.ModuleContext, testConfig android.Path) android.Path {
@@ -1058,6 +1381,7 @@ func AndroidTestFactory() android.Module {
 		&module.appProperties,
 		&module.appTestProperties,
 		&module.overridableAppProperties,
+		&module.overridableTestConfigProperties,
 		&module.testProperties)
 
 	android.InitAndroidMultiTargetsArchModule(module, android.DeviceSupported, android.MultilibCommon)
@@ -1183,11 +1507,13 @@ func (i *OverrideAndroidTest) GenerateAndroidBuildActions(_ android.ModuleContex
 }
 
 // override_android_test is used to create an android_app module based on another android_test by overriding
-// some of its properties.
+// some of its properties, e.g. the package name, the certificate or the options of the auto-generated
+// test config.
 func OverrideAndroidTestModuleFactory() android.Module {
 	m := &OverrideAndroidTest{}
 	m.AddProperties(&overridableAppProperties{})
 	m.AddProperties(&appTestProperties{})
+	m.AddProperties(&overridableTestConfigProperties{})
 
 	android.InitAndroidMultiTargetsArchModule(m, android.DeviceSupported, android.MultilibCommon)
 	android.InitOverrideModule(m)
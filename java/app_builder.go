@@ -76,6 +76,70 @@ func CreateAndSignAppPackage(ctx android.ModuleContext, outputFile android.Writa
 	SignAppPackage(ctx, outputFile, unsignedApk, certificates, v4SignatureFile, lineageFile, rotationMinSdkVersion)
 }
 
+var resourceShrinker = pctx.AndroidStaticRule("resourceShrinker",
+	blueprint.RuleParams{
+		Command: `${config.ResourceShrinkerCmd} --input $in --dex_input $dexJar --mapping_file $mapping ` +
+			`--output $out --print_usage_log $usageLog`,
+		CommandDeps: []string{"${config.ResourceShrinkerCmd}"},
+	},
+	"dexJar", "mapping", "usageLog")
+
+// shrinkResources removes the resources of packageFile that aren't referenced by the code in
+// dexJarFile, which must be the output of R8 with mapping as its proguard dictionary, and returns
+// the package with the remaining resources in binary format.
+func shrinkResources(ctx android.ModuleContext, packageFile, dexJarFile, mapping android.Path) android.Path {
+	protoPackage := android.PathForModuleOut(ctx, "resource-shrinker", "package-res.proto.apk")
+	aapt2Convert(ctx, protoPackage, packageFile, "proto")
+
+	shrunkProtoPackage := android.PathForModuleOut(ctx, "resource-shrinker", "package-res.shrunk.proto.apk")
+	usageLog := android.PathForModuleOut(ctx, "resource-shrinker", "usage.log")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           resourceShrinker,
+		Description:    "shrink resources",
+		Output:         shrunkProtoPackage,
+		ImplicitOutput: usageLog,
+		Input:          protoPackage,
+		Implicits:      android.Paths{dexJarFile, mapping},
+		Args: map[string]string{
+			"dexJar":   dexJarFile.String(),
+			"mapping":  mapping.String(),
+			"usageLog": usageLog.String(),
+		},
+	})
+
+	shrunkPackage := android.PathForModuleOut(ctx, "resource-shrinker", "package-res.shrunk.apk")
+	aapt2Convert(ctx, shrunkPackage, shrunkProtoPackage, "binary")
+	return shrunkPackage
+}
+
+var splitApksCertificatesCheck = pctx.AndroidStaticRule("splitApksCertificatesCheck",
+	blueprint.RuleParams{
+		Command: `base=$$(${config.ApksignerCmd} verify --print-certs $base | grep 'SHA-256 digest') && ` +
+			`for split in $splits; do ` +
+			`if [ "$$(${config.ApksignerCmd} verify --print-certs $$split | grep 'SHA-256 digest')" != "$$base" ]; then ` +
+			`echo "$$split is not signed with the same certificates as $base" >&2; exit 1; ` +
+			`fi; done && touch $out`,
+		CommandDeps: []string{"${config.ApksignerCmd}"},
+	},
+	"base", "splits")
+
+// checkSplitApksCertificates verifies that the presigned split APKs are signed with the same
+// certificates as the base APK, and returns a timestamp file to be used as a validation.
+func checkSplitApksCertificates(ctx android.ModuleContext, base android.Path, splits android.Paths) android.Path {
+	timestamp := android.PathForModuleOut(ctx, "split_apks_certificates_check.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        splitApksCertificatesCheck,
+		Description: "check split apks certificates",
+		Output:      timestamp,
+		Inputs:      append(android.Paths{base}, splits...),
+		Args: map[string]string{
+			"base":   base.String(),
+			"splits": strings.Join(splits.Strings(), " "),
+		},
+	})
+	return timestamp
+}
+
 func SignAppPackage(ctx android.ModuleContext, signedApk android.WritablePath, unsignedApk android.Path, certificates []Certificate, v4SignatureFile android.WritablePath, lineageFile android.Path, rotationMinSdkVersion string) {
 
 	var certificateArgs []string
@@ -119,6 +183,16 @@ func SignAppPackage(ctx android.ModuleContext, signedApk android.WritablePath, u
 		Implicits:   deps,
 		Args:        args,
 	})
+
+	if len(certificates) > 0 {
+		pems := make(android.Paths, 0, len(certificates))
+		for _, c := range certificates {
+			pems = append(pems, c.Pem)
+		}
+		if _, err := BuildTransparencyLogEntry(ctx, signedApk, pems); err != nil {
+			ctx.ModuleErrorf("%s", err)
+		}
+	}
 }
 
 var buildAAR = pctx.AndroidStaticRule("buildAAR",
@@ -182,7 +256,7 @@ func BuildBundleModule(ctx android.ModuleContext, outputFile android.WritablePat
 	packageFile, jniJarFile, dexJarFile android.Path) {
 
 	protoResJarFile := android.PathForModuleOut(ctx, "package-res.pb.apk")
-	aapt2Convert(ctx, protoResJarFile, packageFile)
+	aapt2Convert(ctx, protoResJarFile, packageFile, "proto")
 
 	var zips android.Paths
 
@@ -40,6 +40,7 @@ type AndroidAppImport struct {
 	android.ModuleBase
 	android.DefaultableModuleBase
 	android.ApexModuleBase
+	TransparencyLog
 	prebuilt android.Prebuilt
 
 	properties   AndroidAppImportProperties
@@ -49,6 +50,10 @@ type AndroidAppImport struct {
 	outputFile  android.Path
 	certificate Certificate
 
+	// The processed split APKs, installed alongside outputFile in onDeviceDir.
+	splitApks   android.Paths
+	onDeviceDir string
+
 	dexpreopter
 
 	usesLibrary usesLibrary
@@ -66,6 +71,10 @@ type AndroidAppImportProperties struct {
 	// A prebuilt apk to import
 	Apk *string `android:"path"`
 
+	// Prebuilt config split APKs of the apk, installed alongside it. They are signed or presigned
+	// the same way as the apk, presigned splits must be signed with the same certificates.
+	Split_apks []string `android:"path"`
+
 	// The name of a certificate in the default certificate directory or an android_app_certificate
 	// module name in the form ":module". Should be empty if presigned or default_dev_cert is set.
 	Certificate *string
@@ -262,9 +271,10 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 	_, certificates := collectAppDeps(ctx, a, false, false)
 
 	// TODO: LOCAL_EXTRACT_APK/LOCAL_EXTRACT_DPI_APK
-	// TODO: LOCAL_PACKAGE_SPLITS
 
 	srcApk := a.prebuilt.SingleSourcePath(ctx)
+	baseApk := srcApk
+	splitApks := android.PathsForModuleSrc(ctx, a.properties.Split_apks)
 
 	// TODO: Install or embed JNI libraries
 
@@ -291,6 +301,7 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 	}
 
 	installDir := android.PathForModuleInstall(ctx, pathFragments...)
+	a.onDeviceDir = android.InstallPathToOnDevicePath(ctx, installDir)
 	a.dexpreopter.isApp = true
 	a.dexpreopter.installPath = installDir.Join(ctx, a.BaseModuleName()+".apk")
 	a.dexpreopter.isPresignedPrebuilt = Bool(a.properties.Presigned)
@@ -299,6 +310,10 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 	a.dexpreopter.enforceUsesLibs = a.usesLibrary.enforceUsesLibraries()
 	a.dexpreopter.classLoaderContexts = a.usesLibrary.classLoaderContextForUsesLibDeps(ctx)
 
+	if len(splitApks) > 0 && a.isPrebuiltFrameworkRes() {
+		ctx.PropertyErrorf("split_apks", "split_apks cannot be set for framework-res")
+	}
+
 	if a.usesLibrary.enforceUsesLibraries() {
 		srcApk = a.usesLibrary.verifyUsesLibrariesAPK(ctx, srcApk)
 	}
@@ -316,6 +331,13 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 
 	// Sign or align the package if package has not been preprocessed
 
+	var lineageFile android.Path
+	if lineage := String(a.properties.Lineage); lineage != "" {
+		lineageFile = android.PathForModuleSrc(ctx, lineage)
+	}
+
+	rotationMinSdkVersion := String(a.properties.RotationMinSdkVersion)
+
 	if a.isPrebuiltFrameworkRes() {
 		a.outputFile = srcApk
 		certificates = processMainCert(a.ModuleBase, String(a.properties.Certificate), certificates, ctx)
@@ -332,13 +354,6 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 		certificates = processMainCert(a.ModuleBase, String(a.properties.Certificate), certificates, ctx)
 		a.certificate = certificates[0]
 		signed := android.PathForModuleOut(ctx, "signed", apkFilename)
-		var lineageFile android.Path
-		if lineage := String(a.properties.Lineage); lineage != "" {
-			lineageFile = android.PathForModuleSrc(ctx, lineage)
-		}
-
-		rotationMinSdkVersion := String(a.properties.RotationMinSdkVersion)
-
 		SignAppPackage(ctx, signed, jnisUncompressed, certificates, nil, lineageFile, rotationMinSdkVersion)
 		a.outputFile = signed
 	} else {
@@ -348,12 +363,39 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 		a.certificate = PresignedCertificate
 	}
 
+	var splitsCertificatesCheck android.Path
+	if len(splitApks) > 0 && Bool(a.properties.Presigned) {
+		splitsCertificatesCheck = checkSplitApksCertificates(ctx, baseApk, splitApks)
+	}
+	for _, split := range splitApks {
+		if a.preprocessed {
+			a.splitApks = append(a.splitApks, split)
+		} else if !Bool(a.properties.Presigned) {
+			signed := android.PathForModuleOut(ctx, "signed", split.Base())
+			SignAppPackage(ctx, signed, split, certificates, nil, lineageFile, rotationMinSdkVersion)
+			a.splitApks = append(a.splitApks, signed)
+		} else {
+			alignedApk := android.PathForModuleOut(ctx, "zip-aligned", split.Base())
+			ctx.Build(pctx, android.BuildParams{
+				Rule:        zipalign,
+				Description: "align",
+				Input:       split,
+				Output:      alignedApk,
+				Validation:  splitsCertificatesCheck,
+			})
+			a.splitApks = append(a.splitApks, alignedApk)
+		}
+	}
+
 	// TODO: Optionally compress the output apk.
 
 	if apexInfo.IsForPlatform() {
 		a.installPath = ctx.InstallFile(installDir, apkFilename, a.outputFile)
 		artifactPath := android.PathForModuleSrc(ctx, *a.properties.Apk)
 		a.provenanceMetaDataFile = provenance.GenerateArtifactProvenanceMetaData(ctx, artifactPath, a.installPath)
+		for _, split := range a.splitApks {
+			ctx.InstallFile(installDir, split.Base(), split)
+		}
 	}
 
 	// TODO: androidmk converter jni libs
@@ -121,6 +121,75 @@ func TestAndroidAppImport_Presigned(t *testing.T) {
 	android.AssertStringEquals(t, "Invalid args", "/system/app/foo/foo.apk", rule.Args["install_path"])
 }
 
+func TestAndroidAppImport_SplitApks(t *testing.T) {
+	bp := `
+		android_app_import {
+			name: "foo",
+			apk: "prebuilts/apk/app.apk",
+			split_apks: [
+				"prebuilts/apk/app_xxhdpi.apk",
+				"prebuilts/apk/app_arm64.apk",
+			],
+			%s
+			dex_preopt: {
+				enabled: true,
+			},
+		}
+		`
+	preparer := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"prebuilts/apk/app_xxhdpi.apk": nil,
+			"prebuilts/apk/app_arm64.apk":  nil,
+		}),
+	)
+
+	t.Run("signed", func(t *testing.T) {
+		result := preparer.RunTestWithBp(t, fmt.Sprintf(bp, `certificate: "platform",`))
+		variant := result.ModuleForTests("foo", "android_common")
+
+		for _, split := range []string{"app_xxhdpi.apk", "app_arm64.apk"} {
+			signed := variant.Output("signed/" + split)
+			android.AssertStringEquals(t, "split certificates",
+				"build/make/target/product/security/platform.x509.pem build/make/target/product/security/platform.pk8",
+				signed.Args["certificates"])
+		}
+		if variant.MaybeOutput("split_apks_certificates_check.timestamp").Rule != nil {
+			t.Errorf("split apks signed by the build shouldn't be checked")
+		}
+
+		installs := variant.Module().(*AndroidAppImport).FilesToInstall()
+		android.AssertStringPathsRelativeToTopEquals(t, "split installs", result.Config, []string{
+			"out/soong/target/product/test_device/system/app/foo/app_xxhdpi.apk",
+			"out/soong/target/product/test_device/system/app/foo/app_arm64.apk",
+		}, installs[len(installs)-2:].Paths())
+
+		entries := android.AndroidMkEntriesForTest(t, result.TestContext, variant.Module())[0]
+		builtInstalled := entries.EntryMap["LOCAL_SOONG_BUILT_INSTALLED"]
+		android.AssertStringPathsRelativeToTopEquals(t, "LOCAL_SOONG_BUILT_INSTALLED", result.Config, []string{
+			"out/soong/.intermediates/foo/android_common/signed/app_xxhdpi.apk:/system/app/foo/app_xxhdpi.apk",
+			"out/soong/.intermediates/foo/android_common/signed/app_arm64.apk:/system/app/foo/app_arm64.apk",
+		}, builtInstalled[len(builtInstalled)-2:])
+	})
+
+	t.Run("presigned", func(t *testing.T) {
+		result := preparer.RunTestWithBp(t, fmt.Sprintf(bp, `presigned: true,`))
+		variant := result.ModuleForTests("foo", "android_common")
+
+		check := variant.Output("split_apks_certificates_check.timestamp")
+		android.AssertStringEquals(t, "check base", "prebuilts/apk/app.apk", check.Args["base"])
+		android.AssertStringEquals(t, "check splits",
+			"prebuilts/apk/app_xxhdpi.apk prebuilts/apk/app_arm64.apk", check.Args["splits"])
+
+		for _, split := range []string{"app_xxhdpi.apk", "app_arm64.apk"} {
+			aligned := variant.Output("zip-aligned/" + split)
+			android.AssertPathRelativeToTopEquals(t, "split validation",
+				"out/soong/.intermediates/foo/android_common/split_apks_certificates_check.timestamp",
+				aligned.Validation)
+		}
+	})
+}
+
 func TestAndroidAppImport_SigningLineage(t *testing.T) {
 	ctx, _ := testJava(t, `
 	  android_app_import {
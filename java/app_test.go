@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -129,6 +131,235 @@ func TestAppSplits(t *testing.T) {
 	android.AssertPathsRelativeToTopEquals(t, `OutputFiles("")`, expectedOutputs, outputFiles)
 }
 
+func TestAapt2LinkOptions(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeMockFs(android.MockFS{
+			"stable_ids.txt": nil,
+		}),
+	).RunTestWithBp(t, `
+		android_app {
+			name: "base",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			aaptflags: ["--no-version-vectors"],
+			aapt2_link_options: {
+				stable_ids: "stable_ids.txt",
+				feature_of: ":base",
+				package_id: "0x20",
+				exclude_configs: ["sw600dp", "en-rGB", "sw600dp"],
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	link := foo.Output("package-res.apk")
+	android.AssertStringDoesContain(t, "aapt2 link flags", link.Args["flags"],
+		"--no-version-vectors --stable-ids stable_ids.txt"+
+			" --feature-of out/soong/.intermediates/base/android_common/base.apk"+
+			" --package-id 0x20 --allow-reserved-package-id --exclude-configs sw600dp,en-rGB")
+	android.AssertStringListContains(t, "aapt2 link implicits", link.Implicits.Strings(), "stable_ids.txt")
+	android.AssertStringListContains(t, "aapt2 link implicits", link.Implicits.Strings(),
+		"out/soong/.intermediates/base/android_common/base.apk")
+
+	info := result.ModuleProvider(foo.Module(), AaptLinkOptionsProvider).(AaptLinkOptionsInfo)
+	android.AssertPathRelativeToTopEquals(t, "StableIds", "stable_ids.txt", info.StableIds)
+	android.AssertPathRelativeToTopEquals(t, "FeatureOf",
+		"out/soong/.intermediates/base/android_common/base.apk", info.FeatureOf)
+	android.AssertIntEquals(t, "PackageId", 0x20, info.PackageId)
+	android.AssertArrayString(t, "ExcludeConfigs", []string{"sw600dp", "en-rGB"}, info.ExcludeConfigs)
+}
+
+func TestAapt2LinkOptions_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options string
+		err     string
+	}{
+		{
+			name:    "package id out of range",
+			options: `aapt2_link_options: { package_id: "0x100" }`,
+			err:     `package_id: must be an integer between 0x02 and 0xff, got "0x100"`,
+		},
+		{
+			name:    "package id not a number",
+			options: `aapt2_link_options: { package_id: "foo" }`,
+			err:     `package_id: must be an integer between 0x02 and 0xff, got "foo"`,
+		},
+		{
+			name:    "invalid config",
+			options: `aapt2_link_options: { exclude_configs: ["en rGB"] }`,
+			err:     `exclude_configs: invalid resource configuration "en rGB"`,
+		},
+		{
+			name: "conflicting aaptflags",
+			options: `
+				aaptflags: ["--package-id 0x80"],
+				aapt2_link_options: { package_id: "0x81" },
+			`,
+			err: `aaptflags: "--package-id 0x80" conflicts with aapt2_link_options.package_id`,
+		},
+		{
+			name:    "flag not in allowlist",
+			options: `aaptflags: ["--keep-raw-values", "--java", "gen"],`,
+			err:     `aaptflags: "--java" is not an allowed aapt2 link flag`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			PrepareForTestWithJavaDefaultModules.
+				ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(regexp.QuoteMeta(tc.err))).
+				RunTestWithBp(t, `
+					android_app {
+						name: "foo",
+						srcs: ["a.java"],
+						sdk_version: "current",
+						`+tc.options+`
+					}
+				`)
+		})
+	}
+}
+
+func TestManifestMergerOptions(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_library {
+			name: "lib",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			static_libs: ["lib"],
+			manifest_merger: {
+				replace: ["application=android:label,android:icon"],
+				tools_node: ["service[com.example.lib.Service]=remove"],
+				placeholders: ["appLabel=Foo Bar"],
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	fixerArgs := foo.Output("manifest_fixer/AndroidManifest.xml").Args["args"]
+	android.AssertStringDoesContain(t, "manifest_fixer args", fixerArgs, "application=android:label,android:icon")
+	android.AssertStringDoesContain(t, "manifest_fixer args", fixerArgs,
+		"--tools-node 'service[com.example.lib.Service]=remove'")
+
+	merger := foo.Output("manifest_merger/AndroidManifest.xml")
+	android.AssertStringDoesContain(t, "manifest merger args", merger.Args["args"],
+		"--remove-tools-declarations --placeholder 'appLabel=Foo Bar'")
+
+	report := foo.Output("manifest_merger/merge_report.tsv")
+	android.AssertPathRelativeToTopEquals(t, "merge report input",
+		"out/soong/.intermediates/foo/android_common/manifest_merger/AndroidManifest.xml", report.Input)
+	android.AssertStringEquals(t, "merge report main",
+		"out/soong/.intermediates/foo/android_common/manifest_fixer/AndroidManifest.xml",
+		android.StringRelativeToTop(result.Config, report.Args["main"]))
+	android.AssertStringEquals(t, "merge report libs",
+		"--libs out/soong/.intermediates/lib/android_common/manifest_fixer/AndroidManifest.xml",
+		android.StringRelativeToTop(result.Config, report.Args["libs"]))
+
+	outputs, err := foo.Module().(*AndroidApp).OutputFiles(".manifest_merge_report")
+	android.AssertDeepEquals(t, "merge report error", nil, err)
+	android.AssertPathsRelativeToTopEquals(t, "merge report output files",
+		[]string{"out/soong/.intermediates/foo/android_common/manifest_merger/merge_report.tsv"}, outputs)
+}
+
+func TestManifestMergerPlaceholdersWithoutLibs(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			manifest_merger: {
+				placeholders: ["appLabel=Foo"],
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	merger := foo.Output("manifest_merger/AndroidManifest.xml")
+	android.AssertStringDoesContain(t, "manifest merger args", merger.Args["args"], "appLabel=Foo")
+	android.AssertStringEquals(t, "manifest merger libs", "", merger.Args["libs"])
+
+	aapt2Link := foo.Output("package-res.apk")
+	android.AssertStringDoesContain(t, "aapt2 link manifest", aapt2Link.Args["flags"],
+		"manifest_merger/AndroidManifest.xml")
+
+	testJavaError(t, `manifest_merger.placeholders: cannot be set on libraries`, `
+		android_library {
+			name: "lib",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			manifest_merger: {
+				placeholders: ["appLabel=Foo"],
+			},
+		}
+	`)
+}
+
+func TestManifestMergerOptions_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options string
+		err     string
+	}{
+		{
+			name:    "replace without attributes",
+			options: `manifest_merger: { replace: ["application"] }`,
+			err:     `manifest_merger.replace: "application" must be in the form <element>=<attribute>[,<attribute>...]`,
+		},
+		{
+			name:    "replace invalid attribute",
+			options: `manifest_merger: { replace: ["application=label"] }`,
+			err:     `manifest_merger.replace: "application=label" has invalid attribute "label", must be in the form <namespace>:<name>`,
+		},
+		{
+			name:    "invalid element",
+			options: `manifest_merger: { tools_node: ["Activity[a.A]=remove"] }`,
+			err:     `manifest_merger.tools_node: "Activity[a.A]=remove" must be in the form <element>=<rule>`,
+		},
+		{
+			name:    "invalid rule",
+			options: `manifest_merger: { tools_node: ["activity[a.A]=delete"] }`,
+			err:     `manifest_merger.tools_node: "activity[a.A]=delete" has invalid rule "delete"`,
+		},
+		{
+			name:    "invalid placeholder",
+			options: `manifest_merger: { placeholders: ["appLabel"] }`,
+			err:     `manifest_merger.placeholders: "appLabel" must be in the form <name>=<value>`,
+		},
+		{
+			name:    "placeholders without merging",
+			options: `dont_merge_manifests: true, manifest_merger: { placeholders: ["appLabel=Foo"] }`,
+			err:     `manifest_merger.placeholders: cannot be set with dont_merge_manifests`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			PrepareForTestWithJavaDefaultModules.
+				ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(regexp.QuoteMeta(tc.err))).
+				RunTestWithBp(t, `
+					android_app {
+						name: "foo",
+						srcs: ["a.java"],
+						sdk_version: "current",
+						`+tc.options+`
+					}
+				`)
+		})
+	}
+}
+
 func TestPlatformAPIs(t *testing.T) {
 	testJava(t, `
 		android_app {
@@ -1634,6 +1865,141 @@ func TestCertificates(t *testing.T) {
 	}
 }
 
+func TestAppOriginalCertificate(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_test_helper_app {
+			name: "foo",
+			srcs: ["a.java"],
+			certificate: ":new_certificate",
+			original_certificate: ":old_certificate",
+			lineage: "lineage.bin",
+			rotationMinSdkVersion: "33",
+			sdk_version: "current",
+		}
+
+		android_app_certificate {
+			name: "new_certificate",
+			certificate: "cert/new_cert",
+		}
+
+		android_app_certificate {
+			name: "old_certificate",
+			certificate: "cert/old_cert",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	signapk := foo.Output("foo.apk")
+	android.AssertStringEquals(t, "certificates flags",
+		"cert/new_cert.x509.pem cert/new_cert.pk8 cert/old_cert.x509.pem cert/old_cert.pk8",
+		signapk.Args["certificates"])
+	android.AssertStringEquals(t, "cert signing flags",
+		"--lineage lineage.bin --rotation-min-sdk-version 33", signapk.Args["flags"])
+
+	app := foo.Module().(*AndroidTestHelperApp)
+	android.AssertPathRelativeToTopEquals(t, "certificate", "cert/new_cert.x509.pem", app.Certificate().Pem)
+	original, ok := app.OriginalCertificate()
+	android.AssertBoolEquals(t, "has original certificate", true, ok)
+	android.AssertPathRelativeToTopEquals(t, "original certificate", "cert/old_cert.x509.pem", original.Pem)
+}
+
+func TestAppOriginalCertificateWithoutLineage(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`original_certificate: requires lineage to be set`)).
+		RunTestWithBp(t, `
+			android_test_helper_app {
+				name: "foo",
+				srcs: ["a.java"],
+				certificate: ":new_certificate",
+				original_certificate: ":old_certificate",
+				sdk_version: "current",
+			}
+
+			android_app_certificate {
+				name: "new_certificate",
+				certificate: "cert/new_cert",
+			}
+
+			android_app_certificate {
+				name: "old_certificate",
+				certificate: "cert/old_cert",
+			}
+		`)
+}
+
+func TestAppDuplicateClassesCheck(t *testing.T) {
+	bp := `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			static_libs: ["liba", "libb"],
+			allowed_duplicate_classes: ["com.example.**"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "liba",
+			srcs: ["b.java"],
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "libb",
+			srcs: ["c.java"],
+			static_libs: ["libc"],
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "libc",
+			srcs: ["d.java"],
+			sdk_version: "current",
+		}
+	`
+
+	// The check is only enabled by the product variable.
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, bp)
+	android.AssertBoolEquals(t, "foo has duplicate classes check", false,
+		result.ModuleForTests("foo", "android_common").MaybeOutput("duplicate-classes.stamp").Rule != nil)
+
+	result = android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.CheckDuplicateClasses = true
+		}),
+	).RunTestWithBp(t, bp)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	check := foo.Output("duplicate-classes.stamp")
+	command := check.RuleParams.Command
+	android.AssertStringDoesContain(t, "check command", command, "--module foo")
+	android.AssertStringDoesContain(t, "check command", command, "--jar foo=out/soong/.intermediates/foo/android_common/javac/foo.jar")
+	android.AssertStringDoesContain(t, "check command", command, "--jar liba=out/soong/.intermediates/liba/android_common/")
+	android.AssertStringDoesContain(t, "check command", command, "--jar libb=out/soong/.intermediates/libb/android_common/")
+	// The classes of the transitive static lib are attributed to it.
+	android.AssertStringDoesContain(t, "check command", command, "--jar libc=out/soong/.intermediates/libc/android_common/")
+	android.AssertStringDoesContain(t, "check command", command, "--static-lib libb=libc")
+	android.AssertStringDoesNotContain(t, "check command", command, "--static-lib foo=")
+	android.AssertStringDoesContain(t, "check command", command, "--allow 'com.example.**'")
+
+	// The check must pass before the app is dexed.
+	dex := foo.Output("dex/foo.jar")
+	android.AssertStringListContains(t, "dex implicits", dex.Implicits.Strings(), check.Output.String())
+
+	// An app without static_libs has nothing to check.
+	bar := result.ModuleForTests("bar", "android_common")
+	android.AssertBoolEquals(t, "bar has duplicate classes check", false,
+		bar.MaybeOutput("duplicate-classes.stamp").Rule != nil)
+}
+
 func TestRequestV4SigningFlag(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -1808,6 +2174,139 @@ func TestInstrumentationTargetOverridden(t *testing.T) {
 	}
 }
 
+func TestAndroidTestShards(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_test {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			shard_count: 2,
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	packageRes := foo.Output("package-res.apk")
+	entries := android.AndroidMkEntriesForTest(t, result.TestContext, foo.Module())[0]
+
+	for i, shard := range []string{"shards/0", "shards/1"} {
+		manifest := foo.Output(shard + "/AndroidManifest.xml")
+		android.AssertStringEquals(t, shard+" shard index", strconv.Itoa(i), manifest.Args["shardIndex"])
+		android.AssertStringEquals(t, shard+" shard count", "2", manifest.Args["shardCount"])
+
+		// Only the manifest of the shard is linked, against the resources linked for the test.
+		manifestPackage := foo.Output(shard + "/manifest.apk")
+		android.AssertStringDoesContain(t, shard+" aapt2 link flags", manifestPackage.Args["flags"],
+			"--manifest "+manifest.Output.String())
+		android.AssertStringDoesContain(t, shard+" aapt2 link flags", manifestPackage.Args["flags"],
+			"-I "+packageRes.Output.String())
+		android.AssertStringEquals(t, shard+" aapt2 link inputs", "", manifestPackage.Args["inFlags"])
+
+		res := foo.Output(shard + "/package-res.apk")
+		android.AssertPathRelativeToTopEquals(t, shard+" resources", packageRes.Output, res.Input)
+		android.AssertPathRelativeToTopEquals(t, shard+" manifest", manifestPackage.Output, res.Implicit)
+
+		name := "foo_shard" + strconv.Itoa(i)
+		unsigned := foo.Output(name + "-unsigned.apk")
+		android.AssertStringListContains(t, shard+" apk inputs", unsigned.Inputs.Strings(),
+			res.Output.String())
+		apk := foo.Output(name + ".apk")
+
+		config := foo.Output(name + ".config")
+		android.AssertPathRelativeToTopEquals(t, shard+" test config manifest", manifest.Output, config.Input)
+
+		android.AssertStringListContains(t, "LOCAL_EXTRA_FULL_TEST_CONFIGS",
+			entries.EntryMap["LOCAL_EXTRA_FULL_TEST_CONFIGS"], config.Output.String())
+		android.AssertStringListContains(t, "LOCAL_COMPATIBILITY_SUPPORT_FILES",
+			entries.EntryMap["LOCAL_COMPATIBILITY_SUPPORT_FILES"], apk.Output.String()+":"+name+".apk")
+		for _, installed := range entries.EntryMap["LOCAL_SOONG_BUILT_INSTALLED"] {
+			android.AssertStringDoesNotContain(t, "LOCAL_SOONG_BUILT_INSTALLED", installed, name)
+		}
+	}
+	android.AssertStringDoesContain(t, "main aapt2 link flags", packageRes.Args["flags"],
+		"--manifest "+foo.Output("manifest_fixer/AndroidManifest.xml").Output.String())
+}
+
+func TestAndroidTestOverlaysForTest(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_test {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			overlays_for_test: {
+				package: "android",
+				values: [
+					"bool/config_enableFoo=true",
+					"string/config_fooName=<foo>",
+				],
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	manifest := foo.Output("overlay_for_test/AndroidManifest.xml")
+	android.AssertStringDoesContain(t, "overlay manifest", android.ContentFromFileRuleForTests(t, manifest),
+		`<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="android.test.overlay.for_foo">`)
+	android.AssertStringDoesContain(t, "overlay manifest", android.ContentFromFileRuleForTests(t, manifest),
+		`<overlay android:targetPackage="android" />`)
+
+	values := foo.Output("gen/overlay_for_test/res/values/overlays_for_test.xml")
+	android.AssertStringEquals(t, "overlay values", `<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <bool name="config_enableFoo">true</bool>
+    <string name="config_fooName">&lt;foo&gt;</string>
+</resources>
+`, android.ContentFromFileRuleForTests(t, values))
+
+	res := foo.Output("overlay_for_test/package-res.apk")
+	android.AssertStringDoesContain(t, "overlay aapt2 link flags", res.Args["flags"],
+		"--manifest "+manifest.Output.String())
+	android.AssertStringDoesContain(t, "overlay aapt2 link flags", res.Args["flags"], "-I ")
+	android.AssertStringDoesNotContain(t, "overlay aapt2 link flags", res.Args["flags"],
+		foo.Output("manifest_fixer/AndroidManifest.xml").Output.String())
+
+	signed := foo.Output("foo_overlay_for_test.apk")
+	android.AssertStringEquals(t, "signed overlay input", res.Output.String(), signed.Input.String())
+
+	extraConfigs := foo.Output("foo.config").Args["extraConfigs"]
+	android.AssertStringDoesContain(t, "test config", extraConfigs,
+		`<option name="test-file-name" value="foo_overlay_for_test.apk" />`)
+	android.AssertStringDoesContain(t, "test config", extraConfigs,
+		`<option name="run-command" value="cmd overlay enable --user current android.test.overlay.for_foo" />`)
+}
+
+func TestAndroidTestOverlaysForTestErrors(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+			`overlays_for_test.values: "config_foo=true" must be in the form <type>/<name>=<value>`,
+			`overlays_for_test.values: "drawable/foo=@null" has unsupported type "drawable"`,
+			`overlays_for_test.package: must be set when values are set`,
+		})).
+		RunTestWithBp(t, `
+			android_test {
+				name: "foo",
+				srcs: ["a.java"],
+				sdk_version: "current",
+				overlays_for_test: {
+					package: "android",
+					values: [
+						"config_foo=true",
+						"drawable/foo=@null",
+					],
+				},
+			}
+
+			android_test {
+				name: "bar",
+				srcs: ["a.java"],
+				sdk_version: "current",
+				overlays_for_test: {
+					values: ["bool/config_foo=true"],
+				},
+			}
+		`)
+}
+
 func TestOverrideAndroidApp(t *testing.T) {
 	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(
 		t, `
@@ -2284,6 +2783,60 @@ func TestOverrideAndroidTest(t *testing.T) {
 	}
 }
 
+func TestOverrideAndroidTestConfigOptions(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_test {
+			name: "foo_test",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			test_config_options: ["instrumentation-arg:device=generic"],
+		}
+
+		override_android_test {
+			name: "bar_test",
+			base: "foo_test",
+			package_name: "com.android.bar.test",
+			certificate: "expiredkey",
+			test_config_options: [
+				"instrumentation-arg:device=bar",
+				"hidden-api-checks=false",
+			],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo_test", "android_common")
+	extraConfigs := foo.Output("foo_test.config").Args["extraConfigs"]
+	android.AssertStringDoesContain(t, "foo_test config", extraConfigs,
+		`<option name="instrumentation-arg" key="device" value="generic" />`)
+
+	bar := result.ModuleForTests("foo_test", "android_common_bar_test")
+	extraConfigs = bar.Output("foo_test.config").Args["extraConfigs"]
+	android.AssertStringDoesContain(t, "bar_test config", extraConfigs,
+		`<option name="instrumentation-arg" key="device" value="bar" />`)
+	android.AssertStringDoesContain(t, "bar_test config", extraConfigs,
+		`<option name="hidden-api-checks" value="false" />`)
+	android.AssertStringDoesNotContain(t, "bar_test config", extraConfigs, `value="generic"`)
+
+	signed := bar.Output("bar_test.apk")
+	android.AssertStringDoesContain(t, "bar_test certificates", signed.Args["certificates"], "expiredkey")
+}
+
+func TestAndroidTestConfigOptionsErrors(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+			`test_config_options: "no-value" must be in the form <name>=<value> or <name>:<key>=<value> without quotes`,
+			`test_config_options: "name='quoted'" must be in the form`,
+		})).
+		RunTestWithBp(t, `
+			android_test {
+				name: "foo_test",
+				srcs: ["a.java"],
+				sdk_version: "current",
+				test_config_options: ["no-value", "name='quoted'"],
+			}
+		`)
+}
+
 func TestAndroidTest_FixTestConfig(t *testing.T) {
 	ctx, _ := testJava(t, `
 		android_app {
@@ -2979,6 +3532,96 @@ func TestExportedProguardFlagFiles(t *testing.T) {
 	}
 }
 
+func TestShrinkResources(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			optimize: {
+				shrink_resources: true,
+			},
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	shrinker := foo.Rule("resourceShrinker")
+	android.AssertPathRelativeToTopEquals(t, "shrinker input",
+		"out/soong/.intermediates/foo/android_common/resource-shrinker/package-res.proto.apk", shrinker.Input)
+	android.AssertStringListContains(t, "shrinker implicits", shrinker.Implicits.Strings(),
+		"out/soong/.intermediates/foo/android_common/proguard_dictionary")
+
+	convert := foo.Output("resource-shrinker/package-res.shrunk.apk")
+	android.AssertStringEquals(t, "convert format", "binary", convert.Args["format"])
+
+	fooApk := foo.Output("foo-unsigned.apk")
+	android.AssertStringListContains(t, "foo apk inputs", fooApk.Inputs.Strings(),
+		"out/soong/.intermediates/foo/android_common/resource-shrinker/package-res.shrunk.apk")
+
+	bar := result.ModuleForTests("bar", "android_common")
+	if bar.MaybeRule("resourceShrinker").Rule != nil {
+		t.Errorf("expected no resource shrinking for bar")
+	}
+	android.AssertStringListContains(t, "bar apk inputs", bar.Output("bar-unsigned.apk").Inputs.Strings(),
+		"out/soong/.intermediates/bar/android_common/package-res.apk")
+}
+
+func TestAppSymbolsArchive(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.PrepareForTestWithSymbolsArchive,
+	).RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			symbols_archive: true,
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	info := result.ModuleProvider(foo.Module(), android.SymbolsArchiveInfoProvider).(android.SymbolsArchiveInfo)
+	android.AssertIntEquals(t, "entries", 1, len(info.Entries))
+	android.AssertStringEquals(t, "artifact", "system/app/foo/foo.apk", info.Entries[0].Artifact)
+	android.AssertPathRelativeToTopEquals(t, "symbols",
+		"out/soong/.intermediates/foo/android_common/proguard_dictionary", info.Entries[0].Symbols)
+
+	symbolsArchive := result.SingletonForTests("symbols_archive")
+	symbolsArchive.Output("symbols/test_product/staging/proguard/system/app/foo/foo.apk/proguard_dictionary")
+	if symbolsArchive.MaybeOutput("symbols/test_product/staging/proguard/system/app/bar/bar.apk/proguard_dictionary").Rule != nil {
+		t.Errorf("expected no proguard dictionary for bar in the symbols archive")
+	}
+}
+
+func TestShrinkResourcesWithoutShrink(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`optimize.shrink_resources: requires optimize.shrink to be true`)).
+		RunTestWithBp(t, `
+			android_app {
+				name: "foo",
+				srcs: ["a.java"],
+				sdk_version: "current",
+				optimize: {
+					shrink: false,
+					shrink_resources: true,
+				},
+			}
+		`)
+}
+
 func TestTargetSdkVersionManifestFixer(t *testing.T) {
 	platform_sdk_codename := "Tiramisu"
 	testCases := []struct {
@@ -55,6 +55,11 @@ type CommonProperties struct {
 	// This is most useful in the arch/multilib variants to remove non-common files
 	Exclude_srcs []string `android:"path,arch_variant"`
 
+	// whether the module may compile sources from outside of its directory, either directly or
+	// through filegroups. "strict" reports an error for such sources, "none" allows them. Defaults
+	// to the package_boundary of the soong_namespace of the module, or "none".
+	Package_boundary *string
+
 	// list of directories containing Java resources
 	Java_resource_dirs []string `android:"arch_variant"`
 
@@ -88,6 +93,14 @@ type CommonProperties struct {
 	// If not blank, set the java version passed to javac as -source and -target
 	Java_version *string
 
+	// Sources compiled for a newer Java release than java_version and packaged under
+	// META-INF/versions/<release> of a multi-release jar, so that their classes replace the classes
+	// with the same name when running on that release or later. Only supported for host modules.
+	Multi_release struct {
+		Java_11 multiReleaseProperties
+		Java_17 multiReleaseProperties
+	}
+
 	// If set to true, allow this module to be dexed and installed on devices.  Has no
 	// effect on host modules, which are always considered installable.
 	Installable *bool
@@ -102,6 +115,12 @@ type CommonProperties struct {
 	// List of modules to use as annotation processors
 	Plugins []string
 
+	// List of java_plugin modules to run as Kotlin Symbol Processing (KSP) processors over the
+	// kotlin and java sources of the module. The processors are found with the service loader, so
+	// their processor_class is not used. Unlike plugins, which run with kapt in modules with kotlin
+	// sources, KSP processors do not need java stubs to be generated for the kotlin sources.
+	Ksp_plugins []string
+
 	// List of modules to export to libraries that directly depend on this library as annotation
 	// processors.  Note that if the plugins set generates_api: true this will disable the turbine
 	// optimization on modules that depend on this module, which will reduce parallelism and cause
@@ -184,6 +203,12 @@ type CommonProperties struct {
 	Hiddenapi_additional_annotations []string
 }
 
+// Properties of the sources compiled for a specific Java release of a multi-release jar.
+type multiReleaseProperties struct {
+	// list of source files compiled for the release, which can use classes compiled from srcs
+	Srcs []string `android:"path"`
+}
+
 // Properties that are specific to device modules. Host module factories should not add these when
 // constructing a new module.
 type DeviceProperties struct {
@@ -420,6 +445,9 @@ type Module struct {
 	// output file containing classes.dex and resources
 	dexJarFile OptionalDexJarPath
 
+	// lists of the classes and method counts in dexJarFile
+	dexClassList DexClassListInfo
+
 	// output file containing uninstrumented classes that will be instrumented by jacoco
 	jacocoReportClassesFile android.Path
 
@@ -457,6 +485,13 @@ type Module struct {
 	// if true, the exported plugins generate API and require disabling turbine.
 	exportedDisableTurbine bool
 
+	// list of main dex rules files of this module and its static dependencies
+	exportedMainDexRules android.Paths
+
+	// minimum version of the JVM that can load the classes compiled by kotlinc for this module and
+	// its static dependencies
+	minJvmVersion javaVersion
+
 	// list of source files, collected from srcFiles with unique java and all kt files,
 	// will be used by android.IDEInfo struct
 	expandIDEInfoCompiledSrcs []string
@@ -486,6 +521,9 @@ type Module struct {
 	maxSdkVersion android.SdkSpec
 
 	sourceExtensions []string
+
+	// The sources from outside of the module directory, for the package boundary report.
+	outsidePackageSrcs android.Paths
 }
 
 func (j *Module) CheckStableSdkVersion(ctx android.BaseModuleContext) error {
@@ -576,6 +614,16 @@ func (j *Module) OutputFiles(tag string) (android.Paths, error) {
 			return android.Paths{j.dexer.proguardDictionary.Path()}, nil
 		}
 		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".dex_class_list":
+		if j.dexClassList.ClassList != nil {
+			return android.Paths{j.dexClassList.ClassList}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".dex_method_counts":
+		if j.dexClassList.MethodCounts != nil {
+			return android.Paths{j.dexClassList.MethodCounts}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -736,6 +784,7 @@ func (j *Module) deps(ctx android.BottomUpMutatorContext) {
 	}
 
 	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), pluginTag, j.properties.Plugins...)
+	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), kspPluginTag, j.properties.Ksp_plugins...)
 	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), errorpronePluginTag, j.properties.Errorprone.Extra_check_modules...)
 	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), exportedPluginTag, j.properties.Exported_plugins...)
 
@@ -874,6 +923,7 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 	// classpath
 	flags.bootClasspath = append(flags.bootClasspath, deps.bootClasspath...)
 	flags.classpath = append(flags.classpath, deps.classpath...)
+	flags.abiDigests = deps.abiDigests
 	flags.dexClasspath = append(flags.dexClasspath, deps.dexClasspath...)
 	flags.java9Classpath = append(flags.java9Classpath, deps.java9Classpath...)
 	flags.processorPath = append(flags.processorPath, deps.processorPath...)
@@ -1001,6 +1051,19 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	deps := j.collectDeps(ctx)
 	flags := j.collectBuilderFlags(ctx, deps)
 
+	j.dexer.extraMainDexRules = android.FirstUniquePaths(deps.staticMainDexRules)
+	j.exportedMainDexRules = android.FirstUniquePaths(append(
+		android.PathsForModuleSrc(ctx, j.dexProperties.Main_dex_rules), deps.staticMainDexRules...))
+
+	if ctx.Host() {
+		checkMinJvmVersions(ctx, deps.jvmVersionDeps, flags.javaVersion)
+	}
+	for _, dep := range deps.jvmVersionDeps {
+		if dep.static && dep.minJvmVersion > j.minJvmVersion {
+			j.minJvmVersion = dep.minJvmVersion
+		}
+	}
+
 	if flags.javaVersion.usesJavaModules() {
 		j.properties.Srcs = append(j.properties.Srcs, j.properties.Openjdk9.Srcs...)
 	}
@@ -1021,6 +1084,10 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		ctx.PropertyErrorf("common_srcs", "common_srcs must be .kt files")
 	}
 
+	boundary := packageBoundary(ctx, j.properties.Package_boundary)
+	j.outsidePackageSrcs = append(checkPackageBoundary(ctx, boundary, "srcs", srcFiles),
+		checkPackageBoundary(ctx, boundary, "common_srcs", kotlinCommonSrcFiles)...)
+
 	srcFiles = j.genSources(ctx, srcFiles, flags)
 
 	// Collect javac flags only after computing the full set of srcFiles to
@@ -1061,7 +1128,40 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 
 	var kotlinJars android.Paths
 	var kotlinHeaderJars android.Paths
+	var ideKotlincFlags []string
+
+	var isolatedPluginResJars android.Paths
+	if len(deps.isolatedPlugins) > 0 {
+		if srcFiles.HasExt(".kt") {
+			// kapt runs all the annotation processors in a single pass over the kotlin and java sources.
+			for _, plugin := range deps.isolatedPlugins {
+				flags.processorPath = append(flags.processorPath, plugin.jars...)
+				flags.processors = append(flags.processors, plugin.processorClass)
+			}
+		} else if len(uniqueSrcFiles) > 0 || len(srcJars) > 0 {
+			// Every isolated annotation processor runs over the same sources, the sources generated by
+			// one of them are not visible to the others.
+			var isolatedPluginSrcJars android.Paths
+			for _, plugin := range deps.isolatedPlugins {
+				genSrcJar := android.PathForModuleOut(ctx, "annotation_processors", plugin.name, plugin.name+".srcjar")
+				var genResJar android.WritablePath
+				if plugin.generatesResources {
+					genResJar = android.PathForModuleOut(ctx, "annotation_processors", plugin.name, plugin.name+"-res.jar")
+					isolatedPluginResJars = append(isolatedPluginResJars, genResJar)
+				}
+				transformJavaToAnnotationProcessorOutputs(ctx, genSrcJar, genResJar, uniqueSrcFiles, srcJars,
+					flags, plugin)
+				isolatedPluginSrcJars = append(isolatedPluginSrcJars, genSrcJar)
+			}
+			srcJars = append(srcJars, isolatedPluginSrcJars...)
+		}
+	}
 
+	if len(deps.kspProcessorPath) > 0 && !srcFiles.HasExt(".kt") {
+		ctx.PropertyErrorf("ksp_plugins", "can only be used in modules with kotlin sources")
+	}
+
+	var kspKotlinSrcJars android.Paths
 	if srcFiles.HasExt(".kt") {
 		// When using kotlin sources turbine is used to generate annotation processor sources,
 		// including for annotation processors that generate API, so we can use turbine for
@@ -1088,6 +1188,12 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		}
 		flags.kotlincDeps = append(flags.kotlincDeps, deps.kotlinPlugins...)
 
+		if v := kotlinMinJvmVersion(flags.javaVersion, j.properties.Kotlincflags); v > j.minJvmVersion {
+			j.minJvmVersion = v
+		}
+
+		ideKotlincFlags = kotlincFlags
+
 		if len(kotlincFlags) > 0 {
 			// optimization.
 			ctx.Variable(pctx, "kotlincFlags", strings.Join(kotlincFlags, " "))
@@ -1108,21 +1214,48 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		flags.kotlincClasspath = append(flags.kotlincClasspath, flags.bootClasspath...)
 		flags.kotlincClasspath = append(flags.kotlincClasspath, flags.classpath...)
 
+		kotlinJar := android.PathForModuleOut(ctx, "kotlin", jarName)
+		kotlinHeaderJar := android.PathForModuleOut(ctx, "kotlin_headers", jarName)
+
+		if len(deps.kspProcessorPath) > 0 {
+			// Run the KSP processors before kapt, so that the java sources they generate are
+			// visible to the annotation processors.
+			kspSrcJar := android.PathForModuleOut(ctx, "ksp", "ksp-java-sources.srcjar")
+			kspKotlinSrcJar := android.PathForModuleOut(ctx, "ksp", "ksp-kotlin-sources.srcjar")
+			kspResJar := android.PathForModuleOut(ctx, "ksp", "ksp-res.jar")
+			kotlinKsp(ctx, kspSrcJar, kspKotlinSrcJar, kspResJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars,
+				deps.kspProcessorPath, flags)
+			srcJars = append(srcJars, kspSrcJar)
+			kspKotlinSrcJars = append(kspKotlinSrcJars, kspKotlinSrcJar)
+			kotlinJars = append(kotlinJars, kspResJar)
+		}
+
+		var kotlinValidations android.Paths
 		if len(flags.processorPath) > 0 {
 			// Use kapt for annotation processing
 			kaptSrcJar := android.PathForModuleOut(ctx, "kapt", "kapt-sources.jar")
 			kaptResJar := android.PathForModuleOut(ctx, "kapt", "kapt-res.jar")
-			kotlinKapt(ctx, kaptSrcJar, kaptResJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
+			kaptStubsJar := android.PathForModuleOut(ctx, "kapt", "kapt-stubs.srcjar")
+			kotlinKapt(ctx, kaptSrcJar, kaptResJar, kaptStubsJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
 			srcJars = append(srcJars, kaptSrcJar)
 			kotlinJars = append(kotlinJars, kaptResJar)
 			// Disable annotation processing in javac, it's already been handled by kapt
 			flags.processorPath = nil
 			flags.processors = nil
+
+			// If KAPT_CORRECTNESS_CHECK is set, check that the stubs that the annotation processors
+			// ran against match the classes compiled by kotlinc.  The check runs in parallel with
+			// the rest of the build but fails it on a mismatch.
+			if ctx.Config().IsEnvTrue("KAPT_CORRECTNESS_CHECK") {
+				kaptStubsCheckFile := android.PathForModuleOut(ctx, "kapt", "kapt-stubs-check.stamp")
+				kotlinKaptStubsCheck(ctx, kaptStubsCheckFile, kaptStubsJar, kotlinHeaderJar,
+					uniqueSrcFiles, srcJars, flags)
+				kotlinValidations = append(kotlinValidations, kaptStubsCheckFile)
+			}
 		}
 
-		kotlinJar := android.PathForModuleOut(ctx, "kotlin", jarName)
-		kotlinHeaderJar := android.PathForModuleOut(ctx, "kotlin_headers", jarName)
-		kotlinCompile(ctx, kotlinJar, kotlinHeaderJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
+		kotlinCompile(ctx, kotlinJar, kotlinHeaderJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars,
+			kspKotlinSrcJars, flags, kotlinValidations)
 		if ctx.Failed() {
 			return
 		}
@@ -1149,7 +1282,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 
 	// Store the list of .java files that was passed to javac
 	j.compiledJavaSrcs = uniqueSrcFiles
-	j.compiledSrcJars = srcJars
+	// Store the list of srcjars, including those of the kotlin sources generated by KSP that were
+	// only passed to kotlinc.
+	j.compiledSrcJars = append(append(android.Paths(nil), srcJars...), kspKotlinSrcJars...)
 
 	enableSharding := false
 	var headerJarFileWithoutDepsOrJarjar android.Path
@@ -1218,6 +1353,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		}
 	}
 
+	multiReleaseJars := j.compileMultiReleaseClasses(ctx, flags, jars)
+	jars = append(jars, multiReleaseJars...)
+
 	j.srcJarArgs, j.srcJarDeps = resourcePathsToJarArgs(srcFiles), srcFiles
 
 	var includeSrcJar android.WritablePath
@@ -1259,6 +1397,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	if Bool(j.properties.Include_srcs) {
 		resourceJars = append(resourceJars, includeSrcJar)
 	}
+	resourceJars = append(resourceJars, isolatedPluginResJars...)
 	resourceJars = append(resourceJars, deps.staticResourceJars...)
 
 	if len(resourceJars) > 1 {
@@ -1270,6 +1409,10 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		j.resourceJar = resourceJars[0]
 	}
 
+	if j.dexer.checkDuplicateClasses && ctx.Device() && len(deps.staticJars) > 0 {
+		j.dexer.duplicateClassesCheck = android.OptionalPathForPath(j.dexer.buildDuplicateClassesCheck(ctx, jars))
+	}
+
 	if len(deps.staticJars) > 0 {
 		jars = append(jars, deps.staticJars...)
 	}
@@ -1279,6 +1422,12 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		manifest = android.OptionalPathForPath(android.PathForModuleSrc(ctx, *j.properties.Manifest))
 	}
 
+	if len(multiReleaseJars) > 0 {
+		multiReleaseManifest := android.PathForModuleOut(ctx, "multi-release", "manifest.txt")
+		GenerateMultiReleaseManifest(ctx, multiReleaseManifest, manifest)
+		manifest = android.OptionalPathForPath(multiReleaseManifest)
+	}
+
 	services := android.PathsForModuleSrc(ctx, j.properties.Services)
 	if len(services) > 0 {
 		servicesJar := android.PathForModuleOut(ctx, "services", jarName)
@@ -1464,6 +1613,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 			dexOutputFile = j.hiddenAPIEncodeDex(ctx, dexOutputFile)
 
 			j.dexJarFile = makeDexJarPathFromPath(dexOutputFile)
+			j.dexClassList = buildDexClassList(ctx, dexOutputFile)
 
 			// Dexpreopting
 			j.dexpreopt(ctx, dexOutputFile)
@@ -1511,6 +1661,25 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 
 	ctx.CheckbuildFile(outputFile)
 
+	var headerJarAbiDigest android.Path
+	if useAbiDigests(ctx.Config()) {
+		digest := android.PathForModuleOut(ctx, "abi-digest", jarName+".sha256")
+		TransformHeaderJarToAbiDigest(ctx, digest, j.headerJarFile)
+		headerJarAbiDigest = digest
+	}
+
+	ctx.SetProvider(ideProjectInfoProvider, ideProjectInfo{
+		Sdk_version:        j.SdkVersion(ctx).Raw,
+		Java_version:       flags.javaVersion.String(),
+		Srcs:               j.expandIDEInfoCompiledSrcs,
+		Srcjars:            j.compiledSrcJars.Strings(),
+		Generated_src_dirs: generatedSrcDirs(srcFiles),
+		Bootclasspath:      append(flags.bootClasspath.Strings(), deps.systemModulesHeaderJars.Strings()...),
+		Classpath:          flags.classpath.Strings(),
+		Kotlinc_flags:      ideKotlincFlags,
+		Output_jar:         outputFile.String(),
+	})
+
 	ctx.SetProvider(JavaInfoProvider, JavaInfo{
 		HeaderJars:                     android.PathsIfNonNil(j.headerJarFile),
 		ImplementationAndResourcesJars: android.PathsIfNonNil(j.implementationAndResourcesJar),
@@ -1523,6 +1692,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		ExportedPluginClasses:          j.exportedPluginClasses,
 		ExportedPluginDisableTurbine:   j.exportedDisableTurbine,
 		JacocoReportClassesFile:        j.jacocoReportClassesFile,
+		ExportedMainDexRules:           j.exportedMainDexRules,
+		MinJvmVersion:                  j.minJvmVersion,
+		HeaderJarAbiDigest:             headerJarAbiDigest,
 	})
 
 	// Save the output file with no relative path so that it doesn't end up in a subdirectory when used as a resource
@@ -1548,6 +1720,58 @@ func enableErrorproneFlags(flags javaBuilderFlags) javaBuilderFlags {
 	return flags
 }
 
+// compileMultiReleaseClasses compiles the sources of each release of a multi-release jar against
+// the classes compiled from srcs and returns the jars that contain their classes under
+// META-INF/versions/<release>.
+func (j *Module) compileMultiReleaseClasses(ctx android.ModuleContext, flags javaBuilderFlags,
+	classesJars android.Paths) android.Paths {
+
+	releases := []struct {
+		name       string
+		version    javaVersion
+		properties multiReleaseProperties
+	}{
+		{"java_11", JAVA_VERSION_11, j.properties.Multi_release.Java_11},
+		{"java_17", JAVA_VERSION_17, j.properties.Multi_release.Java_17},
+	}
+
+	var jars android.Paths
+	for _, release := range releases {
+		if len(release.properties.Srcs) == 0 {
+			continue
+		}
+		property := "multi_release." + release.name + ".srcs"
+		if ctx.Device() {
+			ctx.PropertyErrorf(property, "multi-release jars are only supported for host modules")
+			continue
+		}
+		if release.version == JAVA_VERSION_17 && !openJDK17ToolchainEnabled(ctx.Config()) {
+			ctx.PropertyErrorf(property, "release 17 requires the JDK 17 toolchain "+
+				"(EXPERIMENTAL_USE_OPENJDK17_TOOLCHAIN=true)")
+			continue
+		}
+		if release.version <= flags.javaVersion {
+			ctx.PropertyErrorf(property, "release %s must be newer than java_version %s",
+				release.version, flags.javaVersion)
+			continue
+		}
+
+		// The sources of the release can use the classes compiled from srcs, but are not processed
+		// by annotation processors as their output would duplicate the classes generated for srcs.
+		releaseFlags := flags
+		releaseFlags.javaVersion = release.version
+		releaseFlags.classpath = append(append(classpath(nil), classesJars...), flags.classpath...)
+		releaseFlags.processorPath = nil
+		releaseFlags.processors = nil
+
+		srcFiles := android.PathsForModuleSrc(ctx, release.properties.Srcs)
+		releaseJar := android.PathForModuleOut(ctx, "multi-release", release.version.String()+".jar")
+		TransformJavaToMultiReleaseClasses(ctx, releaseJar, srcFiles, releaseFlags)
+		jars = append(jars, releaseJar)
+	}
+	return jars
+}
+
 func (j *Module) compileJavaClasses(ctx android.ModuleContext, jarName string, idx int,
 	srcFiles, srcJars android.Paths, flags javaBuilderFlags, extraJarDeps android.Paths) android.WritablePath {
 
@@ -1909,6 +2133,12 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				syspropDep := ctx.OtherModuleProvider(module, SyspropPublicStubInfoProvider).(SyspropPublicStubInfo)
 				dep = syspropDep.JavaInfo
 			}
+			if dep.HeaderJarAbiDigest != nil && len(dep.HeaderJars) == 1 {
+				if deps.abiDigests == nil {
+					deps.abiDigests = make(map[string]android.Path)
+				}
+				deps.abiDigests[dep.HeaderJars[0].String()] = dep.HeaderJarAbiDigest
+			}
 			switch tag {
 			case bootClasspathTag:
 				deps.bootClasspath = append(deps.bootClasspath, dep.HeaderJars...)
@@ -1918,6 +2148,10 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.aidlIncludeDirs = append(deps.aidlIncludeDirs, dep.AidlIncludeDirs...)
 				addPlugins(&deps, dep.ExportedPlugins, dep.ExportedPluginClasses...)
 				deps.disableTurbine = deps.disableTurbine || dep.ExportedPluginDisableTurbine
+				if dep.MinJvmVersion != JAVA_VERSION_UNSUPPORTED {
+					deps.jvmVersionDeps = append(deps.jvmVersionDeps,
+						jvmVersionDep{otherName, dep.MinJvmVersion, false})
+				}
 			case java9LibTag:
 				deps.java9Classpath = append(deps.java9Classpath, dep.HeaderJars...)
 			case staticLibTag:
@@ -1925,6 +2159,11 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.staticJars = append(deps.staticJars, dep.ImplementationJars...)
 				deps.staticHeaderJars = append(deps.staticHeaderJars, dep.HeaderJars...)
 				deps.staticResourceJars = append(deps.staticResourceJars, dep.ResourceJars...)
+				deps.staticMainDexRules = append(deps.staticMainDexRules, dep.ExportedMainDexRules...)
+				if dep.MinJvmVersion != JAVA_VERSION_UNSUPPORTED {
+					deps.jvmVersionDeps = append(deps.jvmVersionDeps,
+						jvmVersionDep{otherName, dep.MinJvmVersion, true})
+				}
 				deps.aidlIncludeDirs = append(deps.aidlIncludeDirs, dep.AidlIncludeDirs...)
 				addPlugins(&deps, dep.ExportedPlugins, dep.ExportedPluginClasses...)
 				// Turbine doesn't run annotation processors, so any module that uses an
@@ -1932,7 +2171,16 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				// optimization.
 				deps.disableTurbine = deps.disableTurbine || dep.ExportedPluginDisableTurbine
 			case pluginTag:
-				if plugin, ok := module.(*Plugin); ok {
+				if plugin, ok := module.(*Plugin); ok && Bool(plugin.pluginProperties.Isolated) {
+					// Isolated annotation processors run in their own javac pass, whose generated
+					// sources are visible to turbine, so they never require disabling turbine.
+					deps.isolatedPlugins = append(deps.isolatedPlugins, isolatedPlugin{
+						name:               otherName,
+						jars:               dep.ImplementationAndResourcesJars,
+						processorClass:     String(plugin.pluginProperties.Processor_class),
+						generatesResources: Bool(plugin.pluginProperties.Generates_resources),
+					})
+				} else if ok {
 					if plugin.pluginProperties.Processor_class != nil {
 						addPlugins(&deps, dep.ImplementationAndResourcesJars, *plugin.pluginProperties.Processor_class)
 					} else {
@@ -1970,6 +2218,12 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.kotlinAnnotations = dep.HeaderJars
 			case kotlinPluginTag:
 				deps.kotlinPlugins = append(deps.kotlinPlugins, dep.ImplementationAndResourcesJars...)
+			case kspPluginTag:
+				if _, ok := module.(*Plugin); ok {
+					deps.kspProcessorPath = append(deps.kspProcessorPath, dep.ImplementationAndResourcesJars...)
+				} else {
+					ctx.PropertyErrorf("ksp_plugins", "%q is not a java_plugin module", otherName)
+				}
 			case syspropPublicStubDepTag:
 				// This is a sysprop implementation library, forward the JavaInfoProvider from
 				// the corresponding sysprop public stub library as SyspropPublicStubInfoProvider.
@@ -2004,6 +2258,7 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				sm := module.(SystemModulesProvider)
 				outputDir, outputDeps := sm.OutputDirAndDeps()
 				deps.systemModules = &systemModules{outputDir, outputDeps}
+				deps.systemModulesHeaderJars = sm.HeaderJars()
 
 			case instrumentationForTag:
 				ctx.PropertyErrorf("instrumentation_for", "dependency %q of type %q does not provide JavaInfo so is unsuitable for use with this property", ctx.OtherModuleName(module), ctx.OtherModuleType(module))
@@ -0,0 +1,84 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"android/soong/android"
+)
+
+// This file contains the support for deduplicating the resources of the platform boot jars, which
+// is enabled with the DedupBootJars product variable to reduce the memory footprint of the boot
+// classpath on low-RAM devices. A resource of a platform boot jar that is identical to the resource
+// at the same path in an earlier platform boot jar is removed from it, as the boot class loader
+// always finds the earlier one. The platform_bootclasspath module, which depends on the platform
+// boot jars in boot classpath order, deduplicates each of them against the ones that precede it
+// and installs the deduplicated jars, which are also compiled into the boot image, instead of the
+// modules.
+//
+// Only resources are deduplicated. The string data of a dex file is referenced by index from the
+// code of its classes, so it cannot be removed without compiling the classes again.
+
+// isDedupedBootJar returns true if the jar of the module is deduplicated and installed by the
+// platform_bootclasspath module instead of the module itself.
+func isDedupedBootJar(ctx android.BaseModuleContext) bool {
+	if !ctx.Device() || !ctx.Config().DedupBootJars() {
+		return false
+	}
+	bootJars := ctx.Config().NonApexBootJars()
+	index := bootJars.IndexOfJar(ctx.ModuleName())
+	return index >= 0 && bootJars.Apex(index) == "platform"
+}
+
+// buildBootJarsDedup generates the rules that remove from each platform boot jar the resources
+// that are also in an earlier platform boot jar, installs the deduplicated jars and writes the
+// concatenation of their reports. It returns the deduplicated jars, or nil if DedupBootJars is not
+// set. The modules must be in boot classpath order.
+func (b *platformBootclasspathModule) buildBootJarsDedup(ctx android.ModuleContext, platformModules []android.Module) bootDexJarByModule {
+	if !ctx.Config().DedupBootJars() || len(platformModules) == 0 {
+		return nil
+	}
+
+	deduped := bootDexJarByModule{}
+	var earlierJars, reports android.Paths
+	installDir := android.PathForModuleInstall(ctx, "framework")
+	for _, module := range platformModules {
+		name := android.RemoveOptionalPrebuiltPrefix(module.Name())
+		dexJar := retrieveEncodedBootDexJarFromModule(ctx, module)
+		// The resources are removed by rewriting the jar, so its uncompressed dex files are aligned
+		// again afterwards.
+		unaligned := android.PathForModuleOut(ctx, "boot_jars_dedup", "unaligned", name+".jar")
+		output := android.PathForModuleOut(ctx, "boot_jars_dedup", name+".jar")
+		report := android.PathForModuleOut(ctx, "boot_jars_dedup", name+".txt")
+
+		rule := android.NewRuleBuilder(pctx, ctx)
+		cmd := rule.Command().BuiltTool("dedup_boot_jars")
+		for _, earlierJar := range earlierJars {
+			cmd.FlagWithInput("--earlier-jar ", earlierJar)
+		}
+		cmd.Flag("--jar").Text(name).Input(dexJar).Output(unaligned).
+			FlagWithOutput("--report ", report)
+		rule.Build("boot_jars_dedup_"+name, "deduplicate boot jar resources "+name)
+		TransformZipAlign(ctx, output, unaligned)
+
+		ctx.InstallFile(installDir, name+".jar", output)
+		deduped.addPath(module, output)
+		reports = append(reports, report)
+		earlierJars = append(earlierJars, dexJar)
+	}
+
+	b.bootJarsDedupReport = android.PathForModuleOut(ctx, "boot_jars_dedup", "report.txt")
+	android.CatFileRule(ctx, reports, b.bootJarsDedupReport)
+	return deduped
+}
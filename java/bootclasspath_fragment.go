@@ -94,6 +94,27 @@ var _ android.SdkMemberDependencyTag = bootclasspathFragmentContentDepTag
 var _ android.CopyDirectlyInAnyApexTag = bootclasspathFragmentContentDepTag
 var _ android.RequiresFilesFromPrebuiltApexTag = bootclasspathFragmentContentDepTag
 
+// finalizedExtensionApiDependencyTag is used for the dependencies of a bootclasspath_fragment onto
+// the API files of its java_sdk_library contents that were finalized in the current SDK extension
+// version.
+type finalizedExtensionApiDependencyTag struct {
+	blueprint.BaseDependencyTag
+
+	// The name of the content module whose API was finalized.
+	module string
+
+	// The scope of the API.
+	apiScope *apiScope
+
+	// True if this is the file of the API elements removed since the last release.
+	removed bool
+}
+
+func (t finalizedExtensionApiDependencyTag) ExcludeFromApexContents() {
+}
+
+var _ android.ExcludeFromApexContentsTag = finalizedExtensionApiDependencyTag{}
+
 func IsBootclasspathFragmentContentDepTag(tag blueprint.DependencyTag) bool {
 	return tag == bootclasspathFragmentContentDepTag
 }
@@ -238,6 +259,10 @@ type BootclasspathFragmentModule struct {
 	// handled by Make (e.g., the boot image should be installed on the system partition, rather than
 	// in the APEX).
 	bootImageDeviceInstalls []dexpreopterInstall
+
+	// The timestamps of the checks of the API of the contents against the API finalized in the
+	// current SDK extension version.
+	finalizedExtensionApiCheckTimestamps android.Paths
 }
 
 // commonBootclasspathFragment defines the methods that are implemented by both source and prebuilt
@@ -412,8 +437,9 @@ type BootclasspathFragmentApexContentInfo struct {
 	// Map from arch type to the boot image files.
 	bootImageFilesByArch bootImageFilesByArch
 
-	// True if the boot image should be installed in the APEX.
-	shouldInstallBootImageInApex bool
+	// The ApexContents of the APEX of this module in which the boot image is installed, or nil if
+	// the boot image is not installed in an APEX.
+	bootImageInstallApex *android.ApexContents
 
 	// Map from the base module name (without prebuilt_ prefix) of a fragment's contents module to the
 	// hidden API encoded dex jar path.
@@ -440,7 +466,14 @@ func (i BootclasspathFragmentApexContentInfo) AndroidBootImageFilesByArchType()
 
 // Return true if the boot image should be installed in the APEX.
 func (i *BootclasspathFragmentApexContentInfo) ShouldInstallBootImageInApex() bool {
-	return i.shouldInstallBootImageInApex
+	return i.bootImageInstallApex != nil
+}
+
+// BootImageInstallApex returns the ApexContents of the APEX in which the boot image is installed,
+// which identifies the module of the APEX and its apex_name, or nil if the boot image is not
+// installed in an APEX.
+func (i *BootclasspathFragmentApexContentInfo) BootImageInstallApex() *android.ApexContents {
+	return i.bootImageInstallApex
 }
 
 // DexBootJarPathForContentModule returns the path to the dex boot jar for specified module.
@@ -518,6 +551,11 @@ func (b *BootclasspathFragmentModule) DepsMutator(ctx android.BottomUpMutatorCon
 		}
 	}
 
+	// Only the source module builds the API stubs that can be checked against the finalized API.
+	if _, isSourceModule := ctx.Module().(*BootclasspathFragmentModule); isSourceModule && ctx.Config().HasPlatformSdkExtensionVersion() {
+		b.addFinalizedExtensionApiDependencies(ctx)
+	}
+
 	if SkipDexpreoptBootJars(ctx) {
 		return
 	}
@@ -527,6 +565,27 @@ func (b *BootclasspathFragmentModule) DepsMutator(ctx android.BottomUpMutatorCon
 	dexpreopt.RegisterToolDeps(ctx)
 }
 
+// addFinalizedExtensionApiDependencies adds dependencies onto the API files of the contents that
+// were finalized in the current SDK extension version, if any.
+func (b *BootclasspathFragmentModule) addFinalizedExtensionApiDependencies(ctx android.BottomUpMutatorContext) {
+	version := ctx.Config().PlatformSdkExtensionVersion()
+	for _, name := range b.properties.Contents {
+		for _, scope := range allApiScopes {
+			for _, removed := range []bool{false, true} {
+				apiModule := name
+				if removed {
+					apiModule += "-removed"
+				}
+				apiModule = prebuiltExtensionApiModuleName(apiModule, scope.name, version)
+				if ctx.OtherModuleExists(apiModule) {
+					tag := finalizedExtensionApiDependencyTag{module: name, apiScope: scope, removed: removed}
+					ctx.AddDependency(ctx.Module(), tag, apiModule)
+				}
+			}
+		}
+	}
+}
+
 func (b *BootclasspathFragmentModule) BootclasspathDepsMutator(ctx android.BottomUpMutatorContext) {
 	// Add dependencies on all the fragments.
 	b.properties.BootclasspathFragmentsDepsProperties.addDependenciesOntoFragments(ctx)
@@ -557,6 +616,11 @@ func (b *BootclasspathFragmentModule) GenerateAndroidBuildActions(ctx android.Mo
 
 	fragments := gatherApexModulePairDepsWithTag(ctx, bootclasspathFragmentDepTag)
 
+	// Only check the API of the variant that is output to Make, the others are identical.
+	if ctx.Module() == ctx.FinalModule() {
+		b.checkFinalizedExtensionApis(ctx, contents)
+	}
+
 	// Verify that the image_name specified on a bootclasspath_fragment is valid even if this is a
 	// prebuilt which will not use the image config.
 	imageConfig := b.getImageConfig(ctx)
@@ -624,6 +688,66 @@ func (b *BootclasspathFragmentModule) GenerateAndroidBuildActions(ctx android.Mo
 	}
 }
 
+// checkFinalizedExtensionApis checks the API files of the stubs built from the sources of the
+// java_sdk_library contents against the API files finalized in the current SDK extension version.
+// The check fails if an API element finalized in that version has been removed or changed.
+func (b *BootclasspathFragmentModule) checkFinalizedExtensionApis(ctx android.ModuleContext, contents []android.Module) {
+	libraries := make(map[string]*SdkLibrary)
+	for _, module := range contents {
+		if library, ok := module.(*SdkLibrary); ok {
+			libraries[ctx.OtherModuleName(module)] = library
+		}
+	}
+
+	ctx.VisitDirectDeps(func(module android.Module) {
+		tag, ok := ctx.OtherModuleDependencyTag(module).(finalizedExtensionApiDependencyTag)
+		if !ok {
+			return
+		}
+		library := libraries[tag.module]
+		if library == nil {
+			return
+		}
+		paths := library.findScopePaths(tag.apiScope)
+		if paths == nil {
+			return
+		}
+		apiFile := paths.currentApiFilePath
+		name := tag.module + "." + tag.apiScope.name
+		if tag.removed {
+			apiFile = paths.removedApiFilePath
+			name += "-removed"
+		}
+		if !apiFile.Valid() {
+			return
+		}
+		finalizedApiFile := android.OutputFileForModule(ctx, module, "")
+
+		timestamp := android.PathForModuleOut(ctx, "check_finalized_extension_api", name+".timestamp")
+		rule := android.NewRuleBuilder(pctx, ctx)
+
+		// Lines only in the finalized API file are API elements that have been removed or changed.
+		// -F matches the closest "opening" line, such as "package android {" and
+		// "  public class Intent {".
+		diff := `diff -u -F '{ *$'`
+		msg := fmt.Sprintf(`\n******************************\n`+
+			`The API of %s has diverged from the %s API finalized in SDK extension version %d,\n`+
+			`the API elements removed from the finalized API are shown in the above diff.\n`+
+			`Finalized APIs cannot be removed or changed.\n`+
+			`******************************\n`, tag.module, tag.apiScope.name, ctx.Config().PlatformSdkExtensionVersion())
+
+		rule.Command().
+			Text("if").Text(diff).Input(finalizedApiFile).Input(apiFile.Path()).Text("| grep -q '^-[^-]'; then").
+			Text(diff).Text(finalizedApiFile.String()).Text(apiFile.String()).Text(";").
+			Text("echo").Flag("-e").Flag(`"` + msg + `"`).Text("; exit 38;").
+			Text("fi")
+		rule.Command().Text("touch").Output(timestamp)
+		rule.Build("check_finalized_extension_api_"+name, "check "+name+" against the finalized extension API")
+
+		b.finalizedExtensionApiCheckTimestamps = append(b.finalizedExtensionApiCheckTimestamps, timestamp)
+	})
+}
+
 // shouldCopyBootFilesToPredefinedLocations determines whether the current module should copy boot
 // files, e.g. boot dex jars or boot image files, to the predefined location expected by the rest
 // of the build.
@@ -643,6 +767,13 @@ func shouldCopyBootFilesToPredefinedLocations(ctx android.ModuleContext, imageCo
 		return false
 	}
 
+	// A boot image that is installed in an APEX can only be provided by a module in that APEX.
+	if location := imageConfig.installLocationOnDevice; !location.providedBy(apexInfo) {
+		ctx.ModuleErrorf("cannot provide the %q boot image as it is installed in the APEX with apex_name %q which does not contain this module",
+			imageConfig.name, location.apexName)
+		return false
+	}
+
 	// Only copy files from the module that is preferred.
 	return isActiveModule(ctx.Module())
 }
@@ -664,7 +795,11 @@ func (b *BootclasspathFragmentModule) provideApexContentInfo(ctx android.ModuleC
 			info.profileInstallPathInApex = imageConfig.profileInstallPathInApex
 		}
 
-		info.shouldInstallBootImageInApex = imageConfig.shouldInstallInApex()
+		// Only install the boot image in the APEX that this module is part of.
+		apexInfo := ctx.Provider(android.ApexInfoProvider).(android.ApexInfo)
+		if location := imageConfig.installLocationOnDevice; location.inApex() {
+			info.bootImageInstallApex = location.apexContents(apexInfo)
+		}
 	}
 
 	info.bootImageFilesByArch = bootImageFilesByArch
@@ -765,6 +900,7 @@ func (b *BootclasspathFragmentModule) generateHiddenAPIBuildActions(ctx android.
 		// generation. That is because the monolithic hidden API processing uses those flag files to
 		// perform its own flag generation.
 		FlagFilesByCategory: input.FlagFilesByCategory,
+		FlagOverrideFiles:   input.FlagOverrideFiles,
 
 		// Other bootclasspath_fragments that depend on this need the transitive set of stub dex jars
 		// from this to resolve any references from their code to classes provided by this fragment
@@ -813,6 +949,9 @@ func (b *BootclasspathFragmentModule) createHiddenAPIFlagInput(ctx android.Modul
 	// Populate with flag file paths from the properties.
 	input.extractFlagFilesFromProperties(ctx, &b.properties.Hidden_api)
 
+	// Merge in the flag override files provided by the contents.
+	input.gatherFlagOverrides(contents)
+
 	// Add the stub dex jars from this module's fragment dependencies.
 	input.DependencyStubDexJarsByScope.addStubDexJarsByModule(dependencyHiddenApiInfo.TransitiveStubDexJarsByScope)
 
@@ -902,6 +1041,18 @@ func (b *BootclasspathFragmentModule) AndroidMkEntries() []android.AndroidMkEntr
 				// line.
 				fmt.Fprintln(w, ".PHONY:", b.Name())
 				fmt.Fprintln(w, b.Name()+":", outputFile.String())
+
+				if len(b.finalizedExtensionApiCheckTimestamps) > 0 {
+					timestamps := strings.Join(b.finalizedExtensionApiCheckTimestamps.Strings(), " ")
+					fmt.Fprintln(w, ".PHONY:", b.Name()+"-check-finalized-extension-api")
+					fmt.Fprintln(w, b.Name()+"-check-finalized-extension-api:", timestamps)
+
+					fmt.Fprintln(w, ".PHONY: checkapi")
+					fmt.Fprintln(w, "checkapi:", timestamps)
+
+					fmt.Fprintln(w, ".PHONY: droidcore")
+					fmt.Fprintln(w, "droidcore: checkapi")
+				}
 			},
 		},
 	}}
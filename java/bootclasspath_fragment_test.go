@@ -278,3 +278,129 @@ func TestBootclasspathFragment_StubLibs(t *testing.T) {
 
 	android.AssertPathsRelativeToTopEquals(t, "widest dex stubs jar", expectedWidestPaths, info.TransitiveStubDexJarsByScope.StubDexJarsForWidestAPIScope())
 }
+
+func TestBootclasspathFragment_HiddenAPIFlagOverrides(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForTestWithBootclasspathFragment,
+		FixtureConfigureApexBootJars("someapex:mybootlib", "someapex:myotherbootlib"),
+	).RunTestWithBp(t, `
+		bootclasspath_fragment {
+			name: "myfragment",
+			contents: [
+				"mybootlib",
+				"myotherbootlib",
+			],
+			hidden_api: {
+				unsupported: ["unsupported.txt"],
+			},
+		}
+
+		java_library {
+			name: "mybootlib",
+			srcs: ["Test.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+			hiddenapi_flag_overrides: {
+				blocked: ["mybootlib-blocked.txt"],
+				max_target_o_low_priority: ["mybootlib-max-target-o.txt"],
+			},
+		}
+
+		java_library {
+			name: "myotherbootlib",
+			srcs: ["Test.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+		}
+	`)
+
+	fragment := result.ModuleForTests("myfragment", "android_common")
+
+	CheckHiddenAPIFlagOverrideFiles(t, result, "fragment", `
+		mybootlib-blocked.txt
+		mybootlib-max-target-o.txt
+	`, fragment.Module())
+
+	// The override files are merged with the fragment's own flag files.
+	info := result.ModuleProvider(fragment.Module(), HiddenAPIInfoProvider).(HiddenAPIInfo)
+	for _, category := range HiddenAPIFlagFileCategories {
+		if category.PropertyName == "unsupported" {
+			android.AssertPathsRelativeToTopEquals(t, "unsupported flag files", []string{"unsupported.txt"}, info.FlagFilesByCategory[category])
+		} else if category.PropertyName == "blocked" {
+			android.AssertPathsRelativeToTopEquals(t, "blocked flag files", []string{"mybootlib-blocked.txt"}, info.FlagFilesByCategory[category])
+		}
+	}
+
+	// The conflict check covers all the flag files except those whose conflicts are ignored.
+	rule := fragment.Rule("modularHiddenApiAllFlagsFlagOverrides")
+	CheckHiddenAPIRuleInputs(t, "flag override conflicts", `
+		mybootlib-blocked.txt
+		unsupported.txt
+	`, rule)
+
+	allFlags := fragment.Rule("modularHiddenApiAllFlags")
+	android.AssertPathsRelativeToTopEquals(t, "all flags validations",
+		[]string{"out/soong/.intermediates/myfragment/android_common/modular-hiddenapi/all-flags.flag-overrides.valid"},
+		allFlags.Validations)
+}
+
+func TestBootclasspathFragment_FinalizedExtensionApiCheck(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForTestWithBootclasspathFragment,
+		PrepareForTestWithJavaSdkLibraryFiles,
+		FixtureWithPrebuiltApisAndCurrentExtension(map[string][]string{
+			"30": {"mysdklibrary", "myothersdklibrary"},
+		}, map[string][]string{
+			"1": {"mysdklibrary"},
+			"2": {"mysdklibrary"},
+		}, 2),
+		FixtureConfigureApexBootJars("someapex:mysdklibrary", "someapex:myothersdklibrary"),
+	).RunTestWithBp(t, `
+		bootclasspath_fragment {
+			name: "myfragment",
+			contents: [
+				"mysdklibrary",
+				"myothersdklibrary",
+			],
+		}
+
+		java_sdk_library {
+			name: "mysdklibrary",
+			srcs: ["a.java"],
+			shared_library: false,
+			public: {enabled: true},
+			system: {enabled: true},
+		}
+
+		java_sdk_library {
+			name: "myothersdklibrary",
+			srcs: ["a.java"],
+			shared_library: false,
+			public: {enabled: true},
+		}
+	`)
+
+	fragment := result.ModuleForTests("myfragment", "android_common")
+
+	// The API files are checked against the ones finalized in the current extension version.
+	check := fragment.Output("check_finalized_extension_api/mysdklibrary.public.timestamp")
+	android.AssertPathsRelativeToTopEquals(t, "public api check inputs", []string{
+		"out/soong/.intermediates/mysdklibrary.stubs.source/android_common/metalava/mysdklibrary.stubs.source_api.txt",
+		"out/soong/.intermediates/prebuilts/sdk/mysdklibrary.api.public.extension_2/gen/mysdklibrary.api.public.extension_2",
+	}, check.Implicits)
+
+	check = fragment.Output("check_finalized_extension_api/mysdklibrary.system-removed.timestamp")
+	android.AssertPathsRelativeToTopEquals(t, "system removed api check inputs", []string{
+		"out/soong/.intermediates/mysdklibrary.stubs.source.system/android_common/metalava/mysdklibrary.stubs.source.system_removed.txt",
+		"out/soong/.intermediates/prebuilts/sdk/mysdklibrary-removed.api.system.extension_2/gen/mysdklibrary-removed.api.system.extension_2",
+	}, check.Implicits)
+
+	// Scopes that are not built from source and modules without finalized extension APIs are not
+	// checked.
+	android.AssertBoolEquals(t, "module-lib api checked", false,
+		fragment.MaybeOutput("check_finalized_extension_api/mysdklibrary.module-lib.timestamp").Rule != nil)
+	android.AssertBoolEquals(t, "myothersdklibrary api checked", false,
+		fragment.MaybeOutput("check_finalized_extension_api/myothersdklibrary.public.timestamp").Rule != nil)
+}
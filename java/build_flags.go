@@ -0,0 +1,228 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func init() {
+	registerBuildFlagsBuildComponents(android.InitRegistrationContext)
+}
+
+func registerBuildFlagsBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("java_build_flags", BuildFlagsFactory)
+}
+
+var PrepareForTestWithBuildFlags = android.FixtureRegisterWithContext(registerBuildFlagsBuildComponents)
+
+// BuildFlagsInfo contains the flags declared by a java_build_flags module and their values for the
+// product being built.
+type BuildFlagsInfo struct {
+	// Package is the Java package of the generated class.
+	Package string
+
+	// ClassName is the name of the generated class.
+	ClassName string
+
+	// Values maps the names of the flags to their values.
+	Values map[string]string
+}
+
+var BuildFlagsInfoProvider = blueprint.NewProvider(BuildFlagsInfo{})
+
+type buildFlagsProperties struct {
+	// Java package of the generated class.
+	Package *string
+
+	// Name of the generated class, defaults to Flags.
+	Class_name *string
+
+	// The declared flags in the form <type>:<name>=<default value>, where <type> is one of
+	// boolean, int or string and <name> is in lower_snake_case. The value of a flag is read from
+	// the BuildFlags product variable using the <package>.<name> key, and falls back to the
+	// default value if it is not set. Each flag is a public static final field of the generated
+	// class, named after the flag in UPPER_SNAKE_CASE.
+	Flags []string
+}
+
+// buildFlag is a flag declared by a java_build_flags module.
+type buildFlag struct {
+	flagType string
+	name     string
+	value    string
+}
+
+type buildFlags struct {
+	android.ModuleBase
+
+	properties buildFlagsProperties
+
+	outputFile android.WritablePath
+}
+
+var _ android.OutputFileProducer = (*buildFlags)(nil)
+
+var (
+	buildFlagTypes = []string{"boolean", "int", "string"}
+
+	buildFlagNameRegexp   = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	javaPackageNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+	javaIdentifierRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	javaStringEscaper     = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+)
+
+// java_build_flags generates a Java class with a constant for each of the declared flags, set to
+// the value of the flag for the product being built. The class can be compiled into a Java module
+// by adding the module to its srcs.
+func BuildFlagsFactory() android.Module {
+	module := &buildFlags{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidModule(module)
+	return module
+}
+
+func (b *buildFlags) className() string {
+	return proptools.StringDefault(b.properties.Class_name, "Flags")
+}
+
+// checkBuildFlagValue returns an error if the value is not valid for the type of the flag.
+func checkBuildFlagValue(flagType, value string) error {
+	switch flagType {
+	case "boolean":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("must be true or false")
+		}
+	case "int":
+		if _, err := strconv.ParseInt(value, 10, 32); err != nil {
+			return fmt.Errorf("must be a 32-bit integer")
+		}
+	}
+	return nil
+}
+
+// parseBuildFlags parses the declared flags and resolves their values from the product variables.
+func (b *buildFlags) parseBuildFlags(ctx android.ModuleContext, pkg string) []buildFlag {
+	var flags []buildFlag
+	seen := make(map[string]bool)
+	for _, declaration := range b.properties.Flags {
+		colon := strings.Index(declaration, ":")
+		equals := strings.Index(declaration, "=")
+		if colon < 0 || equals < colon {
+			ctx.PropertyErrorf("flags", "%q must be in the form <type>:<name>=<default value>", declaration)
+			continue
+		}
+		flag := buildFlag{
+			flagType: declaration[:colon],
+			name:     declaration[colon+1 : equals],
+			value:    declaration[equals+1:],
+		}
+		if !android.InList(flag.flagType, buildFlagTypes) {
+			ctx.PropertyErrorf("flags", "%q has unsupported type %q, must be one of %s",
+				declaration, flag.flagType, strings.Join(buildFlagTypes, ", "))
+			continue
+		}
+		if !buildFlagNameRegexp.MatchString(flag.name) {
+			ctx.PropertyErrorf("flags", "%q has invalid name %q, must be in lower_snake_case", declaration, flag.name)
+			continue
+		}
+		if seen[flag.name] {
+			ctx.PropertyErrorf("flags", "flag %q is declared more than once", flag.name)
+			continue
+		}
+		seen[flag.name] = true
+		if err := checkBuildFlagValue(flag.flagType, flag.value); err != nil {
+			ctx.PropertyErrorf("flags", "%q has invalid default value: %s", declaration, err)
+			continue
+		}
+
+		qualifiedName := pkg + "." + flag.name
+		if value, ok := ctx.Config().BuildFlag(qualifiedName); ok {
+			if err := checkBuildFlagValue(flag.flagType, value); err != nil {
+				ctx.ModuleErrorf("invalid value %q for build flag %q in the product configuration: %s",
+					value, qualifiedName, err)
+				continue
+			}
+			flag.value = value
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+func (b *buildFlags) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	pkg := proptools.String(b.properties.Package)
+	if pkg == "" {
+		ctx.PropertyErrorf("package", "must be set")
+		return
+	}
+	if !javaPackageNameRegexp.MatchString(pkg) {
+		ctx.PropertyErrorf("package", "%q is not a valid Java package name", pkg)
+		return
+	}
+	className := b.className()
+	if !javaIdentifierRegexp.MatchString(className) {
+		ctx.PropertyErrorf("class_name", "%q is not a valid Java class name", className)
+		return
+	}
+
+	flags := b.parseBuildFlags(ctx, pkg)
+	if ctx.Failed() {
+		return
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "// Generated by the %s java_build_flags module, do not edit.\n", ctx.ModuleName())
+	fmt.Fprintf(&content, "package %s;\n\n", pkg)
+	fmt.Fprintf(&content, "public final class %s {\n", className)
+	fmt.Fprintf(&content, "    private %s() {}\n", className)
+	values := make(map[string]string)
+	for _, flag := range flags {
+		javaType, value := flag.flagType, flag.value
+		if flag.flagType == "string" {
+			javaType = "String"
+			value = `"` + javaStringEscaper.Replace(value) + `"`
+		}
+		fmt.Fprintf(&content, "\n    public static final %s %s = %s;\n", javaType, strings.ToUpper(flag.name), value)
+		values[flag.name] = flag.value
+	}
+	content.WriteString("}\n")
+
+	b.outputFile = android.PathForModuleGen(ctx, strings.ReplaceAll(pkg, ".", "/"), className+".java")
+	android.WriteFileRule(ctx, b.outputFile, content.String())
+
+	ctx.SetProvider(BuildFlagsInfoProvider, BuildFlagsInfo{
+		Package:   pkg,
+		ClassName: className,
+		Values:    values,
+	})
+}
+
+func (b *buildFlags) OutputFiles(tag string) (android.Paths, error) {
+	switch tag {
+	case "":
+		return android.Paths{b.outputFile}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
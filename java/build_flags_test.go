@@ -0,0 +1,174 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestBuildFlags(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.BuildFlags = map[string]string{
+				"com.android.foo.enable_bar": "true",
+				"com.android.foo.server":     `"prod"\server`,
+				"com.android.other.max_size": "100",
+			}
+		}),
+	).RunTestWithBp(t, `
+		java_build_flags {
+			name: "foo_flags",
+			package: "com.android.foo",
+			class_name: "FooFlags",
+			flags: [
+				"boolean:enable_bar=false",
+				"boolean:enable_baz=false",
+				"int:max_size=10",
+				"string:server=test",
+			],
+		}
+
+		java_library {
+			name: "foo",
+			srcs: ["a.java", ":foo_flags"],
+			sdk_version: "current",
+		}
+	`)
+
+	CheckBuildFlagValues(t, result, "foo_flags", map[string]string{
+		"enable_bar": "true",
+		"enable_baz": "false",
+		"max_size":   "10",
+		"server":     `"prod"\server`,
+	})
+
+	flags := result.ModuleForTests("foo_flags", "")
+	output := flags.Output("out/soong/.intermediates/foo_flags/gen/com/android/foo/FooFlags.java")
+	android.AssertStringEquals(t, "generated class", `// Generated by the foo_flags java_build_flags module, do not edit.
+package com.android.foo;
+
+public final class FooFlags {
+    private FooFlags() {}
+
+    public static final boolean ENABLE_BAR = true;
+
+    public static final boolean ENABLE_BAZ = false;
+
+    public static final int MAX_SIZE = 10;
+
+    public static final String SERVER = "\"prod\"\\server";
+}
+`, android.ContentFromFileRuleForTests(t, output))
+
+	javac := result.ModuleForTests("foo", "android_common").Rule("javac")
+	android.AssertPathsRelativeToTopEquals(t, "javac inputs",
+		[]string{"a.java", "out/soong/.intermediates/foo_flags/gen/com/android/foo/FooFlags.java"}, javac.Inputs)
+}
+
+func TestBuildFlagsErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		bp          string
+		buildFlags  map[string]string
+		expectedErr string
+	}{
+		{
+			name: "missing package",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					flags: ["boolean:enable_bar=false"],
+				}`,
+			expectedErr: `package: must be set`,
+		},
+		{
+			name: "invalid declaration",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["enable_bar"],
+				}`,
+			expectedErr: `"enable_bar" must be in the form <type>:<name>=<default value>`,
+		},
+		{
+			name: "unsupported type",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["float:ratio=0.5"],
+				}`,
+			expectedErr: `"float:ratio=0.5" has unsupported type "float"`,
+		},
+		{
+			name: "invalid name",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["boolean:EnableBar=false"],
+				}`,
+			expectedErr: `has invalid name "EnableBar", must be in lower_snake_case`,
+		},
+		{
+			name: "duplicate flag",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["boolean:enable_bar=false", "int:enable_bar=1"],
+				}`,
+			expectedErr: `flag "enable_bar" is declared more than once`,
+		},
+		{
+			name: "invalid default value",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["int:max_size=big"],
+				}`,
+			expectedErr: `"int:max_size=big" has invalid default value: must be a 32-bit integer`,
+		},
+		{
+			name: "invalid product value",
+			bp: `
+				java_build_flags {
+					name: "foo_flags",
+					package: "com.android.foo",
+					flags: ["boolean:enable_bar=false"],
+				}`,
+			buildFlags:  map[string]string{"com.android.foo.enable_bar": "yes"},
+			expectedErr: `invalid value "yes" for build flag "com.android.foo.enable_bar" in the product configuration: must be true or false`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			android.GroupFixturePreparers(
+				prepareForJavaTest,
+				android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+					variables.BuildFlags = test.buildFlags
+				}),
+			).
+				ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(test.expectedErr)).
+				RunTestWithBp(t, test.bp)
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
+	"android/soong/java/config"
 	"android/soong/remoteexec"
 )
 
@@ -45,7 +46,7 @@ var (
 			Command: `rm -rf "$outDir" "$annoDir" "$srcJarDir" "$out" && mkdir -p "$outDir" "$annoDir" "$srcJarDir" && ` +
 				`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
 				`(if [ -s $srcJarDir/list ] || [ -s $out.rsp ] ; then ` +
-				`${config.SoongJavacWrapper} $javaTemplate${config.JavacCmd} ` +
+				`${config.SoongJavacWrapper} $javaTemplate${config.JavacWorkerClient}${config.JavacCmd} ` +
 				`${config.JavacHeapFlags} ${config.JavacVmFlags} ${config.CommonJdkFlags} ` +
 				`$processorpath $processor $javacFlags $bootClasspath $classpath ` +
 				`-source $javaVersion -target $javaVersion ` +
@@ -57,7 +58,7 @@ var (
 				"${config.SoongZipCmd}",
 				"${config.ZipSyncCmd}",
 			},
-			CommandOrderOnly: []string{"${config.SoongJavacWrapper}"},
+			CommandOrderOnly: []string{"${config.SoongJavacWrapper}", "${config.SoongWorkerClientCmd}"},
 			Rspfile:          "$out.rsp",
 			RspfileContent:   "$in",
 		}, map[string]*remoteexec.REParams{
@@ -76,6 +77,40 @@ var (
 		}, []string{"javacFlags", "bootClasspath", "classpath", "processorpath", "processor", "srcJars", "srcJarDir",
 			"outDir", "annoDir", "javaVersion"}, nil)
 
+	// javacAnnotationProcessor runs a single isolated annotation processor over the java sources of a
+	// module with javac -proc:only and zips the generated sources into $out.  If the annotation
+	// processor declares that it generates resources they are zipped into $resJar, otherwise the
+	// rule fails if any were generated as they would not be tracked.
+	javacAnnotationProcessor = pctx.AndroidStaticRule("javacAnnotationProcessor",
+		blueprint.RuleParams{
+			Command: `rm -rf "$genDir" "$srcJarDir" "$out" && ` +
+				`mkdir -p "$genDir/sources" "$genDir/resources" "$srcJarDir" && ` +
+				`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
+				`(if [ -s $srcJarDir/list ] || [ -s $out.rsp ] ; then ` +
+				`${config.SoongJavacWrapper} ${config.JavacCmd} ` +
+				`${config.JavacHeapFlags} ${config.JavacVmFlags} ${config.CommonJdkFlags} ` +
+				`-proc:only $processorpath -processor $processor $javacFlags $bootClasspath $classpath ` +
+				`-source $javaVersion -target $javaVersion ` +
+				`-d $genDir/resources -s $genDir/sources @$out.rsp @$srcJarDir/list ; fi ) && ` +
+				`${config.SoongZipCmd} -o $out -C $genDir/sources -D $genDir/sources && ` +
+				`(if [ -n "$resJar" ] ; then ` +
+				`${config.SoongZipCmd} -jar -o $resJar -C $genDir/resources -D $genDir/resources ; ` +
+				`elif [ -n "$$(find $genDir/resources -type f)" ] ; then ` +
+				`echo "annotation processor $processor generated resources, set generates_resources: true in its java_plugin" >&2 ; ` +
+				`exit 1 ; fi ) && ` +
+				`rm -rf "$srcJarDir"`,
+			CommandDeps: []string{
+				"${config.JavacCmd}",
+				"${config.SoongZipCmd}",
+				"${config.ZipSyncCmd}",
+			},
+			CommandOrderOnly: []string{"${config.SoongJavacWrapper}"},
+			Rspfile:          "$out.rsp",
+			RspfileContent:   "$in",
+		},
+		"javacFlags", "bootClasspath", "classpath", "processorpath", "processor", "srcJars", "srcJarDir",
+		"genDir", "resJar", "javaVersion")
+
 	_ = pctx.VariableFunc("kytheCorpus",
 		func(ctx android.PackageVarContext) string { return ctx.Config().XrefCorpusName() })
 	_ = pctx.VariableFunc("kytheCuEncoding",
@@ -153,6 +188,16 @@ var (
 			Platform:        map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
 		}, []string{"javacFlags", "bootClasspath", "classpath", "srcJars", "javaVersion"}, []string{"implicits"})
 
+	// abiDigest only updates its output when the ABI of the input jar changes, so that the actions
+	// that depend on the digest instead of on the jar are not rerun for other changes.
+	abiDigest = pctx.AndroidStaticRule("abiDigest",
+		blueprint.RuleParams{
+			Command: `${config.AbiDigestCmd} -i $in -o $out.tmp && ` +
+				`(if cmp -s $out.tmp $out ; then rm $out.tmp ; else mv $out.tmp $out ; fi )`,
+			CommandDeps: []string{"${config.AbiDigestCmd}"},
+			Restat:      true,
+		})
+
 	jar, jarRE = pctx.RemoteStaticRules("jar",
 		blueprint.RuleParams{
 			Command:        `$reTemplate${config.SoongZipCmd} -jar -o $out @$out.rsp`,
@@ -225,6 +270,18 @@ var (
 		},
 	)
 
+	multiReleaseClasses = pctx.AndroidStaticRule("multiReleaseClasses",
+		blueprint.RuleParams{
+			Command:     `${config.Zip2ZipCmd} -i $in -o $out '**/*.class:META-INF/versions/$release/'`,
+			CommandDeps: []string{"${config.Zip2ZipCmd}"},
+		},
+		"release")
+
+	multiReleaseManifest = pctx.AndroidStaticRule("multiReleaseManifest",
+		blueprint.RuleParams{
+			Command: `{ cat $in; echo; echo 'Multi-Release: true'; } | sed '/^$$/d' > $out`,
+		})
+
 	zipalign = pctx.AndroidStaticRule("zipalign",
 		blueprint.RuleParams{
 			Command: "if ! ${config.ZipAlign} -c -p 4 $in > /dev/null; then " +
@@ -279,6 +336,9 @@ type javaBuilderFlags struct {
 	kotlincDeps      android.Paths
 
 	proto android.ProtoFlags
+
+	// abiDigests maps the path of a header jar on the classpath to the path of its ABI digest.
+	abiDigests map[string]android.Path
 }
 
 func TransformJavaToClasses(ctx android.ModuleContext, outputFile android.WritablePath, shardIdx int,
@@ -394,16 +454,52 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 		rule = turbineRE
 		args["implicits"] = strings.Join(deps.Strings(), ",")
 	}
+	implicits, orderOnly := splitAbiDigestDeps(flags, deps)
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
 		Description: "turbine",
 		Output:      outputFile,
 		Inputs:      srcFiles,
-		Implicits:   deps,
+		Implicits:   implicits,
+		OrderOnly:   orderOnly,
 		Args:        args,
 	})
 }
 
+// useAbiDigests returns true if the turbine and javac actions should depend on the ABI digests of
+// the header jars on their classpath instead of on the header jars themselves. The turbine rule
+// already leaves a header jar untouched when only method bodies change; the digests are also
+// unchanged by changes to the private members and the debug information of a header jar, so such a
+// change does not rerun the actions of the modules that depend on it.
+func useAbiDigests(config android.Config) bool {
+	return config.IsEnvTrue("SOONG_JAVA_ABI_DIGESTS")
+}
+
+// TransformHeaderJarToAbiDigest generates a digest of the ABI of the classes in a header jar.
+func TransformHeaderJarToAbiDigest(ctx android.ModuleContext, outputFile android.WritablePath, headerJar android.Path) {
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        abiDigest,
+		Description: "abi digest",
+		Output:      outputFile,
+		Input:       headerJar,
+	})
+}
+
+// splitAbiDigestDeps replaces the header jars in deps that have an ABI digest with their digest. The
+// header jars are returned separately so that they can be order-only dependencies, which ensures
+// they are built before the action that reads them without rerunning it every time they change.
+func splitAbiDigestDeps(flags javaBuilderFlags, deps android.Paths) (implicits, orderOnly android.Paths) {
+	for _, dep := range deps {
+		if digest, ok := flags.abiDigests[dep.String()]; ok {
+			implicits = append(implicits, digest)
+			orderOnly = append(orderOnly, dep)
+		} else {
+			implicits = append(implicits, dep)
+		}
+	}
+	return implicits, orderOnly
+}
+
 // transformJavaToClasses takes source files and converts them to a jar containing .class files.
 // srcFiles is a list of paths to sources, srcJars is a list of paths to jar files that contain
 // sources.  flags contains various command line flags to be passed to the compiler.
@@ -460,12 +556,15 @@ func transformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 	if ctx.Config().UseRBE() && ctx.Config().IsEnvTrue("RBE_JAVAC") {
 		rule = javacRE
 	}
+	implicits, orderOnly := splitAbiDigestDeps(flags, deps)
+	implicits = append(implicits, config.PersistentWorkerJar(ctx, "javac")...)
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
 		Description: desc,
 		Output:      outputFile,
 		Inputs:      srcFiles,
-		Implicits:   deps,
+		Implicits:   implicits,
+		OrderOnly:   orderOnly,
 		Args: map[string]string{
 			"javacFlags":    flags.javacFlags,
 			"bootClasspath": bootClasspath,
@@ -481,6 +580,70 @@ func transformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 	})
 }
 
+// transformJavaToAnnotationProcessorOutputs runs an isolated annotation processor over the java
+// sources and srcjars of a module, producing a srcjar of the generated sources in outputSrcJar and,
+// if the annotation processor generates resources, a jar of the generated resources in
+// outputResJar.
+func transformJavaToAnnotationProcessorOutputs(ctx android.ModuleContext, outputSrcJar, outputResJar android.WritablePath,
+	srcFiles, srcJars android.Paths, flags javaBuilderFlags, plugin isolatedPlugin) {
+
+	processorPath := classpath(plugin.jars)
+
+	var deps android.Paths
+	deps = append(deps, srcJars...)
+
+	classpath := flags.classpath
+
+	var bootClasspath string
+	if flags.javaVersion.usesJavaModules() {
+		var systemModuleDeps android.Paths
+		bootClasspath, systemModuleDeps = flags.systemModules.FormJavaSystemModulesPath(ctx.Device())
+		deps = append(deps, systemModuleDeps...)
+		classpath = append(flags.java9Classpath, classpath...)
+	} else {
+		deps = append(deps, flags.bootClasspath...)
+		if len(flags.bootClasspath) == 0 && ctx.Device() {
+			// explicitly specify -bootclasspath "" if the bootclasspath is empty to
+			// ensure java does not fall back to the default bootclasspath.
+			bootClasspath = `-bootclasspath ""`
+		} else {
+			bootClasspath = flags.bootClasspath.FormJavaClassPath("-bootclasspath")
+		}
+	}
+
+	deps = append(deps, classpath...)
+	deps = append(deps, processorPath...)
+
+	var implicitOutputs android.WritablePaths
+	resJar := ""
+	if outputResJar != nil {
+		implicitOutputs = append(implicitOutputs, outputResJar)
+		resJar = outputResJar.String()
+	}
+
+	genDir := android.PathForModuleOut(ctx, "annotation_processors", plugin.name)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:            javacAnnotationProcessor,
+		Description:     "annotation processor " + plugin.name,
+		Output:          outputSrcJar,
+		ImplicitOutputs: implicitOutputs,
+		Inputs:          srcFiles,
+		Implicits:       deps,
+		Args: map[string]string{
+			"javacFlags":    flags.javacFlags,
+			"bootClasspath": bootClasspath,
+			"classpath":     classpath.FormJavaClassPath("-classpath"),
+			"processorpath": processorPath.FormJavaClassPath("-processorpath"),
+			"processor":     plugin.processorClass,
+			"srcJars":       strings.Join(srcJars.Strings(), " "),
+			"srcJarDir":     genDir.Join(ctx, "srcjars").String(),
+			"genDir":        genDir.Join(ctx, "gen").String(),
+			"resJar":        resJar,
+			"javaVersion":   flags.javaVersion.String(),
+		},
+	})
+}
+
 func TransformResourcesToJar(ctx android.ModuleContext, outputFile android.WritablePath,
 	jarArgs []string, deps android.Paths) {
 
@@ -576,6 +739,43 @@ func TransformJetifier(ctx android.ModuleContext, outputFile android.WritablePat
 	})
 }
 
+// TransformJavaToMultiReleaseClasses compiles the sources of a release of a multi-release jar,
+// whose version is set in flags.javaVersion, and moves the resulting classes under
+// META-INF/versions/<release> in the output jar.
+func TransformJavaToMultiReleaseClasses(ctx android.ModuleContext, outputFile android.WritablePath,
+	srcFiles android.Paths, flags javaBuilderFlags) {
+
+	release := flags.javaVersion.String()
+	intermediatesDir := filepath.Join("javac-multi-release", release)
+	classes := android.PathForModuleOut(ctx, intermediatesDir, "classes.jar")
+	transformJavaToClasses(ctx, classes, -1, srcFiles, nil, flags, nil, intermediatesDir, "javac "+release)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        multiReleaseClasses,
+		Description: "multi-release " + release,
+		Input:       classes,
+		Output:      outputFile,
+		Args: map[string]string{
+			"release": release,
+		},
+	})
+}
+
+// GenerateMultiReleaseManifest writes a manifest that marks a jar as a multi-release jar and
+// contains the attributes of the given manifest, if any.
+func GenerateMultiReleaseManifest(ctx android.ModuleContext, outputFile android.WritablePath, manifest android.OptionalPath) {
+	if !manifest.Valid() {
+		android.WriteFileRule(ctx, outputFile, "Multi-Release: true\n")
+		return
+	}
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        multiReleaseManifest,
+		Description: "multi-release manifest",
+		Input:       manifest.Path(),
+		Output:      outputFile,
+	})
+}
+
 func GenerateMainClassManifest(ctx android.ModuleContext, outputFile android.WritablePath, mainClass string) {
 	android.WriteFileRule(ctx, outputFile, "Main-Class: "+mainClass+"\n")
 }
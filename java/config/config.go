@@ -15,6 +15,7 @@
 package config
 
 import (
+	"fmt"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -131,6 +132,7 @@ func init() {
 		"${JavaToolchain}/javac", "ALTERNATE_JAVAC")
 	pctx.SourcePathVariable("JavaCmd", "${JavaToolchain}/java")
 	pctx.SourcePathVariable("JarCmd", "${JavaToolchain}/jar")
+	pctx.SourcePathVariable("JavapCmd", "${JavaToolchain}/javap")
 	pctx.SourcePathVariable("JavadocCmd", "${JavaToolchain}/javadoc")
 	pctx.SourcePathVariable("JlinkCmd", "${JavaToolchain}/jlink")
 	pctx.SourcePathVariable("JmodCmd", "${JavaToolchain}/jmod")
@@ -142,16 +144,23 @@ func init() {
 
 	pctx.SourcePathVariable("JarArgsCmd", "build/soong/scripts/jar-args.sh")
 	pctx.SourcePathVariable("PackageCheckCmd", "build/soong/scripts/package-check.sh")
+	pctx.SourcePathVariable("CheckKaptStubsCmd", "build/soong/scripts/check-kapt-stubs.sh")
+	pctx.SourcePathVariable("DexClassListCmd", "build/soong/scripts/dex-class-list.sh")
 	pctx.HostBinToolVariable("ExtractJarPackagesCmd", "extract_jar_packages")
+	pctx.HostBinToolVariable("AbiDigestCmd", "abi_digest")
+	pctx.HostBinToolVariable("CheckDeniedApisCmd", "check_denied_apis")
 	pctx.HostBinToolVariable("SoongZipCmd", "soong_zip")
 	pctx.HostBinToolVariable("MergeZipsCmd", "merge_zips")
 	pctx.HostBinToolVariable("Zip2ZipCmd", "zip2zip")
 	pctx.HostBinToolVariable("ZipSyncCmd", "zipsync")
 	pctx.HostBinToolVariable("ApiCheckCmd", "apicheck")
 	pctx.HostBinToolVariable("D8Cmd", "d8")
+	pctx.HostBinToolVariable("DexdumpCmd", "dexdump")
 	pctx.HostBinToolVariable("R8Cmd", "r8-compat-proguard")
+	pctx.HostBinToolVariable("ResourceShrinkerCmd", "resourceshrinker")
 	pctx.HostBinToolVariable("HiddenAPICmd", "hiddenapi")
 	pctx.HostBinToolVariable("ExtractApksCmd", "extract_apks")
+	pctx.HostBinToolVariable("ApksignerCmd", "apksigner")
 	pctx.VariableFunc("TurbineJar", func(ctx android.PackageVarContext) string {
 		turbine := "turbine.jar"
 		if ctx.Config().AlwaysUsePrebuiltSdks() {
@@ -171,6 +180,25 @@ func init() {
 	pctx.HostJavaToolVariable("D8Jar", "d8.jar")
 
 	pctx.HostBinToolVariable("SoongJavacWrapper", "soong_javac_wrapper")
+
+	// When SOONG_USE_PERSISTENT_WORKERS is set the javac, kotlinc and r8 command lines are prefixed
+	// with soong_worker_client, which runs them in the persistent workers started by soong_ui
+	// instead of starting a new JVM for every action, unless they run remotely. The worker jars are
+	// built by the modules in java/workers, and are implicit dependencies of the actions, see
+	// PersistentWorkerJar.
+	pctx.HostBinToolVariable("SoongWorkerClientCmd", "soong_worker_client")
+	pctx.HostJavaToolVariable("JavacWorkerJar", "javac-worker.jar")
+	pctx.HostJavaToolVariable("KotlincWorkerJar", "kotlinc-worker.jar")
+	pctx.HostJavaToolVariable("R8WorkerJar", "r8-worker.jar")
+	pctx.VariableFunc("JavacWorkerClient", func(ctx android.PackageVarContext) string {
+		return persistentWorkerClient(ctx, "javac", "Javac", "${JavacHeapSize}", "${JavacWorkerJar}")
+	})
+	pctx.VariableFunc("KotlincWorkerClient", func(ctx android.PackageVarContext) string {
+		return persistentWorkerClient(ctx, "kotlinc", "Kotlinc", "${JavacHeapSize}", "${KotlincWorkerJar} ${KotlinCompilerJar}")
+	})
+	pctx.VariableFunc("R8WorkerClient", func(ctx android.PackageVarContext) string {
+		return persistentWorkerClient(ctx, "r8", "R8", "6G", "${R8WorkerJar} ${R8Jar}")
+	})
 	pctx.HostBinToolVariable("DexpreoptGen", "dexpreopt_gen")
 
 	pctx.StaticVariableWithEnvOverride("REJavaPool", "RBE_JAVA_POOL", "java16")
@@ -188,6 +216,7 @@ func init() {
 	pctx.HostBinToolVariable("ManifestFixerCmd", "manifest_fixer")
 
 	pctx.HostBinToolVariable("ManifestMergerCmd", "manifest-merger")
+	pctx.HostBinToolVariable("ManifestMergeReportCmd", "manifest_merge_report")
 
 	pctx.HostBinToolVariable("Class2NonSdkList", "class2nonsdklist")
 	pctx.HostBinToolVariable("HiddenAPI", "hiddenapi")
@@ -200,6 +229,31 @@ func init() {
 	// TODO(ccross): this should come from the signapk dependencies, but we don't have any way
 	// to express host JNI dependencies yet.
 	hostJNIToolVariableWithSdkToolsPrebuilt("SignapkJniLibrary", "libconscrypt_openjdk_jni")
+
+	android.RegisterToolVersionsProvider(javaToolVersions)
+}
+
+// javaToolVersions returns the java tools used by the build for tool_versions.json.
+func javaToolVersions(ctx android.PathContext) []android.ToolVersion {
+	aapt2 := ctx.Config().HostToolPath(ctx, "aapt2")
+	if ctx.Config().AlwaysUsePrebuiltSdks() {
+		aapt2 = android.PathForSource(ctx, "prebuilts/sdk/tools", runtime.GOOS, "bin", "aapt2")
+	}
+	tools := []android.ToolVersion{
+		{Name: "aapt2", Tool: aapt2, VersionArgs: []string{"version"}},
+		{Name: "d8", Tool: ctx.Config().HostToolPath(ctx, "d8"), VersionArgs: []string{"--version"}},
+		{Name: "metalava", Tool: ctx.Config().HostToolPath(ctx, "metalava"), VersionArgs: []string{"--version"}},
+		{Name: "r8", Tool: ctx.Config().HostToolPath(ctx, "r8-compat-proguard"), VersionArgs: []string{"--version"}},
+	}
+	// ANDROID_JAVA_HOME is set up by soong_ui, see the JavaHome variable.
+	if javaHome := ctx.Config().Getenv("ANDROID_JAVA_HOME"); javaHome != "" {
+		tools = append(tools, android.ToolVersion{
+			Name:        "javac",
+			Tool:        android.PathForSource(ctx, javaHome, "bin", "javac"),
+			VersionArgs: []string{"-version"},
+		})
+	}
+	return tools
 }
 
 func BazelJavaToolchainVars(config android.Config) string {
@@ -255,6 +309,11 @@ func JavaCmd(ctx android.PathContext) android.SourcePath {
 	return javaTool(ctx, "java")
 }
 
+// JavapCmd returns a SourcePath object with the path to the javap command.
+func JavapCmd(ctx android.PathContext) android.SourcePath {
+	return javaTool(ctx, "javap")
+}
+
 // JavadocCmd returns a SourcePath object with the path to the java command.
 func JavadocCmd(ctx android.PathContext) android.SourcePath {
 	return javaTool(ctx, "javadoc")
@@ -287,3 +346,43 @@ func javaHome(ctx android.PathContext) android.SourcePath {
 		return android.PathForSource(ctx, ctx.Config().Getenv("ANDROID_JAVA_HOME"))
 	})
 }
+
+// persistentWorkerClient returns the soong_worker_client prefix of the command lines of the tool,
+// or an empty string if it doesn't run in a persistent worker. workerJar is the jar of the worker,
+// followed by its arguments if any.
+func persistentWorkerClient(ctx android.PackageVarContext, tool, mnemonic, heapSize, workerJar string) string {
+	if !usePersistentWorker(ctx.Config(), tool) {
+		return ""
+	}
+	return fmt.Sprintf(`${SoongWorkerClientCmd} -mnemonic %s -worker "${JavaCmd} ${JavaVmFlags} -Xmx%s -jar %s" -- `,
+		mnemonic, heapSize, workerJar)
+}
+
+// usePersistentWorker returns true if the actions of the tool, i.e. "javac", "kotlinc" or "r8", run
+// in a persistent worker. They don't when they run remotely with RBE.
+func usePersistentWorker(config android.Config, tool string) bool {
+	if !config.IsEnvTrue("SOONG_USE_PERSISTENT_WORKERS") {
+		return false
+	}
+	switch tool {
+	case "javac":
+		return !(config.UseRBE() && config.IsEnvTrue("RBE_JAVAC"))
+	case "r8":
+		return !(config.UseRBE() && config.IsEnvTrue("RBE_R8"))
+	default:
+		// kotlinc has no remote execution of its own, but it is compiled together with javac by
+		// the same modules, so it follows the RBE setup of the build.
+		return !config.UseRBE()
+	}
+}
+
+// PersistentWorkerJar returns the jar of the persistent worker of the tool, i.e. "javac",
+// "kotlinc" or "r8", as a list to use as implicit dependencies of the actions that run the tool,
+// or nil if they don't run in a persistent worker. The jar runs the tool, so the actions rerun
+// when it changes.
+func PersistentWorkerJar(ctx android.PathContext, tool string) android.Paths {
+	if !usePersistentWorker(ctx.Config(), tool) {
+		return nil
+	}
+	return android.Paths{ctx.Config().HostJavaToolPath(ctx, tool+"-worker.jar")}
+}
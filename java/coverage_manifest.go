@@ -0,0 +1,100 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strings"
+
+	"android/soong/android"
+	"android/soong/cc"
+)
+
+// In coverage builds the coverage_manifest singleton lists the coverage metadata of every module
+// in ${OUT_DIR}/soong/coverage/<product>/coverage_manifest.tsv, one line per artifact with the
+// kind of coverage, the name of the module and the path of the artifact:
+//  - java: the jar of uninstrumented classes that jacoco needs to interpret the .ec files.
+//  - native: the zip of the unstripped binaries and the clang profile mapping or gcno files.
+// The manifest and all the artifacts it references are built by the coverage-manifest goal, which
+// gives the coverage pipeline a single entry point for both java and native code.
+
+func init() {
+	registerCoverageManifestBuildComponents(android.InitRegistrationContext)
+}
+
+func registerCoverageManifestBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("coverage_manifest", coverageManifestSingletonFactory)
+}
+
+var PrepareForTestWithCoverageManifest = android.FixtureRegisterWithContext(registerCoverageManifestBuildComponents)
+
+// javaCoverageEnabled returns true if java modules are instrumented with jacoco.
+func javaCoverageEnabled(config android.Config) bool {
+	return config.IsEnvTrue("EMMA_INSTRUMENT")
+}
+
+func coverageManifestSingletonFactory() android.Singleton {
+	return &coverageManifestSingleton{}
+}
+
+type coverageManifestSingleton struct {
+	manifest android.WritablePath
+}
+
+func (s *coverageManifestSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	javaCoverage := javaCoverageEnabled(ctx.Config())
+	nativeCoverage := ctx.DeviceConfig().NativeCoverageEnabled()
+	if !javaCoverage && !nativeCoverage {
+		return
+	}
+
+	// Modules with multiple variants may share the same artifacts, only keep one of them.
+	lines := make(map[string]bool)
+	var artifacts android.Paths
+	addArtifact := func(kind string, m android.Module, artifact android.Path) {
+		lines[strings.Join([]string{kind, ctx.ModuleName(m), artifact.String()}, "\t")] = true
+		artifacts = append(artifacts, artifact)
+	}
+
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() {
+			return
+		}
+		if javaCoverage && ctx.ModuleHasProvider(m, JavaInfoProvider) {
+			info := ctx.ModuleProvider(m, JavaInfoProvider).(JavaInfo)
+			if info.JacocoReportClassesFile != nil {
+				addArtifact("java", m, info.JacocoReportClassesFile)
+			}
+		}
+		if ccModule, ok := m.(*cc.Module); ok && nativeCoverage {
+			if coverageFile := ccModule.CoverageOutputFile(); coverageFile.Valid() {
+				addArtifact("native", m, coverageFile.Path())
+			}
+		}
+	})
+
+	s.manifest = android.PathForOutput(ctx, "coverage", ctx.Config().DeviceProduct(), "coverage_manifest.tsv")
+	android.WriteFileRule(ctx, s.manifest, strings.Join(android.SortedStringKeys(lines), "\n"))
+
+	ctx.Phony("coverage-manifest", append(android.Paths{s.manifest}, android.SortedUniquePaths(artifacts)...)...)
+}
+
+func (s *coverageManifestSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.manifest != nil {
+		ctx.DistForGoalWithFilename("coverage-manifest", s.manifest,
+			ctx.Config().DeviceProduct()+"-coverage_manifest.tsv")
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*coverageManifestSingleton)(nil)
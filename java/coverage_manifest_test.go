@@ -0,0 +1,56 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+const coverageManifestBp = `
+	android_app {
+		name: "foo",
+		srcs: ["a.java"],
+		sdk_version: "current",
+	}
+`
+
+func TestCoverageManifest(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithCoverageManifest,
+		android.FixtureMergeEnv(map[string]string{
+			"EMMA_INSTRUMENT": "true",
+		}),
+	).RunTestWithBp(t, coverageManifestBp)
+
+	manifest := result.SingletonForTests("coverage_manifest").Output("coverage/test_product/coverage_manifest.tsv")
+	android.AssertStringEquals(t, "manifest",
+		"java\tfoo\tout/soong/.intermediates/foo/android_common/jacoco-report-classes/foo.jar",
+		android.StringRelativeToTop(result.Config, android.ContentFromFileRuleForTests(t, manifest)))
+}
+
+func TestCoverageManifestDisabled(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithCoverageManifest,
+	).RunTestWithBp(t, coverageManifestBp)
+
+	manifest := result.SingletonForTests("coverage_manifest").MaybeOutput("coverage/test_product/coverage_manifest.tsv")
+	if manifest.Rule != nil {
+		t.Errorf("coverage manifest should not be generated without coverage")
+	}
+}
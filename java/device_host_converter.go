@@ -17,16 +17,28 @@ package java
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/blueprint"
 
 	"android/soong/android"
 	"android/soong/dexpreopt"
 )
 
+var deniedApiCheck = pctx.AndroidStaticRule("deniedApiCheck",
+	blueprint.RuleParams{
+		Command:     `rm -f $out && ${config.CheckDeniedApisCmd} -denied_apis $deniedApis $in && cp -f $in $out`,
+		CommandDeps: []string{"${config.CheckDeniedApisCmd}"},
+	},
+	"deniedApis")
+
 type DeviceHostConverter struct {
 	android.ModuleBase
 	android.DefaultableModuleBase
 
-	properties DeviceHostConverterProperties
+	properties              DeviceHostConverterProperties
+	deviceForHostProperties DeviceForHostProperties
 
 	headerJars                    android.Paths
 	implementationJars            android.Paths
@@ -45,6 +57,14 @@ type DeviceHostConverterProperties struct {
 	Libs []string
 }
 
+type DeviceForHostProperties struct {
+	// List of classes or packages, e.g. "android.os.SystemProperties" or "android.os.", that the
+	// classes in libs must not reference as they are not available in the host runtime. A class
+	// also denies its nested classes and a package its subpackages. The build fails if any of them
+	// is referenced.
+	Denied_apis []string
+}
+
 type DeviceForHost struct {
 	DeviceHostConverter
 }
@@ -52,11 +72,14 @@ type DeviceForHost struct {
 // java_device_for_host makes the classes.jar output of a device java_library module available to host
 // java_library modules.
 //
+// The classes can be checked against a list of APIs that are not available on the host with
+// denied_apis.
+//
 // It is rarely necessary, and its usage is restricted to a few allowed projects.
 func DeviceForHostFactory() android.Module {
 	module := &DeviceForHost{}
 
-	module.AddProperties(&module.properties)
+	module.AddProperties(&module.properties, &module.deviceForHostProperties)
 
 	InitJavaModule(module, android.HostSupported)
 	return module
@@ -111,6 +134,10 @@ func (d *DeviceHostConverter) GenerateAndroidBuildActions(ctx android.ModuleCont
 		}
 	})
 
+	if len(d.deviceForHostProperties.Denied_apis) > 0 {
+		d.checkDeniedApis(ctx)
+	}
+
 	jarName := ctx.ModuleName() + ".jar"
 
 	if len(d.implementationAndResourceJars) > 1 {
@@ -142,6 +169,45 @@ func (d *DeviceHostConverter) GenerateAndroidBuildActions(ctx android.ModuleCont
 
 }
 
+// checkDeniedApis replaces the implementation jars with copies that are only created once the jars
+// have been checked not to reference any of the denied APIs, so that any module using the classes
+// on the host depends on the check.
+func (d *DeviceHostConverter) checkDeniedApis(ctx android.ModuleContext) {
+	var deniedApis []string
+	for _, api := range d.deviceForHostProperties.Denied_apis {
+		// Class files refer to other classes by their internal names, e.g. android/os/Build.
+		deniedApis = append(deniedApis, strings.ReplaceAll(api, ".", "/"))
+	}
+	deniedApisFile := android.PathForModuleOut(ctx, "denied_apis.txt")
+	android.WriteFileRule(ctx, deniedApisFile, strings.Join(deniedApis, "\n"))
+
+	checked := make(map[string]android.Path)
+	checkJars := func(jars android.Paths) android.Paths {
+		var checkedJars android.Paths
+		for _, jar := range jars {
+			if _, ok := checked[jar.String()]; !ok {
+				checkedJar := android.PathForModuleOut(ctx, "api_checked", strconv.Itoa(len(checked)), jar.Base())
+				ctx.Build(pctx, android.BuildParams{
+					Rule:        deniedApiCheck,
+					Description: "check denied APIs",
+					Input:       jar,
+					Implicit:    deniedApisFile,
+					Output:      checkedJar,
+					Args: map[string]string{
+						"deniedApis": deniedApisFile.String(),
+					},
+				})
+				checked[jar.String()] = checkedJar
+			}
+			checkedJars = append(checkedJars, checked[jar.String()])
+		}
+		return checkedJars
+	}
+
+	d.implementationJars = checkJars(d.implementationJars)
+	d.implementationAndResourceJars = checkJars(d.implementationAndResourceJars)
+}
+
 func (d *DeviceHostConverter) HeaderJars() android.Paths {
 	return d.headerJars
 }
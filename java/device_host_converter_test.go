@@ -101,6 +101,51 @@ func TestDeviceForHost(t *testing.T) {
 	}
 }
 
+func TestDeviceForHostDeniedApis(t *testing.T) {
+	bp := `
+		java_library {
+			name: "device_module",
+			srcs: ["a.java"],
+		}
+
+		java_device_for_host {
+			name: "device_for_host_module",
+			libs: ["device_module"],
+			denied_apis: [
+				"android.os.SystemProperties",
+				"android.net.",
+			],
+		}
+
+		java_library_host {
+			name: "host_module",
+			srcs: ["b.java"],
+			static_libs: ["device_for_host_module"],
+		}
+	`
+
+	ctx, config := testJava(t, bp)
+
+	deviceJavac := ctx.ModuleForTests("device_module", "android_common").Output("javac/device_module.jar")
+
+	deviceForHostModule := ctx.ModuleForTests("device_for_host_module", config.BuildOSCommonTarget.String())
+	deniedApis := android.ContentFromFileRuleForTests(t, deviceForHostModule.Output("denied_apis.txt"))
+	if deniedApis != "android/os/SystemProperties\nandroid/net/\n" {
+		t.Errorf("unexpected denied_apis.txt contents %q", deniedApis)
+	}
+
+	check := deviceForHostModule.Rule("deniedApiCheck")
+	if check.Input.String() != deviceJavac.Output.String() {
+		t.Errorf("expected denied API check of %q, got %q", deviceJavac.Output, check.Input)
+	}
+
+	// check host module merged with the checked implementation jar
+	combined := ctx.ModuleForTests("host_module", config.BuildOSCommonTarget.String()).Output("combined/host_module.jar")
+	if !android.InList(check.Output.String(), combined.Inputs.Strings()) {
+		t.Errorf("expected host_module combined inputs to contain %q, got %q", check.Output, combined.Inputs)
+	}
+}
+
 func TestHostForDevice(t *testing.T) {
 	bp := `
 		java_library_host {
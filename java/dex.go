@@ -22,6 +22,7 @@ import (
 	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
+	"android/soong/java/config"
 	"android/soong/remoteexec"
 )
 
@@ -33,6 +34,8 @@ type DexProperties struct {
 	Dxflags []string `android:"arch_variant"`
 
 	// A list of files containing rules that specify the classes to keep in the main dex file.
+	// Only used when min_sdk_version is lower than 21, as later releases support multidex
+	// natively.  The rules are also applied to any module that statically includes this module.
 	Main_dex_rules []string `android:"path"`
 
 	Optimize struct {
@@ -50,6 +53,10 @@ type DexProperties struct {
 		// false for libraries and tests.
 		Shrink *bool
 
+		// If true, remove the resources that aren't referenced by the code left after R8 shrinks
+		// it.  Requires shrink.  Only supported by android_app modules.  Defaults to false.
+		Shrink_resources *bool
+
 		// If true, optimize bytecode.  Defaults to false.
 		Optimize *bool
 
@@ -84,12 +91,32 @@ type dexer struct {
 	extraProguardFlagFiles android.Paths
 	proguardDictionary     android.OptionalPath
 	proguardUsageZip       android.OptionalPath
+
+	// list of main dex rules files from static dependencies
+	extraMainDexRules android.Paths
+	// list of main dex rules files generated from the app manifest
+	generatedMainDexRules android.Paths
+	// list of classes in the main dex file, only generated for legacy multidex
+	mainDexList android.OptionalPath
+	// the jar of the classes that were dexed into the main dex list
+	mainDexClassesJar android.Path
+
+	// whether to check that no class is contributed by more than one of the inputs of the dex jar,
+	// and the patterns of the classes that may be duplicated
+	checkDuplicateClasses   bool
+	allowedDuplicateClasses []string
+	// the file written by the duplicate classes check if it passed
+	duplicateClassesCheck android.OptionalPath
 }
 
 func (d *dexer) effectiveOptimizeEnabled() bool {
 	return BoolDefault(d.dexProperties.Optimize.Enabled, d.dexProperties.Optimize.EnabledByDefault)
 }
 
+func (d *dexer) resourceShrinkingEnabled() bool {
+	return d.effectiveOptimizeEnabled() && Bool(d.dexProperties.Optimize.Shrink_resources)
+}
+
 var d8, d8RE = pctx.MultiCommandRemoteStaticRules("d8",
 	blueprint.RuleParams{
 		Command: `rm -rf "$outDir" && mkdir -p "$outDir" && ` +
@@ -128,7 +155,7 @@ var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 			`mkdir -p $$(dirname ${outUsage}) && ` +
 			`mkdir -p $$(dirname $tmpJar) && ` +
 			`${config.Zip2ZipCmd} -i $in -o $tmpJar -x '**/*.dex' && ` +
-			`$r8Template${config.R8Cmd} -JXmx6G ${config.DexFlags} -injars $tmpJar --output $outDir ` +
+			`$r8Template${config.R8WorkerClient}${config.R8Cmd} -JXmx6G ${config.DexFlags} -injars $tmpJar --output $outDir ` +
 			`--no-data-resources ` +
 			`-printmapping ${outDict} ` +
 			`-printusage ${outUsage} ` +
@@ -147,6 +174,7 @@ var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 			"${config.SoongZipCmd}",
 			"${config.MergeZipsCmd}",
 		},
+		CommandOrderOnly: []string{"${config.SoongWorkerClientCmd}"},
 	}, map[string]*remoteexec.REParams{
 		"$r8Template": &remoteexec.REParams{
 			Labels:          map[string]string{"type": "compile", "compiler": "r8"},
@@ -182,11 +210,6 @@ func (d *dexer) dexCommonFlags(ctx android.ModuleContext,
 	flags = android.RemoveListFromList(flags,
 		[]string{"--core-library", "--dex", "--multi-dex"})
 
-	for _, f := range android.PathsForModuleSrc(ctx, d.dexProperties.Main_dex_rules) {
-		flags = append(flags, "--main-dex-rules", f.String())
-		deps = append(deps, f)
-	}
-
 	if ctx.Config().Getenv("NO_OPTIMIZE_DX") != "" {
 		flags = append(flags, "--debug")
 	}
@@ -202,10 +225,73 @@ func (d *dexer) dexCommonFlags(ctx android.ModuleContext,
 		ctx.PropertyErrorf("min_sdk_version", "%s", err)
 	}
 
-	flags = append(flags, "--min-api "+strconv.Itoa(effectiveVersion.FinalOrFutureInt()))
+	minApi := effectiveVersion.FinalOrFutureInt()
+	flags = append(flags, "--min-api "+strconv.Itoa(minApi))
+
+	// The main dex rules of the module are always passed to d8/r8. Devices before Lollipop only load
+	// the classes in the main dex file at startup, so for them the classes needed to install the
+	// secondary dex files are also kept there with the main dex rules of the static libraries and
+	// the generated ones, and the resulting main dex list is checked.
+	mainDexRules := android.PathsForModuleSrc(ctx, d.dexProperties.Main_dex_rules)
+	if minApi < 21 {
+		mainDexRules = append(mainDexRules, d.extraMainDexRules...)
+		mainDexRules = append(mainDexRules, d.generatedMainDexRules...)
+	}
+	mainDexRules = android.FirstUniquePaths(mainDexRules)
+	for _, f := range mainDexRules {
+		flags = append(flags, "--main-dex-rules", f.String())
+	}
+	deps = append(deps, mainDexRules...)
+	if minApi < 21 && len(mainDexRules) > 0 {
+		mainDexList := android.PathForModuleOut(ctx, "main_dex_list.txt")
+		flags = append(flags, "--main-dex-list-output", mainDexList.String())
+		d.mainDexList = android.OptionalPathForPath(mainDexList)
+	}
+
 	return flags, deps
 }
 
+var mainDexListCheck = pctx.AndroidStaticRule("mainDexListCheck",
+	blueprint.RuleParams{
+		Command: `rm -f $out && ` +
+			`sed -n 's/^-keep class \([^ ]*\) .*/\1/p' $rules | tr . / | sed 's/$$/.class/' | sort -u > $out.kept && ` +
+			`zipinfo -1 $classesJar | grep '\.class$$' | sort -u | comm -12 $out.kept - > $out.expected && ` +
+			`sort -u $in | comm -23 $out.expected - > $out.missing && ` +
+			`if [ -s $out.missing ]; then ` +
+			`echo "error: $in is missing classes kept in the main dex file by $rules:" >&2; ` +
+			`cat $out.missing >&2; rm -f $out.kept $out.expected $out.missing; exit 1; fi && ` +
+			`rm -f $out.kept $out.expected $out.missing && touch $out`,
+	}, "rules", "classesJar")
+
+// checkMainDexList checks that the main dex list contains all the classes kept by the generated
+// main dex rules, which are needed before the secondary dex files are installed, and returns the
+// timestamp file of the check. The rules also keep classes that are not dexed into the app, like
+// the framework classes and the classes of its uses_libs, so only the classes in classesJar, the
+// jar that was dexed, are checked.
+func checkMainDexList(ctx android.ModuleContext, mainDexList, rules, classesJar android.Path) android.Path {
+	timestamp := android.PathForModuleOut(ctx, "main_dex_list_check.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        mainDexListCheck,
+		Description: "check main dex list",
+		Input:       mainDexList,
+		Implicits:   android.Paths{rules, classesJar},
+		Output:      timestamp,
+		Args: map[string]string{
+			"rules":      rules.String(),
+			"classesJar": classesJar.String(),
+		},
+	})
+	return timestamp
+}
+
+// mainDexListOutputs returns the main dex list generated by the dex rule, if any.
+func (d *dexer) mainDexListOutputs() android.WritablePaths {
+	if d.mainDexList.Valid() {
+		return android.WritablePaths{d.mainDexList.Path().(android.WritablePath)}
+	}
+	return nil
+}
+
 func d8Flags(flags javaBuilderFlags) (d8Flags []string, d8Deps android.Paths) {
 	d8Flags = append(d8Flags, flags.bootClasspath.FormRepeatedClassPath("--lib ")...)
 	d8Flags = append(d8Flags, flags.dexClasspath.FormRepeatedClassPath("--lib ")...)
@@ -312,6 +398,13 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 	}
 
 	commonFlags, commonDeps := d.dexCommonFlags(ctx, minSdkVersion)
+	if d.mainDexList.Valid() {
+		d.mainDexClassesJar = classesJar
+	}
+	if d.duplicateClassesCheck.Valid() {
+		// Report duplicate classes before d8 or r8 fails on them.
+		commonDeps = append(commonDeps, d.duplicateClassesCheck.Path())
+	}
 
 	// Exclude kotlinc generated files when "exclude_kotlinc_generated_files" is set to true.
 	mergeZipsFlags := ""
@@ -350,9 +443,9 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 			Rule:            rule,
 			Description:     "r8",
 			Output:          javalibJar,
-			ImplicitOutputs: android.WritablePaths{proguardDictionary, proguardUsageZip},
+			ImplicitOutputs: append(android.WritablePaths{proguardDictionary, proguardUsageZip}, d.mainDexListOutputs()...),
 			Input:           classesJar,
-			Implicits:       r8Deps,
+			Implicits:       append(r8Deps, config.PersistentWorkerJar(ctx, "r8")...),
 			Args:            args,
 		})
 	} else {
@@ -363,11 +456,12 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 			rule = d8RE
 		}
 		ctx.Build(pctx, android.BuildParams{
-			Rule:        rule,
-			Description: "d8",
-			Output:      javalibJar,
-			Input:       classesJar,
-			Implicits:   d8Deps,
+			Rule:            rule,
+			Description:     "d8",
+			Output:          javalibJar,
+			ImplicitOutputs: d.mainDexListOutputs(),
+			Input:           classesJar,
+			Implicits:       d8Deps,
 			Args: map[string]string{
 				"d8Flags":        strings.Join(append(commonFlags, d8Flags...), " "),
 				"zipFlags":       zipFlags,
@@ -385,3 +479,49 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 
 	return javalibJar
 }
+
+var dexClassList = pctx.AndroidStaticRule("dexClassList",
+	blueprint.RuleParams{
+		Command:     `${config.DexClassListCmd} ${config.DexdumpCmd} $in $classList $methodCounts`,
+		CommandDeps: []string{"${config.DexClassListCmd}", "${config.DexdumpCmd}"},
+	},
+	"classList", "methodCounts")
+
+// DexClassListInfo contains the list of classes in the dex jar of a java module, so that consumers
+// like multidex budgeting and package checks don't each have to run dexdump on it.
+type DexClassListInfo struct {
+	// ClassList is a file listing the descriptors of the classes in the dex jar, one per line,
+	// sorted.
+	ClassList android.Path
+
+	// MethodCounts is a file listing the number of methods defined by each class in the dex jar,
+	// as "<descriptor> <count>" lines sorted by descriptor.
+	MethodCounts android.Path
+}
+
+var DexClassListProvider = blueprint.NewProvider(DexClassListInfo{})
+
+// buildDexClassList creates the rule that lists the classes in dexJar and sets the
+// DexClassListProvider. The rule only runs when something depends on its outputs.
+func buildDexClassList(ctx android.ModuleContext, dexJar android.Path) DexClassListInfo {
+	classList := android.PathForModuleOut(ctx, "dex-class-list", "classes.txt")
+	methodCounts := android.PathForModuleOut(ctx, "dex-class-list", "method-counts.txt")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           dexClassList,
+		Description:    "dex class list",
+		Output:         classList,
+		ImplicitOutput: methodCounts,
+		Input:          dexJar,
+		Args: map[string]string{
+			"classList":    classList.String(),
+			"methodCounts": methodCounts.String(),
+		},
+	})
+
+	info := DexClassListInfo{
+		ClassList:    classList,
+		MethodCounts: methodCounts,
+	}
+	ctx.SetProvider(DexClassListProvider, info)
+	return info
+}
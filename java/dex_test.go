@@ -101,3 +101,180 @@ func TestD8(t *testing.T) {
 	android.AssertStringDoesNotContain(t, "expected no  static_lib header jar in foo javac classpath",
 		fooD8.Args["d8Flags"], staticLibHeader.String())
 }
+
+func TestMainDexRules(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModulesWithoutFakeDex2oatd,
+		android.FixtureMergeMockFs(android.MockFS{
+			"app.rules":        nil,
+			"foo.rules":        nil,
+			"static_lib.rules": nil,
+		}),
+	).RunTestWithBp(t, `
+		android_app {
+			name: "app",
+			srcs: ["foo.java"],
+			static_libs: ["static_lib"],
+			main_dex_rules: ["app.rules"],
+			sdk_version: "current",
+			min_sdk_version: "19",
+		}
+
+		java_library {
+			name: "foo",
+			srcs: ["foo.java"],
+			static_libs: ["static_lib"],
+			main_dex_rules: ["foo.rules"],
+			installable: true,
+			min_sdk_version: "19",
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["foo.java"],
+			static_libs: ["static_lib"],
+			main_dex_rules: ["foo.rules"],
+			installable: true,
+			min_sdk_version: "21",
+		}
+
+		java_library {
+			name: "static_lib",
+			srcs: ["foo.java"],
+			main_dex_rules: ["static_lib.rules"],
+		}
+	`)
+
+	app := result.ModuleForTests("app", "android_common")
+	appR8Flags := app.Rule("r8").Args["r8Flags"]
+	android.AssertStringDoesContain(t, "app r8 flags", appR8Flags, "--main-dex-rules app.rules")
+	android.AssertStringDoesContain(t, "app r8 flags", appR8Flags, "--main-dex-rules static_lib.rules")
+	app.Output("main_dex_list.txt")
+
+	foo := result.ModuleForTests("foo", "android_common")
+	fooD8Flags := foo.Rule("d8").Args["d8Flags"]
+	android.AssertStringDoesContain(t, "foo d8 flags", fooD8Flags, "--main-dex-rules foo.rules")
+	android.AssertStringDoesContain(t, "foo d8 flags", fooD8Flags, "--main-dex-rules static_lib.rules")
+	android.AssertStringDoesContain(t, "foo d8 flags", fooD8Flags, "--main-dex-list-output")
+	foo.Output("main_dex_list.txt")
+
+	// Native multidex is supported from API level 21, only the main dex rules of the module are
+	// passed.
+	bar := result.ModuleForTests("bar", "android_common")
+	barD8Flags := bar.Rule("d8").Args["d8Flags"]
+	android.AssertStringDoesContain(t, "bar d8 flags", barD8Flags, "--main-dex-rules foo.rules")
+	android.AssertStringDoesNotContain(t, "bar d8 flags", barD8Flags, "--main-dex-rules static_lib.rules")
+	android.AssertStringDoesNotContain(t, "bar d8 flags", barD8Flags, "--main-dex-list-output")
+	if bar.MaybeOutput("main_dex_list.txt").Rule != nil {
+		t.Errorf("expected no main dex list for bar")
+	}
+}
+
+func TestGeneratedMainDexRules(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModulesWithoutFakeDex2oatd.RunTestWithBp(t, `
+		android_app {
+			name: "app",
+			srcs: ["foo.java"],
+			sdk_version: "current",
+			min_sdk_version: "19",
+		}
+
+		android_app {
+			name: "app_without_generated_rules",
+			srcs: ["foo.java"],
+			sdk_version: "current",
+			min_sdk_version: "19",
+			generate_main_dex_rules: false,
+		}
+
+		android_app {
+			name: "app_native_multidex",
+			srcs: ["foo.java"],
+			sdk_version: "current",
+			min_sdk_version: "21",
+		}
+	`)
+
+	app := result.ModuleForTests("app", "android_common")
+	rules := "out/soong/.intermediates/app/android_common/gen/main_dex_proguard.options"
+	android.AssertStringDoesContain(t, "app aapt2 link flags",
+		android.StringRelativeToTop(result.Config, app.Output("package-res.apk").Args["flags"]),
+		"--proguard-main-dex "+rules)
+	android.AssertStringDoesContain(t, "app r8 flags",
+		android.StringRelativeToTop(result.Config, app.Rule("r8").Args["r8Flags"]),
+		"--main-dex-rules "+rules)
+
+	check := app.Rule("mainDexListCheck")
+	android.AssertPathRelativeToTopEquals(t, "main dex list check input",
+		"out/soong/.intermediates/app/android_common/main_dex_list.txt", check.Input)
+	// Only the classes in the jar that was dexed are checked.
+	classesJar := app.Rule("r8").Input
+	android.AssertPathsRelativeToTopEquals(t, "main dex list check implicits",
+		[]string{rules, android.PathRelativeToTop(classesJar)}, check.Implicits)
+	android.AssertStringEquals(t, "main dex list check classes jar", classesJar.String(), check.Args["classesJar"])
+	android.AssertStringListContains(t, "unsigned apk implicits",
+		android.PathsRelativeToTop(app.Output("app-unsigned.apk").Implicits),
+		"out/soong/.intermediates/app/android_common/main_dex_list_check.timestamp")
+
+	for _, name := range []string{"app_without_generated_rules", "app_native_multidex"} {
+		m := result.ModuleForTests(name, "android_common")
+		android.AssertStringDoesNotContain(t, name+" aapt2 link flags",
+			m.Output("package-res.apk").Args["flags"], "--proguard-main-dex")
+		if m.MaybeRule("mainDexListCheck").Rule != nil {
+			t.Errorf("expected no main dex list check for %s", name)
+		}
+	}
+}
+
+func TestGeneratedMainDexRulesNativeMultidex(t *testing.T) {
+	PrepareForTestWithJavaDefaultModulesWithoutFakeDex2oatd.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`generate_main_dex_rules: is only supported when min_sdk_version is lower than 21, got 21`)).
+		RunTestWithBp(t, `
+			android_app {
+				name: "app",
+				srcs: ["foo.java"],
+				sdk_version: "current",
+				min_sdk_version: "21",
+				generate_main_dex_rules: true,
+			}
+		`)
+}
+
+func TestDexClassList(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModulesWithoutFakeDex2oatd.RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["foo.java"],
+			installable: true,
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["foo.java"],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	classList := foo.Output("dex-class-list/classes.txt")
+	android.AssertPathRelativeToTopEquals(t, "class list input",
+		"out/soong/.intermediates/foo/android_common/dex/foo.jar", classList.Input)
+	android.AssertStringEquals(t, "method counts output",
+		"out/soong/.intermediates/foo/android_common/dex-class-list/method-counts.txt", classList.Args["methodCounts"])
+
+	info := result.ModuleProvider(foo.Module(), DexClassListProvider).(DexClassListInfo)
+	android.AssertPathsRelativeToTopEquals(t, "provider", []string{
+		"out/soong/.intermediates/foo/android_common/dex-class-list/classes.txt",
+		"out/soong/.intermediates/foo/android_common/dex-class-list/method-counts.txt",
+	}, android.Paths{info.ClassList, info.MethodCounts})
+
+	android.AssertPathsRelativeToTopEquals(t, ".dex_method_counts output files", []string{
+		"out/soong/.intermediates/foo/android_common/dex-class-list/method-counts.txt",
+	}, foo.OutputFiles(t, ".dex_method_counts"))
+
+	// Modules that aren't compiled to dex don't have a class list.
+	bar := result.ModuleForTests("bar", "android_common")
+	if bar.MaybeOutput("dex-class-list/classes.txt").Rule != nil {
+		t.Errorf("expected no class list for bar")
+	}
+}
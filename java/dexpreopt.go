@@ -103,6 +103,10 @@ type dexpreopter struct {
 	// - Dexpreopt post-processing (using dexpreopt artifacts from a prebuilt system image to incrementally
 	//   dexpreopt another partition).
 	configPath android.WritablePath
+
+	// Modifiers applied to the dexpreopt config of the module before the dexpreopt rules are
+	// generated from it, only set by FixtureModifyDexpreoptConfigPerModule in tests.
+	configModifiersForTests []func(ctx android.PathContext, moduleConfig *dexpreopt.ModuleConfig)
 }
 
 type DexpreoptProperties struct {
@@ -346,6 +350,9 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Wr
 
 		PresignedPrebuilt: d.isPresignedPrebuilt,
 	}
+	for _, modifier := range d.configModifiersForTests {
+		modifier(ctx, dexpreoptConfig)
+	}
 
 	d.configPath = android.PathForModuleOut(ctx, "dexpreopt", "dexpreopt.config")
 	dexpreopt.WriteModuleConfig(ctx, dexpreoptConfig, d.configPath)
@@ -401,6 +408,21 @@ func (d *dexpreopter) DexpreoptBuiltInstalledForApex() []dexpreopterInstall {
 	return d.builtInstalledForApex
 }
 
+// InstallDepsReportExtraFiles returns the dexpreopt artifacts of an APEX variant, which are
+// installed by Make.
+func (d *dexpreopter) InstallDepsReportExtraFiles(ctx android.PathContext) android.RuleBuilderInstalls {
+	var installs android.RuleBuilderInstalls
+	for _, install := range d.builtInstalledForApex {
+		installs = append(installs, android.RuleBuilderInstall{
+			From: install.outputPathOnHost,
+			To:   filepath.Join(android.InstallPathToOnDevicePath(ctx, install.installDirOnDevice), install.installFileOnDevice),
+		})
+	}
+	return installs
+}
+
+var _ android.InstallDepsReportExtraFilesProvider = (*dexpreopter)(nil)
+
 func (d *dexpreopter) AndroidMkEntriesForApex() []android.AndroidMkEntries {
 	var entries []android.AndroidMkEntries
 	for _, install := range d.builtInstalledForApex {
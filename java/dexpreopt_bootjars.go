@@ -233,6 +233,69 @@ func init() {
 	RegisterDexpreoptBootJarsComponents(android.InitRegistrationContext)
 }
 
+// bootImageInstallLocation identifies where the files of a boot image are installed on device.
+//
+// A boot image is either installed in a subdirectory of the system partition or in a subdirectory
+// of an APEX. The APEX is referenced by its apex_name, the name of the directory in which it is
+// activated on device, which is resolved against the ApexContents in the ApexInfoProvider of the
+// bootclasspath_fragment that provides the boot image files. So the files can only be provided by a
+// bootclasspath_fragment that is part of an APEX with that apex_name, e.g. com.android.art or an
+// override_apex of it, but not by the variant of another APEX that was merged with it.
+type bootImageInstallLocation struct {
+	// The apex_name of the APEX in which the image files are installed, or empty if they are
+	// installed in the system partition.
+	apexName string
+
+	// The subdirectory of the APEX or of the system partition in which the image files are installed.
+	subdir string
+}
+
+// bootImageInstallOnSystem returns the location of a boot image that is installed in the given
+// subdirectory of the system partition, e.g. "framework" for /system/framework.
+func bootImageInstallOnSystem(subdir string) bootImageInstallLocation {
+	return bootImageInstallLocation{subdir: subdir}
+}
+
+// bootImageInstallInApex returns the location of a boot image that is installed in the given
+// subdirectory of the APEX with the given apex_name, e.g. "com.android.art" and "javalib" for
+// /apex/com.android.art/javalib.
+func bootImageInstallInApex(apexName string, subdir string) bootImageInstallLocation {
+	return bootImageInstallLocation{apexName: apexName, subdir: subdir}
+}
+
+// inApex returns true if the boot image is installed in an APEX.
+func (l bootImageInstallLocation) inApex() bool {
+	return l.apexName != ""
+}
+
+// apexContents returns the ApexContents of the APEX in which the boot image is installed from the
+// APEXes that a module with the given apex info is part of, or nil if the module is not part of
+// it.
+func (l bootImageInstallLocation) apexContents(apexInfo android.ApexInfo) *android.ApexContents {
+	for _, contents := range apexInfo.ApexContents {
+		if contents.ApexName() == l.apexName {
+			return contents
+		}
+	}
+	return nil
+}
+
+// providedBy returns true if a module with the given apex info can provide the files of the boot
+// image, i.e. if the boot image is installed in the system partition or in an APEX that contains
+// the module.
+func (l bootImageInstallLocation) providedBy(apexInfo android.ApexInfo) bool {
+	return !l.inApex() || l.apexContents(apexInfo) != nil
+}
+
+// String returns the directory, relative to the root of the device, in which the image files are
+// installed, e.g. "system/framework" or "apex/com.android.art/javalib".
+func (l bootImageInstallLocation) String() string {
+	if l.inApex() {
+		return filepath.Join("apex", l.apexName, l.subdir)
+	}
+	return filepath.Join("system", l.subdir)
+}
+
 // Target-independent description of a boot image.
 type bootImageConfig struct {
 	// If this image is an extension, the image that it extends.
@@ -253,8 +316,8 @@ type bootImageConfig struct {
 	// Subdirectory where the image files are installed.
 	installDirOnHost string
 
-	// Subdirectory where the image files on device are installed.
-	installDirOnDevice string
+	// Location where the image files on device are installed.
+	installLocationOnDevice bootImageInstallLocation
 
 	// Install path of the boot image profile if it needs to be installed in the APEX, or empty if not
 	// needed.
@@ -402,7 +465,7 @@ func (image *bootImageConfig) apexVariants() []*bootImageVariant {
 
 // Returns true if the boot image should be installed in the APEX.
 func (image *bootImageConfig) shouldInstallInApex() bool {
-	return strings.HasPrefix(image.installDirOnDevice, "apex/")
+	return image.installLocationOnDevice.inApex()
 }
 
 // Return boot image locations (as a list of symbolic paths).
@@ -760,8 +823,8 @@ func buildBootImageVariant(ctx android.ModuleContext, image *bootImageVariant, p
 			android.RuleBuilderInstall{unstrippedOat, filepath.Join(installDir, unstrippedOat.Base())})
 	}
 
-	if image.installDirOnHost != image.installDirOnDevice && !image.shouldInstallInApex() && !ctx.Config().UnbundledBuild() {
-		installDirOnDevice := filepath.Join("/", image.installDirOnDevice, arch.String())
+	if image.installDirOnHost != image.installLocationOnDevice.String() && !image.shouldInstallInApex() && !ctx.Config().UnbundledBuild() {
+		installDirOnDevice := filepath.Join("/", image.installLocationOnDevice.String(), arch.String())
 		for _, file := range image.moduleFiles(ctx, outputDir, ".art", ".oat", ".vdex") {
 			deviceInstalls = append(deviceInstalls,
 				android.RuleBuilderInstall{file, filepath.Join(installDirOnDevice, file.Base())})
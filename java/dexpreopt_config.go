@@ -59,7 +59,7 @@ func genBootImageConfigRaw(ctx android.PathContext) map[string]*bootImageConfig
 			name:                     artBootImageName,
 			stem:                     "boot",
 			installDirOnHost:         "apex/art_boot_images/javalib",
-			installDirOnDevice:       "system/framework",
+			installLocationOnDevice:  bootImageInstallOnSystem("framework"),
 			profileInstallPathInApex: "etc/boot-image.prof",
 			modules:                  artModules,
 			preloadedClassesFile:     "art/build/boot/preloaded-classes",
@@ -67,15 +67,15 @@ func genBootImageConfigRaw(ctx android.PathContext) map[string]*bootImageConfig
 
 		// Framework config for the boot image extension.
 		// It includes framework libraries and depends on the ART config.
-		frameworkSubdir := "system/framework"
+		frameworkLocation := bootImageInstallOnSystem("framework")
 		frameworkCfg := bootImageConfig{
-			extends:              &artCfg,
-			name:                 frameworkBootImageName,
-			stem:                 "boot",
-			installDirOnHost:     frameworkSubdir,
-			installDirOnDevice:   frameworkSubdir,
-			modules:              frameworkModules,
-			preloadedClassesFile: "frameworks/base/config/preloaded-classes",
+			extends:                 &artCfg,
+			name:                    frameworkBootImageName,
+			stem:                    "boot",
+			installDirOnHost:        frameworkLocation.String(),
+			installLocationOnDevice: frameworkLocation,
+			modules:                 frameworkModules,
+			preloadedClassesFile:    "frameworks/base/config/preloaded-classes",
 		}
 
 		return map[string]*bootImageConfig{
@@ -120,7 +120,7 @@ func genBootImageConfigs(ctx android.PathContext) map[string]*bootImageConfig {
 					bootImageConfig:   c,
 					target:            target,
 					imagePathOnHost:   imageDir.Join(ctx, imageName),
-					imagePathOnDevice: filepath.Join("/", c.installDirOnDevice, arch.String(), imageName),
+					imagePathOnDevice: filepath.Join("/", c.installLocationOnDevice.String(), arch.String(), imageName),
 					imagesDeps:        c.moduleFiles(ctx, imageDir, ".art", ".oat", ".vdex"),
 					dexLocations:      c.modules.DevicePaths(ctx.Config(), target.Os),
 				}
@@ -296,6 +296,95 @@ func TestDex2oatToolDeps(t *testing.T) {
 	testDex2oatToolDep(false, true, false, prebuiltDex2oatPath)
 }
 
+func TestDexpreoptSystemServerDirtyImageObjects(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		dexpreopt.FixtureSetSystemServerJars("platform:service-foo", "platform:service-bar"),
+		FixtureConfigureSystemServerDirtyImageObjects("frameworks/base/config/dirty-image-objects"),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "service-foo",
+			installable: true,
+			srcs: ["a.java"],
+			dex_preopt: {
+				app_image: true,
+			},
+		}
+
+		java_library {
+			name: "service-bar",
+			installable: true,
+			srcs: ["a.java"],
+		}
+	`)
+
+	dexpreoptRule := result.ModuleForTests("service-foo", "android_common").Rule("dexpreopt")
+	android.AssertStringDoesContain(t, "dexpreopt command", dexpreoptRule.RuleParams.Command,
+		"--dirty-image-objects=frameworks/base/config/dirty-image-objects")
+	android.AssertStringListContains(t, "dexpreopt inputs", dexpreoptRule.Implicits.Strings(),
+		"frameworks/base/config/dirty-image-objects")
+
+	// The dirty image objects are only used to lay out an app image.
+	dexpreoptRule = result.ModuleForTests("service-bar", "android_common").Rule("dexpreopt")
+	android.AssertStringDoesNotContain(t, "dexpreopt command", dexpreoptRule.RuleParams.Command,
+		"--dirty-image-objects=")
+}
+
+func TestDexpreoptModifyConfigPerModule(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureAddFile("foo.prof", nil),
+		FixtureModifyDexpreoptConfigPerModule("foo", func(ctx android.PathContext, moduleConfig *dexpreopt.ModuleConfig) {
+			moduleConfig.ProfileClassListing = android.OptionalPathForPath(android.PathForSource(ctx, "foo.prof"))
+			moduleConfig.ProfileIsTextListing = true
+		}),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			installable: true,
+			srcs: ["a.java"],
+		}
+
+		java_library {
+			name: "bar",
+			installable: true,
+			srcs: ["a.java"],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common").Rule("dexpreopt")
+	android.AssertStringDoesContain(t, "foo dexpreopt command", foo.RuleParams.Command,
+		"--create-profile-from=foo.prof")
+
+	bar := result.ModuleForTests("bar", "android_common").Rule("dexpreopt")
+	android.AssertStringDoesNotContain(t, "bar dexpreopt command", bar.RuleParams.Command,
+		"--create-profile-from=")
+}
+
+func TestDexpreoptInstalledFiles(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			installable: true,
+			srcs: ["a.java"],
+		}
+	`)
+
+	CheckInstalledFiles(t, result, "foo", "system", []string{
+		"framework/foo.jar",
+		"framework/oat/arm/foo.odex",
+		"framework/oat/arm/foo.vdex",
+		"framework/oat/arm64/foo.odex",
+		"framework/oat/arm64/foo.vdex",
+	})
+	CheckInstalledFiles(t, result, "foo", "vendor", nil)
+
+	android.FixtureExpectInstalledFiles(t, result, "system", []string{
+		"framework/foo.jar",
+		"framework/oat/arm64/foo.odex",
+	})
+}
+
 func TestDexpreoptBuiltInstalledForApex(t *testing.T) {
 	preparers := android.GroupFixturePreparers(
 		PrepareForTestWithJavaDefaultModules,
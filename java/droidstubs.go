@@ -73,6 +73,9 @@ type Droidstubs struct {
 
 	metadataZip android.WritablePath
 	metadataDir android.WritablePath
+
+	// The metalava baseline files used by the api lint and last released checks.
+	metalavaBaselines android.Paths
 }
 
 type DroidstubsProperties struct {
@@ -147,6 +150,18 @@ type DroidstubsProperties struct {
 	// if set to true, collect the values used by the Dev tools and
 	// write them in files packaged with the SDK. Defaults to false.
 	Write_sdk_values *bool
+
+	// if set, the sources are split by package into up to this number of partitions, which are
+	// processed by separate metalava invocations, so that a change to a source only reruns the
+	// metalava invocation of its partition. The API files and stubs of the partitions are merged.
+	// Cannot be combined with api_lint, check_api.last_released, annotations_enabled,
+	// api_levels_annotations_enabled, write_sdk_values or out.
+	Package_partitions *int64
+
+	// the directories that contain the sources of the module in a package hierarchy, in which
+	// metalava looks up the classes of the other partitions when package_partitions is set.
+	// Defaults to the directory of the module.
+	Partition_source_path []string
 }
 
 // Used by xsd_config
@@ -257,36 +272,68 @@ func (d *Droidstubs) DepsMutator(ctx android.BottomUpMutatorContext) {
 	}
 }
 
-func (d *Droidstubs) stubsFlags(ctx android.ModuleContext, cmd *android.RuleBuilderCommand, stubsDir android.OptionalPath) {
+// apiFileName returns the name of the API file written by metalava, or "" if it is not written.
+func (d *Droidstubs) apiFileName(ctx android.ModuleContext) string {
 	if apiCheckEnabled(ctx, d.properties.Check_api.Current, "current") ||
 		apiCheckEnabled(ctx, d.properties.Check_api.Last_released, "last_released") ||
 		String(d.properties.Api_filename) != "" {
-		filename := proptools.StringDefault(d.properties.Api_filename, ctx.ModuleName()+"_api.txt")
-		d.apiFile = android.PathForModuleOut(ctx, "metalava", filename)
-		cmd.FlagWithOutput("--api ", d.apiFile)
-		d.apiFilePath = d.apiFile
-	} else if sourceApiFile := proptools.String(d.properties.Check_api.Current.Api_file); sourceApiFile != "" {
-		// If check api is disabled then make the source file available for export.
-		d.apiFilePath = android.PathForModuleSrc(ctx, sourceApiFile)
+		return proptools.StringDefault(d.properties.Api_filename, ctx.ModuleName()+"_api.txt")
 	}
+	return ""
+}
 
+// removedApiFileName returns the name of the removed API file written by metalava, or "" if it is
+// not written.
+func (d *Droidstubs) removedApiFileName(ctx android.ModuleContext) string {
 	if apiCheckEnabled(ctx, d.properties.Check_api.Current, "current") ||
 		apiCheckEnabled(ctx, d.properties.Check_api.Last_released, "last_released") ||
 		String(d.properties.Removed_api_filename) != "" {
-		filename := proptools.StringDefault(d.properties.Removed_api_filename, ctx.ModuleName()+"_removed.txt")
-		d.removedApiFile = android.PathForModuleOut(ctx, "metalava", filename)
-		cmd.FlagWithOutput("--removed-api ", d.removedApiFile)
-		d.removedApiFilePath = d.removedApiFile
+		return proptools.StringDefault(d.properties.Removed_api_filename, ctx.ModuleName()+"_removed.txt")
+	}
+	return ""
+}
+
+// setApiFiles sets the API files of the module to the files written by metalava, or to the source
+// files of the current API if metalava does not write them.
+func (d *Droidstubs) setApiFiles(ctx android.ModuleContext, apiFile, removedApiFile android.WritablePath) {
+	if apiFile != nil {
+		d.apiFile = apiFile
+		d.apiFilePath = apiFile
+	} else if sourceApiFile := proptools.String(d.properties.Check_api.Current.Api_file); sourceApiFile != "" {
+		// If check api is disabled then make the source file available for export.
+		d.apiFilePath = android.PathForModuleSrc(ctx, sourceApiFile)
+	}
+
+	if removedApiFile != nil {
+		d.removedApiFile = removedApiFile
+		d.removedApiFilePath = removedApiFile
 	} else if sourceRemovedApiFile := proptools.String(d.properties.Check_api.Current.Removed_api_file); sourceRemovedApiFile != "" {
 		// If check api is disabled then make the source removed api file available for export.
 		d.removedApiFilePath = android.PathForModuleSrc(ctx, sourceRemovedApiFile)
 	}
+}
+
+func (d *Droidstubs) stubsFlags(ctx android.ModuleContext, cmd *android.RuleBuilderCommand, stubsDir android.OptionalPath) {
+	var apiFile, removedApiFile android.WritablePath
+	if filename := d.apiFileName(ctx); filename != "" {
+		apiFile = android.PathForModuleOut(ctx, "metalava", filename)
+		cmd.FlagWithOutput("--api ", apiFile)
+	}
+	if filename := d.removedApiFileName(ctx); filename != "" {
+		removedApiFile = android.PathForModuleOut(ctx, "metalava", filename)
+		cmd.FlagWithOutput("--removed-api ", removedApiFile)
+	}
+	d.setApiFiles(ctx, apiFile, removedApiFile)
 
 	if Bool(d.properties.Write_sdk_values) {
 		d.metadataDir = android.PathForModuleOut(ctx, "metalava", "metadata")
 		cmd.FlagWithArg("--sdk-values ", d.metadataDir.String())
 	}
 
+	d.stubsDirFlags(cmd, stubsDir)
+}
+
+func (d *Droidstubs) stubsDirFlags(cmd *android.RuleBuilderCommand, stubsDir android.OptionalPath) {
 	if stubsDir.Valid() {
 		if Bool(d.properties.Create_doc_stubs) {
 			cmd.FlagWithArg("--doc-stubs ", stubsDir.String())
@@ -299,7 +346,9 @@ func (d *Droidstubs) stubsFlags(ctx android.ModuleContext, cmd *android.RuleBuil
 	}
 }
 
-func (d *Droidstubs) annotationsFlags(ctx android.ModuleContext, cmd *android.RuleBuilderCommand) {
+// annotationsFlags adds the flags that make metalava include the annotations in the stubs and
+// extract them to annotationsZip when annotations_enabled is set.
+func (d *Droidstubs) annotationsFlags(ctx android.ModuleContext, cmd *android.RuleBuilderCommand, annotationsZip android.WritablePath) {
 	if Bool(d.properties.Annotations_enabled) {
 		cmd.Flag("--include-annotations")
 
@@ -324,8 +373,7 @@ func (d *Droidstubs) annotationsFlags(ctx android.ModuleContext, cmd *android.Ru
 			cmd.FlagWithOutput("--nullability-warnings-txt ", d.nullabilityWarningsFile)
 		}
 
-		d.annotationsZip = android.PathForModuleOut(ctx, "metalava", ctx.ModuleName()+"_annotations.zip")
-		cmd.FlagWithOutput("--extract-annotations ", d.annotationsZip)
+		cmd.FlagWithOutput("--extract-annotations ", annotationsZip)
 
 		if len(d.properties.Merge_annotations_dirs) != 0 {
 			d.mergeAnnoDirFlags(ctx, cmd)
@@ -437,8 +485,10 @@ func metalavaUseRbe(ctx android.ModuleContext) bool {
 	return ctx.Config().UseRBE() && ctx.Config().IsEnvTrue("RBE_METALAVA")
 }
 
+// metalavaCmd returns a metalava command for the sources in srcs, listed in rspFile, and in the
+// srcjars extracted by zipSyncCmd to the files listed in srcJarList, which may be nil.
 func metalavaCmd(ctx android.ModuleContext, rule *android.RuleBuilder, javaVersion javaVersion, srcs android.Paths,
-	srcJarList android.Path, bootclasspath, classpath classpath, homeDir android.WritablePath) *android.RuleBuilderCommand {
+	srcJarList android.Path, bootclasspath, classpath classpath, homeDir, rspFile android.WritablePath) *android.RuleBuilderCommand {
 	rule.Command().Text("rm -rf").Flag(homeDir.String())
 	rule.Command().Text("mkdir -p").Flag(homeDir.String())
 
@@ -465,8 +515,11 @@ func metalavaCmd(ctx android.ModuleContext, rule *android.RuleBuilder, javaVersi
 		Flag("-J--add-opens=java.base/java.util=ALL-UNNAMED").
 		FlagWithArg("-encoding ", "UTF-8").
 		FlagWithArg("-source ", javaVersion.String()).
-		FlagWithRspFileInputList("@", android.PathForModuleOut(ctx, "metalava.rsp"), srcs).
-		FlagWithInput("@", srcJarList)
+		FlagWithRspFileInputList("@", rspFile, srcs)
+
+	if srcJarList != nil {
+		cmd.FlagWithInput("@", srcJarList)
+	}
 
 	if len(bootclasspath) > 0 {
 		cmd.FlagWithInputList("-bootclasspath ", bootclasspath.Paths(), ":")
@@ -494,6 +547,21 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 	javaVersion := getJavaVersion(ctx, String(d.Javadoc.properties.Java_version), android.SdkContext(d))
 
+	if d.properties.Package_partitions != nil {
+		if !d.checkPartitionedMetalava(ctx) {
+			return
+		}
+		d.buildPartitionedMetalava(ctx, deps, javaVersion)
+	} else {
+		d.buildMetalava(ctx, deps, javaVersion)
+	}
+
+	d.buildApiChecks(ctx)
+}
+
+// buildMetalava generates the rule that runs metalava on all the sources of the module, which also
+// runs api lint and checks the compatibility with the last released API.
+func (d *Droidstubs) buildMetalava(ctx android.ModuleContext, deps deps, javaVersion javaVersion) {
 	// Create rule for metalava
 
 	srcJarDir := android.PathForModuleOut(ctx, "metalava", "srcjars")
@@ -522,12 +590,15 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 	homeDir := android.PathForModuleOut(ctx, "metalava", "home")
 	cmd := metalavaCmd(ctx, rule, javaVersion, d.Javadoc.srcFiles, srcJarList,
-		deps.bootClasspath, deps.classpath, homeDir)
+		deps.bootClasspath, deps.classpath, homeDir, android.PathForModuleOut(ctx, "metalava.rsp"))
 	cmd.Implicits(d.Javadoc.implicits)
 
 	d.stubsFlags(ctx, cmd, stubsDir)
 
-	d.annotationsFlags(ctx, cmd)
+	if Bool(d.properties.Annotations_enabled) {
+		d.annotationsZip = android.PathForModuleOut(ctx, "metalava", ctx.ModuleName()+"_annotations.zip")
+	}
+	d.annotationsFlags(ctx, cmd, d.annotationsZip)
 	d.inclusionAnnotationsFlags(ctx, cmd)
 	d.apiLevelsAnnotationsFlags(ctx, cmd)
 
@@ -584,6 +655,7 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			`   where the <id> is given in brackets in the error message above.\n`
 
 		if baselineFile.Valid() {
+			d.metalavaBaselines = append(d.metalavaBaselines, baselineFile.Path())
 			cmd.FlagWithInput("--baseline:api-lint ", baselineFile.Path())
 			cmd.FlagWithOutput("--update-baseline:api-lint ", updatedBaselineOutput)
 
@@ -626,6 +698,7 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		cmd.FlagWithInput("--check-compatibility:removed:released ", removedApiFile)
 
 		if baselineFile.Valid() {
+			d.metalavaBaselines = append(d.metalavaBaselines, baselineFile.Path())
 			cmd.FlagWithInput("--baseline:compatibility:released ", baselineFile.Path())
 			cmd.FlagWithOutput("--update-baseline:compatibility:released ", updatedBaselineOutput)
 		}
@@ -677,7 +750,11 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	zipSyncCleanupCmd(rule, srcJarDir)
 
 	rule.Build("metalava", "metalava merged")
+}
 
+// buildApiChecks generates the rules that check the API files of the module against the current
+// API and update it, and that check the nullability warnings.
+func (d *Droidstubs) buildApiChecks(ctx android.ModuleContext) {
 	if apiCheckEnabled(ctx, d.properties.Check_api.Current, "current") {
 
 		if len(d.Javadoc.properties.Out) > 0 {
@@ -810,6 +887,10 @@ var _ android.PrebuiltInterface = (*PrebuiltStubsSources)(nil)
 
 type PrebuiltStubsSourcesProperties struct {
 	Srcs []string `android:"path"`
+
+	// The annotations zip extracted from the sources, as generated by droidstubs with
+	// annotations_enabled: true.
+	Annotations *string `android:"path"`
 }
 
 type PrebuiltStubsSources struct {
@@ -820,13 +901,19 @@ type PrebuiltStubsSources struct {
 
 	properties PrebuiltStubsSourcesProperties
 
-	stubsSrcJar android.Path
+	stubsSrcJar    android.Path
+	annotationsZip android.Path
 }
 
 func (p *PrebuiltStubsSources) OutputFiles(tag string) (android.Paths, error) {
 	switch tag {
 	case "":
 		return android.Paths{p.stubsSrcJar}, nil
+	case ".annotations.zip":
+		if p.annotationsZip != nil {
+			return android.Paths{p.annotationsZip}, nil
+		}
+		return nil, fmt.Errorf("no annotations specified on %s", p.BaseModuleName())
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -836,7 +923,16 @@ func (d *PrebuiltStubsSources) StubsSrcJar() android.Path {
 	return d.stubsSrcJar
 }
 
+// AnnotationsZip returns the annotations zip, or nil if it was not specified.
+func (p *PrebuiltStubsSources) AnnotationsZip() android.Path {
+	return p.annotationsZip
+}
+
 func (p *PrebuiltStubsSources) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if p.properties.Annotations != nil {
+		p.annotationsZip = android.PathForModuleSrc(ctx, *p.properties.Annotations)
+	}
+
 	if len(p.properties.Srcs) != 1 {
 		ctx.PropertyErrorf("srcs", "must only specify one directory path or srcjar, contains %d paths", len(p.properties.Srcs))
 		return
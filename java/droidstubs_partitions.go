@@ -0,0 +1,250 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"android/soong/android"
+)
+
+// This file contains the partitioned mode of droidstubs, which is enabled by the
+// package_partitions property, e.g.
+//
+//	droidstubs {
+//	    name: "framework-doc-stubs",
+//	    package_partitions: 8,
+//	    partition_source_path: ["core/java"],
+//	}
+//
+// The sources are split into partitions of whole packages with about the same number of sources,
+// and metalava is run separately on each partition, in parallel. Metalava resolves the classes of
+// the other partitions from the source path, which is why the partitions are not sandboxed. A
+// change to a class can change the API of the classes of other partitions, e.g. through the members
+// that subclasses inherit, so every partition depends on all the sources of the module. The merged
+// outputs are only rebuilt when the outputs of a partition changed.
+//
+// The API and removed API files of the partitions are merged by metalava, and their stubs by
+// merge_zips, to the same files as in the default mode, which are checked against the current API
+// as usual. The features that need the whole API in a single metalava run, i.e. api lint, the
+// compatibility check against the last released API, the annotations, the API levels and the SDK
+// values, are not supported.
+
+// partitionSourcesByPackage splits srcs into at most n partitions of whole packages with about the
+// same number of sources. Like filter_packages, it uses the directory of a source relative to its
+// module as its package.
+func partitionSourcesByPackage(srcs android.Paths, n int) []android.Paths {
+	byPackage := make(map[string]android.Paths)
+	for _, src := range srcs {
+		pkg := filepath.Dir(src.Rel())
+		byPackage[pkg] = append(byPackage[pkg], src)
+	}
+	packages := android.SortedStringKeys(byPackage)
+
+	if n > len(packages) {
+		n = len(packages)
+	}
+
+	var partitions []android.Paths
+	var current android.Paths
+	remainingSrcs := len(srcs)
+	for i, pkg := range packages {
+		current = append(current, byPackage[pkg]...)
+		remainingPartitions := n - len(partitions)
+		remainingPackages := len(packages) - i - 1
+		// Close the partition once it holds its share of the remaining sources, or when each of the
+		// remaining partitions needs one of the remaining packages.
+		if remainingPartitions > 1 &&
+			(len(current)*remainingPartitions >= remainingSrcs || remainingPackages == remainingPartitions-1) {
+			partitions = append(partitions, current)
+			remainingSrcs -= len(current)
+			current = nil
+		}
+	}
+	return append(partitions, current)
+}
+
+// checkPartitionedMetalava reports the properties that cannot be combined with package_partitions,
+// and returns false if there are any.
+func (d *Droidstubs) checkPartitionedMetalava(ctx android.ModuleContext) bool {
+	ok := true
+	unsupported := func(property string) {
+		ctx.PropertyErrorf(property, "cannot be combined with package_partitions")
+		ok = false
+	}
+
+	if n := *d.properties.Package_partitions; n < 1 {
+		ctx.PropertyErrorf("package_partitions", "must be at least 1, got %d", n)
+		ok = false
+	}
+	if Bool(d.properties.Check_api.Api_lint.Enabled) {
+		unsupported("check_api.api_lint.enabled")
+	}
+	if apiCheckEnabled(ctx, d.properties.Check_api.Last_released, "last_released") {
+		unsupported("check_api.last_released")
+	}
+	if Bool(d.properties.Annotations_enabled) {
+		// The annotations of a package that is split between partitions, e.g. by the srcjars, cannot
+		// be merged.
+		unsupported("annotations_enabled")
+	}
+	if Bool(d.properties.Api_levels_annotations_enabled) {
+		unsupported("api_levels_annotations_enabled")
+	}
+	if Bool(d.properties.Write_sdk_values) {
+		unsupported("write_sdk_values")
+	}
+	if len(d.Javadoc.properties.Out) > 0 {
+		unsupported("out")
+	}
+	return ok
+}
+
+// buildPartitionedMetalava generates a metalava rule for each partition of the sources of the
+// module, and the rule that merges their outputs.
+func (d *Droidstubs) buildPartitionedMetalava(ctx android.ModuleContext, deps deps, javaVersion javaVersion) {
+	sourcePath := d.Javadoc.sourcepaths
+	if len(d.properties.Partition_source_path) > 0 {
+		sourcePath = android.PathsForModuleSrc(ctx, d.properties.Partition_source_path)
+	}
+
+	apiFileName := d.apiFileName(ctx)
+	removedApiFileName := d.removedApiFileName(ctx)
+	generateStubs := BoolDefault(d.properties.Generate_stubs, true)
+
+	var apiFiles, removedApiFiles, stubsSrcJars android.Paths
+
+	partitions := partitionSourcesByPackage(d.Javadoc.srcFiles, int(*d.properties.Package_partitions))
+	for i, srcs := range partitions {
+		partition := strconv.Itoa(i)
+		outDir := android.PathForModuleOut(ctx, "metalava_partitions", partition)
+		srcJarDir := android.PathForModuleOut(ctx, "metalava_partitions", partition, "srcjars")
+
+		rule := android.NewRuleBuilder(pctx, ctx)
+
+		// The inputs are not sandboxed, as metalava reads the sources of the other partitions from
+		// the source path.
+		rule.Sbox(outDir,
+			android.PathForModuleOut(ctx, "metalava_partitions", partition+".sbox.textproto"))
+
+		if BoolDefault(d.properties.High_mem, false) {
+			rule.HighMem()
+		}
+
+		var stubsDir android.OptionalPath
+		if generateStubs {
+			stubsDir = android.OptionalPathForPath(outDir.Join(ctx, "stubsDir"))
+			rule.Command().Text("rm -rf").Text(stubsDir.String())
+			rule.Command().Text("mkdir -p").Text(stubsDir.String())
+		}
+
+		// Every partition extracts the srcjars so that it can resolve their classes, but only the
+		// first one processes them.
+		srcJarList := zipSyncCmd(ctx, rule, srcJarDir, d.Javadoc.srcJars)
+		var partitionSrcJarList android.Path
+		if i == 0 {
+			partitionSrcJarList = srcJarList
+		}
+
+		homeDir := outDir.Join(ctx, "home")
+		cmd := metalavaCmd(ctx, rule, javaVersion, srcs, partitionSrcJarList,
+			deps.bootClasspath, deps.classpath, homeDir,
+			android.PathForModuleOut(ctx, "metalava_partitions", partition+".rsp"))
+		// The sources of the other partitions are read through the source path.
+		cmd.Implicits(d.Javadoc.srcFiles)
+
+		partitionSourcePath := sourcePath.Strings()
+		if i != 0 {
+			partitionSourcePath = append(partitionSourcePath, cmd.PathForOutput(srcJarDir))
+		}
+		if len(partitionSourcePath) > 0 {
+			cmd.FlagWithList("--source-path ", partitionSourcePath, ":")
+		}
+
+		if apiFileName != "" {
+			apiFile := outDir.Join(ctx, "api.txt")
+			cmd.FlagWithOutput("--api ", apiFile)
+			apiFiles = append(apiFiles, apiFile)
+		}
+		if removedApiFileName != "" {
+			removedApiFile := outDir.Join(ctx, "removed.txt")
+			cmd.FlagWithOutput("--removed-api ", removedApiFile)
+			removedApiFiles = append(removedApiFiles, removedApiFile)
+		}
+		d.stubsDirFlags(cmd, stubsDir)
+		d.inclusionAnnotationsFlags(ctx, cmd)
+
+		d.expandArgs(ctx, cmd)
+
+		if generateStubs {
+			stubsSrcJar := outDir.Join(ctx, "stubs.srcjar")
+			rule.Command().
+				BuiltTool("soong_zip").
+				Flag("-write_if_changed").
+				Flag("-jar").
+				FlagWithOutput("-o ", stubsSrcJar).
+				FlagWithArg("-C ", stubsDir.String()).
+				FlagWithArg("-D ", stubsDir.String())
+			stubsSrcJars = append(stubsSrcJars, stubsSrcJar)
+		}
+
+		// TODO(b/183630617): rewrapper doesn't support restat rules
+		if !metalavaUseRbe(ctx) {
+			rule.Restat()
+		}
+
+		zipSyncCleanupCmd(rule, srcJarDir)
+
+		rule.Build("metalava_partition_"+partition, "metalava partition "+partition)
+	}
+
+	// Merge the outputs of the partitions into the outputs of the default mode.
+	rule := android.NewRuleBuilder(pctx, ctx)
+
+	var apiFile, removedApiFile android.WritablePath
+	if apiFileName != "" {
+		apiFile = android.PathForModuleOut(ctx, "metalava", apiFileName)
+		mergeSignatureFilesCmd(ctx, rule, apiFiles, apiFile)
+	}
+	if removedApiFileName != "" {
+		removedApiFile = android.PathForModuleOut(ctx, "metalava", removedApiFileName)
+		mergeSignatureFilesCmd(ctx, rule, removedApiFiles, removedApiFile)
+	}
+	d.setApiFiles(ctx, apiFile, removedApiFile)
+
+	if generateStubs {
+		d.Javadoc.stubsSrcJar = android.PathForModuleOut(ctx, "metalava", ctx.ModuleName()+"-"+"stubs.srcjar")
+		rule.Command().
+			BuiltTool("merge_zips").
+			Flag("-j").
+			Output(d.Javadoc.stubsSrcJar).
+			Inputs(stubsSrcJars)
+	}
+
+	rule.Build("metalava_merge_partitions", "metalava merge partitions")
+}
+
+// mergeSignatureFilesCmd adds a command to rule that merges the API signature files in inputs to
+// output.
+func mergeSignatureFilesCmd(ctx android.ModuleContext, rule *android.RuleBuilder, inputs android.Paths, output android.WritablePath) {
+	rule.Command().
+		BuiltTool("metalava").ImplicitTool(ctx.Config().HostJavaToolPath(ctx, "metalava.jar")).
+		Flag("--no-banner").
+		Flag("--quiet").
+		Flag("--format=v2").
+		Inputs(inputs).
+		FlagWithOutput("--api ", output)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -242,3 +243,142 @@ func checkSystemModulesUseByDroidstubs(t *testing.T, ctx *android.TestContext, m
 		t.Errorf("inputs of %q must be []string{%q}, but was %#v.", moduleName, systemJar, systemJars)
 	}
 }
+
+func TestPartitionSourcesByPackage(t *testing.T) {
+	srcs := android.PathsForTesting(
+		"a/A1.java", "a/A2.java", "a/A3.java",
+		"b/B1.java",
+		"c/C1.java", "c/C2.java",
+		"d/D1.java")
+
+	testCases := []struct {
+		name string
+		srcs android.Paths
+		n    int
+		want [][]string
+	}{
+		{
+			name: "one partition",
+			srcs: srcs,
+			n:    1,
+			want: [][]string{srcs.Strings()},
+		},
+		{
+			name: "two partitions",
+			srcs: srcs,
+			n:    2,
+			want: [][]string{
+				{"a/A1.java", "a/A2.java", "a/A3.java", "b/B1.java"},
+				{"c/C1.java", "c/C2.java", "d/D1.java"},
+			},
+		},
+		{
+			name: "three partitions",
+			srcs: srcs,
+			n:    3,
+			want: [][]string{
+				{"a/A1.java", "a/A2.java", "a/A3.java"},
+				{"b/B1.java", "c/C1.java", "c/C2.java"},
+				{"d/D1.java"},
+			},
+		},
+		{
+			name: "more partitions than packages",
+			srcs: srcs,
+			n:    10,
+			want: [][]string{
+				{"a/A1.java", "a/A2.java", "a/A3.java"},
+				{"b/B1.java"},
+				{"c/C1.java", "c/C2.java"},
+				{"d/D1.java"},
+			},
+		},
+		{
+			name: "no sources",
+			srcs: nil,
+			n:    2,
+			want: [][]string{nil},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got [][]string
+			for _, partition := range partitionSourcesByPackage(tc.srcs, tc.n) {
+				got = append(got, partition.Strings())
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("expected partitions %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDroidstubsPackagePartitions(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: [
+				"src/a/A.java",
+				"src/b/B.java",
+			],
+			package_partitions: 2,
+			partition_source_path: ["src"],
+			api_filename: "foo_api.txt",
+			removed_api_filename: "foo_removed.txt",
+		}
+		`,
+		map[string][]byte{
+			"src/a/A.java": nil,
+			"src/b/B.java": nil,
+		})
+
+	m := ctx.ModuleForTests("foo-stubs", "android_common")
+
+	// Each partition processes the sources of its package, and depends on the sources of the other
+	// partitions that it reads through the source path.
+	for i, src := range []string{"src/a/A.java", "src/b/B.java"} {
+		partition := strconv.Itoa(i)
+		rule := m.Rule("metalava_partition_" + partition)
+		android.AssertPathsRelativeToTopEquals(t, "partition "+partition+" sources", []string{src}, rule.Inputs)
+		implicits := android.PathsRelativeToTop(rule.Implicits)
+		android.AssertStringListContains(t, "partition "+partition+" inputs", implicits,
+			[]string{"src/b/B.java", "src/a/A.java"}[i])
+
+		manifest := android.RuleBuilderSboxProtoForTests(t, m.Output("metalava_partitions/"+partition+".sbox.textproto"))
+		android.AssertStringDoesContain(t, "partition "+partition+" command",
+			manifest.Commands[0].GetCommand(), "--source-path src")
+	}
+
+	for _, output := range []string{"metalava/foo_api.txt", "metalava/foo_removed.txt", "metalava/foo-stubs-stubs.srcjar"} {
+		merge := m.Output(output)
+		android.AssertStringDoesContain(t, output+" rule", merge.Rule.String(), "metalava_merge_partitions")
+	}
+
+	merge := m.Output("metalava/foo_api.txt")
+	for _, input := range []string{
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/0/api.txt",
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/1/api.txt",
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/0/removed.txt",
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/1/removed.txt",
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/0/stubs.srcjar",
+		"out/soong/.intermediates/foo-stubs/android_common/metalava_partitions/1/stubs.srcjar",
+	} {
+		android.AssertStringListContains(t, "merge inputs", merge.Implicits.Strings(), input)
+	}
+}
+
+func TestDroidstubsPackagePartitionsUnsupported(t *testing.T) {
+	testJavaError(t, `check_api.api_lint.enabled: cannot be combined with package_partitions`, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["src/a/A.java"],
+			package_partitions: 2,
+			check_api: {
+				api_lint: {
+					enabled: true,
+				},
+			},
+		}
+		`)
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// This file contains the check that no class is contributed with different contents by more than
+// one of the sources and static_libs of an app, which is enabled with the CheckDuplicateClasses
+// product variable. The jars are combined with --ignore-duplicates before they are dexed, so
+// without the check only the first of the classes is kept. A duplicate class is reported along with
+// the module that it was compiled in, which may be a transitive static lib of the app, and the
+// static_libs of the app that include it.
+
+// buildDuplicateClassesCheck adds a rule that checks the classes compiled from the sources of the
+// module, in jars, and the classes of its transitive static_libs, and returns the file it writes if
+// there are no duplicate classes.
+func (d *dexer) buildDuplicateClassesCheck(ctx android.ModuleContext, jars android.Paths) android.Path {
+	stamp := android.PathForModuleOut(ctx, "duplicate-classes.stamp")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().
+		BuiltTool("check_duplicate_classes").
+		FlagWithArg("--module ", ctx.ModuleName())
+	for _, jar := range jars {
+		cmd.FlagWithInput("--jar "+ctx.ModuleName()+"=", jar)
+	}
+	visited := make(map[android.Module]bool)
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		if ctx.OtherModuleDependencyTag(child) != staticLibTag {
+			return false
+		}
+		if parent != ctx.Module() {
+			// The jars of the parent include the classes of the child.
+			cmd.FlagWithArg("--static-lib ", ctx.OtherModuleName(parent)+"="+ctx.OtherModuleName(child))
+		}
+		if visited[child] {
+			return false
+		}
+		visited[child] = true
+
+		var depJars android.Paths
+		if ctx.OtherModuleHasProvider(child, JavaInfoProvider) {
+			depJars = ctx.OtherModuleProvider(child, JavaInfoProvider).(JavaInfo).ImplementationJars
+		} else if dep, ok := child.(android.SourceFileProducer); ok {
+			depJars = dep.Srcs()
+		}
+		for _, jar := range depJars {
+			cmd.FlagWithInput("--jar "+ctx.OtherModuleName(child)+"=", jar)
+		}
+		return true
+	})
+	for _, pattern := range d.allowedDuplicateClasses {
+		cmd.FlagWithArg("--allow ", proptools.ShellEscape(pattern))
+	}
+	cmd.FlagWithOutput("--stamp ", stamp)
+	rule.Build("duplicate_classes_check", "check duplicate classes of "+ctx.ModuleName())
+
+	return stamp
+}
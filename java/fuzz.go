@@ -15,19 +15,31 @@
 package java
 
 import (
-	"github.com/google/blueprint/proptools"
 	"sort"
 	"strings"
 
+	"github.com/google/blueprint/proptools"
+
 	"android/soong/android"
 	"android/soong/fuzz"
 )
 
+const (
+	// Name of the library containing the Jazzer API that java_fuzz targets are compiled against.
+	jazzerApiModule = "jazzer-api"
+	// Name of the library containing the Jazzer fuzzing engine that is packaged alongside
+	// java_fuzz targets.
+	jazzerRuntimeModule = "jazzer"
+)
+
+var jazzerRuntimeTag = dependencyTag{name: "jazzer-runtime"}
+
 func init() {
 	RegisterJavaFuzzBuildComponents(android.InitRegistrationContext)
 }
 
 func RegisterJavaFuzzBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("java_fuzz", JavaFuzzFactory)
 	ctx.RegisterModuleType("java_fuzz_host", FuzzFactory)
 	ctx.RegisterSingletonType("java_fuzz_packaging", javaFuzzPackagingFactory)
 }
@@ -35,11 +47,41 @@ func RegisterJavaFuzzBuildComponents(ctx android.RegistrationContext) {
 type JavaFuzzLibrary struct {
 	Library
 	fuzzPackagedModule fuzz.FuzzPackagedModule
+
+	// true if the module depends on the Jazzer API and runtime, i.e. it is a java_fuzz module.
+	useJazzer bool
+
+	// the Jazzer runtime jar to package alongside the fuzz target.
+	jazzerRuntime android.Path
+}
+
+func (j *JavaFuzzLibrary) DepsMutator(ctx android.BottomUpMutatorContext) {
+	j.Library.DepsMutator(ctx)
+	if j.useJazzer {
+		ctx.AddVariationDependencies(nil, libTag, jazzerApiModule)
+		ctx.AddVariationDependencies(nil, jazzerRuntimeTag, jazzerRuntimeModule)
+	}
 }
 
 func (j *JavaFuzzLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	j.Library.GenerateAndroidBuildActions(ctx)
 
+	ctx.VisitDirectDepsWithTag(jazzerRuntimeTag, func(module android.Module) {
+		if ctx.Host() {
+			dep := ctx.OtherModuleProvider(module, JavaInfoProvider).(JavaInfo)
+			if len(dep.ImplementationAndResourcesJars) != 1 {
+				ctx.ModuleErrorf("expected a single jar from %s, got %s",
+					ctx.OtherModuleName(module), dep.ImplementationAndResourcesJars)
+				return
+			}
+			j.jazzerRuntime = dep.ImplementationAndResourcesJars[0]
+		} else if dep, ok := module.(UsesLibraryDependency); ok && dep.DexJarBuildPath().Valid() {
+			j.jazzerRuntime = dep.DexJarBuildPath().Path()
+		} else {
+			ctx.ModuleErrorf("%s does not provide a dex jar", ctx.OtherModuleName(module))
+		}
+	})
+
 	if j.fuzzPackagedModule.FuzzProperties.Corpus != nil {
 		j.fuzzPackagedModule.Corpus = android.PathsForModuleSrc(ctx, j.fuzzPackagedModule.FuzzProperties.Corpus)
 	}
@@ -87,6 +129,39 @@ func FuzzFactory() android.Module {
 	return module
 }
 
+// java_fuzz builds and links sources against the Jazzer API into a `.jar` file for the device,
+// and for the host if host_supported is set.
+//
+// The fuzz target is packaged together with the Jazzer runtime, its corpus, dictionary and
+// fuzz config into the java fuzz package of the corresponding target. On the device the
+// fuzz target and the runtime are dex jars.
+func JavaFuzzFactory() android.Module {
+	module := &JavaFuzzLibrary{useJazzer: true}
+
+	module.addHostAndDeviceProperties()
+	module.Module.properties.Installable = proptools.BoolPtr(false)
+	module.Module.dexProperties.Compile_dex = proptools.BoolPtr(true)
+	module.AddProperties(&module.fuzzPackagedModule.FuzzProperties)
+
+	// java_fuzz packaging rules collide when both linux_glibc and linux_bionic are enabled, disable the linux_bionic variants.
+	android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+		disableLinuxBionic := struct {
+			Target struct {
+				Linux_bionic struct {
+					Enabled *bool
+				}
+			}
+		}{}
+		disableLinuxBionic.Target.Linux_bionic.Enabled = proptools.BoolPtr(false)
+		ctx.AppendProperties(&disableLinuxBionic)
+	})
+
+	module.initModuleAndImport(module)
+	android.InitSdkAwareModule(module)
+	InitJavaModuleMultiTargets(module, android.HostAndDeviceSupported)
+	return module
+}
+
 // Responsible for generating rules that package fuzz targets into
 // their architecture & target/host specific zip file.
 type javaFuzzPackager struct {
@@ -117,7 +192,7 @@ func (s *javaFuzzPackager) GenerateBuildActions(ctx android.SingletonContext) {
 			javaModule.ApexModuleBase,
 		}
 
-		if ok := fuzz.IsValid(fuzzModuleValidator); !ok || *javaModule.Module.properties.Installable {
+		if ok := fuzz.IsValid(fuzzModuleValidator); !ok || Bool(javaModule.Module.properties.Installable) {
 			return
 		}
 
@@ -139,7 +214,12 @@ func (s *javaFuzzPackager) GenerateBuildActions(ctx android.SingletonContext) {
 		// Add .jar
 		files = append(files, fuzz.FileToZip{javaModule.outputFile, ""})
 
-		archDirs[archOs], ok = s.BuildZipFile(ctx, module, javaModule.fuzzPackagedModule, files, builder, archDir, archString, "host", archOs, archDirs)
+		// Add the Jazzer runtime
+		if javaModule.jazzerRuntime != nil {
+			files = append(files, fuzz.FileToZip{javaModule.jazzerRuntime, ""})
+		}
+
+		archDirs[archOs], ok = s.BuildZipFile(ctx, module, javaModule.fuzzPackagedModule, files, builder, archDir, archString, hostOrTargetString, archOs, archDirs)
 		if !ok {
 			return
 		}
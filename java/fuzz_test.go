@@ -22,7 +22,6 @@ import (
 
 var prepForJavaFuzzTest = android.GroupFixturePreparers(
 	PrepareForTestWithJavaDefaultModules,
-	android.FixtureRegisterWithContext(RegisterJavaFuzzBuildComponents),
 )
 
 func TestJavaFuzz(t *testing.T) {
@@ -63,3 +62,54 @@ func TestJavaFuzz(t *testing.T) {
 		t.Errorf("foo combineJar inputs %v does not contain %q", combineJar.Inputs, baz)
 	}
 }
+
+func TestJavaFuzzJazzer(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepForJavaFuzzTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"corpus/a": nil,
+			"foo.dict": nil,
+		}),
+	).RunTestWithBp(t, `
+		java_fuzz {
+			name: "foo",
+			srcs: ["a.java"],
+			host_supported: true,
+			corpus: ["corpus/a"],
+			dictionary: "foo.dict",
+		}
+
+		java_library {
+			name: "jazzer-api",
+			srcs: ["b.java"],
+			host_supported: true,
+		}
+
+		java_library {
+			name: "jazzer",
+			srcs: ["c.java"],
+			host_supported: true,
+			compile_dex: true,
+		}`)
+
+	osCommonTarget := result.Config.BuildOSCommonTarget.String()
+	for _, variant := range []string{"android_common", osCommonTarget} {
+		javac := result.ModuleForTests("foo", variant).Rule("javac")
+		apiOut := filepath.Join("out", "soong", ".intermediates", "jazzer-api", variant, "turbine-combined", "jazzer-api.jar")
+		android.AssertStringDoesContain(t, "foo classpath for "+variant, javac.Args["classpath"], apiOut)
+	}
+
+	packaging := result.SingletonForTests("java_fuzz_packaging")
+
+	hostZip := packaging.Output("out/soong/.intermediates/fuzz/host/common/foo.zip")
+	hostRuntime := result.ModuleForTests("jazzer", osCommonTarget).Module().(*Library).ImplementationAndResourcesJars()[0]
+	android.AssertStringListContains(t, "host fuzz zip inputs", hostZip.Implicits.Strings(), hostRuntime.String())
+	android.AssertStringListContains(t, "host fuzz zip inputs", hostZip.Implicits.Strings(), "foo.dict")
+	packaging.Output("out/soong/.intermediates/fuzz/host/common/foo_seed_corpus.zip")
+
+	deviceZip := packaging.Output("out/soong/.intermediates/fuzz/target/common/foo.zip")
+	deviceRuntime := result.ModuleForTests("jazzer", "android_common").Module().(*Library).DexJarBuildPath().Path()
+	android.AssertStringListContains(t, "device fuzz zip inputs", deviceZip.Implicits.Strings(), deviceRuntime.String())
+	fooDex := result.ModuleForTests("foo", "android_common").Module().(*JavaFuzzLibrary).outputFile
+	android.AssertStringListContains(t, "device fuzz zip inputs", deviceZip.Implicits.Strings(), fooDex.String())
+}
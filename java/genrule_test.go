@@ -116,3 +116,43 @@ func TestJarGenrules(t *testing.T) {
 			barCombined.Inputs.Strings(), bar.Output.String(), jargen.Output.String())
 	}
 }
+
+func TestGenruleJavaBinaryToolRuntimeDeps(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_binary_host {
+			name: "tool",
+			srcs: ["a.java"],
+			main_class: "foo.Main",
+		}
+
+		java_genrule {
+			name: "gen",
+			tools: ["tool"],
+			cmd: "$(location tool) $(out)",
+			out: ["gen.txt"],
+		}
+
+		java_genrule {
+			name: "gen_no_runtime_deps",
+			tools: ["tool"],
+			cmd: "$(location tool) $(out)",
+			out: ["gen.txt"],
+			tool_runtime_deps: false,
+		}
+	`)
+
+	// The wrapper runs the installed jar.
+	toolJar := ctx.Config().HostJavaToolPath(android.PathContextForTesting(ctx.Config()), "tool.jar")
+	buildOS := ctx.Config().BuildOS.String()
+	tool := ctx.ModuleForTests("tool", buildOS+"_x86_64").Module()
+	runtimeDeps := ctx.ModuleProvider(tool, android.HostToolRuntimeDepsInfoProvider).(android.HostToolRuntimeDepsInfo)
+	android.AssertPathsRelativeToTopEquals(t, "tool runtime deps",
+		[]string{"out/soong/host/linux-x86/framework/tool.jar"}, runtimeDeps.Deps)
+
+	gen := ctx.ModuleForTests("gen", "android_common").Output("gen.txt")
+	android.AssertStringListContains(t, "gen implicits", gen.Implicits.Strings(), toolJar.String())
+
+	genNoRuntimeDeps := ctx.ModuleForTests("gen_no_runtime_deps", "android_common").Output("gen.txt")
+	android.AssertStringListDoesNotContain(t, "gen_no_runtime_deps implicits",
+		genNoRuntimeDeps.Implicits.Strings(), toolJar.String())
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// Golden assets are the large files, e.g. screenshots, that UI tests compare their results
+// against. A test_golden_assets module packages them content-addressed: each asset is stored once
+// as assets/<sha256> in the zip of the module, and manifests/<module>.tsv maps the logical name of
+// each asset to its hash, one "<logical name>\t<sha256>" line per asset. Tests reference the
+// manifest from their data property, so the assets are not packaged next to every test.
+//
+// The golden_assets singleton merges the zips of all the test_golden_assets modules of a test
+// suite into ${OUT_DIR}/soong/golden_assets/<suite>-golden-assets.zip, where the assets shared by
+// several tests are stored only once, and which is the only place the assets are shipped.
+
+func init() {
+	registerGoldenAssetsBuildComponents(android.InitRegistrationContext)
+}
+
+func registerGoldenAssetsBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("test_golden_assets", GoldenAssetsFactory)
+	ctx.RegisterSingletonType("golden_assets", goldenAssetsSingletonFactory)
+}
+
+var PrepareForTestWithGoldenAssets = android.FixtureRegisterWithContext(registerGoldenAssetsBuildComponents)
+
+// GoldenAssetsInfo contains the golden assets packaged by a test_golden_assets module.
+type GoldenAssetsInfo struct {
+	// Assets maps the logical names of the assets to their source files.
+	Assets map[string]android.Path
+
+	// Manifest is the file mapping the logical names of the assets to their hashes.
+	Manifest android.Path
+
+	// Zip is the content-addressed zip of the assets, including the manifest.
+	Zip android.Path
+
+	// TestSuites is the list of test suites the assets are packaged into.
+	TestSuites []string
+}
+
+var GoldenAssetsInfoProvider = blueprint.NewProvider(GoldenAssetsInfo{})
+
+type goldenAssetsProperties struct {
+	// The golden assets. The logical name of an asset is its path relative to the module
+	// directory.
+	Srcs []string `android:"path"`
+
+	// List of test suites the assets are packaged into.
+	Test_suites []string
+}
+
+type goldenAssets struct {
+	android.ModuleBase
+
+	properties goldenAssetsProperties
+
+	manifest android.WritablePath
+	zip      android.WritablePath
+}
+
+var _ android.OutputFileProducer = (*goldenAssets)(nil)
+
+// test_golden_assets packages golden assets for UI tests, content-addressed so that the assets
+// shared by several tests are stored only once in the test suites.
+func GoldenAssetsFactory() android.Module {
+	module := &goldenAssets{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidModule(module)
+	return module
+}
+
+func (g *goldenAssets) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	srcs := android.PathsForModuleSrc(ctx, g.properties.Srcs)
+	if len(srcs) == 0 {
+		ctx.PropertyErrorf("srcs", "must not be empty")
+		return
+	}
+
+	assets := make(map[string]android.Path)
+	for _, src := range srcs {
+		assets[src.Rel()] = src
+	}
+	names := android.SortedStringKeys(assets)
+
+	stagingDir := android.PathForModuleOut(ctx, "golden_assets")
+	stagedManifest := stagingDir.Join(ctx, "manifests", ctx.ModuleName()+".tsv")
+	g.manifest = android.PathForModuleOut(ctx, ctx.ModuleName()+".tsv")
+	g.zip = android.PathForModuleOut(ctx, ctx.ModuleName()+".zip")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().Text("rm -rf").Text(stagingDir.String())
+	rule.Command().Text("mkdir -p").
+		Text(stagingDir.Join(ctx, "assets").String()).
+		Text(stagingDir.Join(ctx, "manifests").String())
+	for _, name := range names {
+		rule.Command().
+			Text("hash=$(sha256sum").Input(assets[name]).Text("| cut -d ' ' -f 1) &&").
+			Text("cp -f").Input(assets[name]).Textf("%s/assets/${hash} &&", stagingDir).
+			Textf(`printf '%%s\t%%s\n' %s "${hash}" >>`, proptools.ShellEscape(name)).
+			Text(stagedManifest.String())
+	}
+	rule.Command().Text("cp -f").Text(stagedManifest.String()).Output(g.manifest)
+	rule.Command().
+		BuiltTool("soong_zip").
+		FlagWithOutput("-o ", g.zip).
+		FlagWithArg("-C ", stagingDir.String()).
+		FlagWithArg("-D ", stagingDir.String())
+	rule.Command().Text("rm -rf").Text(stagingDir.String())
+	rule.Build("golden_assets", "golden assets "+ctx.ModuleName())
+
+	ctx.SetProvider(GoldenAssetsInfoProvider, GoldenAssetsInfo{
+		Assets:     assets,
+		Manifest:   g.manifest,
+		Zip:        g.zip,
+		TestSuites: android.SortedUniqueStrings(g.properties.Test_suites),
+	})
+}
+
+func (g *goldenAssets) OutputFiles(tag string) (android.Paths, error) {
+	switch tag {
+	case "":
+		return android.Paths{g.manifest}, nil
+	case ".zip":
+		return android.Paths{g.zip}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
+
+func goldenAssetsSingletonFactory() android.Singleton {
+	return &goldenAssetsSingleton{}
+}
+
+type goldenAssetsSingleton struct {
+	suiteZips map[string]android.WritablePath
+}
+
+func (s *goldenAssetsSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	zipsBySuite := make(map[string]android.Paths)
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() || !ctx.ModuleHasProvider(m, GoldenAssetsInfoProvider) {
+			return
+		}
+		info := ctx.ModuleProvider(m, GoldenAssetsInfoProvider).(GoldenAssetsInfo)
+		for _, suite := range info.TestSuites {
+			zipsBySuite[suite] = append(zipsBySuite[suite], info.Zip)
+		}
+	})
+	if len(zipsBySuite) == 0 {
+		return
+	}
+
+	s.suiteZips = make(map[string]android.WritablePath)
+	var allZips android.Paths
+	for _, suite := range android.SortedStringKeys(zipsBySuite) {
+		zips := android.SortedUniquePaths(zipsBySuite[suite])
+		suiteZip := android.PathForOutput(ctx, "golden_assets", suite+"-golden-assets.zip")
+
+		// merge_zips keeps a single copy of the entries with the same name and content, which are
+		// the assets shared by several tests.
+		rule := android.NewRuleBuilder(pctx, ctx)
+		rule.Command().
+			BuiltTool("merge_zips").
+			Output(suiteZip).
+			Inputs(zips)
+		rule.Build("golden_assets_"+suite, "golden assets "+suite)
+
+		s.suiteZips[suite] = suiteZip
+		allZips = append(allZips, suiteZip)
+	}
+	ctx.Phony("golden-assets", allZips...)
+}
+
+func (s *goldenAssetsSingleton) MakeVars(ctx android.MakeVarsContext) {
+	for _, suite := range android.SortedStringKeys(s.suiteZips) {
+		ctx.DistForGoal(suite, s.suiteZips[suite])
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*goldenAssetsSingleton)(nil)
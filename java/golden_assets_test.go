@@ -0,0 +1,99 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+var prepareForGoldenAssetsTest = android.GroupFixturePreparers(
+	PrepareForTestWithJavaDefaultModules,
+	PrepareForTestWithGoldenAssets,
+	android.FixtureMergeMockFs(android.MockFS{
+		"foo/goldens/home.png":     nil,
+		"foo/goldens/settings.png": nil,
+		"bar/a.java":               nil,
+		"bar/goldens/home.png":     nil,
+	}),
+)
+
+func TestGoldenAssets(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForGoldenAssetsTest,
+		android.FixtureAddTextFile("foo/Android.bp", `
+			test_golden_assets {
+				name: "foo_goldens",
+				srcs: ["goldens/*.png"],
+				test_suites: ["device-tests", "general-tests"],
+			}
+		`),
+		android.FixtureAddTextFile("bar/Android.bp", `
+			test_golden_assets {
+				name: "bar_goldens",
+				srcs: ["goldens/home.png"],
+				test_suites: ["device-tests"],
+			}
+
+			android_test {
+				name: "BarTests",
+				srcs: ["a.java"],
+				data: [":bar_goldens"],
+				sdk_version: "current",
+			}
+		`),
+	).RunTest(t)
+
+	foo := result.ModuleForTests("foo_goldens", "")
+	info := result.ModuleProvider(foo.Module(), GoldenAssetsInfoProvider).(GoldenAssetsInfo)
+	android.AssertPathsRelativeToTopEquals(t, "assets",
+		[]string{"foo/goldens/home.png", "foo/goldens/settings.png"},
+		android.Paths{info.Assets["goldens/home.png"], info.Assets["goldens/settings.png"]})
+	android.AssertPathRelativeToTopEquals(t, "zip",
+		"out/soong/.intermediates/foo/foo_goldens/foo_goldens.zip", info.Zip)
+	android.AssertDeepEquals(t, "test suites", []string{"device-tests", "general-tests"}, info.TestSuites)
+
+	command := foo.Rule("golden_assets").RuleParams.Command
+	android.AssertStringDoesContain(t, "stores assets by hash", command,
+		"cp -f foo/goldens/settings.png out/soong/.intermediates/foo/foo_goldens/golden_assets/assets/$${hash}")
+	android.AssertStringDoesContain(t, "maps logical names to hashes", command,
+		`printf '%s\t%s\n' goldens/settings.png "$${hash}" >> out/soong/.intermediates/foo/foo_goldens/golden_assets/manifests/foo_goldens.tsv`)
+
+	data := result.ModuleForTests("BarTests", "android_common").Module().(*AndroidTest).data
+	android.AssertPathsRelativeToTopEquals(t, "test data",
+		[]string{"out/soong/.intermediates/bar/bar_goldens/bar_goldens.tsv"}, data)
+
+	singleton := result.SingletonForTests("golden_assets")
+	deviceTests := singleton.Output("out/soong/golden_assets/device-tests-golden-assets.zip")
+	android.AssertPathsRelativeToTopEquals(t, "device-tests inputs", []string{
+		"out/soong/.intermediates/bar/bar_goldens/bar_goldens.zip",
+		"out/soong/.intermediates/foo/foo_goldens/foo_goldens.zip",
+	}, deviceTests.Inputs)
+	generalTests := singleton.Output("out/soong/golden_assets/general-tests-golden-assets.zip")
+	android.AssertPathsRelativeToTopEquals(t, "general-tests inputs", []string{
+		"out/soong/.intermediates/foo/foo_goldens/foo_goldens.zip",
+	}, generalTests.Inputs)
+}
+
+func TestGoldenAssetsNoSrcs(t *testing.T) {
+	prepareForGoldenAssetsTest.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(`srcs: must not be empty`)).
+		RunTestWithBp(t, `
+			test_golden_assets {
+				name: "foo_goldens",
+			}
+		`)
+}
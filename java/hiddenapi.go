@@ -47,6 +47,22 @@ type hiddenAPI struct {
 	// The compressed state of the dex file being encoded. This is used to ensure that the encoded
 	// dex file has the same state.
 	uncompressDexState *bool
+
+	hiddenAPIProperties hiddenAPIProperties
+
+	// The paths to the flag override files resolved from hiddenAPIProperties.
+	flagOverridesByCategory FlagFilesByCategory
+}
+
+// hiddenAPIProperties contains the properties of a module that contribute to the hidden API
+// processing of the bootclasspath_fragment that contains it. They are only added to the module
+// types that can be boot jars, and are ignored by host variants.
+type hiddenAPIProperties struct {
+	// Flag files that override the flags of the members of this module. They are merged into the
+	// flags of the bootclasspath_fragment that lists this module in its contents, and into the
+	// monolithic flags, along with the flag files specified by the bootclasspath_fragment itself. A
+	// signature must not be given conflicting flags by any of those files.
+	Hiddenapi_flag_overrides HiddenAPIFlagFileProperties
 }
 
 func (h *hiddenAPI) bootDexJar() OptionalDexJarPath {
@@ -61,6 +77,10 @@ func (h *hiddenAPI) uncompressDex() *bool {
 	return h.uncompressDexState
 }
 
+func (h *hiddenAPI) flagOverrides() FlagFilesByCategory {
+	return h.flagOverridesByCategory
+}
+
 // hiddenAPIModule is the interface a module that embeds the hiddenAPI structure must implement.
 type hiddenAPIModule interface {
 	android.Module
@@ -73,6 +93,7 @@ type hiddenAPIIntf interface {
 	bootDexJar() OptionalDexJarPath
 	classesJars() android.Paths
 	uncompressDex() *bool
+	flagOverrides() FlagFilesByCategory
 }
 
 var _ hiddenAPIIntf = (*hiddenAPI)(nil)
@@ -98,6 +119,18 @@ func (h *hiddenAPI) initHiddenAPI(ctx android.ModuleContext, dexJar OptionalDexJ
 
 	h.uncompressDexState = uncompressedDexState
 
+	// Resolve the flag override files so that they can be merged into the flags of the
+	// bootclasspath_fragment that contains this. Only device variants can be boot jars.
+	h.flagOverridesByCategory = FlagFilesByCategory{}
+	if ctx.Device() {
+		for _, category := range HiddenAPIFlagFileCategories {
+			paths := android.PathsForModuleSrc(ctx, category.propertyValueReader(&h.hiddenAPIProperties.Hiddenapi_flag_overrides))
+			if len(paths) > 0 {
+				h.flagOverridesByCategory[category] = paths
+			}
+		}
+	}
+
 	// If hiddenapi processing is disabled treat this as inactive.
 	if ctx.Config().IsEnvTrue("UNSAFE_DISABLE_HIDDENAPI_FLAGS") {
 		return
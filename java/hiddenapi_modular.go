@@ -417,6 +417,11 @@ type hiddenAPIFlagFileCategory struct {
 	// commandMutator adds the appropriate command line options for this category to the supplied
 	// command
 	commandMutator func(command *android.RuleBuilderCommand, path android.Path)
+
+	// excludeFromConflictCheck is true if the files in this category are not checked for conflicts
+	// with the files in other categories, either because conflicts are ignored or because the files
+	// do not contain signatures.
+	excludeFromConflictCheck bool
 }
 
 // The flag file category for removed members of the API.
@@ -433,6 +438,7 @@ var hiddenAPIRemovedFlagFileCategory = &hiddenAPIFlagFileCategory{
 	commandMutator: func(command *android.RuleBuilderCommand, path android.Path) {
 		command.FlagWithInput("--unsupported ", path).Flag("--ignore-conflicts ").FlagWithArg("--tag ", "removed")
 	},
+	excludeFromConflictCheck: true,
 }
 
 var HiddenAPIFlagFileCategories = []*hiddenAPIFlagFileCategory{
@@ -486,6 +492,7 @@ var HiddenAPIFlagFileCategories = []*hiddenAPIFlagFileCategory{
 		commandMutator: func(command *android.RuleBuilderCommand, path android.Path) {
 			command.FlagWithInput("--max-target-o ", path).Flag("--ignore-conflicts ").FlagWithArg("--tag ", "lo-prio")
 		},
+		excludeFromConflictCheck: true,
 	},
 	// See HiddenAPIFlagFileProperties.Blocked
 	{
@@ -506,6 +513,7 @@ var HiddenAPIFlagFileCategories = []*hiddenAPIFlagFileCategory{
 		commandMutator: func(command *android.RuleBuilderCommand, path android.Path) {
 			command.FlagWithInput("--unsupported ", path).Flag("--packages ")
 		},
+		excludeFromConflictCheck: true,
 	},
 }
 
@@ -528,6 +536,10 @@ type HiddenAPIInfo struct {
 	// that category.
 	FlagFilesByCategory FlagFilesByCategory
 
+	// FlagOverrideFiles contains the flag files in FlagFilesByCategory that were provided by the
+	// contents of the fragment, see hiddenAPIProperties.Hiddenapi_flag_overrides.
+	FlagOverrideFiles android.Paths
+
 	// The paths to the stub dex jars for each of the *HiddenAPIScope in hiddenAPIScopes provided by
 	// this fragment and the fragments on which this depends.
 	TransitiveStubDexJarsByScope StubDexJarsByModule
@@ -693,6 +705,10 @@ type HiddenAPIFlagInput struct {
 	// from the stub dex files.
 	FlagFilesByCategory FlagFilesByCategory
 
+	// FlagOverrideFiles contains the flag files in FlagFilesByCategory that were provided by the
+	// contents of the fragment rather than by the fragment's own properties.
+	FlagOverrideFiles android.Paths
+
 	// StubDexJarsByScope contains the stub dex jars for different *HiddenAPIScope and which determine
 	// the initial flags for each dex member.
 	StubDexJarsByScope StubDexJarsByModule
@@ -782,6 +798,20 @@ func (i *HiddenAPIFlagInput) extractFlagFilesFromProperties(ctx android.ModuleCo
 	}
 }
 
+// gatherFlagOverrides gathers the flag override files provided by the supplied contents and adds them
+// to the flag files in this struct.
+func (i *HiddenAPIFlagInput) gatherFlagOverrides(contents []android.Module) {
+	for _, module := range contents {
+		if hiddenAPIModule, ok := module.(hiddenAPIModule); ok {
+			overrides := hiddenAPIModule.flagOverrides()
+			i.FlagFilesByCategory.append(overrides)
+			for _, category := range HiddenAPIFlagFileCategories {
+				i.FlagOverrideFiles = append(i.FlagOverrideFiles, overrides[category]...)
+			}
+		}
+	}
+}
+
 func (i *HiddenAPIFlagInput) transitiveStubDexJarsByScope() StubDexJarsByModule {
 	transitive := i.DependencyStubDexJarsByScope
 	transitive.addStubDexJarsByModule(i.StubDexJarsByScope)
@@ -879,9 +909,14 @@ func pathForValidation(ctx android.PathContext, path android.WritablePath) andro
 //
 // hiddenAPIInfo is a struct containing paths to files that augment the information provided by
 // the annotationFlags.
+//
+// flagOverrideFiles are the flag files in flagFilesByCategory that were provided by modules rather
+// than by a bootclasspath_fragment or platform_bootclasspath. If there are any then all the flag
+// files are checked to make sure that they do not specify conflicting flags for a signature.
 func buildRuleToGenerateHiddenApiFlags(ctx android.BuilderContext, name, desc string,
 	outputPath android.WritablePath, baseFlagsPath android.Path, annotationFlagPaths android.Paths,
-	flagFilesByCategory FlagFilesByCategory, flagSubsets SignatureCsvSubsets, generatedRemovedDexSignatures android.OptionalPath) {
+	flagFilesByCategory FlagFilesByCategory, flagOverrideFiles android.Paths, flagSubsets SignatureCsvSubsets,
+	generatedRemovedDexSignatures android.OptionalPath) {
 
 	// Create the rule that will generate the flag files.
 	tempPath := tempPathForRestat(ctx, outputPath)
@@ -921,9 +956,54 @@ func buildRuleToGenerateHiddenApiFlags(ctx android.BuilderContext, name, desc st
 		command.Validation(validFile)
 	}
 
+	// If any of the flag files were provided by modules then check that they do not conflict with
+	// each other or with the other flag files.
+	if len(flagOverrideFiles) > 0 {
+		validFile := buildRuleValidateFlagFileConflicts(ctx, name, desc, outputPath, flagFilesByCategory)
+		command.Validation(validFile)
+	}
+
 	rule.Build(name, desc)
 }
 
+// buildRuleValidateFlagFileConflicts checks that no signature is listed in flag files of more than
+// one category, ignoring those categories that are excluded from the conflict check.
+//
+// It returns the path to a file that is created if there are no conflicts.
+func buildRuleValidateFlagFileConflicts(ctx android.BuilderContext, name, desc string,
+	flagsPath android.WritablePath, flagFilesByCategory FlagFilesByCategory) android.WritablePath {
+	validFile := flagsPath.ReplaceExtension(ctx, "flag-overrides.valid")
+	conflicts := flagsPath.ReplaceExtension(ctx, "flag-overrides.conflicts")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+
+	// Output one line of <signature>,<category> for every signature in every category and then report
+	// any signature that appears in more than one category.
+	command := rule.Command().Text("(")
+	for _, category := range HiddenAPIFlagFileCategories {
+		if category.excludeFromConflictCheck {
+			continue
+		}
+		for _, path := range flagFilesByCategory[category] {
+			command.Text("grep -v '^#'").Input(path).
+				Textf("| sed -e 's/,.*//' -e 's/$/,%s/';", category.PropertyName)
+		}
+	}
+	command.Text(") | sort -u | cut -d, -f1 | sort | uniq -d >").Output(conflicts)
+
+	rule.Command().
+		Text("if [ -s").Input(conflicts).Text("]; then").
+		Text(`echo "The following signatures are given conflicting flags by the hidden API flag files:" >&2;`).
+		Text("cat").Input(conflicts).Text(">&2;").
+		Text("exit 1;").
+		Text("fi")
+	rule.Command().Text("touch").Output(validFile)
+
+	rule.Build(name+"FlagOverrides", desc+" flag override conflicts")
+
+	return validFile
+}
+
 // SignatureCsvSubset describes a subset of a monolithic flags file, i.e. either
 // out/soong/hiddenapi/hiddenapi-stub-flags.txt or out/soong/hiddenapi/hiddenapi-flags.csv
 type SignatureCsvSubset struct {
@@ -1096,7 +1176,7 @@ func hiddenAPIRulesForBootclasspathFragment(ctx android.ModuleContext, contents
 	// Generate the all-flags.csv which are the flags that will, in future, be encoded into the dex
 	// files.
 	allFlagsCSV := android.PathForModuleOut(ctx, hiddenApiSubDir, "all-flags.csv")
-	buildRuleToGenerateHiddenApiFlags(ctx, "modularHiddenApiAllFlags", "modular hiddenapi all flags", allFlagsCSV, stubFlagsCSV, android.Paths{annotationFlagsCSV}, input.FlagFilesByCategory, nil, removedDexSignatures)
+	buildRuleToGenerateHiddenApiFlags(ctx, "modularHiddenApiAllFlags", "modular hiddenapi all flags", allFlagsCSV, stubFlagsCSV, android.Paths{annotationFlagsCSV}, input.FlagFilesByCategory, input.FlagOverrideFiles, nil, removedDexSignatures)
 
 	// Encode the flags into the boot dex files.
 	encodedBootDexJarsByModule := map[string]android.Path{}
@@ -29,6 +29,10 @@ type MonolithicHiddenAPIInfo struct {
 	// that category.
 	FlagsFilesByCategory FlagFilesByCategory
 
+	// The flag files in FlagsFilesByCategory that were provided by the contents of the
+	// bootclasspath_fragment modules.
+	FlagOverrideFiles android.Paths
+
 	// The paths to the generated annotation-flags.csv files.
 	AnnotationFlagsPaths android.Paths
 
@@ -65,6 +69,15 @@ func newMonolithicHiddenAPIInfo(ctx android.ModuleContext, flagFilesByCategory F
 			classesJars := retrieveClassesJarsFromModule(e.Module())
 			monolithicInfo.ClassesJars = append(monolithicInfo.ClassesJars, classesJars...)
 
+			// Libraries that are not in a fragment provide their flag override files directly.
+			if hiddenAPIModule, ok := e.Module().(hiddenAPIModule); ok {
+				overrides := hiddenAPIModule.flagOverrides()
+				monolithicInfo.FlagsFilesByCategory.append(overrides)
+				for _, category := range HiddenAPIFlagFileCategories {
+					monolithicInfo.FlagOverrideFiles = append(monolithicInfo.FlagOverrideFiles, overrides[category]...)
+				}
+			}
+
 		case *ClasspathFragmentElement:
 			fragment := e.Module()
 			if ctx.OtherModuleHasProvider(fragment, HiddenAPIInfoProvider) {
@@ -82,6 +95,7 @@ func newMonolithicHiddenAPIInfo(ctx android.ModuleContext, flagFilesByCategory F
 // append appends all the files from the supplied info to the corresponding files in this struct.
 func (i *MonolithicHiddenAPIInfo) append(other *HiddenAPIInfo) {
 	i.FlagsFilesByCategory.append(other.FlagFilesByCategory)
+	i.FlagOverrideFiles = append(i.FlagOverrideFiles, other.FlagOverrideFiles...)
 	i.AnnotationFlagsPaths = append(i.AnnotationFlagsPaths, other.AnnotationFlagsPath)
 	i.MetadataPaths = append(i.MetadataPaths, other.MetadataPath)
 	i.IndexPaths = append(i.IndexPaths, other.IndexPath)
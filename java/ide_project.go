@@ -0,0 +1,115 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"android/soong/android"
+
+	"github.com/google/blueprint"
+)
+
+// The java_ide_project singleton writes the project metadata of every java module to
+// ${OUT_DIR}/soong/java_ide_project.json, for IDE sync plugins that generate Gradle or IDEA
+// projects. Unlike module_bp_java_deps.json written by the jdeps_generator singleton, which merges
+// the variants of a module, it lists every variant of a module separately with what was actually
+// passed to the compilers:
+//  - the source files and srcjars, and the directories of the generated source files,
+//  - the bootclasspath resolved from sdk_version, including the jars of the system modules,
+//  - the classpath,
+//  - the java version and the kotlinc flags.
+// The file is only generated when SOONG_COLLECT_JAVA_IDE_PROJECT is set, as its content is part of
+// the ninja file, and is built by the java-ide-project goal.
+
+func init() {
+	registerIdeProjectBuildComponents(android.InitRegistrationContext)
+}
+
+func registerIdeProjectBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("java_ide_project", ideProjectSingletonFactory)
+}
+
+var PrepareForTestWithIdeProject = android.FixtureRegisterWithContext(registerIdeProjectBuildComponents)
+
+// ideProjectInfo is the project metadata of a variant of a java module.
+type ideProjectInfo struct {
+	Variant            string   `json:"variant"`
+	Sdk_version        string   `json:"sdk_version,omitempty"`
+	Java_version       string   `json:"java_version,omitempty"`
+	Srcs               []string `json:"srcs,omitempty"`
+	Srcjars            []string `json:"srcjars,omitempty"`
+	Generated_src_dirs []string `json:"generated_src_dirs,omitempty"`
+	Bootclasspath      []string `json:"bootclasspath,omitempty"`
+	Classpath          []string `json:"classpath,omitempty"`
+	Kotlinc_flags      []string `json:"kotlinc_flags,omitempty"`
+	Output_jar         string   `json:"output_jar,omitempty"`
+}
+
+var ideProjectInfoProvider = blueprint.NewProvider(ideProjectInfo{})
+
+// generatedSrcDirs returns the directories of the source files that were generated by the build.
+func generatedSrcDirs(srcs android.Paths) []string {
+	var dirs []string
+	for _, src := range srcs {
+		if _, ok := src.(android.WritablePath); ok {
+			dirs = append(dirs, filepath.Dir(src.String()))
+		}
+	}
+	return android.FirstUniqueStrings(dirs)
+}
+
+func ideProjectSingletonFactory() android.Singleton {
+	return &ideProjectSingleton{}
+}
+
+type ideProjectSingleton struct {
+	project android.WritablePath
+}
+
+func (s *ideProjectSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !ctx.Config().IsEnvTrue("SOONG_COLLECT_JAVA_IDE_PROJECT") {
+		return
+	}
+
+	modules := make(map[string][]ideProjectInfo)
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() || !ctx.ModuleHasProvider(m, ideProjectInfoProvider) {
+			return
+		}
+		info := ctx.ModuleProvider(m, ideProjectInfoProvider).(ideProjectInfo)
+		info.Variant = ctx.ModuleSubDir(m)
+		name := ctx.ModuleName(m)
+		modules[name] = append(modules[name], info)
+	})
+
+	project, err := json.MarshalIndent(modules, "", "  ")
+	if err != nil {
+		ctx.Errorf("JSON marshal of the java IDE project failed: %s", err)
+		return
+	}
+	s.project = android.PathForOutput(ctx, "java_ide_project.json")
+	android.WriteFileRule(ctx, s.project, string(project))
+	ctx.Phony("java-ide-project", s.project)
+}
+
+func (s *ideProjectSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.project != nil {
+		ctx.DistForGoal("java-ide-project", s.project)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*ideProjectSingleton)(nil)
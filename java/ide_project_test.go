@@ -0,0 +1,77 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestIdeProject(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			libs: ["bar"],
+			kotlincflags: ["-Xjvm-default=all"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["c.java"],
+			host_supported: true,
+		}
+	`
+
+	// The project is only generated when requested.
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithIdeProject,
+	).RunTestWithBp(t, bp)
+	android.AssertBoolEquals(t, "java_ide_project.json generated", false,
+		result.SingletonForTests("java_ide_project").MaybeOutput("java_ide_project.json").Rule != nil)
+
+	result = android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithIdeProject,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_COLLECT_JAVA_IDE_PROJECT": "true",
+		}),
+	).RunTestWithBp(t, bp)
+
+	project := result.SingletonForTests("java_ide_project").Output("java_ide_project.json")
+	var modules map[string][]ideProjectInfo
+	content := android.StringRelativeToTop(result.Config, android.ContentFromFileRuleForTests(t, project))
+	if err := json.Unmarshal([]byte(content), &modules); err != nil {
+		t.Fatalf("failed to parse the java IDE project: %s", err)
+	}
+
+	foo := modules["foo"]
+	android.AssertIntEquals(t, "variants of foo", 1, len(foo))
+	android.AssertStringEquals(t, "variant of foo", "android_common", foo[0].Variant)
+	android.AssertArrayString(t, "srcs of foo", []string{"a.java", "b.kt"}, foo[0].Srcs)
+	android.AssertStringListContains(t, "classpath of foo", foo[0].Classpath,
+		"out/soong/.intermediates/bar/android_common/turbine-combined/bar.jar")
+	if len(foo[0].Bootclasspath) == 0 {
+		t.Errorf("expected the bootclasspath of foo to be resolved from its sdk_version")
+	}
+	android.AssertStringListContains(t, "kotlinc flags of foo", foo[0].Kotlinc_flags, "-Xjvm-default=all")
+	android.AssertStringDoesContain(t, "output jar of foo", foo[0].Output_jar,
+		"out/soong/.intermediates/foo/android_common/")
+
+	android.AssertIntEquals(t, "variants of bar", 2, len(modules["bar"]))
+}
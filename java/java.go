@@ -253,6 +253,19 @@ type JavaInfo struct {
 	// JacocoReportClassesFile is the path to a jar containing uninstrumented classes that will be
 	// instrumented by jacoco.
 	JacocoReportClassesFile android.Path
+
+	// ExportedMainDexRules is a list of files containing rules that specify the classes to keep in
+	// the main dex file of any module that statically includes this module.
+	ExportedMainDexRules android.Paths
+
+	// MinJvmVersion is the minimum version of the JVM that can load the classes compiled by kotlinc
+	// for this module or its static dependencies, or JAVA_VERSION_UNSUPPORTED if there are none.
+	MinJvmVersion javaVersion
+
+	// HeaderJarAbiDigest is the path to a file containing a digest of the ABI of the single jar in
+	// HeaderJars, or nil if none was generated. The file is only updated when the ABI changes, see
+	// useAbiDigests.
+	HeaderJarAbiDigest android.Path
 }
 
 var JavaInfoProvider = blueprint.NewProvider(JavaInfo{})
@@ -319,6 +332,15 @@ func (d dependencyTag) LicenseAnnotations() []android.LicenseAnnotation {
 
 var _ android.LicenseAnnotationsDependencyTag = dependencyTag{}
 
+// CoveredDependency returns true for the libraries that are linked into or instrumented by the
+// depending module, so that the tests of the module cover them. The libraries in libs are only
+// compiled against, so they are not covered.
+func (d dependencyTag) CoveredDependency() bool {
+	return d == staticLibTag || d == instrumentationForTag || d == jniLibTag
+}
+
+var _ android.CoveredDependencyTag = dependencyTag{}
+
 type usesLibraryDependencyTag struct {
 	dependencyTag
 
@@ -365,8 +387,10 @@ var (
 	kotlinStdlibTag         = dependencyTag{name: "kotlin-stdlib", runtimeLinked: true}
 	kotlinAnnotationsTag    = dependencyTag{name: "kotlin-annotations", runtimeLinked: true}
 	kotlinPluginTag         = dependencyTag{name: "kotlin-plugin", toolchain: true}
+	kspPluginTag            = dependencyTag{name: "ksp-plugin", toolchain: true}
 	proguardRaiseTag        = dependencyTag{name: "proguard-raise"}
 	certificateTag          = dependencyTag{name: "certificate"}
+	originalCertificateTag  = dependencyTag{name: "original-certificate"}
 	instrumentationForTag   = dependencyTag{name: "instrumentation_for"}
 	extraLintCheckTag       = dependencyTag{name: "extra-lint-check", toolchain: true}
 	jniLibTag               = dependencyTag{name: "jnilib", runtimeLinked: true}
@@ -469,17 +493,26 @@ type deps struct {
 	processorPath           classpath
 	errorProneProcessorPath classpath
 	processorClasses        []string
+	isolatedPlugins         []isolatedPlugin
 	staticJars              android.Paths
 	staticHeaderJars        android.Paths
 	staticResourceJars      android.Paths
+	staticMainDexRules      android.Paths
+	jvmVersionDeps          []jvmVersionDep
 	aidlIncludeDirs         android.Paths
 	srcs                    android.Paths
 	srcJars                 android.Paths
 	systemModules           *systemModules
+	systemModulesHeaderJars android.Paths
 	aidlPreprocess          android.OptionalPath
 	kotlinStdlib            android.Paths
 	kotlinAnnotations       android.Paths
 	kotlinPlugins           android.Paths
+	kspProcessorPath        classpath
+
+	// abiDigests maps the path of a header jar on the classpath to the path of its ABI digest, for
+	// those dependencies that provide one.
+	abiDigests map[string]android.Path
 
 	disableTurbine bool
 }
@@ -512,6 +545,7 @@ const (
 	JAVA_VERSION_8           = 8
 	JAVA_VERSION_9           = 9
 	JAVA_VERSION_11          = 11
+	JAVA_VERSION_17          = 17
 )
 
 func (v javaVersion) String() string {
@@ -526,6 +560,8 @@ func (v javaVersion) String() string {
 		return "1.9"
 	case JAVA_VERSION_11:
 		return "11"
+	case JAVA_VERSION_17:
+		return "17"
 	default:
 		return "unsupported"
 	}
@@ -550,6 +586,12 @@ func (v javaVersion) usesJavaModules() bool {
 	return v >= 9
 }
 
+// openJDK17ToolchainEnabled returns true if the build uses the JDK 17 toolchain, which is required
+// to compile for Java 17.
+func openJDK17ToolchainEnabled(config android.Config) bool {
+	return config.IsEnvTrue("EXPERIMENTAL_USE_OPENJDK17_TOOLCHAIN")
+}
+
 func normalizeJavaVersion(ctx android.BaseModuleContext, javaVersion string) javaVersion {
 	switch javaVersion {
 	case "1.6", "6":
@@ -562,6 +604,13 @@ func normalizeJavaVersion(ctx android.BaseModuleContext, javaVersion string) jav
 		return JAVA_VERSION_9
 	case "11":
 		return JAVA_VERSION_11
+	case "17":
+		if !openJDK17ToolchainEnabled(ctx.Config()) {
+			ctx.PropertyErrorf("java_version", "Java language level 17 requires the JDK 17 toolchain "+
+				"(EXPERIMENTAL_USE_OPENJDK17_TOOLCHAIN=true)")
+			return JAVA_VERSION_UNSUPPORTED
+		}
+		return JAVA_VERSION_17
 	case "10":
 		ctx.PropertyErrorf("java_version", "Java language levels 10 is not supported")
 		return JAVA_VERSION_UNSUPPORTED
@@ -669,7 +718,10 @@ func (j *Library) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		} else {
 			installDir = android.PathForModuleInstall(ctx, "framework")
 		}
-		j.installFile = ctx.InstallFile(installDir, j.Stem()+".jar", j.outputFile, extraInstallDeps...)
+		// The deduplicated jar of a platform boot jar is installed by platform_bootclasspath.
+		if !isDedupedBootJar(ctx) {
+			j.installFile = ctx.InstallFile(installDir, j.Stem()+".jar", j.outputFile, extraInstallDeps...)
+		}
 	}
 }
 
@@ -808,6 +860,7 @@ func LibraryFactory() android.Module {
 	module := &Library{}
 
 	module.addHostAndDeviceProperties()
+	module.AddProperties(&module.hiddenAPIProperties)
 
 	module.initModuleAndImport(module)
 
@@ -888,6 +941,9 @@ type testProperties struct {
 
 	// Install the test into a folder named for the module in all test suites.
 	Per_testcase_directory *bool
+
+	// The modules that the test is for in the generated test mapping.
+	Test_mapping android.TestMappingProperties
 }
 
 type hostTestProperties struct {
@@ -972,6 +1028,16 @@ func (j *Test) InstallInTestcases() bool {
 	return !j.Host()
 }
 
+func (j *Test) TestMappingTargets() []string {
+	return j.testProperties.Test_mapping.Test_for
+}
+
+func (j *Test) TestMappingPresubmit() bool {
+	return Bool(j.testProperties.Test_mapping.Presubmit)
+}
+
+var _ android.TestMappingModule = (*Test)(nil)
+
 func (j *TestHelperLibrary) InstallInTestcases() bool {
 	return true
 }
@@ -1169,6 +1235,67 @@ func (j *Test) generateAndroidBuildActionsWithConfig(ctx android.ModuleContext,
 	})
 
 	j.Library.GenerateAndroidBuildActions(ctx)
+
+	if ctx.Host() && Bool(j.testProperties.Test_options.Unit_test) && j.implementationAndResourcesJar != nil {
+		j.buildHostTestRun(ctx)
+	}
+}
+
+// buildHostTestRun adds a rule that runs the JUnit tests in the jar of a host unit test.
+func (j *Test) buildHostTestRun(ctx android.ModuleContext) {
+	// Static libraries are already in the implementation jar, but the libraries they and the
+	// test link against at runtime have to be on the classpath, transitively.
+	classpath := android.Paths{j.implementationAndResourcesJar}
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		tag := ctx.OtherModuleDependencyTag(child)
+		if tag != libTag && tag != staticLibTag {
+			return false
+		}
+		if tag == libTag && ctx.OtherModuleHasProvider(child, JavaInfoProvider) {
+			depInfo := ctx.OtherModuleProvider(child, JavaInfoProvider).(JavaInfo)
+			classpath = append(classpath, depInfo.ImplementationAndResourcesJars...)
+		}
+		return true
+	})
+	classpath = android.FirstUniquePaths(classpath)
+
+	// The classes to run come from the class and include-filter options of the test config, as
+	// for tradefed's HostTest. Without either option every class in the jar with a @Test method
+	// is run, minus the classes in exclude-filter options.
+	inputs := android.Paths{}
+	testConfig := "/dev/null"
+	if j.testConfig != nil {
+		inputs = append(inputs, j.testConfig)
+		testConfig = j.testConfig.String()
+	}
+	script := android.PathForModuleOut(ctx, "test_result", "run_junit.sh")
+	android.WriteFileRule(ctx, script, fmt.Sprintf(`set -e
+options() {
+  sed -n 's|.*<option  *name="'$1'"  *value="\([^"]*\)".*|\1|p' %[1]s
+}
+classes=$(options class; options include-filter)
+if [ -z "${classes}" ]; then
+  for c in $(zipinfo -1 %[2]s | sed -n 's|\.class$||p' | grep -v '\$' | tr / .); do
+    if %[3]s -v -cp %[2]s ${c} | grep -q 'Lorg/junit/Test;'; then
+      classes="${classes} ${c}"
+    fi
+  done
+fi
+for c in $(options exclude-filter); do
+  classes=$(echo ${classes} | tr ' ' '\n' | grep -vxF "${c}" || true)
+done
+if [ -z "${classes}" ]; then
+  echo "no test classes found in %[2]s" >&2
+  exit 1
+fi
+%[4]s -cp %[5]s org.junit.runner.JUnitCore ${classes}
+`, testConfig, j.implementationAndResourcesJar, config.JavapCmd(ctx), config.JavaCmd(ctx),
+		strings.Join(classpath.Strings(), ":")))
+
+	android.BuildHostTestRun(ctx, android.HostTestRunParams{
+		Command: "bash " + script.String(),
+		Inputs:  append(append(append(inputs, script), classpath...), j.data...),
+	})
 }
 
 func (j *TestHelperLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
@@ -1357,6 +1484,9 @@ type Binary struct {
 
 	wrapperFile android.Path
 	binaryFile  android.InstallPath
+
+	// The installed jar and JNI libraries needed to run the wrapper, set in the wrapper variant.
+	runtimeDeps android.Paths
 }
 
 func (j *Binary) HostToolPath() android.OptionalPath {
@@ -1400,6 +1530,16 @@ func (j *Binary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		// libraries.  This is verified by TestBinary.
 		j.binaryFile = ctx.InstallExecutable(android.PathForModuleInstall(ctx, "bin"),
 			ctx.ModuleName()+ext, j.wrapperFile)
+
+		// The wrapper runs the installed jar, which it finds relative to its own location.
+		ctx.VisitDirectDeps(func(m android.Module) {
+			if tag := ctx.OtherModuleDependencyTag(m); tag == binaryInstallTag || tag == jniInstallTag {
+				j.runtimeDeps = append(j.runtimeDeps, m.FilesToInstall().Paths()...)
+			}
+		})
+		ctx.SetProvider(android.HostToolRuntimeDepsInfoProvider, android.HostToolRuntimeDepsInfo{
+			Deps: j.runtimeDeps,
+		})
 	}
 }
 
@@ -1521,6 +1661,9 @@ type Import struct {
 	dexJarFile        OptionalDexJarPath
 	dexJarInstallFile android.Path
 
+	// lists of the classes and method counts in dexJarFile, if it was compiled by this module
+	dexClassList DexClassListInfo
+
 	combinedClasspathFile android.Path
 	classLoaderContexts   dexpreopt.ClassLoaderContextMap
 	exportAidlIncludeDirs android.Paths
@@ -1722,6 +1865,7 @@ func (j *Import) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 			j.dexJarFile = makeDexJarPathFromPath(dexOutputFile)
 			j.dexJarInstallFile = android.PathForModuleInstall(ctx, "framework", jarName)
+			j.dexClassList = buildDexClassList(ctx, dexOutputFile)
 		}
 	}
 
@@ -1737,6 +1881,16 @@ func (j *Import) OutputFiles(tag string) (android.Paths, error) {
 	switch tag {
 	case "", ".jar":
 		return android.Paths{j.combinedClasspathFile}, nil
+	case ".dex_class_list":
+		if j.dexClassList.ClassList != nil {
+			return android.Paths{j.dexClassList.ClassList}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".dex_method_counts":
+		if j.dexClassList.MethodCounts != nil {
+			return android.Paths{j.dexClassList.MethodCounts}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -1994,6 +2148,7 @@ func (j *DexImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	}
 
 	j.dexJarFile = makeDexJarPathFromPath(dexOutputFile)
+	buildDexClassList(ctx, dexOutputFile)
 
 	j.dexpreopt(ctx, dexOutputFile)
 
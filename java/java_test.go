@@ -532,6 +532,90 @@ func TestHostBinaryNoJavaDebugInfoOverride(t *testing.T) {
 	}
 }
 
+func TestMultiReleaseJar(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"EXPERIMENTAL_USE_OPENJDK17_TOOLCHAIN": "true",
+		}),
+	).RunTestWithBp(t, `
+		java_binary_host {
+			name: "host_binary",
+			srcs: ["a.java"],
+			main_class: "foo.Main",
+			multi_release: {
+				java_17: {
+					srcs: ["b.java"],
+				},
+			},
+		}
+	`)
+
+	buildOS := result.Config.BuildOS.String()
+	module := result.ModuleForTests("host_binary", buildOS+"_common")
+
+	// The sources of the release are compiled for the release against the classes compiled from srcs.
+	javac := module.Output("javac/host_binary.jar")
+	javac17 := module.Output("javac-multi-release/17/classes.jar")
+	android.AssertStringEquals(t, "java version", "17", javac17.Args["javaVersion"])
+	android.AssertStringDoesContain(t, "classpath", javac17.Args["classpath"], javac.Output.String())
+	android.AssertPathsRelativeToTopEquals(t, "srcs", []string{"b.java"}, javac17.Inputs)
+
+	multiRelease := module.Rule("multiReleaseClasses")
+	android.AssertStringEquals(t, "release", "17", multiRelease.Args["release"])
+	android.AssertPathRelativeToTopEquals(t, "input",
+		"out/soong/.intermediates/host_binary/"+buildOS+"_common/javac-multi-release/17/classes.jar", multiRelease.Input)
+
+	// The classes of the release are merged into the jar, whose manifest marks it as a multi-release
+	// jar in addition to setting the main class.
+	combined := module.Output("combined/host_binary.jar")
+	android.AssertStringListContains(t, "combined inputs", combined.Inputs.Strings(), multiRelease.Output.String())
+
+	manifest := module.Rule("multiReleaseManifest")
+	android.AssertPathRelativeToTopEquals(t, "manifest input", "out/soong/.intermediates/host_binary/"+buildOS+"_common/manifest.txt", manifest.Input)
+	android.AssertStringDoesContain(t, "jarArgs", combined.Args["jarArgs"], "-m "+manifest.Output.String())
+}
+
+func TestMultiReleaseJarErrors(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+			`module "device_library" .* multi_release.java_17.srcs: multi-release jars are only supported for host modules`,
+			`module "host_library" .* multi_release.java_11.srcs: release 11 must be newer than java_version 11`,
+			`module "host_library_17" .* multi_release.java_17.srcs: release 17 requires the JDK 17 toolchain`,
+		})).
+		RunTestWithBp(t, `
+			java_library {
+				name: "device_library",
+				srcs: ["a.java"],
+				multi_release: {
+					java_17: {
+						srcs: ["b.java"],
+					},
+				},
+			}
+
+			java_library_host {
+				name: "host_library",
+				srcs: ["a.java"],
+				multi_release: {
+					java_11: {
+						srcs: ["b.java"],
+					},
+				},
+			}
+
+			java_library_host {
+				name: "host_library_17",
+				srcs: ["a.java"],
+				multi_release: {
+					java_17: {
+						srcs: ["b.java"],
+					},
+				},
+			}
+		`)
+}
+
 func TestPrebuilts(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
@@ -1207,6 +1291,33 @@ func TestPatchModule(t *testing.T) {
 	})
 }
 
+func TestTestCoverageInfo(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		java_test {
+			name: "foo_test",
+			srcs: ["a.java"],
+			test_suites: ["general-tests"],
+			static_libs: ["covered_lib"],
+			libs: ["compile_only_lib"],
+		}
+
+		java_library {
+			name: "covered_lib",
+			srcs: ["b.java"],
+		}
+
+		java_library {
+			name: "compile_only_lib",
+			srcs: ["c.java"],
+		}
+	`)
+
+	fooTest := result.ModuleForTests("foo_test", "android_common").Module()
+	info := result.ModuleProvider(fooTest, android.TestCoverageInfoProvider).(android.TestCoverageInfo)
+	android.AssertStringListContains(t, "covered modules", android.SortedStringKeys(info.Covered), "covered_lib")
+	android.AssertStringListDoesNotContain(t, "covered modules", android.SortedStringKeys(info.Covered), "compile_only_lib")
+}
+
 func TestJavaLibraryWithSystemModules(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
@@ -1497,6 +1608,120 @@ func TestErrorproneEnabledOnlyByEnvironmentVariable(t *testing.T) {
 	}
 }
 
+func TestAbiDigests(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			libs: ["bar"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+	`
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_JAVA_ABI_DIGESTS": "true",
+		}),
+	).RunTestWithBp(t, bp)
+
+	barHeaderJar := "out/soong/.intermediates/bar/android_common/turbine-combined/bar.jar"
+	barDigest := result.ModuleForTests("bar", "android_common").Output("abi-digest/bar.jar.sha256")
+	android.AssertPathRelativeToTopEquals(t, "digest input", barHeaderJar, barDigest.Input)
+
+	// The actions of foo depend on the digest of bar and only on the header jar of bar for ordering.
+	foo := result.ModuleForTests("foo", "android_common")
+	for _, desc := range []string{"javac", "turbine"} {
+		rule := foo.Description(desc)
+		android.AssertStringListContains(t, desc+" implicits", rule.Implicits.RelativeToTop().Strings(),
+			"out/soong/.intermediates/bar/android_common/abi-digest/bar.jar.sha256")
+		android.AssertStringListDoesNotContain(t, desc+" implicits", rule.Implicits.RelativeToTop().Strings(), barHeaderJar)
+		android.AssertPathsRelativeToTopEquals(t, desc+" order only", []string{barHeaderJar}, rule.OrderOnly)
+		android.AssertStringDoesContain(t, desc+" classpath", rule.Args["classpath"], barHeaderJar)
+	}
+}
+
+func TestAbiDigestsDisabled(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	android.AssertStringEquals(t, "digest rule", "", foo.MaybeOutput("abi-digest/foo.jar.sha256").RuleParams.Command)
+}
+
+func TestPersistentWorkerJars(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			optimize: {
+				enabled: true,
+			},
+			installable: true,
+		}
+	`
+	hasWorkerJar := func(paths android.Paths, jar string) bool {
+		for _, path := range paths {
+			if strings.HasSuffix(path.String(), "/framework/"+jar) {
+				return true
+			}
+		}
+		return false
+	}
+	rules := map[string]string{
+		"javac":   "javac-worker.jar",
+		"kotlinc": "kotlinc-worker.jar",
+		"r8":      "r8-worker.jar",
+	}
+
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_USE_PERSISTENT_WORKERS": "true",
+		}),
+	).RunTestWithBp(t, bp)
+	foo := result.ModuleForTests("foo", "android_common")
+	for rule, jar := range rules {
+		if !hasWorkerJar(foo.Rule(rule).Implicits, jar) {
+			t.Errorf("expected %s to be an implicit dependency of %s, got %q", jar, rule, foo.Rule(rule).Implicits)
+		}
+	}
+
+	result = PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, bp)
+	foo = result.ModuleForTests("foo", "android_common")
+	for rule, jar := range rules {
+		if hasWorkerJar(foo.Rule(rule).Implicits, jar) {
+			t.Errorf("expected no %s without persistent workers, got %q", jar, foo.Rule(rule).Implicits)
+		}
+	}
+
+	// The tools don't run in persistent workers when they run remotely.
+	result = android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_USE_PERSISTENT_WORKERS": "true",
+			"RBE_JAVAC":                    "true",
+			"RBE_R8":                       "true",
+		}),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.UseRBE = proptools.BoolPtr(true)
+		}),
+	).RunTestWithBp(t, bp)
+	foo = result.ModuleForTests("foo", "android_common")
+	for rule, jar := range rules {
+		if hasWorkerJar(foo.Rule(rule).Implicits, jar) {
+			t.Errorf("expected no %s with RBE, got %q", jar, foo.Rule(rule).Implicits)
+		}
+	}
+}
+
 func TestDataDeviceBinsBuildsDeviceBinary(t *testing.T) {
 	testCases := []struct {
 		dataDeviceBinType  string
@@ -22,19 +22,21 @@ import (
 	"strings"
 
 	"android/soong/android"
+	"android/soong/java/config"
 
 	"github.com/google/blueprint"
 )
 
 var kotlinc = pctx.AndroidRemoteStaticRule("kotlinc", android.RemoteRuleSupports{Goma: true},
 	blueprint.RuleParams{
-		Command: `rm -rf "$classesDir" "$headerClassesDir" "$srcJarDir" "$kotlinBuildFile" "$emptyDir" && ` +
-			`mkdir -p "$classesDir" "$headerClassesDir" "$srcJarDir" "$emptyDir" && ` +
+		Command: `rm -rf "$classesDir" "$headerClassesDir" "$srcJarDir" "$kotlinSrcJarDir" "$kotlinBuildFile" "$emptyDir" && ` +
+			`mkdir -p "$classesDir" "$headerClassesDir" "$srcJarDir" "$kotlinSrcJarDir" "$emptyDir" && ` +
 			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
+			`${config.ZipSyncCmd} -d $kotlinSrcJarDir -l $kotlinSrcJarDir/list -f "*.kt" $kotlinSrcJars && ` +
 			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
-			` --out_dir "$classesDir" --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
+			` --out_dir "$classesDir" --srcs "$out.rsp" --srcs "$srcJarDir/list" --srcs "$kotlinSrcJarDir/list"` +
 			` $commonSrcFilesArg --out "$kotlinBuildFile" && ` +
-			`${config.KotlincCmd} ${config.KotlincGlobalFlags} ` +
+			`${config.KotlincWorkerClient}${config.KotlincCmd} ${config.KotlincGlobalFlags} ` +
 			` ${config.KotlincSuppressJDK9Warnings} ${config.JavacHeapFlags} ` +
 			` $kotlincFlags -jvm-target $kotlinJvmTarget -Xbuild-file=$kotlinBuildFile ` +
 			` -kotlin-home $emptyDir ` +
@@ -42,7 +44,7 @@ var kotlinc = pctx.AndroidRemoteStaticRule("kotlinc", android.RemoteRuleSupports
 			` -P plugin:org.jetbrains.kotlin.jvm.abi:outputDir=$headerClassesDir && ` +
 			`${config.SoongZipCmd} -jar -o $out -C $classesDir -D $classesDir -write_if_changed && ` +
 			`${config.SoongZipCmd} -jar -o $headerJar -C $headerClassesDir -D $headerClassesDir -write_if_changed && ` +
-			`rm -rf "$srcJarDir"`,
+			`rm -rf "$srcJarDir" "$kotlinSrcJarDir"`,
 		CommandDeps: []string{
 			"${config.KotlincCmd}",
 			"${config.KotlinCompilerJar}",
@@ -57,12 +59,13 @@ var kotlinc = pctx.AndroidRemoteStaticRule("kotlinc", android.RemoteRuleSupports
 			"${config.SoongZipCmd}",
 			"${config.ZipSyncCmd}",
 		},
-		Rspfile:        "$out.rsp",
-		RspfileContent: `$in`,
-		Restat:         true,
+		CommandOrderOnly: []string{"${config.SoongWorkerClientCmd}"},
+		Rspfile:          "$out.rsp",
+		RspfileContent:   `$in`,
+		Restat:           true,
 	},
-	"kotlincFlags", "classpath", "srcJars", "commonSrcFilesArg", "srcJarDir", "classesDir",
-	"headerClassesDir", "headerJar", "kotlinJvmTarget", "kotlinBuildFile", "emptyDir", "name")
+	"kotlincFlags", "classpath", "srcJars", "kotlinSrcJars", "commonSrcFilesArg", "srcJarDir", "kotlinSrcJarDir",
+	"classesDir", "headerClassesDir", "headerJar", "kotlinJvmTarget", "kotlinBuildFile", "emptyDir", "name")
 
 func kotlinCommonSrcsList(ctx android.ModuleContext, commonSrcFiles android.Paths) android.OptionalPath {
 	if len(commonSrcFiles) > 0 {
@@ -81,14 +84,17 @@ func kotlinCommonSrcsList(ctx android.ModuleContext, commonSrcFiles android.Path
 }
 
 // kotlinCompile takes .java and .kt sources and srcJars, and compiles the .kt sources into a classes jar in outputFile.
+// The .kt sources in kotlinSrcJars, e.g. those generated by KSP, are compiled too.  Any validations are run whenever
+// the outputs of the kotlinc rule are used.
 func kotlinCompile(ctx android.ModuleContext, outputFile, headerOutputFile android.WritablePath,
-	srcFiles, commonSrcFiles, srcJars android.Paths,
-	flags javaBuilderFlags) {
+	srcFiles, commonSrcFiles, srcJars, kotlinSrcJars android.Paths,
+	flags javaBuilderFlags, validations android.Paths) {
 
 	var deps android.Paths
 	deps = append(deps, flags.kotlincClasspath...)
 	deps = append(deps, flags.kotlincDeps...)
 	deps = append(deps, srcJars...)
+	deps = append(deps, kotlinSrcJars...)
 	deps = append(deps, commonSrcFiles...)
 
 	kotlinName := filepath.Join(ctx.ModuleDir(), ctx.ModuleSubDir(), ctx.ModuleName())
@@ -107,16 +113,19 @@ func kotlinCompile(ctx android.ModuleContext, outputFile, headerOutputFile andro
 		Output:         outputFile,
 		ImplicitOutput: headerOutputFile,
 		Inputs:         srcFiles,
-		Implicits:      deps,
+		Implicits:      append(deps, config.PersistentWorkerJar(ctx, "kotlinc")...),
+		Validations:    validations,
 		Args: map[string]string{
 			"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
 			"kotlincFlags":      flags.kotlincFlags,
 			"commonSrcFilesArg": commonSrcFilesArg,
 			"srcJars":           strings.Join(srcJars.Strings(), " "),
+			"kotlinSrcJars":     strings.Join(kotlinSrcJars.Strings(), " "),
 			"classesDir":        android.PathForModuleOut(ctx, "kotlinc", "classes").String(),
 			"headerClassesDir":  android.PathForModuleOut(ctx, "kotlinc", "header_classes").String(),
 			"headerJar":         headerOutputFile.String(),
 			"srcJarDir":         android.PathForModuleOut(ctx, "kotlinc", "srcJars").String(),
+			"kotlinSrcJarDir":   android.PathForModuleOut(ctx, "kotlinc", "kotlinSrcJars").String(),
 			"kotlinBuildFile":   android.PathForModuleOut(ctx, "kotlinc-build.xml").String(),
 			"emptyDir":          android.PathForModuleOut(ctx, "kotlinc", "empty").String(),
 			"kotlinJvmTarget":   flags.javaVersion.StringForKotlinc(),
@@ -128,7 +137,7 @@ func kotlinCompile(ctx android.ModuleContext, outputFile, headerOutputFile andro
 var kapt = pctx.AndroidRemoteStaticRule("kapt", android.RemoteRuleSupports{Goma: true},
 	blueprint.RuleParams{
 		Command: `rm -rf "$srcJarDir" "$kotlinBuildFile" "$kaptDir" && ` +
-			`mkdir -p "$srcJarDir" "$kaptDir/sources" "$kaptDir/classes" && ` +
+			`mkdir -p "$srcJarDir" "$kaptDir/sources" "$kaptDir/classes" "$kaptDir/stubs" && ` +
 			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
 			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
 			` --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
@@ -147,6 +156,7 @@ var kapt = pctx.AndroidRemoteStaticRule("kapt", android.RemoteRuleSupports{Goma:
 			`-Xbuild-file=$kotlinBuildFile && ` +
 			`${config.SoongZipCmd} -jar -o $out -C $kaptDir/sources -D $kaptDir/sources && ` +
 			`${config.SoongZipCmd} -jar -o $classesJarOut -C $kaptDir/classes -D $kaptDir/classes && ` +
+			`${config.SoongZipCmd} -jar -o $stubsJarOut -C $kaptDir/stubs -D $kaptDir/stubs && ` +
 			`rm -rf "$srcJarDir"`,
 		CommandDeps: []string{
 			"${config.KotlincCmd}",
@@ -161,13 +171,14 @@ var kapt = pctx.AndroidRemoteStaticRule("kapt", android.RemoteRuleSupports{Goma:
 	},
 	"kotlincFlags", "encodedJavacFlags", "kaptProcessorPath", "kaptProcessor",
 	"classpath", "srcJars", "commonSrcFilesArg", "srcJarDir", "kaptDir", "kotlinJvmTarget",
-	"kotlinBuildFile", "name", "classesJarOut")
+	"kotlinBuildFile", "name", "classesJarOut", "stubsJarOut")
 
 // kotlinKapt performs Kotlin-compatible annotation processing.  It takes .kt and .java sources and srcjars, and runs
 // annotation processors over all of them, producing a srcjar of generated code in outputFile.  The srcjar should be
 // added as an additional input to kotlinc and javac rules, and the javac rule should have annotation processing
-// disabled.
-func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile android.WritablePath,
+// disabled.  The Java stubs that kapt generates for the Kotlin sources, and that the annotation processors see, are
+// written to a srcjar in stubsJarOutputFile.
+func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile, stubsJarOutputFile android.WritablePath,
 	srcFiles, commonSrcFiles, srcJars android.Paths,
 	flags javaBuilderFlags) {
 
@@ -206,12 +217,12 @@ func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile an
 	kotlinName = strings.ReplaceAll(kotlinName, "/", "__")
 
 	ctx.Build(pctx, android.BuildParams{
-		Rule:           kapt,
-		Description:    "kapt",
-		Output:         srcJarOutputFile,
-		ImplicitOutput: resJarOutputFile,
-		Inputs:         srcFiles,
-		Implicits:      deps,
+		Rule:            kapt,
+		Description:     "kapt",
+		Output:          srcJarOutputFile,
+		ImplicitOutputs: android.WritablePaths{resJarOutputFile, stubsJarOutputFile},
+		Inputs:          srcFiles,
+		Implicits:       deps,
 		Args: map[string]string{
 			"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
 			"kotlincFlags":      flags.kotlincFlags,
@@ -225,6 +236,126 @@ func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile an
 			"encodedJavacFlags": encodedJavacFlags,
 			"name":              kotlinName,
 			"classesJarOut":     resJarOutputFile.String(),
+			"stubsJarOut":       stubsJarOutputFile.String(),
+		},
+	})
+}
+
+var ksp = pctx.AndroidRemoteStaticRule("ksp", android.RemoteRuleSupports{Goma: true},
+	blueprint.RuleParams{
+		Command: `rm -rf "$srcJarDir" "$kotlinBuildFile" "$kspDir" && ` +
+			`mkdir -p "$srcJarDir" "$kspDir/java" "$kspDir/kotlin" "$kspDir/classes" "$kspDir/resources" "$kspDir/caches" && ` +
+			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
+			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
+			` --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
+			` $commonSrcFilesArg --out "$kotlinBuildFile" && ` +
+			`${config.KotlincCmd} ${config.KotlincGlobalFlags} ` +
+			`${config.KotlincSuppressJDK9Warnings} ${config.JavacHeapFlags} $kotlincFlags ` +
+			`-Xplugin=${config.KotlinKspApiJar} -Xplugin=${config.KotlinKspJar} ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:apclasspath=$kspProcessorPath ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:projectBaseDir=$kspDir ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:kspOutputDir=$kspDir ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:javaOutputDir=$kspDir/java ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:kotlinOutputDir=$kspDir/kotlin ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:classOutputDir=$kspDir/classes ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:resourceOutputDir=$kspDir/resources ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:cachesDir=$kspDir/caches ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:incremental=false ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:withCompilation=false ` +
+			`-Xbuild-file=$kotlinBuildFile && ` +
+			`${config.SoongZipCmd} -jar -o $out -C $kspDir/java -D $kspDir/java && ` +
+			`${config.SoongZipCmd} -jar -o $kotlinSrcJarOut -C $kspDir/kotlin -D $kspDir/kotlin && ` +
+			`${config.SoongZipCmd} -jar -o $resJarOut -C $kspDir/resources -D $kspDir/resources && ` +
+			`rm -rf "$srcJarDir"`,
+		CommandDeps: []string{
+			"${config.KotlincCmd}",
+			"${config.KotlinCompilerJar}",
+			"${config.KotlinKspJar}",
+			"${config.KotlinKspApiJar}",
+			"${config.GenKotlinBuildFileCmd}",
+			"${config.SoongZipCmd}",
+			"${config.ZipSyncCmd}",
+		},
+		Rspfile:        "$out.rsp",
+		RspfileContent: `$in`,
+	},
+	"kotlincFlags", "kspProcessorPath", "classpath", "srcJars", "commonSrcFilesArg", "srcJarDir", "kspDir",
+	"kotlinBuildFile", "name", "kotlinSrcJarOut", "resJarOut")
+
+// kotlinKsp runs the Kotlin Symbol Processing processors in processorPath over .kt and .java sources and srcjars.
+// The java sources they generate are written to a srcjar in srcJarOutputFile, which should be added as an
+// additional input to the kotlinc and javac rules, and the kotlin sources to a srcjar in kotlinSrcJarOutputFile,
+// which should be compiled by kotlinc.  The resources they generate are written to resJarOutputFile.
+func kotlinKsp(ctx android.ModuleContext, srcJarOutputFile, kotlinSrcJarOutputFile, resJarOutputFile android.WritablePath,
+	srcFiles, commonSrcFiles, srcJars android.Paths, processorPath classpath,
+	flags javaBuilderFlags) {
+
+	var deps android.Paths
+	deps = append(deps, flags.kotlincClasspath...)
+	deps = append(deps, flags.kotlincDeps...)
+	deps = append(deps, srcJars...)
+	deps = append(deps, processorPath...)
+	deps = append(deps, commonSrcFiles...)
+
+	commonSrcsList := kotlinCommonSrcsList(ctx, commonSrcFiles)
+	commonSrcFilesArg := ""
+	if commonSrcsList.Valid() {
+		deps = append(deps, commonSrcsList.Path())
+		commonSrcFilesArg = "--common_srcs " + commonSrcsList.String()
+	}
+
+	kotlinName := filepath.Join(ctx.ModuleDir(), ctx.ModuleSubDir(), ctx.ModuleName())
+	kotlinName = strings.ReplaceAll(kotlinName, "/", "__")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:            ksp,
+		Description:     "ksp",
+		Output:          srcJarOutputFile,
+		ImplicitOutputs: android.WritablePaths{kotlinSrcJarOutputFile, resJarOutputFile},
+		Inputs:          srcFiles,
+		Implicits:       deps,
+		Args: map[string]string{
+			"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
+			"kotlincFlags":      flags.kotlincFlags,
+			"kspProcessorPath":  processorPath.FormJavaClassPath(""),
+			"commonSrcFilesArg": commonSrcFilesArg,
+			"srcJars":           strings.Join(srcJars.Strings(), " "),
+			"srcJarDir":         android.PathForModuleOut(ctx, "ksp", "srcJars").String(),
+			"kotlinBuildFile":   android.PathForModuleOut(ctx, "ksp", "build.xml").String(),
+			"kspDir":            android.PathForModuleOut(ctx, "ksp/gen").String(),
+			"name":              kotlinName,
+			"kotlinSrcJarOut":   kotlinSrcJarOutputFile.String(),
+			"resJarOut":         resJarOutputFile.String(),
+		},
+	})
+}
+
+var kaptStubsCheck = pctx.AndroidStaticRule("kaptStubsCheck",
+	blueprint.RuleParams{
+		Command:     `${config.CheckKaptStubsCmd} ${config.JavapCmd} $kotlinHeaderJar $in $out`,
+		CommandDeps: []string{"${config.CheckKaptStubsCmd}", "${config.JavapCmd}"},
+	},
+	"kotlinHeaderJar")
+
+// kotlinKaptStubsCheck verifies that the Java stubs generated by kapt, which the annotation processors ran against,
+// have the same signatures as the classes compiled by kotlinc.  A mismatch means the annotation processors saw stale
+// or incorrect signatures, which would otherwise only be noticed at runtime.  The stubs are compiled to a header jar
+// with turbine, along with the Java sources and srcjars of the module, and the public signatures of every class in
+// the kotlinc header jar are compared against it.  A timestamp file is written to outputFile if they match.
+func kotlinKaptStubsCheck(ctx android.ModuleContext, outputFile android.WritablePath,
+	stubsSrcJar, kotlinHeaderJar android.Path, srcFiles, srcJars android.Paths, flags javaBuilderFlags) {
+
+	stubsHeaderJar := android.PathForModuleOut(ctx, "kapt", "kapt-stubs-header.jar")
+	TransformJavaToHeaderClasses(ctx, stubsHeaderJar, srcFiles, append(android.Paths{stubsSrcJar}, srcJars...), flags)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        kaptStubsCheck,
+		Description: "kapt stubs check",
+		Output:      outputFile,
+		Input:       stubsHeaderJar,
+		Implicit:    kotlinHeaderJar,
+		Args: map[string]string{
+			"kotlinHeaderJar": kotlinHeaderJar.String(),
 		},
 	})
 }
@@ -254,3 +385,44 @@ func kaptEncodeFlags(options [][2]string) string {
 
 	return base64.StdEncoding.EncodeToString(append(header.Bytes(), buf.Bytes()...))
 }
+
+// kotlincJvmFeatureFlags maps kotlinc flags that make the generated classes use JVM features that
+// may be newer than the -jvm-target to the minimum version of the JVM that supports them.
+var kotlincJvmFeatureFlags = map[string]javaVersion{
+	"-Xjvm-default=all":                   JAVA_VERSION_8,
+	"-Xjvm-default=all-compatibility":     JAVA_VERSION_8,
+	"-Xlambdas=indy":                      JAVA_VERSION_8,
+	"-Xstring-concat=indy":                JAVA_VERSION_9,
+	"-Xstring-concat=indy-with-constants": JAVA_VERSION_9,
+}
+
+// kotlinMinJvmVersion returns the minimum version of the JVM that can load the classes generated by
+// kotlinc when targeting jvmTarget with the user supplied kotlincFlags.
+func kotlinMinJvmVersion(jvmTarget javaVersion, kotlincFlags []string) javaVersion {
+	minVersion := jvmTarget
+	for _, flag := range kotlincFlags {
+		if v, ok := kotlincJvmFeatureFlags[strings.TrimSpace(flag)]; ok && v > minVersion {
+			minVersion = v
+		}
+	}
+	return minVersion
+}
+
+// jvmVersionDep is a classpath dependency that contains classes compiled by kotlinc.
+type jvmVersionDep struct {
+	name          string
+	minJvmVersion javaVersion
+	static        bool
+}
+
+// checkMinJvmVersions reports an error for every dependency whose kotlinc compiled classes require
+// a newer JVM than the one targeted by the module, as host tools would otherwise fail at runtime
+// with an UnsupportedClassVersionError.
+func checkMinJvmVersions(ctx android.ModuleContext, deps []jvmVersionDep, javaVersion javaVersion) {
+	for _, dep := range deps {
+		if dep.minJvmVersion > javaVersion {
+			ctx.ModuleErrorf("depends on %q, which contains kotlin classes that require JVM %s, "+
+				"but this module targets java_version %s", dep.name, dep.minJvmVersion, javaVersion)
+		}
+	}
+}
@@ -244,6 +244,99 @@ func TestKapt(t *testing.T) {
 			t.Errorf("expected processor '-proc:none', got %q", errorprone.Args["processor"])
 		}
 	})
+
+	t.Run("correctness check", func(t *testing.T) {
+		result := android.GroupFixturePreparers(
+			PrepareForTestWithJavaDefaultModules,
+			android.FixtureMergeEnv(map[string]string{
+				"KAPT_CORRECTNESS_CHECK": "true",
+			}),
+		).RunTestWithBp(t, bp)
+
+		foo := result.ModuleForTests("foo", "android_common")
+		kapt := foo.Rule("kapt")
+		kotlinc := foo.Rule("kotlinc")
+		stubsHeader := foo.Output("kapt/kapt-stubs-header.jar")
+		check := foo.Rule("kaptStubsCheck")
+
+		// Test that the kapt stubs are compiled along with the java sources and the kapt srcjar
+		stubsSrcJar := "out/soong/.intermediates/foo/android_common/kapt/kapt-stubs.srcjar"
+		android.AssertPathsRelativeToTopEquals(t, "kapt implicit outputs", []string{
+			"out/soong/.intermediates/foo/android_common/kapt/kapt-res.jar",
+			stubsSrcJar,
+		}, kapt.ImplicitOutputs.Paths())
+		android.AssertPathsRelativeToTopEquals(t, "stubs header inputs", []string{"a.java"}, stubsHeader.Inputs)
+		android.AssertStringDoesContain(t, "stubs header srcjars", stubsHeader.Args["srcJars"], stubsSrcJar)
+		android.AssertStringDoesContain(t, "stubs header srcjars", stubsHeader.Args["srcJars"], kapt.Output.String())
+
+		// Test that the stubs are compared against the kotlinc header jar and validate the kotlinc rule
+		android.AssertPathRelativeToTopEquals(t, "check input", stubsHeader.Output.String(), check.Input)
+		android.AssertStringEquals(t, "check kotlin header jar",
+			kotlinc.ImplicitOutput.String(), check.Args["kotlinHeaderJar"])
+		android.AssertPathsRelativeToTopEquals(t, "kotlinc validations",
+			[]string{check.Output.String()}, kotlinc.Validations)
+	})
+}
+
+func TestKsp(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			ksp_plugins: ["bar"],
+		}
+
+		java_plugin {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+	`)
+
+	buildOS := result.Config.BuildOS.String()
+	foo := result.ModuleForTests("foo", "android_common")
+	ksp := foo.Rule("ksp")
+	kotlinc := foo.Rule("kotlinc")
+	javac := foo.Rule("javac")
+	bar := result.ModuleForTests("bar", buildOS+"_common").Rule("javac").Output
+
+	// Test that the kotlin and java sources are passed to ksp, along with the processors
+	android.AssertPathsRelativeToTopEquals(t, "ksp inputs", []string{"a.java", "b.kt"}, ksp.Inputs)
+	android.AssertStringEquals(t, "ksp processor path", bar.String(), ksp.Args["kspProcessorPath"])
+
+	// Test that the java sources generated by ksp are compiled by kotlinc and javac, and the kotlin
+	// sources only by kotlinc
+	kspKotlinSrcJar := "out/soong/.intermediates/foo/android_common/ksp/ksp-kotlin-sources.srcjar"
+	android.AssertPathsRelativeToTopEquals(t, "ksp implicit outputs", []string{
+		kspKotlinSrcJar,
+		"out/soong/.intermediates/foo/android_common/ksp/ksp-res.jar",
+	}, ksp.ImplicitOutputs.Paths())
+	android.AssertStringEquals(t, "kotlinc srcjars", ksp.Output.String(), kotlinc.Args["srcJars"])
+	android.AssertStringEquals(t, "kotlinc kotlin srcjars", kspKotlinSrcJar, kotlinc.Args["kotlinSrcJars"])
+	android.AssertStringEquals(t, "javac srcjars", ksp.Output.String(), javac.Args["srcJars"])
+
+	// Test that the processors are not run by kapt or javac
+	if foo.MaybeRule("kapt").Rule != nil {
+		t.Errorf("expected no kapt rule")
+	}
+	android.AssertStringEquals(t, "javac processor path", "", javac.Args["processorpath"])
+}
+
+func TestKspWithoutKotlinSources(t *testing.T) {
+	PrepareForTestWithJavaDefaultModules.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`ksp_plugins: can only be used in modules with kotlin sources`)).
+		RunTestWithBp(t, `
+			java_library {
+				name: "foo",
+				srcs: ["a.java"],
+				ksp_plugins: ["bar"],
+			}
+
+			java_plugin {
+				name: "bar",
+				srcs: ["b.java"],
+			}
+		`)
 }
 
 func TestKaptEncodeFlags(t *testing.T) {
@@ -355,3 +448,70 @@ func TestKotlinCompose(t *testing.T) {
 	android.AssertStringDoesNotContain(t, "unexpected compose compiler plugin",
 		noCompose.VariablesForTestsRelativeToTop()["kotlincFlags"], "-Xplugin="+composeCompiler.String())
 }
+
+func TestKotlinMinJvmVersion(t *testing.T) {
+	bp := `
+		java_library_host {
+			name: "kotlin_11",
+			srcs: ["a.kt"],
+			java_version: "11",
+		}
+
+		java_library_host {
+			name: "kotlin_indy",
+			srcs: ["a.kt"],
+			java_version: "1.8",
+			kotlincflags: ["-Xstring-concat=indy"],
+		}
+
+		java_library_host {
+			name: "wrapper",
+			srcs: ["b.java"],
+			java_version: "11",
+			static_libs: ["kotlin_11"],
+		}
+
+		java_library_host {
+			name: "compatible",
+			srcs: ["b.java"],
+			java_version: "11",
+			libs: ["kotlin_11", "kotlin_indy"],
+		}
+	`
+
+	t.Run("compatible", func(t *testing.T) {
+		android.GroupFixturePreparers(
+			PrepareForTestWithJavaDefaultModules,
+		).RunTestWithBp(t, bp)
+	})
+
+	t.Run("older java_version", func(t *testing.T) {
+		android.GroupFixturePreparers(
+			PrepareForTestWithJavaDefaultModules,
+		).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+			`depends on "kotlin_indy", which contains kotlin classes that require JVM 1.9, but this module targets java_version 1.8`,
+		})).RunTestWithBp(t, bp+`
+			java_library_host {
+				name: "java8",
+				srcs: ["b.java"],
+				java_version: "1.8",
+				libs: ["kotlin_indy"],
+			}
+		`)
+	})
+
+	t.Run("transitive static lib", func(t *testing.T) {
+		android.GroupFixturePreparers(
+			PrepareForTestWithJavaDefaultModules,
+		).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+			`depends on "wrapper", which contains kotlin classes that require JVM 11, but this module targets java_version 1.8`,
+		})).RunTestWithBp(t, bp+`
+			java_binary_host {
+				name: "java8",
+				srcs: ["b.java"],
+				java_version: "1.8",
+				static_libs: ["wrapper"],
+			}
+		`)
+	})
+}
@@ -87,6 +87,9 @@ type linter struct {
 
 	reports android.Paths
 
+	// The lint baseline file used by the module, if any.
+	baseline android.OptionalPath
+
 	buildModuleReportZip bool
 }
 
@@ -95,6 +98,10 @@ type lintOutputs struct {
 	text android.Path
 	xml  android.Path
 
+	// The SARIF report, which also lists the issues suppressed in the sources. It is only set for
+	// modules that run lint.
+	sarif android.Path
+
 	depSets LintDepSets
 }
 
@@ -377,6 +384,7 @@ func (l *linter) lint(ctx android.ModuleContext) {
 	html := android.PathForModuleOut(ctx, "lint", "lint-report.html")
 	text := android.PathForModuleOut(ctx, "lint", "lint-report.txt")
 	xml := android.PathForModuleOut(ctx, "lint", "lint-report.xml")
+	sarif := android.PathForModuleOut(ctx, "lint", "lint-report.sarif")
 	baseline := android.PathForModuleOut(ctx, "lint", "lint-baseline.xml")
 
 	depSetsBuilder := NewLintDepSetBuilder().Direct(html, text, xml)
@@ -427,6 +435,7 @@ func (l *linter) lint(ctx android.ModuleContext) {
 		FlagWithOutput("--html ", html).
 		FlagWithOutput("--text ", text).
 		FlagWithOutput("--xml ", xml).
+		FlagWithOutput("--sarif ", sarif).
 		FlagWithArg("--compile-sdk-version ", l.compileSdkVersion.String()).
 		FlagWithArg("--java-language-level ", l.javaLanguageLevel).
 		FlagWithArg("--kotlin-language-level ", l.kotlinLanguageLevel).
@@ -447,6 +456,7 @@ func (l *linter) lint(ctx android.ModuleContext) {
 	if lintBaseline.Valid() {
 		cmd.FlagWithInput("--baseline ", lintBaseline.Path())
 	}
+	l.baseline = lintBaseline
 
 	cmd.FlagWithOutput("--write-reference-baseline ", baseline)
 
@@ -460,9 +470,10 @@ func (l *linter) lint(ctx android.ModuleContext) {
 	rule.Build("lint", "lint")
 
 	l.outputs = lintOutputs{
-		html: html,
-		text: text,
-		xml:  xml,
+		html:  html,
+		text:  text,
+		xml:   xml,
+		sarif: sarif,
 
 		depSets: depSetsBuilder.Build(),
 	}
@@ -649,10 +660,28 @@ func lintZip(ctx android.BuilderContext, paths android.Paths, outputPath android
 
 	rule := android.NewRuleBuilder(pctx, ctx)
 
-	rule.Command().BuiltTool("soong_zip").
-		FlagWithOutput("-o ", outputPath).
-		FlagWithArg("-C ", android.PathForIntermediates(ctx).String()).
-		FlagWithRspFileInputList("-r ", outputPath.ReplaceExtension(ctx, "rsp"), paths)
+	cmd := rule.Command().BuiltTool("soong_zip").
+		FlagWithOutput("-o ", outputPath)
+
+	// The files are zipped relative to the intermediates directory that contains them, as the
+	// intermediates of the device variants are apart when SOONG_PER_PRODUCT_INTERMEDIATES is set.
+	for i, root := range android.IntermediatesRoots(ctx) {
+		var rootPaths android.Paths
+		for _, path := range paths {
+			if _, ok := android.MaybeRel(ctx, root.String(), path.String()); ok {
+				rootPaths = append(rootPaths, path)
+			}
+		}
+		rspFile := outputPath.ReplaceExtension(ctx, "rsp")
+		if i > 0 {
+			if len(rootPaths) == 0 {
+				continue
+			}
+			rspFile = outputPath.ReplaceExtension(ctx, fmt.Sprintf("%d.rsp", i))
+		}
+		cmd.FlagWithArg("-C ", root.String()).
+			FlagWithRspFileInputList("-r ", rspFile, rootPaths)
+	}
 
 	rule.Build(outputPath.Base(), outputPath.Base())
 }
@@ -0,0 +1,104 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strings"
+
+	"android/soong/android"
+)
+
+// The resources of preinstalled apps are filtered to the product locales (PRODUCT_LOCALES) with
+// aapt2 -c. The locale_filter singleton reports how much each app saved, as a tab separated file
+// with one line per app:
+//
+//	<module> <filtered size> <unfiltered size> <saved bytes>
+//
+// where the sizes are those of the resource package linked with and without the filtering.
+
+func init() {
+	registerLocaleFilterBuildComponents(android.InitRegistrationContext)
+}
+
+func registerLocaleFilterBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("locale_filter", localeFilterSingletonFactory)
+}
+
+var PrepareForTestWithLocaleFilter = android.FixtureRegisterWithContext(registerLocaleFilterBuildComponents)
+
+// aaptLocaleConfigs converts locales in the PRODUCT_LOCALES format, for example en_US, to aapt2
+// configs, for example en-rUS.
+func aaptLocaleConfigs(locales []string) []string {
+	configs := make([]string, 0, len(locales))
+	for _, locale := range locales {
+		if parts := strings.SplitN(locale, "_", 2); len(parts) == 2 {
+			locale = parts[0] + "-r" + parts[1]
+		}
+		configs = append(configs, locale)
+	}
+	return android.FirstUniqueStrings(configs)
+}
+
+func localeFilterSingletonFactory() android.Singleton {
+	return &localeFilterSingleton{}
+}
+
+type localeFilterSingleton struct {
+	report android.WritablePath
+}
+
+func (s *localeFilterSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var lines []string
+	var inputs android.Paths
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() {
+			return
+		}
+		app, ok := m.(*AndroidApp)
+		if !ok || app.aapt.unfilteredPackage == nil {
+			return
+		}
+		lines = append(lines, strings.Join([]string{
+			ctx.ModuleName(m),
+			app.aapt.exportPackage.String(),
+			app.aapt.unfilteredPackage.String(),
+		}, "\t"))
+		inputs = append(inputs, app.aapt.exportPackage, app.aapt.unfilteredPackage)
+	})
+	if len(lines) == 0 {
+		return
+	}
+
+	entriesFile := android.PathForOutput(ctx, "locale_filter", "entries.tsv")
+	android.WriteFileRule(ctx, entriesFile, strings.Join(android.SortedUniqueStrings(lines), "\n"))
+
+	s.report = android.PathForOutput(ctx, "locale_filter", "locale_filter_savings.tsv")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	android.FileSizesCommand(rule, entriesFile, 1, inputs).
+		Text(`| awk -F '\t' -v OFS='\t' '{ print $1, $2, $3, $3 - $2 }' >`).
+		Output(s.report)
+	rule.Build("locale_filter_savings", "locale filter savings")
+
+	ctx.Phony("locale-filter-savings", s.report)
+}
+
+func (s *localeFilterSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.report != nil {
+		ctx.DistForGoal("locale-filter-savings", s.report)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*localeFilterSingleton)(nil)
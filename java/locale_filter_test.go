@@ -0,0 +1,76 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestProductLocalesFilter(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithLocaleFilter,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ProductLocales = []string{"en_US", "fr_FR", "en_US"}
+		}),
+	).RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			filter_product_locales: false,
+		}
+
+		android_test {
+			name: "baz",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	android.AssertCommandContainsFlagWithArg(t, "foo aapt2 link flags",
+		foo.Output("package-res.apk").Args["flags"], "-c", "en-rUS,fr-rFR")
+	unfiltered := foo.Output("unfiltered/package-res.apk")
+	android.AssertStringDoesNotContain(t, "foo unfiltered aapt2 link flags", unfiltered.Args["flags"], "en-rUS")
+
+	for _, name := range []string{"bar", "baz"} {
+		m := result.ModuleForTests(name, "android_common")
+		android.AssertStringDoesNotContain(t, name+" aapt2 link flags", m.Output("package-res.apk").Args["flags"], "en-rUS")
+		if m.MaybeOutput("unfiltered/package-res.apk").Rule != nil {
+			t.Errorf("%s should not have an unfiltered resource package", name)
+		}
+	}
+
+	report := result.SingletonForTests("locale_filter").Output("locale_filter/locale_filter_savings.tsv")
+	android.AssertPathsRelativeToTopEquals(t, "report inputs", []string{
+		"out/soong/.intermediates/foo/android_common/package-res.apk",
+		"out/soong/.intermediates/foo/android_common/unfiltered/package-res.apk",
+		"out/soong/locale_filter/entries.tsv",
+	}, report.Implicits)
+}
+
+func TestAaptLocaleConfigs(t *testing.T) {
+	android.AssertArrayString(t, "configs", []string{"en-rUS", "fr", "b+sr+Latn"},
+		aaptLocaleConfigs([]string{"en_US", "fr", "b+sr+Latn", "en_US"}))
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// The package boundary of a java module restricts the sources it compiles to the ones in its own
+// directory, so that the owners of a directory own all the code compiled into its modules. It is
+// set with the package_boundary property of the module, or of its defaults or soong_namespace.
+//
+// This singleton writes a report of the sources that modules compile from outside of their
+// directory, to help migrating directories to the strict package boundary. The report is a tab
+// separated file with one line per source:
+//
+//	<module> <dir> <source>
+
+const (
+	packageBoundaryNone   = "none"
+	packageBoundaryStrict = "strict"
+)
+
+func init() {
+	registerPackageBoundaryBuildComponents(android.InitRegistrationContext)
+}
+
+func registerPackageBoundaryBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("package_boundary_report", packageBoundaryReportSingletonFactory)
+}
+
+var PrepareForTestWithPackageBoundaryReport = android.FixtureRegisterWithContext(registerPackageBoundaryBuildComponents)
+
+// packageBoundary returns the package boundary of the module, from its package_boundary property
+// or from its soong_namespace.
+func packageBoundary(ctx android.ModuleContext, property *string) string {
+	if boundary := proptools.String(property); boundary != "" {
+		if boundary != packageBoundaryNone && boundary != packageBoundaryStrict {
+			ctx.PropertyErrorf("package_boundary", "%q is not a valid package boundary, must be %q or %q",
+				boundary, packageBoundaryNone, packageBoundaryStrict)
+		}
+		return boundary
+	}
+	if boundary := ctx.Namespace().PackageBoundary(); boundary != "" {
+		if boundary != packageBoundaryNone && boundary != packageBoundaryStrict {
+			ctx.ModuleErrorf("soong_namespace %q has invalid package_boundary %q, must be %q or %q",
+				ctx.Namespace().Path, boundary, packageBoundaryNone, packageBoundaryStrict)
+		}
+		return boundary
+	}
+	return packageBoundaryNone
+}
+
+// checkPackageBoundary returns the source files that are outside of the module directory, and
+// reports an error for each of them if the module has a strict package boundary. Generated
+// sources are owned by the module that generates them and are not checked.
+func checkPackageBoundary(ctx android.ModuleContext, boundary, property string, srcs android.Paths) android.Paths {
+	moduleDir := android.PathForModuleSrc(ctx).String()
+	var outside android.Paths
+	for _, src := range srcs {
+		if _, ok := src.(android.SourcePath); !ok {
+			continue
+		}
+		rel, err := filepath.Rel(moduleDir, src.String())
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			continue
+		}
+		if boundary == packageBoundaryStrict {
+			ctx.PropertyErrorf(property, "%s is outside of the module directory %s, which is not allowed with package_boundary: %q",
+				src, ctx.ModuleDir(), packageBoundaryStrict)
+		}
+		outside = append(outside, src)
+	}
+	return outside
+}
+
+// packageBoundaryReporter is implemented by modules that compile sources which can be outside of
+// their directory.
+type packageBoundaryReporter interface {
+	outsidePackageSources() android.Paths
+}
+
+func (j *Module) outsidePackageSources() android.Paths {
+	return j.outsidePackageSrcs
+}
+
+var _ packageBoundaryReporter = (*Module)(nil)
+
+func packageBoundaryReportSingletonFactory() android.Singleton {
+	return &packageBoundaryReportSingleton{}
+}
+
+type packageBoundaryReportSingleton struct {
+	report android.WritablePath
+}
+
+func (s *packageBoundaryReportSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if ctx.Config().UnbundledBuild() {
+		return
+	}
+
+	// Modules with multiple variants report the same sources, only keep one of them.
+	lines := make(map[string]bool)
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() {
+			return
+		}
+		reporter, ok := m.(packageBoundaryReporter)
+		if !ok {
+			return
+		}
+		for _, src := range reporter.outsidePackageSources() {
+			lines[strings.Join([]string{ctx.ModuleName(m), ctx.ModuleDir(m), src.String()}, "\t")] = true
+		}
+	})
+
+	s.report = android.PathForOutput(ctx, "package_boundary", "java_package_boundary_report.tsv")
+	android.WriteFileRule(ctx, s.report, strings.Join(android.SortedStringKeys(lines), "\n"))
+
+	ctx.Phony("java-package-boundary-report", s.report)
+}
+
+func (s *packageBoundaryReportSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.report != nil {
+		ctx.DistForGoal("java-package-boundary-report", s.report)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*packageBoundaryReportSingleton)(nil)
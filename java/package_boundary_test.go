@@ -0,0 +1,140 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+var prepareForPackageBoundaryTest = android.GroupFixturePreparers(
+	PrepareForTestWithJavaDefaultModules,
+	PrepareForTestWithPackageBoundaryReport,
+	android.PrepareForTestWithNamespace,
+	android.FixtureMergeMockFs(android.MockFS{
+		"common/c.java":  nil,
+		"foo/a.java":     nil,
+		"foo/sub/b.java": nil,
+	}),
+	android.FixtureAddTextFile("common/Android.bp", `
+		filegroup {
+			name: "common_srcs",
+			srcs: ["c.java"],
+		}
+	`),
+)
+
+func TestPackageBoundaryReport(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForPackageBoundaryTest,
+		android.FixtureAddTextFile("foo/Android.bp", `
+			java_library {
+				name: "foo",
+				srcs: ["a.java", "sub/b.java", ":common_srcs"],
+				sdk_version: "current",
+			}
+
+			java_library {
+				name: "bar",
+				srcs: ["a.java"],
+				sdk_version: "current",
+			}
+		`),
+	).RunTest(t)
+
+	report := result.SingletonForTests("package_boundary_report").
+		Output("out/soong/package_boundary/java_package_boundary_report.tsv")
+	android.AssertStringEquals(t, "report", "foo\tfoo\tcommon/c.java",
+		android.ContentFromFileRuleForTests(t, report))
+}
+
+func TestPackageBoundaryStrict(t *testing.T) {
+	testCases := []struct {
+		name        string
+		bp          string
+		expectedErr string
+	}{
+		{
+			name: "defaults",
+			bp: `
+				java_defaults {
+					name: "strict_defaults",
+					package_boundary: "strict",
+				}
+
+				java_library {
+					name: "foo",
+					defaults: ["strict_defaults"],
+					srcs: ["a.java", "sub/b.java", ":common_srcs"],
+					sdk_version: "current",
+				}`,
+			expectedErr: `srcs: common/c.java is outside of the module directory foo, which is not allowed with package_boundary: "strict"`,
+		},
+		{
+			name: "namespace",
+			bp: `
+				soong_namespace {
+					package_boundary: "strict",
+				}
+
+				java_library {
+					name: "foo",
+					srcs: ["a.java", ":common_srcs"],
+					sdk_version: "current",
+				}`,
+			expectedErr: `srcs: common/c.java is outside of the module directory foo, which is not allowed with package_boundary: "strict"`,
+		},
+		{
+			name: "invalid",
+			bp: `
+				java_library {
+					name: "foo",
+					srcs: ["a.java"],
+					package_boundary: "loose",
+					sdk_version: "current",
+				}`,
+			expectedErr: `package_boundary: "loose" is not a valid package boundary, must be "none" or "strict"`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			android.GroupFixturePreparers(
+				prepareForPackageBoundaryTest,
+				android.FixtureAddTextFile("foo/Android.bp", test.bp),
+			).
+				ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(test.expectedErr)).
+				RunTest(t)
+		})
+	}
+
+	// A module can opt out of the strict package boundary of its namespace.
+	android.GroupFixturePreparers(
+		prepareForPackageBoundaryTest,
+		android.FixtureAddTextFile("foo/Android.bp", `
+			soong_namespace {
+				package_boundary: "strict",
+			}
+
+			java_library {
+				name: "foo",
+				srcs: ["a.java", ":common_srcs"],
+				package_boundary: "none",
+				sdk_version: "current",
+			}
+		`),
+	).RunTest(t)
+}
@@ -15,6 +15,7 @@
 package java
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"android/soong/android"
@@ -57,6 +58,20 @@ type platformBootclasspathModule struct {
 
 	// Path to the monolithic hiddenapi-unsupported.csv file.
 	hiddenAPIMetadataCSV android.OutputPath
+
+	// The classpath elements used to generate the monolithic hidden API files, nil if hidden API
+	// processing is disabled.
+	classpathElements ClasspathElements
+
+	// Path to the report of the modules on the bootclasspath.
+	bootclasspathReport android.WritablePath
+
+	// Path to the report of the resources removed from the platform boot jars, nil unless
+	// DedupBootJars is set.
+	bootJarsDedupReport android.WritablePath
+
+	// The platform boot jars with their duplicate resources removed, nil unless DedupBootJars is set.
+	dedupedBootDexJarsByModule bootDexJarByModule
 }
 
 type platformBootclasspathProperties struct {
@@ -95,6 +110,13 @@ func (b *platformBootclasspathModule) OutputFiles(tag string) (android.Paths, er
 		return android.Paths{b.hiddenAPIIndexCSV}, nil
 	case "hiddenapi-metadata.csv":
 		return android.Paths{b.hiddenAPIMetadataCSV}, nil
+	case "bootclasspath-report.json":
+		return android.Paths{b.bootclasspathReport}, nil
+	case "boot-jars-dedup-report.txt":
+		if b.bootJarsDedupReport != nil {
+			return android.Paths{b.bootJarsDedupReport}, nil
+		}
+		return nil, nil
 	}
 
 	return nil, fmt.Errorf("unknown tag %s", tag)
@@ -159,6 +181,12 @@ func (b *platformBootclasspathModule) GenerateSingletonBuildActions(android.Sing
 
 func (d *platformBootclasspathModule) MakeVars(ctx android.MakeVarsContext) {
 	d.generateHiddenApiMakeVars(ctx)
+	if d.bootclasspathReport != nil {
+		ctx.DistForGoal("platform-bootclasspath-report", d.bootclasspathReport)
+	}
+	if d.bootJarsDedupReport != nil {
+		ctx.DistForGoal("platform-bootclasspath-report", d.bootJarsDedupReport)
+	}
 }
 
 func (b *platformBootclasspathModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
@@ -187,6 +215,14 @@ func (b *platformBootclasspathModule) GenerateAndroidBuildActions(ctx android.Mo
 	bootDexJarByModule := b.generateHiddenAPIBuildActions(ctx, b.configuredModules, b.fragments)
 	buildRuleForBootJarsPackageCheck(ctx, bootDexJarByModule)
 
+	b.generateBootclasspathReport(ctx, map[string][]android.Module{
+		"art":      artModules,
+		"platform": platformModules,
+		"apex":     apexModules,
+	})
+
+	b.dedupedBootDexJarsByModule = b.buildBootJarsDedup(ctx, platformModules)
+
 	// Nothing to do if skipping the dexpreopt of boot image jars.
 	if SkipDexpreoptBootJars(ctx) {
 		return
@@ -296,6 +332,7 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 
 	// Construct a list of ClasspathElement objects from the modules and fragments.
 	classpathElements := CreateClasspathElements(ctx, modules, fragments)
+	b.classpathElements = classpathElements
 
 	monolithicInfo := b.createAndProvideMonolithicHiddenAPIInfo(ctx, classpathElements)
 
@@ -315,7 +352,11 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 
 	// Generate the monolithic stub-flags.csv file.
 	stubFlags := hiddenAPISingletonPaths(ctx).stubFlags
-	buildRuleToGenerateHiddenAPIStubFlagsFile(ctx, "platform-bootclasspath-monolithic-hiddenapi-stub-flags", "monolithic hidden API stub flags", stubFlags, bootDexJarByModule.bootDexJars(), input, monolithicInfo.StubFlagSubsets)
+	if fragmentStubFlags, ok := incrementalHiddenAPIStubFlags(ctx, classpathElements); ok {
+		b.generateIncrementalHiddenAPIStubFlags(ctx, classpathElements, bootDexJarByModule, input, fragmentStubFlags, stubFlags, monolithicInfo.StubFlagSubsets)
+	} else {
+		buildRuleToGenerateHiddenAPIStubFlagsFile(ctx, "platform-bootclasspath-monolithic-hiddenapi-stub-flags", "monolithic hidden API stub flags", stubFlags, bootDexJarByModule.bootDexJars(), input, monolithicInfo.StubFlagSubsets)
+	}
 
 	// Generate the annotation-flags.csv file from all the module annotations.
 	annotationFlags := android.PathForModuleOut(ctx, "hiddenapi-monolithic", "annotation-flags-from-classes.csv")
@@ -328,7 +369,7 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 	allAnnotationFlagFiles := android.Paths{annotationFlags}
 	allAnnotationFlagFiles = append(allAnnotationFlagFiles, monolithicInfo.AnnotationFlagsPaths...)
 	allFlags := hiddenAPISingletonPaths(ctx).flags
-	buildRuleToGenerateHiddenApiFlags(ctx, "hiddenAPIFlagsFile", "monolithic hidden API flags", allFlags, stubFlags, allAnnotationFlagFiles, monolithicInfo.FlagsFilesByCategory, monolithicInfo.FlagSubsets, android.OptionalPath{})
+	buildRuleToGenerateHiddenApiFlags(ctx, "hiddenAPIFlagsFile", "monolithic hidden API flags", allFlags, stubFlags, allAnnotationFlagFiles, monolithicInfo.FlagsFilesByCategory, monolithicInfo.FlagOverrideFiles, monolithicInfo.FlagSubsets, android.OptionalPath{})
 
 	// Generate an intermediate monolithic hiddenapi-metadata.csv file directly from the annotations
 	// in the source code.
@@ -364,6 +405,94 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 	return bootDexJarByModule
 }
 
+// incrementalHiddenAPIStubFlags returns the paths to the stub flags generated by each of the
+// fragments and true if the monolithic stub flags can be generated incrementally from them, i.e.
+// SOONG_INCREMENTAL_HIDDENAPI_FLAGS=true and every fragment provides its stub flags. Prebuilt
+// fragments that predate the hidden_api.stub_flags property do not, in which case the monolithic
+// stub flags have to be generated from all the boot dex jars.
+func incrementalHiddenAPIStubFlags(ctx android.ModuleContext, classpathElements ClasspathElements) (android.Paths, bool) {
+	if !ctx.Config().IsEnvTrue("SOONG_INCREMENTAL_HIDDENAPI_FLAGS") {
+		return nil, false
+	}
+
+	var stubFlags android.Paths
+	for _, element := range classpathElements {
+		if e, ok := element.(*ClasspathFragmentElement); ok {
+			fragment := e.Module()
+			if !ctx.OtherModuleHasProvider(fragment, HiddenAPIInfoProvider) {
+				return nil, false
+			}
+			info := ctx.OtherModuleProvider(fragment, HiddenAPIInfoProvider).(HiddenAPIInfo)
+			if info.StubFlagsPath == nil {
+				return nil, false
+			}
+			stubFlags = append(stubFlags, info.StubFlagsPath)
+		}
+	}
+	return stubFlags, true
+}
+
+// generateIncrementalHiddenAPIStubFlags generates the monolithic stub flags by merging the stub
+// flags generated by each of the fragments with stub flags generated only for the libraries that
+// are not part of a fragment.
+//
+// Generating the stub flags from all the boot dex jars is one of the slowest steps of an
+// incremental build of the framework. The stub flags of a fragment only change when the fragment
+// does, so this limits the work done for an unchanged fragment to the merge.
+func (b *platformBootclasspathModule) generateIncrementalHiddenAPIStubFlags(ctx android.ModuleContext, classpathElements ClasspathElements,
+	bootDexJars bootDexJarByModule, input HiddenAPIFlagInput, fragmentStubFlags android.Paths, outputPath android.WritablePath,
+	stubFlagSubsets SignatureCsvSubsets) {
+
+	libraryBootDexJars := bootDexJarByModule{}
+	var fragments []android.Module
+	for _, element := range classpathElements {
+		switch e := element.(type) {
+		case *ClasspathLibraryElement:
+			name := android.RemoveOptionalPrebuiltPrefix(e.Module().Name())
+			if path, ok := bootDexJars[name]; ok {
+				libraryBootDexJars[name] = path
+			}
+		case *ClasspathFragmentElement:
+			fragments = append(fragments, e.Module())
+		}
+	}
+
+	// The libraries are processed in the same way as the contents of a fragment that depends on all
+	// the fragments, so that references to classes in the fragments are resolved using their stubs.
+	dependencies := newHiddenAPIInfo()
+	dependencies.mergeFromFragmentDeps(ctx, fragments)
+	input.DependencyStubDexJarsByScope = dependencies.TransitiveStubDexJarsByScope
+
+	libraryStubFlags := android.PathForModuleOut(ctx, "hiddenapi-monolithic", "stub-flags-from-libraries.csv")
+	buildRuleToGenerateHiddenAPIStubFlagsFile(ctx, "platform-bootclasspath-library-hiddenapi-stub-flags", "hidden API stub flags of the platform libraries", libraryStubFlags, libraryBootDexJars.bootDexJars(), input, nil)
+
+	// Merge the stub flags, which have no header so can't be merged with merge_csv, sorted by
+	// signature in the same order as `hiddenapi list`. A signature can be in several files, e.g. a
+	// class of a fragment that is also on the classpath of the libraries, but must have the same
+	// flags in all of them. Use restat so that the rules that consume the monolithic stub flags are
+	// not rerun if merging produces the same output.
+	tempPath := tempPathForRestat(ctx, outputPath)
+	rule := android.NewRuleBuilder(pctx, ctx)
+	command := rule.Command().
+		Text("LC_ALL=C sort -u").
+		Input(libraryStubFlags).
+		Inputs(fragmentStubFlags).
+		FlagWithOutput("-o ", tempPath)
+	rule.Command().
+		Text(`awk -F, 'seen[$1]++ { print "conflicting hidden API stub flags for " $1 > "/dev/stderr"; err = 1 } END { exit err }'`).
+		Text(tempPath.String())
+	commitChangeForRestat(rule, tempPath, outputPath)
+
+	// Validate the merged stub flags against the stub flags of each of the fragments in the same way
+	// as the stub flags generated from all the boot dex jars are.
+	if len(stubFlagSubsets) > 0 {
+		validFile := buildRuleValidateOverlappingCsvFiles(ctx, "platform-bootclasspath-monolithic-hiddenapi-stub-flags",
+			"monolithic hidden API stub flags", outputPath, stubFlagSubsets, HIDDENAPI_STUB_FLAGS_IMPL_FLAGS)
+		command.Validation(validFile)
+	}
+	rule.Build("platform-bootclasspath-monolithic-hiddenapi-stub-flags", "monolithic hidden API stub flags")
+}
+
 // createAndProvideMonolithicHiddenAPIInfo creates a MonolithicHiddenAPIInfo and provides it for
 // testing.
 func (b *platformBootclasspathModule) createAndProvideMonolithicHiddenAPIInfo(ctx android.ModuleContext, classpathElements ClasspathElements) MonolithicHiddenAPIInfo {
@@ -394,6 +523,96 @@ func (b *platformBootclasspathModule) buildRuleMergeCSV(ctx android.ModuleContex
 	rule.Build(desc, desc)
 }
 
+// PlatformBootclasspathReportEntry describes one of the modules on the bootclasspath in the report
+// generated by the platform_bootclasspath module. The report lists the modules in the order in
+// which they appear on the bootclasspath, so that changes to the bootclasspath closure, e.g. a new
+// jar or a jar that moved to a different apex, show up as a diff of the report.
+type PlatformBootclasspathReportEntry struct {
+	// The name of the module.
+	Module string `json:"module"`
+
+	// The boot jars list the module is configured in, one of "art", "platform" or "apex".
+	Kind string `json:"kind"`
+
+	// The apexes that contain the module, empty if it is part of the platform.
+	Apexes []string `json:"apexes,omitempty"`
+
+	// How the hidden API flags of the module are generated, either "fragment:<name>" when they are
+	// generated by the bootclasspath_fragment that contains the module, "monolithic" when they are
+	// generated by the platform_bootclasspath itself or "disabled" when hidden API processing is
+	// disabled.
+	HiddenAPI string `json:"hidden_api"`
+
+	// The API surfaces for which the module provides stubs, empty if it is not a java_sdk_library.
+	Stubs []string `json:"stubs,omitempty"`
+}
+
+// sdkLibraryScopePaths is implemented by java_sdk_library and java_sdk_library_import modules.
+type sdkLibraryScopePaths interface {
+	findScopePaths(scope *apiScope) *scopePaths
+}
+
+// generateBootclasspathReport generates a JSON report describing all the modules on the
+// bootclasspath, their apexes, the source of their hidden API flags and the availability of their
+// stubs.
+func (b *platformBootclasspathModule) generateBootclasspathReport(ctx android.ModuleContext, modulesByKind map[string][]android.Module) {
+	kindByModule := map[android.Module]string{}
+	for kind, modules := range modulesByKind {
+		for _, m := range modules {
+			kindByModule[m] = kind
+		}
+	}
+
+	fragmentByModule := map[android.Module]android.Module{}
+	for _, element := range b.classpathElements {
+		if fragmentElement, ok := element.(*ClasspathFragmentElement); ok {
+			for _, content := range fragmentElement.Contents {
+				fragmentByModule[content] = fragmentElement.Fragment
+			}
+		}
+	}
+
+	entries := []PlatformBootclasspathReportEntry{}
+	for _, m := range b.configuredModules {
+		entry := PlatformBootclasspathReportEntry{
+			Module: android.RemoveOptionalPrebuiltPrefix(ctx.OtherModuleName(m)),
+			Kind:   kindByModule[m],
+		}
+
+		apexInfo := ctx.OtherModuleProvider(m, android.ApexInfoProvider).(android.ApexInfo)
+		if !apexInfo.IsForPlatform() {
+			entry.Apexes = android.SortedUniqueStrings(apexInfo.InApexModules)
+		}
+
+		if b.classpathElements == nil {
+			entry.HiddenAPI = "disabled"
+		} else if fragment, ok := fragmentByModule[m]; ok {
+			entry.HiddenAPI = "fragment:" + android.RemoveOptionalPrebuiltPrefix(ctx.OtherModuleName(fragment))
+		} else {
+			entry.HiddenAPI = "monolithic"
+		}
+
+		if sdkLibrary, ok := m.(sdkLibraryScopePaths); ok {
+			for _, scope := range allApiScopes {
+				if sdkLibrary.findScopePaths(scope) != nil {
+					entry.Stubs = append(entry.Stubs, scope.name)
+				}
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	report, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal the bootclasspath report: %s", err)
+		return
+	}
+	b.bootclasspathReport = android.PathForModuleOut(ctx, "platform-bootclasspath-report.json")
+	android.WriteFileRule(ctx, b.bootclasspathReport, string(report))
+	ctx.Phony("platform-bootclasspath-report", b.bootclasspathReport)
+}
+
 // generateHiddenApiMakeVars generates make variables needed by hidden API related make rules, e.g.
 // veridex and run-appcompat.
 func (b *platformBootclasspathModule) generateHiddenApiMakeVars(ctx android.MakeVarsContext) {
@@ -425,6 +644,10 @@ func (b *platformBootclasspathModule) generateBootImageBuildActions(ctx android.
 
 	// Copy platform module dex jars to their predefined locations.
 	platformBootDexJarsByModule := extractEncodedDexJarsFromModules(ctx, platformModules)
+	if b.dedupedBootDexJarsByModule != nil {
+		// Compile the jars that are installed into the boot image.
+		platformBootDexJarsByModule = b.dedupedBootDexJarsByModule
+	}
 	copyBootJarsToPredefinedLocations(ctx, platformBootDexJarsByModule, imageConfig.dexPathsByModule)
 
 	// Copy apex module dex jars to their predefined locations.
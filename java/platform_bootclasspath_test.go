@@ -356,3 +356,145 @@ func TestPlatformBootclasspath_HiddenAPIMonolithicFiles(t *testing.T) {
 		out/soong/.intermediates/myplatform-bootclasspath/android_common/hiddenapi-monolithic/index-from-classes.csv
 	`, rule)
 }
+
+func TestPlatformBootclasspath_HiddenAPIFlagOverrides(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		hiddenApiFixtureFactory,
+		FixtureConfigureBootJars("platform:foo", "platform:bar"),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			compile_dex: true,
+			host_supported: true,
+			hiddenapi_flag_overrides: {
+				blocked: ["foo-blocked.txt"],
+				max_target_o_low_priority: ["foo-max-target-o.txt"],
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["a.java"],
+			compile_dex: true,
+		}
+
+		platform_bootclasspath {
+			name: "myplatform-bootclasspath",
+			hidden_api: {
+				unsupported: ["unsupported.txt"],
+			},
+		}
+	`)
+
+	platformBootclasspath := result.ModuleForTests("myplatform-bootclasspath", "android_common")
+
+	// The override files of libraries that are not in a fragment are merged into the monolithic
+	// flags.
+	CheckHiddenAPIFlagOverrideFiles(t, result, "monolithic", `
+		foo-blocked.txt
+		foo-max-target-o.txt
+	`, platformBootclasspath.Module())
+
+	rule := platformBootclasspath.Rule("hiddenAPIFlagsFileFlagOverrides")
+	CheckHiddenAPIRuleInputs(t, "monolithic flag override conflicts", `
+		foo-blocked.txt
+		unsupported.txt
+	`, rule)
+
+	allFlags := platformBootclasspath.Output("out/soong/hiddenapi/hiddenapi-flags.csv")
+	android.AssertPathsRelativeToTopEquals(t, "monolithic flags validations",
+		[]string{"out/soong/hiddenapi/hiddenapi-flags.flag-overrides.valid"}, allFlags.Validations)
+
+	// Host variants cannot be boot jars so they ignore the override files.
+	hostFoo := result.ModuleForTests("foo", result.Config.BuildOSCommonTarget.String()).Module().(*Library)
+	android.AssertIntEquals(t, "host flag overrides", 0, len(hostFoo.flagOverrides()))
+}
+
+func TestPlatformBootclasspath_Report(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		hiddenApiFixtureFactory,
+		PrepareForTestWithJavaSdkLibraryFiles,
+		FixtureWithLastReleaseApis("bar"),
+		FixtureConfigureBootJars("platform:foo", "platform:bar"),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			compile_dex: true,
+		}
+
+		java_sdk_library {
+			name: "bar",
+			srcs: ["a.java"],
+			compile_dex: true,
+		}
+
+		platform_bootclasspath {
+			name: "myplatform-bootclasspath",
+		}
+	`)
+
+	CheckPlatformBootclasspathReport(t, result, "myplatform-bootclasspath", []PlatformBootclasspathReportEntry{
+		{Module: "foo", Kind: "platform", HiddenAPI: "monolithic"},
+		{Module: "bar", Kind: "platform", HiddenAPI: "monolithic", Stubs: []string{"public", "system", "test"}},
+	})
+}
+
+func TestPlatformBootclasspath_DedupBootJars(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForTestWithPlatformBootclasspath,
+		FixtureConfigureBootJars("platform:foo", "platform:bar"),
+		android.PrepareForTestWithAndroidMk,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.DedupBootJars = true
+		}),
+	).RunTestWithBp(t, `
+		platform_bootclasspath {
+			name: "platform-bootclasspath",
+		}
+
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+			installable: true,
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["a.java"],
+			system_modules: "none",
+			sdk_version: "none",
+			compile_dex: true,
+			installable: true,
+		}
+	`)
+
+	pbcp := result.ModuleForTests("platform-bootclasspath", "android_common")
+
+	// Test that foo is not deduplicated against any jar, and bar against foo.
+	fooDedup := pbcp.Rule("boot_jars_dedup_foo")
+	android.AssertStringDoesNotContain(t, "foo dedup command", fooDedup.RuleParams.Command, "--earlier-jar")
+	fooDexJar := result.ModuleForTests("foo", "android_common").Module().(*Library).DexJarBuildPath().Path()
+	barDedup := pbcp.Rule("boot_jars_dedup_bar")
+	android.AssertStringDoesContain(t, "bar dedup command", barDedup.RuleParams.Command,
+		"--earlier-jar "+android.PathRelativeToTop(fooDexJar))
+	android.AssertStringDoesContain(t, "bar dedup command", barDedup.RuleParams.Command,
+		"--report out/soong/.intermediates/platform-bootclasspath/android_common/boot_jars_dedup/bar.txt")
+
+	// Test that the deduplicated jar is installed by platform-bootclasspath instead of foo.
+	pbcp.Output("out/soong/target/product/test_device/system/framework/foo.jar")
+	foo := result.ModuleForTests("foo", "android_common").Module()
+	entries := android.AndroidMkEntriesForTest(t, result.TestContext, foo)[0]
+	android.AssertStringListContains(t, "foo uninstallable", entries.EntryMap["LOCAL_UNINSTALLABLE_MODULE"], "true")
+
+	// Test that the reports of the jars are combined in boot classpath order.
+	report := pbcp.Output("boot_jars_dedup/report.txt")
+	android.AssertPathsRelativeToTopEquals(t, "report inputs", []string{
+		"out/soong/.intermediates/platform-bootclasspath/android_common/boot_jars_dedup/foo.txt",
+		"out/soong/.intermediates/platform-bootclasspath/android_common/boot_jars_dedup/bar.txt",
+	}, report.Inputs)
+}
@@ -55,6 +55,35 @@ type PluginProperties struct {
 	// This necessitates disabling the turbine optimization on modules that use this plugin, which will reduce
 	// parallelism and cause more recompilation for modules that depend on modules that use this plugin.
 	Generates_api *bool
+
+	// If true, the annotation processor is run in its own javac pass over the java sources of each module that
+	// uses it, and only the sources and resources it declares are tracked as its outputs.  This improves
+	// incrementality, as only that pass is rerun when the annotation processor changes, and the generated sources
+	// are visible to turbine even if the annotation processor generates API.  Requires processor_class.
+	Isolated *bool
+
+	// If true, the isolated annotation processor generates resources in addition to sources, which are added to
+	// the jar of the modules that use it.  An isolated annotation processor that generates undeclared resources
+	// fails the build.
+	Generates_resources *bool
+}
+
+// isolatedPlugin is an annotation processor that runs in its own javac pass.
+type isolatedPlugin struct {
+	name               string
+	jars               android.Paths
+	processorClass     string
+	generatesResources bool
+}
+
+func (p *Plugin) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if Bool(p.pluginProperties.Isolated) && p.pluginProperties.Processor_class == nil {
+		ctx.PropertyErrorf("isolated", "requires processor_class to be set")
+	}
+	if Bool(p.pluginProperties.Generates_resources) && !Bool(p.pluginProperties.Isolated) {
+		ctx.PropertyErrorf("generates_resources", "is only supported with isolated: true")
+	}
+	p.Library.GenerateAndroidBuildActions(ctx)
 }
 
 type pluginAttributes struct {
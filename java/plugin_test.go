@@ -16,6 +16,8 @@ package java
 
 import (
 	"testing"
+
+	"android/soong/android"
 )
 
 func TestNoPlugin(t *testing.T) {
@@ -120,3 +122,85 @@ func TestPluginGeneratesApi(t *testing.T) {
 		t.Errorf("foo processor %q != '-processor com.bar'", javac.Args["processor"])
 	}
 }
+
+func TestIsolatedPlugin(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			plugins: ["bar", "baz", "qux"],
+		}
+
+		java_plugin {
+			name: "bar",
+			processor_class: "com.bar",
+			generates_api: true,
+			isolated: true,
+			srcs: ["b.java"],
+		}
+
+		java_plugin {
+			name: "baz",
+			processor_class: "com.baz",
+			isolated: true,
+			generates_resources: true,
+			srcs: ["b.java"],
+		}
+
+		java_plugin {
+			name: "qux",
+			processor_class: "com.qux",
+			srcs: ["b.java"],
+		}
+	`)
+
+	buildOS := result.Config.BuildOS.String()
+	foo := result.ModuleForTests("foo", "android_common")
+	bar := result.ModuleForTests("bar", buildOS+"_common").Rule("javac").Output
+	qux := result.ModuleForTests("qux", buildOS+"_common").Rule("javac").Output
+
+	// Isolated annotation processors that generate API don't disable turbine.
+	turbine := foo.Rule("turbine")
+	barProcessor := foo.Output("annotation_processors/bar/bar.srcjar")
+	android.AssertStringEquals(t, "bar processor", "com.bar", barProcessor.Args["processor"])
+	android.AssertStringEquals(t, "bar processorpath", "-processorpath "+bar.String(), barProcessor.Args["processorpath"])
+	android.AssertStringEquals(t, "bar resources", "", barProcessor.Args["resJar"])
+	android.AssertPathsRelativeToTopEquals(t, "bar sources", []string{"a.java"}, barProcessor.Inputs)
+	android.AssertStringDoesContain(t, "turbine srcjars", turbine.Args["srcJars"], barProcessor.Output.String())
+
+	bazProcessor := foo.Output("annotation_processors/baz/baz.srcjar")
+	bazResJar := foo.Output("annotation_processors/baz/baz-res.jar")
+	android.AssertStringEquals(t, "baz resources", bazResJar.Output.String(), bazProcessor.Args["resJar"])
+	android.AssertStringListContains(t, "foo resources",
+		foo.Output("withres/foo.jar").Inputs.Strings(), bazResJar.Output.String())
+
+	// The javac pass only runs the annotation processors that are not isolated.
+	javac := foo.Rule("javac")
+	android.AssertStringEquals(t, "javac processor", "-processor com.qux", javac.Args["processor"])
+	android.AssertStringEquals(t, "javac processorpath", "-processorpath "+qux.String(), javac.Args["processorpath"])
+	android.AssertStringDoesContain(t, "javac srcjars", javac.Args["srcJars"], bazProcessor.Output.String())
+}
+
+func TestIsolatedPluginErrors(t *testing.T) {
+	android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+	).ExtendWithErrorHandler(android.FixtureExpectsAllErrorsToMatchAPattern([]string{
+		`module "bar" variant "[^"]*": isolated: requires processor_class to be set`,
+		`module "baz" variant "[^"]*": generates_resources: is only supported with isolated: true`,
+	})).RunTestWithBp(t, `
+		java_plugin {
+			name: "bar",
+			isolated: true,
+			srcs: ["b.java"],
+		}
+
+		java_plugin {
+			name: "baz",
+			processor_class: "com.baz",
+			generates_resources: true,
+			srcs: ["b.java"],
+		}
+	`)
+}
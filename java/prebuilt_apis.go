@@ -15,8 +15,10 @@
 package java
 
 import (
+	"bufio"
 	"fmt"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -55,15 +57,77 @@ type prebuiltApisProperties struct {
 
 	// If set to true, compile dex for java_import modules. Defaults to false.
 	Imports_compile_dex *bool
+
+	// Index file listing the jar and api txt files under api_dirs, extensions_dir and
+	// next_api_dir, one path relative to this directory per line, as generated by
+	// gen_prebuilt_apis_index. If set, modules are created from the files in the index instead of
+	// globbing the directories, which is much faster for trees with many api levels. The index
+	// must be regenerated whenever files are added or removed, which is verified by checkbuild.
+	Index *string
 }
 
 type prebuiltApis struct {
 	android.ModuleBase
 	properties prebuiltApisProperties
+
+	// files listed in the index, or nil if there is no index
+	indexedFiles []string
 }
 
+var prebuiltApisScopes = []string{"public", "system", "test", "core", "module-lib", "system-server"}
+
 func (module *prebuiltApis) GenerateAndroidBuildActions(ctx android.ModuleContext) {
-	// no need to implement
+	if module.indexedFiles != nil {
+		module.checkIndex(ctx)
+	}
+}
+
+// checkIndex verifies at build time that the index still lists exactly the jar and api txt files
+// in the directory of the module, which can't be done while creating the modules without globbing
+// the directories the index is meant to avoid. The check depends on the directories the files are
+// in, whose modification times change whenever files are added to or removed from them.
+func (module *prebuiltApis) checkIndex(ctx android.ModuleContext) {
+	dirs := []string{"."}
+	addDir := func(dir string) {
+		for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, f := range module.indexedFiles {
+		addDir(path.Dir(f))
+	}
+	roots := append([]string(nil), module.properties.Api_dirs...)
+	if nextApiDir := String(module.properties.Next_api_dir); nextApiDir != "" {
+		roots = append(roots, nextApiDir)
+	}
+	if extensionsDir := String(module.properties.Extensions_dir); extensionsDir != "" {
+		roots = append(roots, extensionsDir)
+	}
+	for _, root := range roots {
+		addDir(root)
+		for _, scope := range prebuiltApisScopes {
+			addDir(path.Join(root, scope, "api"))
+		}
+	}
+
+	var implicits android.Paths
+	for _, dir := range android.SortedUniqueStrings(dirs) {
+		if p := android.ExistentPathForSource(ctx, ctx.ModuleDir(), dir); p.Valid() {
+			implicits = append(implicits, p.Path())
+		}
+	}
+
+	timestamp := android.PathForModuleOut(ctx, "index_check.timestamp")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("gen_prebuilt_apis_index").
+		FlagWithInput("-check ", android.PathForModuleSrc(ctx, String(module.properties.Index))).
+		FlagWithOutput("-o ", timestamp).
+		Text(ctx.ModuleDir()).
+		Implicits(implicits)
+	rule.Build("prebuilt_apis_index_check", "check prebuilt_apis index")
+
+	ctx.CheckbuildFile(timestamp)
 }
 
 // parsePrebuiltPath parses the relevant variables out of a variety of paths, e.g.
@@ -121,6 +185,12 @@ func createImport(mctx android.LoadHookContext, module, scope, version, path, sd
 	mctx.CreateModule(ImportFactory, &props)
 }
 
+// prebuiltExtensionApiModuleName returns the name of the module that provides the API file of the
+// module in the scope that was finalized in the given SDK extension version.
+func prebuiltExtensionApiModuleName(module, scope string, version int) string {
+	return fmt.Sprintf("%s.api.%s.extension_%d", module, scope, version)
+}
+
 func createApiModule(mctx android.LoadHookContext, name string, path string) {
 	genruleProps := struct {
 		Name *string
@@ -135,6 +205,35 @@ func createApiModule(mctx android.LoadHookContext, name string, path string) {
 	mctx.CreateModule(genrule.GenRuleFactory, &genruleProps)
 }
 
+// prebuiltApiHistoryModuleName returns the name of the filegroup that contains all the finalized
+// API files of the module in the scope, for the API levels and the SDK extension versions.
+func prebuiltApiHistoryModuleName(module, scope string) string {
+	return module + ".api." + scope + ".history"
+}
+
+func createApiHistoryModule(mctx android.LoadHookContext, name string, paths []string) {
+	filegroupProps := struct {
+		Name *string
+		Srcs []string
+	}{}
+	filegroupProps.Name = proptools.StringPtr(name)
+	filegroupProps.Srcs = paths
+	mctx.CreateModule(android.FileGroupFactory, &filegroupProps)
+}
+
+// parseApiHistoryPath returns the version an API file in an api history filegroup was finalized
+// in, and whether it is an SDK extension version rather than an API level. The path is relative to
+// the prebuilt_apis module, i.e. <version>/<scope>/api/<module>.txt for API levels and
+// <extensions-dir>/<version>/<scope>/api/<module>.txt for SDK extension versions.
+func parseApiHistoryPath(p string) (version int, extension bool, err error) {
+	elements := strings.Split(p, "/")
+	if len(elements) < 4 {
+		return 0, false, fmt.Errorf("invalid api file path %q", p)
+	}
+	version, err = strconv.Atoi(elements[len(elements)-4])
+	return version, len(elements) > 4, err
+}
+
 func createEmptyFile(mctx android.LoadHookContext, name string) {
 	props := struct {
 		Name *string
@@ -147,12 +246,41 @@ func createEmptyFile(mctx android.LoadHookContext, name string) {
 	mctx.CreateModule(genrule.GenRuleFactory, &props)
 }
 
+// readIndex reads the files listed in the index file of the prebuilt_apis module, if any.
+func readIndex(mctx android.LoadHookContext, p *prebuiltApis) {
+	index := String(p.properties.Index)
+	if index == "" {
+		return
+	}
+	indexPath := filepath.Join(mctx.ModuleDir(), index)
+	mctx.AddNinjaFileDeps(indexPath)
+	r, err := mctx.Config().Fs().Open(indexPath)
+	if err != nil {
+		mctx.PropertyErrorf("index", "failed to open %q: %s", indexPath, err)
+		return
+	}
+	defer r.Close()
+
+	p.indexedFiles = []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.indexedFiles = append(p.indexedFiles, line)
+	}
+	if err := scanner.Err(); err != nil {
+		mctx.PropertyErrorf("index", "failed to read %q: %s", indexPath, err)
+	}
+}
+
 // globApiDirs collects all the files in all api_dirs and all scopes that match the given glob, e.g. '*.jar' or 'api/*.txt'.
 // <api-dir>/<scope>/<glob> for all api-dir and scope.
 func globApiDirs(mctx android.LoadHookContext, p *prebuiltApis, api_dir_glob string) []string {
 	var files []string
 	for _, apiver := range p.properties.Api_dirs {
-		files = append(files, globScopeDir(mctx, apiver, api_dir_glob)...)
+		files = append(files, globScopeDir(mctx, p, apiver, api_dir_glob)...)
 	}
 	return files
 }
@@ -161,15 +289,25 @@ func globApiDirs(mctx android.LoadHookContext, p *prebuiltApis, api_dir_glob str
 // <extension-dir>/<version>/<scope>/<glob> for all version and scope.
 func globExtensionDirs(mctx android.LoadHookContext, p *prebuiltApis, extension_dir_glob string) []string {
 	// <extensions-dir>/<num>/<extension-dir-glob>
-	return globScopeDir(mctx, *p.properties.Extensions_dir+"/*", extension_dir_glob)
+	return globScopeDir(mctx, p, *p.properties.Extensions_dir+"/*", extension_dir_glob)
 }
 
 // globScopeDir collects all the files in the given subdir across all scopes that match the given glob, e.g. '*.jar' or 'api/*.txt'.
-// <subdir>/<scope>/<glob> for all scope.
-func globScopeDir(mctx android.LoadHookContext, subdir string, subdir_glob string) []string {
+// <subdir>/<scope>/<glob> for all scope. If the module has an index the files are matched against
+// it instead of the filesystem.
+func globScopeDir(mctx android.LoadHookContext, p *prebuiltApis, subdir string, subdir_glob string) []string {
 	var files []string
 	dir := mctx.ModuleDir() + "/" + subdir
-	for _, scope := range []string{"public", "system", "test", "core", "module-lib", "system-server"} {
+	for _, scope := range prebuiltApisScopes {
+		if p.indexedFiles != nil {
+			pattern := fmt.Sprintf("%s/%s/%s", subdir, scope, subdir_glob)
+			for _, f := range p.indexedFiles {
+				if matched, _ := filepath.Match(pattern, f); matched {
+					files = append(files, f)
+				}
+			}
+			continue
+		}
 		glob := fmt.Sprintf("%s/%s/%s", dir, scope, subdir_glob)
 		vfiles, err := mctx.GlobWithDeps(glob, nil)
 		if err != nil {
@@ -223,9 +361,12 @@ func prebuiltApiFiles(mctx android.LoadHookContext, p *prebuiltApis) {
 	apiModuleName := func(module, scope, version string) string {
 		return module + ".api." + scope + "." + version
 	}
+	// Collect all the versions of the api file of each (<module>, <scope>) pair.
+	history := make(map[string][]string)
 	for _, f := range apiLevelFiles {
 		module, version, scope := parseFinalizedPrebuiltPath(mctx, f)
 		createApiModule(mctx, apiModuleName(module, scope, strconv.Itoa(version)), f)
+		history[module+"."+scope] = append(history[module+"."+scope], f)
 	}
 
 	// Figure out the latest version of each module/scope
@@ -253,6 +394,11 @@ func prebuiltApiFiles(mctx android.LoadHookContext, p *prebuiltApis) {
 	latest := getLatest(apiLevelFiles)
 	if p.properties.Extensions_dir != nil {
 		extensionApiFiles := globExtensionDirs(mctx, p, "api/*.txt")
+		for _, f := range extensionApiFiles {
+			module, version, scope := parseFinalizedPrebuiltPath(mctx, f)
+			createApiModule(mctx, prebuiltExtensionApiModuleName(module, scope, version), f)
+			history[module+"."+scope] = append(history[module+"."+scope], f)
+		}
 		for k, v := range getLatest(extensionApiFiles) {
 			if v.version > mctx.Config().PlatformBaseSdkExtensionVersion() {
 				if _, exists := latest[k]; !exists {
@@ -268,12 +414,17 @@ func prebuiltApiFiles(mctx android.LoadHookContext, p *prebuiltApis) {
 		info := latest[k]
 		name := apiModuleName(info.module, info.scope, "latest")
 		createApiModule(mctx, name, info.path)
+
+		// Create the api history used to generate the api tracking database of the library.
+		if !strings.HasSuffix(info.module, "-removed") {
+			createApiHistoryModule(mctx, prebuiltApiHistoryModuleName(info.module, info.scope), history[k])
+		}
 	}
 
 	// Create incompatibilities tracking files for all modules, if we have a "next" api.
 	incompatibilities := make(map[string]bool)
 	if nextApiDir := String(p.properties.Next_api_dir); nextApiDir != "" {
-		files := globScopeDir(mctx, nextApiDir, "api/*incompatibilities.txt")
+		files := globScopeDir(mctx, p, nextApiDir, "api/*incompatibilities.txt")
 		for _, f := range files {
 			filename, _, scope := parsePrebuiltPath(mctx, f)
 			referencedModule := strings.TrimSuffix(filename, "-incompatibilities")
@@ -293,6 +444,10 @@ func prebuiltApiFiles(mctx android.LoadHookContext, p *prebuiltApis) {
 
 func createPrebuiltApiModules(mctx android.LoadHookContext) {
 	if p, ok := mctx.Module().(*prebuiltApis); ok {
+		readIndex(mctx, p)
+		if mctx.Failed() {
+			return
+		}
 		prebuiltApiFiles(mctx, p)
 		prebuiltSdkStubs(mctx, p)
 	}
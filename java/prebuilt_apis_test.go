@@ -90,3 +90,137 @@ func TestPrebuiltApis_WithExtensions(t *testing.T) {
 	android.AssertStringEquals(t, "Expected latest = api level 32", "prebuilts/sdk/32/public/api/foo.txt", foo_input)
 	android.AssertStringEquals(t, "Expected latest = api level 32", "prebuilts/sdk/32/public/api/bar.txt", bar_input)
 }
+
+func TestPrebuiltApis_History(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		FixtureWithPrebuiltApisAndExtensions(map[string][]string{
+			"31": {"foo"},
+			"32": {"foo"},
+		}, map[string][]string{
+			"2": {"foo"},
+		}),
+	).RunTest(t)
+
+	history := result.ModuleForTests("foo.api.public.history", "").Module().(android.SourceFileProducer)
+	android.AssertPathsRelativeToTopEquals(t, "foo public history", []string{
+		"prebuilts/sdk/31/public/api/foo.txt",
+		"prebuilts/sdk/32/public/api/foo.txt",
+		"prebuilts/sdk/extensions/2/public/api/foo.txt",
+	}, history.Srcs())
+
+	var modules []string
+	result.VisitAllModules(func(module blueprint.Module) {
+		modules = append(modules, module.Name())
+	})
+	android.AssertStringListDoesNotContain(t, "modules", modules, "foo-removed.api.public.history")
+	android.AssertStringListDoesNotContain(t, "modules", modules, "foo-incompatibilities.api.public.history")
+
+	for _, test := range []struct {
+		path      string
+		version   int
+		extension bool
+	}{
+		{"31/public/api/foo.txt", 31, false},
+		{"extensions/2/public/api/foo.txt", 2, true},
+	} {
+		version, extension, err := parseApiHistoryPath(test.path)
+		android.AssertSame(t, "error", nil, err)
+		android.AssertIntEquals(t, test.path+" version", test.version, version)
+		android.AssertBoolEquals(t, test.path+" extension", test.extension, extension)
+	}
+}
+
+func TestPrebuiltApis_FromApiLevels(t *testing.T) {
+	upsideDownCake := android.PreviewApiLevelForTest("UpsideDownCake", 0)
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		FixtureWithPrebuiltApisFromApiLevels(map[android.ApiLevel][]string{
+			android.ApiLevelForTest("33"): {"foo"},
+			upsideDownCake:                {"foo"},
+		}),
+	).RunTest(t)
+
+	android.AssertArrayString(t, "active codenames", []string{"UpsideDownCake"},
+		result.Config.PlatformVersionActiveCodenames())
+
+	apiLevel, err := android.ApiLevelFromUserWithConfig(result.Config, "UpsideDownCake")
+	android.AssertSame(t, "error", nil, err)
+	android.AssertBoolEquals(t, "codename maps to the preview", true, apiLevel.EqualTo(upsideDownCake))
+
+	// Jars are created for the preview but, as for current, it has no finalized API files.
+	var modules []string
+	result.VisitAllModules(func(module blueprint.Module) {
+		modules = append(modules, module.Name())
+	})
+	android.AssertStringListContains(t, "modules", modules, "sdk_public_UpsideDownCake_foo")
+	android.AssertStringListContains(t, "modules", modules, "foo.api.public.33")
+	android.AssertStringListDoesNotContain(t, "modules", modules, "foo.api.public.UpsideDownCake")
+}
+
+func TestPrebuiltApis_Index(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureAddTextFile("indexed_sdk/Android.bp", `
+			prebuilt_apis {
+				name: "indexed_sdk",
+				api_dirs: ["30", "31"],
+				index: "prebuilt_apis.index",
+			}
+		`),
+		android.FixtureAddTextFile("indexed_sdk/prebuilt_apis.index", `
+# Generated by gen_prebuilt_apis_index indexed_sdk
+30/public/api/indexed_foo.txt
+30/public/indexed_foo.jar
+31/public/api/indexed_foo.txt
+31/system/api/indexed_foo.txt
+31/system/indexed_foo.jar
+`),
+		android.FixtureMergeMockFs(android.MockFS{
+			// Not in the index, so ignored.
+			"indexed_sdk/31/public/indexed_bar.jar": nil,
+		}),
+	).RunTest(t)
+
+	var modules []string
+	result.VisitAllModules(func(module blueprint.Module) {
+		name := android.RemoveOptionalPrebuiltPrefix(module.Name())
+		if strings.Contains(name, "indexed_") {
+			modules = append(modules, name)
+		}
+	})
+	modules = android.SortedUniqueStrings(modules)
+	android.AssertArrayString(t, "indexed modules", []string{
+		"indexed_foo-incompatibilities.api.public.latest",
+		"indexed_foo-incompatibilities.api.system.latest",
+		"indexed_foo.api.public.30",
+		"indexed_foo.api.public.31",
+		"indexed_foo.api.public.history",
+		"indexed_foo.api.public.latest",
+		"indexed_foo.api.system.31",
+		"indexed_foo.api.system.history",
+		"indexed_foo.api.system.latest",
+		"indexed_sdk",
+		"indexed_sdk_public_30_indexed_foo",
+		"indexed_sdk_system_31_indexed_foo",
+	}, modules)
+
+	android.AssertStringEquals(t, "latest public api", "indexed_sdk/31/public/api/indexed_foo.txt",
+		result.ModuleForTests("indexed_foo.api.public.latest", "").Rule("generator").Implicits[0].String())
+
+	check := result.ModuleForTests("indexed_sdk", "").Output("index_check.timestamp")
+	android.AssertStringDoesContain(t, "index check command", check.RuleParams.Command,
+		"-check indexed_sdk/prebuilt_apis.index")
+	android.AssertPathsRelativeToTopEquals(t, "index check inputs", []string{
+		"indexed_sdk",
+		"indexed_sdk/30",
+		"indexed_sdk/30/public",
+		"indexed_sdk/30/public/api",
+		"indexed_sdk/31",
+		"indexed_sdk/31/public",
+		"indexed_sdk/31/public/api",
+		"indexed_sdk/31/system",
+		"indexed_sdk/31/system/api",
+		"indexed_sdk/prebuilt_apis.index",
+	}, check.Implicits)
+}
@@ -32,6 +32,7 @@ type RuntimeResourceOverlay struct {
 	android.ModuleBase
 	android.DefaultableModuleBase
 	android.OverridableModuleBase
+	TransparencyLog
 	aapt
 
 	properties            RuntimeResourceOverlayProperties
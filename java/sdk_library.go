@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -59,6 +60,23 @@ func (tag scopeDependencyTag) ReplaceSourceWithPrebuilt() bool {
 	return false
 }
 
+// A tag to associate a dependency on the filegroup of the finalized API files of the library with
+// a specific api scope.
+type apiHistoryDependencyTag struct {
+	blueprint.BaseDependencyTag
+	apiScope *apiScope
+}
+
+// ApiTrackingInfo contains the api tracking databases of a java_sdk_library.
+type ApiTrackingInfo struct {
+	// Databases maps the name of each api scope with finalized API files to the JSON database
+	// that maps every API symbol of the scope to the API level, or the SDK extension version, it
+	// was introduced in.
+	Databases map[string]android.Path
+}
+
+var ApiTrackingInfoProvider = blueprint.NewProvider(ApiTrackingInfo{})
+
 // Provides information about an api scope, e.g. public, system, test.
 type apiScope struct {
 	// The name of the api scope, e.g. public, system, test
@@ -424,6 +442,11 @@ type sdkLibraryProperties struct {
 	// a list of top-level directories containing Java stub files to merge show/hide annotations from.
 	Merge_inclusion_annotations_dirs []string
 
+	// If set to true then the lint reports of the implementation library are copied into the sdk
+	// snapshot, so that the java_sdk_library_import provides them when it is preferred. Defaults to
+	// false.
+	Export_lint_reports *bool
+
 	// If set to true then don't create dist rules.
 	No_dist *bool
 
@@ -539,6 +562,9 @@ type scopePaths struct {
 
 	// Extracted annotations.
 	annotationsZip android.OptionalPath
+
+	// The database of the API levels the API symbols were introduced in.
+	apiTrackingDatabase android.OptionalPath
 }
 
 func (paths *scopePaths) extractStubsLibraryInfoFromDependency(ctx android.ModuleContext, dep android.Module) error {
@@ -758,6 +784,8 @@ const (
 	removedApiTxtComponentName = "removed-api.txt"
 
 	annotationsComponentName = "annotations.zip"
+
+	apiTrackingComponentName = "api-tracking.json"
 )
 
 // A regular expression to match tags that reference a specific stubs component.
@@ -776,7 +804,7 @@ var tagSplitter = func() *regexp.Regexp {
 	scopesRegexp := choice(allScopeNames...)
 
 	// Regular expression to match one of the components.
-	componentsRegexp := choice(stubsSourceComponentName, apiTxtComponentName, removedApiTxtComponentName, annotationsComponentName)
+	componentsRegexp := choice(stubsSourceComponentName, apiTxtComponentName, removedApiTxtComponentName, annotationsComponentName, apiTrackingComponentName)
 
 	// Regular expression to match any combination of one scope and one component.
 	return regexp.MustCompile(fmt.Sprintf(`^\.(%s)\.(%s)$`, scopesRegexp, componentsRegexp))
@@ -816,6 +844,11 @@ func (c *commonToSdkLibraryAndImport) commonOutputFiles(tag string) (android.Pat
 				if paths.annotationsZip.Valid() {
 					return android.Paths{paths.annotationsZip.Path()}, nil
 				}
+
+			case apiTrackingComponentName:
+				if paths.apiTrackingDatabase.Valid() {
+					return android.Paths{paths.apiTrackingDatabase.Path()}, nil
+				}
 			}
 
 			return nil, fmt.Errorf("%s not available for api scope %s", component, scopeName)
@@ -1203,6 +1236,9 @@ func (module *SdkLibrary) DepsMutator(ctx android.BottomUpMutatorContext) {
 		if m := android.SrcIsModule(module.latestIncompatibilitiesFilegroupName(apiScope)); !ctx.OtherModuleExists(m) {
 			missingApiModules = append(missingApiModules, m)
 		}
+		if m := prebuiltApiHistoryModuleName(module.distStem(), apiScope.name); ctx.OtherModuleExists(m) {
+			ctx.AddDependency(module, apiHistoryDependencyTag{apiScope: apiScope}, m)
+		}
 	}
 	if len(missingApiModules) != 0 && !module.sdkLibraryProperties.Unsafe_ignore_missing_latest_api {
 		m := module.Name() + " is missing tracking files for previously released library versions.\n"
@@ -1269,13 +1305,69 @@ func (module *SdkLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext)
 
 			exportedComponents[ctx.OtherModuleName(to)] = struct{}{}
 		}
+
+		if historyTag, ok := tag.(apiHistoryDependencyTag); ok {
+			if producer, ok := to.(android.SourceFileProducer); ok {
+				module.buildApiTrackingDatabase(ctx, historyTag.apiScope, producer.Srcs())
+			}
+		}
 	})
 
+	apiTrackingInfo := ApiTrackingInfo{Databases: map[string]android.Path{}}
+	for _, apiScope := range allApiScopes {
+		if paths := module.findScopePaths(apiScope); paths != nil && paths.apiTrackingDatabase.Valid() {
+			apiTrackingInfo.Databases[apiScope.name] = paths.apiTrackingDatabase.Path()
+		}
+	}
+	if len(apiTrackingInfo.Databases) > 0 {
+		ctx.SetProvider(ApiTrackingInfoProvider, apiTrackingInfo)
+	}
+
 	// Make the set of components exported by this module available for use elsewhere.
 	exportedComponentInfo := android.ExportedComponentsInfo{Components: android.SortedStringKeys(exportedComponents)}
 	ctx.SetProvider(android.ExportedComponentsInfoProvider, exportedComponentInfo)
 }
 
+// buildApiTrackingDatabase generates the database that maps every API symbol of the scope to the API
+// level, or the SDK extension version, it was introduced in from the finalized API files of the
+// library.
+func (module *SdkLibrary) buildApiTrackingDatabase(ctx android.ModuleContext, apiScope *apiScope, apiFiles android.Paths) {
+	database := android.PathForModuleOut(ctx, "api_tracking", apiScope.name+".json")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().BuiltTool("api_tracking").FlagWithOutput("--out ", database)
+	for _, apiFile := range apiFiles {
+		version, extension, err := parseApiHistoryPath(apiFile.Rel())
+		if err != nil {
+			ctx.ModuleErrorf("invalid finalized api file: %s", err)
+			return
+		}
+		flag := "--api "
+		if extension {
+			flag = "--extension "
+		}
+		cmd.FlagWithInput(flag+strconv.Itoa(version)+":", apiFile)
+	}
+	rule.Build("api_tracking_"+apiScope.name, "api tracking database "+apiScope.name)
+
+	module.getScopePathsCreateIfNeeded(apiScope).apiTrackingDatabase = android.OptionalPathForPath(database)
+}
+
+var _ android.ModuleMakeVarsProvider = (*SdkLibrary)(nil)
+
+// MakeVars dists the api tracking databases for sdk builds, next to the api txt files.
+func (module *SdkLibrary) MakeVars(ctx android.MakeVarsModuleContext) {
+	if Bool(module.sdkLibraryProperties.No_dist) {
+		return
+	}
+	for _, apiScope := range allApiScopes {
+		if paths := module.findScopePaths(apiScope); paths != nil && paths.apiTrackingDatabase.Valid() {
+			dest := path.Join(module.apiDistPath(apiScope), "api", module.distStem()+"-api-tracking.json")
+			ctx.DistForGoalsWithFilename([]string{"sdk", "win_sdk"}, paths.apiTrackingDatabase.Path(), dest)
+		}
+	}
+}
+
 func (module *SdkLibrary) AndroidMkEntries() []android.AndroidMkEntries {
 	if !module.requiresRuntimeImplementationLibrary() {
 		return nil
@@ -1832,7 +1924,7 @@ func (module *SdkLibrary) CreateInternalModules(mctx android.DefaultableHookCont
 
 func (module *SdkLibrary) InitSdkLibraryProperties() {
 	module.addHostAndDeviceProperties()
-	module.AddProperties(&module.sdkLibraryProperties)
+	module.AddProperties(&module.sdkLibraryProperties, &module.hiddenAPIProperties)
 
 	module.initSdkLibraryComponent(module)
 
@@ -1974,6 +2066,19 @@ type sdkLibraryImportProperties struct {
 
 	// If not empty, classes are restricted to the specified packages and their sub-packages.
 	Permitted_packages []string
+
+	// The lint reports of the implementation library of the source module, provided in place of
+	// the reports of the source module. Either all or none of them must be set.
+	Lint struct {
+		// The lint report in HTML format.
+		Html_report *string `android:"path"`
+
+		// The lint report in text format.
+		Text_report *string `android:"path"`
+
+		// The lint report in XML format.
+		Xml_report *string `android:"path"`
+	}
 }
 
 type SdkLibraryImport struct {
@@ -2007,6 +2112,9 @@ type SdkLibraryImport struct {
 	// Expected install file path of the source module(sdk_library)
 	// or dex implementation jar obtained from the prebuilt_apex, if any.
 	installFile android.Path
+
+	// The lint reports from the lint properties, if any.
+	lintReports *lintOutputs
 }
 
 var _ SdkLibraryDependency = (*SdkLibraryImport)(nil)
@@ -2145,13 +2253,17 @@ func (module *SdkLibraryImport) createJavaImportForStubs(mctx android.Defaultabl
 
 func (module *SdkLibraryImport) createPrebuiltStubsSources(mctx android.DefaultableHookContext, apiScope *apiScope, scopeProperties *sdkLibraryScopeProperties) {
 	props := struct {
-		Name *string
-		Srcs []string
+		Name        *string
+		Srcs        []string
+		Annotations *string
 
 		android.UserSuppliedPrebuiltProperties
 	}{}
 	props.Name = proptools.StringPtr(module.stubsSourceModuleName(apiScope))
 	props.Srcs = scopeProperties.Stub_srcs
+	// Make the annotations available from the stubs source, as they are from the droidstubs module
+	// of the source java_sdk_library.
+	props.Annotations = scopeProperties.Annotations
 
 	// The stubs source is preferred if the java_sdk_library_import is preferred.
 	props.CopyUserSuppliedPropertiesFromPrebuilt(&module.prebuilt)
@@ -2290,6 +2402,8 @@ func (module *SdkLibraryImport) GenerateAndroidBuildActions(ctx android.ModuleCo
 		paths.removedApiFilePath = android.OptionalPathForModuleSrc(ctx, scopeProperties.Removed_api)
 	}
 
+	module.lintReports = module.importLintReports(ctx)
+
 	if ctx.Device() {
 		// If this is a variant created for a prebuilt_apex then use the dex implementation jar
 		// obtained from the associated deapexer module.
@@ -2383,9 +2497,34 @@ func (module *SdkLibraryImport) JacocoReportClassesFile() android.Path {
 	}
 }
 
+// importLintReports returns the lint reports from the lint properties, or nil if they are not set.
+func (module *SdkLibraryImport) importLintReports(ctx android.ModuleContext) *lintOutputs {
+	lint := module.properties.Lint
+	if lint.Html_report == nil && lint.Text_report == nil && lint.Xml_report == nil {
+		return nil
+	}
+	if lint.Html_report == nil || lint.Text_report == nil || lint.Xml_report == nil {
+		ctx.PropertyErrorf("lint", "html_report, text_report and xml_report must all be set")
+		return nil
+	}
+
+	html := android.PathForModuleSrc(ctx, *lint.Html_report)
+	text := android.PathForModuleSrc(ctx, *lint.Text_report)
+	xml := android.PathForModuleSrc(ctx, *lint.Xml_report)
+	return &lintOutputs{
+		html: html,
+		text: text,
+		xml:  xml,
+
+		depSets: NewLintDepSetBuilder().Direct(html, text, xml).Build(),
+	}
+}
+
 // to satisfy apex.javaDependency interface
 func (module *SdkLibraryImport) LintDepSets() LintDepSets {
-	if module.implLibraryModule == nil {
+	if module.lintReports != nil {
+		return module.lintReports.depSets
+	} else if module.implLibraryModule == nil {
 		return LintDepSets{}
 	} else {
 		return module.implLibraryModule.LintDepSets()
@@ -2406,6 +2545,17 @@ func (module *SdkLibraryImport) SetStrictUpdatabilityLinting(strictLinting bool)
 	}
 }
 
+var _ lintOutputsIntf = (*SdkLibraryImport)(nil)
+
+// lintOutputs returns the imported lint reports when the prebuilt is preferred, so that they are
+// included in the lint-check reports in place of the reports of the source module.
+func (module *SdkLibraryImport) lintOutputs() *lintOutputs {
+	if module.lintReports == nil || !module.prebuilt.UsePrebuilt() {
+		return &lintOutputs{}
+	}
+	return module.lintReports
+}
+
 // to satisfy apex.javaDependency interface
 func (module *SdkLibraryImport) Stem() string {
 	return module.BaseModuleName()
@@ -2839,6 +2989,11 @@ type sdkLibrarySdkMemberProperties struct {
 	//
 	// This means that the device won't recognise this library as installed.
 	Max_device_sdk *string
+
+	// The lint reports of the implementation library, only set if export_lint_reports is true.
+	Lint_html_report android.Path `supported_build_releases:"Tiramisu+"`
+	Lint_text_report android.Path `supported_build_releases:"Tiramisu+"`
+	Lint_xml_report  android.Path `supported_build_releases:"Tiramisu+"`
 }
 
 type scopeProperties struct {
@@ -2889,6 +3044,14 @@ func (s *sdkLibrarySdkMemberProperties) PopulateFromVariant(ctx android.SdkMembe
 	s.On_bootclasspath_before = sdk.commonSdkLibraryProperties.On_bootclasspath_before
 	s.Min_device_sdk = sdk.commonSdkLibraryProperties.Min_device_sdk
 	s.Max_device_sdk = sdk.commonSdkLibraryProperties.Max_device_sdk
+
+	if proptools.Bool(sdk.sdkLibraryProperties.Export_lint_reports) {
+		if outputs := sdk.lintOutputs(); outputs.html != nil {
+			s.Lint_html_report = outputs.html
+			s.Lint_text_report = outputs.text
+			s.Lint_xml_report = outputs.xml
+		}
+	}
 }
 
 func (s *sdkLibrarySdkMemberProperties) AddToPropertySet(ctx android.SdkMemberContext, propertySet android.BpPropertySet) {
@@ -2965,4 +3128,17 @@ func (s *sdkLibrarySdkMemberProperties) AddToPropertySet(ctx android.SdkMemberCo
 		}
 		propertySet.AddProperty("doctag_files", dests)
 	}
+
+	if s.Lint_html_report != nil {
+		lintSet := propertySet.AddPropertySet("lint")
+		lintDir := filepath.Join("sdk_library", s.OsPrefix(), "lint")
+		addLintReport := func(name string, report android.Path, suffix string) {
+			dest := filepath.Join(lintDir, ctx.Name()+"-lint-report"+suffix)
+			ctx.SnapshotBuilder().CopyToSnapshot(report, dest)
+			lintSet.AddProperty(name, dest)
+		}
+		addLintReport("html_report", s.Lint_html_report, ".html")
+		addLintReport("text_report", s.Lint_text_report, ".txt")
+		addLintReport("xml_report", s.Lint_xml_report, ".xml")
+	}
 }
@@ -529,6 +529,7 @@ func TestJavaSdkLibrary_Deps(t *testing.T) {
 
 	CheckModuleDependencies(t, result.TestContext, "sdklib", "android_common", []string{
 		`dex2oatd`,
+		`sdklib.api.public.history`,
 		`sdklib.impl`,
 		`sdklib.stubs`,
 		`sdklib.stubs.source`,
@@ -536,6 +537,52 @@ func TestJavaSdkLibrary_Deps(t *testing.T) {
 	})
 }
 
+func TestJavaSdkLibrary_ApiTracking(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		PrepareForTestWithJavaSdkLibraryFiles,
+		FixtureWithPrebuiltApisAndExtensions(map[string][]string{
+			"30": {"sdklib"},
+			"31": {"sdklib"},
+		}, map[string][]string{
+			"2": {"sdklib"},
+		}),
+	).RunTestWithBp(t, `
+		java_sdk_library {
+			name: "sdklib",
+			srcs: ["a.java"],
+			sdk_version: "none",
+			system_modules: "none",
+			public: {
+				enabled: true,
+			},
+		}
+		`)
+
+	sdklib := result.ModuleForTests("sdklib", "android_common")
+	database := "out/soong/.intermediates/sdklib/android_common/api_tracking/public.json"
+
+	rule := sdklib.Rule("api_tracking_public")
+	android.AssertPathRelativeToTopEquals(t, "output", database, rule.Output)
+	android.AssertStringDoesContain(t, "api level 30", rule.RuleParams.Command,
+		" --api 30:prebuilts/sdk/30/public/api/sdklib.txt")
+	android.AssertStringDoesContain(t, "api level 31", rule.RuleParams.Command,
+		" --api 31:prebuilts/sdk/31/public/api/sdklib.txt")
+	android.AssertStringDoesContain(t, "extension 2", rule.RuleParams.Command,
+		" --extension 2:prebuilts/sdk/extensions/2/public/api/sdklib.txt")
+	android.AssertStringDoesNotContain(t, "removed api", rule.RuleParams.Command, "sdklib-removed.txt")
+
+	info := result.ModuleProvider(sdklib.Module(), ApiTrackingInfoProvider).(ApiTrackingInfo)
+	android.AssertIntEquals(t, "number of databases", 1, len(info.Databases))
+	android.AssertPathRelativeToTopEquals(t, "public database", database, info.Databases["public"])
+
+	outputFiles, err := sdklib.Module().(*SdkLibrary).OutputFiles(".public.api-tracking.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	android.AssertPathsRelativeToTopEquals(t, "output files", []string{database}, outputFiles)
+}
+
 func TestJavaSdkLibraryImport_AccessOutputFiles(t *testing.T) {
 	prepareForJavaTest.RunTestWithBp(t, `
 		java_sdk_library_import {
@@ -824,6 +871,92 @@ func TestJavaSdkLibraryImport(t *testing.T) {
 	})
 }
 
+func TestJavaSdkLibraryImport_LintReports(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"lint/sdklib-lint-report.html": nil,
+			"lint/sdklib-lint-report.txt":  nil,
+			"lint/sdklib-lint-report.xml":  nil,
+		}),
+	).RunTestWithBp(t, `
+		java_sdk_library_import {
+			name: "sdklib",
+			prefer: true,
+			public: {
+				jars: ["a.jar"],
+			},
+			lint: {
+				html_report: "lint/sdklib-lint-report.html",
+				text_report: "lint/sdklib-lint-report.txt",
+				xml_report: "lint/sdklib-lint-report.xml",
+			},
+		}
+		`)
+
+	sdklib := result.ModuleForTests("sdklib", "android_common").Module().(*SdkLibraryImport)
+	depSets := sdklib.LintDepSets()
+	android.AssertPathsRelativeToTopEquals(t, "html reports",
+		[]string{"lint/sdklib-lint-report.html"}, depSets.HTML.ToList())
+	android.AssertPathsRelativeToTopEquals(t, "text reports",
+		[]string{"lint/sdklib-lint-report.txt"}, depSets.Text.ToList())
+	android.AssertPathsRelativeToTopEquals(t, "xml reports",
+		[]string{"lint/sdklib-lint-report.xml"}, depSets.XML.ToList())
+
+	outputs := sdklib.lintOutputs()
+	android.AssertPathRelativeToTopEquals(t, "html output", "lint/sdklib-lint-report.html", outputs.html)
+}
+
+func TestJavaSdkLibraryImport_LintReports_Incomplete(t *testing.T) {
+	prepareForJavaTest.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`lint: html_report, text_report and xml_report must all be set`)).
+		RunTestWithBp(t, `
+		java_sdk_library_import {
+			name: "sdklib",
+			public: {
+				jars: ["a.jar"],
+			},
+			lint: {
+				html_report: "lint/sdklib-lint-report.html",
+			},
+		}
+		`)
+}
+
+func TestJavaSdkLibraryImport_Annotations(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureMergeMockFs(android.MockFS{
+			"sdk_library/public/sdklib_stub_sources/Foo.java": nil,
+			"sdk_library/public/sdklib_annotations.zip":       nil,
+		}),
+	).RunTestWithBp(t, `
+		java_sdk_library_import {
+			name: "sdklib",
+			prefer: true,
+			public: {
+				jars: ["a.jar"],
+				stub_srcs: ["sdk_library/public/sdklib_stub_sources"],
+				annotations: "sdk_library/public/sdklib_annotations.zip",
+			},
+		}
+		`)
+
+	// The annotations zip is provided by the prebuilt stubs source in place of the droidstubs
+	// module of the source java_sdk_library.
+	stubsSource := result.ModuleForTests("prebuilt_sdklib.stubs.source", "android_common").Module().(*PrebuiltStubsSources)
+	android.AssertPathRelativeToTopEquals(t, "stubs source annotations zip",
+		"sdk_library/public/sdklib_annotations.zip", stubsSource.AnnotationsZip())
+
+	paths, err := stubsSource.OutputFiles(".annotations.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	android.AssertPathsRelativeToTopEquals(t, "stubs source output files",
+		[]string{"sdk_library/public/sdklib_annotations.zip"}, paths)
+}
+
 func TestJavaSdkLibraryImport_WithSource(t *testing.T) {
 	result := android.GroupFixturePreparers(
 		prepareForJavaTest,
@@ -851,6 +984,7 @@ func TestJavaSdkLibraryImport_WithSource(t *testing.T) {
 	CheckModuleDependencies(t, result.TestContext, "sdklib", "android_common", []string{
 		`dex2oatd`,
 		`prebuilt_sdklib`,
+		`sdklib.api.public.history`,
 		`sdklib.impl`,
 		`sdklib.stubs`,
 		`sdklib.stubs.source`,
@@ -921,6 +1055,7 @@ func testJavaSdkLibraryImport_Preferred(t *testing.T, prefer string, preparer an
 
 	CheckModuleDependencies(t, result.TestContext, "sdklib", "android_common", []string{
 		`prebuilt_sdklib`,
+		`sdklib.api.public.history`,
 		`sdklib.impl`,
 		`sdklib.stubs`,
 		`sdklib.stubs.source`,
@@ -1300,3 +1435,63 @@ func TestSdkLibrary_CheckMinSdkVersion(t *testing.T) {
 			}
 		`)
 }
+
+func TestJavaSdkLibrary_ApexPayload(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		PrepareForTestWithJavaSdkLibraryFiles,
+		PrepareForTestWithFakeApexPayload,
+		FixtureWithLastReleaseApis("foo"),
+	).RunTestWithBp(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+			apex_available: ["com.android.foo"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			compile_dex: true,
+			stem: "bar-impl",
+			apex_available: [
+				"//apex_available:platform",
+				"com.android.foo",
+				"com.android.bar",
+			],
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+			compile_dex: true,
+		}
+
+		apex_test {
+			name: "com.android.foo",
+			java_libs: [
+				"foo",
+				"bar",
+			],
+		}
+
+		apex_test {
+			name: "com.android.bar",
+			java_libs: ["bar"],
+		}
+
+		apex_test {
+			name: "com.android.baz",
+		}
+	`)
+
+	CheckApexPayloadContents(t, result, "com.android.foo", []string{
+		"javalib/bar-impl.jar",
+		"javalib/foo.jar",
+	})
+	CheckApexPayloadContents(t, result, "com.android.bar", []string{
+		"javalib/bar-impl.jar",
+	})
+	CheckApexPayloadContents(t, result, "com.android.baz", nil)
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strings"
+
+	"android/soong/android"
+)
+
+// This singleton collects every lint baseline, metalava baseline, lint suppression annotation and
+// check disabling property (lint and errorprone) across the tree into a single report so that the
+// suppression debt of each module can be tracked. The report is a tab separated file with one line
+// per suppression:
+//
+//	<module> <dir> <owner> <kind> <detail> <count>
+//
+// For kinds that refer to files the count is the number of suppressed issues found in the files
+// when the report is built, otherwise it is 1. Baselines are counted in the baseline files, and
+// the issues suppressed with @SuppressLint or @Suppress in the SARIF report of lint, which lists
+// them as results with suppressions, so building the report runs lint on every module.
+
+func init() {
+	registerSuppressionInventoryBuildComponents(android.InitRegistrationContext)
+}
+
+func registerSuppressionInventoryBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("suppression_inventory", suppressionInventorySingletonFactory)
+}
+
+var PrepareForTestWithSuppressionInventory = android.FixtureRegisterWithContext(registerSuppressionInventoryBuildComponents)
+
+const (
+	suppressionKindLintBaseline           = "lint_baseline"
+	suppressionKindLintDisabledCheck      = "lint_disabled_check"
+	suppressionKindLintSuppressAnnotation = "lint_suppress_annotation"
+	suppressionKindErrorproneDisabled     = "errorprone_disabled_check"
+	suppressionKindMetalavaBaseline       = "metalava_baseline"
+)
+
+// suppressionEntry is a single suppression reported by a module.
+type suppressionEntry struct {
+	kind   string
+	detail string
+
+	// The files in which the suppressed issues are counted, if any.
+	files android.Paths
+
+	// The grep pattern used to count the suppressed issues in files.
+	pattern string
+}
+
+// suppressionInventoryProvider is implemented by modules that can report suppressions.
+type suppressionInventoryProvider interface {
+	suppressionEntries() []suppressionEntry
+}
+
+func (l *linter) suppressionEntries() []suppressionEntry {
+	if !l.enabled() {
+		return nil
+	}
+
+	var entries []suppressionEntry
+	if l.baseline.Valid() {
+		entries = append(entries, suppressionEntry{
+			kind:    suppressionKindLintBaseline,
+			detail:  l.baseline.String(),
+			files:   android.Paths{l.baseline.Path()},
+			pattern: "<issue",
+		})
+	}
+	for _, check := range l.properties.Lint.Disabled_checks {
+		entries = append(entries, suppressionEntry{
+			kind:   suppressionKindLintDisabledCheck,
+			detail: check,
+		})
+	}
+	if l.outputs.sarif != nil {
+		entries = append(entries, suppressionEntry{
+			kind:   suppressionKindLintSuppressAnnotation,
+			detail: "@SuppressLint",
+			files:  android.Paths{l.outputs.sarif},
+			// Each suppressed result has a single "suppressions" property on its own line.
+			pattern: `"suppressions"`,
+		})
+	}
+	return entries
+}
+
+func (j *Module) suppressionEntries() []suppressionEntry {
+	entries := j.linter.suppressionEntries()
+	for _, flag := range j.properties.Errorprone.Javacflags {
+		// Errorprone checks are disabled with -Xep:<check>:OFF.
+		if strings.HasPrefix(flag, "-Xep:") && strings.HasSuffix(flag, ":OFF") {
+			entries = append(entries, suppressionEntry{
+				kind:   suppressionKindErrorproneDisabled,
+				detail: strings.TrimSuffix(strings.TrimPrefix(flag, "-Xep:"), ":OFF"),
+			})
+		}
+	}
+	return entries
+}
+
+var _ suppressionInventoryProvider = (*Module)(nil)
+
+func (d *Droidstubs) suppressionEntries() []suppressionEntry {
+	var entries []suppressionEntry
+	for _, baseline := range d.metalavaBaselines {
+		entries = append(entries, suppressionEntry{
+			kind:   suppressionKindMetalavaBaseline,
+			detail: baseline.String(),
+			files:  android.Paths{baseline},
+			// Each baselined issue starts with "<IssueId>: <location>:".
+			pattern: "^[A-Za-z]*:",
+		})
+	}
+	return entries
+}
+
+var _ suppressionInventoryProvider = (*Droidstubs)(nil)
+
+func suppressionInventorySingletonFactory() android.Singleton {
+	return &suppressionInventorySingleton{}
+}
+
+type suppressionInventorySingleton struct {
+	report android.WritablePath
+}
+
+func (s *suppressionInventorySingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if ctx.Config().UnbundledBuild() {
+		return
+	}
+
+	// Modules with multiple variants report the same suppressions, only keep one of them.
+	lines := make(map[string]bool)
+	var inputs android.Paths
+	ctx.VisitAllModules(func(m android.Module) {
+		if !m.Enabled() {
+			return
+		}
+		provider, ok := m.(suppressionInventoryProvider)
+		if !ok {
+			return
+		}
+		for _, entry := range provider.suppressionEntries() {
+			fields := []string{
+				ctx.ModuleName(m),
+				ctx.ModuleDir(m),
+				m.Owner(),
+				entry.kind,
+				entry.detail,
+				entry.pattern,
+				strings.Join(entry.files.Strings(), " "),
+			}
+			// read collapses consecutive tabs, so use a placeholder for empty fields.
+			for i := range fields {
+				if fields[i] == "" {
+					fields[i] = "-"
+				}
+			}
+			lines[strings.Join(fields, "\t")] = true
+			inputs = append(inputs, entry.files...)
+		}
+	})
+
+	entriesFile := android.PathForOutput(ctx, "suppression_inventory", "entries.tsv")
+	android.WriteFileRule(ctx, entriesFile, strings.Join(android.SortedStringKeys(lines), "\n"))
+
+	s.report = android.PathForOutput(ctx, "suppression_inventory", "suppression_inventory.tsv")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("while IFS=$'\\t' read -r module dir owner kind detail pattern files; do").
+		Text(`count=1;`).
+		Text(`if [ "${files}" != "-" ]; then count=$(cat ${files} | grep -c -e "${pattern}" || true); fi;`).
+		Text(`printf '%s\t%s\t%s\t%s\t%s\t%s\n' "${module}" "${dir}" "${owner}" "${kind}" "${detail}" "${count}";`).
+		Text("done <").Input(entriesFile).
+		Text(">").Output(s.report).
+		Implicits(android.SortedUniquePaths(inputs))
+	rule.Build("suppression_inventory", "suppression inventory")
+
+	ctx.Phony("suppression-inventory", s.report)
+}
+
+func (s *suppressionInventorySingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.report != nil {
+		ctx.DistForGoal("suppression-inventory", s.report)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*suppressionInventorySingleton)(nil)
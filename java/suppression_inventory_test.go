@@ -0,0 +1,88 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestSuppressionInventory(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithSuppressionInventory,
+		android.FixtureMergeMockFs(android.MockFS{
+			"foo/a.java":                nil,
+			"foo/lint-baseline.xml":     nil,
+			"bar/a.java":                nil,
+			"bar/api_lint_baseline.txt": nil,
+		}),
+		android.FixtureAddTextFile("foo/Android.bp", `
+			java_library {
+				name: "foo",
+				srcs: ["a.java"],
+				owner: "acme",
+				lint: {
+					disabled_checks: ["SomeCheck"],
+				},
+				errorprone: {
+					javacflags: [
+						"-Xep:SomeErrorproneCheck:OFF",
+						"-Xep:OtherErrorproneCheck:ERROR",
+					],
+				},
+			}
+		`),
+		android.FixtureAddTextFile("bar/Android.bp", `
+			droidstubs {
+				name: "bar-stubs",
+				srcs: ["a.java"],
+				check_api: {
+					api_lint: {
+						enabled: true,
+						baseline_file: "api_lint_baseline.txt",
+					},
+				},
+			}
+		`),
+	).RunTest(t)
+
+	inventory := result.SingletonForTests("suppression_inventory")
+	entries := android.ContentFromFileRuleForTests(t, inventory.Output("suppression_inventory/entries.tsv"))
+
+	expected := []string{
+		"bar-stubs\tbar\t-\tmetalava_baseline\tbar/api_lint_baseline.txt\t^[A-Za-z]*:\tbar/api_lint_baseline.txt",
+		"foo\tfoo\tacme\terrorprone_disabled_check\tSomeErrorproneCheck\t-\t-",
+		"foo\tfoo\tacme\tlint_baseline\tfoo/lint-baseline.xml\t<issue\tfoo/lint-baseline.xml",
+		"foo\tfoo\tacme\tlint_disabled_check\tSomeCheck\t-\t-",
+		"foo\tfoo\tacme\tlint_suppress_annotation\t@SuppressLint\t\"suppressions\"\tout/soong/.intermediates/foo/android_common/lint/lint-report.sarif",
+	}
+	for _, e := range expected {
+		android.AssertStringDoesContain(t, "suppression inventory entries", entries, e)
+	}
+	android.AssertStringDoesNotContain(t, "suppression inventory entries", entries, "OtherErrorproneCheck")
+
+	report := inventory.Output("suppression_inventory/suppression_inventory.tsv")
+	android.AssertPathsRelativeToTopEquals(t, "suppression inventory implicits",
+		[]string{"bar/api_lint_baseline.txt", "foo/lint-baseline.xml",
+			"out/soong/.intermediates/foo/android_common/lint/lint-report.sarif",
+			"out/soong/suppression_inventory/entries.tsv"},
+		report.Implicits)
+	if !strings.Contains(report.RuleParams.Command, "grep -c") {
+		t.Errorf("expected report command to count suppressions, got %q", report.RuleParams.Command)
+	}
+}
@@ -15,9 +15,9 @@
 package java
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
-	"regexp"
 	"sort"
 	"strings"
 	"testing"
@@ -27,6 +27,7 @@ import (
 	"android/soong/dexpreopt"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
 )
 
 const defaultJavaDir = "default/java"
@@ -156,9 +157,70 @@ func FixtureWithPrebuiltApis(release2Modules map[string][]string) android.Fixtur
 }
 
 func FixtureWithPrebuiltApisAndExtensions(apiLevel2Modules map[string][]string, extensionLevel2Modules map[string][]string) android.FixturePreparer {
+	apiLevels := make(map[android.ApiLevel][]string)
+	for release, modules := range apiLevel2Modules {
+		apiLevels[android.ApiLevelForTest(release)] = modules
+	}
+	return fixtureWithPrebuiltApiLevels(apiLevels, extensionLevel2Modules)
+}
+
+// FixtureWithPrebuiltApisAndCurrentExtension is like FixtureWithPrebuiltApisAndExtensions except
+// that it also sets the SDK extension version of the platform to currentExtensionLevel, so that the
+// APIs finalized in that extension level are the ones that the current APIs are checked against.
+func FixtureWithPrebuiltApisAndCurrentExtension(apiLevel2Modules map[string][]string, extensionLevel2Modules map[string][]string, currentExtensionLevel int) android.FixturePreparer {
+	return android.GroupFixturePreparers(
+		FixtureWithPrebuiltApisAndExtensions(apiLevel2Modules, extensionLevel2Modules),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.Platform_sdk_extension_version = proptools.IntPtr(currentExtensionLevel)
+		}),
+	)
+}
+
+// FixtureWithPrebuiltApisFromApiLevels is like FixtureWithPrebuiltApis except that the releases are
+// specified as ApiLevel values, which allows them to include preview API levels, e.g.
+// android.PreviewApiLevelForTest("UpsideDownCake", 0).
+//
+// The codenames of the preview API levels, other than current, are ordered by ApiLevel and replace
+// the Platform_version_active_codenames product variable so that they can be used in sdk_version
+// properties. As with current, no finalized API files are created for a preview API level.
+func FixtureWithPrebuiltApisFromApiLevels(apiLevel2Modules map[android.ApiLevel][]string) android.FixturePreparer {
+	var previews []android.ApiLevel
+	for apiLevel := range apiLevel2Modules {
+		if apiLevel.IsPreview() && !apiLevel.IsCurrent() {
+			previews = append(previews, apiLevel)
+		}
+	}
+	if len(previews) == 0 {
+		return fixtureWithPrebuiltApiLevels(apiLevel2Modules, nil)
+	}
+
+	sort.Slice(previews, func(i, j int) bool {
+		return previews[i].LessThan(previews[j])
+	})
+	var codenames []string
+	for _, preview := range previews {
+		codenames = append(codenames, preview.String())
+	}
+
+	return android.GroupFixturePreparers(
+		fixtureWithPrebuiltApiLevels(apiLevel2Modules, nil),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.Platform_version_active_codenames = codenames
+		}),
+	)
+}
+
+func fixtureWithPrebuiltApiLevels(apiLevel2Modules map[android.ApiLevel][]string, extensionLevel2Modules map[string][]string) android.FixturePreparer {
 	mockFS := android.MockFS{}
 	path := "prebuilts/sdk/Android.bp"
 
+	var releases []string
+	for apiLevel, modules := range apiLevel2Modules {
+		releases = append(releases, apiLevel.String())
+		mockFS.Merge(prebuiltApisFilesForModules([]android.ApiLevel{apiLevel}, modules))
+	}
+	sort.Strings(releases)
+
 	bp := fmt.Sprintf(`
 			prebuilt_apis {
 				name: "sdk",
@@ -167,11 +229,8 @@ func FixtureWithPrebuiltApisAndExtensions(apiLevel2Modules map[string][]string,
 				imports_sdk_version: "none",
 				imports_compile_dex: true,
 			}
-		`, strings.Join(android.SortedStringKeys(apiLevel2Modules), `", "`))
+		`, strings.Join(releases, `", "`))
 
-	for release, modules := range apiLevel2Modules {
-		mockFS.Merge(prebuiltApisFilesForModules([]string{release}, modules))
-	}
 	if extensionLevel2Modules != nil {
 		for release, modules := range extensionLevel2Modules {
 			mockFS.Merge(prebuiltExtensionApiFiles([]string{release}, modules))
@@ -183,12 +242,12 @@ func FixtureWithPrebuiltApisAndExtensions(apiLevel2Modules map[string][]string,
 	)
 }
 
-func prebuiltApisFilesForModules(apiLevels []string, modules []string) map[string][]byte {
+func prebuiltApisFilesForModules(apiLevels []android.ApiLevel, modules []string) map[string][]byte {
 	libs := append([]string{"android"}, modules...)
 
 	fs := make(map[string][]byte)
-	for _, level := range apiLevels {
-		apiLevel := android.ApiLevelForTest(level)
+	for _, apiLevel := range apiLevels {
+		level := apiLevel.String()
 		for _, sdkKind := range []android.SdkKind{android.SdkPublic, android.SdkSystem, android.SdkModule, android.SdkSystemServer, android.SdkTest} {
 			// A core-for-system-modules file must only be created for the sdk kind that supports it.
 			if sdkKind == systemModuleKind(sdkKind, apiLevel) {
@@ -199,14 +258,14 @@ func prebuiltApisFilesForModules(apiLevels []string, modules []string) map[strin
 				// Create a jar file for every library.
 				fs[fmt.Sprintf("prebuilts/sdk/%s/%s/%s.jar", level, sdkKind, lib)] = nil
 
-				// No finalized API files for "current"
-				if level != "current" {
+				// No finalized API files for "current" or other preview API levels
+				if !apiLevel.IsPreview() {
 					fs[fmt.Sprintf("prebuilts/sdk/%s/%s/api/%s.txt", level, sdkKind, lib)] = nil
 					fs[fmt.Sprintf("prebuilts/sdk/%s/%s/api/%s-removed.txt", level, sdkKind, lib)] = nil
 				}
 			}
 		}
-		if level == "current" {
+		if apiLevel.IsCurrent() {
 			fs["prebuilts/sdk/current/core/android.jar"] = nil
 		}
 		fs[fmt.Sprintf("prebuilts/sdk/%s/public/framework.aidl", level)] = nil
@@ -270,6 +329,18 @@ func FixtureConfigureApexBootJars(bootJars ...string) android.FixturePreparer {
 	)
 }
 
+// FixtureConfigureSystemServerDirtyImageObjects configures the dirty image objects file that is
+// passed to dex2oat when generating the app images of system server jars, and adds it to the mock
+// filesystem.
+func FixtureConfigureSystemServerDirtyImageObjects(dirtyImageObjects string) android.FixturePreparer {
+	return android.GroupFixturePreparers(
+		android.FixtureAddTextFile(dirtyImageObjects, ""),
+		dexpreopt.FixtureModifyGlobalConfig(func(ctx android.PathContext, dexpreoptConfig *dexpreopt.GlobalConfig) {
+			dexpreoptConfig.SystemServerDirtyImageObjects = android.PathForSource(ctx, dirtyImageObjects)
+		}),
+	)
+}
+
 // FixtureUseLegacyCorePlatformApi prepares the fixture by setting the exception list of those
 // modules that are allowed to use the legacy core platform API to be the ones supplied.
 func FixtureUseLegacyCorePlatformApi(moduleNames ...string) android.FixturePreparer {
@@ -303,10 +374,12 @@ func registerRequiredBuildComponentsForTest(ctx android.RegistrationContext) {
 	RegisterAppSetBuildComponents(ctx)
 	registerBootclasspathBuildComponents(ctx)
 	registerBootclasspathFragmentBuildComponents(ctx)
+	registerBuildFlagsBuildComponents(ctx)
 	RegisterDexpreoptBootJarsComponents(ctx)
 	RegisterDocsBuildComponents(ctx)
 	RegisterGenRuleBuildComponents(ctx)
 	registerJavaBuildComponents(ctx)
+	RegisterJavaFuzzBuildComponents(ctx)
 	registerPlatformBootclasspathBuildComponents(ctx)
 	RegisterPrebuiltApisBuildComponents(ctx)
 	RegisterRuntimeResourceOverlayBuildComponents(ctx)
@@ -422,6 +495,17 @@ func CheckModuleDependencies(t *testing.T, ctx *android.TestContext, name, varia
 	}
 }
 
+// CheckInstalledFiles checks that the java module with the given name installs exactly the expected
+// files in a partition, e.g. "framework/foo.jar" and its dexpreopt artifacts
+// "framework/oat/arm64/foo.odex" in "system", in the form returned by
+// android.TestingModule.InstalledFilesInPartition. The expected files must be sorted.
+func CheckInstalledFiles(t *testing.T, result *android.TestResult, name, partition string, expected []string) {
+	t.Helper()
+	installed := result.ModuleForTests(name, "android_common").InstalledFilesInPartition(partition)
+	sort.Strings(installed)
+	android.AssertDeepEquals(t, fmt.Sprintf("files installed by %q in %q", name, partition), expected, installed)
+}
+
 // CheckPlatformBootclasspathModules returns the apex:module pair for the modules depended upon by
 // the platform-bootclasspath module.
 func CheckPlatformBootclasspathModules(t *testing.T, result *android.TestResult, name string, expected []string) {
@@ -431,6 +515,18 @@ func CheckPlatformBootclasspathModules(t *testing.T, result *android.TestResult,
 	android.AssertDeepEquals(t, fmt.Sprintf("%s modules", "platform-bootclasspath"), expected, pairs)
 }
 
+// CheckPlatformBootclasspathReport checks that the bootclasspath report generated by the
+// platform_bootclasspath module contains the expected entries.
+func CheckPlatformBootclasspathReport(t *testing.T, result *android.TestResult, name string, expected []PlatformBootclasspathReportEntry) {
+	t.Helper()
+	report := result.ModuleForTests(name, "android_common").Output("platform-bootclasspath-report.json")
+	var actual []PlatformBootclasspathReportEntry
+	if err := json.Unmarshal([]byte(android.ContentFromFileRuleForTests(t, report)), &actual); err != nil {
+		t.Fatalf("failed to parse the bootclasspath report of %s: %s", name, err)
+	}
+	android.AssertDeepEquals(t, fmt.Sprintf("%s bootclasspath report", name), expected, actual)
+}
+
 func CheckClasspathFragmentProtoContentInfoProvider(t *testing.T, result *android.TestResult, generated bool, contents, outputFilename, installDir string) {
 	t.Helper()
 	p := result.Module("platform-bootclasspath", "android_common").(*platformBootclasspathModule)
@@ -473,6 +569,13 @@ func CheckPlatformBootclasspathFragments(t *testing.T, result *android.TestResul
 	android.AssertDeepEquals(t, fmt.Sprintf("%s fragments", "platform-bootclasspath"), expected, pairs)
 }
 
+// CheckBuildFlagValues checks the values that the java_build_flags module resolved its flags to.
+func CheckBuildFlagValues(t *testing.T, result *android.TestResult, name string, expected map[string]string) {
+	t.Helper()
+	info := result.ModuleProvider(result.Module(name, ""), BuildFlagsInfoProvider).(BuildFlagsInfo)
+	android.AssertDeepEquals(t, fmt.Sprintf("%s build flag values", name), expected, info.Values)
+}
+
 func CheckHiddenAPIRuleInputs(t *testing.T, message string, expected string, hiddenAPIRule android.TestingBuildParams) {
 	t.Helper()
 	inputs := android.Paths{}
@@ -482,12 +585,28 @@ func CheckHiddenAPIRuleInputs(t *testing.T, message string, expected string, hid
 	inputs = append(inputs, hiddenAPIRule.Inputs...)
 	inputs = append(inputs, hiddenAPIRule.Implicits...)
 	inputs = android.SortedUniquePaths(inputs)
-	actual := strings.TrimSpace(strings.Join(inputs.RelativeToTop().Strings(), "\n"))
-	re := regexp.MustCompile(`\n\s+`)
-	expected = strings.TrimSpace(re.ReplaceAllString(expected, "\n"))
-	if actual != expected {
-		t.Errorf("Expected hiddenapi rule inputs - %s:\n%s\nactual inputs:\n%s", message, expected, actual)
+	actual := strings.Join(inputs.RelativeToTop().Strings(), "\n")
+	android.AssertCommandEquals(t, "hiddenapi rule inputs - "+message, expected, actual)
+}
+
+// CheckHiddenAPIFlagOverrideFiles checks that the flag override files that were merged into the
+// hidden API flags of a bootclasspath_fragment or platform_bootclasspath module are the expected
+// ones.
+func CheckHiddenAPIFlagOverrideFiles(t *testing.T, result *android.TestResult, message string, expected string, module android.Module) {
+	t.Helper()
+	var overrideFiles android.Paths
+	if result.ModuleHasProvider(module, HiddenAPIInfoProvider) {
+		info := result.ModuleProvider(module, HiddenAPIInfoProvider).(HiddenAPIInfo)
+		overrideFiles = info.FlagOverrideFiles
+	} else if result.ModuleHasProvider(module, MonolithicHiddenAPIInfoProvider) {
+		info := result.ModuleProvider(module, MonolithicHiddenAPIInfoProvider).(MonolithicHiddenAPIInfo)
+		overrideFiles = info.FlagOverrideFiles
+	} else {
+		t.Errorf("%s: module %s does not provide hidden API information", message, module)
+		return
 	}
+	actual := strings.Join(android.SortedUniquePaths(overrideFiles).RelativeToTop().Strings(), "\n")
+	android.AssertCommandEquals(t, "hiddenapi flag override files - "+message, expected, actual)
 }
 
 // Check that the merged file create by platform_compat_config_singleton has the correct inputs.
@@ -541,6 +660,117 @@ func fakeApexMutator(mctx android.BottomUpMutatorContext) {
 	}
 }
 
+// FixtureModifyDexpreoptConfigPerModule modifies the dexpreopt config of the named module, e.g. to
+// set its ClassLoaderContexts or ProfileClassListing, after it is created by the module and before
+// the dexpreopt rules are generated from it. It must be used at most once per module.
+func FixtureModifyDexpreoptConfigPerModule(name string, configModifier func(ctx android.PathContext, moduleConfig *dexpreopt.ModuleConfig)) android.FixturePreparer {
+	return android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+		ctx.PostDepsMutators(func(ctx android.RegisterMutatorsContext) {
+			ctx.BottomUp("modify_dexpreopt_config_"+name, func(ctx android.BottomUpMutatorContext) {
+				if ctx.ModuleName() != name {
+					return
+				}
+				if d, ok := ctx.Module().(dexpreoptConfigModifiable); ok {
+					d.addDexpreoptConfigModifierForTests(configModifier)
+				}
+			}).Parallel()
+		})
+	})
+}
+
+// dexpreoptConfigModifiable is implemented by the modules that embed dexpreopter.
+type dexpreoptConfigModifiable interface {
+	addDexpreoptConfigModifierForTests(configModifier func(ctx android.PathContext, moduleConfig *dexpreopt.ModuleConfig))
+}
+
+func (d *dexpreopter) addDexpreoptConfigModifierForTests(configModifier func(ctx android.PathContext, moduleConfig *dexpreopt.ModuleConfig)) {
+	d.configModifiersForTests = append(d.configModifiersForTests, configModifier)
+}
+
+// PrepareForTestWithFakeApexPayload is like PrepareForTestWithFakeApexMutator but also registers a
+// fake apex_test module type, which records the files that the APEX variants of its java_libs
+// would contribute to its payload. The payload can be checked with CheckApexPayloadContents.
+var PrepareForTestWithFakeApexPayload = android.GroupFixturePreparers(
+	PrepareForTestWithFakeApexMutator,
+	android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+		ctx.RegisterModuleType("apex_test", fakeApexTestFactory)
+		ctx.PostDepsMutators(func(ctx android.RegisterMutatorsContext) {
+			ctx.BottomUp("fake_apex_test_deps", fakeApexTestDepsMutator).Parallel()
+		})
+	}),
+)
+
+// fakeApexPayloadModule is implemented by the modules that can be listed in the java_libs of the
+// fake apex_test module.
+type fakeApexPayloadModule interface {
+	DexJarBuildPath() OptionalDexJarPath
+	Stem() string
+}
+
+var _ fakeApexPayloadModule = (*Library)(nil)
+var _ fakeApexPayloadModule = (*SdkLibrary)(nil)
+
+type fakeApexTestProperties struct {
+	// The java libraries whose APEX variants are in the payload of the APEX.
+	Java_libs []string
+}
+
+// A fake apex_test module that records its would-be payload, i.e. the dex jars of the APEX variants
+// of its java_libs installed in javalib/ like the real APEX module does.
+type fakeApexTest struct {
+	android.ModuleBase
+
+	properties fakeApexTestProperties
+
+	// Map from the path of a file in the APEX to the file.
+	payload map[string]android.Path
+}
+
+func fakeApexTestFactory() android.Module {
+	m := &fakeApexTest{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidArchModule(m, android.DeviceSupported, android.MultilibCommon)
+	return m
+}
+
+type fakeApexTestDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+var fakeApexTestJavaLibTag = fakeApexTestDependencyTag{}
+
+// fakeApexTestDepsMutator adds the dependencies of the fake apex_test modules on the APEX variants
+// of their java_libs, so it must run after the fake APEX mutator created them.
+func fakeApexTestDepsMutator(ctx android.BottomUpMutatorContext) {
+	if m, ok := ctx.Module().(*fakeApexTest); ok {
+		variations := append(ctx.Target().Variations(), blueprint.Variation{Mutator: "apex", Variation: "apex1000"})
+		ctx.AddFarVariationDependencies(variations, fakeApexTestJavaLibTag, m.properties.Java_libs...)
+	}
+}
+
+func (m *fakeApexTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	m.payload = make(map[string]android.Path)
+	ctx.VisitDirectDepsWithTag(fakeApexTestJavaLibTag, func(dep android.Module) {
+		lib, ok := dep.(fakeApexPayloadModule)
+		if !ok {
+			ctx.PropertyErrorf("java_libs", "%q is not a java library", ctx.OtherModuleName(dep))
+			return
+		}
+		if dexJar := lib.DexJarBuildPath(); dexJar.Valid() {
+			m.payload["javalib/"+lib.Stem()+".jar"] = dexJar.Path()
+		}
+	})
+}
+
+// CheckApexPayloadContents checks that the payload of the fake apex_test module registered by
+// PrepareForTestWithFakeApexPayload contains exactly the expected paths.
+func CheckApexPayloadContents(t *testing.T, result *android.TestResult, apexName string, expected []string) {
+	t.Helper()
+	apex := result.ModuleForTests(apexName, "android_common").Module().(*fakeApexTest)
+	actual := android.SortedStringKeys(apex.payload)
+	android.AssertArrayString(t, fmt.Sprintf("payload of %s", apexName), android.SortedUniqueStrings(expected), actual)
+}
+
 // Applies the given modifier on the boot image config with the given name.
 func FixtureModifyBootImageConfig(name string, configModifier func(*bootImageConfig)) android.FixturePreparer {
 	return android.FixtureModifyConfig(func(androidConfig android.Config) {
@@ -550,9 +780,26 @@ func FixtureModifyBootImageConfig(name string, configModifier func(*bootImageCon
 	})
 }
 
-// Sets the value of `installDirOnDevice` of the boot image config with the given name.
-func FixtureSetBootImageInstallDirOnDevice(name string, installDir string) android.FixturePreparer {
+// Installs the boot image with the given name in the `javalib` directory of the APEX with the given
+// apex_name.
+func FixtureSetBootImageInstallInApex(name string, apexName string) android.FixturePreparer {
 	return FixtureModifyBootImageConfig(name, func(config *bootImageConfig) {
-		config.installDirOnDevice = installDir
+		config.installLocationOnDevice = bootImageInstallInApex(apexName, "javalib")
 	})
 }
+
+// Installs the boot image with the given name in the `framework` directory of the system partition.
+func FixtureSetBootImageInstallOnSystem(name string) android.FixturePreparer {
+	return FixtureModifyBootImageConfig(name, func(config *bootImageConfig) {
+		config.installLocationOnDevice = bootImageInstallOnSystem("framework")
+	})
+}
+
+// CheckBootImageInstallLocation checks that the boot image config with the given name is installed
+// in the expected directory on device, e.g. "apex/com.android.art/javalib".
+func CheckBootImageInstallLocation(t *testing.T, result *android.TestResult, name string, expected string) {
+	t.Helper()
+	pathCtx := android.PathContextForTesting(result.Config)
+	config := genBootImageConfigs(pathCtx)[name]
+	android.AssertStringEquals(t, fmt.Sprintf("install location of the %q boot image", name), expected, config.installLocationOnDevice.String())
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// Every apk signed by SignAppPackage and every apex signed by the apex rules gets a binary
+// transparency log entry: a single line JSON object holding the name and SHA-256 of the signed
+// artifact, the SHA-256 of the DER encoding of each signing certificate and the build id. The
+// modules that sign artifacts embed TransparencyLog to record their entries, and the
+// transparency_log singleton concatenates the entries of all the modules into
+// ${OUT_DIR}/soong/transparency_log/entries.jsonl, which is built by the transparency-log goal and
+// can be appended as is to a transparency log by the release infrastructure.
+
+func init() {
+	registerTransparencyLogBuildComponents(android.InitRegistrationContext)
+}
+
+func registerTransparencyLogBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("transparency_log", transparencyLogSingletonFactory)
+}
+
+var PrepareForTestWithTransparencyLog = android.FixtureRegisterWithContext(registerTransparencyLogBuildComponents)
+
+var transparencyLogEntry = pctx.AndroidStaticRule("transparencyLogEntry",
+	blueprint.RuleParams{
+		Command: `echo "{\"module\":\"$module\",\"artifact\":\"$artifact\",` +
+			`\"sha256\":\"$$(sha256sum $in | cut -d ' ' -f 1)\",` +
+			`\"signers_sha256\":[$$(for cert in $certificates; do ` +
+			`openssl x509 -in $$cert -outform DER | sha256sum | cut -d ' ' -f 1; ` +
+			`done | sed 's/.*/"&"/' | paste -sd , -)],` +
+			`\"build_id\":\"$buildId\"}" > $out`,
+	},
+	"module", "artifact", "certificates", "buildId")
+
+// TransparencyLog is embedded in the modules that sign artifacts to record the transparency log
+// entries of the signed artifacts.
+type TransparencyLog struct {
+	transparencyLogEntries android.Paths
+}
+
+// TransparencyLogEntries returns the transparency log entries of the artifacts signed by the module.
+func (t *TransparencyLog) TransparencyLogEntries() android.Paths {
+	return t.transparencyLogEntries
+}
+
+func (t *TransparencyLog) addTransparencyLogEntry(entry android.Path) {
+	t.transparencyLogEntries = append(t.transparencyLogEntries, entry)
+}
+
+type transparencyLogModule interface {
+	TransparencyLogEntries() android.Paths
+	addTransparencyLogEntry(entry android.Path)
+}
+
+// BuildTransparencyLogEntry generates the transparency log entry of an artifact signed with the
+// given certificates and records it in the TransparencyLog of the module to be collected by the
+// transparency_log singleton. It returns an error if the module does not embed TransparencyLog.
+func BuildTransparencyLogEntry(ctx android.ModuleContext, signed android.Path, certificates android.Paths) (android.Path, error) {
+	m, ok := ctx.Module().(transparencyLogModule)
+	if !ok {
+		return nil, fmt.Errorf("module %q signs %s but does not embed TransparencyLog", ctx.ModuleName(), signed.Base())
+	}
+
+	entry := android.PathForModuleOut(ctx, "transparency_log", signed.Base()+".json")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        transparencyLogEntry,
+		Description: "transparency log entry " + signed.Base(),
+		Output:      entry,
+		Input:       signed,
+		Implicits:   certificates,
+		Args: map[string]string{
+			"module":       ctx.ModuleName(),
+			"artifact":     signed.Base(),
+			"certificates": strings.Join(certificates.Strings(), " "),
+			"buildId":      ctx.Config().BuildId(),
+		},
+	})
+	m.addTransparencyLogEntry(entry)
+
+	return entry, nil
+}
+
+func transparencyLogSingletonFactory() android.Singleton {
+	return &transparencyLogSingleton{}
+}
+
+type transparencyLogSingleton struct {
+	log android.WritablePath
+}
+
+func (s *transparencyLogSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var entries android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if m, ok := module.(transparencyLogModule); ok && module.Enabled() {
+			entries = append(entries, m.TransparencyLogEntries()...)
+		}
+	})
+	if len(entries) == 0 {
+		return
+	}
+
+	s.log = android.PathForOutput(ctx, "transparency_log", "entries.jsonl")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("xargs cat <").
+		FlagWithRspFileInputList("", android.PathForOutput(ctx, "transparency_log", "entries.rsp"),
+			android.SortedUniquePaths(entries)).
+		Text(">").Output(s.log)
+	rule.Build("transparency_log", "transparency log")
+
+	ctx.Phony("transparency-log", s.log)
+}
+
+func (s *transparencyLogSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.log != nil {
+		ctx.DistForGoal("transparency-log", s.log)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*transparencyLogSingleton)(nil)
@@ -0,0 +1,77 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func TestTransparencyLog(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		PrepareForTestWithTransparencyLog,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.BuildId = proptools.StringPtr("TEST.123")
+		}),
+	).RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			certificate: ":new_certificate",
+			additional_certificates: [":additional_certificate"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app_certificate {
+			name: "new_certificate",
+			certificate: "cert/new_cert",
+		}
+
+		android_app_certificate {
+			name: "additional_certificate",
+			certificate: "cert/additional_cert",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	entry := foo.Output("transparency_log/foo.apk.json")
+	android.AssertPathRelativeToTopEquals(t, "entry input", "out/soong/.intermediates/foo/android_common/foo.apk", entry.Input)
+	android.AssertPathsRelativeToTopEquals(t, "entry implicits",
+		[]string{"cert/new_cert.x509.pem", "cert/additional_cert.x509.pem"}, entry.Implicits)
+	android.AssertStringEquals(t, "certificates",
+		"cert/new_cert.x509.pem cert/additional_cert.x509.pem", entry.Args["certificates"])
+	android.AssertStringEquals(t, "module", "foo", entry.Args["module"])
+	android.AssertStringEquals(t, "artifact", "foo.apk", entry.Args["artifact"])
+	android.AssertStringEquals(t, "build id", "TEST.123", entry.Args["buildId"])
+	android.AssertPathsRelativeToTopEquals(t, "recorded entries",
+		[]string{"out/soong/.intermediates/foo/android_common/transparency_log/foo.apk.json"},
+		foo.Module().(*AndroidApp).TransparencyLogEntries())
+
+	log := result.SingletonForTests("transparency_log").Output("transparency_log/entries.jsonl")
+	android.AssertPathsRelativeToTopEquals(t, "log inputs", []string{
+		"out/soong/.intermediates/bar/android_common/transparency_log/bar.apk.json",
+		"out/soong/.intermediates/foo/android_common/transparency_log/foo.apk.json",
+	}, log.Inputs)
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import java.io.PrintStream;
+import javax.tools.JavaCompiler;
+import javax.tools.ToolProvider;
+
+/** Runs the javac of the JDK the worker runs on. */
+public final class JavacWorker extends PersistentWorker {
+    private final JavaCompiler compiler = ToolProvider.getSystemJavaCompiler();
+
+    @Override
+    protected int run(String[] args, PrintStream out) {
+        return compiler.run(null, out, out, args);
+    }
+
+    public static void main(String[] args) throws Exception {
+        new JavacWorker().serve(args);
+    }
+}
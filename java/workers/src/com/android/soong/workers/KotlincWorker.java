@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import java.io.PrintStream;
+import java.lang.reflect.Method;
+
+/**
+ * Runs kotlinc from the kotlin-compiler.jar given as the first argument of the worker, e.g.
+ *
+ * <pre>java -jar kotlinc-worker.jar external/kotlinc/lib/kotlin-compiler.jar --persistent_worker
+ * </pre>
+ */
+public final class KotlincWorker extends PersistentWorker {
+    private final Class<?> compilerClass;
+    private final Method exec;
+
+    private KotlincWorker(String compilerJar) throws Exception {
+        compilerClass = Class.forName(
+                "org.jetbrains.kotlin.cli.jvm.K2JVMCompiler", true, toolClassLoader(compilerJar));
+        exec = compilerClass.getMethod("exec", PrintStream.class, String[].class);
+    }
+
+    @Override
+    protected int run(String[] args, PrintStream out) throws Exception {
+        // The compiler keeps state between compilations, use a new one for every request.
+        Object exitCode = exec.invoke(compilerClass.getConstructor().newInstance(), out, args);
+        return (Integer) exitCode.getClass().getMethod("getCode").invoke(exitCode);
+    }
+
+    public static void main(String[] args) throws Exception {
+        if (args.length < 2) {
+            System.err.println("usage: kotlinc-worker <kotlin-compiler.jar> --persistent_worker");
+            System.exit(2);
+        }
+        new KotlincWorker(args[0]).serve(args);
+    }
+}
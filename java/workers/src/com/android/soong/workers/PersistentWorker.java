@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import java.io.BufferedReader;
+import java.io.ByteArrayOutputStream;
+import java.io.IOException;
+import java.io.InputStreamReader;
+import java.io.PrintStream;
+import java.net.MalformedURLException;
+import java.net.URL;
+import java.net.URLClassLoader;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Paths;
+
+/**
+ * A persistent worker of the worker pool of soong_ui. It reads one WorkRequest per line on stdin,
+ * runs the tool with its arguments and writes one WorkResponse per line on stdout.
+ *
+ * <p>The pool sends a worker one request at a time, so the tool can write to System.out and
+ * System.err, which are redirected to the output of the response while it runs.
+ */
+public abstract class PersistentWorker {
+    /** Runs the tool with the arguments of a request and returns its exit code. */
+    protected abstract int run(String[] args, PrintStream out) throws Exception;
+
+    /** Serves the requests on stdin until it is closed. */
+    public void serve(String[] args) throws IOException {
+        if (args.length == 0 || !args[args.length - 1].equals("--persistent_worker")) {
+            System.err.println("usage: " + getClass().getSimpleName() + " [args] --persistent_worker");
+            System.exit(2);
+        }
+
+        PrintStream stdout = System.out;
+        PrintStream stderr = System.err;
+        BufferedReader in =
+                new BufferedReader(new InputStreamReader(System.in, StandardCharsets.UTF_8));
+        String line;
+        while ((line = in.readLine()) != null) {
+            if (line.isEmpty()) {
+                continue;
+            }
+            WorkProtocol.WorkRequest req = WorkProtocol.parseRequest(line);
+
+            ByteArrayOutputStream buf = new ByteArrayOutputStream();
+            PrintStream out = new PrintStream(buf, true, "UTF-8");
+            int exitCode;
+            System.setOut(out);
+            System.setErr(out);
+            try {
+                exitCode = run(req.arguments.toArray(new String[0]), out);
+            } catch (Throwable t) {
+                t.printStackTrace(out);
+                exitCode = 1;
+            } finally {
+                System.setOut(stdout);
+                System.setErr(stderr);
+            }
+            out.flush();
+
+            stdout.println(WorkProtocol.encodeResponse(
+                    exitCode, buf.toString("UTF-8"), req.requestId));
+            stdout.flush();
+        }
+    }
+
+    /** Returns a class loader for the tool in the jar at path. */
+    protected static ClassLoader toolClassLoader(String path) throws MalformedURLException {
+        return new URLClassLoader(
+                new URL[] {Paths.get(path).toUri().toURL()},
+                PersistentWorker.class.getClassLoader());
+    }
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import java.io.PrintStream;
+import java.lang.reflect.InvocationTargetException;
+import java.lang.reflect.Method;
+
+/**
+ * Runs the proguard compatible command line of r8 from the r8-compat-proguard.jar given as the
+ * first argument of the worker, e.g.
+ *
+ * <pre>java -jar r8-worker.jar out/host/linux-x86/framework/r8-compat-proguard.jar
+ *     --persistent_worker
+ * </pre>
+ */
+public final class R8Worker extends PersistentWorker {
+    private final Method compatProguardRun;
+
+    private R8Worker(String r8Jar) throws Exception {
+        Class<?> compatProguard = Class.forName(
+                "com.android.tools.r8.compatproguard.CompatProguard", true, toolClassLoader(r8Jar));
+        compatProguardRun = compatProguard.getMethod("run", String[].class);
+    }
+
+    @Override
+    protected int run(String[] args, PrintStream out) throws Exception {
+        try {
+            compatProguardRun.invoke(null, (Object) args);
+            return 0;
+        } catch (InvocationTargetException e) {
+            // Compilation failures are reported by exceptions, print them like r8 does.
+            out.println("Compilation failed");
+            e.getCause().printStackTrace(out);
+            return 1;
+        }
+    }
+
+    public static void main(String[] args) throws Exception {
+        if (args.length < 2) {
+            System.err.println("usage: r8-worker <r8-compat-proguard.jar> --persistent_worker");
+            System.exit(2);
+        }
+        new R8Worker(args[0]).serve(args);
+    }
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import java.util.ArrayList;
+import java.util.List;
+
+/**
+ * The JSON encoding of the WorkRequest and WorkResponse messages of the Bazel persistent worker
+ * protocol, limited to the fields used by the worker pool of soong_ui.
+ */
+public final class WorkProtocol {
+    private WorkProtocol() {}
+
+    /** A parsed WorkRequest. */
+    public static final class WorkRequest {
+        public final List<String> arguments = new ArrayList<>();
+        public int requestId;
+    }
+
+    /** Parses a WorkRequest, fields other than arguments and requestId are ignored. */
+    public static WorkRequest parseRequest(String json) {
+        Parser p = new Parser(json);
+        WorkRequest req = new WorkRequest();
+        p.expect('{');
+        if (!p.consume('}')) {
+            do {
+                String name = p.string();
+                p.expect(':');
+                if (name.equals("arguments")) {
+                    p.expect('[');
+                    if (!p.consume(']')) {
+                        do {
+                            req.arguments.add(p.string());
+                        } while (p.consume(','));
+                        p.expect(']');
+                    }
+                } else if (name.equals("requestId")) {
+                    req.requestId = Integer.parseInt(p.number());
+                } else {
+                    p.skipValue();
+                }
+            } while (p.consume(','));
+            p.expect('}');
+        }
+        return req;
+    }
+
+    /** Returns the JSON encoding of a WorkResponse. */
+    public static String encodeResponse(int exitCode, String output, int requestId) {
+        StringBuilder sb = new StringBuilder();
+        sb.append("{\"exitCode\":").append(exitCode).append(",\"output\":");
+        quote(sb, output);
+        if (requestId != 0) {
+            sb.append(",\"requestId\":").append(requestId);
+        }
+        return sb.append('}').toString();
+    }
+
+    private static void quote(StringBuilder sb, String s) {
+        sb.append('"');
+        for (int i = 0; i < s.length(); i++) {
+            char c = s.charAt(i);
+            switch (c) {
+                case '"':
+                    sb.append("\\\"");
+                    break;
+                case '\\':
+                    sb.append("\\\\");
+                    break;
+                case '\n':
+                    sb.append("\\n");
+                    break;
+                case '\r':
+                    sb.append("\\r");
+                    break;
+                case '\t':
+                    sb.append("\\t");
+                    break;
+                default:
+                    if (c < 0x20) {
+                        sb.append(String.format("\\u%04x", (int) c));
+                    } else {
+                        sb.append(c);
+                    }
+            }
+        }
+        sb.append('"');
+    }
+
+    private static final class Parser {
+        private final String s;
+        private int pos;
+
+        Parser(String s) {
+            this.s = s;
+        }
+
+        private void skipSpace() {
+            while (pos < s.length() && Character.isWhitespace(s.charAt(pos))) {
+                pos++;
+            }
+        }
+
+        boolean consume(char c) {
+            skipSpace();
+            if (pos < s.length() && s.charAt(pos) == c) {
+                pos++;
+                return true;
+            }
+            return false;
+        }
+
+        void expect(char c) {
+            if (!consume(c)) {
+                throw new IllegalArgumentException("expected '" + c + "' at offset " + pos);
+            }
+        }
+
+        String string() {
+            expect('"');
+            StringBuilder sb = new StringBuilder();
+            while (true) {
+                if (pos >= s.length()) {
+                    throw new IllegalArgumentException("unterminated string");
+                }
+                char c = s.charAt(pos++);
+                if (c == '"') {
+                    return sb.toString();
+                }
+                if (c != '\\') {
+                    sb.append(c);
+                    continue;
+                }
+                char e = s.charAt(pos++);
+                switch (e) {
+                    case 'b':
+                        sb.append('\b');
+                        break;
+                    case 'f':
+                        sb.append('\f');
+                        break;
+                    case 'n':
+                        sb.append('\n');
+                        break;
+                    case 'r':
+                        sb.append('\r');
+                        break;
+                    case 't':
+                        sb.append('\t');
+                        break;
+                    case 'u':
+                        sb.append((char) Integer.parseInt(s.substring(pos, pos + 4), 16));
+                        pos += 4;
+                        break;
+                    default:
+                        sb.append(e);
+                }
+            }
+        }
+
+        String number() {
+            skipSpace();
+            int start = pos;
+            while (pos < s.length() && "+-0123456789.eE".indexOf(s.charAt(pos)) >= 0) {
+                pos++;
+            }
+            return s.substring(start, pos);
+        }
+
+        void skipValue() {
+            skipSpace();
+            char c = s.charAt(pos);
+            if (c == '"') {
+                string();
+            } else if (c == '{' || c == '[') {
+                char end = c == '{' ? '}' : ']';
+                pos++;
+                if (!consume(end)) {
+                    do {
+                        if (c == '{') {
+                            string();
+                            expect(':');
+                        }
+                        skipValue();
+                    } while (consume(','));
+                    expect(end);
+                }
+            } else {
+                // A number, true, false or null.
+                while (pos < s.length() && ",}] \t\r\n".indexOf(s.charAt(pos)) < 0) {
+                    pos++;
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2022 The Android Open Source Project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package com.android.soong.workers;
+
+import static org.junit.Assert.assertEquals;
+
+import java.util.Arrays;
+import java.util.Collections;
+import org.junit.Test;
+
+public class WorkProtocolTest {
+    @Test
+    public void parseRequest() {
+        WorkProtocol.WorkRequest req = WorkProtocol.parseRequest(
+                "{\"arguments\":[\"-d\",\"out dir\",\"a\\\"b\\\\c\\u0041\"],\"requestId\":3,"
+                        + "\"inputs\":[{\"path\":\"a.java\",\"digest\":\"\"}],\"verbosity\":0}");
+        assertEquals(Arrays.asList("-d", "out dir", "a\"b\\cA"), req.arguments);
+        assertEquals(3, req.requestId);
+    }
+
+    @Test
+    public void parseEmptyRequest() {
+        WorkProtocol.WorkRequest req = WorkProtocol.parseRequest("{}");
+        assertEquals(Collections.emptyList(), req.arguments);
+        assertEquals(0, req.requestId);
+    }
+
+    @Test
+    public void encodeResponse() {
+        assertEquals("{\"exitCode\":1,\"output\":\"a \\\"b\\\"\\n\\u0001\"}",
+                WorkProtocol.encodeResponse(1, "a \"b\"\n\u0001", 0));
+        assertEquals("{\"exitCode\":0,\"output\":\"\",\"requestId\":2}",
+                WorkProtocol.encodeResponse(0, "", 2));
+    }
+}
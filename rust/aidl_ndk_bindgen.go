@@ -0,0 +1,75 @@
+// Copyright 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"android/soong/android"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// AidlNdkBindgenProperties describe the Rust bindings to the NDK backend of an aidl_interface
+// that CreateAidlNdkBindgen creates.
+type AidlNdkBindgenProperties struct {
+	// The name of the rust_bindgen module, which the clients list in rustlibs.
+	Name string
+
+	// The crate name of the bindings.
+	Crate_name string
+
+	// The name of the NDK backend library of the aidl_interface, e.g. "android.foo-V1-ndk".
+	Ndk_backend string
+
+	// The headers generated by the NDK backend for the types of the interface, e.g.
+	// "aidl/android/foo/IFoo.h".
+	Headers []string
+
+	// The min_sdk_version and apex_available of the NDK backend library, so that the bindings can
+	// be used wherever the library can.
+	Min_sdk_version *string
+	Apex_available  []string
+
+	// The visibility of the bindings.
+	Visibility []string
+}
+
+// CreateAidlNdkBindgen creates a rust_bindgen module that chains the headers of the NDK backend of
+// an aidl_interface through bindgen, so that a client can use an interface that has no Rust
+// backend from Rust by listing the module in rustlibs. It is called by aidl_interface when the
+// Rust bindings to its NDK backend are enabled.
+func CreateAidlNdkBindgen(ctx android.LoadHookContext, props AidlNdkBindgenProperties) {
+	ctx.CreateModule(RustBindgenFactory, &struct {
+		Name            *string
+		Crate_name      *string
+		Source_stem     *string
+		Wrapper_headers []string
+		Cpp_std         *string
+		Shared_libs     []string
+		Min_sdk_version *string
+		Apex_available  []string
+		Visibility      []string
+	}{
+		Name:            proptools.StringPtr(props.Name),
+		Crate_name:      proptools.StringPtr(props.Crate_name),
+		Source_stem:     proptools.StringPtr("bindings"),
+		Wrapper_headers: props.Headers,
+		// The headers of the NDK backend are C++ headers.
+		Cpp_std:         proptools.StringPtr("default"),
+		Shared_libs:     []string{props.Ndk_backend},
+		Min_sdk_version: props.Min_sdk_version,
+		Apex_available:  props.Apex_available,
+		Visibility:      props.Visibility,
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+// testAidlInterface stands in for aidl_interface, which is defined outside of this tree.
+type testAidlInterface struct {
+	android.ModuleBase
+
+	properties struct {
+		Headers []string
+	}
+}
+
+func (m *testAidlInterface) GenerateAndroidBuildActions(ctx android.ModuleContext) {}
+
+func testAidlInterfaceFactory() android.Module {
+	module := &testAidlInterface{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidModule(module)
+	android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+		CreateAidlNdkBindgen(ctx, AidlNdkBindgenProperties{
+			Name:        ctx.ModuleName() + "-ndk-rust",
+			Crate_name:  "android_foo_ndk",
+			Ndk_backend: ctx.ModuleName() + "-ndk",
+			Headers:     module.properties.Headers,
+		})
+	})
+	return module
+}
+
+func TestAidlNdkBindgen(t *testing.T) {
+	skipTestIfOsNotSupported(t)
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+			ctx.RegisterModuleType("test_aidl_interface", testAidlInterfaceFactory)
+		}),
+	).RunTestWithBp(t, `
+		test_aidl_interface {
+			name: "android.foo",
+			headers: ["aidl/android/foo/IFoo.h"],
+		}
+		cc_library_shared {
+			name: "android.foo-ndk",
+			export_include_dirs: ["aidl_include"],
+		}
+		rust_library {
+			name: "libclient",
+			srcs: ["foo.rs"],
+			crate_name: "client",
+			rustlibs: ["android.foo-ndk-rust"],
+		}
+	`)
+
+	bindgen := result.ModuleForTests("android.foo-ndk-rust", "android_arm64_armv8-a_source")
+	bindings := bindgen.Output("bindings.rs")
+	android.AssertStringDoesContain(t, "bindgen cflags", bindings.Args["cflags"], "-x c++")
+	android.AssertStringDoesContain(t, "bindgen cflags", bindings.Args["cflags"], "-Iaidl_include")
+	wrapper := "out/soong/.intermediates/android.foo-ndk-rust/android_arm64_armv8-a_source/bindgen_wrapper.hpp"
+	android.AssertStringEquals(t, "wrapper contents", "#include <aidl/android/foo/IFoo.h>\n",
+		android.ContentFromFileRuleForTests(t, bindgen.Output(wrapper)))
+
+	// The client links against the crate of the bindings.
+	client := result.ModuleForTests("libclient", "android_arm64_armv8-a_dylib").Rule("rustc")
+	android.AssertStringDoesContain(t, "client libs", client.Args["libFlags"], "--extern android_foo_ndk=")
+}
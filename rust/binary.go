@@ -15,6 +15,9 @@
 package rust
 
 import (
+	"path/filepath"
+	"strings"
+
 	"android/soong/android"
 )
 
@@ -42,6 +45,8 @@ type binaryDecorator struct {
 	stripper Stripper
 
 	Properties BinaryCompilerProperties
+
+	initRcTemplateProperties android.InitRcTemplateProperties
 }
 
 var _ compiler = (*binaryDecorator)(nil)
@@ -117,9 +122,15 @@ func (binary *binaryDecorator) compilerDeps(ctx DepsContext, deps Deps) Deps {
 func (binary *binaryDecorator) compilerProps() []interface{} {
 	return append(binary.baseCompiler.compilerProps(),
 		&binary.Properties,
+		&binary.initRcTemplateProperties,
 		&binary.stripper.StripProperties)
 }
 
+func (binary *binaryDecorator) install(ctx ModuleContext) {
+	binary.baseCompiler.install(ctx)
+	android.GenerateInitRcFromTemplates(ctx, &binary.initRcTemplateProperties, binary.path)
+}
+
 func (binary *binaryDecorator) nativeCoverage() bool {
 	return true
 }
@@ -134,6 +145,10 @@ func (binary *binaryDecorator) compile(ctx ModuleContext, flags Flags, deps Path
 	outputFile := android.PathForModuleOut(ctx, fileName)
 	ret := outputFile
 
+	if binary.staticallyLinked() && ctx.toolchain().Bionic() {
+		binary.checkStaticDeps(ctx, deps)
+	}
+
 	flags.RustFlags = append(flags.RustFlags, deps.depFlags...)
 	flags.LinkFlags = append(flags.LinkFlags, deps.depLinkFlags...)
 	flags.LinkFlags = append(flags.LinkFlags, deps.linkObjects...)
@@ -152,6 +167,28 @@ func (binary *binaryDecorator) compile(ctx ModuleContext, flags Flags, deps Path
 	return ret
 }
 
+// checkStaticDeps verifies that a static executable has no dynamic dependencies, either direct or
+// propagated from its rlib dependencies, so that it can run without a dynamic linker, e.g. in the
+// ramdisk or in recovery before the system partition is mounted.
+func (binary *binaryDecorator) checkStaticDeps(ctx ModuleContext, deps PathDeps) {
+	var dynamicDeps []string
+	for _, dylib := range deps.DyLibs {
+		dynamicDeps = append(dynamicDeps, dylib.Path.Base())
+	}
+	for _, sharedLib := range deps.SharedLibs {
+		dynamicDeps = append(dynamicDeps, sharedLib.Base())
+	}
+	for _, linkObject := range deps.linkObjects {
+		if strings.HasSuffix(linkObject, ".so") {
+			dynamicDeps = append(dynamicDeps, filepath.Base(linkObject))
+		}
+	}
+	if len(dynamicDeps) > 0 {
+		ctx.PropertyErrorf("static_executable", "static executables cannot have dynamic dependencies, found: %s",
+			strings.Join(android.FirstUniqueStrings(dynamicDeps), ", "))
+	}
+}
+
 func (binary *binaryDecorator) autoDep(ctx android.BottomUpMutatorContext) autoDep {
 	// Binaries default to dylib dependencies for device, rlib for host.
 	if binary.preferRlib() {
@@ -162,6 +162,65 @@ func TestStaticBinaryFlags(t *testing.T) {
 	}
 }
 
+func TestStaticBinaryRecovery(t *testing.T) {
+	ctx := testRust(t, `
+		rust_binary {
+			name: "fizz",
+			srcs: ["foo.rs"],
+			static_executable: true,
+			bootstrap: true,
+			recovery_available: true,
+			rustlibs: ["libbar"],
+		}
+		rust_library {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			recovery_available: true,
+		}`)
+
+	for _, variant := range []string{"android_arm64_armv8-a", "android_recovery_arm64_armv8-a"} {
+		fizzOut := ctx.ModuleForTests("fizz", variant).Rule("rustc")
+		android.AssertStringDoesContain(t, variant+" linkFlags", fizzOut.Args["linkFlags"], "-static")
+		android.AssertStringDoesNotContain(t, variant+" linkFlags", fizzOut.Args["linkFlags"], "-dynamic-linker")
+
+		fizzMod := ctx.ModuleForTests("fizz", variant).Module().(*Module)
+		android.AssertDeepEquals(t, variant+" dylibs", []string(nil), fizzMod.Properties.AndroidMkDylibs)
+	}
+}
+
+func TestStaticBinaryDynamicDeps(t *testing.T) {
+	testRustError(t, `static_executable: static executables cannot have dynamic dependencies, found: libbar.dylib.so`, `
+		rust_binary {
+			name: "fizz",
+			srcs: ["foo.rs"],
+			static_executable: true,
+			dylibs: ["libbar"],
+		}
+		rust_library_dylib {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+		}`)
+
+	testRustError(t, `static_executable: static executables cannot have dynamic dependencies, found: libfoo.so`, `
+		rust_binary {
+			name: "fizz",
+			srcs: ["foo.rs"],
+			static_executable: true,
+			rlibs: ["libbar"],
+		}
+		rust_library_rlib {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			shared_libs: ["libfoo"],
+		}
+		cc_library {
+			name: "libfoo",
+		}`)
+}
+
 func TestLinkObjects(t *testing.T) {
 	ctx := testRust(t, `
 		rust_binary {
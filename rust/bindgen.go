@@ -73,6 +73,12 @@ type BindgenProperties struct {
 	// cpp_std property.
 	Wrapper_src *string `android:"path,arch_variant"`
 
+	// Headers to include from a generated wrapper header instead of wrapper_src, as they are
+	// included from C or C++ sources, e.g. "aidl/android/foo/IFoo.h" to generate bindings to the
+	// headers exported by the NDK backend library of an aidl_interface listed in shared_libs. The
+	// generated wrapper is a C++ header if cpp_std is set, and a C header otherwise.
+	Wrapper_headers []string `android:"arch_variant"`
+
 	// list of bindgen-specific flags and options
 	Bindgen_flags []string `android:"arch_variant"`
 
@@ -206,7 +212,7 @@ func (b *bindgenDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) andr
 	bindgenFlags := defaultBindgenFlags
 	bindgenFlags = append(bindgenFlags, esc(b.Properties.Bindgen_flags)...)
 
-	wrapperFile := android.OptionalPathForModuleSrc(ctx, b.Properties.Wrapper_src)
+	wrapperFile := b.wrapperFile(ctx)
 	if !wrapperFile.Valid() {
 		ctx.PropertyErrorf("wrapper_src", "invalid path to wrapper source")
 	}
@@ -252,6 +258,29 @@ func (b *bindgenDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) andr
 	return outputFile
 }
 
+// wrapperFile returns the wrapper header to generate the bindings from, which is either
+// wrapper_src or a header that includes each of wrapper_headers.
+func (b *bindgenDecorator) wrapperFile(ctx ModuleContext) android.OptionalPath {
+	if len(b.Properties.Wrapper_headers) == 0 || b.Properties.Wrapper_src != nil {
+		if len(b.Properties.Wrapper_headers) > 0 {
+			ctx.PropertyErrorf("wrapper_headers", "cannot be set at the same time as wrapper_src")
+		}
+		return android.OptionalPathForModuleSrc(ctx, b.Properties.Wrapper_src)
+	}
+
+	ext := ".h"
+	if b.ClangProperties.Cpp_std != nil {
+		ext = ".hpp"
+	}
+	wrapper := android.PathForModuleOut(ctx, "bindgen_wrapper"+ext)
+	var content strings.Builder
+	for _, header := range b.Properties.Wrapper_headers {
+		fmt.Fprintf(&content, "#include <%s>\n", header)
+	}
+	android.WriteFileRule(ctx, wrapper, content.String())
+	return android.OptionalPathForPath(wrapper)
+}
+
 func (b *bindgenDecorator) SourceProviderProps() []interface{} {
 	return append(b.BaseSourceProvider.SourceProviderProps(),
 		&b.Properties, &b.ClangProperties)
@@ -17,6 +17,8 @@ package rust
 import (
 	"strings"
 	"testing"
+
+	"android/soong/android"
 )
 
 func TestRustBindgen(t *testing.T) {
@@ -143,6 +145,45 @@ func TestRustBindgenStdVersions(t *testing.T) {
 	}
 }
 
+func TestRustBindgenWrapperHeaders(t *testing.T) {
+	ctx := testRust(t, `
+		rust_bindgen {
+			name: "libbindgen",
+			wrapper_headers: ["aidl/android/foo/IFoo.h", "aidl/android/foo/Bar.h"],
+			crate_name: "bindgen",
+			stem: "libbindgen",
+			source_stem: "bindings",
+			cpp_std: "default",
+			shared_libs: ["android.foo-ndk"],
+		}
+		cc_library_shared {
+			name: "android.foo-ndk",
+			export_include_dirs: ["aidl_include"],
+		}
+	`)
+
+	libbindgen := ctx.ModuleForTests("libbindgen", "android_arm64_armv8-a_source")
+	bindings := libbindgen.Output("bindings.rs")
+	wrapper := "out/soong/.intermediates/libbindgen/android_arm64_armv8-a_source/bindgen_wrapper.hpp"
+	android.AssertPathRelativeToTopEquals(t, "bindgen input", wrapper, bindings.Input)
+	android.AssertStringDoesContain(t, "bindgen cflags", bindings.Args["cflags"], "-x c++")
+	android.AssertStringDoesContain(t, "bindgen cflags", bindings.Args["cflags"], "-Iaidl_include")
+	android.AssertStringEquals(t, "wrapper contents",
+		"#include <aidl/android/foo/IFoo.h>\n#include <aidl/android/foo/Bar.h>\n",
+		android.ContentFromFileRuleForTests(t, libbindgen.Output(wrapper)))
+
+	testRustError(t, "wrapper_headers: cannot be set at the same time as wrapper_src", `
+		rust_bindgen {
+			name: "libbindgen",
+			wrapper_src: "src/any.h",
+			wrapper_headers: ["foo.h"],
+			crate_name: "bindgen",
+			stem: "libbindgen",
+			source_stem: "bindings",
+		}
+	`)
+}
+
 func TestBindgenDisallowedFlags(t *testing.T) {
 	// Make sure passing '-x c++' to cflags generates an error
 	testRustError(t, "cflags: -x c\\+\\+ should not be specified in cflags.*", `
@@ -53,6 +53,13 @@ var (
 		},
 		"rustdocFlags", "outDir", "envVars")
 
+	rustdocZip = pctx.AndroidStaticRule("rustdocZip",
+		blueprint.RuleParams{
+			Command:     "${SoongZipCmd} -o $out -C $docDir -D $docDir/$crateName",
+			CommandDeps: []string{"${SoongZipCmd}"},
+		},
+		"docDir", "crateName")
+
 	_            = pctx.SourcePathVariable("clippyCmd", "${config.RustBin}/clippy-driver")
 	clippyDriver = pctx.AndroidStaticRule("clippy",
 		blueprint.RuleParams{
@@ -83,6 +90,30 @@ var (
 			RspfileContent: "$in",
 		},
 		"outDir")
+
+	// Generates a version script that exports only the symbols listed in the input, ignoring
+	// comments and empty lines.
+	genVersionScript = pctx.AndroidStaticRule("genVersionScript",
+		blueprint.RuleParams{
+			Command: "(echo '{' && echo '  global:' && " +
+				"sed -e '/^[[:space:]]*#/d' -e '/^[[:space:]]*$$/d' -e 's/[[:space:]]//g' -e 's/.*/    &;/' $in && " +
+				"echo '  local:' && echo '    *;' && echo '};') > $out",
+		})
+
+	// Checks that the defined dynamic symbols of a shared library match the symbols listed in
+	// exportedSymbols.
+	checkExportedSymbolsRule = pctx.AndroidStaticRule("checkExportedSymbols",
+		blueprint.RuleParams{
+			Command: "${cc_config.ClangBin}/llvm-nm -D --defined-only --extern-only --format=just-symbols $in | " +
+				"sed -e 's/@.*//' | sort -u > $out.actual && " +
+				"sed -e '/^[[:space:]]*#/d' -e '/^[[:space:]]*$$/d' -e 's/[[:space:]]//g' $exportedSymbols | " +
+				"sort -u > $out.expected && " +
+				"(diff -u $out.expected $out.actual || " +
+				"(echo 'error: the symbols exported by $in do not match $exportedSymbols' && exit 1)) && " +
+				"touch $out",
+			CommandDeps: []string{"${cc_config.ClangBin}/llvm-nm"},
+		},
+		"exportedSymbols")
 )
 
 type buildOutput struct {
@@ -93,6 +124,23 @@ func init() {
 	pctx.HostBinToolVariable("SoongZipCmd", "soong_zip")
 }
 
+// checkExportedSymbols returns a timestamp file whose rule fails when the symbols exported by the
+// shared library do not match the exported symbols list.
+func checkExportedSymbols(ctx ModuleContext, sharedLib android.Path, exportedSymbols android.Path) android.Path {
+	timestamp := android.PathForModuleOut(ctx, "exported_symbols.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        checkExportedSymbolsRule,
+		Description: "check exported symbols " + sharedLib.Base(),
+		Input:       sharedLib,
+		Implicit:    exportedSymbols,
+		Output:      timestamp,
+		Args: map[string]string{
+			"exportedSymbols": exportedSymbols.String(),
+		},
+	})
+	return timestamp
+}
+
 func TransformSrcToBinary(ctx ModuleContext, mainSrc android.Path, deps PathDeps, flags Flags,
 	outputFile android.WritablePath) buildOutput {
 	flags.GlobalRustFlags = append(flags.GlobalRustFlags, "-C lto=thin")
@@ -227,8 +275,8 @@ func transformSrctoCrate(ctx ModuleContext, main android.Path, deps PathDeps, fl
 	linkFlags = append(linkFlags, flags.GlobalLinkFlags...)
 	linkFlags = append(linkFlags, flags.LinkFlags...)
 
-	// Check if this module needs to use the bootstrap linker
-	if ctx.RustModule().Bootstrap() && !ctx.RustModule().InRecovery() && !ctx.RustModule().InRamdisk() && !ctx.RustModule().InVendorRamdisk() {
+	// Check if this module needs to use the bootstrap linker. Static executables don't use a linker.
+	if ctx.RustModule().Bootstrap() && !ctx.RustModule().StaticExecutable() && !ctx.RustModule().InRecovery() && !ctx.RustModule().InRamdisk() && !ctx.RustModule().InVendorRamdisk() {
 		dynamicLinker := "-Wl,-dynamic-linker,/system/bin/bootstrap/linker"
 		if ctx.toolchain().Is64Bit() {
 			dynamicLinker += "64"
@@ -249,6 +297,7 @@ func transformSrctoCrate(ctx ModuleContext, main android.Path, deps PathDeps, fl
 
 	implicits = append(implicits, deps.CrtBegin...)
 	implicits = append(implicits, deps.CrtEnd...)
+	implicits = append(implicits, deps.linkerDeps...)
 
 	if len(deps.SrcDeps) > 0 {
 		moduleGenDir := ctx.RustModule().compiler.CargoOutDir()
@@ -314,6 +363,7 @@ func transformSrctoCrate(ctx ModuleContext, main android.Path, deps PathDeps, fl
 		ImplicitOutputs: implicitOutputs,
 		Inputs:          inputs,
 		Implicits:       implicits,
+		Validations:     deps.validations,
 		Args: map[string]string{
 			"rustcFlags": strings.Join(rustcFlags, " "),
 			"linkFlags":  strings.Join(linkFlags, " "),
@@ -378,3 +428,22 @@ func Rustdoc(ctx ModuleContext, main android.Path, deps PathDeps,
 
 	return docTimestampFile
 }
+
+// RustdocZip packages the documentation generated by Rustdoc for the module's crate.
+func RustdocZip(ctx ModuleContext, docTimestampFile android.Path) android.ModuleOutPath {
+	crateName := ctx.RustModule().CrateName()
+	docZip := android.PathForModuleOut(ctx, "rustdoc", crateName+".zip")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        rustdocZip,
+		Description: "rustdoc zip " + crateName,
+		Output:      docZip,
+		Input:       docTimestampFile,
+		Args: map[string]string{
+			"docDir":    android.PathForOutput(ctx, "rustdoc").String(),
+			"crateName": crateName,
+		},
+	})
+
+	return docZip
+}
@@ -63,6 +63,91 @@ func TestCfgsToFlags(t *testing.T) {
 	}
 }
 
+// Test that the debug paths are remapped when RemapDebugPaths is set.
+func TestRemapDebugPaths(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.RemapDebugPaths = true
+		}),
+	).RunTestWithBp(t, `
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+		}`)
+
+	libfooDylib := result.ModuleForTests("libfoo", "linux_glibc_x86_64_dylib").Rule("rustc")
+
+	// The output directory of the test is outside the source tree, so it is remapped.
+	android.AssertStringDoesContain(t, "rustcFlags of libfoo dylib",
+		libfooDylib.Args["rustcFlags"], "--remap-path-prefix="+result.Config.OutDir()+"=out")
+}
+
+// Test that features, cfgs and flags can vary by arch and os.
+func TestArchAndOsVariantFlags(t *testing.T) {
+	ctx := testRust(t, `
+		rust_binary {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			host_supported: true,
+			features: ["common"],
+			arch: {
+				arm64: {
+					features: ["arm64"],
+					flags: ["-C arm64-flag"],
+				},
+				arm: {
+					features: ["arm"],
+					flags: ["-C arm-flag"],
+				},
+			},
+			target: {
+				android: {
+					cfgs: ["android_cfg"],
+				},
+				host: {
+					cfgs: ["host_cfg"],
+				},
+			},
+		}`)
+
+	testCases := []struct {
+		variant  string
+		expected []string
+		excluded []string
+	}{
+		{
+			variant:  "android_arm64_armv8-a",
+			expected: []string{"cfg 'feature=\"common\"'", "cfg 'feature=\"arm64\"'", "-C arm64-flag", "cfg 'android_cfg'"},
+			excluded: []string{"cfg 'feature=\"arm\"'", "-C arm-flag", "cfg 'host_cfg'"},
+		},
+		{
+			variant:  "android_arm_armv7-a-neon",
+			expected: []string{"cfg 'feature=\"common\"'", "cfg 'feature=\"arm\"'", "-C arm-flag", "cfg 'android_cfg'"},
+			excluded: []string{"cfg 'feature=\"arm64\"'", "-C arm64-flag", "cfg 'host_cfg'"},
+		},
+		{
+			variant:  "linux_glibc_x86_64",
+			expected: []string{"cfg 'feature=\"common\"'", "cfg 'host_cfg'"},
+			excluded: []string{"cfg 'feature=\"arm64\"'", "cfg 'feature=\"arm\"'", "-C arm", "cfg 'android_cfg'"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.variant, func(t *testing.T) {
+			rustcFlags := ctx.ModuleForTests("fizz-buzz", tc.variant).Rule("rustc").Args["rustcFlags"]
+			for _, flag := range tc.expected {
+				android.AssertStringDoesContain(t, "rustcFlags", rustcFlags, flag)
+			}
+			for _, flag := range tc.excluded {
+				android.AssertStringDoesNotContain(t, "rustcFlags", rustcFlags, flag)
+			}
+		})
+	}
+}
+
 // Test that we reject multiple source files.
 func TestEnforceSingleSourceFile(t *testing.T) {
 
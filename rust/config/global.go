@@ -31,6 +31,9 @@ var (
 		"libstd",
 	}
 
+	// The major version of the LLVM that the default rustc is built with.
+	RustDefaultLlvmVersion = "13"
+
 	// Mapping between Soong internal arch types and std::env constants.
 	// Required as Rust uses aarch64 when Soong uses arm64.
 	StdEnvArch = map[android.ArchType]string{
@@ -97,6 +100,22 @@ func init() {
 
 	pctx.StaticVariable("DeviceGlobalLinkFlags", strings.Join(deviceGlobalLinkFlags, " "))
 
+	android.RegisterToolVersionsProvider(rustToolVersions)
+}
+
+// rustToolVersions returns the rustc used by the build for tool_versions.json.
+func rustToolVersions(ctx android.PathContext) []android.ToolVersion {
+	base := RustDefaultBase
+	if override := ctx.Config().Getenv("RUST_PREBUILTS_BASE"); override != "" {
+		base = override
+	}
+	version := GetRustVersion(ctx)
+	return []android.ToolVersion{{
+		Name:        "rustc",
+		Version:     version,
+		Tool:        android.PathForSource(ctx, base, ctx.Config().PrebuiltOS(), version, "bin", "rustc"),
+		VersionArgs: []string{"--version"},
+	}}
 }
 
 func getRustVersionPctx(ctx android.PackageVarContext) string {
@@ -109,3 +128,13 @@ func GetRustVersion(ctx android.PathContext) string {
 	}
 	return RustDefaultVersion
 }
+
+// GetRustLlvmVersion returns the major version of the LLVM that rustc is built with. It must be
+// overridden with RUST_LLVM_VERSION when RUST_PREBUILTS_VERSION selects a rustc built with another
+// version.
+func GetRustLlvmVersion(ctx android.PathContext) string {
+	if override := ctx.Config().Getenv("RUST_LLVM_VERSION"); override != "" {
+		return override
+	}
+	return RustDefaultLlvmVersion
+}
@@ -18,8 +18,25 @@ import (
 	"android/soong/android"
 )
 
+// Documentation for rust_library modules is only generated when SOONG_GEN_RUSTDOC is set. Each
+// library then documents its crate into the shared ${OUT_DIR}/soong/rustdoc tree and packages its
+// own part of it as <crate_name>.zip, available through the ".rustdoc" output tag. The rustdoc
+// singleton zips the whole tree, including the shared index and search data, into
+// ${OUT_DIR}/soong/rustdoc.zip. For example,
+//
+//	$ SOONG_GEN_RUSTDOC=1 m rustdoc
+const envVariableGenRustdoc = "SOONG_GEN_RUSTDOC"
+
 func init() {
-	android.RegisterSingletonType("rustdoc", RustdocSingleton)
+	RegisterRustdocBuildComponents(android.InitRegistrationContext)
+}
+
+func RegisterRustdocBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("rustdoc", RustdocSingleton)
+}
+
+func rustdocEnabled(config android.Config) bool {
+	return config.IsEnvTrue(envVariableGenRustdoc)
 }
 
 func RustdocSingleton() android.Singleton {
@@ -29,6 +46,10 @@ func RustdocSingleton() android.Singleton {
 type rustdocSingleton struct{}
 
 func (n *rustdocSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !rustdocEnabled(ctx.Config()) {
+		return
+	}
+
 	docDir := android.PathForOutput(ctx, "rustdoc")
 	docZip := android.PathForOutput(ctx, "rustdoc.zip")
 	rule := android.NewRuleBuilder(pctx, ctx)
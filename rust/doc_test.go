@@ -0,0 +1,75 @@
+// Copyright 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+const rustdocBp = `
+	rust_library_host {
+		name: "libfoo",
+		srcs: ["foo.rs"],
+		crate_name: "foo",
+	}
+`
+
+func TestRustdoc(t *testing.T) {
+	skipTestIfOsNotSupported(t)
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureMergeEnv(map[string]string{envVariableGenRustdoc: "1"}),
+	).RunTestWithBp(t, rustdocBp)
+
+	var docZips []string
+	for _, variant := range result.ModuleVariantsForTests("libfoo") {
+		m := result.ModuleForTests("libfoo", variant)
+		if m.MaybeRule("rustdoc").Rule == nil {
+			continue
+		}
+		docZip := m.Rule("rustdocZip")
+		android.AssertStringEquals(t, "crateName", "foo", docZip.Args["crateName"])
+		docZips = append(docZips, docZip.Output.String())
+
+		outputFiles, err := m.Module().(*Module).OutputFiles(".rustdoc")
+		android.AssertSame(t, "OutputFiles error", nil, err)
+		android.AssertPathsRelativeToTopEquals(t, ".rustdoc output files",
+			[]string{"out/soong/.intermediates/libfoo/" + variant + "/rustdoc/foo.zip"}, outputFiles)
+	}
+	android.AssertIntEquals(t, "number of variants with rustdoc", 1, len(docZips))
+
+	zip := result.SingletonForTests("rustdoc").Output("rustdoc.zip")
+	android.AssertStringDoesContain(t, "rustdoc.zip command", zip.RuleParams.Command, "out/soong/rustdoc")
+}
+
+func TestRustdocDisabled(t *testing.T) {
+	skipTestIfOsNotSupported(t)
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+	).RunTestWithBp(t, rustdocBp)
+
+	for _, variant := range result.ModuleVariantsForTests("libfoo") {
+		if result.ModuleForTests("libfoo", variant).MaybeRule("rustdoc").Rule != nil {
+			t.Errorf("unexpected rustdoc rule for variant %q", variant)
+		}
+	}
+	if result.SingletonForTests("rustdoc").MaybeOutput("rustdoc.zip").Rule != nil {
+		t.Errorf("unexpected rustdoc.zip without %s", envVariableGenRustdoc)
+	}
+}
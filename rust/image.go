@@ -223,6 +223,10 @@ func (mod *Module) SetImageVariation(ctx android.BaseModuleContext, variant stri
 }
 
 func (mod *Module) ImageMutatorBegin(mctx android.BaseModuleContext) {
+	if mod.ProcMacro() && !checkProcMacroDeviceOnlyProperties(mctx, mod) {
+		return
+	}
+
 	// Rust does not support installing to the product image yet.
 	vendorSpecific := mctx.SocSpecific() || mctx.DeviceSpecific()
 
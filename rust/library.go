@@ -58,6 +58,21 @@ type LibraryCompilerProperties struct {
 	// path to include directories to pass to cc_* modules, only relevant for static/shared variants.
 	Include_dirs []string `android:"path,arch_variant"`
 
+	// version script to pass to the linker when building the shared library variant, which
+	// controls the symbols it exports.
+	Version_script *string `android:"path,arch_variant"`
+
+	// file listing the symbols that the shared library variant exports, one per line. Unless
+	// version_script is set, a version script that exports only these symbols is generated.
+	// The dynamic symbols of the linked library are checked against this list.
+	Exported_symbols_list *string `android:"path,arch_variant"`
+
+	// if true, the whole_static_libs of the shared library variant are linked with
+	// --whole-archive so that all their symbols are included, instead of only those referenced
+	// by this crate. Used to re-export the C API of rust_ffi_static libraries from a
+	// rust_ffi_shared library.
+	Whole_archive_static_libs *bool `android:"arch_variant"`
+
 	// Whether this library is part of the Rust toolchain sysroot.
 	Sysroot *bool
 }
@@ -142,6 +157,9 @@ type libraryInterface interface {
 	BuildOnlyShared()
 
 	toc() android.OptionalPath
+
+	// Returns true if the whole_static_libs are linked with --whole-archive
+	wholeArchiveStaticLibs() bool
 }
 
 func (library *libraryDecorator) nativeCoverage() bool {
@@ -152,6 +170,10 @@ func (library *libraryDecorator) toc() android.OptionalPath {
 	return library.tocFile
 }
 
+func (library *libraryDecorator) wholeArchiveStaticLibs() bool {
+	return library.shared() && Bool(library.Properties.Whole_archive_static_libs)
+}
+
 func (library *libraryDecorator) rlib() bool {
 	return library.MutatedProperties.VariantIsRlib
 }
@@ -515,6 +537,10 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 	flags.LinkFlags = append(flags.LinkFlags, deps.depLinkFlags...)
 	flags.LinkFlags = append(flags.LinkFlags, deps.linkObjects...)
 
+	if library.shared() {
+		flags, deps = library.exportedSymbolsFlags(ctx, flags, deps, outputFile)
+	}
+
 	if library.dylib() {
 		// We need prefer-dynamic for now to avoid linking in the static stdlib. See:
 		// https://github.com/rust-lang/rust/issues/19680
@@ -572,6 +598,48 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 	return ret
 }
 
+// exportedSymbolsFlags adds the version script that controls the symbols exported by the shared
+// library to the linker flags, and checks the exported symbols of the linked library against the
+// exported_symbols_list if it is set.
+func (library *libraryDecorator) exportedSymbolsFlags(ctx ModuleContext, flags Flags, deps PathDeps,
+	outputFile android.Path) (Flags, PathDeps) {
+
+	versionScript := android.OptionalPathForModuleSrc(ctx, library.Properties.Version_script)
+	exportedSymbols := android.OptionalPathForModuleSrc(ctx, library.Properties.Exported_symbols_list)
+	if !versionScript.Valid() && !exportedSymbols.Valid() {
+		return flags, deps
+	}
+	if ctx.Os() == android.Darwin {
+		if versionScript.Valid() {
+			ctx.PropertyErrorf("version_script", "Not supported on Darwin")
+		}
+		if exportedSymbols.Valid() {
+			ctx.PropertyErrorf("exported_symbols_list", "Not supported on Darwin")
+		}
+		return flags, deps
+	}
+
+	if !versionScript.Valid() {
+		generated := android.PathForModuleOut(ctx, "exported_symbols.map")
+		ctx.Build(pctx, android.BuildParams{
+			Rule:        genVersionScript,
+			Description: "generate version script " + generated.Base(),
+			Input:       exportedSymbols.Path(),
+			Output:      generated,
+		})
+		versionScript = android.OptionalPathForPath(generated)
+	}
+	flags.LinkFlags = append(flags.LinkFlags, "-Wl,--version-script,"+versionScript.String())
+	deps.linkerDeps = append(deps.linkerDeps, versionScript.Path())
+
+	if exportedSymbols.Valid() {
+		deps.validations = append(deps.validations,
+			checkExportedSymbols(ctx, outputFile, exportedSymbols.Path()))
+	}
+
+	return flags, deps
+}
+
 func (library *libraryDecorator) srcPath(ctx ModuleContext, deps PathDeps) android.Path {
 	if library.sourceProvider != nil {
 		// Assume the first source from the source provider is the library entry point.
@@ -589,7 +657,7 @@ func (library *libraryDecorator) rustdoc(ctx ModuleContext, flags Flags,
 	// (https://doc.rust-lang.org/rustdoc/advanced-features.html#cfgdoc-documenting-platform-specific-or-feature-specific-information),
 	// so we generate the rustdoc for only the primary module so that we have a
 	// single set of docs to refer to.
-	if ctx.Module() != ctx.PrimaryModule() {
+	if ctx.Module() != ctx.PrimaryModule() || !rustdocEnabled(ctx.Config()) {
 		return android.OptionalPath{}
 	}
 
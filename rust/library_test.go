@@ -180,6 +180,75 @@ func TestSharedLibraryToc(t *testing.T) {
 	}
 }
 
+func TestSharedLibraryVersionScript(t *testing.T) {
+	ctx := testRust(t, `
+		rust_ffi_shared {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			version_script: "libfoo.map.txt",
+		}
+		rust_ffi_shared {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			exported_symbols_list: "libfoo.symbols.txt",
+		}`)
+
+	libfoo := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+	libfooRustc := libfoo.Rule("rustc")
+	android.AssertStringDoesContain(t, "libfoo linkFlags", libfooRustc.Args["linkFlags"],
+		"-Wl,--version-script,libfoo.map.txt")
+	android.AssertStringListContains(t, "libfoo implicits", libfooRustc.Implicits.Strings(), "libfoo.map.txt")
+	if libfoo.MaybeRule("checkExportedSymbols").Rule != nil {
+		t.Errorf("expected no exported symbols check without exported_symbols_list")
+	}
+
+	libbar := ctx.ModuleForTests("libbar", "android_arm64_armv8-a_shared")
+	versionScript := libbar.Output("exported_symbols.map")
+	android.AssertPathRelativeToTopEquals(t, "version script input", "libfoo.symbols.txt", versionScript.Input)
+
+	libbarRustc := libbar.Rule("rustc")
+	android.AssertStringDoesContain(t, "libbar linkFlags", libbarRustc.Args["linkFlags"],
+		"-Wl,--version-script,"+versionScript.Output.String())
+
+	check := libbar.Rule("checkExportedSymbols")
+	android.AssertStringEquals(t, "check input", libbarRustc.Output.String(), check.Input.String())
+	android.AssertPathsRelativeToTopEquals(t, "libbar validations",
+		[]string{"out/soong/.intermediates/libbar/android_arm64_armv8-a_shared/exported_symbols.timestamp"},
+		libbarRustc.Validations)
+}
+
+func TestSharedLibraryWholeArchiveStaticLibs(t *testing.T) {
+	ctx := testRust(t, `
+		rust_ffi_static {
+			name: "libstatic",
+			srcs: ["foo.rs"],
+			crate_name: "static",
+		}
+		rust_ffi_shared {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			whole_static_libs: ["libstatic"],
+			whole_archive_static_libs: true,
+		}
+		rust_ffi_shared {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			whole_static_libs: ["libstatic"],
+		}`)
+
+	libfoo := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_shared").Rule("rustc")
+	android.AssertStringDoesContain(t, "libfoo linkFlags", libfoo.Args["linkFlags"], "-Wl,--whole-archive")
+	android.AssertStringDoesNotContain(t, "libfoo rustcFlags", libfoo.Args["rustcFlags"], "-lstatic=static")
+
+	libbar := ctx.ModuleForTests("libbar", "android_arm64_armv8-a_shared").Rule("rustc")
+	android.AssertStringDoesNotContain(t, "libbar linkFlags", libbar.Args["linkFlags"], "-Wl,--whole-archive")
+	android.AssertStringDoesContain(t, "libbar rustcFlags", libbar.Args["rustcFlags"], "-lstatic=static")
+}
+
 func TestStaticLibraryLinkage(t *testing.T) {
 	ctx := testRust(t, `
 		rust_ffi_static {
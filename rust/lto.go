@@ -0,0 +1,111 @@
+// Copyright 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"android/soong/cc"
+	cc_config "android/soong/cc/config"
+	"android/soong/rust/config"
+)
+
+// LTO (link-time optimization) of Rust modules is done by rustc for the crate types that are
+// linked, i.e. binaries and static and shared libraries, which use ThinLTO by default. The lto
+// property selects the mode, e.g.
+//
+//	rust_binary {
+//	    name: "foo",
+//	    lto: {
+//	        full: true,
+//	    },
+//	}
+//
+// When the RustCrossLanguageLto product variable is set, the static libraries of the device are
+// compiled with -C linker-plugin-lto instead, so that they contain LLVM bitcode that the linker
+// optimizes together with the C/C++ code of the cc modules linking them, which use ThinLTO for
+// that. rustc skips its own LTO in that case. The bitcode can only be read by the linker if rustc
+// and clang use the same major version of LLVM, so a mismatch is an error.
+
+type LTOProperties struct {
+	// Lto must violate capitalization style for acronyms so that it can be
+	// referred to in blueprint files as "lto"
+	Lto struct {
+		// Whether to use ThinLTO, which is the default.
+		Thin *bool `android:"arch_variant"`
+
+		// Whether to use full LTO, which optimizes the whole crate graph at once at the expense of
+		// link time.
+		Full *bool `android:"arch_variant"`
+	} `android:"arch_variant"`
+}
+
+type lto struct {
+	Properties LTOProperties
+}
+
+func (lto *lto) props() []interface{} {
+	return []interface{}{&lto.Properties}
+}
+
+// linked returns true if the crate type of the module is linked by rustc, and can therefore be
+// optimized at link time.
+func (lto *lto) linked(ctx ModuleContext) bool {
+	switch compiler := ctx.RustModule().compiler.(type) {
+	case libraryInterface:
+		return compiler.static() || compiler.shared()
+	case *procMacroDecorator:
+		return false
+	}
+	return true
+}
+
+// crossLanguageLTO returns true if the module is a static library whose objects are LLVM bitcode
+// for the cross-language LTO of the cc modules linking it.
+func (lto *lto) crossLanguageLTO(ctx ModuleContext) bool {
+	if !ctx.Config().RustCrossLanguageLTO() || !ctx.Device() || !ctx.RustModule().Static() {
+		return false
+	}
+	// Fuzzers are not built with LTO, see cc/lto.go.
+	return !ctx.RustModule().IsSanitizerEnabled(cc.Fuzzer)
+}
+
+func (lto *lto) flags(ctx ModuleContext, flags Flags, deps PathDeps) (Flags, PathDeps) {
+	thin := Bool(lto.Properties.Lto.Thin)
+	full := Bool(lto.Properties.Lto.Full)
+	if thin && full {
+		ctx.PropertyErrorf("lto", "thin and full are mutually exclusive")
+		return flags, deps
+	}
+
+	if lto.crossLanguageLTO(ctx) {
+		rustLlvmVersion, clangLlvmVersion := config.GetRustLlvmVersion(ctx), cc_config.ClangLlvmVersion(ctx)
+		if rustLlvmVersion != clangLlvmVersion {
+			ctx.ModuleErrorf("RustCrossLanguageLto requires rustc and clang to use the same LLVM "+
+				"version, but rustc uses LLVM %s and clang uses LLVM %s", rustLlvmVersion, clangLlvmVersion)
+			return flags, deps
+		}
+		flags.RustFlags = append(flags.RustFlags, "-C linker-plugin-lto")
+		return flags, deps
+	}
+
+	if !lto.linked(ctx) {
+		return flags, deps
+	}
+	if full {
+		flags.RustFlags = append(flags.RustFlags, "-C lto=fat")
+	} else if thin {
+		flags.RustFlags = append(flags.RustFlags, "-C lto=thin")
+	}
+	return flags, deps
+}
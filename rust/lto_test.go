@@ -0,0 +1,133 @@
+// Copyright 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestLtoFlags(t *testing.T) {
+	ctx := testRust(t, `
+		rust_binary {
+			name: "fizz_full",
+			srcs: ["foo.rs"],
+			lto: {
+				full: true,
+			},
+		}
+		rust_binary {
+			name: "fizz_thin",
+			srcs: ["foo.rs"],
+			lto: {
+				thin: true,
+			},
+		}
+		rust_library {
+			name: "libfoo",
+			crate_name: "foo",
+			srcs: ["foo.rs"],
+			lto: {
+				full: true,
+			},
+		}`)
+
+	full := ctx.ModuleForTests("fizz_full", "android_arm64_armv8-a").Rule("rustc")
+	android.AssertStringDoesContain(t, "rustcFlags of fizz_full", full.Args["rustcFlags"], "-C lto=fat")
+
+	thin := ctx.ModuleForTests("fizz_thin", "android_arm64_armv8-a").Rule("rustc")
+	android.AssertStringDoesContain(t, "rustcFlags of fizz_thin", thin.Args["rustcFlags"], "-C lto=thin")
+	android.AssertStringDoesNotContain(t, "rustcFlags of fizz_thin", thin.Args["rustcFlags"], "-C lto=fat")
+
+	rlib := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_rlib_dylib-std").Rule("rustc")
+	android.AssertStringDoesNotContain(t, "rustcFlags of libfoo rlib", rlib.Args["rustcFlags"], "-C lto=fat")
+
+	dylib := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_dylib").Rule("rustc")
+	android.AssertStringDoesNotContain(t, "rustcFlags of libfoo dylib", dylib.Args["rustcFlags"], "-C lto=fat")
+}
+
+func TestLtoThinAndFull(t *testing.T) {
+	testRustError(t, "thin and full are mutually exclusive", `
+		rust_binary {
+			name: "fizz",
+			srcs: ["foo.rs"],
+			lto: {
+				thin: true,
+				full: true,
+			},
+		}`)
+}
+
+func TestCrossLanguageLto(t *testing.T) {
+	bp := `
+		cc_binary {
+			name: "fizz",
+			srcs: ["foo.c"],
+			static_libs: ["libfoo_ffi"],
+		}
+		rust_ffi_static {
+			name: "libfoo_ffi",
+			crate_name: "foo",
+			srcs: ["foo.rs"],
+		}`
+
+	for _, enabled := range []bool{false, true} {
+		result := android.GroupFixturePreparers(
+			prepareForRustTest,
+			rustMockedFiles.AddToFixture(),
+			android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+				variables.RustCrossLanguageLto = enabled
+			}),
+			android.FixtureMergeEnv(map[string]string{
+				"RUST_LLVM_VERSION":    "14",
+				"LLVM_RELEASE_VERSION": "14.0.6",
+			}),
+		).RunTestWithBp(t, bp)
+
+		rustc := result.ModuleForTests("libfoo_ffi", "android_arm64_armv8-a_static").Rule("rustc")
+		ld := result.ModuleForTests("fizz", "android_arm64_armv8-a").Rule("ld")
+		if enabled {
+			android.AssertStringDoesContain(t, "rustcFlags of libfoo_ffi",
+				rustc.Args["rustcFlags"], "-C linker-plugin-lto")
+			android.AssertStringDoesContain(t, "ldFlags of fizz", ld.Args["ldFlags"], "-flto=thin")
+		} else {
+			android.AssertStringDoesNotContain(t, "rustcFlags of libfoo_ffi",
+				rustc.Args["rustcFlags"], "-C linker-plugin-lto")
+			android.AssertStringDoesNotContain(t, "ldFlags of fizz", ld.Args["ldFlags"], "-flto=thin")
+		}
+	}
+}
+
+func TestCrossLanguageLtoLlvmVersionMismatch(t *testing.T) {
+	android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.RustCrossLanguageLto = true
+		}),
+		android.FixtureMergeEnv(map[string]string{
+			"RUST_LLVM_VERSION":    "13",
+			"LLVM_RELEASE_VERSION": "14.0.6",
+		}),
+	).ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+		"rustc uses LLVM 13 and clang uses LLVM 14")).
+		RunTestWithBp(t, `
+			rust_ffi_static {
+				name: "libfoo_ffi",
+				crate_name: "foo",
+				srcs: ["foo.rs"],
+			}`)
+}
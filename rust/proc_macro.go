@@ -70,6 +70,32 @@ func (procMacro *procMacroDecorator) compilerFlags(ctx ModuleContext, flags Flag
 	return flags
 }
 
+// checkProcMacroDeviceOnlyProperties reports an error for each property of a proc-macro that only
+// applies to device modules, and returns false if there were any. Proc-macros are loaded by rustc,
+// so they are only ever built for the build host regardless of the modules that use them.
+func checkProcMacroDeviceOnlyProperties(ctx android.BaseModuleContext, mod *Module) bool {
+	deviceOnlyProperties := []struct {
+		name string
+		set  bool
+	}{
+		{"vendor_available", mod.VendorProperties.Vendor_available != nil},
+		{"odm_available", mod.VendorProperties.Odm_available != nil},
+		{"product_available", mod.VendorProperties.Product_available != nil},
+		{"ramdisk_available", mod.Properties.Ramdisk_available != nil},
+		{"vendor_ramdisk_available", mod.Properties.Vendor_ramdisk_available != nil},
+		{"recovery_available", mod.Properties.Recovery_available != nil},
+		{"min_sdk_version", mod.Properties.Min_sdk_version != nil},
+	}
+	ok := true
+	for _, prop := range deviceOnlyProperties {
+		if prop.set {
+			ctx.PropertyErrorf(prop.name, "is not supported by proc-macros, which are only built for the build host")
+			ok = false
+		}
+	}
+	return ok
+}
+
 func (procMacro *procMacroDecorator) compile(ctx ModuleContext, flags Flags, deps PathDeps) android.Path {
 	fileName := procMacro.getStem(ctx) + ctx.toolchain().ProcMacroSuffix()
 	outputFile := android.PathForModuleOut(ctx, fileName)
@@ -34,3 +34,70 @@ func TestRustProcMacro(t *testing.T) {
 		t.Errorf("--extern proc_macro flag not being passed to rustc for proc macro %#v", libprocmacro.Args["rustcFlags"])
 	}
 }
+
+func TestRustProcMacroBuiltForBuildHost(t *testing.T) {
+	ctx := testRust(t, `
+		rust_proc_macro {
+			name: "libprocmacro",
+			srcs: ["foo.rs"],
+			crate_name: "procmacro",
+		}
+		rust_library {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			proc_macros: ["libprocmacro"],
+			host_supported: true,
+		}
+	`)
+
+	// The proc-macro is only built for the first arch of the build host.
+	for _, variant := range ctx.ModuleVariantsForTests("libprocmacro") {
+		if variant != "linux_glibc_x86_64" {
+			t.Errorf("unexpected variant %q of proc-macro", variant)
+		}
+	}
+
+	procMacro := "--extern procmacro=out/soong/.intermediates/libprocmacro/linux_glibc_x86_64/libprocmacro.so"
+	for _, variant := range []string{
+		"android_arm64_armv8-a_rlib_dylib-std",
+		"android_arm_armv7-a-neon_rlib_dylib-std",
+		"linux_glibc_x86_rlib_dylib-std",
+		"linux_glibc_x86_64_rlib_dylib-std",
+	} {
+		libFlags := ctx.ModuleForTests("libfoo", variant).Rule("rustc").Args["libFlags"]
+		if !strings.Contains(libFlags, procMacro) {
+			t.Errorf("%s: expected %q in libFlags, got %q", variant, procMacro, libFlags)
+		}
+	}
+}
+
+func TestRustProcMacroDeviceOnlyProperties(t *testing.T) {
+	for _, property := range []string{
+		"vendor_available",
+		"product_available",
+		"recovery_available",
+		"ramdisk_available",
+		"vendor_ramdisk_available",
+	} {
+		t.Run(property, func(t *testing.T) {
+			testRustError(t, property+`: is not supported by proc-macros`, `
+				rust_proc_macro {
+					name: "libprocmacro",
+					srcs: ["foo.rs"],
+					crate_name: "procmacro",
+					`+property+`: true,
+				}
+			`)
+		})
+	}
+
+	testRustError(t, `min_sdk_version: is not supported by proc-macros`, `
+		rust_proc_macro {
+			name: "libprocmacro",
+			srcs: ["foo.rs"],
+			crate_name: "procmacro",
+			min_sdk_version: "29",
+		}
+	`)
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/blueprint/proptools"
+
 	"android/soong/android"
 )
 
@@ -27,6 +29,10 @@ var (
 
 const (
 	grpcSuffix = "_grpc"
+
+	// Code generators supported by rust_protobuf.
+	grpcioCodegen = "grpcio"
+	prostCodegen  = "prost"
 )
 
 type PluginType int
@@ -52,6 +58,12 @@ type ProtobufProperties struct {
 
 	// List of libraries which export include paths required for this module
 	Header_libs []string `android:"arch_variant,variant_prepend"`
+
+	// The code generator used to generate the rust source, either "grpcio" or "prost". "grpcio" uses
+	// the protoc-gen-rust plugin for protos and the grpcio plugin for grpc_protos. "prost" uses the
+	// protoc-gen-prost plugin for protos and the protoc-gen-tonic plugin for grpc_protos.
+	// Defaults to "grpcio".
+	Codegen *string
 }
 
 type protobufDecorator struct {
@@ -65,36 +77,24 @@ type protobufDecorator struct {
 	protoFlags     android.ProtoFlags
 }
 
-func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) android.Path {
-	var protoFlags android.ProtoFlags
-	var grpcProtoFlags android.ProtoFlags
-	var commonProtoFlags []string
+func (proto *protobufDecorator) codegen() string {
+	return proptools.StringDefault(proto.Properties.Codegen, grpcioCodegen)
+}
 
+func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) android.Path {
 	outDir := android.PathForModuleOut(ctx)
 	protoFiles := android.PathsForModuleSrc(ctx, proto.Properties.Protos)
 	grpcFiles := android.PathsForModuleSrc(ctx, proto.Properties.Grpc_protos)
-	protoPluginPath := ctx.Config().HostToolPath(ctx, "protoc-gen-rust")
-
-	commonProtoFlags = append(commonProtoFlags, defaultProtobufFlags...)
-	commonProtoFlags = append(commonProtoFlags, proto.Properties.Proto_flags...)
-	commonProtoFlags = append(commonProtoFlags, "--plugin=protoc-gen-rust="+protoPluginPath.String())
-
-	if len(protoFiles) > 0 {
-		protoFlags.OutTypeFlag = "--rust_out"
-		protoFlags.Flags = append(protoFlags.Flags, commonProtoFlags...)
-
-		protoFlags.Deps = append(protoFlags.Deps, protoPluginPath)
-	}
-
-	if len(grpcFiles) > 0 {
-		grpcPath := ctx.Config().HostToolPath(ctx, "grpc_rust_plugin")
 
-		grpcProtoFlags.OutTypeFlag = "--rust_out"
-		grpcProtoFlags.Flags = append(grpcProtoFlags.Flags, "--grpc_out="+outDir.String())
-		grpcProtoFlags.Flags = append(grpcProtoFlags.Flags, "--plugin=protoc-gen-grpc="+grpcPath.String())
-		grpcProtoFlags.Flags = append(grpcProtoFlags.Flags, commonProtoFlags...)
-
-		grpcProtoFlags.Deps = append(grpcProtoFlags.Deps, grpcPath, protoPluginPath)
+	switch proto.codegen() {
+	case grpcioCodegen:
+		proto.setGrpcioProtoFlags(ctx, outDir, protoFiles, grpcFiles)
+	case prostCodegen:
+		proto.setProstProtoFlags(ctx, protoFiles, grpcFiles)
+	default:
+		ctx.PropertyErrorf("codegen", "unknown codegen %q, must be one of %q or %q",
+			proto.codegen(), grpcioCodegen, prostCodegen)
+		return nil
 	}
 
 	if len(protoFiles) == 0 && len(grpcFiles) == 0 {
@@ -104,8 +104,8 @@ func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps)
 
 	// Add exported dependency include paths
 	for _, include := range deps.depIncludePaths {
-		protoFlags.Flags = append(protoFlags.Flags, "-I"+include.String())
-		grpcProtoFlags.Flags = append(grpcProtoFlags.Flags, "-I"+include.String())
+		proto.protoFlags.Flags = append(proto.protoFlags.Flags, "-I"+include.String())
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, "-I"+include.String())
 	}
 
 	stem := proto.BaseSourceProvider.getStem(ctx)
@@ -132,9 +132,14 @@ func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps)
 		protoOut := android.PathForModuleOut(ctx, protoName+".rs")
 		depFile := android.PathForModuleOut(ctx, protoName+".d")
 
+		if proto.codegen() == prostCodegen {
+			outputs = append(outputs, proto.prostRule(ctx, rule, protoFile, protoName, protoOut, nil, depFile)...)
+			continue
+		}
+
 		ruleOutputs := android.WritablePaths{protoOut, depFile}
 
-		android.ProtoRule(rule, protoFile, protoFlags, protoFlags.Deps, outDir, depFile, ruleOutputs)
+		android.ProtoRule(rule, protoFile, proto.protoFlags, proto.protoFlags.Deps, outDir, depFile, ruleOutputs)
 		outputs = append(outputs, ruleOutputs...)
 	}
 
@@ -147,19 +152,38 @@ func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps)
 		grpcOut := android.WritablePath(android.PathForModuleOut(ctx, grpcName+grpcSuffix+".rs"))
 		depFile := android.PathForModuleOut(ctx, grpcName+".d")
 
+		if proto.codegen() == prostCodegen {
+			outputs = append(outputs, proto.prostRule(ctx, rule, grpcFile, grpcName, protoOut, grpcOut, depFile)...)
+			continue
+		}
+
 		ruleOutputs := android.WritablePaths{protoOut, grpcOut, depFile}
 
-		android.ProtoRule(rule, grpcFile, grpcProtoFlags, grpcProtoFlags.Deps, outDir, depFile, ruleOutputs)
+		android.ProtoRule(rule, grpcFile, proto.grpcProtoFlags, proto.grpcProtoFlags.Deps, outDir, depFile, ruleOutputs)
 		outputs = append(outputs, ruleOutputs...)
 	}
 
 	// Check that all proto base filenames are unique as outputs are written to the same directory.
-	baseFilenames := append(proto.protoNames, proto.grpcNames...)
+	baseFilenames := append(android.CopyOf(proto.protoNames), proto.grpcNames...)
 	if len(baseFilenames) != len(android.FirstUniqueStrings(baseFilenames)) {
 		ctx.PropertyErrorf("protos", "proto filenames must be unique across  'protos' and 'grpc_protos' "+
 			"to be used in the same rust_protobuf module. For example, foo.proto and src/foo.proto will conflict.")
 	}
 
+	// Check that no generated file collides with the generated grpc files or the mod_stem.rs file, which
+	// are written to the same directory.
+	var generatedNames []string
+	for _, grpcName := range proto.grpcNames {
+		generatedNames = append(generatedNames, grpcName+grpcSuffix)
+	}
+	generatedNames = append(generatedNames, "mod_"+stem)
+	for _, name := range baseFilenames {
+		if android.InList(name, generatedNames) {
+			ctx.PropertyErrorf("protos", "proto filename %q conflicts with a generated file %q, "+
+				"rename the proto or change the source_stem.", name+".proto", name+".rs")
+		}
+	}
+
 	android.WriteFileRule(ctx, stemFile, proto.genModFileContents())
 
 	rule.Build("protoc_"+ctx.ModuleName(), "protoc "+ctx.ModuleName())
@@ -171,6 +195,98 @@ func (proto *protobufDecorator) GenerateSource(ctx ModuleContext, deps PathDeps)
 	return stemFile
 }
 
+// setGrpcioProtoFlags sets the flags to generate sources using the protoc-gen-rust plugin for protos and
+// the grpcio plugin for grpc_protos.
+func (proto *protobufDecorator) setGrpcioProtoFlags(ctx ModuleContext, outDir android.WritablePath,
+	protoFiles, grpcFiles android.Paths) {
+
+	var commonProtoFlags []string
+	protoPluginPath := ctx.Config().HostToolPath(ctx, "protoc-gen-rust")
+
+	commonProtoFlags = append(commonProtoFlags, defaultProtobufFlags...)
+	commonProtoFlags = append(commonProtoFlags, proto.Properties.Proto_flags...)
+	commonProtoFlags = append(commonProtoFlags, "--plugin=protoc-gen-rust="+protoPluginPath.String())
+
+	if len(protoFiles) > 0 {
+		proto.protoFlags.OutTypeFlag = "--rust_out"
+		proto.protoFlags.Flags = append(proto.protoFlags.Flags, commonProtoFlags...)
+
+		proto.protoFlags.Deps = append(proto.protoFlags.Deps, protoPluginPath)
+	}
+
+	if len(grpcFiles) > 0 {
+		grpcPath := ctx.Config().HostToolPath(ctx, "grpc_rust_plugin")
+
+		proto.grpcProtoFlags.OutTypeFlag = "--rust_out"
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, "--grpc_out="+outDir.String())
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, "--plugin=protoc-gen-grpc="+grpcPath.String())
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, commonProtoFlags...)
+
+		proto.grpcProtoFlags.Deps = append(proto.grpcProtoFlags.Deps, grpcPath, protoPluginPath)
+	}
+}
+
+// setProstProtoFlags sets the flags to generate sources using the protoc-gen-prost plugin for protos and
+// the protoc-gen-tonic plugin for grpc_protos.
+func (proto *protobufDecorator) setProstProtoFlags(ctx ModuleContext, protoFiles, grpcFiles android.Paths) {
+	var commonProtoFlags []string
+	prostPluginPath := ctx.Config().HostToolPath(ctx, "protoc-gen-prost")
+
+	commonProtoFlags = append(commonProtoFlags, defaultProtobufFlags...)
+	commonProtoFlags = append(commonProtoFlags, proto.Properties.Proto_flags...)
+	commonProtoFlags = append(commonProtoFlags, "--plugin=protoc-gen-prost="+prostPluginPath.String())
+
+	if len(protoFiles) > 0 {
+		proto.protoFlags.OutTypeFlag = "--prost_out"
+		proto.protoFlags.Flags = append(proto.protoFlags.Flags, commonProtoFlags...)
+
+		proto.protoFlags.Deps = append(proto.protoFlags.Deps, prostPluginPath)
+	}
+
+	if len(grpcFiles) > 0 {
+		tonicPluginPath := ctx.Config().HostToolPath(ctx, "protoc-gen-tonic")
+
+		proto.grpcProtoFlags.OutTypeFlag = "--prost_out"
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, commonProtoFlags...)
+		proto.grpcProtoFlags.Flags = append(proto.grpcProtoFlags.Flags, "--plugin=protoc-gen-tonic="+tonicPluginPath.String())
+
+		proto.grpcProtoFlags.Deps = append(proto.grpcProtoFlags.Deps, prostPluginPath, tonicPluginPath)
+	}
+}
+
+// prostRule adds the commands to generate the sources for a single proto using prost. prost names its
+// outputs after the proto package rather than the proto file, so the sources are generated into a
+// per-proto directory and then concatenated into <protoName>.rs (and <protoName>_grpc.rs for
+// grpc_protos) to match the layout of the grpcio codegen.
+func (proto *protobufDecorator) prostRule(ctx ModuleContext, rule *android.RuleBuilder, protoFile android.Path,
+	protoName string, protoOut, grpcOut, depFile android.WritablePath) android.WritablePaths {
+
+	genDir := android.PathForModuleOut(ctx, "prost", protoName)
+	flags := proto.protoFlags
+	if grpcOut != nil {
+		flags = proto.grpcProtoFlags
+		flags.Flags = append(android.CopyOf(flags.Flags), "--tonic_out="+genDir.String())
+	}
+
+	rule.Command().Text("rm -rf").Flag(genDir.String())
+	rule.Command().Text("mkdir -p").Flag(genDir.String())
+
+	android.ProtoRule(rule, protoFile, flags, flags.Deps, genDir, depFile, android.WritablePaths{depFile})
+
+	rule.Command().
+		Textf("find %s -name '*.rs' ! -name '*.tonic.rs' | sort | xargs cat >", genDir.String()).
+		Output(protoOut)
+
+	outputs := android.WritablePaths{protoOut, depFile}
+	if grpcOut != nil {
+		rule.Command().
+			Textf("find %s -name '*.tonic.rs' | sort | xargs cat >", genDir.String()).
+			Output(grpcOut)
+		outputs = append(outputs, grpcOut)
+	}
+	return outputs
+}
+
 func (proto *protobufDecorator) genModFileContents() string {
 	lines := []string{
 		"// @Soong generated Source",
@@ -183,7 +299,7 @@ func (proto *protobufDecorator) genModFileContents() string {
 		lines = append(lines, fmt.Sprintf("pub mod %s;", grpcName))
 		lines = append(lines, fmt.Sprintf("pub mod %s%s;", grpcName, grpcSuffix))
 	}
-	if len(proto.grpcNames) > 0 {
+	if len(proto.grpcNames) > 0 && proto.codegen() == grpcioCodegen {
 		lines = append(
 			lines,
 			"pub mod empty {",
@@ -206,9 +322,18 @@ func (proto *protobufDecorator) SourceProviderProps() []interface{} {
 
 func (proto *protobufDecorator) SourceProviderDeps(ctx DepsContext, deps Deps) Deps {
 	deps = proto.BaseSourceProvider.SourceProviderDeps(ctx, deps)
-	deps.Rustlibs = append(deps.Rustlibs, "libprotobuf")
 	deps.HeaderLibs = append(deps.SharedLibs, proto.Properties.Header_libs...)
 
+	if proto.codegen() == prostCodegen {
+		deps.Rustlibs = append(deps.Rustlibs, "libprost")
+		if len(proto.Properties.Grpc_protos) > 0 {
+			deps.Rustlibs = append(deps.Rustlibs, "libtonic")
+			deps.HeaderLibs = append(deps.HeaderLibs, "libprotobuf-cpp-full")
+		}
+		return deps
+	}
+
+	deps.Rustlibs = append(deps.Rustlibs, "libprotobuf")
 	if len(proto.Properties.Grpc_protos) > 0 {
 		deps.Rustlibs = append(deps.Rustlibs, "libgrpcio", "libfutures")
 		deps.HeaderLibs = append(deps.HeaderLibs, "libprotobuf-cpp-full")
@@ -217,10 +342,11 @@ func (proto *protobufDecorator) SourceProviderDeps(ctx DepsContext, deps Deps) D
 	return deps
 }
 
-// rust_protobuf generates protobuf rust code from the provided proto file. This uses the protoc-gen-rust plugin for
-// protoc. Additional flags to the protoc command can be passed via the proto_flags property. This module type will
-// create library variants that can be used as a crate dependency by adding it to the rlibs, dylibs, and rustlibs
-// properties of other modules.
+// rust_protobuf generates protobuf rust code from the provided proto file. By default this uses the protoc-gen-rust
+// plugin for protoc, the codegen property can be set to "prost" to use the protoc-gen-prost plugin instead. Additional
+// flags to the protoc command can be passed via the proto_flags property. This module type will create library
+// variants that can be used as a crate dependency by adding it to the rlibs, dylibs, and rustlibs properties of other
+// modules.
 func RustProtobufFactory() android.Module {
 	module, _ := NewRustProtobuf(android.HostAndDeviceSupported)
 	return module.Init()
@@ -113,6 +113,56 @@ func TestRustGrpc(t *testing.T) {
 	}
 }
 
+func TestRustProst(t *testing.T) {
+	ctx := testRust(t, `
+		rust_protobuf {
+			name: "librust_prost",
+			protos: ["buf.proto"],
+			grpc_protos: ["foo.proto"],
+			crate_name: "rust_prost",
+			source_stem: "buf",
+			codegen: "prost",
+		}
+	`)
+
+	librust_prost_module := ctx.ModuleForTests("librust_prost", "android_arm64_armv8-a_dylib").Module().(*Module)
+
+	// Check that libprost and libtonic are added as dependencies instead of libprotobuf and libgrpcio.
+	for _, dep := range []string{"libprost", "libtonic"} {
+		if !android.InList(dep, librust_prost_module.Properties.AndroidMkDylibs) {
+			t.Errorf("%s dependency missing for rust_prost (dependency missing from AndroidMkDylibs)", dep)
+		}
+	}
+	for _, dep := range []string{"libprotobuf", "libgrpcio"} {
+		if android.InList(dep, librust_prost_module.Properties.AndroidMkDylibs) {
+			t.Errorf("unexpected %s dependency for rust_prost", dep)
+		}
+	}
+
+	// Make sure the correct plugins are being used.
+	source := ctx.ModuleForTests("librust_prost", "android_arm64_armv8-a_source")
+	cmd := source.Output("foo_grpc.rs").RuleParams.Command
+	for _, w := range []string{"protoc-gen-prost", "protoc-gen-tonic", "--tonic_out="} {
+		if !strings.Contains(cmd, w) {
+			t.Errorf("expected %q in %q", w, cmd)
+		}
+	}
+	if w := "protoc-gen-rust"; strings.Contains(cmd, w) {
+		t.Errorf("unexpected %q in %q", w, cmd)
+	}
+
+	// The prost codegen does not re-export the rust-protobuf well known types.
+	modFile := android.ContentFromFileRuleForTests(t, source.Output("mod_buf.rs"))
+	if w := "protobuf::well_known_types"; strings.Contains(modFile, w) {
+		t.Errorf("unexpected %q in %q", w, modFile)
+	}
+	for _, w := range []string{"pub mod buf;", "pub mod foo;", "pub mod foo_grpc;"} {
+		if !strings.Contains(modFile, w) {
+			t.Errorf("expected %q in %q", w, modFile)
+		}
+	}
+}
+
 func TestRustProtoErrors(t *testing.T) {
 	testRustError(t, "A proto can only be added once to either grpc_protos or protos.*", `
 		rust_protobuf {
@@ -133,4 +183,33 @@ func TestRustProtoErrors(t *testing.T) {
 			source_stem: "buf",
 		}
 	`)
+
+	testRustError(t, "proto filename \"buf_grpc.proto\" conflicts with a generated file.*", `
+		rust_protobuf {
+			name: "librust_grpcio",
+			protos: ["buf_grpc.proto"],
+			grpc_protos: ["buf.proto"],
+			crate_name: "rust_grpcio",
+			source_stem: "stem",
+		}
+	`)
+
+	testRustError(t, "proto filename \"mod_buf.proto\" conflicts with a generated file.*", `
+		rust_protobuf {
+			name: "librust_proto",
+			protos: ["mod_buf.proto"],
+			crate_name: "rust_proto",
+			source_stem: "buf",
+		}
+	`)
+
+	testRustError(t, "unknown codegen \"foo\".*", `
+		rust_protobuf {
+			name: "librust_proto",
+			protos: ["buf.proto"],
+			crate_name: "rust_proto",
+			source_stem: "buf",
+			codegen: "foo",
+		}
+	`)
 }
@@ -153,6 +153,7 @@ type Module struct {
 	compiler         compiler
 	coverage         *coverage
 	clippy           *clippy
+	lto              *lto
 	sanitize         *sanitize
 	cachedToolchain  config.Toolchain
 	sourceProvider   SourceProvider
@@ -162,6 +163,7 @@ type Module struct {
 	outputFile android.OptionalPath
 
 	docTimestampFile android.OptionalPath
+	docZipFile       android.OptionalPath
 
 	hideApexVariantFromMake bool
 
@@ -210,6 +212,11 @@ func (mod *Module) OutputFiles(tag string) (android.Paths, error) {
 			}
 			return android.Paths{}, nil
 		}
+	case ".rustdoc":
+		if mod.docZipFile.Valid() {
+			return android.Paths{mod.docZipFile.Path()}, nil
+		}
+		return android.Paths{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -442,6 +449,11 @@ type PathDeps struct {
 	// Paths to generated source files
 	SrcDeps          android.Paths
 	srcProviderFiles android.Paths
+
+	// linkerDeps are implicit inputs of the linker, like version scripts. validations are checks
+	// of the output that are run whenever it is built.
+	linkerDeps  android.Paths
+	validations android.Paths
 }
 
 type RustLibraries []RustLibrary
@@ -582,6 +594,7 @@ func DefaultsFactory(props ...interface{}) android.Module {
 		&cc.CoverageProperties{},
 		&cc.RustBindgenClangProperties{},
 		&ClippyProperties{},
+		&LTOProperties{},
 		&SanitizeProperties{},
 	)
 
@@ -718,6 +731,9 @@ func (mod *Module) Init() android.Module {
 	if mod.clippy != nil {
 		mod.AddProperties(mod.clippy.props()...)
 	}
+	if mod.lto != nil {
+		mod.AddProperties(mod.lto.props()...)
+	}
 	if mod.sourceProvider != nil {
 		mod.AddProperties(mod.sourceProvider.SourceProviderProps()...)
 	}
@@ -743,6 +759,7 @@ func newModule(hod android.HostOrDeviceSupported, multilib android.Multilib) *Mo
 	module.afdo = &afdo{}
 	module.coverage = &coverage{}
 	module.clippy = &clippy{}
+	module.lto = &lto{}
 	module.sanitize = &sanitize{}
 	return module
 }
@@ -882,6 +899,9 @@ func (mod *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 	if mod.clippy != nil {
 		flags, deps = mod.clippy.flags(ctx, flags, deps)
 	}
+	if mod.lto != nil {
+		flags, deps = mod.lto.flags(ctx, flags, deps)
+	}
 	if mod.sanitize != nil {
 		flags, deps = mod.sanitize.flags(ctx, flags, deps)
 	}
@@ -914,6 +934,7 @@ func (mod *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 		mod.docTimestampFile = mod.compiler.rustdoc(ctx, flags, deps)
 		if mod.docTimestampFile.Valid() {
 			ctx.CheckbuildFile(mod.docTimestampFile.Path())
+			mod.docZipFile = android.OptionalPathForPath(RustdocZip(ctx, mod.docTimestampFile.Path()))
 		}
 
 		// glob exported headers for snapshot, if BOARD_VNDK_VERSION is current or
@@ -1110,6 +1131,18 @@ func (mod *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 				directRlibDeps = append(directRlibDeps, rustDep)
 				mod.Properties.AndroidMkRlibs = append(mod.Properties.AndroidMkRlibs, makeLibName)
 			case procMacroDepTag:
+				if !rustDep.ProcMacro() {
+					ctx.ModuleErrorf("mod %q not a proc_macro", depName)
+					return
+				}
+				// rustc loads proc-macros as compiler plugins, so they must be built for the build host
+				// no matter which target this module is built for.
+				buildHost := ctx.Config().BuildOSTarget
+				if target := rustDep.Target(); target.Os != buildHost.Os || target.Arch.ArchType != buildHost.Arch.ArchType {
+					ctx.ModuleErrorf("proc_macro %q is built for %s instead of the build host %s",
+						depName, target.String(), buildHost.String())
+					return
+				}
 				directProcMacroDeps = append(directProcMacroDeps, rustDep)
 				mod.Properties.AndroidMkProcMacroLibs = append(mod.Properties.AndroidMkProcMacroLibs, makeLibName)
 			}
@@ -1176,10 +1209,11 @@ func (mod *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 				if cc.IsWholeStaticLib(depTag) {
 					// rustc will bundle static libraries when they're passed with "-lstatic=<lib>". This will fail
 					// if the library is not prefixed by "lib".
-					if mod.Binary() {
+					if lib, ok := mod.compiler.(libraryInterface); mod.Binary() || (ok && lib.wholeArchiveStaticLibs()) {
 						// Binaries may sometimes need to link whole static libraries that don't start with 'lib'.
 						// Since binaries don't need to 'rebundle' these like libraries and only use these for the
-						// final linkage, pass the args directly to the linker to handle these cases.
+						// final linkage, pass the args directly to the linker to handle these cases. Shared
+						// libraries that re-export the symbols of their whole static libraries do the same.
 						depPaths.depLinkFlags = append(depPaths.depLinkFlags, []string{"-Wl,--whole-archive", linkObject.Path().String(), "-Wl,--no-whole-archive"}...)
 					} else if libName, ok := libNameFromFilePath(linkObject.Path()); ok {
 						depPaths.depFlags = append(depPaths.depFlags, "-lstatic="+libName)
@@ -1538,6 +1572,16 @@ func (mod *Module) MinSdkVersion() string {
 	return String(mod.Properties.Min_sdk_version)
 }
 
+// Implements android.ApexModule
+func (mod *Module) UniqueApexVariations() bool {
+	// The files generated from the init_rc_template and vintf_fragments_template of a binary
+	// contain the path of the variant in its APEX.
+	if binary, ok := mod.compiler.(*binaryDecorator); ok {
+		return binary.initRcTemplateProperties.HasTemplates()
+	}
+	return false
+}
+
 // Implements android.ApexModule
 func (mod *Module) ShouldSupportSdkVersion(ctx android.BaseModuleContext, sdkVersion android.ApiLevel) error {
 	minSdkVersion := mod.MinSdkVersion()
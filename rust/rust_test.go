@@ -60,6 +60,8 @@ var rustMockedFiles = android.MockFS{
 	"libz.so":                      nil,
 	"data.txt":                     nil,
 	"liblog.map.txt":               nil,
+	"libfoo.map.txt":               nil,
+	"libfoo.symbols.txt":           nil,
 }
 
 // testRust returns a TestContext in which a basic environment has been setup.
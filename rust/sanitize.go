@@ -33,6 +33,9 @@ type SanitizeProperties struct {
 		Address   *bool `android:"arch_variant"`
 		Hwaddress *bool `android:"arch_variant"`
 
+		// shadow-call-stack sanitizer, only available on arm64
+		Scs *bool `android:"arch_variant"`
+
 		// Memory-tagging, only available on arm64
 		// if diag.memtag unset or false, enables async memory tagging
 		Memtag_heap *bool `android:"arch_variant"`
@@ -92,6 +95,12 @@ var hwasanFlags = []string{
 	"-C llvm-args=--hwasan-with-ifunc",
 }
 
+// See cc/sanitize.go for the shadow-call-stack flags, the x18 register it uses is reserved by the
+// aarch64 Android targets.
+var scsFlags = []string{
+	"-Z sanitizer=shadow-call-stack",
+}
+
 func boolPtr(v bool) *bool {
 	if v {
 		return &v
@@ -205,6 +214,11 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 		s.Hwaddress = nil
 	}
 
+	// SCS is only implemented on AArch64.
+	if ctx.Arch().ArchType != android.Arm64 {
+		s.Scs = nil
+	}
+
 	// HWASan ramdisk (which is built from recovery) goes over some bootloader limit.
 	// Keep libc instrumented so that ramdisk / vendor_ramdisk / recovery can run hwasan-instrumented code if necessary.
 	if (ctx.RustModule().InRamdisk() || ctx.RustModule().InVendorRamdisk() || ctx.RustModule().InRecovery()) && !strings.HasPrefix(ctx.ModuleDir(), "bionic/libc") {
@@ -220,7 +234,7 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 		s.Memtag_heap = nil
 	}
 
-	if ctx.Os() == android.Android && (Bool(s.Hwaddress) || Bool(s.Address) || Bool(s.Memtag_heap)) {
+	if ctx.Os() == android.Android && (Bool(s.Hwaddress) || Bool(s.Address) || Bool(s.Scs) || Bool(s.Memtag_heap)) {
 		sanitize.Properties.SanitizerEnabled = true
 	}
 }
@@ -245,6 +259,9 @@ func (sanitize *sanitize) flags(ctx ModuleContext, flags Flags, deps PathDeps) (
 	} else if Bool(sanitize.Properties.Sanitize.Address) {
 		flags.RustFlags = append(flags.RustFlags, asanFlags...)
 	}
+	if Bool(sanitize.Properties.Sanitize.Scs) {
+		flags.RustFlags = append(flags.RustFlags, scsFlags...)
+	}
 	return flags, deps
 }
 
@@ -323,6 +340,9 @@ func (sanitize *sanitize) SetSanitizer(t cc.SanitizerType, b bool) {
 	case cc.Hwasan:
 		sanitize.Properties.Sanitize.Hwaddress = boolPtr(b)
 		sanitizerSet = true
+	case cc.Scs:
+		sanitize.Properties.Sanitize.Scs = boolPtr(b)
+		sanitizerSet = true
 	case cc.Memtag_heap:
 		sanitize.Properties.Sanitize.Memtag_heap = boolPtr(b)
 		sanitizerSet = true
@@ -385,6 +405,8 @@ func (sanitize *sanitize) getSanitizerBoolPtr(t cc.SanitizerType) *bool {
 		return sanitize.Properties.Sanitize.Address
 	case cc.Hwasan:
 		return sanitize.Properties.Sanitize.Hwaddress
+	case cc.Scs:
+		return sanitize.Properties.Sanitize.Scs
 	case cc.Memtag_heap:
 		return sanitize.Properties.Sanitize.Memtag_heap
 	default:
@@ -393,12 +415,15 @@ func (sanitize *sanitize) getSanitizerBoolPtr(t cc.SanitizerType) *bool {
 }
 
 func (sanitize *sanitize) AndroidMk(ctx AndroidMkContext, entries *android.AndroidMkEntries) {
-	// Add a suffix for hwasan rlib libraries to allow surfacing both the sanitized and
+	// Add a suffix for hwasan and scs rlib libraries to allow surfacing both the sanitized and
 	// non-sanitized variants to make without a name conflict.
 	if entries.Class == "RLIB_LIBRARIES" || entries.Class == "STATIC_LIBRARIES" {
 		if sanitize.isSanitizerEnabled(cc.Hwasan) {
 			entries.SubName += ".hwasan"
 		}
+		if sanitize.isSanitizerEnabled(cc.Scs) {
+			entries.SubName += ".scs"
+		}
 	}
 }
 
@@ -417,6 +442,8 @@ func (mod *Module) SanitizerSupported(t cc.SanitizerType) bool {
 			return false
 		}
 		return true
+	case cc.Scs:
+		return true
 	case cc.Memtag_heap:
 		return true
 	default:
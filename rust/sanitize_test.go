@@ -363,3 +363,40 @@ func TestSanitizeMemtagHeapWithSanitizeDeviceDiag(t *testing.T) {
 	checkHasMemtagNote(t, ctx.ModuleForTests("unset_test_override_default_disable", variant), Sync)
 	checkHasMemtagNote(t, ctx.ModuleForTests("unset_test_override_default_sync", variant), Sync)
 }
+
+func TestSanitizeScs(t *testing.T) {
+	ctx := testRust(t, `
+		rust_binary {
+			name: "scs_binary",
+			srcs: ["foo.rs"],
+			compile_multilib: "both",
+			sanitize: {
+				scs: true,
+			},
+		}
+		rust_binary {
+			name: "arch_scs_binary",
+			srcs: ["foo.rs"],
+			compile_multilib: "both",
+			arch: {
+				arm64: {
+					sanitize: {
+						scs: true,
+					},
+				},
+			},
+		}`)
+
+	for _, name := range []string{"scs_binary", "arch_scs_binary"} {
+		arm64Flags := ctx.ModuleForTests(name, "android_arm64_armv8-a").Rule("rustc").Args["rustcFlags"]
+		if !strings.Contains(arm64Flags, "-Z sanitizer=shadow-call-stack") {
+			t.Errorf("%s: expected the arm64 variant to enable shadow-call-stack, got %q", name, arm64Flags)
+		}
+
+		// SCS is only implemented on AArch64, the 32-bit variant isn't sanitized.
+		armFlags := ctx.ModuleForTests(name, "android_arm_armv7-a-neon").Rule("rustc").Args["rustcFlags"]
+		if strings.Contains(armFlags, "-Z sanitizer=shadow-call-stack") {
+			t.Errorf("%s: expected the arm variant not to enable shadow-call-stack, got %q", name, armFlags)
+		}
+	}
+}
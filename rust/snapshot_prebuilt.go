@@ -69,6 +69,11 @@ func snapshotLibraryFactory(image cc.SnapshotImage, moduleSuffix string) (*Modul
 	return module, prebuilt
 }
 
+func (library *snapshotLibraryDecorator) compilerDeps(ctx DepsContext, deps Deps) Deps {
+	library.AddSnapshotManifestDependency(ctx)
+	return library.libraryDecorator.compilerDeps(ctx, deps)
+}
+
 func (library *snapshotLibraryDecorator) compile(ctx ModuleContext, flags Flags, deps PathDeps) android.Path {
 	var variant string
 	if library.static() {
@@ -87,7 +92,10 @@ func (library *snapshotLibraryDecorator) compile(ctx ModuleContext, flags Flags,
 	if !library.MatchesWithDevice(ctx.DeviceConfig()) {
 		return nil
 	}
-	outputFile := android.PathForModuleSrc(ctx, *library.properties.Src)
+	outputFile := library.SnapshotSrcPath(ctx, *library.properties.Src)
+	if outputFile == nil {
+		return nil
+	}
 	library.unstrippedOutputFile = outputFile
 	return outputFile
 }
@@ -185,6 +185,17 @@ func (test *testDecorator) install(ctx ModuleContext) {
 		test.Properties.Test_options.Unit_test = proptools.BoolPtr(true)
 	}
 	test.binaryDecorator.install(ctx)
+
+	if ctx.Host() && Bool(test.Properties.Test_options.Unit_test) {
+		inputs := android.Paths{test.path}
+		for _, data := range test.data {
+			inputs = append(inputs, data.SrcPath)
+		}
+		android.BuildHostTestRun(ctx, android.HostTestRunParams{
+			Command: test.path.String(),
+			Inputs:  inputs,
+		})
+	}
 }
 
 func (test *testDecorator) compilerFlags(ctx ModuleContext, flags Flags) Flags {
@@ -143,6 +143,18 @@ func GatherRequiredDepsForTest() string {
 			srcs: ["foo.rs"],
 			host_supported: true,
 		}
+		rust_library {
+			name: "libprost",
+			crate_name: "prost",
+			srcs: ["foo.rs"],
+			host_supported: true,
+		}
+		rust_library {
+			name: "libtonic",
+			crate_name: "tonic",
+			srcs: ["foo.rs"],
+			host_supported: true,
+		}
 		rust_library {
 			name: "liblibfuzzer_sys",
 			crate_name: "libfuzzer_sys",
@@ -194,6 +206,7 @@ func registerRequiredBuildComponentsForTest(ctx android.RegistrationContext) {
 		ctx.BottomUp("rust_begin", BeginMutator).Parallel()
 	})
 	ctx.RegisterSingletonType("rust_project_generator", rustProjectGeneratorSingleton)
+	RegisterRustdocBuildComponents(ctx)
 	ctx.PostDepsMutators(func(ctx android.RegisterMutatorsContext) {
 		ctx.BottomUp("rust_sanitizers", rustSanitizerRuntimeMutator).Parallel()
 	})
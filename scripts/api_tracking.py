@@ -0,0 +1,191 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for generating the API tracking database of an sdk library.
+
+The database maps every API symbol found in the finalized API signature files
+of the library to the API level, or the SDK extension version if it was never
+finalized in an API level, it was introduced in, e.g.:
+
+  {
+    "android.foo.Bar": {"api_level": 30},
+    "android.foo.Bar#Bar(int)": {"api_level": 30},
+    "android.foo.Bar#baz(java.lang.String)": {"extension": 2},
+    "android.foo.Bar#QUX": {"api_level": 31}
+  }
+
+Classes are identified by their qualified names, methods and constructors by
+the qualified name of their class, their name and their parameter types, and
+fields, enum constants and properties by the qualified name of their class and
+their name.
+"""
+
+from __future__ import print_function
+
+import argparse
+import json
+import re
+import sys
+
+
+_ANNOTATION_RE = re.compile(r'@[\w.]+(\([^)]*\))?\s*')
+_CLASS_RE = re.compile(r'\b(?:class|interface|@interface|enum)\s+([\w.$]+)')
+_MEMBER_KINDS = ('ctor', 'method', 'field', 'enum_constant', 'property')
+
+
+def parse_versioned_file(arg):
+  """Parses a <version>:<file> argument."""
+
+  version, sep, path = arg.partition(':')
+  if not sep or not version.isdigit():
+    raise argparse.ArgumentTypeError(
+        'expected <version>:<file>, got %r' % arg)
+  return int(version), path
+
+
+def parse_args():
+  """Parse commandline arguments."""
+
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--api', dest='apis', action='append', default=[],
+                      type=parse_versioned_file,
+                      help='<api level>:<file> API signature file of the '
+                      'library finalized in the API level')
+  parser.add_argument('--extension', dest='extensions', action='append',
+                      default=[], type=parse_versioned_file,
+                      help='<extension version>:<file> API signature file of '
+                      'the library finalized in the SDK extension version')
+  parser.add_argument('--out', dest='out', required=True,
+                      help='output database file')
+  return parser.parse_args()
+
+
+def split_params(params):
+  """Splits a parameter list on the commas that are not in type arguments."""
+
+  result = []
+  depth = 0
+  current = ''
+  for c in params:
+    if c == ',' and depth == 0:
+      result.append(current)
+      current = ''
+      continue
+    if c == '<':
+      depth += 1
+    elif c == '>':
+      depth -= 1
+    current += c
+  if current.strip():
+    result.append(current)
+  return result
+
+
+def member_symbol(class_name, kind, declaration):
+  """Returns the symbol of a member declared in the class."""
+
+  declaration = _ANNOTATION_RE.sub('', declaration).rstrip(';')
+  if kind in ('ctor', 'method'):
+    name_end = declaration.index('(')
+    name = declaration[:name_end].split()[-1]
+    params = declaration[name_end + 1:declaration.rindex(')')]
+    # Only keep the parameter types, for the signature formats that also list
+    # the parameter names.
+    types = [p.split()[0] for p in split_params(params)]
+    return '%s#%s(%s)' % (class_name, name, ', '.join(types))
+  name = declaration.split(' = ')[0].split()[-1]
+  return '%s#%s' % (class_name, name)
+
+
+def parse_api(lines):
+  """Returns the symbols declared in the lines of an API signature file."""
+
+  symbols = []
+  package = None
+  class_name = None
+  for line in lines:
+    line = line.strip()
+    if not line or line.startswith('//'):
+      continue
+    if line.startswith('package ') and line.endswith('{'):
+      package = line[len('package '):-1].strip()
+      continue
+    kind = line.split(' ', 1)[0]
+    if kind in _MEMBER_KINDS and class_name:
+      symbols.append(member_symbol(class_name, kind, line[len(kind):]))
+      continue
+    if line.endswith('{'):
+      match = _CLASS_RE.search(_ANNOTATION_RE.sub('', line))
+      if match:
+        class_name = '%s.%s' % (package, match.group(1))
+        symbols.append(class_name)
+      continue
+    if line == '}':
+      # Classes are not nested in signature files, the brace closes either the
+      # current class or the package.
+      if class_name:
+        class_name = None
+      else:
+        package = None
+  return symbols
+
+
+def api_tracking(apis, extensions):
+  """Returns the API tracking database.
+
+  Args:
+    apis: The (api level, lines) pairs of the API signature files finalized in
+      API levels.
+    extensions: The (extension version, lines) pairs of the API signature files
+      finalized in SDK extension versions.
+  Returns:
+    The database, mapping each symbol to the version it was introduced in.
+  """
+
+  database = {}
+  for key, versioned_files in (('api_level', apis), ('extension', extensions)):
+    for version, lines in sorted(versioned_files, key=lambda f: f[0]):
+      for symbol in parse_api(lines):
+        if symbol not in database:
+          database[symbol] = {key: version}
+  return database
+
+
+def main():
+  """Program entry point."""
+  try:
+    args = parse_args()
+
+    def read(versioned_files):
+      result = []
+      for version, path in versioned_files:
+        with open(path) as f:
+          result.append((version, f.readlines()))
+      return result
+
+    database = api_tracking(read(args.apis), read(args.extensions))
+
+    with open(args.out, 'w') as f:
+      json.dump(database, f, indent=2, sort_keys=True)
+      f.write('\n')
+
+  # pylint: disable=broad-except
+  except Exception as err:
+    print('error: ' + str(err), file=sys.stderr)
+    sys.exit(-1)
+
+if __name__ == '__main__':
+  main()
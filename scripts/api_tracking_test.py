@@ -0,0 +1,120 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for api_tracking.py."""
+
+import sys
+import unittest
+
+import api_tracking
+
+sys.dont_write_bytecode = True
+
+
+API_30 = '''// Signature format: 2.0
+package android.foo {
+
+  public class Bar {
+    ctor public Bar(int);
+    method public void baz(@NonNull java.lang.String);
+    method @IntRange(from=0) public int count();
+  }
+
+}
+'''
+
+API_31 = '''// Signature format: 2.0
+package android.foo {
+
+  public class Bar {
+    ctor public Bar(int);
+    method public void baz(@NonNull java.lang.String);
+    method @IntRange(from=0) public int count();
+    method public java.util.Map<java.lang.String,java.lang.Integer> map(java.util.List<java.lang.String>, int...);
+    field public static final int QUX = 1; // 0x1
+  }
+
+  public enum Color {
+    enum_constant public static final android.foo.Color RED;
+  }
+
+  public static interface Bar.Listener {
+    method public void onBar();
+  }
+
+}
+'''
+
+EXTENSION_2 = '''// Signature format: 2.0
+package android.foo {
+
+  public class Bar {
+    ctor public Bar(int);
+    method public void extension();
+  }
+
+}
+'''
+
+
+class ParseApiTest(unittest.TestCase):
+  """Unit tests for parse_api function."""
+
+  def test_symbols(self):
+    self.assertEqual(api_tracking.parse_api(API_31.splitlines()), [
+        'android.foo.Bar',
+        'android.foo.Bar#Bar(int)',
+        'android.foo.Bar#baz(java.lang.String)',
+        'android.foo.Bar#count()',
+        'android.foo.Bar#map(java.util.List<java.lang.String>, int...)',
+        'android.foo.Bar#QUX',
+        'android.foo.Color',
+        'android.foo.Color#RED',
+        'android.foo.Bar.Listener',
+        'android.foo.Bar.Listener#onBar()',
+    ])
+
+  def test_parameter_names(self):
+    api = [
+        'package android.foo {',
+        '  public class Bar {',
+        '    method public void baz(@NonNull java.lang.String s, int i);',
+        '  }',
+        '}',
+    ]
+    self.assertEqual(api_tracking.parse_api(api), [
+        'android.foo.Bar',
+        'android.foo.Bar#baz(java.lang.String, int)',
+    ])
+
+
+class ApiTrackingTest(unittest.TestCase):
+  """Unit tests for api_tracking function."""
+
+  def test_introduction_versions(self):
+    database = api_tracking.api_tracking(
+        [(31, API_31.splitlines()), (30, API_30.splitlines())],
+        [(2, EXTENSION_2.splitlines())])
+    self.assertEqual(database['android.foo.Bar'], {'api_level': 30})
+    self.assertEqual(database['android.foo.Bar#Bar(int)'], {'api_level': 30})
+    self.assertEqual(database['android.foo.Bar#QUX'], {'api_level': 31})
+    self.assertEqual(database['android.foo.Bar.Listener#onBar()'],
+                     {'api_level': 31})
+    self.assertEqual(database['android.foo.Bar#extension()'], {'extension': 2})
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
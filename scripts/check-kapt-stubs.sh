@@ -0,0 +1,57 @@
+#!/bin/bash
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -e
+
+if [[ $# -ne 4 ]]; then
+  cat <<EOF2
+Usage:
+  check-kapt-stubs.sh <javap> <kotlin-header-jar> <stubs-header-jar> <timestamp>
+Checks that every class in <kotlin-header-jar>, the header jar produced by
+kotlinc, has the same public signature in <stubs-header-jar>, the header jar
+compiled from the Java stubs generated by kapt. Touches <timestamp> if they
+match.
+EOF2
+  exit 1
+fi
+
+javap=$1
+kotlin_header_jar=$2
+stubs_header_jar=$3
+timestamp=$4
+
+classes=$(zipinfo -1 "${kotlin_header_jar}" | grep '\.class$' | grep -v '^META-INF/' | \
+  sed -e 's/\.class$//' -e 's|/|.|g' | sort)
+
+if [[ -n "${classes}" ]]; then
+  # The "Compiled from" lines differ between kotlinc and turbine, and a class that is missing
+  # from the stubs results in an error message that differs from the kotlinc signature.
+  dump() {
+    "${javap}" -public -cp "$1" ${classes} 2>&1 | grep -v '^Compiled from' || true
+  }
+
+  if ! diff -u --label kotlinc --label kapt-stubs \
+      <(dump "${kotlin_header_jar}") <(dump "${stubs_header_jar}") > "${timestamp}.diff"; then
+    echo "error: the Java stubs generated by kapt differ from the classes compiled by kotlinc," >&2
+    echo "so annotation processors ran against incorrect signatures:" >&2
+    cat "${timestamp}.diff" >&2
+    rm -f "${timestamp}.diff"
+    exit 1
+  fi
+  rm -f "${timestamp}.diff"
+fi
+
+touch "${timestamp}"
@@ -0,0 +1,184 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for finding classes contributed by more than one input of a module.
+
+Each input is a jar passed with --jar name=path, where name is the module that
+contributes it. A class that is in the jars of more than one module with
+different contents is reported along with the modules that contribute it,
+unless it matches one of the --allow patterns, e.g. com.example.Foo,
+com.example.* for the classes in a package or com.example.** for the classes
+in a package and its subpackages. Otherwise one of the classes would silently
+be dropped when the jars are combined.
+
+The jar of a module contains the classes of its static_libs, which are passed
+with --static-lib name=lib. A class is reported for the module that it was
+compiled in, along with the modules that include it, rather than for all of
+them.
+"""
+
+from __future__ import print_function
+
+import argparse
+import re
+import sys
+import zipfile
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--module', required=True,
+                      help='name of the module whose inputs are checked')
+  parser.add_argument('--jar', action='append', default=[],
+                      help='name=path of a jar and the module contributing it')
+  parser.add_argument('--static-lib', action='append', default=[],
+                      dest='static_libs',
+                      help='name=lib of a module and one of its static_libs')
+  parser.add_argument('--allow', action='append', default=[],
+                      help='pattern of classes that may be duplicated')
+  parser.add_argument('--stamp', required=True,
+                      help='file to write if there are no duplicate classes')
+  return parser.parse_args()
+
+
+def pattern_to_regex(pattern):
+  """Returns the regex for a class name pattern."""
+  regex = ''
+  for part in re.split(r'(\*\*|\*)', pattern):
+    if part == '**':
+      regex += '.*'
+    elif part == '*':
+      regex += r'[^.]*'
+    else:
+      regex += re.escape(part)
+  return re.compile(regex + '$')
+
+
+def class_name(entry):
+  """Returns the name of the class in a jar entry, or None if it isn't one."""
+  if not entry.endswith('.class') or entry.startswith('META-INF/'):
+    return None
+  if entry.endswith('module-info.class') or entry.endswith('package-info.class'):
+    return None
+  return entry[:-len('.class')].replace('/', '.')
+
+
+def transitive_static_libs(static_libs):
+  """Returns the modules mapped to all the modules they statically include.
+
+  static_libs maps the modules to the set of their direct static_libs.
+  """
+  closure = {}
+
+  def visit(module):
+    if module not in closure:
+      closure[module] = set()
+      libs = set()
+      for lib in static_libs.get(module, ()):
+        libs.add(lib)
+        libs |= visit(lib)
+      closure[module] = libs
+    return closure[module]
+
+  for module in list(static_libs):
+    visit(module)
+  return closure
+
+
+def find_duplicates(classes, allow, static_libs=None):
+  """Returns the classes contributed with different contents by more than one
+  module, mapped to the sorted names of the modules.
+
+  classes is a list of (module, class name, crc) tuples. static_libs maps the
+  modules to the set of their direct static_libs. A class that a module gets
+  from one of its static_libs is reported for the static lib, followed by the
+  modules that include it, e.g. "libc (via liba)".
+  """
+  allowed = [pattern_to_regex(p) for p in allow]
+  closure = transitive_static_libs(static_libs or {})
+  crcs_by_name = {}
+  for module, name, crc in classes:
+    crcs_by_name.setdefault(name, {}).setdefault(module, set()).add(crc)
+  duplicates = {}
+  for name, crcs in crcs_by_name.items():
+    def includes(module, lib):
+      return lib in closure.get(module, ()) and crcs[module] & crcs[lib]
+
+    contributors = [m for m in crcs
+                    if not any(includes(m, lib) for lib in crcs if lib != m)]
+    if len(contributors) < 2:
+      continue
+    if len(set().union(*[crcs[m] for m in contributors])) < 2:
+      continue
+    if any(regex.match(name) for regex in allowed):
+      continue
+    reported = []
+    for module in contributors:
+      via = sorted(m for m in crcs if includes(m, module))
+      if via:
+        module += ' (via %s)' % ', '.join(via)
+      reported.append(module)
+    duplicates[name] = sorted(reported)
+  return duplicates
+
+
+def read_static_libs(args):
+  """Returns the modules mapped to the set of their direct static_libs."""
+  static_libs = {}
+  for arg in args:
+    module, sep, lib = arg.partition('=')
+    if not sep:
+      raise ValueError('--static-lib %r is not of the form name=lib' % arg)
+    static_libs.setdefault(module, set()).add(lib)
+  return static_libs
+
+
+def read_classes(jars):
+  """Returns the (module, class name, crc) tuples of the classes in jars."""
+  classes = []
+  for arg in jars:
+    module, sep, path = arg.partition('=')
+    if not sep:
+      raise ValueError('--jar %r is not of the form name=path' % arg)
+    with zipfile.ZipFile(path) as jar:
+      for info in jar.infolist():
+        name = class_name(info.filename)
+        if name:
+          classes.append((module, name, info.CRC))
+  return classes
+
+
+def main():
+  args = parse_args()
+  duplicates = find_duplicates(read_classes(args.jar), args.allow,
+                               read_static_libs(args.static_libs))
+  if duplicates:
+    print('error: %s: classes contributed by more than one module:' %
+          args.module, file=sys.stderr)
+    for name in sorted(duplicates):
+      print('  %s: %s' % (name, ', '.join(duplicates[name])), file=sys.stderr)
+    print('Remove the classes from all but one of the modules, or add them to '
+          'allowed_duplicate_classes of %s if it doesn\'t matter which one is '
+          'used.' % args.module, file=sys.stderr)
+    sys.exit(1)
+
+  with open(args.stamp, 'w'):
+    pass
+
+
+if __name__ == '__main__':
+  main()
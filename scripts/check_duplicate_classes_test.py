@@ -0,0 +1,104 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for check_duplicate_classes.py."""
+
+import sys
+import unittest
+
+import check_duplicate_classes as check
+
+sys.dont_write_bytecode = True
+
+
+class ClassNameTest(unittest.TestCase):
+
+  def test_class_name(self):
+    self.assertEqual(check.class_name('com/example/Foo$Bar.class'),
+                     'com.example.Foo$Bar')
+    self.assertIsNone(check.class_name('com/example/foo.txt'))
+    self.assertIsNone(check.class_name('module-info.class'))
+    self.assertIsNone(check.class_name('com/example/package-info.class'))
+    self.assertIsNone(
+        check.class_name('META-INF/versions/11/com/example/Foo.class'))
+
+
+class FindDuplicatesTest(unittest.TestCase):
+
+  def test_duplicates(self):
+    classes = [
+        ('foo', 'com.example.A', 1),
+        ('libb', 'com.example.A', 2),
+        ('liba', 'com.example.A', 3),
+        ('foo', 'com.example.B', 1),
+    ]
+    self.assertEqual(check.find_duplicates(classes, []),
+                     {'com.example.A': ['foo', 'liba', 'libb']})
+
+  def test_identical_classes_are_not_duplicates(self):
+    classes = [('liba', 'com.example.A', 1), ('libb', 'com.example.A', 1)]
+    self.assertEqual(check.find_duplicates(classes, []), {})
+
+  def test_same_module(self):
+    classes = [('liba', 'com.example.A', 1), ('liba', 'com.example.A', 2)]
+    self.assertEqual(check.find_duplicates(classes, []), {})
+
+  def test_allow(self):
+    classes = [
+        ('liba', 'com.example.A', 1),
+        ('libb', 'com.example.A', 2),
+        ('liba', 'com.example.sub.B', 1),
+        ('libb', 'com.example.sub.B', 2),
+    ]
+    self.assertEqual(check.find_duplicates(classes, ['com.example.*']),
+                     {'com.example.sub.B': ['liba', 'libb']})
+    self.assertEqual(check.find_duplicates(classes, ['com.example.**']), {})
+    self.assertEqual(check.find_duplicates(classes, ['com.example.sub.B']),
+                     {'com.example.A': ['liba', 'libb']})
+
+  def test_static_libs(self):
+    # liba includes libc, whose class conflicts with the one of libb.
+    classes = [
+        ('liba', 'com.example.A', 1),
+        ('libc', 'com.example.A', 1),
+        ('libb', 'com.example.A', 2),
+    ]
+    self.assertEqual(
+        check.find_duplicates(classes, [], {'liba': {'libc'}}),
+        {'com.example.A': ['libb', 'libc (via liba)']})
+
+  def test_transitive_static_libs(self):
+    classes = [
+        ('liba', 'com.example.A', 1),
+        ('libc', 'com.example.A', 1),
+        ('libd', 'com.example.A', 1),
+        ('libb', 'com.example.A', 2),
+    ]
+    self.assertEqual(
+        check.find_duplicates(classes, [],
+                              {'liba': {'libc'}, 'libc': {'libd'}}),
+        {'com.example.A': ['libb', 'libd (via liba, libc)']})
+
+  def test_static_lib_with_different_class(self):
+    # liba compiles its own version of the class of its static lib libc.
+    classes = [('liba', 'com.example.A', 1), ('libc', 'com.example.A', 2)]
+    self.assertEqual(
+        check.find_duplicates(classes, [], {'liba': {'libc'}}),
+        {'com.example.A': ['liba', 'libc']})
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
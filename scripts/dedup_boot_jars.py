@@ -0,0 +1,133 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for deduplicating the resources of boot classpath jars.
+
+The jars are passed in boot classpath order with --jar name input output,
+after the jars that precede them on the boot classpath, which are passed with
+--earlier-jar input and are only read. A resource of a jar that is identical to
+the resource at the same path in an earlier jar is removed from it, as the boot
+class loader always finds the earlier one. The classes*.dex files and the files
+in META-INF/ are kept.
+
+The report lists, for each jar, the resources that were removed and the number
+of bytes saved.
+"""
+
+from __future__ import print_function
+
+import argparse
+import hashlib
+import re
+import sys
+import zipfile
+
+DEX_RE = re.compile(r'^classes\d*\.dex$')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--earlier-jar', action='append', default=[],
+                      dest='earlier_jars', metavar='INPUT',
+                      help='boot jar that precedes the deduplicated jars, in '
+                      'boot classpath order')
+  parser.add_argument('--jar', nargs=3, action='append', default=[],
+                      metavar=('NAME', 'INPUT', 'OUTPUT'),
+                      help='boot jar to deduplicate, in boot classpath order')
+  parser.add_argument('--report', required=True,
+                      help='path to write the report of the savings to')
+  return parser.parse_args()
+
+
+def is_resource(name):
+  """Returns whether a jar entry is a resource that can be deduplicated."""
+  if name.endswith('/') or name.startswith('META-INF/'):
+    return False
+  return not DEX_RE.match(name)
+
+
+class JarSavings(object):
+  """The savings of deduplicating a jar."""
+
+  def __init__(self, name):
+    self.name = name
+    self.removed = []
+    self.removed_bytes = 0
+
+
+def read_earlier_jar(path, seen_resources):
+  """Records the resources of a jar that is not deduplicated."""
+  with zipfile.ZipFile(path) as zin:
+    for info in zin.infolist():
+      if is_resource(info.filename):
+        digest = hashlib.sha256(zin.read(info)).hexdigest()
+        seen_resources.setdefault(info.filename, digest)
+
+
+def dedup_jars(jars, earlier_jars=()):
+  """Writes the deduplicated jars and returns their savings.
+
+  Args:
+    jars: list of (name, input, output) of the jars in boot classpath order.
+    earlier_jars: list of the jars that precede jars, in boot classpath order.
+  """
+  seen_resources = {}
+  for path in earlier_jars:
+    read_earlier_jar(path, seen_resources)
+  savings = []
+  for name, input_path, output_path in jars:
+    jar = JarSavings(name)
+    with zipfile.ZipFile(input_path) as zin, \
+        zipfile.ZipFile(output_path, 'w') as zout:
+      for info in zin.infolist():
+        data = zin.read(info)
+        if is_resource(info.filename):
+          digest = hashlib.sha256(data).hexdigest()
+          if seen_resources.get(info.filename) == digest:
+            jar.removed.append(info.filename)
+            jar.removed_bytes += info.file_size
+            continue
+          seen_resources.setdefault(info.filename, digest)
+        zout.writestr(info, data)
+    savings.append(jar)
+  return savings
+
+
+def format_report(savings):
+  """Returns the report of the savings of the jars."""
+  lines = []
+  for jar in savings:
+    lines.append('%s: removed %d duplicate resources (%d bytes)' %
+                 (jar.name, len(jar.removed), jar.removed_bytes))
+    for resource in jar.removed:
+      lines.append('  ' + resource)
+  return '\n'.join(lines) + '\n'
+
+
+def main():
+  args = parse_args()
+  try:
+    savings = dedup_jars(args.jar, args.earlier_jars)
+  except zipfile.BadZipfile as e:
+    print('dedup_boot_jars: %s' % e, file=sys.stderr)
+    sys.exit(1)
+  with open(args.report, 'w') as f:
+    f.write(format_report(savings))
+
+
+if __name__ == '__main__':
+  main()
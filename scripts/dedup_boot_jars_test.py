@@ -0,0 +1,107 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for dedup_boot_jars.py."""
+
+import os
+import shutil
+import sys
+import tempfile
+import unittest
+import zipfile
+
+import dedup_boot_jars as dedup
+
+sys.dont_write_bytecode = True
+
+
+class DedupJarsTest(unittest.TestCase):
+
+  def setUp(self):
+    self.tmp = tempfile.mkdtemp()
+
+  def tearDown(self):
+    shutil.rmtree(self.tmp)
+
+  def write_jar(self, name, entries):
+    path = os.path.join(self.tmp, name + '.jar')
+    with zipfile.ZipFile(path, 'w') as z:
+      for entry, data in entries:
+        z.writestr(entry, data)
+    return path
+
+  def test_is_resource(self):
+    self.assertTrue(dedup.is_resource('android/icu/data.dat'))
+    self.assertFalse(dedup.is_resource('classes2.dex'))
+    self.assertFalse(dedup.is_resource('META-INF/MANIFEST.MF'))
+    self.assertFalse(dedup.is_resource('android/'))
+
+  def test_dedup_jars(self):
+    foo = self.write_jar('foo', [
+        ('classes.dex', b'foo'),
+        ('res/same.txt', b'same'),
+        ('res/different.txt', b'foo'),
+    ])
+    bar = self.write_jar('bar', [
+        ('classes.dex', b'bar'),
+        ('META-INF/MANIFEST.MF', b'Manifest-Version: 1.0\n'),
+        ('res/same.txt', b'same'),
+        ('res/different.txt', b'bar'),
+    ])
+    foo_out = os.path.join(self.tmp, 'foo-out.jar')
+    bar_out = os.path.join(self.tmp, 'bar-out.jar')
+
+    savings = dedup.dedup_jars([('foo', foo, foo_out), ('bar', bar, bar_out)])
+
+    with zipfile.ZipFile(foo_out) as z:
+      self.assertEqual(z.namelist(),
+                       ['classes.dex', 'res/same.txt', 'res/different.txt'])
+    with zipfile.ZipFile(bar_out) as z:
+      self.assertEqual(z.namelist(), ['classes.dex', 'META-INF/MANIFEST.MF',
+                                      'res/different.txt'])
+
+    self.assertEqual(savings[0].removed, [])
+    self.assertEqual(savings[1].removed, ['res/same.txt'])
+    self.assertEqual(savings[1].removed_bytes, 4)
+
+    self.assertEqual(
+        dedup.format_report(savings),
+        'foo: removed 0 duplicate resources (0 bytes)\n'
+        'bar: removed 1 duplicate resources (4 bytes)\n'
+        '  res/same.txt\n')
+
+  def test_dedup_against_earlier_jars(self):
+    foo = self.write_jar('foo', [
+        ('classes.dex', b'foo'),
+        ('res/same.txt', b'same'),
+    ])
+    bar = self.write_jar('bar', [
+        ('classes.dex', b'bar'),
+        ('res/same.txt', b'same'),
+        ('res/other.txt', b'other'),
+    ])
+    bar_out = os.path.join(self.tmp, 'bar-out.jar')
+
+    savings = dedup.dedup_jars([('bar', bar, bar_out)], earlier_jars=[foo])
+
+    with zipfile.ZipFile(bar_out) as z:
+      self.assertEqual(z.namelist(), ['classes.dex', 'res/other.txt'])
+    self.assertEqual(len(savings), 1)
+    self.assertEqual(savings[0].removed, ['res/same.txt'])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,46 @@
+#!/bin/bash
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -e -o pipefail
+
+if [[ $# -ne 4 ]]; then
+  cat <<EOF2
+Usage:
+  dex-class-list.sh <dexdump> <dex-jar> <class-list> <method-counts>
+Writes the descriptors of the classes in the dex files of <dex-jar> to
+<class-list>, one per line, and the number of methods defined by each class
+to <method-counts>, as "<descriptor> <count>" lines. Both are sorted by
+descriptor.
+EOF2
+  exit 1
+fi
+
+dexdump=$1
+dex_jar=$2
+class_list=$3
+method_counts=$4
+
+# Only the entries in the method sections are counted, the entries in the field sections look the
+# same.
+"${dexdump}" "${dex_jar}" | awk '
+  /^  Class descriptor/ { cls = $4; gsub("\047", "", cls); methods[cls] = 0; in_methods = 0; next }
+  /^  (Direct|Virtual) methods/ { in_methods = 1; next }
+  /^  (Static|Instance) fields/ { in_methods = 0; next }
+  in_methods && /^    #[0-9]+ +: \(in / { methods[cls]++ }
+  END { for (cls in methods) print cls, methods[cls] }
+' | LC_ALL=C sort > "${method_counts}"
+
+cut -d' ' -f1 "${method_counts}" > "${class_list}"
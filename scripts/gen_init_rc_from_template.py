@@ -0,0 +1,157 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for generating init .rc files and VINTF manifest fragments from templates.
+
+Every ${name} in the template is replaced with the value passed for it with
+--var name=value, e.g. the template
+
+  service foo ${install_path}
+      user ${user}
+
+with --var install_path=/system/bin/foo --var user=system generates
+
+  service foo /system/bin/foo
+      user system
+
+A template that refers to a variable without a value is an error. The result
+is then checked to be a valid init .rc file or a well-formed VINTF manifest
+fragment, depending on --format.
+"""
+
+from __future__ import print_function
+
+import argparse
+import re
+import sys
+from xml.etree import ElementTree
+
+VAR_RE = re.compile(r'\$\{([A-Za-z_][A-Za-z0-9_]*)\}')
+
+# The keywords that start a section of an init .rc file, and whether the
+# section can contain indented commands or options.
+RC_SECTIONS = {
+    'import': False,
+    'on': True,
+    'service': True,
+    'subsystem': True,
+}
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--format', choices=['rc', 'vintf'], required=True,
+                      help='format of the template')
+  parser.add_argument('--var', action='append', default=[],
+                      help='name=value of a variable to substitute')
+  parser.add_argument('template', help='template to substitute')
+  parser.add_argument('output', help='path to write the result to')
+  return parser.parse_args()
+
+
+def parse_vars(var_args):
+  """Returns the map of variables from name=value strings."""
+  variables = {}
+  for arg in var_args:
+    name, sep, value = arg.partition('=')
+    if not sep:
+      raise ValueError('--var %r is not of the form name=value' % arg)
+    variables[name] = value
+  return variables
+
+
+def substitute(template, variables):
+  """Returns the template with each ${name} replaced with its value."""
+  undefined = set()
+
+  def replace(match):
+    name = match.group(1)
+    if name not in variables:
+      undefined.add(name)
+      return match.group(0)
+    return variables[name]
+
+  result = VAR_RE.sub(replace, template)
+  if undefined:
+    raise ValueError('undefined variables: %s' % ', '.join(sorted(undefined)))
+  return result
+
+
+def check_rc(content):
+  """Returns the syntax errors in an init .rc file."""
+  errors = []
+  in_section = False
+  for num, line in enumerate(content.splitlines(), 1):
+    stripped = line.strip()
+    if not stripped or stripped.startswith('#'):
+      continue
+    if line[0].isspace():
+      if not in_section:
+        errors.append('line %d: %r is not in an on, service or subsystem '
+                      'section' % (num, stripped))
+      continue
+    words = stripped.split()
+    keyword = words[0]
+    if keyword not in RC_SECTIONS:
+      errors.append('line %d: unknown section %r' % (num, keyword))
+      in_section = False
+      continue
+    in_section = RC_SECTIONS[keyword]
+    if keyword == 'service':
+      if len(words) < 3:
+        errors.append('line %d: service must have a name and a path' % num)
+      elif not words[2].startswith('/'):
+        errors.append('line %d: service path %r is not absolute' %
+                      (num, words[2]))
+    elif len(words) < 2:
+      errors.append('line %d: %s must have an argument' % (num, keyword))
+  return errors
+
+
+def check_vintf(content):
+  """Returns the syntax errors in a VINTF manifest fragment."""
+  try:
+    root = ElementTree.fromstring(content)
+  except ElementTree.ParseError as e:
+    return ['not well-formed XML: %s' % e]
+  if root.tag != 'manifest':
+    return ['root element is <%s> instead of <manifest>' % root.tag]
+  return []
+
+
+def main():
+  args = parse_args()
+  try:
+    variables = parse_vars(args.var)
+    with open(args.template) as f:
+      content = substitute(f.read(), variables)
+  except ValueError as e:
+    print('%s: %s' % (args.template, e), file=sys.stderr)
+    sys.exit(1)
+
+  errors = check_rc(content) if args.format == 'rc' else check_vintf(content)
+  if errors:
+    for error in errors:
+      print('%s: %s' % (args.template, error), file=sys.stderr)
+    sys.exit(1)
+
+  with open(args.output, 'w') as f:
+    f.write(content)
+
+
+if __name__ == '__main__':
+  main()
@@ -0,0 +1,96 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for gen_init_rc_from_template.py."""
+
+import sys
+import unittest
+
+import gen_init_rc_from_template as gen
+
+sys.dont_write_bytecode = True
+
+
+class SubstituteTest(unittest.TestCase):
+
+  def test_substitute(self):
+    self.assertEqual(
+        gen.substitute('service foo ${install_path}\n    user ${user}\n',
+                       {'install_path': '/system/bin/foo', 'user': 'system'}),
+        'service foo /system/bin/foo\n    user system\n')
+
+  def test_undefined_variable(self):
+    with self.assertRaisesRegex(ValueError, 'undefined variables: group, user'):
+      gen.substitute('    user ${user}\n    group ${group}\n', {})
+
+  def test_dollar_without_braces_is_kept(self):
+    self.assertEqual(gen.substitute('setprop a $b\n', {}), 'setprop a $b\n')
+
+  def test_parse_vars(self):
+    self.assertEqual(gen.parse_vars(['a=b', 'c=d=e', 'f=']),
+                     {'a': 'b', 'c': 'd=e', 'f': ''})
+    with self.assertRaises(ValueError):
+      gen.parse_vars(['a'])
+
+
+class CheckRcTest(unittest.TestCase):
+
+  def test_valid(self):
+    self.assertEqual(gen.check_rc(
+        '# comment\n'
+        'import /vendor/etc/init/foo.rc\n'
+        '\n'
+        'on boot\n'
+        '    start foo\n'
+        '\n'
+        'service foo /system/bin/foo --flag\n'
+        '    class main\n'
+        '    user system\n'), [])
+
+  def test_command_outside_section(self):
+    self.assertEqual(gen.check_rc('    start foo\n'),
+                     ["line 1: 'start foo' is not in an on, service or "
+                      "subsystem section"])
+    self.assertEqual(len(gen.check_rc('import /foo.rc\n    start foo\n')), 1)
+
+  def test_unknown_section(self):
+    self.assertEqual(gen.check_rc('servce foo /system/bin/foo\n'),
+                     ["line 1: unknown section 'servce'"])
+
+  def test_service_path(self):
+    self.assertEqual(gen.check_rc('service foo\n'),
+                     ['line 1: service must have a name and a path'])
+    self.assertEqual(gen.check_rc('service foo bin/foo\n'),
+                     ["line 1: service path 'bin/foo' is not absolute"])
+
+
+class CheckVintfTest(unittest.TestCase):
+
+  def test_valid(self):
+    self.assertEqual(gen.check_vintf(
+        '<manifest version="1.0" type="device"><hal format="aidl">'
+        '<name>android.hardware.foo</name></hal></manifest>'), [])
+
+  def test_malformed(self):
+    self.assertEqual(len(gen.check_vintf('<manifest><hal></manifest>')), 1)
+
+  def test_wrong_root(self):
+    self.assertEqual(gen.check_vintf('<hal/>'),
+                     ['root element is <hal> instead of <manifest>'])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
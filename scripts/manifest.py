@@ -21,6 +21,7 @@ from xml.dom import minidom
 
 
 android_ns = 'http://schemas.android.com/apk/res/android'
+tools_ns = 'http://schemas.android.com/tools'
 
 
 def get_children_with_tag(parent, tag_name):
@@ -65,6 +66,21 @@ def ensure_manifest_android_ns(doc):
                        ns.value)
 
 
+def ensure_manifest_tools_ns(doc):
+  """Make sure the manifest tag defines the tools namespace."""
+
+  manifest = parse_manifest(doc)
+
+  ns = manifest.getAttributeNodeNS(minidom.XMLNS_NAMESPACE, 'tools')
+  if ns is None:
+    attr = doc.createAttributeNS(minidom.XMLNS_NAMESPACE, 'xmlns:tools')
+    attr.value = tools_ns
+    manifest.setAttributeNode(attr)
+  elif ns.value != tools_ns:
+    raise RuntimeError('manifest tag has incorrect tools namespace ' +
+                       ns.value)
+
+
 def parse_test_config(doc):
   """ Get the configuration element. """
 
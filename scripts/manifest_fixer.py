@@ -26,10 +26,12 @@ from xml.dom import minidom
 from manifest import android_ns
 from manifest import compare_version_gt
 from manifest import ensure_manifest_android_ns
+from manifest import ensure_manifest_tools_ns
 from manifest import find_child_with_attribute
 from manifest import get_children_with_tag
 from manifest import get_indent
 from manifest import parse_manifest
+from manifest import tools_ns
 from manifest import write_xml
 
 
@@ -68,6 +70,12 @@ def parse_args():
   parser.add_argument('--test-only', dest='test_only', action='store_true',
                       help=('adds testOnly="true" attribute to application. Assign true value if application elem '
                             'already has a testOnly attribute.'))
+  parser.add_argument('--tools-replace', dest='tools_replace', action='append',
+                      help=('specify attributes of an element to add to its tools:replace '
+                            'attribute, in the form <element>=<attribute>[,<attribute>...]'))
+  parser.add_argument('--tools-node', dest='tools_node', action='append',
+                      help=('specify the tools:node merge rule of an element, in the form '
+                            '<element>=<rule>. The element is added if it is missing.'))
   parser.add_argument('input', help='input AndroidManifest.xml file')
   parser.add_argument('output', help='output AndroidManifest.xml file')
   return parser.parse_args()
@@ -342,6 +350,134 @@ def set_test_only_flag_to_true(doc):
   attr.value = 'true'
   application.setAttributeNode(attr)
 
+# Elements that are children of <application>. The other elements selected by
+# --tools-replace and --tools-node are children of <manifest>.
+application_children = ['activity', 'activity-alias', 'meta-data', 'profileable',
+                        'property', 'provider', 'receiver', 'service',
+                        'uses-library', 'uses-native-library']
+
+
+def append_child(doc, parent, tag, level):
+  """Append a new element to parent, indented at the given level."""
+
+  indent = get_indent(parent.firstChild, level)
+
+  last = parent.lastChild
+  if last is not None and last.nodeType != minidom.Node.TEXT_NODE:
+    last = None
+
+  element = doc.createElement(tag)
+  parent.insertBefore(doc.createTextNode(indent), last)
+  parent.insertBefore(element, last)
+
+  # align the closing tag with the opening tag if it's not
+  # indented
+  if parent.lastChild.nodeType != minidom.Node.TEXT_NODE:
+    indent = get_indent(parent.previousSibling, level - 1)
+    parent.appendChild(doc.createTextNode(indent))
+
+  return element
+
+
+def find_element(doc, selector, create):
+  """Find the element of the manifest matching the selector.
+
+  Args:
+    doc: The XML document. May be modified by this function.
+    selector: <tag> to select the only element with that tag, or
+      <tag>[<name>] to select the element with that tag and android:name.
+    create: True to add the element if it is missing.
+  Returns:
+    The element matching the selector.
+  Raises:
+    RuntimeError: Invalid manifest or no element matches the selector
+  """
+
+  manifest = parse_manifest(doc)
+
+  tag, name = selector, None
+  if selector.endswith(']') and '[' in selector:
+    tag, name = selector[:-1].split('[', 1)
+
+  if tag == 'manifest':
+    return manifest
+
+  parent, level = manifest, 1
+  if tag in application_children:
+    elems = get_children_with_tag(manifest, 'application')
+    if len(elems) > 1:
+      raise RuntimeError('found multiple <application> tags')
+    elif elems:
+      parent = elems[0]
+    elif create:
+      parent = append_child(doc, manifest, 'application', 1)
+    else:
+      raise RuntimeError('no element matches %s' % selector)
+    level = 2
+
+  if name is None:
+    elems = get_children_with_tag(parent, tag)
+    if len(elems) > 1:
+      raise RuntimeError('found multiple <%s> tags, select one with %s[<android:name>]' %
+                         (tag, tag))
+    element = elems[0] if elems else None
+  else:
+    element = find_child_with_attribute(parent, tag, android_ns, 'name', name)
+
+  if element is None:
+    if not create:
+      raise RuntimeError('no element matches %s' % selector)
+    element = append_child(doc, parent, tag, level)
+    if name is not None:
+      element.setAttributeNS(android_ns, 'android:name', name)
+
+  return element
+
+
+def add_tools_replace(doc, replace):
+  """Add attributes to the tools:replace attribute of an element.
+
+  Args:
+    doc: The XML document. May be modified by this function.
+    replace: <element>=<attribute>[,<attribute>...]
+  Raises:
+    RuntimeError: Invalid manifest or no element matches the selector
+  """
+
+  selector, _, attrs = replace.partition('=')
+  element = find_element(doc, selector, False)
+
+  values = []
+  attr = element.getAttributeNodeNS(tools_ns, 'replace')
+  if attr is not None:
+    values = [v.strip() for v in attr.value.split(',') if v.strip()]
+  for value in attrs.split(','):
+    if value not in values:
+      values.append(value)
+  element.setAttributeNS(tools_ns, 'tools:replace', ','.join(values))
+
+
+def set_tools_node(doc, node):
+  """Set the tools:node merge rule of an element, adding it if it is missing.
+
+  Args:
+    doc: The XML document. May be modified by this function.
+    node: <element>=<rule>
+  Raises:
+    RuntimeError: Invalid manifest or the element has a different merge rule
+  """
+
+  selector, _, rule = node.partition('=')
+  element = find_element(doc, selector, True)
+
+  attr = element.getAttributeNodeNS(tools_ns, 'node')
+  if attr is None:
+    element.setAttributeNS(tools_ns, 'tools:node', rule)
+  elif attr.value != rule:
+    raise RuntimeError('existing attribute tools:node="%s" of %s conflicts with --tools-node="%s"' %
+                       (attr.value, selector, rule))
+
+
 def main():
   """Program entry point."""
   try:
@@ -378,6 +514,15 @@ def main():
     if args.extract_native_libs is not None:
       add_extract_native_libs(doc, args.extract_native_libs)
 
+    if args.tools_replace or args.tools_node:
+      ensure_manifest_tools_ns(doc)
+
+    for replace in args.tools_replace or []:
+      add_tools_replace(doc, replace)
+
+    for node in args.tools_node or []:
+      set_tools_node(doc, node)
+
     with open(args.output, 'w') as f:
       write_xml(f, doc)
 
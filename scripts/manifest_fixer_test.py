@@ -571,5 +571,139 @@ class AddTestOnlyApplicationTest(unittest.TestCase):
     output = self.run_test(manifest_input)
     self.assert_xml_equal(output, manifest_input)
 
+
+class ToolsReplaceTest(unittest.TestCase):
+  """Unit tests for add_tools_replace function."""
+
+  def assert_xml_equal(self, output, expected):
+    self.assertEqual(ET.canonicalize(output), ET.canonicalize(expected))
+
+  def run_test(self, input_manifest, replace):
+    doc = minidom.parseString(input_manifest)
+    manifest_fixer.ensure_manifest_tools_ns(doc)
+    manifest_fixer.add_tools_replace(doc, replace)
+    output = io.StringIO()
+    manifest_fixer.write_xml(output, doc)
+    return output.getvalue()
+
+  manifest_tmpl = (
+      '<?xml version="1.0" encoding="utf-8"?>\n'
+      '<manifest xmlns:android="http://schemas.android.com/apk/res/android" '
+      'xmlns:tools="http://schemas.android.com/tools">\n'
+      '%s'
+      '</manifest>\n')
+
+  def test_application(self):
+    manifest_input = self.manifest_tmpl % '    <application android:label="Foo"/>\n'
+    expected = self.manifest_tmpl % (
+        '    <application android:label="Foo" tools:replace="android:label,android:icon"/>\n')
+    output = self.run_test(manifest_input, 'application=android:label,android:icon')
+    self.assert_xml_equal(output, expected)
+
+  def test_existing_replace(self):
+    manifest_input = self.manifest_tmpl % (
+        '    <application android:label="Foo" tools:replace="android:label"/>\n')
+    expected = self.manifest_tmpl % (
+        '    <application android:label="Foo" tools:replace="android:label,android:icon"/>\n')
+    output = self.run_test(manifest_input, 'application=android:icon,android:label')
+    self.assert_xml_equal(output, expected)
+
+  def test_named_element(self):
+    manifest_input = self.manifest_tmpl % (
+        '    <application>\n'
+        '        <activity android:name="a.A"/>\n'
+        '        <activity android:name="a.B" android:exported="true"/>\n'
+        '    </application>\n')
+    expected = self.manifest_tmpl % (
+        '    <application>\n'
+        '        <activity android:name="a.A"/>\n'
+        '        <activity android:name="a.B" android:exported="true" tools:replace="android:exported"/>\n'
+        '    </application>\n')
+    output = self.run_test(manifest_input, 'activity[a.B]=android:exported')
+    self.assert_xml_equal(output, expected)
+
+  def test_missing_element(self):
+    manifest_input = self.manifest_tmpl % '    <application/>\n'
+    with self.assertRaises(RuntimeError):
+      self.run_test(manifest_input, 'activity[a.A]=android:exported')
+
+  def test_multiple_elements(self):
+    manifest_input = self.manifest_tmpl % (
+        '    <uses-permission android:name="a"/>\n'
+        '    <uses-permission android:name="b"/>\n')
+    with self.assertRaises(RuntimeError):
+      self.run_test(manifest_input, 'uses-permission=android:maxSdkVersion')
+
+
+class ToolsNodeTest(unittest.TestCase):
+  """Unit tests for set_tools_node function."""
+
+  def assert_xml_equal(self, output, expected):
+    self.assertEqual(ET.canonicalize(output), ET.canonicalize(expected))
+
+  def run_test(self, input_manifest, node):
+    doc = minidom.parseString(input_manifest)
+    manifest_fixer.ensure_manifest_tools_ns(doc)
+    manifest_fixer.set_tools_node(doc, node)
+    output = io.StringIO()
+    manifest_fixer.write_xml(output, doc)
+    return output.getvalue()
+
+  manifest_tmpl = (
+      '<?xml version="1.0" encoding="utf-8"?>\n'
+      '<manifest xmlns:android="http://schemas.android.com/apk/res/android" '
+      'xmlns:tools="http://schemas.android.com/tools">\n'
+      '%s'
+      '</manifest>\n')
+
+  def test_existing_element(self):
+    manifest_input = self.manifest_tmpl % '    <uses-permission android:name="a"/>\n'
+    expected = self.manifest_tmpl % (
+        '    <uses-permission android:name="a" tools:node="replace"/>\n')
+    output = self.run_test(manifest_input, 'uses-permission[a]=replace')
+    self.assert_xml_equal(output, expected)
+
+  def test_missing_manifest_child(self):
+    manifest_input = self.manifest_tmpl % '    <application/>\n'
+    expected = self.manifest_tmpl % (
+        '    <application/>\n'
+        '    <uses-permission android:name="a" tools:node="remove"/>\n')
+    output = self.run_test(manifest_input, 'uses-permission[a]=remove')
+    self.assert_xml_equal(output, expected)
+
+  def test_missing_application_child(self):
+    manifest_input = self.manifest_tmpl % '    <application/>\n'
+    expected = self.manifest_tmpl % (
+        '    <application>\n'
+        '        <activity android:name="lib.A" tools:node="remove"/>\n'
+        '    </application>\n')
+    output = self.run_test(manifest_input, 'activity[lib.A]=remove')
+    self.assert_xml_equal(output, expected)
+
+  def test_missing_application(self):
+    manifest_input = self.manifest_tmpl % ''
+    expected = self.manifest_tmpl % (
+        '    <application>\n'
+        '        <service android:name="lib.S" tools:node="remove"/>\n'
+        '    </application>\n')
+    output = self.run_test(manifest_input, 'service[lib.S]=remove')
+    self.assert_xml_equal(output, expected)
+
+  def test_conflict(self):
+    manifest_input = self.manifest_tmpl % (
+        '    <uses-permission android:name="a" tools:node="merge"/>\n')
+    with self.assertRaises(RuntimeError):
+      self.run_test(manifest_input, 'uses-permission[a]=remove')
+
+  def test_adds_tools_namespace(self):
+    manifest_input = (
+        '<?xml version="1.0" encoding="utf-8"?>\n'
+        '<manifest xmlns:android="http://schemas.android.com/apk/res/android">\n'
+        '    <application/>\n'
+        '</manifest>\n')
+    expected = self.manifest_tmpl % '    <application tools:node="merge"/>\n'
+    output = self.run_test(manifest_input, 'application=merge')
+    self.assert_xml_equal(output, expected)
+
 if __name__ == '__main__':
   unittest.main(verbosity=2)
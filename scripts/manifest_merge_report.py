@@ -0,0 +1,171 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for reporting the origin of the elements of a merged manifest.
+
+The report has one tab separated line per element and attribute of the merged
+manifest, in document order:
+
+  <element path>\t<origin>
+  <element path>@<attribute>=<value>\t<origin>
+
+The path of an element is the list of the tags of its ancestors and itself,
+separated by '/', where the tags of the elements with an android:name attribute
+are followed by the name in brackets, e.g.
+manifest/application/activity[com.example.Main]. The origin is the first of the
+input manifests, in merge priority order, that declares the element or the
+attribute with the same value, or 'merger' if none of them does, e.g. for
+attributes with substituted placeholders.
+
+The elements of the input manifests that are not in the merged manifest, e.g.
+because of a tools:node="remove" rule, are listed at the end of the report:
+
+  <element path>\tremoved, declared in <origin>
+"""
+
+from __future__ import print_function
+
+import argparse
+import sys
+from xml.dom import minidom
+
+
+from manifest import android_ns
+from manifest import parse_manifest
+from manifest import tools_ns
+
+
+def parse_args():
+  """Parse commandline arguments."""
+
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--main', dest='main', required=True,
+                      help='main AndroidManifest.xml file of the merge')
+  parser.add_argument('--libs', dest='libs', action='append', default=[],
+                      help='AndroidManifest.xml file merged into the main one')
+  parser.add_argument('--merged', dest='merged', required=True,
+                      help='merged AndroidManifest.xml file')
+  parser.add_argument('--out', dest='out', required=True,
+                      help='output report file')
+  return parser.parse_args()
+
+
+def element_key(element):
+  """Returns the tag of the element, followed by its android:name in brackets."""
+
+  name = element.getAttributeNS(android_ns, 'name')
+  if name:
+    return '%s[%s]' % (element.tagName, name)
+  return element.tagName
+
+
+def collect_elements(element, parent_path, elements):
+  """Appends the (path, element) pairs of element and its descendants."""
+
+  path = parent_path + '/' + element_key(element) if parent_path else element_key(element)
+  elements.append((path, element))
+  for child in element.childNodes:
+    if child.nodeType == minidom.Node.ELEMENT_NODE:
+      collect_elements(child, path, elements)
+
+
+def get_elements(doc):
+  """Returns the (path, element) pairs of the manifest, in document order."""
+
+  elements = []
+  collect_elements(parse_manifest(doc), '', elements)
+  return elements
+
+
+def get_attributes(element):
+  """Returns the sorted (name, value) pairs of the attributes of the element.
+
+  The namespace declarations and the tools attributes, which are removed by
+  the merger, are skipped.
+  """
+
+  attributes = []
+  for i in range(element.attributes.length):
+    attr = element.attributes.item(i)
+    if attr.namespaceURI in (minidom.XMLNS_NAMESPACE, tools_ns):
+      continue
+    attributes.append((attr.name, attr.value))
+  return sorted(attributes)
+
+
+def merge_report(inputs, merged):
+  """Returns the lines of the merge report.
+
+  Args:
+    inputs: The (name, document) pairs of the input manifests, in merge
+      priority order.
+    merged: The merged document.
+  Returns:
+    The lines of the report.
+  """
+
+  input_elements = []
+  for name, doc in inputs:
+    by_path = {}
+    for path, element in get_elements(doc):
+      by_path.setdefault(path, element)
+    input_elements.append((name, by_path))
+
+  def origin(path, attr=None):
+    for name, by_path in input_elements:
+      element = by_path.get(path)
+      if element is None:
+        continue
+      if attr is None or (element.hasAttribute(attr[0]) and
+                          element.getAttribute(attr[0]) == attr[1]):
+        return name
+    return 'merger'
+
+  lines = []
+  merged_paths = set()
+  for path, element in get_elements(merged):
+    merged_paths.add(path)
+    lines.append('%s\t%s' % (path, origin(path)))
+    for attr in get_attributes(element):
+      lines.append('%s@%s=%s\t%s' % (path, attr[0], attr[1], origin(path, attr)))
+
+  for name, doc in inputs:
+    for path, _ in get_elements(doc):
+      if path not in merged_paths:
+        lines.append('%s\tremoved, declared in %s' % (path, name))
+
+  return lines
+
+
+def main():
+  """Program entry point."""
+  try:
+    args = parse_args()
+
+    inputs = [(path, minidom.parse(path)) for path in [args.main] + args.libs]
+    merged = minidom.parse(args.merged)
+
+    with open(args.out, 'w') as f:
+      for line in merge_report(inputs, merged):
+        f.write(line + '\n')
+
+  # pylint: disable=broad-except
+  except Exception as err:
+    print('error: ' + str(err), file=sys.stderr)
+    sys.exit(-1)
+
+if __name__ == '__main__':
+  main()
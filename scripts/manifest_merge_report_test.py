@@ -0,0 +1,108 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for manifest_merge_report.py."""
+
+import sys
+import unittest
+from xml.dom import minidom
+
+import manifest_merge_report
+
+sys.dont_write_bytecode = True
+
+
+class MergeReportTest(unittest.TestCase):
+  """Unit tests for merge_report function."""
+
+  manifest_tmpl = (
+      '<?xml version="1.0" encoding="utf-8"?>\n'
+      '<manifest xmlns:android="http://schemas.android.com/apk/res/android" '
+      'xmlns:tools="http://schemas.android.com/tools" package="com.example">\n'
+      '%s'
+      '</manifest>\n')
+
+  def run_test(self, main, libs, merged):
+    inputs = [('main.xml', minidom.parseString(self.manifest_tmpl % main))]
+    for i, lib in enumerate(libs):
+      inputs.append(('lib%d.xml' % i, minidom.parseString(self.manifest_tmpl % lib)))
+    return manifest_merge_report.merge_report(
+        inputs, minidom.parseString(self.manifest_tmpl % merged))
+
+  def test_origins(self):
+    main = (
+        '    <application android:label="Main" tools:replace="android:label">\n'
+        '        <activity android:name="com.example.Main"/>\n'
+        '    </application>\n')
+    lib = (
+        '    <uses-permission android:name="android.permission.INTERNET"/>\n'
+        '    <application android:label="Lib" android:icon="@drawable/icon">\n'
+        '        <service android:name="com.lib.Service"/>\n'
+        '    </application>\n')
+    merged = (
+        '    <uses-permission android:name="android.permission.INTERNET"/>\n'
+        '    <application android:label="Main" android:icon="@drawable/icon">\n'
+        '        <activity android:name="com.example.Main"/>\n'
+        '        <service android:name="com.lib.Service"/>\n'
+        '    </application>\n')
+    self.assertEqual(self.run_test(main, [lib], merged), [
+        'manifest\tmain.xml',
+        'manifest@package=com.example\tmain.xml',
+        'manifest/uses-permission[android.permission.INTERNET]\tlib0.xml',
+        'manifest/uses-permission[android.permission.INTERNET]'
+        '@android:name=android.permission.INTERNET\tlib0.xml',
+        'manifest/application\tmain.xml',
+        'manifest/application@android:icon=@drawable/icon\tlib0.xml',
+        'manifest/application@android:label=Main\tmain.xml',
+        'manifest/application/activity[com.example.Main]\tmain.xml',
+        'manifest/application/activity[com.example.Main]'
+        '@android:name=com.example.Main\tmain.xml',
+        'manifest/application/service[com.lib.Service]\tlib0.xml',
+        'manifest/application/service[com.lib.Service]'
+        '@android:name=com.lib.Service\tlib0.xml',
+    ])
+
+  def test_placeholders(self):
+    main = '    <application android:label="${appLabel}"/>\n'
+    merged = '    <application android:label="Example"/>\n'
+    self.assertEqual(self.run_test(main, [], merged), [
+        'manifest\tmain.xml',
+        'manifest@package=com.example\tmain.xml',
+        'manifest/application\tmain.xml',
+        'manifest/application@android:label=Example\tmerger',
+    ])
+
+  def test_removed(self):
+    main = (
+        '    <application>\n'
+        '        <service android:name="com.lib.Service" tools:node="remove"/>\n'
+        '    </application>\n')
+    lib = (
+        '    <application>\n'
+        '        <service android:name="com.lib.Service"/>\n'
+        '    </application>\n')
+    merged = '    <application/>\n'
+    self.assertEqual(self.run_test(main, [lib], merged), [
+        'manifest\tmain.xml',
+        'manifest@package=com.example\tmain.xml',
+        'manifest/application\tmain.xml',
+        'manifest/application/service[com.lib.Service]\tremoved, declared in main.xml',
+        'manifest/application/service[com.lib.Service]\tremoved, declared in lib0.xml',
+    ])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,57 @@
+#!/bin/bash
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -e
+
+usage() {
+  cat <<EOF2
+Usage:
+  run-cached-host-test.sh [--no-cache] <cache-dir> <inputs-rsp> <result> <test-command>
+Runs <test-command> unless a previous run of the same command with inputs of the
+same content passed, which is recorded in <cache-dir> under a digest of the
+command and of the files listed in <inputs-rsp>. Writes the digest to <result>
+if the test passed or was skipped. With --no-cache the test is always run.
+EOF2
+  exit 1
+}
+
+use_cache=true
+if [[ "$1" == "--no-cache" ]]; then
+  use_cache=false
+  shift
+fi
+
+if [[ $# -ne 4 ]]; then
+  usage
+fi
+
+cache_dir="$1"
+inputs_rsp="$2"
+result="$3"
+test_command="$4"
+
+digest=$( (echo "${test_command}"; xargs -r sha256sum < "${inputs_rsp}") | sha256sum | cut -d' ' -f1)
+cached_result="${cache_dir}/${digest}"
+
+if ${use_cache} && [[ -f "${cached_result}" ]]; then
+  echo "Skipping ${test_command}: passed with the same inputs on $(date -r "${cached_result}")"
+else
+  bash -c "${test_command}"
+  mkdir -p "${cache_dir}"
+  touch "${cached_result}"
+fi
+
+echo "${digest}" > "${result}"
@@ -0,0 +1,106 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for storing the files of a vendor or recovery snapshot by content.
+
+Every input file is written to the blobs zip as blobs/<digest>, where digest is
+the sha256 digest of its contents, and a manifest is written that maps the path
+of each file, relative to the root directory, to its digest, e.g.:
+
+  {
+    "files": {
+      "arch-arm64-armv8-a/shared/libfoo.so": "9f86d081884c7d65...",
+      "arch-arm64-armv8-a/static/libfoo.a": "60303ae22b998861..."
+    }
+  }
+
+Identical files, whether within a snapshot or across several snapshot versions
+sharing the same blob directory, are then stored only once.
+"""
+
+from __future__ import print_function
+
+import argparse
+import hashlib
+import json
+import os
+import sys
+import zipfile
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--root', required=True,
+                      help='directory the manifest paths are relative to')
+  parser.add_argument('--blobs-zip', required=True,
+                      help='path to write the zip of the blobs to')
+  parser.add_argument('--manifest', required=True,
+                      help='path to write the manifest to')
+  parser.add_argument('files', nargs='*', help='files to store')
+  return parser.parse_args()
+
+
+def digest(path):
+  """Returns the sha256 digest of the contents of the file at path."""
+  h = hashlib.sha256()
+  with open(path, 'rb') as f:
+    for chunk in iter(lambda: f.read(65536), b''):
+      h.update(chunk)
+  return h.hexdigest()
+
+
+def store_blobs(root, blobs_zip, files):
+  """Stores files in the ZipFile blobs_zip and returns the manifest entries for them."""
+  entries = {}
+  stored = set()
+  for path in sorted(files):
+    rel = os.path.relpath(path, root)
+    if rel.startswith(os.pardir + os.sep):
+      raise ValueError('%s is not under %s' % (path, root))
+    d = digest(path)
+    if d not in stored:
+      # Use a fixed timestamp so that the zip only depends on the contents of
+      # the files.
+      info = zipfile.ZipInfo('blobs/' + d, date_time=(2008, 1, 1, 0, 0, 0))
+      info.compress_type = zipfile.ZIP_DEFLATED
+      info.external_attr = 0o644 << 16
+      with open(path, 'rb') as f:
+        blobs_zip.writestr(info, f.read())
+      stored.add(d)
+    entries[rel] = d
+  return entries
+
+
+def main():
+  """Program entry point."""
+  try:
+    args = parse_args()
+
+    with zipfile.ZipFile(args.blobs_zip, 'w') as blobs_zip:
+      entries = store_blobs(args.root, blobs_zip, args.files)
+
+    with open(args.manifest, 'w') as f:
+      json.dump({'files': entries}, f, indent=2, sort_keys=True)
+      f.write('\n')
+
+  # pylint: disable=broad-except
+  except Exception as err:
+    print('error: ' + str(err), file=sys.stderr)
+    sys.exit(-1)
+
+if __name__ == '__main__':
+  main()
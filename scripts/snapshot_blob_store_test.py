@@ -0,0 +1,77 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for snapshot_blob_store.py."""
+
+import os
+import shutil
+import sys
+import tempfile
+import unittest
+import zipfile
+
+import snapshot_blob_store
+
+sys.dont_write_bytecode = True
+
+
+class SnapshotBlobStoreTest(unittest.TestCase):
+
+  def setUp(self):
+    self.tmp = tempfile.mkdtemp()
+    self.root = os.path.join(self.tmp, 'arm64')
+    self.blobs = os.path.join(self.tmp, 'blobs.zip')
+
+  def tearDown(self):
+    shutil.rmtree(self.tmp)
+
+  def write(self, rel, content):
+    path = os.path.join(self.root, rel)
+    if not os.path.isdir(os.path.dirname(path)):
+      os.makedirs(os.path.dirname(path))
+    with open(path, 'w') as f:
+      f.write(content)
+    return path
+
+  def test_identical_files_share_a_blob(self):
+    a = self.write('arch-arm64-armv8-a/shared/liba.so', 'same')
+    b = self.write('arch-arm-armv7-a-neon/shared/liba.so', 'same')
+    c = self.write('arch-arm64-armv8-a/static/libc.a', 'other')
+
+    with zipfile.ZipFile(self.blobs, 'w') as blobs_zip:
+      entries = snapshot_blob_store.store_blobs(self.root, blobs_zip, [a, b, c])
+
+    self.assertEqual(entries['arch-arm64-armv8-a/shared/liba.so'],
+                     entries['arch-arm-armv7-a-neon/shared/liba.so'])
+    self.assertNotEqual(entries['arch-arm64-armv8-a/shared/liba.so'],
+                        entries['arch-arm64-armv8-a/static/libc.a'])
+    with zipfile.ZipFile(self.blobs) as blobs_zip:
+      self.assertEqual(sorted(blobs_zip.namelist()),
+                       sorted('blobs/' + d for d in set(entries.values())))
+      blob = blobs_zip.read('blobs/' + entries['arch-arm64-armv8-a/static/libc.a'])
+      self.assertEqual(blob, b'other')
+
+  def test_file_outside_root(self):
+    outside = os.path.join(self.tmp, 'outside.so')
+    with open(outside, 'w') as f:
+      f.write('x')
+    with zipfile.ZipFile(self.blobs, 'w') as blobs_zip:
+      with self.assertRaises(ValueError):
+        snapshot_blob_store.store_blobs(self.root, blobs_zip, [outside])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
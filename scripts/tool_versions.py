@@ -0,0 +1,83 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""A tool for resolving the versions of the tools used by the build.
+
+The input is the JSON list of tools written by the tool_versions singleton,
+each with a name, the version known when the build was generated, the path to
+the tool and the arguments that make it print its version. Every tool is run
+with its version arguments, and the first non-empty line that it prints, on
+stdout or stderr, is added to it as version_output. A tool that cannot be run
+or fails gets an error instead, so that a single broken tool does not fail the
+build.
+"""
+
+import argparse
+import json
+import subprocess
+import sys
+
+
+def parse_args():
+  """Parses the command line arguments."""
+  parser = argparse.ArgumentParser(description=__doc__)
+  parser.add_argument('tools', help='JSON list of the tools')
+  parser.add_argument('output', help='output JSON file')
+  return parser.parse_args()
+
+
+def first_line(output):
+  """Returns the first non-empty line of the output of a tool."""
+  for line in output.splitlines():
+    line = line.strip()
+    if line:
+      return line
+  return ''
+
+
+def resolve_version(tool):
+  """Returns the tool with the version that it prints."""
+  resolved = dict(tool)
+  if not tool.get('tool'):
+    return resolved
+  cmd = [tool['tool']] + tool.get('version_args', [])
+  try:
+    proc = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.STDOUT,
+                          check=False)
+  except OSError as e:
+    resolved['error'] = str(e)
+    return resolved
+  output = proc.stdout.decode('utf-8', errors='replace')
+  if proc.returncode != 0:
+    resolved['error'] = 'exited with %d: %s' % (proc.returncode,
+                                                first_line(output))
+  else:
+    resolved['version_output'] = first_line(output)
+  return resolved
+
+
+def main():
+  args = parse_args()
+  with open(args.tools) as f:
+    tools = json.load(f)
+  resolved = [resolve_version(tool) for tool in tools]
+  with open(args.output, 'w') as f:
+    json.dump(resolved, f, indent=2, sort_keys=True)
+    f.write('\n')
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,82 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2022 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Unit tests for tool_versions.py."""
+
+import os
+import shutil
+import stat
+import sys
+import tempfile
+import unittest
+
+import tool_versions
+
+sys.dont_write_bytecode = True
+
+
+class ToolVersionsTest(unittest.TestCase):
+
+  def setUp(self):
+    self.tmp = tempfile.mkdtemp()
+
+  def tearDown(self):
+    shutil.rmtree(self.tmp)
+
+  def write_tool(self, name, script):
+    path = os.path.join(self.tmp, name)
+    with open(path, 'w') as f:
+      f.write('#!/bin/sh\n' + script)
+    os.chmod(path, os.stat(path).st_mode | stat.S_IEXEC)
+    return path
+
+  def test_first_line(self):
+    self.assertEqual(tool_versions.first_line('\n  \nfoo 1.0\nbar\n'),
+                     'foo 1.0')
+    self.assertEqual(tool_versions.first_line(''), '')
+
+  def test_version_output(self):
+    tool = self.write_tool('foo', 'echo "foo version $1" >&2\n')
+    resolved = tool_versions.resolve_version({
+        'name': 'foo',
+        'version': '1.0',
+        'tool': tool,
+        'version_args': ['1.0.1'],
+    })
+    self.assertEqual(resolved['version'], '1.0')
+    self.assertEqual(resolved['version_output'], 'foo version 1.0.1')
+    self.assertNotIn('error', resolved)
+
+  def test_failing_tool(self):
+    tool = self.write_tool('foo', 'echo broken\nexit 2\n')
+    resolved = tool_versions.resolve_version({'name': 'foo', 'tool': tool})
+    self.assertEqual(resolved['error'], 'exited with 2: broken')
+    self.assertNotIn('version_output', resolved)
+
+  def test_missing_tool(self):
+    resolved = tool_versions.resolve_version({
+        'name': 'foo',
+        'tool': os.path.join(self.tmp, 'missing'),
+    })
+    self.assertIn('error', resolved)
+
+  def test_no_tool(self):
+    self.assertEqual(tool_versions.resolve_version({'name': 'foo'}),
+                     {'name': 'foo'})
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,275 @@
+// Copyright (C) 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"android/soong/android"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/proptools"
+)
+
+func init() {
+	registerPartialBuildImportBuildComponents(android.InitRegistrationContext)
+}
+
+func registerPartialBuildImportBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("partial_build_import", PartialBuildImportFactory)
+}
+
+// partialBuildMetadata is the contents of the partial_build.json file of a snapshot exported as a
+// partial build, see SOONG_SDK_SNAPSHOT_PARTIAL_BUILD.
+type partialBuildMetadata struct {
+	// The name of the sdk or module_exports that the snapshot was built from.
+	Name string `json:"name"`
+
+	// The members of the snapshot, in the order in which they were added to it.
+	Members []*partialBuildMember `json:"members"`
+}
+
+// partialBuildMember is the description of a member in the partial_build.json file of a snapshot.
+type partialBuildMember struct {
+	// The name of the member.
+	Name string `json:"name"`
+
+	// The type of the prebuilt module that reconstitutes the member.
+	Module_type string `json:"module_type"`
+
+	// The definition of the prebuilt module that reconstitutes the member, in Android.bp syntax.
+	Module string `json:"module"`
+
+	// The variants that the member was built for, sorted by OS and then arch.
+	Variants []partialBuildVariant `json:"variants"`
+
+	// The paths of the files in the snapshot that belong to the member, relative to the root of the
+	// snapshot and sorted. A path ending in "/" is a directory unpacked from a zip file.
+	Files []string `json:"files"`
+
+	// The unversioned prebuilt module generated for the member, only used while the snapshot is
+	// built.
+	prebuiltModule *bpModule
+}
+
+// partialBuildVariant is a variant that a member of a partial build was built for.
+type partialBuildVariant struct {
+	// The name of the OS of the variant, e.g. android or linux_glibc.
+	Os string `json:"os"`
+
+	// The name of the arch type of the variant, e.g. arm64 or common.
+	Arch string `json:"arch"`
+
+	// The arch variation of the variant, e.g. arm64_armv8-a or common.
+	Arch_variation string `json:"arch_variation"`
+}
+
+func inPartialBuildVariants(v partialBuildVariant, variants []partialBuildVariant) bool {
+	for _, variant := range variants {
+		if variant == v {
+			return true
+		}
+	}
+	return false
+}
+
+type partialBuildImportProperties struct {
+	// Path to the partial_build.json file of the partial build, relative to the directory of the
+	// module. Defaults to partial_build.json.
+	Metadata *string
+}
+
+// partial_build_import is the import side of a snapshot exported as a partial build, see
+// SOONG_SDK_SNAPSHOT_PARTIAL_BUILD. The snapshot generates one in its Android.bp file. It creates
+// the prebuilt modules that reconstitute the members described by the partial_build.json file, in
+// its own directory, and checks that the partial build contains all the files of each member and
+// that the member was built for every variant that the current product builds it for.
+type partialBuildImport struct {
+	android.ModuleBase
+
+	properties partialBuildImportProperties
+
+	// The contents of the partial_build.json file, read by the load hook.
+	metadata partialBuildMetadata
+}
+
+type partialBuildImportDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+var partialBuildImportMemberTag = partialBuildImportDependencyTag{}
+
+// Mark this tag so dependencies that use it are excluded from visibility enforcement.
+func (t partialBuildImportDependencyTag) ExcludeFromVisibilityEnforcement() {}
+
+var _ android.ExcludeFromVisibilityEnforcementTag = partialBuildImportMemberTag
+
+func PartialBuildImportFactory() android.Module {
+	module := &partialBuildImport{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidModule(module)
+	android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+		if module.readMetadata(ctx) {
+			module.createMembers(ctx)
+		}
+	})
+	return module
+}
+
+func (p *partialBuildImport) metadataPath(ctx android.EarlyModuleContext) string {
+	return filepath.Join(ctx.ModuleDir(), proptools.StringDefault(p.properties.Metadata, PARTIAL_BUILD_METADATA_FILE))
+}
+
+// readMetadata reads the partial_build.json file, which has to be done before the members are
+// created, and returns whether it succeeded.
+func (p *partialBuildImport) readMetadata(ctx android.LoadHookContext) bool {
+	metadataPath := p.metadataPath(ctx)
+	ctx.AddNinjaFileDeps(metadataPath)
+	r, err := ctx.Config().Fs().Open(metadataPath)
+	if err != nil {
+		ctx.PropertyErrorf("metadata", "failed to open %q: %s", metadataPath, err)
+		return false
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&p.metadata); err != nil {
+		ctx.PropertyErrorf("metadata", "failed to parse %q: %s", metadataPath, err)
+		return false
+	}
+	return true
+}
+
+// createMembers creates the prebuilt module of each member from its definition in the metadata.
+func (p *partialBuildImport) createMembers(ctx android.LoadHookContext) {
+	factories := android.ModuleTypeFactories()
+	for _, member := range p.metadata.Members {
+		factory := factories[member.Module_type]
+		if factory == nil {
+			ctx.PropertyErrorf("metadata", "member %q has unknown module type %q", member.Name, member.Module_type)
+			continue
+		}
+
+		file, errs := parser.ParseAndEval(p.metadataPath(ctx), strings.NewReader(member.Module), parser.NewScope(nil))
+		if len(errs) > 0 {
+			ctx.PropertyErrorf("metadata", "failed to parse the module of member %q: %s", member.Name, errs[0])
+			continue
+		}
+		var def *parser.Module
+		if len(file.Defs) == 1 {
+			def, _ = file.Defs[0].(*parser.Module)
+		}
+		if def == nil || def.Type != member.Module_type {
+			ctx.PropertyErrorf("metadata", "the module of member %q must be a single %s module",
+				member.Name, member.Module_type)
+			continue
+		}
+
+		// Unpack the properties into the property structs of a module of the same type, which are
+		// then appended to those of the created module.
+		props := factory().GetProperties()
+		if _, errs := proptools.UnpackProperties(def.Properties, props...); len(errs) > 0 {
+			ctx.PropertyErrorf("metadata", "invalid module of member %q: %s", member.Name, errs[0])
+			continue
+		}
+		ctx.CreateModule(factory, props...)
+	}
+}
+
+// productVariations returns the variations of the variants of the member that the current product
+// builds.
+func productVariations(config android.Config, member *partialBuildMember) [][]blueprint.Variation {
+	var variations [][]blueprint.Variation
+	for _, variant := range member.Variants {
+		for _, osType := range android.OsTypeList() {
+			if osType.Name != variant.Os {
+				continue
+			}
+			for _, target := range config.Targets[osType] {
+				if target.NativeBridge == android.NativeBridgeEnabled {
+					continue
+				}
+				if variant.Arch_variation == android.Common.Name || target.ArchVariation() == variant.Arch_variation {
+					variations = append(variations, []blueprint.Variation{
+						{Mutator: "os", Variation: variant.Os},
+						{Mutator: "arch", Variation: variant.Arch_variation},
+					})
+					break
+				}
+			}
+		}
+	}
+	return variations
+}
+
+func (p *partialBuildImport) DepsMutator(ctx android.BottomUpMutatorContext) {
+	for _, member := range p.metadata.Members {
+		for _, variations := range productVariations(ctx.Config(), member) {
+			ctx.AddFarVariationDependencies(variations, partialBuildImportMemberTag,
+				android.PrebuiltNameFromSource(member.Name))
+		}
+	}
+}
+
+func (p *partialBuildImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	for _, member := range p.metadata.Members {
+		p.checkMemberFiles(ctx, member)
+		p.checkMemberArches(ctx, member)
+	}
+}
+
+// checkMemberFiles checks that the partial build contains all the files of the member. The contents
+// of the directories unpacked from zip files are not listed, so they are not checked.
+func (p *partialBuildImport) checkMemberFiles(ctx android.ModuleContext, member *partialBuildMember) {
+	for _, file := range member.Files {
+		if strings.HasSuffix(file, "/") {
+			continue
+		}
+		if !android.ExistentPathForSource(ctx, ctx.ModuleDir(), file).Valid() {
+			ctx.PropertyErrorf("metadata", "file %q of member %q is missing from the partial build",
+				file, member.Name)
+		}
+	}
+}
+
+// checkMemberArches checks that the member was built for every arch that the current product
+// builds for an OS that the member was built for. Members that were built for the common arch
+// only are not arch specific.
+func (p *partialBuildImport) checkMemberArches(ctx android.ModuleContext, member *partialBuildMember) {
+	arches := make(map[string][]string)
+	for _, variant := range member.Variants {
+		if variant.Arch != android.Common.Name {
+			arches[variant.Os] = append(arches[variant.Os], variant.Arch)
+		}
+	}
+
+	for _, osType := range android.OsTypeList() {
+		os := osType.Name
+		if arches[os] == nil {
+			continue
+		}
+		for _, target := range ctx.Config().Targets[osType] {
+			if target.NativeBridge == android.NativeBridgeEnabled {
+				continue
+			}
+			if arch := target.Arch.ArchType.Name; !android.InList(arch, arches[os]) {
+				ctx.PropertyErrorf("metadata", "member %q was not built for %s %s, it was only built for %s",
+					member.Name, os, arch, strings.Join(arches[os], ", "))
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2022 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk
+
+import (
+	"fmt"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestPartialBuildImport(t *testing.T) {
+	metadata := `
+{
+  "name": "mysdk",
+  "members": [
+    {
+      "name": "myjavalib",
+      "module_type": "java_import",
+      "module": %q,
+      "variants": %s,
+      "files": %s
+    }
+  ]
+}
+`
+	module := `
+java_import {
+    name: "myjavalib",
+    prefer: false,
+    jars: ["java/myjavalib.jar"],
+}
+`
+	commonVariants := `[{"os": "android", "arch": "common", "arch_variation": "common"}]`
+
+	runTest := func(t *testing.T, module, variants, files string, errorHandler android.FixtureErrorHandler) *android.TestResult {
+		return android.GroupFixturePreparers(
+			prepareForSdkTestWithJava,
+			android.FixtureAddTextFile("snapshot/Android.bp", `
+				partial_build_import {
+					name: "mysdk_partial_build",
+				}
+			`),
+			android.FixtureAddTextFile("snapshot/partial_build.json",
+				fmt.Sprintf(metadata, module, variants, files)),
+			android.FixtureAddFile("snapshot/java/myjavalib.jar", nil),
+		).ExtendWithErrorHandler(errorHandler).RunTest(t)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		result := runTest(t, module, commonVariants, `["java/myjavalib.jar"]`, android.FixtureExpectsNoErrors)
+
+		// The member is created in the directory of the partial_build_import module.
+		myjavalib := result.ModuleForTests("prebuilt_myjavalib", "android_common").Module()
+		android.AssertBoolEquals(t, "myjavalib is a prebuilt", true, android.IsModulePrebuilt(myjavalib))
+		android.AssertStringEquals(t, "myjavalib dir", "snapshot", result.ModuleDir(myjavalib))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		runTest(t, module, commonVariants, `["java/myjavalib.jar", "java/myjavalib-sources.jar"]`,
+			android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`file "java/myjavalib-sources.jar" of member "myjavalib" is missing from the partial build`))
+	})
+
+	t.Run("wrong module type", func(t *testing.T) {
+		runTest(t, `android_app_import { name: "myjavalib" }`, commonVariants, `["java/myjavalib.jar"]`,
+			android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`the module of member "myjavalib" must be a single java_import module`))
+	})
+
+	t.Run("invalid module", func(t *testing.T) {
+		runTest(t, `java_import { name: "myjavalib", srcs: ["a.java"] }`, commonVariants, `["java/myjavalib.jar"]`,
+			android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`invalid module of member "myjavalib": .*unrecognized property "srcs"`))
+	})
+
+	t.Run("missing arch", func(t *testing.T) {
+		runTest(t, module, `[{"os": "android", "arch": "arm64", "arch_variation": "arm64_armv8-a"}]`,
+			`["java/myjavalib.jar"]`,
+			android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+				`member "myjavalib" was not built for android arm, it was only built for arm64`))
+	})
+}
@@ -98,6 +98,7 @@ var prepareForSdkTest = android.GroupFixturePreparers(
 var PrepareForTestWithSdkBuildComponents = android.GroupFixturePreparers(
 	android.FixtureRegisterWithContext(registerModuleExportsBuildComponents),
 	android.FixtureRegisterWithContext(registerSdkBuildComponents),
+	android.FixtureRegisterWithContext(registerPartialBuildImportBuildComponents),
 )
 
 func testSdkWithFs(t *testing.T, bp string, fs android.MockFS) *android.TestResult {
@@ -146,6 +147,14 @@ func getSdkSnapshotBuildInfo(t *testing.T, result *android.TestResult, sdk *sdk)
 		targetBuildRelease:           sdk.builderForTests.targetBuildRelease,
 	}
 
+	if len(sdk.builderForTests.partialBuildMembers) > 0 {
+		metadata, err := sdk.builderForTests.partialBuildMetadata()
+		if err != nil {
+			t.Fatalf("failed to marshal partial build metadata: %s", err)
+		}
+		info.partialBuildMetadata = metadata
+	}
+
 	buildParams := sdk.BuildParamsForTests()
 	copyRules := &strings.Builder{}
 	otherCopyRules := &strings.Builder{}
@@ -272,6 +281,9 @@ func CheckSnapshot(t *testing.T, result *android.TestResult, name string, dir st
 		fs[filepath.Join(snapshotSubDir, dest)] = nil
 	}
 	fs[filepath.Join(snapshotSubDir, "Android.bp")] = []byte(snapshotBuildInfo.androidBpContents)
+	if snapshotBuildInfo.partialBuildMetadata != "" {
+		fs[filepath.Join(snapshotSubDir, PARTIAL_BUILD_METADATA_FILE)] = []byte(snapshotBuildInfo.partialBuildMetadata)
+	}
 
 	// If the generated snapshot builders not for the current release then it cannot be loaded by
 	// the current release.
@@ -326,6 +338,12 @@ func CheckSnapshot(t *testing.T, result *android.TestResult, name string, dir st
 			snapshotBpFile := filepath.Join(snapshotSubDir, "Android.bp")
 			unpreferred := string(fs[snapshotBpFile])
 			fs[snapshotBpFile] = []byte(strings.ReplaceAll(unpreferred, "prefer: false,", "prefer: true,"))
+
+			// The prebuilts of a partial build are defined in its metadata.
+			metadataFile := filepath.Join(snapshotSubDir, PARTIAL_BUILD_METADATA_FILE)
+			if metadata, ok := fs[metadataFile]; ok {
+				fs[metadataFile] = []byte(strings.ReplaceAll(string(metadata), "prefer: false,", "prefer: true,"))
+			}
 		})
 
 		runSnapshotTestWithCheckers(t, checkSnapshotPreferredWithSource, preferPrebuilts)
@@ -371,6 +389,16 @@ func checkVersionedAndroidBpContents(expected string) snapshotBuildInfoChecker {
 	}
 }
 
+// Check that the partial_build.json file of the snapshot is correct.
+//
+// Both the expected and actual string are both trimmed before comparing.
+func checkPartialBuildMetadata(expected string) snapshotBuildInfoChecker {
+	return func(info *snapshotBuildInfo) {
+		info.t.Helper()
+		android.AssertTrimmedStringEquals(info.t, "partial_build.json contents do not match", expected, info.partialBuildMetadata)
+	}
+}
+
 // Check that the snapshot's copy rules are correct.
 //
 // The copy rules are formatted as <src> -> <dest>, one per line and then compared
@@ -479,6 +507,9 @@ type snapshotBuildInfo struct {
 	// The contents of the versioned Android.bp file
 	androidVersionedBpContents string
 
+	// The contents of the partial_build.json file, empty if the snapshot is not a partial build.
+	partialBuildMetadata string
+
 	// The paths, relative to the snapshot root, of all files and directories copied into the
 	// snapshot.
 	snapshotContents []string
@@ -15,6 +15,7 @@
 package sdk
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
@@ -94,6 +95,16 @@ import (
 //     e.g. if setting SOONG_SDK_SNAPSHOT_TARGET_BUILD_RELEASE=S will cause the generated snapshot
 //     to be compatible with S.
 //
+// SOONG_SDK_SNAPSHOT_PARTIAL_BUILD
+//     Building a snapshot with SOONG_SDK_SNAPSHOT_PARTIAL_BUILD=true exports it as a partial build,
+//     i.e. a drop of built modules that is intended to be unpacked into a separate checkout and
+//     used there instead of building the modules from source. In addition to the usual contents
+//     the snapshot contains a partial_build.json file that describes each member: its name, the
+//     type and definition of the prebuilt module that reconstitutes it, the variants that it was
+//     built for and the files that the snapshot contains for it. Instead of the prebuilt modules,
+//     the generated Android.bp file contains a partial_build_import module that creates them from
+//     partial_build.json when the snapshot is unpacked into another checkout.
+//
 
 var pctx = android.NewPackageContext("android/soong/sdk")
 
@@ -311,6 +322,10 @@ func appendUniqueVariants(variants []android.SdkAware, newVariant android.SdkAwa
 // the build from which the snapshot was produced.
 const BUILD_NUMBER_FILE = "snapshot-creation-build-number.txt"
 
+// PARTIAL_BUILD_METADATA_FILE is the name of the file in a snapshot exported as a partial build
+// that describes its members, see SOONG_SDK_SNAPSHOT_PARTIAL_BUILD.
+const PARTIAL_BUILD_METADATA_FILE = "partial_build.json"
+
 // SDK directory structure
 // <sdk_root>/
 //     Android.bp   : definition of a 'sdk' module is here. This is a hand-made one.
@@ -409,6 +424,8 @@ func (s *sdk) buildSnapshot(ctx android.ModuleContext, sdkVariants []*sdk) andro
 		targetBuildRelease = currentBuildRelease
 	}
 
+	partialBuild := config.IsEnvTrue("SOONG_SDK_SNAPSHOT_PARTIAL_BUILD")
+
 	builder := &snapshotBuilder{
 		ctx:                   ctx,
 		sdk:                   s,
@@ -459,8 +476,12 @@ be unnecessary as every module in the sdk already has its own licenses property.
 		memberCtx := &memberContext{ctx, builder, memberType, name, requiredTraits}
 
 		prebuiltModule := memberType.AddPrebuiltModule(memberCtx, member)
+		if partialBuild {
+			builder.startPartialBuildMember(member, prebuiltModule.(*bpModule))
+		}
 		s.createMemberSnapshot(memberCtx, member, prebuiltModule.(*bpModule))
 	}
+	builder.currentPartialBuildMember = nil
 
 	// Create a transformer that will transform an unversioned module into a versioned module.
 	unversionedToVersionedTransformer := unversionedToVersionedTransformation{builder: builder}
@@ -471,9 +492,9 @@ be unnecessary as every module in the sdk already has its own licenses property.
 		builder: builder,
 	}
 
-	for _, unversioned := range builder.prebuiltOrder {
+	for _, prebuiltModule := range builder.prebuiltOrder {
 		// Prune any empty property sets.
-		unversioned = unversioned.transform(pruneEmptySetTransformer{})
+		unversioned := prebuiltModule.transform(pruneEmptySetTransformer{})
 
 		if generateVersioned {
 			// Copy the unversioned module so it can be modified to make it versioned.
@@ -487,7 +508,13 @@ be unnecessary as every module in the sdk already has its own licenses property.
 		if generateUnversioned {
 			// Transform the unversioned module to make it suitable for use in the snapshot.
 			unversioned.transform(unversionedTransformer)
-			bpFile.AddModule(unversioned)
+			if member := builder.partialBuildMemberFor(prebuiltModule); member != nil {
+				// The partial_build_import module creates the unversioned prebuilts of a partial build
+				// from their definitions in the metadata.
+				member.Module = bpModuleContents(unversioned)
+			} else {
+				bpFile.AddModule(unversioned)
+			}
 		}
 	}
 
@@ -496,6 +523,14 @@ be unnecessary as every module in the sdk already has its own licenses property.
 		s.addSnapshotModule(ctx, builder, sdkVariants, memberVariantDeps)
 	}
 
+	if partialBuild && generateUnversioned {
+		// Add the module that creates the unversioned prebuilts from the partial build metadata.
+		partialBuildImport := bpFile.newModule("partial_build_import")
+		partialBuildImport.AddProperty("name", ctx.ModuleName()+"_partial_build")
+		partialBuildImport.AddProperty("metadata", PARTIAL_BUILD_METADATA_FILE)
+		bpFile.AddModule(partialBuildImport)
+	}
+
 	// generate Android.bp
 	bp = newGeneratedFile(ctx, "snapshot", "Android.bp")
 	generateBpContents(&bp.generatedContents, bpFile)
@@ -505,6 +540,9 @@ be unnecessary as every module in the sdk already has its own licenses property.
 	// sure that it is compatible.
 	if targetBuildRelease == currentBuildRelease {
 		syntaxCheckSnapshotBpFile(ctx, contents)
+		for _, member := range builder.partialBuildMembers {
+			syntaxCheckSnapshotBpFile(ctx, member.Module)
+		}
 	}
 
 	bp.build(pctx, ctx, nil)
@@ -512,6 +550,10 @@ be unnecessary as every module in the sdk already has its own licenses property.
 	// Copy the build number file into the snapshot.
 	builder.CopyToSnapshot(ctx.Config().BuildNumberFile(ctx), BUILD_NUMBER_FILE)
 
+	if partialBuild {
+		builder.buildPartialBuildMetadata()
+	}
+
 	filesToZip := builder.filesToZip
 
 	// zip them all
@@ -927,13 +969,24 @@ func generateFilteredBpContents(contents *generatedContents, bpFile *bpFile, mod
 	for _, bpModule := range bpFile.order {
 		if moduleFilter(bpModule) {
 			contents.IndentedPrintf("\n")
-			contents.IndentedPrintf("%s {\n", bpModule.moduleType)
-			outputPropertySet(contents, bpModule.bpPropertySet)
-			contents.IndentedPrintf("}\n")
+			outputModule(contents, bpModule)
 		}
 	}
 }
 
+func outputModule(contents *generatedContents, bpModule *bpModule) {
+	contents.IndentedPrintf("%s {\n", bpModule.moduleType)
+	outputPropertySet(contents, bpModule.bpPropertySet)
+	contents.IndentedPrintf("}\n")
+}
+
+// bpModuleContents returns the definition of the module in Android.bp syntax.
+func bpModuleContents(bpModule *bpModule) string {
+	contents := &generatedContents{}
+	outputModule(contents, bpModule)
+	return contents.content.String()
+}
+
 func outputPropertySet(contents *generatedContents, set *bpPropertySet) {
 	contents.Indent()
 
@@ -1116,9 +1169,93 @@ type snapshotBuilder struct {
 
 	// The target build release for which the snapshot is to be generated.
 	targetBuildRelease *buildRelease
+
+	// The members of a partial build, in the order in which they were added to the snapshot, and
+	// the member to which files copied into the snapshot currently belong. Only used when the
+	// snapshot is exported as a partial build, see SOONG_SDK_SNAPSHOT_PARTIAL_BUILD.
+	partialBuildMembers       []*partialBuildMember
+	currentPartialBuildMember *partialBuildMember
+}
+
+// startPartialBuildMember records the metadata of the member and makes it the member to which files
+// copied into the snapshot belong.
+func (s *snapshotBuilder) startPartialBuildMember(member *sdkMember, prebuiltModule *bpModule) {
+	var variants []partialBuildVariant
+	for _, variant := range member.variants {
+		target := variant.Target()
+		v := partialBuildVariant{
+			Os:             target.Os.Name,
+			Arch:           target.Arch.ArchType.Name,
+			Arch_variation: target.ArchVariation(),
+		}
+		if !inPartialBuildVariants(v, variants) {
+			variants = append(variants, v)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if variants[i].Os != variants[j].Os {
+			return variants[i].Os < variants[j].Os
+		}
+		return variants[i].Arch < variants[j].Arch
+	})
+	s.currentPartialBuildMember = &partialBuildMember{
+		Name:           member.name,
+		Module_type:    prebuiltModule.moduleType,
+		Variants:       variants,
+		prebuiltModule: prebuiltModule,
+	}
+	s.partialBuildMembers = append(s.partialBuildMembers, s.currentPartialBuildMember)
+}
+
+// partialBuildMemberFor returns the partial build member whose unversioned prebuilt module is
+// prebuiltModule, or nil if the snapshot is not exported as a partial build.
+func (s *snapshotBuilder) partialBuildMemberFor(prebuiltModule *bpModule) *partialBuildMember {
+	for _, m := range s.partialBuildMembers {
+		if m.prebuiltModule == prebuiltModule {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *snapshotBuilder) recordPartialBuildFile(dest string) {
+	if m := s.currentPartialBuildMember; m != nil && !android.InList(dest, m.Files) {
+		m.Files = append(m.Files, dest)
+	}
+}
+
+// partialBuildMetadata returns the contents of the partial_build.json file of the snapshot.
+func (s *snapshotBuilder) partialBuildMetadata() (string, error) {
+	for _, m := range s.partialBuildMembers {
+		sort.Strings(m.Files)
+	}
+	metadata := partialBuildMetadata{
+		Name:    s.ctx.ModuleName(),
+		Members: s.partialBuildMembers,
+	}
+	contents, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(contents) + "\n", nil
+}
+
+// buildPartialBuildMetadata adds the partial_build.json file to the snapshot.
+func (s *snapshotBuilder) buildPartialBuildMetadata() {
+	contents, err := s.partialBuildMetadata()
+	if err != nil {
+		s.ctx.ModuleErrorf("failed to marshal partial build metadata: %s", err)
+		return
+	}
+
+	metadataFile := newGeneratedFile(s.ctx, "snapshot", PARTIAL_BUILD_METADATA_FILE)
+	metadataFile.UnindentedPrintf("%s", contents)
+	metadataFile.build(pctx, s.ctx, nil)
+	s.filesToZip = append(s.filesToZip, metadataFile.path)
 }
 
 func (s *snapshotBuilder) CopyToSnapshot(src android.Path, dest string) {
+	s.recordPartialBuildFile(dest)
 	if existing, ok := s.copies[dest]; ok {
 		if existing != src.String() {
 			s.ctx.ModuleErrorf("conflicting copy, %s copied from both %s and %s", dest, existing, src)
@@ -1139,6 +1276,7 @@ func (s *snapshotBuilder) CopyToSnapshot(src android.Path, dest string) {
 
 func (s *snapshotBuilder) UnzipToSnapshot(zipPath android.Path, destDir string) {
 	ctx := s.ctx
+	s.recordPartialBuildFile(destDir + "/")
 
 	// Repackage the zip file so that the entries are in the destDir directory.
 	// This will allow the zip file to be merged into the snapshot.
@@ -16,6 +16,7 @@ package snapshot
 import (
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"android/soong/android"
 )
@@ -84,6 +85,13 @@ func (c *SnapshotSingleton) GenerateBuildActions(ctx android.SingletonContext) {
 		return snapshotOutputs[i].String() < snapshotOutputs[j].String()
 	})
 
+	// Fake snapshots contain only empty files, there is nothing to share between them.
+	var blobsZip android.Path
+	contentAddressed := ctx.DeviceConfig().ContentAddressedSnapshots() && !c.Fake
+	if contentAddressed {
+		snapshotOutputs, blobsZip = storeSnapshotBlobs(ctx, snapshotArchDir, snapshotOutputs)
+	}
+
 	zipPath := android.PathForOutput(
 		ctx,
 		snapshotDir,
@@ -104,17 +112,69 @@ func (c *SnapshotSingleton) GenerateBuildActions(ctx android.SingletonContext) {
 
 	zipRule.Temporary(snapshotOutputList)
 
-	zipRule.Command().
-		BuiltTool("soong_zip").
-		FlagWithOutput("-o ", zipPath).
-		FlagWithArg("-C ", android.PathForOutput(ctx, snapshotDir).String()).
-		FlagWithInput("-l ", snapshotOutputList)
+	if contentAddressed {
+		// The blobs are added to the zip of the snapshot tree.
+		treeZipPath := android.PathForOutput(ctx, snapshotDir,
+			c.name+"-"+ctx.Config().DeviceName()+"-tree.zip")
+		zipRule.Command().
+			BuiltTool("soong_zip").
+			FlagWithOutput("-o ", treeZipPath).
+			FlagWithArg("-C ", android.PathForOutput(ctx, snapshotDir).String()).
+			FlagWithInput("-l ", snapshotOutputList)
+		zipRule.Command().
+			BuiltTool("merge_zips").
+			Output(zipPath).
+			Input(treeZipPath).
+			Input(blobsZip)
+		zipRule.Temporary(treeZipPath)
+	} else {
+		zipRule.Command().
+			BuiltTool("soong_zip").
+			FlagWithOutput("-o ", zipPath).
+			FlagWithArg("-C ", android.PathForOutput(ctx, snapshotDir).String()).
+			FlagWithInput("-l ", snapshotOutputList)
+	}
 
 	zipRule.Build(zipPath.String(), c.name+" snapshot "+zipPath.String())
 	zipRule.DeleteTemporaryFiles()
 	c.snapshotZipFile = android.OptionalPathForPath(zipPath)
 }
 
+// storeSnapshotBlobs stores the snapshot files in a content-addressed blob store, and returns the
+// files that remain in the snapshot tree and a zip of the blobs, whose entries are
+// blobs/<digest>. The files that remain in the snapshot tree are the json flag files, the headers
+// and a manifest.json mapping the path of every stored file to the digest of its blob.
+//
+// The json flag files are kept as they are, as they describe the snapshot modules rather than
+// being part of them, and so are the headers, as the snapshot modules export their directories.
+// Snapshot modules resolve their other files through the manifest with the snapshot_manifest
+// property.
+func storeSnapshotBlobs(ctx android.SingletonContext, snapshotArchDir string, snapshotOutputs android.Paths) (android.Paths, android.Path) {
+	includeDir := android.PathForOutput(ctx, snapshotArchDir, "include").String()
+	var kept, blobs android.Paths
+	for _, output := range snapshotOutputs {
+		if _, isHeader := android.MaybeRel(ctx, includeDir, output.String()); isHeader || output.Ext() == ".json" {
+			kept = append(kept, output)
+		} else {
+			blobs = append(blobs, output)
+		}
+	}
+
+	manifest := android.PathForOutput(ctx, snapshotArchDir, "manifest.json")
+	blobsZip := android.PathForOutput(ctx, snapshotArchDir, "blobs.zip")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("snapshot_blob_store").
+		FlagWithArg("--root ", android.PathForOutput(ctx, snapshotArchDir).String()).
+		FlagWithOutput("--blobs-zip ", blobsZip).
+		FlagWithOutput("--manifest ", manifest).
+		Inputs(blobs)
+	rule.Build("snapshot_blob_store_"+strings.ReplaceAll(snapshotArchDir, "/", "_"),
+		"snapshot blob store "+snapshotArchDir)
+
+	return append(kept, manifest), blobsZip
+}
+
 func (c *SnapshotSingleton) MakeVars(ctx android.MakeVarsContext) {
 	ctx.Strict(
 		c.makeVar,
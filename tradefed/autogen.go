@@ -291,34 +291,50 @@ var autogenInstrumentationTest = pctx.StaticRule("autogenInstrumentationTest", b
 func AutoGenInstrumentationTestConfig(ctx android.ModuleContext, testConfigProp *string,
 	testConfigTemplateProp *string, manifest android.Path, testSuites []string, autoGenConfig *bool, configs []Config) android.Path {
 	path, autogenPath := testConfigPath(ctx, testConfigProp, testSuites, autoGenConfig, testConfigTemplateProp)
-	var configStrings []string
 	if autogenPath != nil {
-		template := "${InstrumentationTestConfigTemplate}"
-		moduleTemplate := getTestConfigTemplate(ctx, testConfigTemplateProp)
-		if moduleTemplate.Valid() {
-			template = moduleTemplate.String()
-		}
-		for _, config := range configs {
-			configStrings = append(configStrings, config.Config())
-		}
-		extraConfigs := strings.Join(configStrings, fmt.Sprintf("\\n%s", test_xml_indent))
-		extraConfigs = fmt.Sprintf("--extra-configs '%s'", extraConfigs)
-
-		ctx.Build(pctx, android.BuildParams{
-			Rule:        autogenInstrumentationTest,
-			Description: "test config",
-			Input:       manifest,
-			Output:      autogenPath,
-			Args: map[string]string{
-				"name":         ctx.ModuleName(),
-				"template":     template,
-				"extraConfigs": extraConfigs,
-			},
-		})
+		autogenInstrumentationTestConfig(ctx, autogenPath, testConfigTemplateProp, manifest, configs)
 		return autogenPath
 	}
 	return path
 }
 
+// AutoGenInstrumentationTestShardConfig generates the test config of a test shard named name from
+// the manifest of the shard, the same way AutoGenInstrumentationTestConfig generates the config of
+// the whole test.
+func AutoGenInstrumentationTestShardConfig(ctx android.ModuleContext, name string,
+	testConfigTemplateProp *string, manifest android.Path, configs []Config) android.Path {
+	// The module name in the template is taken from the name of the generated config.
+	autogenPath := android.PathForModuleOut(ctx, name+".config")
+	autogenInstrumentationTestConfig(ctx, autogenPath, testConfigTemplateProp, manifest, configs)
+	return autogenPath
+}
+
+func autogenInstrumentationTestConfig(ctx android.ModuleContext, autogenPath android.WritablePath,
+	testConfigTemplateProp *string, manifest android.Path, configs []Config) {
+	template := "${InstrumentationTestConfigTemplate}"
+	moduleTemplate := getTestConfigTemplate(ctx, testConfigTemplateProp)
+	if moduleTemplate.Valid() {
+		template = moduleTemplate.String()
+	}
+	var configStrings []string
+	for _, config := range configs {
+		configStrings = append(configStrings, config.Config())
+	}
+	extraConfigs := strings.Join(configStrings, fmt.Sprintf("\\n%s", test_xml_indent))
+	extraConfigs = fmt.Sprintf("--extra-configs '%s'", extraConfigs)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        autogenInstrumentationTest,
+		Description: "test config",
+		Input:       manifest,
+		Output:      autogenPath,
+		Args: map[string]string{
+			"name":         ctx.ModuleName(),
+			"template":     template,
+			"extraConfigs": extraConfigs,
+		},
+	})
+}
+
 var Bool = proptools.Bool
 var BoolDefault = proptools.BoolDefault
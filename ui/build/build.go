@@ -65,6 +65,8 @@ builddir = {{.OutDir}}
 {{end -}}
 pool highmem_pool
  depth = {{.HighmemParallel}}
+{{if .HasSoongNinjaPoolsFile}}include {{.SoongNinjaPoolsFile}}
+{{end -}}
 {{if and (not .SkipKatiNinja) .HasKatiSuffix}}subninja {{.KatiBuildNinjaFile}}
 subninja {{.KatiPackageNinjaFile}}
 {{end -}}
@@ -272,6 +274,7 @@ func Build(ctx Context, config Config) {
 
 	if what&RunProductConfig != 0 {
 		runMakeProductConfig(ctx, config)
+		runStarlarkProductConfig(ctx, config)
 	}
 
 	// Everything below here depends on product config.
@@ -323,6 +326,11 @@ func Build(ctx Context, config Config) {
 			installCleanIfNecessary(ctx, config)
 		}
 
+		if config.UsePersistentWorkers() {
+			stopPersistentWorkers := startPersistentWorkers(ctx, config)
+			defer stopPersistentWorkers()
+		}
+
 		runNinjaForBuild(ctx, config)
 	}
 
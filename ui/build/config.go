@@ -46,7 +46,7 @@ type Config struct{ *configImpl }
 
 type configImpl struct {
 	// Some targets that are implemented in soong_build
-	// (bp2build, json-module-graph) are not here and have their own bits below.
+	// (bp2build, json-module-graph, modules-under) are not here and have their own bits below.
 	arguments     []string
 	goma          bool
 	environ       *Environment
@@ -64,6 +64,7 @@ type configImpl struct {
 	queryview       bool
 	reportMkMetrics bool // Collect and report mk2bp migration progress metrics.
 	soongDocs       bool
+	modulesUnderDir string
 	skipConfig      bool
 	skipKati        bool
 	skipKatiNinja   bool
@@ -72,12 +73,13 @@ type configImpl struct {
 	skipSoongTests  bool
 
 	// From the product config
-	katiArgs        []string
-	ninjaArgs       []string
-	katiSuffix      string
-	targetDevice    string
-	targetDeviceDir string
-	sandboxConfig   *SandboxConfig
+	katiArgs              []string
+	ninjaArgs             []string
+	katiSuffix            string
+	targetDevice          string
+	targetDeviceDir       string
+	starlarkProductConfig string
+	sandboxConfig         *SandboxConfig
 
 	// Autodetected
 	totalRAM uint64
@@ -735,6 +737,13 @@ func (c *configImpl) parseArgs(ctx Context, args []string) {
 			c.skipConfig = true
 		} else if arg == "--skip-soong-tests" {
 			c.skipSoongTests = true
+		} else if arg == "--no-test-cache" {
+			// Rerun host unit tests even if they passed with the same inputs before.
+			c.environ.Set("SOONG_NO_TEST_CACHE", "true")
+		} else if arg == "--per-product-intermediates" {
+			// Keep the intermediates of each product apart so that multiple products can be built
+			// into the same out directory.
+			c.environ.Set("SOONG_PER_PRODUCT_INTERMEDIATES", "true")
 		} else if arg == "--mk-metrics" {
 			c.reportMkMetrics = true
 		} else if len(arg) > 0 && arg[0] == '-' {
@@ -777,6 +786,12 @@ func (c *configImpl) parseArgs(ctx Context, args []string) {
 			c.queryview = true
 		} else if arg == "soong_docs" {
 			c.soongDocs = true
+		} else if arg == "modules-under" {
+			if i+1 >= len(args) {
+				ctx.Fatalln("modules-under requires a directory, e.g. m modules-under frameworks/base")
+			}
+			i++
+			c.modulesUnderDir = strings.TrimSpace(args[i])
 		} else {
 			if arg == "checkbuild" {
 				c.checkbuild = true
@@ -850,7 +865,7 @@ func (c *configImpl) SoongBuildInvocationNeeded() bool {
 		return true
 	}
 
-	if !c.JsonModuleGraph() && !c.Bp2Build() && !c.Queryview() && !c.SoongDocs() {
+	if !c.JsonModuleGraph() && !c.Bp2Build() && !c.Queryview() && !c.SoongDocs() && !c.ModulesUnder() {
 		// Command line was empty, the default Ninja target is built
 		return true
 	}
@@ -945,6 +960,10 @@ func (c *configImpl) ModuleGraphFile() string {
 	return shared.JoinPath(c.SoongOutDir(), "module-graph.json")
 }
 
+func (c *configImpl) ModulesUnderFile() string {
+	return shared.JoinPath(c.SoongOutDir(), "modules_under.txt")
+}
+
 func (c *configImpl) ModuleActionsFile() string {
 	return shared.JoinPath(c.SoongOutDir(), "module-actions.json")
 }
@@ -990,6 +1009,16 @@ func (c *configImpl) SoongDocs() bool {
 	return c.soongDocs
 }
 
+// ModulesUnder returns true if "modules-under <dir>" was one of the build goals, which lists the
+// modules defined under the directory returned by ModulesUnderDir.
+func (c *configImpl) ModulesUnder() bool {
+	return c.modulesUnderDir != ""
+}
+
+func (c *configImpl) ModulesUnderDir() string {
+	return c.modulesUnderDir
+}
+
 func (c *configImpl) IsVerbose() bool {
 	return c.verbose
 }
@@ -1033,6 +1062,16 @@ func (c *configImpl) SetTargetDevice(device string) {
 	c.targetDevice = device
 }
 
+// StarlarkProductConfig returns the Starlark (.scl) file defining product variables of the current
+// product, or an empty string if the product is only defined in Make.
+func (c *configImpl) StarlarkProductConfig() string {
+	return c.starlarkProductConfig
+}
+
+func (c *configImpl) SetStarlarkProductConfig(file string) {
+	c.starlarkProductConfig = file
+}
+
 func (c *configImpl) TargetBuildVariant() string {
 	if v, ok := c.environ.Get("TARGET_BUILD_VARIANT"); ok {
 		return v
@@ -1154,6 +1193,12 @@ func (c *configImpl) StartRBE() bool {
 	return true
 }
 
+// UsePersistentWorkers returns true if the javac, kotlinc and r8 actions should run in the
+// persistent workers of a pool started by soong_ui.
+func (c *configImpl) UsePersistentWorkers() bool {
+	return c.Environment().IsEnvTrue("SOONG_USE_PERSISTENT_WORKERS")
+}
+
 func (c *configImpl) rbeLogDir() string {
 	for _, f := range []string{"RBE_log_dir", "FLAG_log_dir"} {
 		if v, ok := c.environ.Get(f); ok {
@@ -1286,6 +1331,18 @@ func (c *configImpl) SoongNinjaFile() string {
 	return filepath.Join(c.SoongOutDir(), "build.ninja")
 }
 
+// SoongNinjaPoolsFile returns the file that Soong writes the Ninja pools defined by the product to.
+func (c *configImpl) SoongNinjaPoolsFile() string {
+	return filepath.Join(c.SoongOutDir(), "ninja_pools.ninja")
+}
+
+// HasSoongNinjaPoolsFile returns whether Soong has written SoongNinjaPoolsFile, which the combined
+// Ninja file must include before the Soong Ninja file that uses the pools.
+func (c *configImpl) HasSoongNinjaPoolsFile() bool {
+	_, err := os.Stat(c.SoongNinjaPoolsFile())
+	return err == nil
+}
+
 func (c *configImpl) CombinedNinjaFile() string {
 	if c.katiSuffix == "" {
 		return filepath.Join(c.OutDir(), "combined.ninja")
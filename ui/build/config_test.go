@@ -154,6 +154,18 @@ func TestConfigParseArgsVars(t *testing.T) {
 			expectedEnv: []string{"A="},
 			remaining:   []string{"=b"},
 		},
+
+		{
+			args: []string{"--no-test-cache"},
+
+			expectedEnv: []string{"SOONG_NO_TEST_CACHE=true"},
+		},
+
+		{
+			args: []string{"--per-product-intermediates"},
+
+			expectedEnv: []string{"SOONG_PER_PRODUCT_INTERMEDIATES=true"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -182,6 +194,58 @@ func TestConfigParseArgsVars(t *testing.T) {
 	}
 }
 
+func TestConfigParseArgsModulesUnder(t *testing.T) {
+	ctx := testContext()
+
+	testCases := []struct {
+		args []string
+
+		modulesUnderDir            string
+		remaining                  []string
+		soongBuildInvocationNeeded bool
+	}{
+		{
+			args: []string{"modules-under", "frameworks/base"},
+
+			modulesUnderDir: "frameworks/base",
+		},
+		{
+			args: []string{"modules-under", "frameworks/base", "droid"},
+
+			modulesUnderDir:            "frameworks/base",
+			remaining:                  []string{"droid"},
+			soongBuildInvocationNeeded: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			defer logger.Recover(func(err error) {
+				t.Fatal(err)
+			})
+
+			c := &configImpl{}
+			c.parseArgs(ctx, tc.args)
+
+			if c.ModulesUnderDir() != tc.modulesUnderDir {
+				t.Errorf("for %q, modules under:\nwant: %q\n got: %q\n",
+					strings.Join(tc.args, " "),
+					tc.modulesUnderDir, c.ModulesUnderDir())
+			}
+			if !reflect.DeepEqual(c.arguments, tc.remaining) {
+				t.Errorf("for %q, remaining arguments:\nwant: %q\n got: %q\n",
+					strings.Join(tc.args, " "),
+					tc.remaining, c.arguments)
+			}
+			if c.SoongBuildInvocationNeeded() != tc.soongBuildInvocationNeeded {
+				t.Errorf("for %q, soong build invocation needed:\nwant: %t\n got: %t\n",
+					strings.Join(tc.args, " "),
+					tc.soongBuildInvocationNeeded, c.SoongBuildInvocationNeeded())
+			}
+		})
+	}
+}
+
 func TestConfigCheckTopDir(t *testing.T) {
 	ctx := testContext()
 	buildRootDir := filepath.Dir(srcDirFileCheck)
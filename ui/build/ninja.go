@@ -23,6 +23,7 @@ import (
 	"strings"
 	"time"
 
+	"android/soong/ui/build/worker"
 	"android/soong/ui/metrics"
 	"android/soong/ui/status"
 )
@@ -172,6 +173,10 @@ func runNinjaForBuild(ctx Context, config Config) {
 
 			// LLVM compiler wrapper options
 			"TOOLCHAIN_RUSAGE_OUTPUT",
+
+			// The socket of the persistent worker pool, the workers produce the same outputs as
+			// the tools they replace.
+			worker.SocketEnvVar,
 		}, config.BuildBrokenNinjaUsesEnvVars()...)...)
 	}
 
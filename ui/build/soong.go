@@ -44,6 +44,7 @@ const (
 	jsonModuleGraphTag = "modulegraph"
 	queryviewTag       = "queryview"
 	soongDocsTag       = "soong_docs"
+	modulesUnderTag    = "modules_under"
 
 	// bootstrapEpoch is used to determine if an incremental build is incompatible with the current
 	// version of bootstrap and needs cleaning before continuing the build.  Increment this for
@@ -237,6 +238,7 @@ func bootstrapGlobFileList(config Config) []string {
 		config.NamedGlobFile(jsonModuleGraphTag),
 		config.NamedGlobFile(queryviewTag),
 		config.NamedGlobFile(soongDocsTag),
+		config.NamedGlobFile(modulesUnderTag),
 	}
 }
 
@@ -316,6 +318,29 @@ func bootstrapBlueprint(ctx Context, config Config) {
 		config.NamedGlobFile(jsonModuleGraphTag),
 		config.NamedGlobFile(queryviewTag),
 		config.NamedGlobFile(soongDocsTag),
+		config.NamedGlobFile(modulesUnderTag),
+	}
+
+	primaryBuilderInvocations := []bootstrap.PrimaryBuilderInvocation{
+		mainSoongBuildInvocation,
+		bp2buildInvocation,
+		jsonModuleGraphInvocation,
+		queryviewInvocation,
+		soongDocsInvocation,
+	}
+
+	// The directory is only known when modules-under is one of the goals.
+	if config.ModulesUnder() {
+		primaryBuilderInvocations = append(primaryBuilderInvocations, primaryBuilderInvocation(
+			config,
+			modulesUnderTag,
+			config.ModulesUnderFile(),
+			[]string{
+				"--modules_under", config.ModulesUnderDir(),
+				"--modules_under_file", config.ModulesUnderFile(),
+			},
+			fmt.Sprintf("listing the modules under %s", config.ModulesUnderDir()),
+		))
 	}
 
 	// The glob .ninja files are subninja'd. However, they are generated during
@@ -339,14 +364,9 @@ func bootstrapBlueprint(ctx Context, config Config) {
 		outDir:      config.OutDir(),
 		runGoTests:  !config.skipSoongTests,
 		// If we want to debug soong_build, we need to compile it for debugging
-		debugCompilation: os.Getenv("SOONG_DELVE") != "",
-		subninjas:        globFiles,
-		primaryBuilderInvocations: []bootstrap.PrimaryBuilderInvocation{
-			mainSoongBuildInvocation,
-			bp2buildInvocation,
-			jsonModuleGraphInvocation,
-			queryviewInvocation,
-			soongDocsInvocation},
+		debugCompilation:          os.Getenv("SOONG_DELVE") != "",
+		subninjas:                 globFiles,
+		primaryBuilderInvocations: primaryBuilderInvocations,
 	}
 
 	bootstrapDeps := bootstrap.RunBlueprint(blueprintArgs, bootstrap.DoEverything, blueprintCtx, blueprintConfig)
@@ -425,6 +445,10 @@ func runSoong(ctx Context, config Config) {
 		if config.SoongDocs() {
 			checkEnvironmentFile(soongBuildEnv, config.UsedEnvFile(soongDocsTag))
 		}
+
+		if config.ModulesUnder() {
+			checkEnvironmentFile(soongBuildEnv, config.UsedEnvFile(modulesUnderTag))
+		}
 	}()
 
 	runMicrofactory(ctx, config, "bpglob", "github.com/google/blueprint/bootstrap/bpglob",
@@ -484,6 +508,10 @@ func runSoong(ctx Context, config Config) {
 		targets = append(targets, config.SoongDocsHtml())
 	}
 
+	if config.ModulesUnder() {
+		targets = append(targets, config.ModulesUnderFile())
+	}
+
 	if config.SoongBuildInvocationNeeded() {
 		// This build generates <builddir>/build.ninja, which is used later by build/soong/ui/build/build.go#Build().
 		targets = append(targets, config.SoongNinjaFile())
@@ -510,6 +538,19 @@ func runSoong(ctx Context, config Config) {
 	if config.JsonModuleGraph() {
 		distGzipFile(ctx, config, config.ModuleGraphFile(), "soong")
 	}
+
+	if config.ModulesUnder() {
+		printModulesUnder(ctx, config)
+	}
+}
+
+// printModulesUnder prints the list of modules written by soong_build for modules-under.
+func printModulesUnder(ctx Context, config Config) {
+	list, err := ioutil.ReadFile(config.ModulesUnderFile())
+	if err != nil {
+		ctx.Fatalf("Failed to read %s: %s", config.ModulesUnderFile(), err)
+	}
+	fmt.Fprint(ctx.Writer, string(list))
 }
 
 func runMicrofactory(ctx Context, config Config, name string, pkg string, mapping map[string]string) {
@@ -0,0 +1,88 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"android/soong/ui/metrics"
+)
+
+// The file soong_build reads the product variables evaluated from the Starlark product config
+// from, see android/starlark_product_config.go.
+const starlarkProductVariablesFile = "soong.starlark.variables"
+
+// starlarkProductConfigDriver returns the Starlark code that loads the product_variables dict
+// from the Starlark product config file and prints it as JSON.
+func starlarkProductConfigDriver(productConfig string) string {
+	productConfig = filepath.Clean(productConfig)
+	// rbcrun loads files relative to the source tree root with "//<dir>:<file>".
+	label := fmt.Sprintf("//%s:%s", filepath.Dir(productConfig), filepath.Base(productConfig))
+	return fmt.Sprintf("load(%q, \"product_variables\")\nprint(json.encode(product_variables))\n", label)
+}
+
+// runStarlarkProductConfig evaluates the Starlark product config of the product, if any, with
+// rbcrun, which it builds first, and writes the resulting product variables where soong_build
+// will read them to override the ones from the Make product config. Products that are only
+// defined in Make get an empty set of product variables.
+func runStarlarkProductConfig(ctx Context, config Config) {
+	ctx.BeginTrace(metrics.RunSetupTool, "starlark_product_config")
+	defer ctx.EndTrace()
+
+	variablesFile := filepath.Join(config.SoongOutDir(), starlarkProductVariablesFile)
+	variables := []byte("{}\n")
+
+	if productConfig := config.StarlarkProductConfig(); productConfig != "" {
+		if filepath.IsAbs(productConfig) || strings.HasPrefix(filepath.Clean(productConfig), "../") {
+			ctx.Fatalf("PRODUCT_STARLARK_CONFIG must be relative to the source tree, got %q", productConfig)
+		}
+		if filepath.Ext(productConfig) != ".scl" {
+			ctx.Fatalf("PRODUCT_STARLARK_CONFIG must be a .scl file, got %q", productConfig)
+		}
+
+		driver := filepath.Join(config.SoongOutDir(), ".starlark_product_config.star")
+		ensureDirectoriesExist(ctx, config.SoongOutDir())
+		if err := ioutil.WriteFile(driver, []byte(starlarkProductConfigDriver(productConfig)), 0666); err != nil { // a+rw
+			ctx.Fatalf("Failed to write Starlark product config driver: %s", err)
+		}
+
+		// rbcrun is only built by soong_ui.bash when it is used to start the build, build it here
+		// so that it is up to date for every entry point.
+		runMicrofactory(ctx, config, "rbcrun", "rbcrun/cmd", map[string]string{
+			"rbcrun":          "build/make/tools/rbcrun",
+			"go.starlark.net": "external/starlark-go",
+		})
+
+		cmd := Command(ctx, config, "rbcrun", filepath.Join(config.SoongOutDir(), "rbcrun"), driver)
+		output := cmd.OutputOrFatal()
+		variables = append(bytes.TrimSpace(output), '\n')
+	}
+
+	// Only update the file when the product variables changed so that soong_build doesn't rerun.
+	if existing, err := ioutil.ReadFile(variablesFile); err == nil && bytes.Equal(existing, variables) {
+		return
+	} else if err != nil && !os.IsNotExist(err) {
+		ctx.Fatalf("Failed to read %s: %s", variablesFile, err)
+	}
+	ensureDirectoriesExist(ctx, config.SoongOutDir())
+	if err := ioutil.WriteFile(variablesFile, variables, 0666); err != nil { // a+rw
+		ctx.Fatalf("Failed to write %s: %s", variablesFile, err)
+	}
+}
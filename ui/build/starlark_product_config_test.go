@@ -0,0 +1,92 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"android/soong/ui/logger"
+)
+
+func TestStarlarkProductConfigDriver(t *testing.T) {
+	expected := "load(\"//vendor/acme/products:acme.scl\", \"product_variables\")\n" +
+		"print(json.encode(product_variables))\n"
+	if got := starlarkProductConfigDriver("vendor/acme/products/./acme.scl"); got != expected {
+		t.Errorf("expected driver:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRunStarlarkProductConfig_NoStarlarkConfig(t *testing.T) {
+	ctx := testContext()
+	defer logger.Recover(func(err error) {
+		t.Fatal(err)
+	})
+
+	e := Environment([]string{"OUT_DIR=" + t.TempDir()})
+	config := Config{&configImpl{environ: &e}}
+
+	runStarlarkProductConfig(ctx, config)
+
+	variablesFile := filepath.Join(config.SoongOutDir(), starlarkProductVariablesFile)
+	data, err := ioutil.ReadFile(variablesFile)
+	if err != nil {
+		t.Fatalf("expected %s to be written: %s", variablesFile, err)
+	}
+	if string(data) != "{}\n" {
+		t.Errorf("expected empty product variables, got %q", string(data))
+	}
+}
+
+func TestRunStarlarkProductConfig_InvalidConfig(t *testing.T) {
+	testCases := []struct {
+		productConfig string
+		expectedErr   string
+	}{
+		{
+			productConfig: "/abs/acme.scl",
+			expectedErr:   "must be relative to the source tree",
+		},
+		{
+			productConfig: "../acme.scl",
+			expectedErr:   "must be relative to the source tree",
+		},
+		{
+			productConfig: "vendor/acme/acme.mk",
+			expectedErr:   "must be a .scl file",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.productConfig, func(t *testing.T) {
+			ctx := testContext()
+			e := Environment([]string{"OUT_DIR=" + t.TempDir()})
+			config := Config{&configImpl{environ: &e}}
+			config.SetStarlarkProductConfig(tc.productConfig)
+
+			var fatal error
+			func() {
+				defer logger.Recover(func(err error) {
+					fatal = err
+				})
+				runStarlarkProductConfig(ctx, config)
+			}()
+			if fatal == nil || !strings.Contains(fatal.Error(), tc.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedErr, fatal)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"android/soong/ui/build/worker"
+	"android/soong/ui/metrics"
+)
+
+// The default number of workers of each kind, a quarter of the parallelism of ninja is enough
+// to keep the workers busy without using too much memory as each worker is a JVM.
+func persistentWorkerMaxInstances(config Config) int {
+	if v, ok := config.Environment().Get("SOONG_PERSISTENT_WORKER_MAX_INSTANCES"); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return (config.Parallel() + 3) / 4
+}
+
+func persistentWorkerSockAddr(dir string) (string, error) {
+	maxNameLen := len(syscall.RawSockaddrUnix{}.Path)
+	base := fmt.Sprintf("soong_workers_%d.sock", os.Getpid())
+
+	for _, d := range []string{dir, "/tmp"} {
+		if name := filepath.Join(d, base); len(name) < maxNameLen {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("cannot generate a worker socket address shorter than the limit of %v", maxNameLen)
+}
+
+// startPersistentWorkers starts the pool of persistent workers that the javac, kotlinc and r8
+// actions run in, and returns the function that stops it. The actions find the pool through the
+// socket in the environment of ninja.
+func startPersistentWorkers(ctx Context, config Config) func() {
+	ctx.BeginTrace(metrics.RunSetupTool, "persistent_workers")
+	defer ctx.EndTrace()
+
+	socket, err := persistentWorkerSockAddr(absPath(ctx, config.TempDir()))
+	if err != nil {
+		ctx.Fatalln(err)
+	}
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		ctx.Fatalf("failed to listen on the worker socket: %v", err)
+	}
+
+	logDir := filepath.Join(config.LogsDir(), "persistent_workers")
+	pool := worker.NewPool(logDir, persistentWorkerMaxInstances(config))
+	go func() {
+		if err := pool.Serve(l); err != nil {
+			ctx.Println("persistent worker pool stopped:", err)
+		}
+	}()
+	config.Environment().Set(worker.SocketEnvVar, socket)
+	ctx.Verbosef("Persistent workers listening on %s, logs in %s", socket, logDir)
+
+	return func() {
+		pool.Close()
+		l.Close()
+		os.Remove(socket)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// SocketEnvVar is the environment variable that holds the path of the socket of the worker pool
+// for the actions of the build.
+const SocketEnvVar = "SOONG_WORKER_SOCKET"
+
+// Run sends the request to the worker pool listening on socket and waits for the response. An
+// error is returned if the request could not be run by a worker.
+func Run(socket string, req Request) (Response, error) {
+	var resp Response
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,296 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package worker implements a pool of persistent workers that is shared by the actions of a
+// build, so that the JVM startup and JIT warmup costs of tools like javac, kotlinc and r8 are only
+// paid once per worker instead of once per action.
+//
+// The workers implement the JSON flavor of the Bazel persistent worker protocol: they are started
+// with the --persistent_worker flag and read one WorkRequest per line on stdin, and write one
+// WorkResponse per line on stdout. The actions talk to the pool through a unix socket, one
+// Request and Response per connection, see Run.
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Request is sent by an action to the pool to run the arguments in a worker of the given kind.
+type Request struct {
+	// Mnemonic identifies the tool, e.g. Javac, it is used to name the worker logs.
+	Mnemonic string
+
+	// WorkerCommand is the command that starts a worker, without the --persistent_worker flag.
+	// Requests with the same mnemonic and worker command share the same workers.
+	WorkerCommand []string
+
+	// Arguments are the arguments of the tool for this action.
+	Arguments []string
+}
+
+// Response is sent by the pool to the action once the worker is done.
+type Response struct {
+	ExitCode int
+	Output   string
+
+	// Error is set if the request could not be handled by a worker, in which case the action
+	// should run the tool itself.
+	Error string
+}
+
+// WorkRequest is the JSON encoding of the WorkRequest message of the Bazel worker protocol.
+type WorkRequest struct {
+	Arguments []string `json:"arguments"`
+	RequestId int      `json:"requestId,omitempty"`
+}
+
+// WorkResponse is the JSON encoding of the WorkResponse message of the Bazel worker protocol.
+type WorkResponse struct {
+	ExitCode  int    `json:"exitCode"`
+	Output    string `json:"output"`
+	RequestId int    `json:"requestId,omitempty"`
+}
+
+// Pool starts and reuses the workers for the requests it receives.
+type Pool struct {
+	logDir     string
+	maxWorkers int
+
+	lock    sync.Mutex
+	closed  bool
+	kinds   map[string]*workerKind
+	workers []*worker
+	// started counts the workers started so far, it numbers their logs.
+	started int
+}
+
+// workerKind holds the workers started with the same command.
+type workerKind struct {
+	// Limits the number of workers of this kind that run at the same time.
+	slots chan struct{}
+
+	lock sync.Mutex
+	idle []*worker
+}
+
+type worker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *json.Decoder
+}
+
+// NewPool returns a pool that runs up to maxWorkers workers of each kind and writes the stderr
+// of the workers to logDir.
+func NewPool(logDir string, maxWorkers int) *Pool {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	return &Pool{
+		logDir:     logDir,
+		maxWorkers: maxWorkers,
+		kinds:      make(map[string]*workerKind),
+	}
+}
+
+// Serve handles the requests on the listener until it is closed.
+func (p *Pool) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if p.isClosed() {
+				return nil
+			}
+			return err
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Pool) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: fmt.Sprintf("invalid request: %s", err)})
+		return
+	}
+	json.NewEncoder(conn).Encode(p.Do(req))
+}
+
+// Do runs the request in an idle worker of its kind, starting a new one if necessary.
+func (p *Pool) Do(req Request) Response {
+	if len(req.WorkerCommand) == 0 {
+		return Response{Error: "missing worker command"}
+	}
+	kind := p.kind(req.Mnemonic, req.WorkerCommand)
+	if kind == nil {
+		return Response{Error: "worker pool is shut down"}
+	}
+
+	kind.slots <- struct{}{}
+	defer func() { <-kind.slots }()
+
+	w := kind.takeIdle()
+	if w == nil {
+		var err error
+		w, err = p.startWorker(req.Mnemonic, req.WorkerCommand)
+		if err != nil {
+			return Response{Error: fmt.Sprintf("failed to start %s worker: %s", req.Mnemonic, err)}
+		}
+	}
+
+	resp, err := w.do(WorkRequest{Arguments: req.Arguments})
+	if err != nil {
+		// The worker is in an unknown state, don't reuse it.
+		p.killWorker(w)
+		return Response{Error: fmt.Sprintf("%s worker failed: %s", req.Mnemonic, err)}
+	}
+	kind.putIdle(w)
+	return Response{ExitCode: resp.ExitCode, Output: resp.Output}
+}
+
+func (p *Pool) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.closed
+}
+
+func (p *Pool) kind(mnemonic string, workerCommand []string) *workerKind {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil
+	}
+	key := mnemonic + "\x00" + strings.Join(workerCommand, "\x00")
+	kind, ok := p.kinds[key]
+	if !ok {
+		kind = &workerKind{slots: make(chan struct{}, p.maxWorkers)}
+		p.kinds[key] = kind
+	}
+	return kind
+}
+
+func (p *Pool) startWorker(mnemonic string, workerCommand []string) (*worker, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("worker pool is shut down")
+	}
+
+	cmd := exec.Command(workerCommand[0], append(workerCommand[1:], "--persistent_worker")...)
+	if p.logDir != "" {
+		if err := os.MkdirAll(p.logDir, 0777); err != nil {
+			return nil, err
+		}
+		logFile := filepath.Join(p.logDir, fmt.Sprintf("%s-%d.log", mnemonic, p.started))
+		log, err := os.Create(logFile)
+		if err != nil {
+			return nil, err
+		}
+		defer log.Close()
+		cmd.Stderr = log
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	w := &worker{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: json.NewDecoder(bufio.NewReader(stdout)),
+	}
+	p.workers = append(p.workers, w)
+	p.started++
+	return w, nil
+}
+
+// killWorker stops a worker and removes it from the pool.
+func (p *Pool) killWorker(w *worker) {
+	p.lock.Lock()
+	for i, other := range p.workers {
+		if other == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			break
+		}
+	}
+	p.lock.Unlock()
+
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+}
+
+// Close stops all the workers, the requests that are still running fail.
+func (p *Pool) Close() {
+	p.lock.Lock()
+	p.closed = true
+	workers := p.workers
+	p.workers = nil
+	p.lock.Unlock()
+
+	for _, w := range workers {
+		// Workers exit when their stdin is closed.
+		w.stdin.Close()
+	}
+	for _, w := range workers {
+		w.cmd.Wait()
+	}
+}
+
+func (k *workerKind) takeIdle() *worker {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if len(k.idle) == 0 {
+		return nil
+	}
+	w := k.idle[len(k.idle)-1]
+	k.idle = k.idle[:len(k.idle)-1]
+	return w
+}
+
+func (k *workerKind) putIdle(w *worker) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.idle = append(k.idle, w)
+}
+
+func (w *worker) do(req WorkRequest) (WorkResponse, error) {
+	var resp WorkResponse
+	if err := json.NewEncoder(w.stdin).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := w.stdout.Decode(&resp); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("worker exited")
+		}
+		return resp, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the test binary as a fake worker when it is started by the pool, the fake worker
+// echoes the arguments and its pid, and exits with the number of arguments.
+func TestMain(m *testing.M) {
+	if os.Args[len(os.Args)-1] == "--persistent_worker" {
+		fakeWorker(os.Args[1 : len(os.Args)-1])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func fakeWorker(args []string) {
+	in := json.NewDecoder(bufio.NewReader(os.Stdin))
+	out := json.NewEncoder(os.Stdout)
+	for {
+		var req WorkRequest
+		if err := in.Decode(&req); err != nil {
+			os.Exit(0)
+		}
+		if len(req.Arguments) > 0 && req.Arguments[0] == "crash" {
+			os.Exit(1)
+		}
+		out.Encode(WorkResponse{
+			ExitCode: len(req.Arguments),
+			Output:   fmt.Sprintf("%d %s", os.Getpid(), strings.Join(append(args, req.Arguments...), " ")),
+		})
+	}
+}
+
+func startTestPool(t *testing.T) (string, *Pool) {
+	dir, err := ioutil.TempDir("", "worker_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewPool(filepath.Join(dir, "logs"), 1)
+	go pool.Serve(l)
+	t.Cleanup(func() {
+		pool.Close()
+		l.Close()
+	})
+	return socket, pool
+}
+
+func TestPool(t *testing.T) {
+	socket, _ := startTestPool(t)
+	workerCommand := []string{os.Args[0], "worker-arg"}
+
+	pids := make(map[string]bool)
+	for _, args := range [][]string{{"a"}, {"b", "c"}} {
+		resp, err := Run(socket, Request{Mnemonic: "Test", WorkerCommand: workerCommand, Arguments: args})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if resp.ExitCode != len(args) {
+			t.Errorf("expected exit code %d, got %d", len(args), resp.ExitCode)
+		}
+		fields := strings.SplitN(resp.Output, " ", 2)
+		if expected := "worker-arg " + strings.Join(args, " "); fields[1] != expected {
+			t.Errorf("expected output %q, got %q", expected, fields[1])
+		}
+		pids[fields[0]] = true
+	}
+	if len(pids) != 1 {
+		t.Errorf("expected the worker to be reused, got workers %v", pids)
+	}
+
+	// A different worker command starts a different worker.
+	resp, err := Run(socket, Request{Mnemonic: "Test", WorkerCommand: []string{os.Args[0]}, Arguments: []string{"a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pid := strings.SplitN(resp.Output, " ", 2)[0]; pids[pid] {
+		t.Errorf("expected a new worker, got %s", pid)
+	}
+}
+
+func TestPool_WorkerFailure(t *testing.T) {
+	socket, pool := startTestPool(t)
+	workerCommand := []string{os.Args[0]}
+
+	_, err := Run(socket, Request{Mnemonic: "Test", WorkerCommand: workerCommand, Arguments: []string{"crash"}})
+	if err == nil || !strings.Contains(err.Error(), "Test worker failed") {
+		t.Errorf("expected a worker failure, got %v", err)
+	}
+
+	// The failed worker is replaced.
+	resp, err := Run(socket, Request{Mnemonic: "Test", WorkerCommand: workerCommand, Arguments: []string{"a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", resp.ExitCode)
+	}
+	pool.lock.Lock()
+	workers := len(pool.workers)
+	pool.lock.Unlock()
+	if workers != 1 {
+		t.Errorf("expected the failed worker to be removed from the pool, got %d workers", workers)
+	}
+
+	_, err = Run(socket, Request{Mnemonic: "Test", WorkerCommand: []string{"/does/not/exist"}})
+	if err == nil || !strings.Contains(err.Error(), "failed to start Test worker") {
+		t.Errorf("expected a worker start failure, got %v", err)
+	}
+}
+
+func TestRun_NoPool(t *testing.T) {
+	if _, err := Run("/does/not/exist", Request{}); err == nil {
+		t.Error("expected an error without a pool")
+	}
+}